@@ -3,9 +3,11 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/honganh1206/tinker/inference"
 	"github.com/honganh1206/tinker/mcp"
@@ -13,12 +15,19 @@ import (
 	"github.com/honganh1206/tinker/schema"
 	"github.com/honganh1206/tinker/server/api"
 	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tinkererr"
 	"github.com/honganh1206/tinker/tools"
 	"github.com/honganh1206/tinker/ui"
+	"github.com/honganh1206/tinker/utils"
 )
 
+var logger = utils.Logger("agent")
+
 type PlanUpdateCallback func(*data.Plan)
 
+// Retry was called while the conversation does not end with a message left unanswered
+var ErrNothingToRetry = errors.New("nothing to retry, the last turn did not fail")
+
 type Agent struct {
 	LLM     inference.LLMClient
 	ToolBox *tools.ToolBox
@@ -27,10 +36,36 @@ type Agent struct {
 	Client  *api.Client
 	ctl     *ui.Controller
 	MCP     mcp.Config
+	// Guard the toolbox and MCP state, since MCP servers register their tools in the background
+	toolsMu sync.RWMutex
 	// TODO: Default to be streaming. Be a dictator :)
 	streaming bool
 	// In the future it could be a map of agents, keys are task ID
 	Sub *Subagent
+	// Optional hook receiving typed events of a run.
+	// When set, tool results are reported here instead of as formatted deltas
+	OnEvent func(Event)
+	// Optional hook asked before each tool call, the call is skipped when it returns false
+	Approve func(ctx context.Context, name string, input json.RawMessage) bool
+	// USD spent on inference since the agent was created
+	sessionCost float64
+	// Context the MCP servers run under, for those started again later.
+	// This and the maps below are guarded by toolsMu
+	mcpCtx context.Context
+	// MCP servers that failed to start by ID, kept so they can be tried again
+	failedMCP map[string]failedMCPServer
+	// IDs of the MCP servers being restarted
+	restartingMCP map[string]bool
+	// Tools left out of requests for the rest of the session
+	disabledTools map[string]bool
+	// Messages sent while a run is in progress
+	queue messageQueue
+	// Bounds of each run
+	limits Limits
+	// Trace whose recorded results tool calls get instead of running, set by Replay
+	replay *Trace
+	// Filesystem of the file tools, the disk when nil
+	fs tools.FS
 }
 
 type Config struct {
@@ -42,6 +77,9 @@ type Config struct {
 	Plan         *data.Plan
 	Streaming    bool
 	Controller   *ui.Controller
+	Limits       Limits
+	// Optional filesystem for the file tools, e.g., a tools.WorkspaceFS
+	FS tools.FS
 }
 
 func New(config *Config) *Agent {
@@ -53,6 +91,8 @@ func New(config *Config) *Agent {
 		Client:    config.Client,
 		streaming: config.Streaming,
 		ctl:       config.Controller,
+		limits:    config.Limits,
+		fs:        config.FS,
 	}
 
 	agent.MCP.ServerConfigs = config.MCPConfigs
@@ -66,36 +106,92 @@ func New(config *Config) *Agent {
 // Run handles a single user message and returns the agent's response
 // This method is designed for TUI integration where streaming is handled externally
 func (a *Agent) Run(ctx context.Context, userInput string, onDelta func(string)) error {
-	readUserInput := true
+	return a.RunWithAttachments(ctx, userInput, nil, onDelta)
+}
+
+// Like Run, with blocks such as attached files sent after the text in the same user message
+func (a *Agent) RunWithAttachments(ctx context.Context, userInput string, attachments []message.ContentBlock, onDelta func(string)) error {
+	userMsg := &message.Message{
+		Role:    message.UserRole,
+		Content: append([]message.ContentBlock{message.NewTextBlock(userInput)}, attachments...),
+	}
+	return a.run(ctx, userMsg, onDelta)
+}
+
+// Run again the turn that failed, answering the last message of the conversation
+// instead of sending it twice
+func (a *Agent) Retry(ctx context.Context, onDelta func(string)) error {
+	n := len(a.Conv.Messages)
+	if n == 0 || a.Conv.Messages[n-1].Role != message.UserRole {
+		return ErrNothingToRetry
+	}
+	return a.run(ctx, nil, onDelta)
+}
+
+// Loop until the model stops calling tools, starting with userMsg unless it is nil
+func (a *Agent) run(parent context.Context, userMsg *message.Message, onDelta func(string)) error {
+	readUserInput := userMsg != nil
+
+	ctx, cancel, budget := a.startBudget(parent)
+	defer cancel()
+
+	a.startQueue()
+	// Whatever is left was sent for a run that did not finish
+	defer a.stopQueue()
 
 	// TODO: Add flag to know when to summarize
-	a.Conv.Messages = a.LLM.SummarizeHistory(a.Conv.Messages, 20)
+	if _, err := a.Compact(20); err != nil {
+		// The history is sent as it was compacted before
+		logger.Warn("failed to compact conversation", "conversation", a.Conv.ID, "err", err)
+	}
 
-	if len(a.Conv.Messages) != 0 {
-		a.LLM.ToNativeHistory(a.Conv.Messages)
+	if history := a.Conv.History(); len(history) != 0 {
+		a.LLM.ToNativeHistory(history)
 	}
 
-	a.LLM.ToNativeTools(a.ToolBox.Tools)
+	a.toolsMu.RLock()
+	a.LLM.ToNativeTools(a.enabledTools())
+	a.toolsMu.RUnlock()
 
+	// First message of the turn, what the answer may cite comes after it
+	turnStart := len(a.Conv.Messages)
 	for {
 		if readUserInput {
-			userMsg := &message.Message{
-				Role:    message.UserRole,
-				Content: []message.ContentBlock{message.NewTextBlock(userInput)},
-			}
-
 			err := a.LLM.ToNativeMessage(userMsg)
 			if err != nil {
 				return err
 			}
 
+			turnStart = len(a.Conv.Messages)
 			a.Conv.Append(userMsg)
 		}
 
-		agentMsg, err := a.streamResponse(ctx, onDelta)
+		// Saved so the run can be picked up again with Retry
+		if err := a.checkBudget(budget); err != nil {
+			a.saveConversation()
+			return err
+		}
+
+		// What the user has seen of the reply so far, kept if the run is interrupted
+		var partial strings.Builder
+		start := time.Now()
+		agentMsg, err := a.streamResponse(ctx, func(delta string) {
+			partial.WriteString(delta)
+			onDelta(delta)
+		})
 		if err != nil {
+			if parent.Err() != nil {
+				a.interrupted(partial.String())
+				return err
+			}
+			if err = budget.timedOut(parent, ctx, err); errors.Is(err, ErrLimitReached) {
+				a.saveConversation()
+			}
 			return err
 		}
+		budget.turns++
+
+		a.emitUsage(agentMsg, time.Since(start))
 
 		err = a.LLM.ToNativeMessage(agentMsg)
 		if err != nil {
@@ -108,7 +204,8 @@ func (a *Agent) Run(ctx context.Context, userInput string, onDelta func(string))
 		for _, c := range agentMsg.Content {
 			switch block := c.(type) {
 			case message.ToolUseBlock:
-				result := a.executeTool(block.ID, block.Name, block.Input, onDelta)
+				a.emit(Event{Type: EventToolCall, Tool: block.Name, ToolUseID: block.ID, Input: block.Input})
+				result := a.executeTool(ctx, block.ID, block.Name, block.Input, onDelta)
 				toolResults = append(toolResults, result)
 			}
 		}
@@ -117,7 +214,14 @@ func (a *Agent) Run(ctx context.Context, userInput string, onDelta func(string))
 			// If we reach this case, it means we have finished processing the tool results
 			// and we are safe to return the text response from the agent and wait for the next input.
 			readUserInput = true
+			a.cite(agentMsg, a.Conv.Messages[turnStart:])
 			a.saveConversation()
+
+			// Messages sent meanwhile are the next turn
+			if queued := a.takeQueued(true); len(queued) > 0 {
+				userMsg = &message.Message{Role: message.UserRole, Content: a.flushQueued(queued)}
+				continue
+			}
 			break
 		}
 
@@ -125,7 +229,7 @@ func (a *Agent) Run(ctx context.Context, userInput string, onDelta func(string))
 
 		toolResultMsg := &message.Message{
 			Role:    message.UserRole,
-			Content: toolResults,
+			Content: append(toolResults, a.flushQueued(a.takeQueued(false))...),
 		}
 
 		err = a.LLM.ToNativeMessage(toolResultMsg)
@@ -138,24 +242,81 @@ func (a *Agent) Run(ctx context.Context, userInput string, onDelta func(string))
 	return nil
 }
 
-func (a *Agent) executeTool(id, name string, input json.RawMessage, onDelta func(string)) message.ContentBlock {
+// Save the conversation of a run cut off by its caller, e.g., on Ctrl+C or shutdown,
+// along with the part of the reply already streamed
+func (a *Agent) interrupted(partial string) {
+	if text := strings.TrimSpace(partial); text != "" {
+		a.Conv.Append(&message.Message{
+			Role:    message.AssistantRole,
+			Content: []message.ContentBlock{message.NewTextBlock(text)},
+			Model:   a.LLM.ModelName(),
+		})
+	}
+	if err := a.saveConversation(); err != nil {
+		logger.Error("failed to save interrupted conversation", "conversation", a.Conv.ID, "err", err)
+	}
+}
+
+// Add to the answer citations of the files and pages it is based on. The provider
+// already has the message, it never gets them
+func (a *Agent) cite(answer *message.Message, turn []*message.Message) {
+	var text strings.Builder
+	for _, block := range answer.Content {
+		if b, ok := block.(message.TextBlock); ok {
+			text.WriteString(b.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return
+	}
+
+	for _, block := range citations(text.String(), turn) {
+		answer.Content = append(answer.Content, block)
+		c := block.(message.CitationBlock)
+		a.emit(Event{Type: EventCitation, Citation: &c})
+	}
+}
+
+func (a *Agent) executeTool(ctx context.Context, id, name string, input json.RawMessage, onDelta func(string)) message.ContentBlock {
 	var result message.ContentBlock
-	if execDetails, isMCPTool := a.MCP.ToolMap[name]; isMCPTool {
-		result = a.executeMCPTool(id, name, input, execDetails)
+	a.toolsMu.RLock()
+	execDetails, isMCPTool := a.MCP.ToolMap[name]
+	a.toolsMu.RUnlock()
+
+	start := time.Now()
+	if a.replay != nil {
+		// Disabled and denied calls were recorded as such too
+		result = a.replay.result(id, name)
+	} else if a.ToolDisabled(name) {
+		// Called anyway, e.g. because earlier messages show the model using it
+		result = message.NewToolResultBlock(id, name, "The user disabled this tool for the rest of the session", true)
+	} else if a.Approve != nil && !a.Approve(ctx, name, input) {
+		result = message.NewToolResultBlock(id, name, "The user denied running this tool call", true)
+	} else if isMCPTool {
+		result = a.executeMCPTool(ctx, id, name, input, execDetails)
 	} else {
 		result = a.executeLocalTool(id, name, input)
 	}
+	duration := time.Since(start)
 
+	var output string
 	isError := false
-	if toolResult, ok := result.(message.ToolResultBlock); ok && toolResult.IsError {
-		isError = true
+	if toolResult, ok := result.(message.ToolResultBlock); ok {
+		output = toolResult.Content
+		isError = toolResult.IsError
+	}
+
+	if a.OnEvent != nil {
+		a.emit(Event{Type: EventToolResult, Tool: name, ToolUseID: id, Output: output, IsError: isError, DurationMs: duration.Milliseconds()})
+	} else {
+		onDelta(FormatToolResultMessage(name, input, isError, duration))
 	}
-	onDelta(FormatToolResultMessage(name, input, isError))
 
 	return result
 }
 
-func FormatToolResultMessage(name string, input json.RawMessage, isError bool) string {
+// Summary line of a tool call, duration is left out when 0
+func FormatToolResultMessage(name string, input json.RawMessage, isError bool, duration time.Duration) string {
 	var detail string
 
 	switch name {
@@ -164,52 +325,52 @@ func FormatToolResultMessage(name string, input json.RawMessage, isError bool) s
 		if err == nil {
 			detail = i.Path
 		}
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Read", Detail: detail, IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Read", Detail: detail, IsError: isError, Duration: duration})
 
 	case tools.ToolNameEditFile:
 		i, err := schema.DecodeRaw[tools.EditFileInput](input)
 		if err == nil {
 			detail = i.Path
 		}
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Edit", Detail: detail, IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Edit", Detail: detail, IsError: isError, Duration: duration})
 
 	case tools.ToolNameListFiles:
 		i, err := schema.DecodeRaw[tools.ListFilesInput](input)
 		if err == nil {
 			detail = i.Path
 		}
-		return ui.FormatListFilesToolResult(ui.ToolResultFormat{Name: "List", Detail: detail, IsError: isError})
+		return ui.FormatListFilesToolResult(ui.ToolResultFormat{Name: "List", Detail: detail, IsError: isError, Duration: duration})
 
 	case tools.ToolNameBash:
 		i, err := schema.DecodeRaw[tools.BashInput](input)
 		if err == nil {
 			detail = i.Command
 		}
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Bash", Detail: detail, IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Bash", Detail: detail, IsError: isError, Duration: duration})
 
 	case tools.ToolNameFinder:
 		i, err := schema.DecodeRaw[tools.FinderInput](input)
 		if err == nil {
 			detail = i.Query
 		}
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Finder", Detail: detail, IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Finder", Detail: detail, IsError: isError, Duration: duration})
 
 	case tools.ToolNameGrepSearch:
 		i, err := schema.DecodeRaw[tools.GrepSearchInput](input)
 		if err == nil {
 			detail = i.Pattern
 		}
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Grep", Detail: detail, IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Grep", Detail: detail, IsError: isError, Duration: duration})
 
 	case tools.ToolNamePlanRead, tools.ToolNamePlanWrite:
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Plan", IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: "Plan", IsError: isError, Duration: duration})
 
 	default:
-		return ui.FormatToolResult(ui.ToolResultFormat{Name: name, IsError: isError})
+		return ui.FormatToolResult(ui.ToolResultFormat{Name: name, IsError: isError, Duration: duration})
 	}
 }
 
-func (a *Agent) executeMCPTool(id, name string, input json.RawMessage, toolDetails mcp.ToolDetails) message.ContentBlock {
+func (a *Agent) executeMCPTool(ctx context.Context, id, name string, input json.RawMessage, toolDetails mcp.ToolDetails) message.ContentBlock {
 	var args map[string]any
 
 	err := json.Unmarshal(input, &args)
@@ -221,7 +382,18 @@ func (a *Agent) executeMCPTool(id, name string, input json.RawMessage, toolDetai
 		args = make(map[string]any)
 	}
 
-	result, err := toolDetails.Server.Call(context.Background(), name, args)
+	onProgress := func(p mcp.ProgressParams) {
+		if a.ctl != nil {
+			a.ctl.TryPublish(&ui.State{ToolProgress: fmt.Sprintf("%s: %s", toolDetails.Server.ID(), p)})
+		}
+	}
+
+	// The server only knows the tool by its original name
+	result, err := toolDetails.Server.CallWithProgress(ctx, toolDetails.Name, args, onProgress)
+	if errors.Is(err, mcp.ErrCallTimeout) {
+		return message.NewToolResultBlock(id, name,
+			fmt.Sprintf("MCP tool %s timed out: %v. The server may be busy or stuck, try a smaller request or a different approach", name, err), true)
+	}
 	if err != nil {
 		return message.NewToolResultBlock(id, name,
 			fmt.Sprintf("MCP tool %s execution error: %v", name, err), true)
@@ -247,6 +419,7 @@ func (a *Agent) executeLocalTool(id, name string, input json.RawMessage) message
 	var toolDef *tools.ToolDefinition
 	var found bool
 	// TODO: Toolbox should be a map, not a list of tools
+	a.toolsMu.RLock()
 	for _, tool := range a.ToolBox.Tools {
 		if tool.Name == name {
 			toolDef = tool
@@ -254,6 +427,7 @@ func (a *Agent) executeLocalTool(id, name string, input json.RawMessage) message
 			break
 		}
 	}
+	a.toolsMu.RUnlock()
 
 	if !found {
 		errorMsg := "tool not found"
@@ -287,6 +461,7 @@ func (a *Agent) executeLocalTool(id, name string, input json.RawMessage) message
 			RawInput: input,
 			ToolObject: &tools.ToolObject{
 				Plan: &data.Plan{},
+				FS:   a.fs,
 			},
 		}
 
@@ -315,7 +490,7 @@ func (a *Agent) executePlanTool(toolDef *tools.ToolDefinition, toolInput tools.T
 
 	p, err = a.Client.GetPlan(a.Conv.ID)
 	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "not found") {
+		if errors.Is(err, tinkererr.NotFound) {
 			p, err = a.Client.CreatePlan(a.Conv.ID)
 			if err != nil {
 				return "", fmt.Errorf("plan_write: failed to create new plan for conversation with ID '%s' for adding steps: %w", a.Conv.ID, err)
@@ -340,9 +515,11 @@ func (a *Agent) executePlanTool(toolDef *tools.ToolDefinition, toolInput tools.T
 	a.Plan = p
 
 	// Send an update plan event to the UI
-	go func() {
-		a.ctl.Publish(&ui.State{Plan: p})
-	}()
+	if a.ctl != nil {
+		go func() {
+			a.ctl.Publish(&ui.State{Plan: p})
+		}()
+	}
 
 	return response, nil
 }
@@ -370,14 +547,12 @@ func (a *Agent) runSubagent(id, name, toolDescription string, rawInput json.RawM
 }
 
 func (a *Agent) saveConversation() error {
-	if len(a.Conv.Messages) > 0 {
-		err := a.Client.SaveConversation(a.Conv)
-		if err != nil {
-			return err
-		}
+	// Agents without a client, like those of replays, keep the conversation in memory
+	if len(a.Conv.Messages) == 0 || a.Client == nil {
+		return nil
 	}
 
-	return nil
+	return a.Client.SaveConversation(a.Conv)
 }
 
 func (a *Agent) streamResponse(ctx context.Context, onDelta func(string)) (*message.Message, error) {
@@ -401,3 +576,121 @@ func (a *Agent) streamResponse(ctx context.Context, onDelta func(string)) (*mess
 	return msg, nil
 }
 
+// Continue another conversation from the next Run on. Must not be called while a run is in progress
+func (a *Agent) SwitchConversation(conv *data.Conversation, plan *data.Plan) {
+	a.Conv = conv
+	a.Plan = plan
+}
+
+// Continue the conversation with other models. The history is converted for the new client right away,
+// so a provider that cannot take it is reported before the next message. A nil sub keeps the current subagent
+func (a *Agent) SwitchModel(llm, sub inference.LLMClient) error {
+	if history := a.Conv.History(); len(history) != 0 {
+		if err := llm.ToNativeHistory(history); err != nil {
+			return fmt.Errorf("failed to convert history for %s: %w", llm.ModelName(), err)
+		}
+	}
+
+	a.toolsMu.RLock()
+	err := llm.ToNativeTools(a.ToolBox.Tools)
+	a.toolsMu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to register tools for %s: %w", llm.ModelName(), err)
+	}
+
+	if sub != nil && a.Sub != nil {
+		subagent, err := NewSubagent(&Config{LLM: sub, ToolBox: a.Sub.toolBox, Streaming: a.Sub.streaming})
+		if err != nil {
+			return err
+		}
+		a.Sub = subagent
+	}
+	a.LLM = llm
+
+	return nil
+}
+
+// Summarize the messages between the first one and the last keep ones, which the history sent
+// from now on holds along with the summary. The messages stay in the conversation and the summary
+// is stored with it, so loading it again sends the same history. Returns how many messages
+// left the history sent
+func (a *Agent) Compact(keep int) (int, error) {
+	msgs := a.Conv.Messages
+	kept := a.LLM.SummarizeHistory(msgs, keep)
+	if len(kept) == 0 || len(kept) >= len(msgs) {
+		return 0, nil
+	}
+
+	// SummarizeHistory keeps the first message
+	from, to := 1, len(msgs)-len(kept)+1
+	// Results whose tool call was summarized would be rejected by the provider
+	for to < len(msgs) && msgs[to].Role == message.UserRole && len(msgs[to].Content) > 0 && msgs[to].Content[0].Type() == message.ToolResultType {
+		to++
+	}
+
+	// Summaries build on each other, the latest covers every compacted message
+	start, previous := from, ""
+	if latest := a.Conv.LatestSummary(); latest != nil && latest.From == from && latest.To <= len(msgs) {
+		if to <= latest.To {
+			return 0, nil
+		}
+		start, previous = latest.To, latest.Text
+	}
+
+	summary := &data.Summary{
+		From:      from,
+		To:        to,
+		Text:      summarizeMessages(previous, msgs[start:to]),
+		CreatedAt: time.Now(),
+	}
+
+	// The server only summarizes messages it holds
+	if err := a.saveConversation(); err != nil {
+		return 0, err
+	}
+	if err := a.Client.AddSummary(a.Conv.ID, summary); err != nil {
+		return 0, err
+	}
+	// Like the server, drop the summaries it supersedes
+	summaries := a.Conv.Summaries[:0]
+	for _, s := range a.Conv.Summaries {
+		if s.From != summary.From || s.To > summary.To {
+			summaries = append(summaries, s)
+		}
+	}
+	a.Conv.Summaries = append(summaries, summary)
+
+	return to - start, nil
+}
+
+// Replace block of message sequence with a tombstone, the whole message when block is negative,
+// on the server and in the history the next run sends. Must not be called while a run is in progress
+func (a *Agent) Redact(sequence, block int) error {
+	if sequence < 0 || sequence >= len(a.Conv.Messages) {
+		return fmt.Errorf("no message %d, the conversation has %d", sequence, len(a.Conv.Messages))
+	}
+	msg := a.Conv.Messages[sequence]
+	if block >= len(msg.Content) {
+		return fmt.Errorf("no block %d, message %d has %d", block, sequence, len(msg.Content))
+	}
+
+	if err := a.Client.RedactMessage(a.Conv.ID, sequence, block); err != nil {
+		return err
+	}
+
+	for i := range msg.Content {
+		if block < 0 || i == block {
+			msg.Content[i] = message.Redact(msg.Content[i])
+		}
+	}
+
+	// Like the server, drop the summaries that may quote it
+	summaries := a.Conv.Summaries[:0]
+	for _, s := range a.Conv.Summaries {
+		if s.From > sequence || s.To <= sequence {
+			summaries = append(summaries, s)
+		}
+	}
+	a.Conv.Summaries = summaries
+	return nil
+}
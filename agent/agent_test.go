@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/honganh1206/tinker/inference"
 	"github.com/honganh1206/tinker/mcp"
 	"github.com/honganh1206/tinker/message"
 	"github.com/honganh1206/tinker/server/api"
@@ -45,6 +48,11 @@ func (m *MockLLMClient) ProviderName() string {
 	return args.String(0)
 }
 
+func (m *MockLLMClient) ModelName() string {
+	args := m.Called()
+	return args.String(0)
+}
+
 func (m *MockLLMClient) ToNativeHistory(history []*message.Message) error {
 	args := m.Called(history)
 	return args.Error(0)
@@ -228,6 +236,30 @@ func TestAgent_Run_SimpleTextResponse(t *testing.T) {
 	mockLLM.AssertExpectations(t)
 }
 
+func TestAgent_RunWithAttachments(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(
+		createTestMessage(message.AssistantRole, "It prints hello"), nil)
+
+	attachments := []message.ContentBlock{message.NewFileBlock("main.go", "package main")}
+	err := agent.RunWithAttachments(context.Background(), "What does @main.go do?", attachments, func(string) {})
+
+	assert.NoError(t, err)
+	userMsg := agent.Conv.Messages[0]
+	assert.Len(t, userMsg.Content, 2)
+	assert.Equal(t, message.TextBlock{Text: "What does @main.go do?"}, userMsg.Content[0])
+
+	path, ok := userMsg.Content[1].(message.TextBlock).AttachedFile()
+	assert.True(t, ok)
+	assert.Equal(t, "main.go", path)
+
+	mockLLM.AssertExpectations(t)
+}
+
 func TestAgent_Run_WithToolUse(t *testing.T) {
 	agent, mockLLM := createTestAgent()
 
@@ -263,6 +295,227 @@ func TestAgent_Run_WithToolUse(t *testing.T) {
 	mockLLM.AssertExpectations(t)
 }
 
+func TestAgent_Run_EmitsToolEvents(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+
+	toolInput, _ := json.Marshal(map[string]string{"query": "test"})
+	toolUseMsg := &message.Message{
+		Role: message.AssistantRole,
+		Content: []message.ContentBlock{
+			message.NewToolUseBlock("tool-123", "test_tool", toolInput),
+		},
+		CreatedAt: time.Now(),
+	}
+	finalMsg := createTestMessage(message.AssistantRole, "Done")
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(toolUseMsg, nil).Once()
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(finalMsg, nil).Once()
+
+	var events []Event
+	agent.OnEvent = func(e Event) {
+		events = append(events, e)
+	}
+
+	var deltas []string
+	err := agent.Run(context.Background(), "Use the test tool", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, EventToolCall, events[0].Type)
+	assert.Equal(t, "tool-123", events[0].ToolUseID)
+	assert.Equal(t, EventToolResult, events[1].Type)
+	assert.Equal(t, "test result", events[1].Output)
+	assert.False(t, events[1].IsError)
+	// Structured consumers do not get the formatted tool line
+	assert.Empty(t, deltas)
+}
+
+func TestAgent_Run_DeniedTool(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+
+	toolInput, _ := json.Marshal(map[string]string{"query": "test"})
+	toolUseMsg := &message.Message{
+		Role: message.AssistantRole,
+		Content: []message.ContentBlock{
+			message.NewToolUseBlock("tool-123", "test_tool", toolInput),
+		},
+		CreatedAt: time.Now(),
+	}
+	finalMsg := createTestMessage(message.AssistantRole, "Done")
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(toolUseMsg, nil).Once()
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(finalMsg, nil).Once()
+
+	var asked []string
+	agent.Approve = func(ctx context.Context, name string, input json.RawMessage) bool {
+		asked = append(asked, name)
+		return false
+	}
+	var events []Event
+	agent.OnEvent = func(e Event) {
+		events = append(events, e)
+	}
+
+	err := agent.Run(context.Background(), "Use the test tool", func(string) {})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test_tool"}, asked)
+	assert.Len(t, events, 2)
+	assert.True(t, events[1].IsError)
+	assert.Contains(t, events[1].Output, "denied")
+}
+
+func TestAgent_Run_QueuedWithToolResults(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+
+	toolInput, _ := json.Marshal(map[string]string{"query": "test"})
+	toolUseMsg := &message.Message{
+		Role: message.AssistantRole,
+		Content: []message.ContentBlock{
+			message.NewToolUseBlock("tool-123", "test_tool", toolInput),
+		},
+		CreatedAt: time.Now(),
+	}
+	finalMsg := createTestMessage(message.AssistantRole, "Done")
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(toolUseMsg, nil).Once()
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(finalMsg, nil).Once()
+
+	// Sent while the tool call waits
+	agent.Approve = func(ctx context.Context, name string, input json.RawMessage) bool {
+		assert.True(t, agent.Enqueue("Use the other file", nil))
+		return false
+	}
+	var sent []string
+	agent.OnEvent = func(e Event) {
+		if e.Type == EventQueuedSent {
+			sent = append(sent, e.Text)
+		}
+	}
+
+	err := agent.Run(context.Background(), "Use the test tool", func(string) {})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Use the other file"}, sent)
+	// User message, tool call, results with the queued message, final answer
+	assert.Len(t, agent.Conv.Messages, 4)
+	results := agent.Conv.Messages[2].Content
+	assert.Len(t, results, 2)
+	assert.Equal(t, "Use the other file", results[1].(message.TextBlock).Text)
+}
+
+func TestAgent_Run_QueuedAfterResponse(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Run(func(mock.Arguments) {
+		agent.Enqueue("And in Go?", nil)
+	}).Return(createTestMessage(message.AssistantRole, "Like this"), nil).Once()
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(createTestMessage(message.AssistantRole, "Like that"), nil).Once()
+
+	err := agent.Run(context.Background(), "How do I sort a list?", func(string) {})
+
+	assert.NoError(t, err)
+	assert.Len(t, agent.Conv.Messages, 4)
+	assert.Equal(t, message.UserRole, agent.Conv.Messages[2].Role)
+	assert.Equal(t, "And in Go?", agent.Conv.Messages[2].Content[0].(message.TextBlock).Text)
+	// Nothing runs to take it anymore
+	assert.False(t, agent.Enqueue("Thanks", nil))
+	mockLLM.AssertExpectations(t)
+}
+
+func TestAgent_Run_MaxTurns(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+	agent.limits = Limits{MaxTurns: 1}
+
+	toolInput, _ := json.Marshal(map[string]string{"query": "test"})
+	toolUseMsg := &message.Message{
+		Role: message.AssistantRole,
+		Content: []message.ContentBlock{
+			message.NewToolUseBlock("tool-123", "test_tool", toolInput),
+		},
+		CreatedAt: time.Now(),
+	}
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(toolUseMsg, nil).Once()
+
+	err := agent.Run(context.Background(), "Use the test tool", func(string) {})
+
+	assert.ErrorIs(t, err, ErrLimitReached)
+	// The tool results are kept for a retry to answer
+	assert.Len(t, agent.Conv.Messages, 3)
+	assert.Equal(t, message.UserRole, agent.Conv.Messages[2].Role)
+	mockLLM.AssertExpectations(t)
+}
+
+func TestAgent_Run_MaxTime(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+	agent.limits = Limits{MaxTime: 10 * time.Millisecond}
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeHistory", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}).Return(nil, context.DeadlineExceeded).Once()
+
+	err := agent.Run(context.Background(), "Hello", func(string) {})
+	assert.ErrorIs(t, err, ErrLimitReached)
+
+	// Cancelled by the caller, not by the limit
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	agent.limits = Limits{MaxTime: time.Minute}
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(nil, context.Canceled).Once()
+
+	err = agent.Run(ctx, "Hello", func(string) {})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrLimitReached)
+}
+
+func TestAgent_Run_Interrupted(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{})
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("ModelName").Return("test-model")
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Run(func(args mock.Arguments) {
+		args.Get(1).(func(string))("The answer starts")
+		// Ctrl+C halfway through the reply
+		cancel()
+	}).Return(nil, context.Canceled).Once()
+
+	err := agent.Run(ctx, "Hello", func(string) {})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The streamed part of the reply is kept
+	assert.Len(t, agent.Conv.Messages, 2)
+	reply := agent.Conv.Messages[1]
+	assert.Equal(t, message.AssistantRole, reply.Role)
+	assert.Equal(t, "test-model", reply.Model)
+	assert.Equal(t, message.NewTextBlock("The answer starts"), reply.Content[0])
+}
+
 func TestAgent_Run_LLMError(t *testing.T) {
 	agent, mockLLM := createTestAgent()
 
@@ -286,6 +539,31 @@ func TestAgent_Run_LLMError(t *testing.T) {
 	mockLLM.AssertExpectations(t)
 }
 
+func TestAgent_Retry(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+
+	assert.ErrorIs(t, agent.Retry(context.Background(), func(string) {}), ErrNothingToRetry)
+
+	prompt := createTestMessage(message.UserRole, "Hello")
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{}).Once()
+	mockLLM.On("SummarizeHistory", mock.Anything, 20).Return([]*message.Message{prompt}).Once()
+	mockLLM.On("ToNativeHistory", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeTools", mock.Anything).Return(nil)
+	mockLLM.On("ToNativeMessage", mock.Anything).Return(nil)
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(nil, errors.New("overloaded")).Once()
+	mockLLM.On("RunInference", mock.Anything, mock.Anything, false).Return(createTestMessage(message.AssistantRole, "Hi"), nil).Once()
+
+	err := agent.Run(context.Background(), "Hello", func(string) {})
+	assert.Error(t, err)
+
+	err = agent.Retry(context.Background(), func(string) {})
+	assert.NoError(t, err)
+	// The prompt is answered, not sent a second time
+	assert.Len(t, agent.Conv.Messages, 2)
+	assert.Equal(t, message.UserRole, agent.Conv.Messages[0].Role)
+	assert.Equal(t, message.AssistantRole, agent.Conv.Messages[1].Role)
+}
+
 func TestAgent_executeLocalTool_Success(t *testing.T) {
 	agent, _ := createTestAgent()
 
@@ -348,7 +626,7 @@ func TestAgent_runSubagent_Success(t *testing.T) {
 	subLLM := &MockLLMClient{}
 	subToolBox := &tools.ToolBox{Tools: []*tools.ToolDefinition{}}
 	subLLM.On("ToNativeTools", subToolBox.Tools).Return(nil)
-	realSubagent := NewSubagent(&Config{
+	realSubagent, _ := NewSubagent(&Config{
 		LLM:       subLLM,
 		ToolBox:   subToolBox,
 		Streaming: false,
@@ -394,7 +672,7 @@ func TestAgent_runSubagent_SubagentError(t *testing.T) {
 	subLLM := &MockLLMClient{}
 	subToolBox := &tools.ToolBox{Tools: []*tools.ToolDefinition{}}
 	subLLM.On("ToNativeTools", subToolBox.Tools).Return(nil)
-	realSubagent := NewSubagent(&Config{
+	realSubagent, _ := NewSubagent(&Config{
 		LLM:       subLLM,
 		ToolBox:   subToolBox,
 		Streaming: false,
@@ -472,6 +750,26 @@ func TestAgent_streamResponse_Error(t *testing.T) {
 	mockLLM.AssertExpectations(t)
 }
 
+// Reports a fixed usage for every call
+type usageLLMClient struct {
+	*MockLLMClient
+	usage inference.Usage
+}
+
+func (m usageLLMClient) LastUsage() inference.Usage { return m.usage }
+
+func TestAgent_emitUsage(t *testing.T) {
+	agent, mockLLM := createTestAgent()
+	mockLLM.On("ModelName").Return("claude-sonnet-4-5")
+	agent.LLM = usageLLMClient{mockLLM, inference.Usage{InputTokens: 10, OutputTokens: 5, CacheReadTokens: 900, CacheWriteTokens: 30}}
+
+	msg := createTestMessage(message.AssistantRole, "Done")
+	agent.emitUsage(msg, 1500*time.Millisecond)
+
+	assert.Equal(t, "claude-sonnet-4-5", msg.Model)
+	assert.Equal(t, &message.Usage{InputTokens: 10, OutputTokens: 5, CacheReadTokens: 900, CacheWriteTokens: 30, LatencyMs: 1500}, msg.Usage)
+}
+
 func TestAgent_executeTool_LocalTool(t *testing.T) {
 	agent, _ := createTestAgent()
 
@@ -481,10 +779,117 @@ func TestAgent_executeTool_LocalTool(t *testing.T) {
 		deltaReceived += delta
 	}
 
-	result := agent.executeTool("tool-123", "test_tool", toolInput, onDelta)
+	result := agent.executeTool(context.Background(), "tool-123", "test_tool", toolInput, onDelta)
 
 	assert.IsType(t, message.ToolResultBlock{}, result)
 	toolResult := result.(message.ToolResultBlock)
 	assert.False(t, toolResult.IsError)
 	assert.Contains(t, deltaReceived, "test_tool") // Should contain success message
 }
+
+func TestAgent_Redact(t *testing.T) {
+	var got map[string]int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/conversations/conv-1/redact" {
+			http.NotFound(w, r)
+			return
+		}
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"status":"message redacted"}`))
+	}))
+	defer ts.Close()
+
+	agent, _ := createTestAgent()
+	agent.Client = api.NewClient(ts.URL)
+	agent.Conv.ID = "conv-1"
+	agent.Conv.Messages = []*message.Message{
+		createTestMessage(message.UserRole, "my token is hunter2"),
+		{Role: message.AssistantRole, Content: []message.ContentBlock{
+			message.NewTextBlock("Let me check"),
+			message.NewToolUseBlock("t1", "bash", json.RawMessage(`{"command":"echo hunter2"}`)),
+		}},
+	}
+
+	assert.NoError(t, agent.Redact(1, 1))
+	assert.Equal(t, map[string]int{"sequence": 1, "block": 1}, got)
+	assert.Equal(t, message.NewTextBlock("Let me check"), agent.Conv.Messages[1].Content[0])
+	assert.Equal(t, message.ToolUseBlock{ID: "t1", Name: "bash", Input: json.RawMessage(`{}`)}, agent.Conv.Messages[1].Content[1])
+
+	assert.NoError(t, agent.Redact(0, -1))
+	assert.Equal(t, map[string]int{"sequence": 0}, got)
+	assert.Equal(t, message.NewTextBlock(message.RedactedText), agent.Conv.Messages[0].Content[0])
+
+	assert.Error(t, agent.Redact(2, -1))
+	assert.Error(t, agent.Redact(1, 2))
+}
+
+func TestAgent_Compact(t *testing.T) {
+	var summaries []data.Summary
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/conversations/conv-1/messages":
+			var req struct {
+				From     int               `json:"from"`
+				Messages []json.RawMessage `json:"messages"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(map[string]int{"count": req.From + len(req.Messages)})
+		case "/conversations/conv-1/summaries":
+			var s data.Summary
+			json.NewDecoder(r.Body).Decode(&s)
+			summaries = append(summaries, s)
+			w.Write([]byte(`{"status":"summary added"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	agent, mockLLM := createTestAgent()
+	agent.Client = api.NewClient(ts.URL)
+	agent.Conv.ID = "conv-1"
+	for _, msg := range []*message.Message{
+		createTestMessage(message.UserRole, "Fix the tests"),
+		{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewToolUseBlock("t1", "bash", json.RawMessage(`{"command":"go test"}`))}},
+		{Role: message.UserRole, Content: []message.ContentBlock{message.NewToolResultBlock("t1", "bash", "ok", false)}},
+		createTestMessage(message.AssistantRole, "Fixed"),
+		createTestMessage(message.UserRole, "Now the docs"),
+		createTestMessage(message.AssistantRole, "Done"),
+	} {
+		agent.Conv.Append(msg)
+	}
+	msgs := agent.Conv.Messages
+
+	// The result of the summarized tool call goes along with it
+	mockLLM.On("SummarizeHistory", msgs, 4).Return(append([]*message.Message{msgs[0]}, msgs[2:]...)).Once()
+	dropped, err := agent.Compact(4)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, []data.Summary{{From: 1, To: 3, Text: "- assistant called bash", CreatedAt: summaries[0].CreatedAt}}, summaries)
+	assert.Len(t, agent.Conv.Messages, 6)
+
+	history := agent.Conv.History()
+	assert.Len(t, history, 5)
+	assert.Same(t, msgs[0], history[0])
+	assert.Contains(t, history[1].Content[0].(message.TextBlock).Text, "- assistant called bash")
+	assert.Same(t, msgs[3], history[2])
+
+	// Nothing new to summarize
+	mockLLM.On("SummarizeHistory", msgs, 4).Return(append([]*message.Message{msgs[0]}, msgs[2:]...)).Once()
+	dropped, err = agent.Compact(4)
+	assert.NoError(t, err)
+	assert.Zero(t, dropped)
+	assert.Len(t, summaries, 1)
+
+	// The next summary builds on the previous one and supersedes it
+	agent.Conv.Append(createTestMessage(message.UserRole, "Thanks"))
+	msgs = agent.Conv.Messages
+	mockLLM.On("SummarizeHistory", msgs, 3).Return(append([]*message.Message{msgs[0]}, msgs[4:]...)).Once()
+	dropped, err = agent.Compact(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, "- assistant called bash\n- assistant: Fixed", summaries[1].Text)
+	assert.Len(t, agent.Conv.Summaries, 1)
+	assert.Len(t, agent.Conv.History(), 5)
+}
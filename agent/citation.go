@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/tools"
+)
+
+// Shortest line of a source taken as quoted when an answer repeats it
+const minQuoteLen = 20
+
+// Citations of the files read and the pages fetched in msgs, the messages of a turn, for its answer.
+// A file whose lines the answer repeats is cited at those lines
+func citations(answer string, msgs []*message.Message) []message.ContentBlock {
+	calls := make(map[string]message.ToolUseBlock)
+	seen := make(map[string]bool)
+	var cited []message.ContentBlock
+
+	for _, msg := range msgs {
+		for _, block := range msg.Content {
+			switch b := block.(type) {
+			case message.ToolUseBlock:
+				calls[b.ID] = b
+			case message.ToolResultBlock:
+				call, ok := calls[b.ToolUseID]
+				if !ok || b.IsError {
+					continue
+				}
+				source, isFile := citedSource(call)
+				if source == "" || seen[source] {
+					continue
+				}
+				seen[source] = true
+
+				start, end, quote := quotedLines(answer, b.Content)
+				if !isFile {
+					// Lines of a fetched page mean little to the reader
+					start, end = 0, 0
+				}
+				cited = append(cited, message.NewCitationBlock(source, start, end, quote))
+			}
+		}
+	}
+
+	return cited
+}
+
+// File read or page fetched by call, empty for other tools
+func citedSource(call message.ToolUseBlock) (source string, isFile bool) {
+	if call.Name == tools.ToolNameReadFile {
+		var input tools.ReadFileInput
+		if err := json.Unmarshal(call.Input, &input); err != nil {
+			return "", false
+		}
+		return input.Path, true
+	}
+
+	// MCP tools fetching pages take their address as url
+	var input struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(call.Input, &input); err != nil {
+		return "", false
+	}
+	if strings.HasPrefix(input.URL, "http://") || strings.HasPrefix(input.URL, "https://") {
+		return input.URL, false
+	}
+	return "", false
+}
+
+// First run of lines of content the answer repeats, 1-based.
+// Zero and empty when it repeats none
+func quotedLines(answer, content string) (start, end int, quote string) {
+	lines := strings.Split(content, "\n")
+	quoted := func(line string) bool {
+		line = strings.TrimSpace(line)
+		return len(line) >= minQuoteLen && strings.Contains(answer, line)
+	}
+
+	for i, line := range lines {
+		if !quoted(line) {
+			continue
+		}
+		j := i
+		for j+1 < len(lines) && quoted(lines[j+1]) {
+			j++
+		}
+		return i + 1, j + 1, strings.Join(lines[i:j+1], "\n")
+	}
+	return 0, 0, ""
+}
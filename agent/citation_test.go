@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/tools"
+)
+
+func TestCitations(t *testing.T) {
+	turn := []*message.Message{
+		{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("How many retries?")}},
+		{Role: message.AssistantRole, Content: []message.ContentBlock{
+			message.NewToolUseBlock("1", tools.ToolNameReadFile, json.RawMessage(`{"path":"/src/retry.go"}`)),
+			message.NewToolUseBlock("2", "fetch", json.RawMessage(`{"url":"https://example.com/docs"}`)),
+			message.NewToolUseBlock("3", tools.ToolNameReadFile, json.RawMessage(`{"path":"/src/missing.go"}`)),
+			message.NewToolUseBlock("4", tools.ToolNameBash, json.RawMessage(`{"command":"ls"}`)),
+		}},
+		{Role: message.UserRole, Content: []message.ContentBlock{
+			message.NewToolResultBlock("1", tools.ToolNameReadFile, "package retry\n\n\tconst maxRetries = 3 // then give up\n\tconst backoffSeconds = 2 * time.Second\n}", false),
+			message.NewToolResultBlock("2", "fetch", "Retries are capped", false),
+			message.NewToolResultBlock("3", tools.ToolNameReadFile, "no such file", true),
+			message.NewToolResultBlock("4", tools.ToolNameBash, "retry.go", false),
+		}},
+		// Read again, cited once
+		{Role: message.AssistantRole, Content: []message.ContentBlock{
+			message.NewToolUseBlock("5", tools.ToolNameReadFile, json.RawMessage(`{"path":"/src/retry.go"}`)),
+		}},
+		{Role: message.UserRole, Content: []message.ContentBlock{
+			message.NewToolResultBlock("5", tools.ToolNameReadFile, "package retry", false),
+		}},
+	}
+	answer := "It gives up after three: `const maxRetries = 3 // then give up`, `const backoffSeconds = 2 * time.Second`."
+
+	got := citations(answer, turn)
+	want := []message.ContentBlock{
+		message.NewCitationBlock("/src/retry.go", 3, 4, "\tconst maxRetries = 3 // then give up\n\tconst backoffSeconds = 2 * time.Second"),
+		message.NewCitationBlock("https://example.com/docs", 0, 0, ""),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("citations() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("citation %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if c := got[0].(message.CitationBlock); c.Reference() != "/src/retry.go:3-4" {
+		t.Errorf("Reference() = %q, want /src/retry.go:3-4", c.Reference())
+	}
+}
@@ -0,0 +1,148 @@
+//go:build eval
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tools"
+)
+
+// Tokens a run asking for one file may use, prompts and tool descriptions included.
+// Listing a whole repository before reading the file used to take 200k
+const readFileTokenBudget = 30_000
+
+// Provider the evals run against, the one whose API key is set unless TINKER_EVAL_PROVIDER names one
+func evalProvider(t *testing.T) inference.ProviderName {
+	t.Helper()
+	if provider := os.Getenv("TINKER_EVAL_PROVIDER"); provider != "" {
+		return inference.ProviderName(provider)
+	}
+	switch {
+	case os.Getenv("GOOGLE_API_KEY") != "":
+		return inference.GoogleProvider
+	case os.Getenv("ANTHROPIC_API_KEY") != "":
+		return inference.AnthropicProvider
+	}
+	t.Skip("set GOOGLE_API_KEY or ANTHROPIC_API_KEY to run the evals")
+	return ""
+}
+
+// Repository with generated code enough to blow the budget when listed, and the file the task asks for
+func createEvalRepository(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+
+	files := map[string]string{
+		".git/HEAD":              "ref: refs/heads/main\n",
+		"README.md":              "# Shop\n\nAn online shop, see src/ for the code.\n",
+		"src/config/settings.go": "package config\n\n// Port the shop listens on unless PORT is set\nconst DefaultPort = 7312\n",
+	}
+	for i := range 2000 {
+		files[fmt.Sprintf("src/gen/models/model_%04d.go", i)] = fmt.Sprintf("package models\n\ntype Model%04d struct {\n\tID   int\n\tName string\n}\n", i)
+	}
+
+	for path, content := range files {
+		fullPath := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestEval_ReadFileTokens(t *testing.T) {
+	provider := evalProvider(t)
+	t.Chdir(createEvalRepository(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	llm, err := inference.Init(ctx, inference.BaseLLMClient{
+		Provider:   string(provider),
+		Model:      string(inference.GetDefaultModel(provider)),
+		TokenLimit: 8192,
+	})
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	subllm, err := inference.Init(ctx, inference.BaseLLMClient{
+		Provider:   string(provider),
+		Model:      string(inference.GetDefaultModelSubagent(provider)),
+		TokenLimit: 8192,
+	})
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	conv, _ := data.NewConversation()
+	a := New(&Config{
+		LLM:          llm,
+		Conversation: conv,
+		// The tools of an interactive session that work without a server
+		ToolBox: &tools.ToolBox{Tools: []*tools.ToolDefinition{
+			&tools.ReadFileDefinition,
+			&tools.ListFilesDefinition,
+			&tools.EditFileDefinition,
+			&tools.GrepSearchDefinition,
+			&tools.FinderDefinition,
+			&tools.BashDefinition,
+		}},
+		// Nothing listens there, the conversation is not saved
+		Client: api.NewClient(""),
+	})
+	a.Sub, err = NewSubagent(&Config{
+		LLM: subllm,
+		ToolBox: &tools.ToolBox{Tools: []*tools.ToolDefinition{
+			&tools.ReadFileDefinition,
+			&tools.GrepSearchDefinition,
+			&tools.ListFilesDefinition,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewSubagent() error = %v", err)
+	}
+
+	var used int64
+	var calls []string
+	a.OnEvent = func(e Event) {
+		switch e.Type {
+		case EventUsage:
+			used += e.Usage.InputTokens + e.Usage.CacheReadTokens + e.Usage.CacheWriteTokens + e.Usage.OutputTokens
+		case EventToolCall:
+			calls = append(calls, e.Tool)
+		}
+	}
+
+	if err := a.Run(ctx, "Read src/config/settings.go and tell me the value of DefaultPort.", func(string) {}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	t.Logf("%s used %d tokens, tools called: %s", llm.ModelName(), used, strings.Join(calls, ", "))
+
+	var answer strings.Builder
+	last := a.Conv.Messages[len(a.Conv.Messages)-1]
+	for _, block := range last.Content {
+		if text, ok := block.(message.TextBlock); ok {
+			answer.WriteString(text.Text)
+		}
+	}
+	if !strings.Contains(answer.String(), "7312") {
+		t.Errorf("answer = %q, want the port 7312", answer.String())
+	}
+	if used > readFileTokenBudget {
+		t.Errorf("reading one file used %d tokens, want at most %d", used, readFileTokenBudget)
+	}
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/ui"
+)
+
+type EventType string
+
+const (
+	EventText       EventType = "text"
+	EventToolCall   EventType = "tool_call"
+	EventToolResult EventType = "tool_result"
+	EventUsage      EventType = "usage"
+	// A message queued during the run went to the model, in Text
+	EventQueuedSent EventType = "queued_sent"
+	// A source the answer is based on, after the answer
+	EventCitation EventType = "citation"
+)
+
+// Event is a typed step of a run, for frontends that render it themselves
+// instead of consuming the TUI-formatted deltas
+type Event struct {
+	Type      EventType       `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Tool      string          `json:"tool,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	Output    string          `json:"output,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	// How long the tool took to run
+	DurationMs int64                  `json:"duration_ms,omitempty"`
+	Usage      *inference.Usage       `json:"usage,omitempty"`
+	Citation   *message.CitationBlock `json:"citation,omitempty"`
+}
+
+func (a *Agent) emit(e Event) {
+	if a.OnEvent != nil {
+		a.OnEvent(e)
+	}
+}
+
+// Report the tokens of the last inference call, if the client keeps track of them,
+// and keep them on msg, the reply the call produced in latency
+func (a *Agent) emitUsage(msg *message.Message, latency time.Duration) {
+	reporter, ok := a.LLM.(inference.UsageReporter)
+	if !ok {
+		return
+	}
+
+	usage := reporter.LastUsage()
+	msg.Model = a.LLM.ModelName()
+	msg.Usage = &message.Usage{
+		InputTokens:      usage.InputTokens,
+		OutputTokens:     usage.OutputTokens,
+		CacheReadTokens:  usage.CacheReadTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+		LatencyMs:        latency.Milliseconds(),
+	}
+	if p, ok := inference.PricingFor(a.LLM.ModelName()); ok {
+		a.sessionCost += p.Cost(usage)
+	}
+
+	a.emit(Event{Type: EventUsage, Usage: &usage})
+	if a.ctl != nil {
+		// Each update carries the totals, so a dropped one is made up by the next
+		a.ctl.TryPublish(&ui.State{Usage: &ui.UsageStatus{Usage: usage, SessionCost: a.sessionCost}})
+	}
+}
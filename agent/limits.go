@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A run stopped before the model was done, because of one of the Limits
+var ErrLimitReached = errors.New("limit reached")
+
+// Bounds of a single run, from the user message until the model stops calling tools.
+// Zero values do not limit anything
+type Limits struct {
+	// Calls to the model
+	MaxTurns int
+	// USD spent on inference, only known for the models with a price
+	MaxCost float64
+	MaxTime time.Duration
+}
+
+// Progress of a run against the limits
+type runBudget struct {
+	limits    Limits
+	turns     int
+	startCost float64
+	start     time.Time
+}
+
+// Bound ctx by MaxTime and start counting
+func (a *Agent) startBudget(ctx context.Context) (context.Context, context.CancelFunc, *runBudget) {
+	b := &runBudget{limits: a.limits, startCost: a.sessionCost, start: time.Now()}
+	if a.limits.MaxTime > 0 {
+		ctx, cancel := context.WithTimeout(ctx, a.limits.MaxTime)
+		return ctx, cancel, b
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, b
+}
+
+// Error wrapping ErrLimitReached when the next model call would go over a limit
+func (a *Agent) checkBudget(b *runBudget) error {
+	l := b.limits
+	if l.MaxTurns > 0 && b.turns >= l.MaxTurns {
+		return fmt.Errorf("%w: %d turns", ErrLimitReached, l.MaxTurns)
+	}
+	if spent := a.sessionCost - b.startCost; l.MaxCost > 0 && spent >= l.MaxCost {
+		return fmt.Errorf("%w: spent $%.4f of $%.2f", ErrLimitReached, spent, l.MaxCost)
+	}
+	if l.MaxTime > 0 && time.Since(b.start) >= l.MaxTime {
+		return b.timeout()
+	}
+	return nil
+}
+
+// The error of a run cut short by MaxTime rather than by its caller
+func (b *runBudget) timedOut(parent, ctx context.Context, err error) error {
+	if b.limits.MaxTime > 0 && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return b.timeout()
+	}
+	return err
+}
+
+func (b *runBudget) timeout() error {
+	return fmt.Errorf("%w: %s", ErrLimitReached, b.limits.MaxTime)
+}
@@ -1,86 +1,548 @@
 package agent
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/honganh1206/tinker/mcp"
+	"github.com/honganh1206/tinker/server/data"
 	"github.com/honganh1206/tinker/tools"
+	"github.com/honganh1206/tinker/ui"
 )
 
-func (a *Agent) RegisterMCPServers() {
-	// fmt.Printf("Initializing MCP servers based on %d configurations...\n", len(a.mcp.ServerConfigs))
+const (
+	// Default time a server gets to complete the initialization handshake
+	mcpStartupTimeout = 30 * time.Second
+	mcpPingInterval   = 30 * time.Second
+	mcpPingTimeout    = 5 * time.Second
+	// Restart a server after this many consecutive failed pings
+	mcpMaxPingFailures = 3
+)
+
+// Start the configured MCP servers concurrently and register their tools as each one comes up.
+// Every server gets its own startup timeout, so a slow or broken one
+// only delays its own tools instead of the whole agent.
+// Tools cached by a previous session are registered before returning,
+// the returned channel is closed once every server has started or given up
+func (a *Agent) RegisterMCPServers(ctx context.Context) <-chan struct{} {
+	var wg sync.WaitGroup
+
+	a.toolsMu.Lock()
+	a.mcpCtx = ctx
+	a.toolsMu.Unlock()
 
 	for _, serverCfg := range a.MCP.ServerConfigs {
-		// fmt.Printf("Attempting to create MCP server instance for ID %s (command: %s)\n", serverCfg.ID, serverCfg.Command)
-		server, err := mcp.NewServer(serverCfg.ID, serverCfg.Command)
+		server, err := mcp.NewServer(serverCfg)
 		if err != nil {
-			// TODO: Better error handling
+			logger.Error("failed to create MCP server", "server", serverCfg.ID, "command", serverCfg.Command, "err", err)
 			continue
 		}
 
-		if server == nil {
-			fmt.Fprintf(os.Stderr, "Error creating MCP server instance for ID %s (command: %s): NewServer returned nil\\n", serverCfg.ID, serverCfg.Command)
-			continue
+		cached := a.loadCachedMCPTools(serverCfg)
+		if cached != nil {
+			a.toolsMu.Lock()
+			a.MCP.ActiveServers = append(a.MCP.ActiveServers, server)
+			a.registerMCPTools(server, serverCfg, cached)
+			a.toolsMu.Unlock()
 		}
 
-		if err := server.Start(context.Background()); err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting MCP server %s (command: %s): %v\n", serverCfg.ID, serverCfg.Command, err)
-			continue
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.startMCPServer(ctx, server, serverCfg, cached != nil)
+
+			if a.ctl != nil {
+				a.ctl.TryPublish(&ui.State{MCPServers: a.MCPStatus()})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+func (a *Agent) startMCPServer(ctx context.Context, server *mcp.Server, serverCfg mcp.ServerConfig, fromCache bool) {
+	timeout := time.Duration(serverCfg.StartupTimeout)
+	if timeout <= 0 {
+		timeout = mcpStartupTimeout
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := server.Start(startCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("no response within %s", timeout)
 		}
+		// Start closed the server and killed its process already
+		logger.Error("failed to start MCP server", "server", serverCfg.ID, "command", serverCfg.Command, "err", err)
+
+		a.toolsMu.Lock()
+		if fromCache {
+			a.removeMCPServer(server)
+		}
+		if a.failedMCP == nil {
+			a.failedMCP = make(map[string]failedMCPServer)
+		}
+		a.failedMCP[serverCfg.ID] = failedMCPServer{config: serverCfg, err: err}
+		a.toolsMu.Unlock()
+		return
+	}
+
+	tools, err := server.ListTools(startCtx)
 
-		// fmt.Printf("MCP Server %s started successfully.\n", serverCfg.ID)
+	var prompts []*mcp.Prompt
+	if server.SupportsPrompts() {
+		var promptsErr error
+		if prompts, promptsErr = server.ListPrompts(startCtx); promptsErr != nil {
+			logger.Warn("failed to list prompts of MCP server", "server", server.ID(), "err", promptsErr)
+		}
+	}
+
+	a.toolsMu.Lock()
+	defer a.toolsMu.Unlock()
+
+	if len(prompts) > 0 {
+		if a.MCP.Prompts == nil {
+			a.MCP.Prompts = make(map[string][]*mcp.Prompt)
+		}
+		a.MCP.Prompts[server.ID()] = prompts
+	}
+
+	delete(a.failedMCP, serverCfg.ID)
+	// Keep the server active even if listing tools fails, it still shows up in the status
+	if !fromCache {
 		a.MCP.ActiveServers = append(a.MCP.ActiveServers, server)
+	}
 
-		// fmt.Printf("Fetching tools from MCP server %s...\n", server.ID())
-		tool, err := server.ListTools(context.Background()) // Using context.Background() for now
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing tools from MCP server %s: %v\\n", server.ID(), err)
-			// We might still want to keep the server active even if listing tools fails initially.
-			// Depending on desired robustness, could 'continue' here or allow agent to proceed.
+	if err != nil {
+		logger.Error("failed to list tools of MCP server", "server", server.ID(), "err", err)
+		return
+	}
+
+	a.MCP.Tools = append(a.MCP.Tools, tools)
+
+	// The fresh list wins over the cached one, in case the server changed its tools
+	a.unregisterMCPTools(server)
+	a.registerMCPTools(server, serverCfg, tools)
+
+	a.saveCachedMCPTools(serverCfg, tools)
+}
+
+// Add the allowed tools of a server to the toolbox.
+// Callers must hold toolsMu
+func (a *Agent) registerMCPTools(server *mcp.Server, serverCfg mcp.ServerConfig, tools mcp.Tools) {
+	// Only the allowed tools reach the model, keeping the tool definitions in the prompt small
+	for _, t := range tools {
+		if serverCfg.AllowsTool(t.Name) {
+			a.registerMCPTool(server, t)
+		}
+	}
+}
+
+// Drop every tool of a server from the toolbox.
+// Callers must hold toolsMu
+func (a *Agent) unregisterMCPTools(server *mcp.Server) {
+	for name, details := range a.MCP.ToolMap {
+		if details.Server != server {
 			continue
-			// return
 		}
-		// fmt.Printf("Fetched %d tools from MCP server %s\n", len(tool), server.ID())
-		a.MCP.Tools = append(a.MCP.Tools, tool)
+		delete(a.MCP.ToolMap, name)
+		a.ToolBox.Tools = slices.DeleteFunc(a.ToolBox.Tools, func(t *tools.ToolDefinition) bool {
+			return t.Name == name
+		})
+	}
+}
+
+// Callers must hold toolsMu
+func (a *Agent) removeMCPServer(server *mcp.Server) {
+	a.unregisterMCPTools(server)
+	a.MCP.ActiveServers = slices.DeleteFunc(a.MCP.ActiveServers, func(s *mcp.Server) bool {
+		return s == server
+	})
+}
+
+// Look up the tools a server exposed last time, nil on a cache miss
+func (a *Agent) loadCachedMCPTools(serverCfg mcp.ServerConfig) mcp.Tools {
+	if a.Client == nil {
+		return nil
+	}
+
+	cache, err := a.Client.GetMCPToolCache(serverCfg.CacheKey())
+	if err != nil {
+		return nil
+	}
+
+	var tools mcp.Tools
+	if err := json.Unmarshal(cache.Tools, &tools); err != nil {
+		return nil
+	}
+
+	return tools
+}
+
+func (a *Agent) saveCachedMCPTools(serverCfg mcp.ServerConfig, tools mcp.Tools) {
+	if a.Client == nil {
+		return
+	}
+
+	raw, err := json.Marshal(tools)
+	if err != nil {
+		return
+	}
+
+	err = a.Client.SaveMCPToolCache(&data.MCPToolCache{
+		Key:      serverCfg.CacheKey(),
+		ServerID: serverCfg.ID,
+		Tools:    raw,
+	})
+	if err != nil {
+		logger.Warn("failed to cache tools of MCP server", "server", serverCfg.ID, "err", err)
+	}
+}
 
-		for _, t := range tool {
-			toolName := fmt.Sprintf("%s_%s", server.ID(), t.Name)
+// Snapshot the servers registered so far
+func (a *Agent) activeMCPServers() []*mcp.Server {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+	return slices.Clone(a.MCP.ActiveServers)
+}
+
+// Add a server tool to the toolbox under its namespaced name.
+// Callers must hold toolsMu.
+// Names already taken by a local tool or another server's tool are disambiguated
+// with a numeric suffix instead of silently overwriting the existing tool.
+func (a *Agent) registerMCPTool(server *mcp.Server, t *mcp.Tool) {
+	baseName := mcp.NamespacedToolName(server.ID(), t.Name)
+	toolName := baseName
+
+	for i := 2; a.hasTool(toolName); i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		toolName = baseName[:min(len(baseName), mcp.MaxToolNameLength-len(suffix))] + suffix
+	}
+
+	description := fmt.Sprintf("[MCP server '%s', tool '%s'] %s", server.ID(), t.Name, t.Description)
+	if toolName != baseName {
+		logger.Warn("MCP tool collides with an existing tool", "server", server.ID(), "tool", t.Name, "registered_as", toolName)
+		description = fmt.Sprintf("%s\n\nNote: exposed as '%s' because another tool is already named '%s'. Prefer this tool only for tasks specific to the '%s' server.",
+			description, toolName, baseName, server.ID())
+	}
+
+	decl := &tools.ToolDefinition{
+		Name:        toolName,
+		Description: description,
+		InputSchema: t.InputSchema,
+	}
+
+	a.ToolBox.Tools = append(a.ToolBox.Tools, decl)
+
+	a.MCP.ToolMap[toolName] = mcp.ToolDetails{
+		Server: server,
+		Name:   t.Name,
+	}
+}
+
+func (a *Agent) hasTool(name string) bool {
+	for _, tool := range a.ToolBox.Tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ID of the MCP server providing a tool, empty for local tools
+func (a *Agent) MCPServerOf(name string) string {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+
+	details, ok := a.MCP.ToolMap[name]
+	if !ok {
+		return ""
+	}
+	return details.Server.ID()
+}
 
-			decl := &tools.ToolDefinition{
-				Name:        toolName,
-				Description: t.Description,
-				InputSchema: t.InputSchema,
+// Close every active MCP server with its shutdown sequence. They are closed together,
+// so a server slow to exit does not hold up the others
+func (a *Agent) ShutdownMCPServers() {
+	var wg sync.WaitGroup
+	for _, s := range a.activeMCPServers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Close(); err != nil {
+				logger.Warn("failed to close MCP server", "server", s.ID(), "err", err)
+			} else {
+				logger.Debug("closed MCP server", "server", s.ID())
 			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Ping every active MCP server on a timer until ctx is cancelled,
+// publishing their health to the UI and restarting unresponsive ones.
+func (a *Agent) MonitorMCPServers(ctx context.Context) {
+	for _, s := range a.activeMCPServers() {
+		go a.monitorMCPServer(ctx, s)
+	}
+}
+
+func (a *Agent) monitorMCPServer(ctx context.Context, s *mcp.Server) {
+	ticker := time.NewTicker(mcpPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-			a.ToolBox.Tools = append(a.ToolBox.Tools, decl)
+		pingCtx, cancel := context.WithTimeout(ctx, mcpPingTimeout)
+		_, err := s.Ping(pingCtx)
+		cancel()
 
-			a.MCP.ToolMap[toolName] = mcp.ToolDetails{
-				Server: server,
-				Name:   t.Name,
+		if err != nil && s.Health().Failures >= mcpMaxPingFailures && ctx.Err() == nil {
+			if restartErr := a.restartMCPServer(s); restartErr != nil {
+				logger.Error("failed to restart unresponsive MCP server", "server", s.ID(), "err", restartErr)
 			}
 		}
+
+		a.publishMCPStatus()
 	}
+}
+
+func (a *Agent) publishMCPStatus() {
+	if a.ctl != nil {
+		a.ctl.TryPublish(&ui.State{MCPServers: a.MCPStatus()})
+	}
+}
 
-	// Print all MCP tools that were added
-	if len(a.MCP.ToolMap) > 0 {
-		var mcpToolNames []string
-		for toolName := range a.MCP.ToolMap {
-			mcpToolNames = append(mcpToolNames, toolName)
+// Restart an MCP server on request, or try again one that failed to start
+func (a *Agent) RestartMCPServer(id string) error {
+	a.toolsMu.RLock()
+	failed, isFailed := a.failedMCP[id]
+	ctx := a.mcpCtx
+	var server *mcp.Server
+	for _, s := range a.MCP.ActiveServers {
+		if s.ID() == id {
+			server = s
 		}
-		// fmt.Printf("Added MCP tools to agent toolbox: %v\n", mcpToolNames)
 	}
+	a.toolsMu.RUnlock()
+
+	if server != nil {
+		return a.restartMCPServer(server)
+	}
+	if !isFailed {
+		return fmt.Errorf("no MCP server %s", id)
+	}
+
+	if !a.markRestarting(id) {
+		return fmt.Errorf("MCP server %s is already restarting", id)
+	}
+	defer a.unmarkRestarting(id)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// A server only gets one start attempt, so a new one takes its place
+	server, err := mcp.NewServer(failed.config)
+	if err != nil {
+		return err
+	}
+	a.startMCPServer(ctx, server, failed.config, false)
+
+	a.toolsMu.RLock()
+	failed, isFailed = a.failedMCP[id]
+	a.toolsMu.RUnlock()
+	if isFailed {
+		return failed.err
+	}
+
+	go a.monitorMCPServer(ctx, server)
+	return nil
 }
 
-func (a *Agent) ShutdownMCPServers() {
-	fmt.Println("shutting down MCP servers...")
+// Restart a running server in place and register the tools it now lists
+func (a *Agent) restartMCPServer(s *mcp.Server) error {
+	if !a.markRestarting(s.ID()) {
+		return fmt.Errorf("MCP server %s is already restarting", s.ID())
+	}
+	defer a.unmarkRestarting(s.ID())
+
+	// The process outlives whoever asked for the restart, so it must not inherit their context
+	if err := s.Restart(context.Background()); err != nil {
+		return err
+	}
+
+	a.toolsMu.RLock()
+	idx := slices.IndexFunc(a.MCP.ServerConfigs, func(cfg mcp.ServerConfig) bool {
+		return cfg.ID == s.ID()
+	})
+	a.toolsMu.RUnlock()
+	if idx < 0 {
+		return nil
+	}
+	serverCfg := a.MCP.ServerConfigs[idx]
+
+	listCtx, cancel := context.WithTimeout(context.Background(), mcpStartupTimeout)
+	defer cancel()
+	tools, err := s.ListTools(listCtx)
+	if err != nil {
+		return fmt.Errorf("restarted, but failed to list tools: %w", err)
+	}
+
+	a.toolsMu.Lock()
+	a.unregisterMCPTools(s)
+	a.registerMCPTools(s, serverCfg, tools)
+	a.toolsMu.Unlock()
+	return nil
+}
+
+// Flag a server as restarting and tell the UI, false if it already was
+func (a *Agent) markRestarting(id string) bool {
+	a.toolsMu.Lock()
+	if a.restartingMCP[id] {
+		a.toolsMu.Unlock()
+		return false
+	}
+	if a.restartingMCP == nil {
+		a.restartingMCP = make(map[string]bool)
+	}
+	a.restartingMCP[id] = true
+	a.toolsMu.Unlock()
+
+	a.publishMCPStatus()
+	return true
+}
+
+func (a *Agent) unmarkRestarting(id string) {
+	a.toolsMu.Lock()
+	delete(a.restartingMCP, id)
+	a.toolsMu.Unlock()
+
+	a.publishMCPStatus()
+}
+
+// Snapshot the health of the MCP servers, in the order they are configured
+func (a *Agent) MCPStatus() []ui.MCPServerStatus {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+
+	toolCounts := make(map[*mcp.Server]int)
+	for _, details := range a.MCP.ToolMap {
+		toolCounts[details.Server]++
+	}
+
+	statuses := make([]ui.MCPServerStatus, 0, len(a.MCP.ActiveServers)+len(a.failedMCP))
 	for _, s := range a.MCP.ActiveServers {
-		fmt.Printf("closing MCP server: %s\n", s.ID())
-		if err := s.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "error closing MCP server %s: %v\n", s.ID(), err)
-		} else {
-			fmt.Printf("MCP server %s closed successfully\n", s.ID())
+		h := s.Health()
+		status := ui.MCPServerStatus{
+			ID:      s.ID(),
+			Healthy: h.Healthy,
+			Latency: h.Latency,
+			State:   ui.MCPRunning,
+			Tools:   toolCounts[s],
+		}
+		switch {
+		// Offered from the tool cache, not up yet
+		case s.Starting():
+			status.State = ui.MCPStarting
+		case !h.Healthy:
+			status.State = ui.MCPFailed
+		}
+		if h.Err != nil {
+			status.Err = h.Err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	for id, failed := range a.failedMCP {
+		statuses = append(statuses, ui.MCPServerStatus{ID: id, State: ui.MCPFailed, Err: failed.err.Error()})
+	}
+	for i := range statuses {
+		if a.restartingMCP[statuses[i].ID] {
+			statuses[i].State = ui.MCPRestarting
+		}
+	}
+
+	order := make(map[string]int, len(a.MCP.ServerConfigs))
+	for i, cfg := range a.MCP.ServerConfigs {
+		order[cfg.ID] = i
+	}
+	slices.SortStableFunc(statuses, func(x, y ui.MCPServerStatus) int {
+		return cmp.Compare(order[x.ID], order[y.ID])
+	})
+
+	return statuses
+}
+
+// MCP server that failed to start, with what it needs to be tried again
+type failedMCPServer struct {
+	config mcp.ServerConfig
+	err    error
+}
+
+// Prompt of an MCP server, offered as a slash command
+type MCPPrompt struct {
+	Server string
+	*mcp.Prompt
+}
+
+// Snapshot the prompts of the active MCP servers, sorted by server and name
+func (a *Agent) MCPPrompts() []MCPPrompt {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+
+	var prompts []MCPPrompt
+	for serverID, serverPrompts := range a.MCP.Prompts {
+		for _, p := range serverPrompts {
+			prompts = append(prompts, MCPPrompt{Server: serverID, Prompt: p})
 		}
 	}
+	slices.SortFunc(prompts, func(x, y MCPPrompt) int {
+		return cmp.Or(cmp.Compare(x.Server, y.Server), cmp.Compare(x.Name, y.Name))
+	})
+
+	return prompts
+}
+
+// Fill in a prompt of an MCP server, returning the text to send as the user message
+func (a *Agent) RenderMCPPrompt(ctx context.Context, serverID, name string, args map[string]string) (string, error) {
+	var server *mcp.Server
+	for _, s := range a.activeMCPServers() {
+		if s.ID() == serverID {
+			server = s
+		}
+	}
+	if server == nil {
+		return "", fmt.Errorf("MCP server %s is not running", serverID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, server.CallTimeout())
+	defer cancel()
+
+	result, err := server.GetPrompt(ctx, name, args)
+	if err != nil {
+		return "", err
+	}
+
+	text := result.Text()
+	if text == "" {
+		return "", fmt.Errorf("prompt %s of %s has no text", name, serverID)
+	}
+	return text, nil
 }
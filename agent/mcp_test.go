@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/honganh1206/tinker/mcp"
+	"github.com/honganh1206/tinker/ui"
+)
+
+func TestAgent_registerMCPTool_Collision(t *testing.T) {
+	agent, _ := createTestAgent()
+
+	// "a_b" + "c" and "a" + "b_c" both namespace to "a_b_c"
+	first, err := mcp.NewServer(mcp.ServerConfig{ID: "a_b", Command: "echo"})
+	require.NoError(t, err)
+	second, err := mcp.NewServer(mcp.ServerConfig{ID: "a", Command: "echo"})
+	require.NoError(t, err)
+
+	agent.registerMCPTool(first, &mcp.Tool{Name: "c", Description: "First tool"})
+	agent.registerMCPTool(second, &mcp.Tool{Name: "b_c", Description: "Second tool"})
+
+	assert.Len(t, agent.MCP.ToolMap, 2)
+	assert.Equal(t, "c", agent.MCP.ToolMap["a_b_c"].Name)
+	assert.Same(t, first, agent.MCP.ToolMap["a_b_c"].Server)
+	assert.Equal(t, "b_c", agent.MCP.ToolMap["a_b_c_2"].Name)
+	assert.Same(t, second, agent.MCP.ToolMap["a_b_c_2"].Server)
+
+	last := agent.ToolBox.Tools[len(agent.ToolBox.Tools)-1]
+	assert.Equal(t, "a_b_c_2", last.Name)
+	assert.Contains(t, last.Description, "MCP server 'a'")
+	assert.Contains(t, last.Description, "another tool is already named 'a_b_c'")
+}
+
+func TestAgent_registerMCPTool_LocalToolCollision(t *testing.T) {
+	agent, _ := createTestAgent()
+
+	server, err := mcp.NewServer(mcp.ServerConfig{ID: "test", Command: "echo"})
+	require.NoError(t, err)
+
+	// The test agent already has a local tool named "test_tool"
+	agent.registerMCPTool(server, &mcp.Tool{Name: "tool"})
+
+	_, exists := agent.MCP.ToolMap["test_tool"]
+	assert.False(t, exists)
+	assert.Equal(t, "tool", agent.MCP.ToolMap["test_tool_2"].Name)
+}
+
+func TestAgent_RegisterMCPServers_SlowServerTimesOut(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	agent, _ := createTestAgent()
+
+	// Never answers the initialize request
+	agent.MCP.ServerConfigs = []mcp.ServerConfig{
+		{ID: "slow", Command: "sleep 10", StartupTimeout: mcp.Duration(100 * time.Millisecond)},
+		{ID: "broken", Command: "this-command-does-not-exist"},
+	}
+
+	start := time.Now()
+	<-agent.RegisterMCPServers(context.Background())
+
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, agent.MCP.ActiveServers)
+	assert.Empty(t, agent.MCP.ToolMap)
+
+	// Failed servers still show up, in the order they are configured
+	statuses := agent.MCPStatus()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "slow", statuses[0].ID)
+	assert.Equal(t, ui.MCPFailed, statuses[0].State)
+	assert.Contains(t, statuses[0].Err, "no response within")
+	assert.Equal(t, "broken", statuses[1].ID)
+
+	assert.Error(t, agent.RestartMCPServer("broken"))
+	assert.Error(t, agent.RestartMCPServer("unknown"))
+}
+
+func TestAgent_MCPStatus_Starting(t *testing.T) {
+	agent, _ := createTestAgent()
+
+	// Cached servers are active before their start attempt is over
+	server, err := mcp.NewServer(mcp.ServerConfig{ID: "cached", Command: "this-command-does-not-exist"})
+	require.NoError(t, err)
+	agent.MCP.ActiveServers = []*mcp.Server{server}
+
+	statuses := agent.MCPStatus()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, ui.MCPStarting, statuses[0].State)
+
+	require.Error(t, server.Start(context.Background()))
+	assert.Equal(t, ui.MCPFailed, agent.MCPStatus()[0].State)
+}
+
+func TestAgent_unregisterMCPTools(t *testing.T) {
+	agent, _ := createTestAgent()
+
+	server, err := mcp.NewServer(mcp.ServerConfig{ID: "fetch", Command: "echo"})
+	require.NoError(t, err)
+
+	cfg := mcp.ServerConfig{ID: "fetch", ExcludeTools: []string{"get_links"}}
+	agent.registerMCPTools(server, cfg, mcp.Tools{{Name: "get_page"}, {Name: "get_links"}})
+
+	assert.Len(t, agent.MCP.ToolMap, 1)
+	assert.Len(t, agent.ToolBox.Tools, 2)
+
+	agent.unregisterMCPTools(server)
+
+	assert.Empty(t, agent.MCP.ToolMap)
+	require.Len(t, agent.ToolBox.Tools, 1)
+	assert.Equal(t, "test_tool", agent.ToolBox.Tools[0].Name)
+}
+
+func TestAgent_SetToolDisabled(t *testing.T) {
+	agent, _ := createTestAgent()
+
+	agent.SetToolDisabled("test_tool", true)
+	assert.True(t, agent.ToolDisabled("test_tool"))
+	assert.Empty(t, agent.enabledTools())
+	assert.True(t, agent.ToolStatus()[0].Disabled)
+	// Still in the toolbox, to be enabled again
+	assert.Len(t, agent.ToolBox.Tools, 1)
+
+	agent.SetToolDisabled("test_tool", false)
+	assert.Len(t, agent.enabledTools(), 1)
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/inference/vcr"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tools"
+)
+
+// The agent loop against Anthropic's recorded answers: a tool call, then the reply to its result
+func TestAgent_Run_AnthropicCassette(t *testing.T) {
+	rec, err := vcr.New(filepath.Join("testdata", "read_file.json"))
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, rec.Stop())
+	}()
+
+	key := "replay"
+	if rec.Recording() {
+		key = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	client := anthropic.NewClient(option.WithHTTPClient(rec.Client()), option.WithAPIKey(key), option.WithMaxRetries(0))
+	llm := inference.NewAnthropicClient(&client, inference.Claude4Sonnet, 1024, "You are a helpful assistant.")
+
+	// The recorded call reads notes.txt of the working directory
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("notes.txt", []byte("buy milk"), 0o644))
+
+	conv, _ := data.NewConversation()
+	a := New(&Config{
+		LLM:          llm,
+		Conversation: conv,
+		ToolBox:      &tools.ToolBox{Tools: []*tools.ToolDefinition{&tools.ReadFileDefinition}},
+	})
+
+	var results []Event
+	a.OnEvent = func(e Event) {
+		if e.Type == EventToolResult {
+			results = append(results, e)
+		}
+	}
+
+	require.NoError(t, a.Run(context.Background(), "What is in notes.txt?", func(string) {}))
+
+	require.Len(t, results, 1)
+	assert.Equal(t, "read_file", results[0].Tool)
+	assert.Equal(t, "buy milk", results[0].Output)
+
+	require.Len(t, conv.Messages, 4)
+	answer := conv.Messages[3]
+	assert.Equal(t, message.NewTextBlock("It says to buy milk."), answer.Content[0])
+	assert.Equal(t, int64(360), answer.Usage.InputTokens)
+}
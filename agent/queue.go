@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+// Messages sent while a run is in progress, passed to the model at the next point the loop can take them:
+// along with the results of the tool calls, or as a new turn once the model is done
+type messageQueue struct {
+	mu      sync.Mutex
+	running bool
+	pending []*message.Message
+}
+
+// Queue a user message for the run in progress.
+// False when no run is in progress, the caller starts one with the message instead
+func (a *Agent) Enqueue(userInput string, attachments []message.ContentBlock) bool {
+	a.queue.mu.Lock()
+	defer a.queue.mu.Unlock()
+
+	if !a.queue.running {
+		return false
+	}
+	a.queue.pending = append(a.queue.pending, &message.Message{
+		Role:    message.UserRole,
+		Content: append([]message.ContentBlock{message.NewTextBlock(userInput)}, attachments...),
+	})
+	return true
+}
+
+func (a *Agent) startQueue() {
+	a.queue.mu.Lock()
+	defer a.queue.mu.Unlock()
+	a.queue.running = true
+}
+
+// Hand the queued messages over to the loop, ending the run when there are none and last is set,
+// so nothing can be queued after the loop has looked
+func (a *Agent) takeQueued(last bool) []*message.Message {
+	a.queue.mu.Lock()
+	defer a.queue.mu.Unlock()
+
+	queued := a.queue.pending
+	a.queue.pending = nil
+	if last && len(queued) == 0 {
+		a.queue.running = false
+	}
+	return queued
+}
+
+// End the run, dropping what is still queued e.g., when it failed
+func (a *Agent) stopQueue() {
+	a.queue.mu.Lock()
+	defer a.queue.mu.Unlock()
+	a.queue.running = false
+	a.queue.pending = nil
+}
+
+// Content of the queued messages in the order they were sent, reporting each as it goes to the model
+func (a *Agent) flushQueued(queued []*message.Message) []message.ContentBlock {
+	var content []message.ContentBlock
+	for _, msg := range queued {
+		if text, ok := msg.Content[0].(message.TextBlock); ok {
+			a.emit(Event{Type: EventQueuedSent, Text: text.Text})
+		}
+		content = append(content, msg.Content...)
+	}
+	return content
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tools"
+)
+
+// The agent loop did something else than the recorded run, e.g., asked the model
+// for another reply or called a tool the trace has no result for
+var ErrReplayDiverged = errors.New("replay diverged from the trace")
+
+// What a recorded run needs to play again: the prompts of the user, the replies of the
+// model in order and the result of each tool call by its ID.
+// A saved conversation is one, e.g., as exported with "tinker conversation export"
+type Trace struct {
+	// Messages as recorded, to compare the replay with
+	messages []*message.Message
+	prompts  []*message.Message
+	replies  []*message.Message
+	results  map[string]message.ContentBlock
+}
+
+func NewTrace(conv *data.Conversation) *Trace {
+	t := &Trace{messages: conv.Messages, results: make(map[string]message.ContentBlock)}
+	for _, msg := range conv.Messages {
+		switch msg.Role {
+		case message.AssistantRole:
+			// The model never saw the citations, the loop adds them again
+			t.replies = append(t.replies, withoutCitations(msg))
+		case message.UserRole:
+			isResults := false
+			for _, block := range msg.Content {
+				if result, ok := block.(message.ToolResultBlock); ok {
+					t.results[result.ToolUseID] = result
+					isResults = true
+				}
+			}
+			if !isResults {
+				t.prompts = append(t.prompts, msg)
+			}
+		}
+	}
+	return t
+}
+
+// Number of replies of the model in the trace
+func (t *Trace) Replies() int {
+	return len(t.replies)
+}
+
+// Run the prompts of trace through the agent loop again, the model answering with the recorded
+// replies and tool calls with the recorded results, so nothing reaches a provider or the system.
+// Returns the conversation of the replay, along with ErrReplayDiverged when it differs from the trace.
+// Messages queued while tools ran are not sent again, a trace with them diverges
+func Replay(ctx context.Context, trace *Trace, onEvent func(Event)) (*data.Conversation, error) {
+	conv, err := data.NewConversation()
+	if err != nil {
+		return nil, err
+	}
+
+	llm := &replayClient{trace: trace}
+	a := New(&Config{LLM: llm, Conversation: conv, ToolBox: &tools.ToolBox{}})
+	a.OnEvent = onEvent
+	a.replay = trace
+
+	for _, prompt := range trace.prompts {
+		if err := a.run(ctx, clone(prompt), func(string) {}); err != nil {
+			return conv, err
+		}
+	}
+
+	if llm.next < len(trace.replies) {
+		return conv, fmt.Errorf("%w: the runs ended after %d of %d replies", ErrReplayDiverged, llm.next, len(trace.replies))
+	}
+	if i := firstDifference(trace.messages, conv.Messages); i >= 0 {
+		return conv, fmt.Errorf("%w: message %d differs", ErrReplayDiverged, i)
+	}
+	return conv, nil
+}
+
+// Recorded result of the tool call id, an error result when there is none
+func (t *Trace) result(id, name string) message.ContentBlock {
+	if result, ok := t.results[id]; ok {
+		return result
+	}
+	return message.NewToolResultBlock(id, name, "The trace has no result for this tool call", true)
+}
+
+// Index of the first message whose role or content differs between a and b, -1 when none does
+func firstDifference(a, b []*message.Message) int {
+	for i := range max(len(a), len(b)) {
+		if i >= len(a) || i >= len(b) {
+			return i
+		}
+		// Content blocks hold raw JSON, comparing the encoding sidesteps its formatting
+		want, _ := json.Marshal(&message.Message{Role: a[i].Role, Content: a[i].Content})
+		got, _ := json.Marshal(&message.Message{Role: b[i].Role, Content: b[i].Content})
+		if string(want) != string(got) {
+			return i
+		}
+	}
+	return -1
+}
+
+func withoutCitations(msg *message.Message) *message.Message {
+	reply := clone(msg)
+	reply.Content = slices.DeleteFunc(reply.Content, func(block message.ContentBlock) bool {
+		return block.Type() == message.CitationType
+	})
+	return reply
+}
+
+// Copy of msg the replay can append to its conversation, leaving the trace as recorded
+func clone(msg *message.Message) *message.Message {
+	c := *msg
+	c.Content = slices.Clone(msg.Content)
+	return &c
+}
+
+// Model answering with the replies of a trace, in the order they were recorded
+type replayClient struct {
+	trace *Trace
+	// Index of the reply to answer with next
+	next int
+	last *message.Message
+}
+
+func (c *replayClient) RunInference(ctx context.Context, onDelta func(string), streaming bool) (*message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.next >= len(c.trace.replies) {
+		return nil, fmt.Errorf("%w: the agent asked for reply %d, the trace has %d", ErrReplayDiverged, c.next+1, len(c.trace.replies))
+	}
+
+	c.last = c.trace.replies[c.next]
+	c.next++
+
+	for _, block := range c.last.Content {
+		if text, ok := block.(message.TextBlock); ok {
+			onDelta(text.Text)
+		}
+	}
+	return clone(c.last), nil
+}
+
+// The usage recorded with the last reply, so limits on cost play out as they did
+func (c *replayClient) LastUsage() inference.Usage {
+	if c.last == nil || c.last.Usage == nil {
+		return inference.Usage{}
+	}
+	u := c.last.Usage
+	return inference.Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadTokens,
+		CacheWriteTokens: u.CacheWriteTokens,
+	}
+}
+
+func (c *replayClient) ModelName() string {
+	if c.last != nil && c.last.Model != "" {
+		return c.last.Model
+	}
+	return "replay"
+}
+
+func (c *replayClient) ProviderName() string {
+	return "replay"
+}
+
+// Nothing is compacted, the trace holds the conversation as it was sent
+func (c *replayClient) SummarizeHistory(history []*message.Message, threshold int) []*message.Message {
+	return history
+}
+
+func (c *replayClient) TruncateMessage(msg *message.Message, threshold int) *message.Message {
+	return msg
+}
+
+func (c *replayClient) ToNativeHistory(history []*message.Message) error {
+	return nil
+}
+
+func (c *replayClient) ToNativeMessage(msg *message.Message) error {
+	return nil
+}
+
+func (c *replayClient) ToNativeTools(tools []*tools.ToolDefinition) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// A run reading a file and answering from it, as "tinker conversation export" writes it
+const readFileTrace = `{
+  "ID": "trace",
+  "Messages": [
+    {"role": "user", "content": [{"type": "text", "text": "What is in notes.txt?"}]},
+    {"role": "assistant", "model": "claude-4-sonnet", "usage": {"input_tokens": 100, "output_tokens": 20},
+     "content": [{"type": "tool_use", "id": "call_1", "name": "read_file", "input": {"path": "notes.txt"}}]},
+    {"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "tool_name": "read_file", "content": "buy milk"}]},
+    {"role": "assistant", "model": "claude-4-sonnet", "content": [{"type": "text", "text": "It says to buy milk."}, {"type": "citation", "source": "notes.txt"}]},
+    {"role": "user", "content": [{"type": "text", "text": "Thanks"}]},
+    {"role": "assistant", "model": "claude-4-sonnet", "content": [{"type": "text", "text": "You're welcome."}]}
+  ]
+}`
+
+func loadTrace(t *testing.T, raw string) *Trace {
+	t.Helper()
+	var conv data.Conversation
+	require.NoError(t, json.Unmarshal([]byte(raw), &conv))
+	return NewTrace(&conv)
+}
+
+func TestReplay(t *testing.T) {
+	trace := loadTrace(t, readFileTrace)
+	assert.Equal(t, 3, trace.Replies())
+
+	var events []Event
+	conv, err := Replay(context.Background(), trace, func(e Event) {
+		events = append(events, e)
+	})
+	require.NoError(t, err)
+	require.Len(t, conv.Messages, 6)
+
+	// The tool is not run, its recorded result comes back
+	var results []Event
+	for _, e := range events {
+		if e.Type == EventToolResult {
+			results = append(results, e)
+		}
+	}
+	require.Len(t, results, 1)
+	assert.Equal(t, "read_file", results[0].Tool)
+	assert.Equal(t, "buy milk", results[0].Output)
+
+	assert.Equal(t, message.NewTextBlock("You're welcome."), conv.Messages[5].Content[0])
+	// The recorded usage is reported again
+	assert.Equal(t, int64(100), conv.Messages[1].Usage.InputTokens)
+}
+
+func TestReplay_MissingResult(t *testing.T) {
+	// The run was cut off before the tool ran, the model answered the next prompt
+	trace := loadTrace(t, `{"Messages": [
+		{"role": "user", "content": [{"type": "text", "text": "List the files"}]},
+		{"role": "assistant", "content": [{"type": "tool_use", "id": "call_1", "name": "list_files", "input": {}}]},
+		{"role": "user", "content": [{"type": "text", "text": "Never mind"}]},
+		{"role": "assistant", "content": [{"type": "text", "text": "Okay."}]}
+	]}`)
+
+	_, err := Replay(context.Background(), trace, nil)
+	assert.ErrorIs(t, err, ErrReplayDiverged)
+}
+
+func TestReplay_MissingReply(t *testing.T) {
+	trace := loadTrace(t, `{"Messages": [
+		{"role": "user", "content": [{"type": "text", "text": "What is in notes.txt?"}]},
+		{"role": "assistant", "content": [{"type": "tool_use", "id": "call_1", "name": "read_file", "input": {"path": "notes.txt"}}]},
+		{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "tool_name": "read_file", "content": "buy milk"}]}
+	]}`)
+
+	conv, err := Replay(context.Background(), trace, nil)
+	assert.ErrorIs(t, err, ErrReplayDiverged)
+	// What the loop did before asking for the missing reply is kept
+	assert.Len(t, conv.Messages, 3)
+}
@@ -19,20 +19,21 @@ type Subagent struct {
 	llm       inference.LLMClient
 	toolBox   *tools.ToolBox
 	streaming bool
+	fs        tools.FS
 }
 
-func NewSubagent(config *Config) *Subagent {
+func NewSubagent(config *Config) (*Subagent, error) {
 	err := config.LLM.ToNativeTools(config.ToolBox.Tools)
 	if err != nil {
-		// TODO: Return error instead of panicking
-		panic(fmt.Sprintf("failed to register subagent tools: %v", err))
+		return nil, fmt.Errorf("failed to register subagent tools: %w", err)
 	}
 
 	return &Subagent{
 		llm:       config.LLM,
 		toolBox:   config.ToolBox,
 		streaming: config.Streaming,
-	}
+		fs:        config.FS,
+	}, nil
 }
 
 func (s *Subagent) Run(
@@ -113,7 +114,8 @@ func (s *Subagent) executeTool(id, name string, input json.RawMessage) message.C
 	}
 
 	toolInput := tools.ToolInput{
-		RawInput: input,
+		RawInput:   input,
+		ToolObject: &tools.ToolObject{FS: s.fs},
 	}
 
 	response, err := toolDef.Function(toolInput)
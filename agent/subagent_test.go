@@ -32,7 +32,7 @@ func createTestSubagent() (*Subagent, *MockLLMClient) {
 	// Mock successful tool registration
 	mockLLM.On("ToNativeTools", toolBox.Tools).Return(nil)
 
-	subagent := NewSubagent(&Config{
+	subagent, _ := NewSubagent(&Config{
 		LLM:       mockLLM,
 		ToolBox:   toolBox,
 		Streaming: false,
@@ -55,12 +55,13 @@ func TestNewSubagent_Success(t *testing.T) {
 
 	mockLLM.On("ToNativeTools", toolBox.Tools).Return(nil)
 
-	subagent := NewSubagent(&Config{
+	subagent, err := NewSubagent(&Config{
 		LLM:       mockLLM,
 		ToolBox:   toolBox,
 		Streaming: true,
 	})
 
+	assert.NoError(t, err)
 	assert.NotNil(t, subagent)
 	assert.Equal(t, mockLLM, subagent.llm)
 	assert.Equal(t, toolBox, subagent.toolBox)
@@ -82,14 +83,13 @@ func TestNewSubagent_ToNativeToolsError(t *testing.T) {
 
 	mockLLM.On("ToNativeTools", toolBox.Tools).Return(errors.New("failed to register tools"))
 
-	// This should panic due to the error
-	assert.Panics(t, func() {
-		NewSubagent(&Config{
-			LLM:       mockLLM,
-			ToolBox:   toolBox,
-			Streaming: false,
-		})
+	subagent, err := NewSubagent(&Config{
+		LLM:       mockLLM,
+		ToolBox:   toolBox,
+		Streaming: false,
 	})
+	assert.Nil(t, subagent)
+	assert.ErrorContains(t, err, "failed to register tools")
 
 	mockLLM.AssertExpectations(t)
 }
@@ -327,7 +327,7 @@ func TestSubagent_executeTool_ToolError(t *testing.T) {
 	}
 
 	mockLLM.On("ToNativeTools", toolBox.Tools).Return(nil)
-	subagent := NewSubagent(&Config{
+	subagent, _ := NewSubagent(&Config{
 		LLM:       mockLLM,
 		ToolBox:   toolBox,
 		Streaming: false,
@@ -409,7 +409,7 @@ func TestSubagent_Run_MultipleToolCalls(t *testing.T) {
 	}
 
 	mockLLM.On("ToNativeTools", toolBox.Tools).Return(nil)
-	subagent := NewSubagent(&Config{
+	subagent, _ := NewSubagent(&Config{
 		LLM:       mockLLM,
 		ToolBox:   toolBox,
 		Streaming: false,
@@ -468,7 +468,7 @@ func TestSubagent_Run_StreamingMode(t *testing.T) {
 	}
 
 	mockLLM.On("ToNativeTools", toolBox.Tools).Return(nil)
-	subagent := NewSubagent(&Config{
+	subagent, _ := NewSubagent(&Config{
 		LLM:       mockLLM,
 		ToolBox:   toolBox,
 		Streaming: true,
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+const (
+	// Longest summary kept, its oldest lines are dropped first
+	maxSummaryLen = 8000
+	// Longest excerpt of a text block in a summary, in runes
+	maxSummaryExcerpt = 300
+)
+
+// Digest of msgs following the previous summary, one line per text or tool call:
+// what the user asked, what the assistant answered and which tools it used.
+// TODO: Have the subagent write summaries
+func summarizeMessages(previous string, msgs []*message.Message) string {
+	var lines []string
+	if previous != "" {
+		lines = strings.Split(previous, "\n")
+	}
+
+	for _, msg := range msgs {
+		for _, block := range msg.Content {
+			switch b := block.(type) {
+			case message.TextBlock:
+				if text := excerpt(b.Text); text != "" {
+					lines = append(lines, fmt.Sprintf("- %s: %s", msg.Role, text))
+				}
+			case message.ToolUseBlock:
+				lines = append(lines, fmt.Sprintf("- %s called %s", msg.Role, b.Name))
+			}
+		}
+	}
+
+	size := len(lines) - 1
+	for _, line := range lines {
+		size += len(line)
+	}
+	for len(lines) > 1 && size > maxSummaryLen {
+		size -= len(lines[0]) + 1
+		lines = lines[1:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Text on a single line, cut to maxSummaryExcerpt runes
+func excerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxSummaryExcerpt {
+		return string(runes[:maxSummaryExcerpt]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"slices"
+
+	"github.com/honganh1206/tinker/tools"
+)
+
+// A tool of the toolbox, as the status view lists it
+type ToolStatus struct {
+	Name string
+	// ID of the MCP server providing it, empty for local tools
+	Server   string
+	Disabled bool
+}
+
+// Snapshot the tools in the order they are offered to the model
+func (a *Agent) ToolStatus() []ToolStatus {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+
+	statuses := make([]ToolStatus, 0, len(a.ToolBox.Tools))
+	for _, t := range a.ToolBox.Tools {
+		status := ToolStatus{Name: t.Name, Disabled: a.disabledTools[t.Name]}
+		if details, ok := a.MCP.ToolMap[t.Name]; ok {
+			status.Server = details.Server.ID()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Leave a tool out of the next requests, or offer it again
+func (a *Agent) SetToolDisabled(name string, disabled bool) {
+	a.toolsMu.Lock()
+	defer a.toolsMu.Unlock()
+
+	if a.disabledTools == nil {
+		a.disabledTools = make(map[string]bool)
+	}
+	if disabled {
+		a.disabledTools[name] = true
+	} else {
+		delete(a.disabledTools, name)
+	}
+}
+
+func (a *Agent) ToolDisabled(name string) bool {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
+	return a.disabledTools[name]
+}
+
+// The toolbox without the disabled tools.
+// Callers must hold toolsMu
+func (a *Agent) enabledTools() []*tools.ToolDefinition {
+	if len(a.disabledTools) == 0 {
+		return a.ToolBox.Tools
+	}
+	return slices.DeleteFunc(slices.Clone(a.ToolBox.Tools), func(t *tools.ToolDefinition) bool {
+		return a.disabledTools[t.Name]
+	})
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/schema"
+	"github.com/honganh1206/tinker/tools"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+type approvalChoice int
+
+const (
+	denyCall approvalChoice = iota
+	allowOnce
+	allowAlways
+)
+
+// Tools the user allowed for the rest of the session
+type allowedTools struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (a *allowedTools) allow(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.names == nil {
+		a.names = make(map[string]bool)
+	}
+	a.names[name] = true
+}
+
+func (a *allowedTools) allowed(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.names[name]
+}
+
+// What the call would do: the lines an edit changes, the arguments of anything else
+func formatApprovalDetails(name string, input json.RawMessage) string {
+	theme := ui.CurrentTheme()
+
+	if name == tools.ToolNameEditFile {
+		if edit, err := schema.DecodeRaw[tools.EditFileInput](input); err == nil && edit.Path != "" {
+			var b strings.Builder
+			for _, line := range strings.Split(strings.TrimSuffix(edit.Diff(), "\n"), "\n") {
+				color := theme.Text
+				switch {
+				case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+					color = theme.Muted
+				case strings.HasPrefix(line, "-"):
+					color = theme.Error
+				case strings.HasPrefix(line, "+"):
+					color = theme.Success
+				}
+				fmt.Fprintf(&b, "[%s::]%s[-::]\n", color, tview.Escape(line))
+			}
+			return b.String()
+		}
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, input, "", "  "); err != nil {
+		return tview.Escape(string(input))
+	}
+	return tview.Escape(pretty.String())
+}
+
+// Overlay asking whether a tool call may run, Esc denies it
+func newApprovalPrompt(name string, input json.RawMessage, keys ui.Keymap, onChoice func(approvalChoice)) *tview.Flex {
+	theme := ui.CurrentTheme()
+
+	details := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true).
+		SetText(formatApprovalDetails(name, input))
+
+	buttons := tview.NewForm().
+		SetButtonsAlign(tview.AlignCenter).
+		AddButton(fmt.Sprintf("Allow once (%s)", keys.Describe(ui.ActionAllowOnce)), func() { onChoice(allowOnce) }).
+		AddButton(fmt.Sprintf("Allow always (%s)", keys.Describe(ui.ActionAllowAlways)), func() { onChoice(allowAlways) }).
+		AddButton(fmt.Sprintf("Deny (%s)", keys.Describe(ui.ActionDeny)), func() { onChoice(denyCall) })
+
+	prompt := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(details, 0, 1, false).
+		AddItem(buttons, 3, 0, true)
+	prompt.SetBorder(true).
+		SetTitle(fmt.Sprintf(" Run [%s::]%s[-::]? ", theme.Accent, tview.Escape(name))).
+		SetTitleAlign(tview.AlignLeft)
+
+	prompt.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case keys.Matches(ui.ActionAllowOnce, event):
+			onChoice(allowOnce)
+			return nil
+		case keys.Matches(ui.ActionAllowAlways, event):
+			onChoice(allowAlways)
+			return nil
+		case keys.Matches(ui.ActionDeny, event), keys.Matches(ui.ActionCancel, event):
+			onChoice(denyCall)
+			return nil
+		case event.Key() == tcell.KeyUp:
+			row, col := details.GetScrollOffset()
+			details.ScrollTo(max(row-1, 0), col)
+			return nil
+		case event.Key() == tcell.KeyDown:
+			row, col := details.GetScrollOffset()
+			details.ScrollTo(row+1, col)
+			return nil
+		}
+		return event
+	})
+
+	return prompt
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Lines the expanded error takes at most, it scrolls past that
+const maxBannerHeight = 8
+
+// Line above the input telling what went wrong, until dismissed.
+// Expands to the whole error, which can be long e.g., a provider's response body
+type errorBanner struct {
+	*tview.TextView
+	keys ui.Keymap
+	err  error
+	// Whether the turn that failed can be run again
+	retryable bool
+	expanded  bool
+}
+
+func newErrorBanner(keys ui.Keymap) *errorBanner {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(false)
+
+	return &errorBanner{TextView: view, keys: keys}
+}
+
+func (b *errorBanner) active() bool {
+	return b.err != nil
+}
+
+// Show err collapsed to its first line, returning the height the banner needs
+func (b *errorBanner) show(err error, retryable bool) int {
+	b.err = err
+	b.retryable = retryable
+	b.expanded = false
+	return b.render()
+}
+
+// Switch between the first line and the whole error
+func (b *errorBanner) toggle() int {
+	if !b.active() {
+		return 0
+	}
+	b.expanded = !b.expanded
+	return b.render()
+}
+
+func (b *errorBanner) dismiss() int {
+	b.err = nil
+	b.Clear()
+	return 0
+}
+
+func (b *errorBanner) render() int {
+	theme := ui.CurrentTheme()
+	message := strings.TrimSpace(b.err.Error())
+
+	hints := []string{}
+	if b.retryable {
+		hints = append(hints, b.keys.Describe(ui.ActionRetry)+" retry")
+	}
+	if b.expanded {
+		hints = append(hints, b.keys.Describe(ui.ActionErrorDetails)+" collapse")
+	} else {
+		hints = append(hints, b.keys.Describe(ui.ActionErrorDetails)+" details")
+	}
+	hints = append(hints, b.keys.Describe(ui.ActionCancel)+" dismiss")
+	hint := fmt.Sprintf("[%s::]%s[-::]", theme.Muted, tview.Escape(strings.Join(hints, " · ")))
+
+	if !b.expanded {
+		first, _, _ := strings.Cut(message, "\n")
+		b.SetWrap(false)
+		b.SetText(fmt.Sprintf("[%s::]%s %s[-::]  %s", theme.Error, ui.ErrorSymbol, tview.Escape(first), hint))
+		b.ScrollToBeginning()
+		return 1
+	}
+
+	b.SetWrap(true).SetWordWrap(true)
+	b.SetText(fmt.Sprintf("[%s::]%s %s[-::]\n%s", theme.Error, ui.ErrorSymbol, tview.Escape(message), hint))
+	b.ScrollToBeginning()
+	return min(wrappedLines(message, b.width())+1, maxBannerHeight)
+}
+
+func (b *errorBanner) width() int {
+	_, _, width, _ := b.GetInnerRect()
+	return width
+}
+
+// Lines text takes once wrapped at width, roughly as words may wrap earlier
+func wrappedLines(text string, width int) int {
+	lines := 0
+	for _, line := range strings.Split(text, "\n") {
+		lines++
+		if width > 0 {
+			lines += (utf8.RuneCountInString(line) - 1) / width
+		}
+	}
+	return lines
+}
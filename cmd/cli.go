@@ -10,15 +10,34 @@ import (
 	"github.com/honganh1206/tinker/agent"
 	"github.com/honganh1206/tinker/message"
 	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
 )
 
 const (
-	colorReset = "\033[0m"
-	colorBlue  = "\033[34m"
-	colorGreen = "\033[32m"
-	colorRed   = "\033[31m"
+	colorReset  = "\033[0m"
+	colorBlue   = "\033[34m"
+	colorGreen  = "\033[32m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorGray   = "\033[90m"
 )
 
+// Convert the tview color tags of tool results to ANSI codes.
+// The CLI leaves the colors to the terminal, so it keeps the default theme
+var ansiColors = func() *strings.Replacer {
+	theme := ui.CurrentTheme()
+	return strings.NewReplacer(
+		"["+theme.Success+"::]", colorGreen,
+		"["+theme.Error+"::]", colorRed,
+		"["+theme.Detail+"::]", colorBlue,
+		"["+theme.Muted+"::]", colorGray,
+		"["+theme.Text+"::-]", colorReset,
+		"["+theme.Text+"::]", colorReset,
+		"[-]", colorReset,
+	)
+}()
+
 func cli(ctx context.Context, a *agent.Agent) error {
 	isFirstInput := len(a.Conv.Messages) == 0
 
@@ -28,32 +47,55 @@ func cli(ctx context.Context, a *agent.Agent) error {
 		printConversationHistory(a.Conv)
 	}
 
+	// Read in the background, so an interrupt ends the session while waiting for input
 	scanner := bufio.NewScanner(os.Stdin)
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
 
 	for {
 		fmt.Printf("\n%s> %s", colorBlue, colorReset)
-		if !scanner.Scan() {
+		var line string
+		var ok bool
+		select {
+		case line, ok = <-lines:
+		case <-ctx.Done():
+			fmt.Println()
+			return nil
+		}
+		if !ok {
 			break
 		}
 		// Space between input and output
 		fmt.Println()
 
-		userInput := strings.TrimSpace(scanner.Text())
+		userInput := strings.TrimSpace(line)
 		if userInput == "" {
 			continue
 		}
 
 		onDelta := func(delta string) {
-			// Convert tview color tags to ANSI codes
-			delta = strings.ReplaceAll(delta, "[green::]", colorGreen)
-			delta = strings.ReplaceAll(delta, "[red::]", colorRed)
-			delta = strings.ReplaceAll(delta, "[blue::]", colorBlue)
-			delta = strings.ReplaceAll(delta, "[white::]", colorReset)
-			delta = strings.ReplaceAll(delta, "[-]", colorReset)
-			fmt.Print(delta)
+			fmt.Print(ansiColors.Replace(tview.Unescape(delta)))
 		}
 
-		err := a.Run(ctx, userInput, onDelta)
+		attachments, attached, skipped := attachMentions(userInput)
+		for _, path := range attached {
+			fmt.Printf("%sAttached %s%s\n", colorGray, path, colorReset)
+		}
+		for _, reason := range skipped {
+			fmt.Printf("%sNot attached: %s%s\n", colorYellow, reason, colorReset)
+		}
+
+		err := a.RunWithAttachments(ctx, userInput, attachments, onDelta)
+		if ctx.Err() != nil {
+			// The agent saved the run it was cut off from
+			fmt.Println()
+			return nil
+		}
 		if err != nil {
 			fmt.Printf("\n%sError: %v%s\n", colorRed, err, colorReset)
 			continue
@@ -99,7 +141,15 @@ func formatMessagePlain(msg *message.Message) string {
 	for _, block := range msg.Content {
 		switch b := block.(type) {
 		case message.TextBlock:
+			if path, ok := b.AttachedFile(); ok {
+				result.WriteString(fmt.Sprintf("%sAttached %s%s\n", colorGray, path, colorBlue))
+				continue
+			}
 			result.WriteString(b.Text + "\n")
+		case message.ImageBlock:
+			result.WriteString(fmt.Sprintf("%s%s%s\n", colorGray, b.Placeholder(), colorBlue))
+		case message.CitationBlock:
+			result.WriteString(fmt.Sprintf("%sSource: %s%s\n", colorGray, b.Reference(), colorBlue))
 		case message.ToolUseBlock:
 			result.WriteString(fmt.Sprintf("%s\u2713 %s %s\n", colorGreen, b.Name, b.Input))
 		}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Fenced block of an assistant response
+type codeBlock struct {
+	lang string
+	code string
+}
+
+// Text of the latest assistant message, empty when there is none yet
+func lastResponse(conv *data.Conversation) string {
+	for i := len(conv.Messages) - 1; i >= 0; i-- {
+		msg := conv.Messages[i]
+		if msg.Role != message.AssistantRole && msg.Role != message.ModelRole {
+			continue
+		}
+
+		var parts []string
+		for _, block := range msg.Content {
+			if b, ok := block.(message.TextBlock); ok && strings.TrimSpace(b.Text) != "" {
+				parts = append(parts, b.Text)
+			}
+		}
+		// A turn made only of tool calls, keep looking
+		if len(parts) > 0 {
+			return strings.Join(parts, "\n")
+		}
+	}
+	return ""
+}
+
+// Fenced code blocks of a markdown text. An unclosed fence runs to the end
+func codeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var current *codeBlock
+	var lines []string
+	var fence string
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if current == nil {
+			if marker := fenceMarker(trimmed); marker != "" {
+				current = &codeBlock{lang: strings.TrimSpace(trimmed[len(marker):])}
+				fence = marker
+				lines = nil
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			current.code = strings.Join(lines, "\n")
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if current != nil && len(lines) > 0 {
+		current.code = strings.Join(lines, "\n")
+		blocks = append(blocks, *current)
+	}
+
+	return blocks
+}
+
+// The run of backticks or tildes opening a fence, empty when line does not open one
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+func newCodeBlockPicker(blocks []codeBlock, keys ui.Keymap, onSelect func(codeBlock), onCancel func()) *tview.List {
+	list := tview.NewList()
+	list.SetBorder(true).
+		SetTitle(" Copy code block ").
+		SetTitleAlign(tview.AlignLeft)
+
+	for _, b := range blocks {
+		first, _, _ := strings.Cut(strings.TrimSpace(b.code), "\n")
+		lang := b.lang
+		if lang == "" {
+			lang = "text"
+		}
+		lineCount := strings.Count(b.code, "\n") + 1
+
+		list.AddItem(tview.Escape(first), fmt.Sprintf("[%s::]%s, %d lines[-::]", ui.CurrentTheme().Muted, tview.Escape(lang), lineCount), 0, func() { onSelect(b) })
+	}
+	// The latest block is usually the one wanted
+	list.SetCurrentItem(len(blocks) - 1)
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if keys.Matches(ui.ActionCancel, event) {
+			onCancel()
+			return nil
+		}
+		return event
+	})
+
+	return list
+}
@@ -1,18 +1,30 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"net"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/honganh1206/tinker/agent"
 	"github.com/honganh1206/tinker/inference"
 	"github.com/honganh1206/tinker/mcp"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/prompts"
 	"github.com/honganh1206/tinker/server"
 	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/server/data"
 	"github.com/honganh1206/tinker/utils"
 	"github.com/spf13/cobra"
 )
@@ -24,8 +36,17 @@ var (
 	continueConv     bool
 	convID           string
 	mcpServerCmd     string
+	mcpServerEnv     []string
+	mcpServerCwd     string
+	mcpServerStartup time.Duration
+	mcpCallTimeout   time.Duration
+	mcpIncludeTools  []string
+	mcpExcludeTools  []string
+	mcpServerHeaders []string
+	mcpServerBearer  string
 	mcpServerConfigs []mcp.ServerConfig
 	useTUI           bool
+	runLimits        agent.Limits
 )
 
 var (
@@ -42,19 +63,8 @@ func HelpHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func ChatHandler(cmd *cobra.Command, args []string) error {
-	new, err := cmd.Flags().GetBool("new-conversation")
-	if err != nil {
-		return err
-	}
-
-	id, err := cmd.Flags().GetString("id")
-	if err != nil {
-		return err
-	}
-
-	client := api.NewClient("")
-
+// Fill in the models and token limits the flags and the config left out
+func setDefaultModels() {
 	provider := inference.ProviderName(llm.Provider)
 	llmSub.Provider = llm.Provider
 	if llm.Model == "" {
@@ -70,7 +80,94 @@ func ChatHandler(cmd *cobra.Command, args []string) error {
 	// Default number of max tokens
 	if llm.TokenLimit == 0 {
 		llm.TokenLimit = 8192
-		llmSub.TokenLimit = 8192
+	}
+	if llmSub.TokenLimit == 0 {
+		llmSub.TokenLimit = llm.TokenLimit
+	}
+}
+
+func ChatHandler(cmd *cobra.Command, args []string) error {
+	new, err := cmd.Flags().GetBool("new-conversation")
+	if err != nil {
+		return err
+	}
+
+	id, err := cmd.Flags().GetString("id")
+	if err != nil {
+		return err
+	}
+
+	resume, err := cmd.Flags().GetBool("resume")
+	if err != nil {
+		return err
+	}
+
+	addDirs, err := cmd.Flags().GetStringArray("add-dir")
+	if err != nil {
+		return err
+	}
+	dirs, err := resolveDirs(addDirs)
+	if err != nil {
+		return err
+	}
+	llm.Dirs, llmSub.Dirs = dirs, dirs
+
+	prompt, err := cmd.Flags().GetString("prompt")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(outputFormats, output) {
+		return fmt.Errorf("unknown output format %q, expected one of %s", output, strings.Join(outputFormats, ", "))
+	}
+
+	// Piped input, e.g., git diff | tinker -p "review this diff", goes along with the prompt or is the prompt
+	stdin, truncated, err := readPipedStdin()
+	if err != nil {
+		return err
+	}
+	if prompt == "" && stdin != "" {
+		if truncated || len(stdin) > maxStdinVerbatim {
+			return fmt.Errorf("piped input is larger than %d KB, pass the prompt with --prompt to have it summarized as context", maxStdinVerbatim>>10)
+		}
+		prompt, stdin = strings.TrimSpace(stdin), ""
+	}
+
+	var run *headlessOptions
+	if prompt != "" {
+		run = &headlessOptions{prompt: prompt, output: output, stdin: stdin, stdinTruncated: truncated}
+	} else if cmd.Flags().Changed("output") {
+		return errors.New("--output only applies with --prompt")
+	}
+
+	if resume && (id != "" || run != nil || !useTUI) {
+		return errors.New("--resume opens a picker for the TUI, use --id to continue a conversation otherwise")
+	}
+
+	client := newAPIClient()
+
+	if resume {
+		id, err = pickConversation(client)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			return nil
+		}
+		new = false
+	}
+
+	setDefaultModels()
+
+	if runLimits.MaxTurns < 0 || runLimits.MaxCost < 0 || runLimits.MaxTime < 0 {
+		return errors.New("--max-turns, --max-cost and --max-time must be positive")
+	}
+	if _, ok := inference.PricingFor(llm.Model); runLimits.MaxCost > 0 && !ok {
+		fmt.Fprintf(os.Stderr, "%sThe price of %s is unknown, --max-cost is not enforced%s\n", colorYellow, llm.Model, colorReset)
 	}
 
 	var convID string
@@ -80,30 +177,148 @@ func ChatHandler(cmd *cobra.Command, args []string) error {
 		if id != "" {
 			convID = id
 		} else {
-			convID, err = client.GetLatestConversationID()
+			// Continue where we left off in this repository, not in whichever was used last
+			convID, err = client.GetLatestConversationID(utils.CurrentProject())
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	err = interactive(cmd.Context(), convID, llm, llmSub, client, mcpServerConfigs, useTUI)
+	var newVersion string
+	if run == nil {
+		newVersion = checkForUpdate()
+	}
+
+	// Interrupting cuts off the run in progress, which saves what it has before tinker exits
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Restore the default handlers so a second Ctrl+C exits right away
+		stop()
+	}()
+
+	err = interactive(ctx, convID, llm, llmSub, client, mcpServerConfigs, useTUI, run)
+	if run != nil {
+		// The exit status tells scripts whether the run failed, the usage would only get in the way
+		cmd.SilenceUsage = true
+		return err
+	}
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 	}
+	if newVersion != "" {
+		fmt.Fprintf(os.Stderr, "%stinker %s is available, you have %s. Run `tinker update` to install it%s\n", colorYellow, newVersion, Version, colorReset)
+	}
 
 	return nil
 }
 
+// Absolute paths of the directories given with --add-dir, which must exist
+func resolveDirs(dirs []string) ([]string, error) {
+	var resolved []string
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot add directory %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("cannot add directory %s: not a directory", dir)
+		}
+		if !slices.Contains(resolved, abs) {
+			resolved = append(resolved, abs)
+		}
+	}
+	return resolved, nil
+}
+
+// Resolve the server config, flags of the command win over the environment and the config file
+func loadServerConfig(cmd *cobra.Command) (config.Server, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return cfg, err
+	}
+
+	if cmd.Flags().Changed("host") {
+		cfg.Host, _ = cmd.Flags().GetString("host")
+	}
+	if cmd.Flags().Changed("port") {
+		cfg.Port, _ = cmd.Flags().GetString("port")
+	}
+	if cmd.Flags().Changed("database-url") {
+		cfg.Database, _ = cmd.Flags().GetString("database-url")
+	}
+	if cmd.Flags().Changed("socket") {
+		cfg.Socket, _ = cmd.Flags().GetString("socket")
+	}
+	if cmd.Flags().Changed("grpc-port") {
+		cfg.GRPCPort, _ = cmd.Flags().GetString("grpc-port")
+	}
+	if cmd.Flags().Changed("max-body-size") {
+		cfg.MaxBodySize, _ = cmd.Flags().GetInt64("max-body-size")
+	}
+	if cmd.Flags().Changed("rate-limit") {
+		cfg.RateLimit, _ = cmd.Flags().GetInt("rate-limit")
+	}
+
+	return cfg, cfg.Validate()
+}
+
 func RunServer(cmd *cobra.Command, args []string) error {
-	ln, err := net.Listen("tcp", ":11435")
+	cfg, err := loadServerConfig(cmd)
 	if err != nil {
 		return err
 	}
+
+	newToken, err := cmd.Flags().GetBool("new-token")
+	if err != nil {
+		return err
+	}
+
+	if newToken {
+		return NewTokenHandler(cfg.Database)
+	}
+
+	if stop, _ := cmd.Flags().GetBool("stop"); stop {
+		return stopServer()
+	}
+	if status, _ := cmd.Flags().GetBool("status"); status {
+		return serverStatus(api.NewClient(cfg.URL()))
+	}
+
+	ln, err := server.Listen(cfg)
+	if err != nil {
+		return err
+	}
+
+	removePID, err := writeServerPID()
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	defer removePID()
+	// Report the port the OS picked when asked for port 0
 	fmt.Printf("Running background server on %s\n", ln.Addr().String())
+
+	server.Version, server.GitCommit = Version, GitCommit
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		// Restore the default handlers so a second Ctrl+C exits right away
+		stop()
+	}()
+
 	// TODO: Can this be on a separate goroutine?
 	// so when I execute the command I return to my current shell session?
-	err = server.Serve(ln)
+	err = server.Serve(ctx, ln, cfg)
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	}
@@ -111,56 +326,538 @@ func RunServer(cmd *cobra.Command, args []string) error {
 	return err
 }
 
+func DBMigrateHandler(cmd *cobra.Command, args []string) error {
+	cfg, err := loadServerConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	applied, err := server.MigrateDatabase(cfg.Database)
+	for _, m := range applied {
+		fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("Database is up to date.")
+	}
+
+	return nil
+}
+
+func DBStatusHandler(cmd *cobra.Command, args []string) error {
+	cfg, err := loadServerConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := server.DatabaseStatus(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"Version", "Name", "Applied At"}
+	var data [][]string
+
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		data = append(data, []string{fmt.Sprintf("%04d", s.Version), s.Name, appliedAt})
+	}
+
+	utils.RenderTable(headers, data)
+
+	return nil
+}
+
+// Encrypt or decrypt the messages of the database, depending on the subcommand.
+// The server must be stopped, it reads the key once at startup
+func DBEncryptHandler(cmd *cobra.Command, args []string) error {
+	cfg, err := loadServerConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	var report server.EncryptionReport
+	switch cmd.Name() {
+	case "encrypt":
+		report, err = server.EncryptDatabase(cfg.Database)
+	case "decrypt":
+		report, err = server.DecryptDatabase(cfg.Database)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s database: %w", cmd.Name(), err)
+	}
+
+	fmt.Printf("Rewrote %d messages, %d summaries, %d attachments and %d archived conversations.\n", report.Messages, report.Summaries, report.Attachments, report.Archives)
+	if cmd.Name() == "encrypt" {
+		fmt.Println("Messages are now encrypted, titles, plans and tags stay in plain text.")
+		fmt.Printf("Keep a copy of the key, without it nothing can be read back. It is in the keyring unless %s is set.\n", config.DatabaseKeyEnv)
+	} else if os.Getenv(config.DatabaseKeyEnv) != "" {
+		fmt.Printf("Unset %s, or the server encrypts new messages again.\n", config.DatabaseKeyEnv)
+	}
+	return nil
+}
+
+// Issue an API token and save it for the local clients
+func NewTokenHandler(dsn string) error {
+	token, err := server.NewToken(dsn)
+	if err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	if err := api.SaveToken(token); err != nil {
+		return err
+	}
+
+	path, _ := api.TokenPath()
+	fmt.Printf("New API token (saved to %s, it will not be shown again):\n%s\n", path, token)
+	fmt.Printf("Other clients can authenticate with 'Authorization: Bearer <token>' or the %s environment variable\n", api.TokenEnv)
+
+	return nil
+}
+
 func ConversationHandler(cmd *cobra.Command, args []string) error {
 	list, err := cmd.Flags().GetBool("list")
 	if err != nil {
 		return err
 	}
 
-	flagsSet := 0
-	showType := ""
+	deleteID, err := cmd.Flags().GetString("delete")
+	if err != nil {
+		return err
+	}
+
+	tags, err := cmd.Flags().GetStringSlice("tag")
+	if err != nil {
+		return err
+	}
+
+	project, err := cmd.Flags().GetString("project")
+	if err != nil {
+		return err
+	}
+
+	archived, err := cmd.Flags().GetBool("archived")
+	if err != nil {
+		return err
+	}
+
+	if (len(tags) > 0 || project != "" || archived) && !list {
+		return errors.New("'--tag', '--project' and '--archived' can only be used with '--list'")
+	}
+	if project != "" {
+		project = utils.ProjectRoot(project)
+	}
+
+	flagsSet := 0
+	showType := ""
+
+	if list {
+		flagsSet++
+		showType = "list"
+	}
+
+	if deleteID != "" {
+		flagsSet++
+		showType = "delete"
+	}
+
+	if flagsSet > 1 {
+		return errors.New("only one of '--list' or '--delete' can be used")
+	}
+
+	client := newAPIClient()
+
+	if flagsSet == 1 {
+		switch showType {
+		case "list":
+			conversations, err := client.ListConversations(data.ListFilter{Project: project, Tags: tags, Archived: archived})
+			if err != nil {
+				return fmt.Errorf("error listing conversations: %w", err)
+			}
+
+			if len(conversations) == 0 {
+				fmt.Println("No conversations found.")
+			} else {
+
+				headers := []string{"ID", "Title", "Project", "Model", "Tags", "Created", "Last Message", "Messages"}
+				var data [][]string
+
+				for _, conv := range conversations {
+					// Archived messages are out of the database, they are not counted
+					count := fmt.Sprintf("%d", conv.MessageCount)
+					if conv.ArchivedAt != nil {
+						count = "archived"
+					}
+					row := []string{
+						conv.ID,
+						conv.Title,
+						conv.Project,
+						conv.Model,
+						strings.Join(conv.Tags, ", "),
+						// TODO: A more read-friendly format?
+						conv.CreatedAt.Format(time.RFC3339),
+						conv.LatestMessageTime.Format(time.RFC3339),
+						count,
+					}
+					data = append(data, row)
+				}
+
+				utils.RenderTable(headers, data)
+			}
+		case "delete":
+			return deleteConversation(client, deleteID)
+		}
+	}
+
+	return nil
+}
+
+func deleteConversation(client *api.Client, id string) error {
+	if err := client.DeleteConversation(id); err != nil {
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return fmt.Errorf("conversation %s not found", id)
+		}
+		return fmt.Errorf("error deleting conversation: %w", err)
+	}
+	fmt.Printf("Deleted conversation %s\n", id)
+	return nil
+}
+
+// Delete conversations by ID, or every one left untouched for longer than --older-than
+func ConversationDeleteHandler(cmd *cobra.Command, args []string) error {
+	olderThan, err := cmd.Flags().GetString("older-than")
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	if (olderThan == "") == (len(args) == 0) {
+		return errors.New("give either conversation IDs or '--older-than'")
+	}
+
+	client := newAPIClient()
+
+	ids := args
+	if olderThan != "" {
+		age, err := config.ParseAge(olderThan)
+		if err != nil {
+			return err
+		}
+
+		conversations, err := client.ListConversations(data.ListFilter{})
+		if err != nil {
+			return fmt.Errorf("error listing conversations: %w", err)
+		}
+
+		cutoff := time.Now().Add(-age)
+		for _, conv := range conversations {
+			last := conv.LatestMessageTime
+			if last.IsZero() {
+				last = conv.CreatedAt
+			}
+			if last.Before(cutoff) {
+				ids = append(ids, conv.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			fmt.Printf("No conversations older than %s.\n", olderThan)
+			return nil
+		}
+	}
+
+	if dryRun {
+		for _, id := range ids {
+			fmt.Printf("Would delete conversation %s\n", id)
+		}
+		return nil
+	}
+
+	for _, id := range ids {
+		if err := deleteConversation(client, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ConversationRenameHandler(cmd *cobra.Command, args []string) error {
+	id, title := args[0], strings.Join(args[1:], " ")
+
+	if err := newAPIClient().RenameConversation(id, title); err != nil {
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return fmt.Errorf("conversation %s not found", id)
+		}
+		return fmt.Errorf("error renaming conversation: %w", err)
+	}
+
+	fmt.Printf("Renamed conversation %s to %q\n", id, title)
+	return nil
+}
+
+// Archive or unarchive conversations, depending on the command name
+func ConversationArchiveHandler(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+
+	for _, id := range args {
+		var err error
+		if cmd.Name() == "unarchive" {
+			err = client.UnarchiveConversation(id)
+		} else {
+			err = client.ArchiveConversation(id)
+		}
+
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return fmt.Errorf("conversation %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating conversation %s: %w", id, err)
+		}
+		fmt.Printf("%sd conversation %s\n", strings.ToUpper(cmd.Name()[:1])+cmd.Name()[1:], id)
+	}
+
+	return nil
+}
+
+func ConversationForkHandler(cmd *cobra.Command, args []string) error {
+	at, err := cmd.Flags().GetInt("at")
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	fork, err := newAPIClient().ForkConversation(id, at)
+	if err != nil {
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return fmt.Errorf("conversation %s not found", id)
+		}
+		return fmt.Errorf("error forking conversation: %w", err)
+	}
+
+	fmt.Printf("Forked conversation %s with %d messages into %s, continue it with: tinker --id %s\n", id, fork.ForkSequence, fork.ID, fork.ID)
+	return nil
+}
+
+// Run the agent loop over a recorded conversation again, without a provider or tools,
+// printing its events as JSON lines
+func ConversationReplayHandler(cmd *cobra.Command, args []string) error {
+	conv, err := loadTrace(args[0])
+	if err != nil {
+		return err
+	}
+
+	trace := agent.NewTrace(conv)
+	enc := json.NewEncoder(os.Stdout)
+	_, err = agent.Replay(cmd.Context(), trace, func(e agent.Event) {
+		enc.Encode(e)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%sReplayed %d replies, the run matches the trace%s\n", colorGray, trace.Replies(), colorReset)
+	return nil
+}
+
+// Conversation exported to the file at arg, or saved under the ID arg otherwise
+func loadTrace(arg string) (*data.Conversation, error) {
+	raw, err := os.ReadFile(arg)
+	if errors.Is(err, os.ErrNotExist) {
+		conv, err := newAPIClient().GetConversation(arg)
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return nil, fmt.Errorf("no file or conversation %s", arg)
+		}
+		return conv, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var conv data.Conversation
+	if err := json.Unmarshal(raw, &conv); err != nil {
+		return nil, fmt.Errorf("%s is not a conversation exported as JSON: %w", arg, err)
+	}
+	return &conv, nil
+}
+
+// Replace a message, or one of its content blocks, with a tombstone
+func ConversationRedactHandler(cmd *cobra.Command, args []string) error {
+	id := args[0]
+	sequence, err := strconv.Atoi(args[1])
+	if err != nil || sequence < 0 {
+		return fmt.Errorf("message must be the number of a message, counting from 0")
+	}
+	block := -1
+	if len(args) == 3 {
+		if block, err = strconv.Atoi(args[2]); err != nil || block < 0 {
+			return fmt.Errorf("block must be the number of a content block, counting from 0")
+		}
+	}
+
+	if err := newAPIClient().RedactMessage(id, sequence, block); err != nil {
+		return fmt.Errorf("error redacting message: %w", err)
+	}
+
+	if block < 0 {
+		fmt.Printf("Redacted message %d of conversation %s\n", sequence, id)
+	} else {
+		fmt.Printf("Redacted block %d of message %d of conversation %s\n", block, sequence, id)
+	}
+	return nil
+}
+
+// Attach or detach tags of a conversation, depending on the command name
+func ConversationTagHandler(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	id, tags := args[0], args[1:]
+
+	for _, tag := range tags {
+		var err error
+		if cmd.Name() == "untag" {
+			err = client.Untag(data.TagConversation, id, tag)
+		} else {
+			err = client.Tag(data.TagConversation, id, tag)
+		}
+
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return fmt.Errorf("conversation %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating tag %s: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+// Full-text search over the messages of every conversation
+func ConversationSearchHandler(cmd *cobra.Command, args []string) error {
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+
+	client := newAPIClient()
+
+	results, err := client.SearchConversations(strings.Join(args, " "), limit)
+	if err != nil {
+		return fmt.Errorf("error searching conversations: %w", err)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No matching conversations found.")
+		return nil
+	}
+
+	headers := []string{"ID", "Message Time", "Match"}
+	var rows [][]string
+	for _, r := range results {
+		rows = append(rows, []string{r.ConversationID, r.MessageTime.Format(time.RFC3339), r.Snippet})
+	}
+
+	utils.RenderTable(headers, rows)
+
+	return nil
+}
+
+// Follow a conversation from another terminal, read-only, until Ctrl+C
+func ConversationWatchHandler(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := newAPIClient()
+
+	err := client.WatchConversation(ctx, args[0], func(event api.WatchEvent) {
+		switch event.Type {
+		case api.WatchMessages:
+			for _, msg := range event.Messages {
+				printWatchedMessage(msg)
+			}
+		case api.WatchPlan:
+			done := 0
+			for _, step := range event.Plan.Steps {
+				if step.Status == "DONE" {
+					done++
+				}
+			}
+			fmt.Printf("[plan] %d/%d steps done\n", done, len(event.Plan.Steps))
+			if next := event.Plan.NextStep(); next != nil {
+				fmt.Printf("[plan] next: %s\n", next.Description)
+			}
+		case api.WatchDeleted:
+			fmt.Println("Conversation was deleted")
+		}
+	})
+	if errors.Is(err, data.ErrConversationNotFound) {
+		return fmt.Errorf("conversation %s not found", args[0])
+	}
+
+	return err
+}
+
+func printWatchedMessage(msg *message.Message) {
+	for _, block := range msg.Content {
+		switch blk := block.(type) {
+		case message.TextBlock:
+			fmt.Printf("[%s] %s\n", msg.Role, strings.TrimSpace(blk.Text))
+		case message.ImageBlock:
+			fmt.Printf("[%s] %s\n", msg.Role, blk.Placeholder())
+		case message.CitationBlock:
+			fmt.Printf("[source] %s\n", blk.Reference())
+		case message.ToolUseBlock:
+			fmt.Printf("[tool] %s %s\n", blk.Name, blk.Input)
+		case message.ToolResultBlock:
+			status := "ok"
+			if blk.IsError {
+				status = "error"
+			}
+			fmt.Printf("[tool] %s %s\n", blk.ToolName, status)
+		}
+	}
+}
+
+// Write the transcript of a conversation to stdout or a file
+func ConversationExportHandler(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	client := newAPIClient()
 
-	if list {
-		flagsSet++
-		showType = "list"
+	body, err := client.ExportConversation(args[0], format)
+	if err != nil {
+		if errors.Is(err, data.ErrConversationNotFound) {
+			return fmt.Errorf("conversation %s not found", args[0])
+		}
+		return fmt.Errorf("error exporting conversation: %w", err)
 	}
 
-	if flagsSet > 1 {
-		return errors.New("only one of '--list'")
+	if output == "" || output == "-" {
+		_, err = os.Stdout.Write(body)
+		return err
 	}
 
-	client := api.NewClient("")
-
-	if flagsSet == 1 {
-		switch showType {
-		case "list":
-			conversations, err := client.ListConversations()
-			if err != nil {
-				log.Fatalf("Error listing conversations: %v", err)
-			}
-
-			if len(conversations) == 0 {
-				fmt.Println("No conversations found.")
-			} else {
-
-				headers := []string{"ID", "Created", "Last Message", "Messages"}
-				var data [][]string
-
-				for _, conv := range conversations {
-					row := []string{
-						conv.ID,
-						// TODO: A more read-friendly format?
-						conv.CreatedAt.Format(time.RFC3339),
-						conv.LatestMessageTime.Format(time.RFC3339),
-						fmt.Sprintf("%d", conv.MessageCount),
-					}
-					data = append(data, row)
-				}
-
-				utils.RenderTable(headers, data)
-			}
-		}
+	if err := os.WriteFile(output, body, 0644); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
 	}
+	fmt.Printf("Exported conversation %s to %s\n", args[0], output)
 
 	return nil
 }
@@ -188,9 +885,30 @@ func MCPHandler(cmd *cobra.Command, args []string) error {
 			id := strings.TrimSpace(parts[0])
 			command := strings.TrimSpace(parts[1])
 			if id != "" && command != "" {
+				env, err := parseEnvFlags(mcpServerEnv)
+				if err != nil {
+					return err
+				}
+				headers, err := parseHeaderFlags(mcpServerHeaders, mcpServerBearer)
+				if err != nil {
+					return err
+				}
 				config := mcp.ServerConfig{
 					ID:      id,
-					Command: command,
+					Env:     env,
+					Cwd:     mcpServerCwd,
+					Headers: headers,
+
+					StartupTimeout: mcp.Duration(mcpServerStartup),
+					CallTimeout:    mcp.Duration(mcpCallTimeout),
+					IncludeTools:   mcpIncludeTools,
+					ExcludeTools:   mcpExcludeTools,
+				}
+				// Remote servers are configured with their endpoint instead of a command
+				if strings.HasPrefix(command, "http://") || strings.HasPrefix(command, "https://") {
+					config.URL = command
+				} else {
+					config.Command = command
 				}
 				mcpServerConfigs = append(mcpServerConfigs, config)
 				if verbose {
@@ -226,6 +944,233 @@ func MCPHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// Start every configured MCP server, ping it once and report its health
+func MCPStatusHandler(cmd *cobra.Command, args []string) error {
+	if len(mcpServerConfigs) == 0 {
+		fmt.Println("No MCP servers configured.")
+		return nil
+	}
+
+	headers := []string{"ID", "Status", "Latency", "Command"}
+	var data [][]string
+
+	for _, cfg := range mcpServerConfigs {
+		status, latency := checkMCPServer(cmd.Context(), cfg)
+		command := cfg.Command
+		if cfg.IsRemote() {
+			command = cfg.URL
+		}
+		data = append(data, []string{cfg.ID, status, latency, command})
+	}
+
+	utils.RenderTable(headers, data)
+
+	return nil
+}
+
+func checkMCPServer(ctx context.Context, cfg mcp.ServerConfig) (string, string) {
+	server, err := mcp.NewServer(cfg)
+	if err != nil {
+		return "invalid: " + err.Error(), "-"
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := server.Start(startCtx); err != nil {
+		return "failed to start", "-"
+	}
+	defer server.Close()
+
+	pingCtx, pingCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer pingCancel()
+
+	latency, err := server.Ping(pingCtx)
+	if err != nil {
+		return "unresponsive", "-"
+	}
+
+	return "healthy", latency.Round(time.Millisecond).String()
+}
+
+// Authorize tinker with a remote MCP server through its OAuth flow in the browser
+func MCPLoginHandler(cmd *cobra.Command, args []string) error {
+	cfg, err := remoteMCPServer(args[0])
+	if err != nil {
+		return err
+	}
+
+	// The user has this long to grant access in the browser
+	ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Minute)
+	defer cancel()
+
+	err = mcp.Login(ctx, cfg.URL, func(authURL string) error {
+		fmt.Printf("Opening the browser to authorize tinker with %s. If it does not open, visit:\n  %s\n", cfg.ID, authURL)
+		_ = utils.OpenBrowser(authURL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to log in to MCP server %s: %w", cfg.ID, err)
+	}
+
+	fmt.Printf("Logged in to MCP server %s\n", cfg.ID)
+	return nil
+}
+
+// Forget the OAuth tokens of a remote MCP server
+func MCPLogoutHandler(cmd *cobra.Command, args []string) error {
+	cfg, err := remoteMCPServer(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := mcp.Logout(cfg.URL); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged out of MCP server %s\n", cfg.ID)
+	return nil
+}
+
+func remoteMCPServer(id string) (mcp.ServerConfig, error) {
+	idx := slices.IndexFunc(mcpServerConfigs, func(cfg mcp.ServerConfig) bool { return cfg.ID == id })
+	if idx < 0 {
+		return mcp.ServerConfig{}, fmt.Errorf("no MCP server %s configured", id)
+	}
+	if !mcpServerConfigs[idx].IsRemote() {
+		return mcp.ServerConfig{}, fmt.Errorf("MCP server %s is not a remote server", id)
+	}
+	return mcpServerConfigs[idx], nil
+}
+
+// Print the tail of an MCP server's stderr log, optionally following new output
+func MCPLogsHandler(cmd *cobra.Command, args []string) error {
+	lines, err := cmd.Flags().GetInt("lines")
+	if err != nil {
+		return err
+	}
+
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+
+	path, err := mcp.LogPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no logs found for MCP server %s (expected %s)", args[0], path)
+		}
+		return err
+	}
+
+	all := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if lines > 0 && len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	fmt.Println(strings.Join(all, "\n"))
+
+	if !follow {
+		return nil
+	}
+
+	offset := int64(len(content))
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		offset, err = printNewLogOutput(path, offset)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Print whatever was appended to the log since offset and return the new offset
+func printNewLogOutput(path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Rotation in progress
+			return 0, nil
+		}
+		return offset, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return offset, err
+	}
+
+	// The file was rotated, start over from the new one
+	if info.Size() < offset {
+		offset = 0
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	n, err := io.Copy(os.Stdout, f)
+
+	return offset + n, err
+}
+
+// Parse repeated KEY=VALUE flags into an env map.
+// Values are kept unexpanded so ${VAR} references are resolved when the server starts.
+func parseEnvFlags(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	env := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid env format: %s (expected KEY=VALUE)", pair)
+		}
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// Parse repeated "Name: value" flags into a header map,
+// with the bearer token as a shorthand for the Authorization header
+func parseHeaderFlags(pairs []string, bearer string) (map[string]string, error) {
+	if len(pairs) == 0 && bearer == "" {
+		return nil, nil
+	}
+
+	headers := make(map[string]string, len(pairs)+1)
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header format: %s (expected 'Name: value')", pair)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+
+	if bearer != "" {
+		headers["Authorization"] = "Bearer " + bearer
+	}
+
+	return headers, nil
+}
+
 func NewCLI() *cobra.Command {
 	modelCmd := &cobra.Command{
 		Use:   "model",
@@ -241,6 +1186,147 @@ func NewCLI() *cobra.Command {
 	}
 
 	conversationCmd.Flags().BoolP("list", "l", false, "Display all conversations")
+	conversationCmd.Flags().StringP("delete", "d", "", "Delete the conversation with the given ID, along with its plan")
+	conversationCmd.Flags().StringSliceP("tag", "t", nil, "With --list, only show conversations carrying every given tag")
+	conversationCmd.Flags().StringP("project", "p", "", "With --list, only show conversations of the repository containing this directory, e.g., '.'")
+	conversationCmd.Flags().Bool("archived", false, "With --list, show archived conversations instead of the others")
+
+	conversationSearchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Find conversations containing every word of the query",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  ConversationSearchHandler,
+	}
+
+	conversationSearchCmd.Flags().IntP("limit", "n", 20, "Maximum number of conversations to show")
+
+	conversationExportCmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Export the full transcript of a conversation",
+		Args:  cobra.ExactArgs(1),
+		RunE:  ConversationExportHandler,
+	}
+
+	conversationExportCmd.Flags().StringP("format", "f", "markdown", "Output format: json, markdown or html")
+	conversationExportCmd.Flags().StringP("output", "o", "", "File to write to, stdout when empty")
+
+	conversationTagCmd := &cobra.Command{
+		Use:   "tag <id> <tag>...",
+		Short: "Tag a conversation, e.g., bug or refactor",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  ConversationTagHandler,
+	}
+
+	conversationUntagCmd := &cobra.Command{
+		Use:   "untag <id> <tag>...",
+		Short: "Remove tags from a conversation",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  ConversationTagHandler,
+	}
+
+	conversationWatchCmd := &cobra.Command{
+		Use:   "watch <id>",
+		Short: "Follow new messages and plan updates of a conversation, read-only",
+		Args:  cobra.ExactArgs(1),
+		RunE:  ConversationWatchHandler,
+	}
+
+	conversationDeleteCmd := &cobra.Command{
+		Use:   "delete [id]...",
+		Short: "Delete conversations along with their plans, by ID or by age",
+		RunE:  ConversationDeleteHandler,
+	}
+
+	conversationDeleteCmd.Flags().String("older-than", "", "Delete every conversation without a message for this long, e.g., 30d, 2w or 12h")
+	conversationDeleteCmd.Flags().Bool("dry-run", false, "Only print the conversations that would be deleted")
+
+	conversationRenameCmd := &cobra.Command{
+		Use:   "rename <id> <title>",
+		Short: "Set the title of a conversation",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  ConversationRenameHandler,
+	}
+
+	conversationForkCmd := &cobra.Command{
+		Use:   "fork <id>",
+		Short: "Start a new conversation from the messages of another, leaving it as is",
+		Args:  cobra.ExactArgs(1),
+		RunE:  ConversationForkHandler,
+	}
+
+	conversationForkCmd.Flags().Int("at", -1, "Number of messages the fork starts with, all of them when negative")
+
+	conversationReplayCmd := &cobra.Command{
+		Use:   "replay <id|file>",
+		Short: "Run the agent loop over a recorded conversation again, the model and tools answering as they did",
+		Long:  "Play back a conversation, saved or exported with \"conversation export --format json\", through the agent loop. The replies of the model and the results of tool calls come from the recording, so nothing is sent to a provider or run on the system. Prints the events of the replay as JSON lines and fails where the loop diverges from the recording.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  ConversationReplayHandler,
+	}
+
+	conversationRedactCmd := &cobra.Command{
+		Use:   "redact <id> <message> [block]",
+		Short: "Remove a message or one of its content blocks from the history, e.g., a pasted secret",
+		Long:  "Replace a message, or one of its content blocks, with a tombstone. Messages and blocks count from 0. Tool calls and results keep their ids so the conversation can go on.",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE:  ConversationRedactHandler,
+	}
+
+	conversationArchiveCmd := &cobra.Command{
+		Use:   "archive <id>...",
+		Short: "Move conversations into compressed archive files, out of listings until unarchived",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  ConversationArchiveHandler,
+	}
+
+	conversationUnarchiveCmd := &cobra.Command{
+		Use:   "unarchive <id>...",
+		Short: "Bring archived conversations back, see 'conversation --list --archived'",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  ConversationArchiveHandler,
+	}
+
+	conversationCmd.AddCommand(conversationSearchCmd, conversationExportCmd, conversationTagCmd, conversationUntagCmd, conversationWatchCmd, conversationDeleteCmd, conversationRenameCmd, conversationForkCmd, conversationReplayCmd, conversationRedactCmd, conversationArchiveCmd, conversationUnarchiveCmd)
+
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Inspect and clean up the plans of conversations",
+	}
+
+	planListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List plans with their progress",
+		Args:  cobra.ExactArgs(0),
+		RunE:  PlanListHandler,
+	}
+
+	planListCmd.Flags().StringSliceP("tag", "t", nil, "Only show plans carrying every given tag")
+	planListCmd.Flags().StringP("project", "p", "", "Only show plans of the repository containing this directory, e.g., '.'")
+
+	planShowCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print the steps of a plan with their acceptance criteria, by plan or conversation ID",
+		Args:  cobra.ExactArgs(1),
+		RunE:  PlanShowHandler,
+	}
+
+	planCompactCmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Delete every plan whose steps are all done, and those without steps",
+		Args:  cobra.ExactArgs(0),
+		RunE:  PlanCompactHandler,
+	}
+
+	planCompactCmd.Flags().Bool("dry-run", false, "Only print the plans that would be deleted")
+
+	planDeleteCmd := &cobra.Command{
+		Use:   "delete <id>...",
+		Short: "Delete plans by plan or conversation ID, leaving the conversations",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  PlanDeleteHandler,
+	}
+
+	planCmd.AddCommand(planListCmd, planShowCmd, planCompactCmd, planDeleteCmd)
 
 	helpCmd := &cobra.Command{
 		Use:   "help",
@@ -248,6 +1334,37 @@ func NewCLI() *cobra.Command {
 		RunE:  HelpHandler,
 	}
 
+	commitCmd := &cobra.Command{
+		Use:   "commit",
+		Short: "Write a commit message for the staged changes and commit them",
+		Args:  cobra.ExactArgs(0),
+		RunE:  CommitHandler,
+	}
+	commitCmd.Flags().BoolP("yes", "y", false, "Commit without showing the message for approval")
+	commitCmd.Flags().Bool("print", false, "Only print the message, e.g., for git commit -m \"$(tinker commit --print)\"")
+
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize sessions, tokens and cost per model, most used tools and most edited files",
+		Args:  cobra.ExactArgs(0),
+		RunE:  StatsHandler,
+	}
+	statsCmd.Flags().String("since", "", "Only count the last stretch of time, e.g., 7d, 2w or 12h")
+	statsCmd.Flags().StringP("project", "p", "", "Only count conversations of the repository containing this directory, e.g., '.'")
+	statsCmd.Flags().Bool("telemetry", false, "Summarize the local telemetry records instead, see the telemetry setting")
+	statsCmd.Flags().String("export", "", "With --telemetry, write the records as JSON to this file, - for stdout")
+
+	reviewCmd := &cobra.Command{
+		Use:   "review",
+		Short: "Review the uncommitted changes with read-only tools and print the findings",
+		Args:  cobra.ExactArgs(0),
+		RunE:  ReviewHandler,
+	}
+	reviewCmd.Flags().Bool("staged", false, "Review the staged changes only")
+	reviewCmd.Flags().String("branch", "", "Review the commits of the current branch since it forked from this one, e.g., main")
+	reviewCmd.Flags().String("output", outputText, "Output format: text or json")
+	reviewCmd.Flags().String("fail-on", "", "Exit with an error when a finding is at least this severe: high, medium or low")
+
 	versionCmd := &cobra.Command{
 		Use:   "version",
 		Short: "Print the version number of tinker",
@@ -256,6 +1373,14 @@ func NewCLI() *cobra.Command {
 		},
 	}
 
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Replace tinker with its latest release",
+		Args:  cobra.ExactArgs(0),
+		RunE:  UpdateHandler,
+	}
+	updateCmd.Flags().Bool("check", false, "Only tell whether a newer release is available")
+
 	serveCmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start tinker server",
@@ -263,6 +1388,17 @@ func NewCLI() *cobra.Command {
 		RunE:  RunServer,
 	}
 
+	serveCmd.Flags().Bool("new-token", false, "Issue a new API token and exit")
+	serveCmd.Flags().Bool("stop", false, "Stop the server running in the background and exit")
+	serveCmd.Flags().Bool("status", false, "Tell whether the server is running and exit")
+	serveCmd.Flags().String("host", "", "Host to bind to, every interface when empty (env "+config.HostEnv+")")
+	serveCmd.Flags().String("port", config.DefaultPort, "Port to listen on, 0 picks a free port (env "+config.PortEnv+")")
+	serveCmd.Flags().String("database-url", "", "postgres:// URL or SQLite file to store data in, ~/.tinker/tinker.db by default (env "+config.DatabaseEnv+")")
+	serveCmd.Flags().String("socket", "", "Unix domain socket to listen on instead of host and port, e.g., ~/.tinker/tinker.sock (env "+config.SocketEnv+")")
+	serveCmd.Flags().String("grpc-port", "", "Also serve the gRPC service on this port, off when empty (env "+config.GRPCPortEnv+")")
+	serveCmd.Flags().Int64("max-body-size", config.DefaultMaxBodySize, "Largest request body accepted, in bytes (env "+config.MaxBodySizeEnv+")")
+	serveCmd.Flags().Int("rate-limit", config.DefaultRateLimit, "Requests per minute allowed for each API token, negative disables the limit (env "+config.RateLimitEnv+")")
+
 	mcpCmd := &cobra.Command{
 		Use:   "mcp",
 		Short: "Start MCP server",
@@ -275,23 +1411,162 @@ Examples:
   tinker mcp "fetch-server:uvx mcp-server-fetch"
   tinker mcp "python-server:python my_mcp_server.py --port 8080"
   tinker mcp --verbose "node-server:node mcp-server.js"
-  tinker mcp "server1:uvx mcp-server-fetch" "server2:python other_server.py"`,
+  tinker mcp "server1:uvx mcp-server-fetch" "server2:python other_server.py"
+  tinker mcp --server-cmd "github:npx -y @modelcontextprotocol/server-github" --env 'GITHUB_TOKEN=${GITHUB_TOKEN}'
+  tinker mcp --server-cmd "db:python server.py" --env 'DB_PASSWORD=${file:~/.secrets/db}' --cwd ~/projects/db-server
+
+Large servers can be trimmed down to the tools that are actually useful:
+  tinker mcp --server-cmd "github:npx -y @modelcontextprotocol/server-github" --include-tools 'get_*,search_code' --exclude-tools get_me
+
+Remote servers are configured with their URL instead of a command, authenticated with static headers:
+  tinker mcp --server-cmd "linear:https://mcp.linear.app/mcp" --bearer-token '${LINEAR_API_KEY}'
+  tinker mcp --server-cmd "internal:https://mcp.example.com/mcp" --header 'X-Api-Key: ${file:~/.secrets/mcp}'
+
+or through OAuth in the browser, when they have no Authorization header:
+  tinker mcp --server-cmd "notion:https://mcp.notion.com/mcp"
+  tinker mcp login notion`,
 		RunE: MCPHandler,
 	}
 
+	mcpStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Ping the configured MCP servers and report their health",
+		Args:  cobra.ExactArgs(0),
+		RunE:  MCPStatusHandler,
+	}
+
+	mcpLogsCmd := &cobra.Command{
+		Use:   "logs <id>",
+		Short: "Show the stderr log of an MCP server",
+		Args:  cobra.ExactArgs(1),
+		RunE:  MCPLogsHandler,
+	}
+
+	mcpLoginCmd := &cobra.Command{
+		Use:   "login <id>",
+		Short: "Authorize tinker with a remote MCP server through OAuth",
+		Args:  cobra.ExactArgs(1),
+		RunE:  MCPLoginHandler,
+	}
+
+	mcpLogoutCmd := &cobra.Command{
+		Use:   "logout <id>",
+		Short: "Forget the OAuth tokens of a remote MCP server",
+		Args:  cobra.ExactArgs(1),
+		RunE:  MCPLogoutHandler,
+	}
+
+	mcpLogsCmd.Flags().IntP("lines", "n", 50, "Number of lines to show")
+	mcpLogsCmd.Flags().BoolP("follow", "f", false, "Keep printing new log output")
+
+	mcpCmd.AddCommand(mcpStatusCmd, mcpLogsCmd, mcpLoginCmd, mcpLogoutCmd)
+
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the server database",
+	}
+
+	dbCmd.PersistentFlags().String("database-url", "", "postgres:// URL or SQLite file, ~/.tinker/tinker.db by default (env "+config.DatabaseEnv+")")
+
+	dbMigrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending schema migrations",
+		Args:  cobra.ExactArgs(0),
+		RunE:  DBMigrateHandler,
+	}
+
+	dbStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show which schema migrations have been applied",
+		Args:  cobra.ExactArgs(0),
+		RunE:  DBStatusHandler,
+	}
+
+	dbEncryptCmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt the messages at rest, with a key kept in the OS keyring",
+		Long:  "Encrypt the messages and archived conversations with AES-256-GCM. The key is created and kept in the OS keyring, or read from " + config.DatabaseKeyEnv + " when set. Stop the server first, it finds the key at startup and encrypts new messages from then on. New conversations are no longer titled after their first prompt, titles are stored in plaintext.",
+		Args:  cobra.ExactArgs(0),
+		RunE:  DBEncryptHandler,
+	}
+
+	dbDecryptCmd := &cobra.Command{
+		Use:   "decrypt",
+		Short: "Decrypt the messages and remove the key from the OS keyring",
+		Args:  cobra.ExactArgs(0),
+		RunE:  DBEncryptHandler,
+	}
+
+	dbCmd.AddCommand(dbMigrateCmd, dbStatusCmd, dbEncryptCmd, dbDecryptCmd)
+
 	mcpCmd.Flags().StringVar(&mcpServerCmd, "server-cmd", "", "Server configuration in format id:command (e.g., 'my-server:uvx mcp-server-fetch')")
+	mcpCmd.Flags().StringArrayVar(&mcpServerEnv, "env", nil, "Environment variable for the server in format KEY=VALUE, supports ${VAR} and ${file:path} (repeatable)")
+	mcpCmd.Flags().StringVar(&mcpServerCwd, "cwd", "", "Working directory for the server process")
+	mcpCmd.Flags().StringSliceVar(&mcpIncludeTools, "include-tools", nil, "Only expose these tools of the server, glob patterns allowed (comma-separated or repeatable)")
+	mcpCmd.Flags().StringSliceVar(&mcpExcludeTools, "exclude-tools", nil, "Hide these tools of the server, glob patterns allowed (comma-separated or repeatable)")
+	mcpCmd.Flags().DurationVar(&mcpServerStartup, "startup-timeout", 0, "How long the server gets to start before it is skipped (default 30s)")
+	mcpCmd.Flags().DurationVar(&mcpCallTimeout, "call-timeout", 0, "How long a tool call may run before it is abandoned (default 2m)")
+	mcpCmd.Flags().StringArrayVar(&mcpServerHeaders, "header", nil, "HTTP header for a remote server in format 'Name: value', supports ${VAR} and ${file:path} (repeatable)")
+	mcpCmd.Flags().StringVar(&mcpServerBearer, "bearer-token", "", "Bearer token for a remote server, supports ${VAR} and ${file:path}")
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show or change the settings of config.json",
+		// Nothing to apply, and a broken config must not keep it from being fixed
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+
+	configGetCmd := &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print a setting as resolved for this project, every one that is set without a key",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  ConfigGetHandler,
+	}
+
+	configSetCmd := &cobra.Command{
+		Use:   "set <key> [value]",
+		Short: "Write a setting to the user config, an empty value unsets it",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  ConfigSetHandler,
+	}
+	configSetCmd.Flags().Bool("project", false, "Write to .tinker/config.json of the repository instead")
+
+	configProfilesCmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "List the profiles of the user config, the one in use marked with *",
+		Args:  cobra.ExactArgs(0),
+		RunE:  ConfigProfilesHandler,
+	}
+
+	configCmd.AddCommand(configGetCmd, configSetCmd, configProfilesCmd)
+
+	promptsCmd := &cobra.Command{
+		Use:   "prompts",
+		Short: "Inspect the system prompts and their overrides",
+	}
+
+	promptsShowCmd := &cobra.Command{
+		Use:   "show [name]",
+		Short: "Print the system prompt template in use, the one of the provider without a name",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  PromptsShowHandler,
+	}
+	promptsShowCmd.Flags().Bool("resolved", false, "Fill in the workspace, date, tools and other variables as the agent would")
+
+	promptsCmd.AddCommand(promptsShowCmd)
 
 	rootCmd := &cobra.Command{
 		Use:   "tinker",
 		Short: "An AI agent for code editing and assistance",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			if configs, err := mcp.LoadConfigs(); err == nil {
-				mcpServerConfigs = configs
-				if verbose && len(configs) > 0 {
-					fmt.Printf("Loaded %d MCP server configurations\n", len(configs))
-				}
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupLogging(cmd); err != nil {
+				return err
 			}
-			// TODO: Check if serve process is running, if not run here?
+			if err := applyConfig(cmd); err != nil {
+				return err
+			}
+			setupTelemetry(cmd)
+			return nil
 		},
 		RunE: ChatHandler,
 	}
@@ -300,11 +1575,49 @@ Examples:
 	rootCmd.PersistentFlags().StringVar(&llm.Model, "model", "", "Model to use (depends on selected model)")
 	rootCmd.PersistentFlags().Int64Var(&llm.TokenLimit, "max-tokens", 0, "Maximum number of tokens in response")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Enable verbose output")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Profile of the user config to use (env TINKER_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Lowest level to log: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "File to log to, rotated as it grows (default ~/.tinker/logs/tinker.log, server.log for serve)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", utils.LogFormatText, "Format of the log records: text or json")
 	rootCmd.Flags().BoolVarP(&continueConv, "new-conversation", "n", true, "Continue from the latest conversation")
 	rootCmd.Flags().StringVarP(&convID, "id", "i", "", "Conversation ID to ")
+	rootCmd.Flags().IntVar(&runLimits.MaxTurns, "max-turns", 0, "Stop a run after this many calls to the model, no limit when 0")
+	rootCmd.Flags().Float64Var(&runLimits.MaxCost, "max-cost", 0, "Stop a run once it has cost this many USD, no limit when 0")
+	rootCmd.Flags().DurationVar(&runLimits.MaxTime, "max-time", 0, "Stop a run after this long, e.g., 10m, no limit when 0")
+	rootCmd.Flags().StringArray("add-dir", nil, "Directory the agent may also work in besides the working directory, e.g., a sibling repository (repeatable)")
+	rootCmd.Flags().BoolP("resume", "r", false, "Pick one of the recent conversations to continue")
 	rootCmd.Flags().BoolVar(&useTUI, "tui", true, "Use TUI (Terminal User Interface) mode")
+	rootCmd.Flags().StringP("prompt", "p", "", "Answer this prompt without the TUI and exit, piped input goes along with it")
+	rootCmd.Flags().String("output", outputText, "With --prompt, output format: text, json or stream-json (one event per line)")
+
+	rootCmd.RegisterFlagCompletionFunc("id", completeConversationIDs)
+	rootCmd.RegisterFlagCompletionFunc("model", completeModels)
+	rootCmd.RegisterFlagCompletionFunc("provider", completeProviders)
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	rootCmd.RegisterFlagCompletionFunc("add-dir", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+	rootCmd.RegisterFlagCompletionFunc("log-level", cobra.FixedCompletions([]string{"debug", "info", "warn", "error"}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("log-format", cobra.FixedCompletions([]string{utils.LogFormatText, utils.LogFormatJSON}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(outputFormats, cobra.ShellCompDirectiveNoFileComp))
+	conversationCmd.RegisterFlagCompletionFunc("delete", completeConversationIDs)
+	conversationExportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"json", "markdown", "html"}, cobra.ShellCompDirectiveNoFileComp))
+	reviewCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{outputText, outputJSON}, cobra.ShellCompDirectiveNoFileComp))
+	reviewCmd.RegisterFlagCompletionFunc("fail-on", cobra.FixedCompletions(severities, cobra.ShellCompDirectiveNoFileComp))
+	for _, c := range []*cobra.Command{conversationExportCmd, conversationTagCmd, conversationUntagCmd, conversationWatchCmd, conversationRenameCmd, conversationForkCmd, conversationRedactCmd} {
+		c.ValidArgsFunction = completeConversationArg
+	}
+	// Every argument of these is an ID
+	conversationDeleteCmd.ValidArgsFunction = completeConversationIDs
+	conversationArchiveCmd.ValidArgsFunction = completeConversationIDs
+	conversationUnarchiveCmd.ValidArgsFunction = completeArchivedConversationIDs
+	planShowCmd.ValidArgsFunction = completePlanArg
+	planDeleteCmd.ValidArgsFunction = completePlanIDs
+	configGetCmd.ValidArgsFunction = completeConfigKeys
+	configSetCmd.ValidArgsFunction = completeConfigKeys
+	promptsShowCmd.ValidArgsFunction = cobra.FixedCompletions(prompts.Names, cobra.ShellCompDirectiveNoFileComp)
 
-	rootCmd.AddCommand(versionCmd, modelCmd, conversationCmd, helpCmd, serveCmd, mcpCmd)
+	rootCmd.AddCommand(versionCmd, updateCmd, modelCmd, conversationCmd, planCmd, reviewCmd, commitCmd, statsCmd, helpCmd, serveCmd, mcpCmd, dbCmd, configCmd, promptsCmd)
 
 	return rootCmd
 }
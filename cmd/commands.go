@@ -0,0 +1,426 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/mcp"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/rivo/tview"
+)
+
+// Messages kept verbatim by /compact when no count is given
+const defaultCompactKeep = 10
+
+// What the slash commands act on, provided by the TUI
+type commandEnv struct {
+	ctx      context.Context
+	app      *tview.Application
+	agent    *agent.Agent
+	commands *ui.Commands
+	// The conversation view
+	out                io.Writer
+	openSwitcher       func()
+	changeModel        func(name string)
+	copyResponse       func(pickCode bool)
+	showHelp           func()
+	openStatus         func()
+	switchConversation func(id string) error
+	// Send text as if the user typed it
+	submit func(content string)
+}
+
+func registerBuiltinCommands(env *commandEnv) error {
+	builtins := []ui.Command{
+		{
+			Name:        "clear",
+			Description: "Start a new conversation, the current one stays in the history",
+			Run: func(string) error {
+				conv, err := env.agent.Client.CreateConversation(utils.CurrentProject())
+				if err != nil {
+					return fmt.Errorf("failed to create conversation: %w", err)
+				}
+				return env.switchConversation(conv.ID)
+			},
+		},
+		{
+			Name:        "compact",
+			Description: "Summarize older messages to free up context",
+			Usage:       "[keep]",
+			Run: func(args string) error {
+				keep := defaultCompactKeep
+				if args != "" {
+					n, err := strconv.Atoi(args)
+					if err != nil || n < 1 {
+						return fmt.Errorf("usage: /compact [keep], keep is a positive number of messages")
+					}
+					keep = n
+				}
+
+				dropped, err := env.agent.Compact(keep)
+				if err != nil {
+					return fmt.Errorf("failed to compact conversation: %w", err)
+				}
+				if dropped == 0 {
+					fmt.Fprintf(env.out, "[%s::]Nothing to compact[-]\n\n", ui.CurrentTheme().Muted)
+					return nil
+				}
+				// Redraw from the rewritten history
+				if err := env.switchConversation(env.agent.Conv.ID); err != nil {
+					return err
+				}
+				fmt.Fprintf(env.out, "[%s::]Compacted %d messages[-]\n\n", ui.CurrentTheme().Muted, dropped)
+				return nil
+			},
+		},
+		{
+			Name:        "copy",
+			Description: "Copy the last response to the clipboard, or pick one of its code blocks",
+			Usage:       "[code]",
+			Run: func(args string) error {
+				switch args {
+				case "":
+					env.copyResponse(false)
+				case "code":
+					env.copyResponse(true)
+				default:
+					return fmt.Errorf("usage: /copy [code]")
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "export",
+			Description: "Write the transcript to a file, by default in the format its extension suggests",
+			Usage:       "[markdown|json|html] [path]",
+			Run: func(args string) error {
+				id := env.agent.Conv.ID
+				format, path := parseExportArgs(args)
+				if format == "" {
+					format = exportFormat(path)
+				}
+				if path == "" {
+					path = id + "." + exportExtensions[format]
+				}
+
+				body, err := env.agent.Client.ExportConversation(id, format)
+				if err != nil {
+					return fmt.Errorf("error exporting conversation: %w", err)
+				}
+				if err := os.WriteFile(path, body, 0644); err != nil {
+					return fmt.Errorf("failed to write export: %w", err)
+				}
+				if abs, err := filepath.Abs(path); err == nil {
+					path = abs
+				}
+				fmt.Fprintf(env.out, "[%s::]Exported conversation as %s to %s[-]\n\n", ui.CurrentTheme().Muted, format, tview.Escape(path))
+				return nil
+			},
+		},
+		{
+			Name:        "help",
+			Description: "Show the commands, key bindings, model and MCP servers",
+			Run: func(string) error {
+				env.showHelp()
+				return nil
+			},
+		},
+		{
+			Name:        "keys",
+			Description: "Show the key bindings, same as /help",
+			Run: func(string) error {
+				env.showHelp()
+				return nil
+			},
+		},
+		{
+			Name:        "status",
+			Description: "Show the MCP servers and tools, restart a server or disable a tool",
+			Run: func(string) error {
+				env.openStatus()
+				return nil
+			},
+		},
+		{
+			Name:        "model",
+			Description: "Switch to another model, pick from a list without a name",
+			Usage:       "[name]",
+			Run: func(args string) error {
+				env.changeModel(args)
+				return nil
+			},
+		},
+		{
+			Name:        "plan",
+			Description: "Show the plan of the conversation",
+			Run: func(string) error {
+				plan, err := env.agent.Client.GetPlan(env.agent.Conv.ID)
+				if err != nil || len(plan.Steps) == 0 {
+					fmt.Fprintf(env.out, "[%s::]No plan yet[-]\n\n", ui.CurrentTheme().Muted)
+					return nil
+				}
+				fmt.Fprintf(env.out, "%s\n\n", formatPlanSteps(plan))
+				return nil
+			},
+		},
+		{
+			Name:        "fork",
+			Description: "Continue in a copy of the conversation, keeping its first messages",
+			Usage:       "[messages]",
+			Run: func(args string) error {
+				at := -1
+				if args != "" {
+					n, err := strconv.Atoi(args)
+					if err != nil || n < 0 {
+						return fmt.Errorf("usage: /fork [messages], messages is the number of messages to keep")
+					}
+					at = n
+				}
+
+				parent := env.agent.Conv.ID
+				fork, err := env.agent.Client.ForkConversation(parent, at)
+				if err != nil {
+					return fmt.Errorf("failed to fork conversation: %w", err)
+				}
+				if err := env.switchConversation(fork.ID); err != nil {
+					return err
+				}
+				fmt.Fprintf(env.out, "[%s::]Forked from %s with %d messages[-]\n\n", ui.CurrentTheme().Muted, parent, fork.ForkSequence)
+				return nil
+			},
+		},
+		{
+			Name:        "redact",
+			Description: "Replace a message or one of its blocks with a tombstone, the last user message by default",
+			Usage:       "[message] [block]",
+			Run: func(args string) error {
+				usage := fmt.Errorf("usage: /redact [message] [block], both counting from 0")
+				fields := strings.Fields(args)
+				if len(fields) > 2 {
+					return usage
+				}
+
+				sequence, block := -1, -1
+				if len(fields) > 0 {
+					n, err := strconv.Atoi(fields[0])
+					if err != nil || n < 0 {
+						return usage
+					}
+					sequence = n
+				} else {
+					// Tool results are user messages too, skip them
+					for i, msg := range env.agent.Conv.Messages {
+						if msg.Role != message.UserRole {
+							continue
+						}
+						for _, blk := range msg.Content {
+							if _, ok := blk.(message.TextBlock); ok {
+								sequence = i
+							}
+						}
+					}
+					if sequence < 0 {
+						return fmt.Errorf("no user message to redact")
+					}
+				}
+				if len(fields) == 2 {
+					n, err := strconv.Atoi(fields[1])
+					if err != nil || n < 0 {
+						return usage
+					}
+					block = n
+				}
+
+				if err := env.agent.Redact(sequence, block); err != nil {
+					return fmt.Errorf("failed to redact message: %w", err)
+				}
+				if err := env.switchConversation(env.agent.Conv.ID); err != nil {
+					return err
+				}
+				fmt.Fprintf(env.out, "[%s::]Redacted message %d[-]\n\n", ui.CurrentTheme().Muted, sequence)
+				return nil
+			},
+		},
+		{
+			Name:        "resume",
+			Description: "Switch to another conversation",
+			Run: func(string) error {
+				env.openSwitcher()
+				return nil
+			},
+		},
+		{
+			Name:        "title",
+			Description: "Show or rename the title of the conversation",
+			Usage:       "[title]",
+			Run: func(args string) error {
+				theme := ui.CurrentTheme()
+				if args == "" {
+					title := env.agent.Conv.Title
+					if title == "" {
+						title = "untitled"
+					}
+					fmt.Fprintf(env.out, "[%s::]Title: %s[-]\n\n", theme.Muted, tview.Escape(title))
+					return nil
+				}
+
+				if err := env.agent.Client.RenameConversation(env.agent.Conv.ID, args); err != nil {
+					return fmt.Errorf("failed to rename conversation: %w", err)
+				}
+				env.agent.Conv.Title = args
+				fmt.Fprintf(env.out, "[%s::]Renamed to %s[-]\n\n", theme.Muted, tview.Escape(args))
+				return nil
+			},
+		},
+	}
+
+	for _, c := range builtins {
+		if err := env.commands.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Expose the prompts of the running MCP servers as /server:prompt.
+// Safe to call again when servers come up, known prompts are skipped
+func registerMCPPromptCommands(env *commandEnv) {
+	for _, p := range env.agent.MCPPrompts() {
+		name := p.Server + ":" + p.Name
+		if _, ok := env.commands.Lookup(name); ok {
+			continue
+		}
+
+		usage := promptUsage(p.Prompt)
+		// Names the registry cannot hold are left out
+		_ = env.commands.Register(ui.Command{
+			Name:        name,
+			Description: p.Description,
+			Usage:       usage,
+			Run: func(args string) error {
+				values, err := promptArguments(p.Prompt, args)
+				if err != nil {
+					return fmt.Errorf("%w, usage: /%s %s", err, name, usage)
+				}
+
+				// Rendering is a round trip to the server, keep the UI responsive meanwhile
+				go func() {
+					text, err := env.agent.RenderMCPPrompt(env.ctx, p.Server, p.Name, values)
+					env.app.QueueUpdateDraw(func() {
+						if err != nil {
+							fmt.Fprintf(env.out, "[%s::]Failed to get prompt %s: %s[-]\n\n", ui.CurrentTheme().Error, name, tview.Escape(err.Error()))
+							return
+						}
+						env.submit(text)
+					})
+				}()
+				return nil
+			},
+		})
+	}
+}
+
+// Arguments of a prompt in the order they are typed, optional ones in brackets
+func promptUsage(p *mcp.Prompt) string {
+	var parts []string
+	for _, arg := range p.Arguments {
+		if arg.Required {
+			parts = append(parts, "<"+arg.Name+">")
+		} else {
+			parts = append(parts, "["+arg.Name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Map positional arguments onto the prompt's, the last one takes the rest of the line
+func promptArguments(p *mcp.Prompt, args string) (map[string]string, error) {
+	values := make(map[string]string)
+	rest := strings.TrimSpace(args)
+
+	for i, arg := range p.Arguments {
+		if rest == "" {
+			if arg.Required {
+				return nil, fmt.Errorf("missing argument %s", arg.Name)
+			}
+			continue
+		}
+
+		value := rest
+		if i < len(p.Arguments)-1 {
+			if j := strings.IndexAny(rest, " \t"); j >= 0 {
+				value, rest = rest[:j], strings.TrimSpace(rest[j:])
+			} else {
+				rest = ""
+			}
+		} else {
+			rest = ""
+		}
+		values[arg.Name] = value
+	}
+
+	return values, nil
+}
+
+var exportExtensions = map[string]string{
+	"markdown": "md",
+	"json":     "json",
+	"html":     "html",
+}
+
+// Split the optional format from the path, a path alone keeps its spaces
+func parseExportArgs(args string) (format, path string) {
+	first, rest, _ := strings.Cut(args, " ")
+	if first == "md" {
+		first = "markdown"
+	}
+	if _, ok := exportExtensions[first]; ok {
+		return first, strings.TrimSpace(rest)
+	}
+	return "", args
+}
+
+func exportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".html", ".htm":
+		return "html"
+	default:
+		return "markdown"
+	}
+}
+
+func commandSummary(c ui.Command) string {
+	if c.Usage == "" {
+		return c.Description
+	}
+	return c.Usage + "  " + c.Description
+}
+
+// Completion entries for a command being typed as the only word of the input
+func commandItems(commands *ui.Commands, input string) []completionItem {
+	prefix, ok := strings.CutPrefix(input, "/")
+	if !ok || strings.ContainsAny(prefix, " \t\n/") {
+		return nil
+	}
+
+	theme := ui.CurrentTheme()
+	var items []completionItem
+	for _, c := range commands.Complete(prefix) {
+		items = append(items, completionItem{
+			label: fmt.Sprintf("[%s::]/%s[-::] [%s::]%s[-::]", theme.Accent, c.Name, theme.Muted, tview.Escape(commandSummary(c))),
+			value: c.Name,
+		})
+	}
+	return items
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Part of the staged diff sent to the model, the stat covers the rest
+const maxCommitDiff = 64 << 10
+
+const commitPrompt = `Write a commit message for the staged changes below, following the Conventional Commits format:
+a subject line of at most 72 characters like "fix(parser): handle empty input", with the type one of feat, fix, refactor, perf, docs, test, build, ci or chore,
+then a blank line and a short body explaining what changed and why, only when the subject is not enough.
+Describe the changes, not the files. Answer with the commit message only, without quotes or a code block.`
+
+func CommitHandler(cmd *cobra.Command, args []string) error {
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	printOnly, err := cmd.Flags().GetBool("print")
+	if err != nil {
+		return err
+	}
+
+	if !yes && !printOnly && !stdinIsTerminal() {
+		return errors.New("stdin is not a terminal, pass --yes to commit without asking or --print to only write the message")
+	}
+
+	stat, err := gitDiff(cmd.Context(), "diff", "--staged", "--stat")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(stat) == "" {
+		return errors.New("nothing is staged, stage the changes to commit with git add first")
+	}
+	diff, err := gitDiff(cmd.Context(), "diff", "--staged")
+	if err != nil {
+		return err
+	}
+	if len(diff) > maxCommitDiff {
+		diff = splitChunks(diff, maxCommitDiff)[0] + "\n[diff truncated]"
+	}
+
+	// A message is short work, the subagent's model does it for less
+	setDefaultModels()
+	msg, err := complete(cmd.Context(), llmSub, commitPrompt+"\n\n"+stat+"\n"+diff)
+	if err != nil {
+		return fmt.Errorf("failed to write the commit message: %w", err)
+	}
+	msg = strings.TrimSpace(strings.Trim(strings.TrimSpace(msg), "`"))
+	if msg == "" {
+		return errors.New("the model wrote an empty commit message")
+	}
+
+	if printOnly {
+		fmt.Println(msg)
+		return nil
+	}
+
+	if !yes {
+		in := bufio.NewReader(os.Stdin)
+	ask:
+		for {
+			fmt.Printf("\n%s\n\n%sCommit with this message? [y]es, [e]dit, [n]o:%s ", msg, colorYellow, colorReset)
+			answer, err := in.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				break ask
+			case "e", "edit":
+				if msg, err = editMessage(msg); err != nil {
+					return err
+				}
+				if msg == "" {
+					return errors.New("aborting the commit, the message is empty")
+				}
+			case "n", "no":
+				return nil
+			}
+		}
+	}
+
+	git := exec.CommandContext(cmd.Context(), "git", "commit", "-m", msg)
+	git.Stdout, git.Stderr = os.Stdout, os.Stderr
+	if err := git.Run(); err != nil {
+		// git already said why
+		cmd.SilenceUsage = true
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+	return nil
+}
+
+// msg as changed in $VISUAL or $EDITOR, vi when neither is set
+func editMessage(msg string) (string, error) {
+	f, err := os.CreateTemp("", "tinker-commit-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(msg + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	editor := strings.Fields(cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi"))
+	edit := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := edit.Run(); err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", editor[0], err)
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(edited)), nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Rows shown before the popup scrolls
+const maxCompletionRows = 8
+
+type completionItem struct {
+	label string
+	// What picking the item inserts or runs
+	value string
+}
+
+// Popup above the question input listing what the word being typed can complete to
+type completionPopup struct {
+	*tview.List
+	items []completionItem
+}
+
+func newCompletionPopup() *completionPopup {
+	theme := ui.CurrentTheme()
+	list := tview.NewList().
+		ShowSecondaryText(false).
+		SetHighlightFullLine(true).
+		SetSelectedBackgroundColor(tcell.GetColor(theme.Selection))
+	list.SetBorder(true).SetBorderColor(tcell.GetColor(theme.Muted))
+
+	return &completionPopup{List: list}
+}
+
+// Replace the entries, returning how many rows the popup needs, 0 to hide it
+func (c *completionPopup) set(items []completionItem) int {
+	c.Clear()
+	c.items = items
+	for _, item := range items {
+		c.AddItem(item.label, "", 0, nil)
+	}
+
+	if len(items) == 0 {
+		return 0
+	}
+	// Borders included
+	return min(len(items), maxCompletionRows) + 2
+}
+
+func (c *completionPopup) selected() (completionItem, bool) {
+	if len(c.items) == 0 {
+		return completionItem{}, false
+	}
+	return c.items[c.GetCurrentItem()], true
+}
+
+func (c *completionPopup) move(delta int) {
+	if n := len(c.items); n > 0 {
+		c.SetCurrentItem((c.GetCurrentItem() + delta + n) % n)
+	}
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/config"
+	"github.com/honganh1206/tinker/mcp"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/spf13/cobra"
+)
+
+// Settings from the config files and the environment, resolved before any command runs
+var userConfig config.Config
+
+// Profile of the user config to apply, set by --profile
+var profileName string
+
+// Set by --log-level, --log-file and --log-format
+var (
+	logLevel  string
+	logFile   string
+	logFormat string
+)
+
+// Send the logs of this process to the log file, so nothing gets printed over the TUI.
+// The server keeps its own file and still logs to the terminal it runs in
+func setupLogging(cmd *cobra.Command) error {
+	level, err := utils.ParseLogLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	name, also := "tinker", []io.Writer(nil)
+	if cmd.Name() == "serve" {
+		name, also = "server", []io.Writer{os.Stderr}
+	}
+
+	path := logFile
+	if path == "" {
+		if path, err = utils.LogPath(name); err != nil {
+			return err
+		}
+	}
+
+	_, err = utils.SetupLogging(path, level, logFormat, also...)
+	return err
+}
+
+// Load the config of the current project and apply it under the flags the user passed
+func applyConfig(cmd *cobra.Command) error {
+	cfg, err := config.Load(utils.CurrentProject(), profileName)
+	if err != nil {
+		return err
+	}
+	userConfig = cfg
+
+	// Credentials of the profile replace those of the shell, that is what selecting it is for
+	for k, v := range cfg.Env {
+		expanded, err := mcp.ExpandValue(v)
+		if err != nil {
+			return fmt.Errorf("config env %s: %w", k, err)
+		}
+		os.Setenv(k, expanded)
+	}
+
+	flags := cmd.Flags()
+	if cfg.Provider != "" && !flags.Changed("provider") {
+		llm.Provider = cfg.Provider
+	}
+	if cfg.Model != "" && !flags.Changed("model") {
+		llm.Model = cfg.Model
+	}
+	if cfg.MaxTokens != 0 && !flags.Changed("max-tokens") {
+		llm.TokenLimit = cfg.MaxTokens
+	}
+	if cfg.MaxTurns != 0 && !flags.Changed("max-turns") {
+		runLimits.MaxTurns = cfg.MaxTurns
+	}
+	if cfg.MaxCost != 0 && !flags.Changed("max-cost") {
+		runLimits.MaxCost = cfg.MaxCost
+	}
+	if cfg.MaxTime != 0 && !flags.Changed("max-time") {
+		runLimits.MaxTime = time.Duration(cfg.MaxTime)
+	}
+
+	configs, err := mcp.LoadConfigs()
+	if err == nil {
+		mcpServerConfigs = config.MergeMCPServers(configs, cfg.MCPServers)
+		if verbose && len(mcpServerConfigs) > 0 {
+			fmt.Printf("Loaded %d MCP server configurations\n", len(mcpServerConfigs))
+		}
+	}
+
+	return nil
+}
+
+// Disable the tools of a that the config does not allow.
+// Tools registered later, like those of MCP servers, need another call
+func restrictTools(a *agent.Agent) {
+	for _, t := range a.ToolStatus() {
+		if !userConfig.AllowsTool(t.Name) {
+			a.SetToolDisabled(t.Name, true)
+		}
+	}
+}
+
+// Client of the server set in the config, the one of the server config otherwise,
+// started in the background when it is not running yet
+func newAPIClient() *api.Client {
+	client := api.NewClient(userConfig.Server)
+	if err := ensureServer(client); err != nil {
+		// The requests fail with the details, starting the server by hand still works
+		fmt.Fprintf(os.Stderr, "%sCould not start the server: %v%s\n", colorYellow, err, colorReset)
+	}
+	return client
+}
+
+func ConfigGetHandler(cmd *cobra.Command, args []string) error {
+	// Resolved here rather than before the command, so a broken file can still be looked at
+	cfg, err := config.Load(utils.CurrentProject(), profileName)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		value, err := cfg.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	}
+
+	for _, key := range config.Keys() {
+		value, _ := cfg.Get(key)
+		if value == "" {
+			continue
+		}
+		fmt.Printf("%s = %s\n", key, value)
+	}
+	return nil
+}
+
+func ConfigSetHandler(cmd *cobra.Command, args []string) error {
+	project, err := cmd.Flags().GetBool("project")
+	if err != nil {
+		return err
+	}
+
+	key, value := args[0], strings.Join(args[1:], " ")
+
+	path, err := config.UserPath()
+	if err != nil {
+		return err
+	}
+	if project {
+		root := utils.CurrentProject()
+		if root == "" {
+			return errors.New("no project here, the working directory cannot be determined")
+		}
+		switch key {
+		case "server", "mcp_servers", "env", "tools", "profile":
+			return fmt.Errorf("%s is only taken from the user config, not from a project's", key)
+		}
+		if profileName != "" {
+			return errors.New("profiles are only taken from the user config, not from a project's")
+		}
+		path = config.ProjectPath(root)
+	}
+
+	if err := config.SetInFile(path, profileName, key, value); err != nil {
+		return err
+	}
+
+	where := path
+	if profileName != "" {
+		where = fmt.Sprintf("profile %s of %s", profileName, path)
+	}
+	if value == "" {
+		fmt.Printf("Unset %s in %s\n", key, where)
+	} else {
+		fmt.Printf("Set %s in %s\n", key, where)
+	}
+	return nil
+}
+
+func ConfigProfilesHandler(cmd *cobra.Command, args []string) error {
+	path, err := config.UserPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	names := cfg.ProfileNames()
+	if len(names) == 0 {
+		fmt.Println("No profiles, add some under \"profiles\" in", path)
+		return nil
+	}
+
+	active := profileName
+	if active == "" {
+		active = os.Getenv(config.ProfileEnv)
+	}
+	if active == "" {
+		active = cfg.Profile
+	}
+	for _, name := range names {
+		marker := "  "
+		if name == active {
+			marker = "* "
+		}
+		fmt.Println(marker + name)
+	}
+	return nil
+}
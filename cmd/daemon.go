@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honganh1206/tinker/server"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/utils"
+)
+
+const (
+	// Written by every running server, removed when it exits
+	serverPIDFile = "server.pid"
+	// Held while a CLI starts the server, so two of them do not race to do it
+	serverStartLock = "server.start.lock"
+	// Time the server gets to answer once started, and to drain once stopped
+	serverStartTimeout = 10 * time.Second
+	serverStopTimeout  = 15 * time.Second
+)
+
+func serverPIDPath() (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, serverPIDFile), nil
+}
+
+// Record the PID of this process as the one of the server, the returned func removes it
+func writeServerPID() (func(), error) {
+	path, err := serverPIDPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	pid := os.Getpid()
+	if err := os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// A server started since then owns the file
+		if current, err := readServerPID(); err == nil && current == pid {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+func readServerPID() (int, error) {
+	path, err := serverPIDPath()
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID file %s: %w", path, err)
+	}
+	return pid, nil
+}
+
+func serverRunning(client *api.Client) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := client.Health(ctx)
+	return err == nil
+}
+
+// Start the local server in the background when nothing answers at the address of client.
+// Servers set in the config are someone else's to run
+func ensureServer(client *api.Client) error {
+	if userConfig.Server != "" || serverRunning(client) {
+		return nil
+	}
+
+	dir, err := utils.DataDir()
+	if err != nil {
+		return err
+	}
+
+	lock, err := utils.LockFile(filepath.Join(dir, serverStartLock))
+	switch {
+	case errors.Is(err, utils.ErrLocked):
+		// Another CLI is starting it, waiting is enough
+	case err != nil:
+		return err
+	default:
+		defer lock.Unlock()
+		if !serverRunning(client) {
+			if err := startServer(client); err != nil {
+				return err
+			}
+		}
+	}
+
+	deadline := time.Now().Add(serverStartTimeout)
+	for !serverRunning(client) {
+		if time.Now().After(deadline) {
+			logPath, _ := utils.LogPath("server")
+			return fmt.Errorf("the server did not answer within %s, see %s", serverStartTimeout, logPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+// Spawn `tinker serve` detached from this process, with a token to reach it when it listens on TCP
+func startServer(client *api.Client) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// Every request but /health is rejected over TCP until a token is issued
+	if cfg.SocketPath() == "" && api.LoadToken() == "" {
+		token, err := server.NewToken(cfg.Database)
+		if err != nil {
+			return fmt.Errorf("failed to create API token: %w", err)
+		}
+		if err := api.SaveToken(token); err != nil {
+			return err
+		}
+		client.SetToken(token)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// The output of the server goes to its log file
+	serve := exec.Command(exe, "serve")
+	detach(serve)
+	if err := serve.Start(); err != nil {
+		return fmt.Errorf("failed to start the server: %w", err)
+	}
+
+	slog.Info("started server in the background", "pid", serve.Process.Pid, "url", cfg.URL())
+	fmt.Fprintf(os.Stderr, "Started tinker server in the background on %s, stop it with 'tinker serve --stop'\n", cfg.URL())
+	// Reap it if it exits before this process does, it outlives it otherwise
+	go serve.Wait()
+	return nil
+}
+
+// Tell whether the local server answers, and which process it is
+func serverStatus(client *api.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pid, pidErr := readServerPID()
+	health, err := client.Health(ctx)
+	if err != nil {
+		fmt.Println("Server is not running.")
+		return nil
+	}
+
+	fmt.Printf("Server is running (status: %s, version: %s, up %s)\n", health.Status, health.Version, time.Duration(health.UptimeSeconds)*time.Second)
+	if pidErr == nil {
+		fmt.Printf("PID: %d\n", pid)
+	}
+	return nil
+}
+
+// Ask the server of the PID file to shut down and wait until it is gone
+func stopServer() error {
+	pid, err := readServerPID()
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("Server is not running.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !serverAlive(pid) {
+		// Killed without a chance to clean up after itself
+		path, _ := serverPIDPath()
+		os.Remove(path)
+		fmt.Println("Server is not running.")
+		return nil
+	}
+
+	if err := terminate(pid); err != nil {
+		return fmt.Errorf("failed to stop server %d: %w", pid, err)
+	}
+
+	deadline := time.Now().Add(serverStopTimeout)
+	for serverAlive(pid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server %d is still running after %s", pid, serverStopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	fmt.Printf("Stopped server %d.\n", pid)
+	return nil
+}
+
+// Whether the server with the given PID has yet to exit, it removes its PID file on the way out
+func serverAlive(pid int) bool {
+	current, err := readServerPID()
+	return err == nil && current == pid && processAlive(pid)
+}
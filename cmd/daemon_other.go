@@ -0,0 +1,29 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+// A child already outlives the console of its parent
+func detach(cmd *exec.Cmd) {}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// There is no SIGTERM to send, the server stops without draining
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
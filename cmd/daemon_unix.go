@@ -0,0 +1,25 @@
+//go:build unix
+
+package cmd
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Run cmd in its own session, so it outlives the terminal the CLI was started from
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	// EPERM means it exists but belongs to another user
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Let the server drain its requests like on Ctrl+C
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+)
+
+// Formats of --output
+const (
+	outputText       = "text"
+	outputJSON       = "json"
+	outputStreamJSON = "stream-json"
+)
+
+var outputFormats = []string{outputText, outputJSON, outputStreamJSON}
+
+// Type of the last line of stream-json, the only one of json
+const eventResult = "result"
+
+// What a headless run does instead of opening the TUI
+type headlessOptions struct {
+	prompt string
+	output string
+	// Input piped into the process, sent along with the prompt
+	stdin          string
+	stdinTruncated bool
+}
+
+// Summary of a headless run, for programs wrapping tinker
+type headlessResult struct {
+	Type           string          `json:"type"`
+	ConversationID string          `json:"conversation_id"`
+	Result         string          `json:"result"`
+	IsError        bool            `json:"is_error"`
+	Error          string          `json:"error,omitempty"`
+	DurationMs     int64           `json:"duration_ms"`
+	Usage          inference.Usage `json:"usage"`
+}
+
+// Answer a single prompt and exit. Text goes to stdout as it streams, with tool calls on stderr.
+// The json formats write the typed events of the run to stdout instead, one object per line
+func headless(ctx context.Context, a *agent.Agent, sub inference.BaseLLMClient, opts headlessOptions) error {
+	start := time.Now()
+	out := json.NewEncoder(os.Stdout)
+
+	var usage inference.Usage
+	emit := func(e agent.Event) {
+		if e.Type == agent.EventUsage && e.Usage != nil {
+			usage.InputTokens += e.Usage.InputTokens
+			usage.OutputTokens += e.Usage.OutputTokens
+			usage.CacheReadTokens += e.Usage.CacheReadTokens
+			usage.CacheWriteTokens += e.Usage.CacheWriteTokens
+		}
+
+		switch opts.output {
+		case outputStreamJSON:
+			out.Encode(e)
+		case outputText:
+			writeToolCallPlain(os.Stderr, e)
+		}
+	}
+	a.OnEvent = recordEvents(emit)
+
+	onDelta := func(delta string) {
+		if opts.output == outputText {
+			fmt.Print(delta)
+			return
+		}
+		emit(agent.Event{Type: agent.EventText, Text: delta})
+	}
+
+	var attachments []message.ContentBlock
+	var runErr error
+	if opts.stdin != "" {
+		var block message.ContentBlock
+		block, runErr = stdinAttachment(ctx, sub, opts.stdin, opts.stdinTruncated)
+		attachments = append(attachments, block)
+	}
+	if runErr == nil {
+		runErr = a.RunWithAttachments(ctx, opts.prompt, attachments, onDelta)
+	}
+
+	if opts.output == outputText {
+		fmt.Println()
+		return runErr
+	}
+
+	result := headlessResult{
+		Type:           eventResult,
+		ConversationID: a.Conv.ID,
+		Result:         lastResponse(a.Conv),
+		DurationMs:     time.Since(start).Milliseconds(),
+		Usage:          usage,
+	}
+	if runErr != nil {
+		recordRunError(runErr)
+		result.IsError = true
+		result.Error = runErr.Error()
+	}
+	if err := out.Encode(result); err != nil {
+		return err
+	}
+
+	return runErr
+}
+
+func writeToolCallPlain(w io.Writer, e agent.Event) {
+	if e.Type != agent.EventToolResult {
+		return
+	}
+	if e.IsError {
+		fmt.Fprintf(w, "%s✗ %s%s\n", colorRed, e.Tool, colorReset)
+		return
+	}
+	fmt.Fprintf(w, "%s✓ %s%s\n", colorGreen, e.Tool, colorReset)
+}
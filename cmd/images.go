@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/rivo/tview"
+)
+
+// Largest image the providers take inline
+const maxImageSize = 5 * 1024 * 1024
+
+// Formats both providers accept
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func newImage(data []byte, name string) (message.ImageBlock, error) {
+	if len(data) > maxImageSize {
+		return message.ImageBlock{}, fmt.Errorf("%s is larger than %d MB", name, maxImageSize/1024/1024)
+	}
+
+	// Sniffed rather than trusting the extension
+	mediaType := http.DetectContentType(data)
+	if !imageTypes[mediaType] {
+		return message.ImageBlock{}, fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image", name)
+	}
+
+	return message.NewImageBlock(mediaType, data, name).(message.ImageBlock), nil
+}
+
+// Image file named by pasted text, as terminals paste the path of a dropped file.
+// False when the text is not a path to an image, so it is pasted as is
+func imageFromPath(pasted string) (message.ImageBlock, bool, error) {
+	path := strings.TrimSpace(pasted)
+	if strings.ContainsAny(path, "\n") {
+		return message.ImageBlock{}, false, nil
+	}
+
+	// Finder and file managers quote, escape or send a URI depending on the terminal
+	if len(path) >= 2 && (path[0] == '\'' || path[0] == '"') && path[len(path)-1] == path[0] {
+		path = path[1 : len(path)-1]
+	}
+	if u, err := url.Parse(path); err == nil && u.Scheme == "file" {
+		path = u.Path
+	}
+	path = strings.ReplaceAll(path, `\ `, " ")
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+	default:
+		return message.ImageBlock{}, false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return message.ImageBlock{}, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return message.ImageBlock{}, true, err
+	}
+
+	img, err := newImage(data, filepath.Base(path))
+	return img, true, err
+}
+
+// Lets pasted text be taken before it reaches the focused primitive
+type pasteInterceptor struct {
+	tview.Primitive
+	// True when the paste was handled
+	onPaste func(text string) bool
+}
+
+func (p *pasteInterceptor) PasteHandler() func(text string, setFocus func(p tview.Primitive)) {
+	handler := p.Primitive.PasteHandler()
+	return func(text string, setFocus func(p tview.Primitive)) {
+		if p.onPaste(text) {
+			return
+		}
+		if handler != nil {
+			handler(text, setFocus)
+		}
+	}
+}
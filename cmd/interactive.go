@@ -3,7 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
+	"os"
 
 	"github.com/honganh1206/tinker/agent"
 	"github.com/honganh1206/tinker/inference"
@@ -12,27 +12,17 @@ import (
 	"github.com/honganh1206/tinker/server/data"
 	"github.com/honganh1206/tinker/tools"
 	"github.com/honganh1206/tinker/ui"
+	"github.com/honganh1206/tinker/utils"
 )
 
 // TODO: All these parameters should go into a struct
-func interactive(ctx context.Context, convID string, llmClient, llmClientSub inference.BaseLLMClient, apiClient *api.Client, mcpConfigs []mcp.ServerConfig, useTUI bool) error {
+func interactive(ctx context.Context, convID string, llmClient, llmClientSub inference.BaseLLMClient, apiClient *api.Client, mcpConfigs []mcp.ServerConfig, useTUI bool, run *headlessOptions) error {
 	llm, err := inference.Init(ctx, llmClient)
 	if err != nil {
-		log.Fatalf("Failed to initialize model: %s", err.Error())
+		return fmt.Errorf("failed to initialize model: %w", err)
 	}
 
-	toolBox := &tools.ToolBox{
-		Tools: []*tools.ToolDefinition{
-			&tools.ReadFileDefinition,
-			&tools.ListFilesDefinition,
-			&tools.EditFileDefinition,
-			&tools.GrepSearchDefinition,
-			&tools.FinderDefinition,
-			&tools.BashDefinition,
-			&tools.PlanWriteDefinition,
-			&tools.PlanReadDefinition,
-		},
-	}
+	toolBox := agentToolBox()
 
 	subToolBox := &tools.ToolBox{
 		Tools: []*tools.ToolDefinition{
@@ -47,22 +37,25 @@ func interactive(ctx context.Context, convID string, llmClient, llmClientSub inf
 	var plan *data.Plan
 
 	if convID != "" {
-		conv, err = apiClient.GetConversation(convID)
+		// The plan stays nil until the agent writes one
+		conv, plan, err = apiClient.GetConversationWithPlan(convID)
 		if err != nil {
 			return err
 		}
-		plan, err = apiClient.GetPlan(convID)
-		// TODO: There could be a case where there is no plan for a conversation
-		// what should we do then?
-		if err != nil {
-		}
 	} else {
-		conv, err = apiClient.CreateConversation()
+		conv, err = apiClient.CreateConversation(utils.CurrentProject())
 		if err != nil {
 			return err
 		}
 	}
 
+	// File tools stay in the working directory and those added with --add-dir
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	workspace := tools.NewWorkspaceFS(tools.OSFS{}, append([]string{cwd}, llmClient.Dirs...)...)
+
 	subllm, err := inference.Init(ctx, llmClientSub)
 	if err != nil {
 		return fmt.Errorf("failed to initialize sub-agent LLM: %w", err)
@@ -79,25 +72,51 @@ func interactive(ctx context.Context, convID string, llmClient, llmClientSub inf
 		Plan:         plan,
 		Streaming:    true,
 		Controller:   ctl,
+		Limits:       runLimits,
+		FS:           workspace,
 	}
 
 	a := agent.New(cfg)
+	restrictTools(a)
 
 	subCfg := &agent.Config{
 		LLM:       subllm,
 		ToolBox:   subToolBox,
 		Streaming: false,
+		FS:        workspace,
 	}
 
-	sub := agent.NewSubagent(subCfg)
+	sub, err := agent.NewSubagent(subCfg)
+	if err != nil {
+		return err
+	}
 	a.Sub = sub
 
-	a.RegisterMCPServers()
-	defer a.ShutdownMCPServers()
-
-	if useTUI {
-		err = tui(ctx, a, ctl)
-	} else {
+	// Servers start in the background so a slow one does not hold back the UI.
+	// Cached tools are usable right away, the others from the next message on
+	mcpCtx, stopMCP := context.WithCancel(ctx)
+	mcpReady := a.RegisterMCPServers(mcpCtx)
+	go func() {
+		<-mcpReady
+		restrictTools(a)
+		a.MonitorMCPServers(mcpCtx)
+	}()
+	defer func() {
+		// Abort pending startups and stop pinging before the servers are shut down
+		stopMCP()
+		<-mcpReady
+		a.ShutdownMCPServers()
+	}()
+
+	switch {
+	case run != nil:
+		// A single prompt gets every tool, the servers are not coming up later
+		<-mcpReady
+		restrictTools(a)
+		err = headless(ctx, a, llmClientSub, *run)
+	case useTUI:
+		err = tui(ctx, a, ctl, llmClient)
+	default:
 		err = cli(ctx, a)
 	}
 
@@ -107,3 +126,19 @@ func interactive(ctx context.Context, convID string, llmClient, llmClientSub inf
 
 	return nil
 }
+
+// Tools of the agent before those of MCP servers, in the order they are offered to the model
+func agentToolBox() *tools.ToolBox {
+	return &tools.ToolBox{
+		Tools: []*tools.ToolDefinition{
+			&tools.ReadFileDefinition,
+			&tools.ListFilesDefinition,
+			&tools.EditFileDefinition,
+			&tools.GrepSearchDefinition,
+			&tools.FinderDefinition,
+			&tools.BashDefinition,
+			&tools.PlanWriteDefinition,
+			&tools.PlanReadDefinition,
+		},
+	}
+}
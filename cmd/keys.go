@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// What the help overlay documents, read from the live registries each time it opens
+type helpContents struct {
+	keys     ui.Keymap
+	commands *ui.Commands
+	llm      inference.LLMClient
+	servers  []ui.MCPServerStatus
+}
+
+func formatHelp(h helpContents) string {
+	theme := ui.CurrentTheme()
+	var b strings.Builder
+
+	section := func(title string) {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, " [%s::b]%s[-::-]\n", theme.Text, title)
+	}
+
+	section("Model")
+	fmt.Fprintf(&b, " [%s::]%s[-::] [%s::]%s, /model switches[-::]\n", theme.Accent, tview.Escape(h.llm.ModelName()), theme.Muted, tview.Escape(h.llm.ProviderName()))
+
+	section("MCP servers")
+	if len(h.servers) == 0 {
+		fmt.Fprintf(&b, " [%s::]None configured[-::]\n", theme.Muted)
+	}
+	for _, s := range h.servers {
+		state, color := "running", theme.Success
+		if !s.Healthy {
+			state, color = "not responding", theme.Error
+		}
+		fmt.Fprintf(&b, " [%s::]●[-::] %-26s [%s::]%s[-::]\n", color, tview.Escape(s.ID), theme.Muted, state)
+	}
+
+	section("Commands")
+	for _, c := range h.commands.Complete("") {
+		fmt.Fprintf(&b, " [%s::]%-14s[-::] %s\n", theme.Accent, "/"+tview.Escape(c.Name), tview.Escape(commandSummary(c)))
+	}
+
+	section("Key bindings")
+	for _, binding := range h.keys.Bindings() {
+		fmt.Fprintf(&b, " [%s::]%-14s[-::] %-28s [%s::]%s[-::]\n", theme.Accent, tview.Escape(binding.Keys), binding.Action, theme.Muted, tview.Escape(binding.Description))
+	}
+
+	fmt.Fprintf(&b, "\n [%s::]Up/Down move through completions and pickers, and recall sent prompts from an empty input.[-::]\n", theme.Muted)
+	if path, err := ui.KeymapPath(); err == nil {
+		fmt.Fprintf(&b, " [%s::]Rebind in %s, e.g. {\"switch_conversation\": \"Ctrl+T\"}[-::]\n", theme.Muted, tview.Escape(path))
+	}
+
+	return b.String()
+}
+
+// Overlay documenting the model, MCP servers, commands and key bindings in effect
+func newHelp(h helpContents, onClose func()) *tview.TextView {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText(formatHelp(h))
+	view.SetBorder(true).
+		SetTitle(" Help ").
+		SetTitleAlign(tview.AlignLeft)
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if h.keys.Matches(ui.ActionCancel, event) || h.keys.Matches(ui.ActionHelp, event) || event.Key() == tcell.KeyEnter {
+			onClose()
+			return nil
+		}
+		return event
+	})
+
+	return view
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+const (
+	// Walking stops here so huge trees don't stall the input
+	maxWorkspaceFiles = 20000
+	// Files past this are left for read_file, which can page through them
+	maxAttachmentSize = 256 * 1024
+	maxMentionMatches = 50
+)
+
+// Directories nobody mentions files from
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"__pycache__":  true,
+}
+
+// Files under root relative to it, skipping hidden and dependency directories
+func workspaceFiles(root string) []string {
+	var files []string
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are left out rather than failing the walk
+			return nil
+		}
+		if len(files) >= maxWorkspaceFiles {
+			return filepath.SkipAll
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || skippedDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if rel, err := filepath.Rel(root, path); err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	return files
+}
+
+// Files that can be mentioned: those of the working directory relative to it,
+// then those of the directories added with --add-dir as absolute paths
+func mentionFiles(dirs []string) []string {
+	files := workspaceFiles(".")
+	for _, dir := range dirs {
+		for _, f := range workspaceFiles(dir) {
+			files = append(files, filepath.ToSlash(filepath.Join(dir, f)))
+		}
+	}
+	return files
+}
+
+// The @mention being typed at the end of the input, and where it starts
+func mentionAtEnd(input string) (start int, query string, ok bool) {
+	start = strings.LastIndexAny(input, " \t\n") + 1
+	word := input[start:]
+
+	query, ok = strings.CutPrefix(word, "@")
+	return start, query, ok
+}
+
+// Best fuzzy matches of query among files, shorter paths first on a tie
+func mentionItems(files []string, query string) []completionItem {
+	type match struct {
+		path  string
+		score int
+	}
+
+	var matches []match
+	for _, f := range files {
+		if score, ok := fuzzyScore(query, f); ok {
+			matches = append(matches, match{f, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return len(matches[i].path) < len(matches[j].path)
+	})
+
+	accent := ui.CurrentTheme().Accent
+	var items []completionItem
+	for _, m := range matches[:min(len(matches), maxMentionMatches)] {
+		items = append(items, completionItem{
+			label: "[" + accent + "::]@[-::]" + tview.Escape(m.path),
+			value: m.path,
+		})
+	}
+	return items
+}
+
+// Read the files mentioned as @path in content so they go along with the message.
+// Mentions that are not readable text files are left in the text as typed, with a reason
+func attachMentions(content string) (attachments []message.ContentBlock, attached []string, skipped []string) {
+	seen := make(map[string]bool)
+
+	for _, word := range strings.Fields(content) {
+		path, ok := strings.CutPrefix(word, "@")
+		if !ok {
+			continue
+		}
+		// Punctuation closing a sentence is not part of the path
+		path = strings.TrimRight(path, ",.;:!?)'\"")
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			// Likely a handle or an email rather than a file
+			continue
+		}
+		if info.Size() > maxAttachmentSize {
+			skipped = append(skipped, fmt.Sprintf("%s is larger than %d KB", path, maxAttachmentSize/1024))
+			continue
+		}
+
+		body, err := os.ReadFile(path)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if bytes.IndexByte(body[:min(len(body), 8000)], 0) >= 0 {
+			skipped = append(skipped, fmt.Sprintf("%s is binary", path))
+			continue
+		}
+
+		attachments = append(attachments, message.NewFileBlock(path, string(body)))
+		attached = append(attached, path)
+	}
+
+	return attachments, attached, skipped
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Move the agent to another model mid-session. The provider is told by the model name,
+// custom names stay on the current provider. The subagent follows when the provider changes.
+// On success base describes the new model
+func switchModel(ctx context.Context, a *agent.Agent, base *inference.BaseLLMClient, model string) error {
+	provider := inference.ProviderForModel(model)
+	if provider == "" {
+		provider = inference.ProviderName(base.Provider)
+	}
+
+	next := inference.BaseLLMClient{Provider: string(provider), Model: model, TokenLimit: base.TokenLimit}
+	llm, err := inference.Init(ctx, next)
+	if err != nil {
+		return err
+	}
+
+	var sub inference.LLMClient
+	if next.Provider != base.Provider {
+		sub, err = inference.Init(ctx, inference.BaseLLMClient{
+			Provider:   next.Provider,
+			Model:      string(inference.GetDefaultModelSubagent(provider)),
+			TokenLimit: base.TokenLimit,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := a.SwitchModel(llm, sub); err != nil {
+		return err
+	}
+
+	*base = next
+	return nil
+}
+
+// Models offered by /model, the default of each provider first
+func switchableModels() []inference.ModelVersion {
+	var models []inference.ModelVersion
+	for _, provider := range []inference.ProviderName{inference.AnthropicProvider, inference.GoogleProvider} {
+		models = append(models, inference.GetDefaultModel(provider))
+		for _, model := range inference.ListAvailableModels(provider) {
+			if !slices.Contains(models, model) {
+				models = append(models, model)
+			}
+		}
+	}
+	return models
+}
+
+func newModelPicker(current string, keys ui.Keymap, onSelect func(model string), onCancel func()) *tview.List {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true).
+		SetTitle(" Switch model ").
+		SetTitleAlign(tview.AlignLeft)
+
+	selected := 0
+	for i, model := range switchableModels() {
+		label := string(model)
+		if label == current {
+			label = "[" + ui.CurrentTheme().Success + "::]●[-::] " + label
+			selected = i
+		}
+		list.AddItem(label, "", 0, func() { onSelect(string(model)) })
+	}
+	list.SetCurrentItem(selected)
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if keys.Matches(ui.ActionCancel, event) {
+			onCancel()
+			return nil
+		}
+		return event
+	})
+
+	return list
+}
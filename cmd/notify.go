@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"sync/atomic"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/ui"
+)
+
+// Screen keeping track of whether the terminal window has focus.
+// tview drops focus events, so they are caught before reaching it
+type focusScreen struct {
+	tcell.Screen
+	unfocused atomic.Bool
+}
+
+func newFocusScreen() (*focusScreen, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+	return &focusScreen{Screen: screen}, nil
+}
+
+func (s *focusScreen) Init() error {
+	if err := s.Screen.Init(); err != nil {
+		return err
+	}
+	// Terminals that do not report focus leave the window taken as focused
+	s.EnableFocus()
+	return nil
+}
+
+func (s *focusScreen) PollEvent() tcell.Event {
+	for {
+		event := s.Screen.PollEvent()
+		focus, ok := event.(*tcell.EventFocus)
+		if !ok {
+			return event
+		}
+		s.unfocused.Store(!focus.Focused)
+	}
+}
+
+func (s *focusScreen) focused() bool {
+	return !s.unfocused.Load()
+}
+
+// Draw attention to the TUI while the user is looking elsewhere
+func notifyUnfocused(screen *focusScreen, mode, body string) error {
+	if mode == ui.NotifyOff || screen.focused() {
+		return nil
+	}
+
+	screen.Beep()
+	if mode != ui.NotifyDesktop {
+		return nil
+	}
+	return ui.Notify("tinker", body)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Side panel next to the input listing the steps of the plan
+type planPanel struct {
+	*tview.List
+	plan *data.Plan
+}
+
+func newPlanPanel() *planPanel {
+	list := tview.NewList().
+		ShowSecondaryText(false).
+		SetHighlightFullLine(true).
+		SetSelectedFocusOnly(true)
+	list.SetBorder(true).
+		SetTitle(" Plan ").
+		SetTitleAlign(tview.AlignLeft)
+
+	return &planPanel{List: list}
+}
+
+// Show another version of the plan, staying on the selected step
+func (p *planPanel) set(plan *data.Plan) {
+	current := p.GetCurrentItem()
+	p.plan = plan
+
+	p.Clear()
+	if plan == nil {
+		return
+	}
+	for _, step := range plan.Steps {
+		p.AddItem(formatPlanStep(step), "", 0, nil)
+	}
+	p.SetCurrentItem(min(current, len(plan.Steps)-1))
+}
+
+func (p *planPanel) selected() (*data.Step, bool) {
+	i := p.GetCurrentItem()
+	if p.plan == nil || i < 0 || i >= len(p.plan.Steps) {
+		return nil, false
+	}
+	return p.plan.Steps[i], true
+}
+
+func stepDone(step *data.Step) bool {
+	return strings.ToUpper(step.Status) == "DONE"
+}
+
+func formatPlanStep(step *data.Step) string {
+	theme := ui.CurrentTheme()
+	// The notes themselves are in the step details
+	var notes string
+	if step.Notes != "" {
+		notes = fmt.Sprintf(" [%s::]✎[-]", theme.Muted)
+	}
+	if stepDone(step) {
+		return fmt.Sprintf("[%s::]✓ %s[-]%s", theme.Success, tview.Escape(step.Description), notes)
+	}
+	return fmt.Sprintf("[%s::]○ %s[-]%s", theme.Text, tview.Escape(step.Description), notes)
+}
+
+// Overlay with the whole description and the acceptance criteria of a step
+func newStepDetails(step *data.Step, keys ui.Keymap, onClose func()) *tview.TextView {
+	theme := ui.CurrentTheme()
+
+	var b strings.Builder
+	status := fmt.Sprintf("[%s::]TODO[-::]", theme.Warning)
+	if stepDone(step) {
+		status = fmt.Sprintf("[%s::]DONE[-::]", theme.Success)
+	}
+	fmt.Fprintf(&b, "%s [%s::]%s[-::]\n\n", status, theme.Muted, tview.Escape(step.ID))
+	fmt.Fprintf(&b, "%s\n", tview.Escape(step.Description))
+	if meta := step.Metadata(); meta != "" {
+		fmt.Fprintf(&b, "[%s::]%s[-::]\n", theme.Muted, meta)
+	}
+	if step.Notes != "" {
+		fmt.Fprintf(&b, "\n[%s::]Notes[-::]\n%s\n", theme.Accent, tview.Escape(step.Notes))
+	}
+
+	if len(step.Acceptance) > 0 {
+		fmt.Fprintf(&b, "\n[%s::]Acceptance criteria[-::]\n", theme.Accent)
+		for _, criterion := range step.Acceptance {
+			fmt.Fprintf(&b, " • %s\n", tview.Escape(criterion))
+		}
+	}
+
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true).
+		SetText(b.String())
+	view.SetBorder(true).
+		SetTitle(" Step ").
+		SetTitleAlign(tview.AlignLeft)
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if keys.Matches(ui.ActionCancel, event) || keys.Matches(ui.ActionStepDetails, event) {
+			onClose()
+			return nil
+		}
+		return event
+	})
+
+	return view
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/spf13/cobra"
+)
+
+func PlanListHandler(cmd *cobra.Command, args []string) error {
+	tags, err := cmd.Flags().GetStringSlice("tag")
+	if err != nil {
+		return err
+	}
+
+	project, err := cmd.Flags().GetString("project")
+	if err != nil {
+		return err
+	}
+	if project != "" {
+		project = utils.ProjectRoot(project)
+	}
+
+	plans, err := newAPIClient().ListPlans(data.ListFilter{Project: project, Tags: tags})
+	if err != nil {
+		return fmt.Errorf("error listing plans: %w", err)
+	}
+
+	if len(plans) == 0 {
+		fmt.Println("No plans found.")
+		return nil
+	}
+
+	headers := []string{"ID", "Conversation", "Project", "Tags", "Status", "Steps"}
+	var rows [][]string
+	for _, p := range plans {
+		rows = append(rows, []string{
+			p.ID,
+			p.ConversationID,
+			p.Project,
+			strings.Join(p.Tags, ", "),
+			p.Status,
+			fmt.Sprintf("%d/%d", p.CompletedTasks, p.TotalTasks),
+		})
+	}
+	utils.RenderTable(headers, rows)
+
+	return nil
+}
+
+// Find a plan by its ID or the ID of its conversation, the API reads plans by the latter and deletes them by the former
+func findPlan(client *api.Client, id string) (data.PlanInfo, error) {
+	plans, err := client.ListPlans(data.ListFilter{})
+	if err != nil {
+		return data.PlanInfo{}, fmt.Errorf("error listing plans: %w", err)
+	}
+
+	for _, p := range plans {
+		if p.ID == id || p.ConversationID == id {
+			return p, nil
+		}
+	}
+	return data.PlanInfo{}, fmt.Errorf("plan %s not found", id)
+}
+
+func PlanShowHandler(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+
+	info, err := findPlan(client, args[0])
+	if err != nil {
+		return err
+	}
+
+	plan, err := client.GetPlan(info.ConversationID)
+	if errors.Is(err, data.ErrPlanNotFound) {
+		return fmt.Errorf("plan %s not found", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("error getting plan: %w", err)
+	}
+
+	if len(plan.Steps) == 0 {
+		fmt.Println("The plan has no steps.")
+		return nil
+	}
+
+	text := plan.Inspect()
+	if stdoutIsTerminal() {
+		text = colorizePlan(text)
+	}
+	fmt.Print(text)
+
+	return nil
+}
+
+// Color the status in the step headlines of Plan.Inspect, and dim the criteria headings and step metadata
+func colorizePlan(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "## ") && strings.Contains(line, "[DONE]"):
+			lines[i] = colorGreen + line + colorReset
+		case strings.HasPrefix(line, "## "):
+			lines[i] = colorYellow + line + colorReset
+		case line == "Acceptance Criteria:", strings.HasPrefix(line, "Added "):
+			lines[i] = colorGray + line + colorReset
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Delete every plan with all of its steps done, and those without steps
+func PlanCompactHandler(cmd *cobra.Command, args []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	client := newAPIClient()
+
+	plans, err := client.ListPlans(data.ListFilter{})
+	if err != nil {
+		return fmt.Errorf("error listing plans: %w", err)
+	}
+
+	var ids []string
+	for _, p := range plans {
+		if p.TotalTasks == 0 || p.Status == "DONE" {
+			ids = append(ids, p.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		fmt.Println("No completed plans.")
+		return nil
+	}
+
+	if dryRun {
+		for _, id := range ids {
+			fmt.Printf("Would delete plan %s\n", id)
+		}
+		return nil
+	}
+
+	results, err := client.DeletePlans(ids)
+	if err != nil {
+		return fmt.Errorf("error deleting plans: %w", err)
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if err := results[id]; err != nil {
+			fmt.Fprintf(os.Stderr, "%sFailed to delete plan %s: %v%s\n", colorRed, id, err, colorReset)
+			continue
+		}
+		deleted++
+	}
+	fmt.Printf("Deleted %d completed plan(s)\n", deleted)
+
+	if deleted < len(ids) {
+		return fmt.Errorf("%d plan(s) could not be deleted", len(ids)-deleted)
+	}
+	return nil
+}
+
+func PlanDeleteHandler(cmd *cobra.Command, args []string) error {
+	client := newAPIClient()
+	for _, id := range args {
+		info, err := findPlan(client, id)
+		if err != nil {
+			return err
+		}
+
+		if err := client.DeletePlan(info.ID); err != nil {
+			if errors.Is(err, data.ErrPlanNotFound) {
+				return fmt.Errorf("plan %s not found", id)
+			}
+			return fmt.Errorf("error deleting plan: %w", err)
+		}
+		fmt.Printf("Deleted plan %s\n", info.ID)
+	}
+	return nil
+}
+
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
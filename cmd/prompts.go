@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/prompts"
+	"github.com/spf13/cobra"
+)
+
+func PromptsShowHandler(cmd *cobra.Command, args []string) error {
+	resolved, err := cmd.Flags().GetBool("resolved")
+	if err != nil {
+		return err
+	}
+
+	// The prompt of the provider in use unless one is named
+	name := prompts.Gemini
+	if inference.ProviderName(llm.Provider) == inference.AnthropicProvider {
+		name = prompts.Claude
+	}
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	prompt, err := prompts.Load(name)
+	if err != nil {
+		return err
+	}
+
+	source := "built in"
+	if prompt.Path != "" {
+		source = prompt.Path
+	}
+	fmt.Fprintf(os.Stderr, "%sPrompt %s from %s%s\n", colorGray, prompt.Name, source, colorReset)
+
+	if !resolved {
+		fmt.Println(prompt.Source)
+		return nil
+	}
+
+	// As the agent starts out, MCP servers add their tools later
+	data := prompts.NewData(nil)
+	for _, t := range agentToolBox().Tools {
+		if userConfig.AllowsTool(t.Name) {
+			data.Tools = append(data.Tools, t.Name)
+		}
+	}
+	text, err := prompt.Render(data)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
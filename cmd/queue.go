@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Queued messages listed at most, the rest are counted
+const maxQueuedLines = 3
+
+// Lines under the input with the messages sent during a run, until the agent takes them.
+// Only touched from the UI goroutine
+type queuedMessages struct {
+	*tview.TextView
+	texts []string
+}
+
+func newQueuedMessages() *queuedMessages {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(false)
+
+	return &queuedMessages{TextView: view}
+}
+
+// Each add, pop and take returns the height the view needs
+func (q *queuedMessages) add(text string) int {
+	q.texts = append(q.texts, text)
+	return q.render()
+}
+
+// The agent took the oldest one
+func (q *queuedMessages) pop() int {
+	if len(q.texts) > 0 {
+		q.texts = q.texts[1:]
+	}
+	return q.render()
+}
+
+// Remove every message, e.g., when the run failed before the agent took them
+func (q *queuedMessages) take() ([]string, int) {
+	texts := q.texts
+	q.texts = nil
+	return texts, q.render()
+}
+
+func (q *queuedMessages) render() int {
+	theme := ui.CurrentTheme()
+	q.Clear()
+
+	var b strings.Builder
+	for i, text := range q.texts {
+		if i == maxQueuedLines {
+			fmt.Fprintf(&b, "[%s::]  +%d more[-::]\n", theme.Muted, len(q.texts)-i)
+			break
+		}
+		first, _, multiline := strings.Cut(strings.TrimSpace(text), "\n")
+		if multiline {
+			first += " …"
+		}
+		fmt.Fprintf(&b, "[%s::i]⋯ %s[-::-] [%s::]queued[-::]\n", theme.Muted, tview.Escape(first), theme.Muted)
+	}
+	q.SetText(strings.TrimSuffix(b.String(), "\n"))
+
+	return min(len(q.texts), maxQueuedLines+1)
+}
+
+// Write a queued message into the conversation when the agent takes it, so it lands where the model reads it
+func writeQueuedSent(view *tview.TextView, spinner *atomic.Pointer[ui.Spinner], onSent func(), next func(agent.Event)) func(agent.Event) {
+	return func(e agent.Event) {
+		if e.Type != agent.EventQueuedSent {
+			next(e)
+			return
+		}
+
+		// Right after the response rather than a tool call
+		if s := spinner.Load(); s != nil && s.Phase() == phaseResponding {
+			fmt.Fprint(view, "\n\n")
+		}
+		fmt.Fprintf(view, "[%s::i]> %s\n\n", ui.CurrentTheme().User, e.Text)
+		onSent()
+	}
+}
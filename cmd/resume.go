@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/rivo/tview"
+)
+
+// Let the user pick a conversation to resume in a full-screen list, before the TUI starts.
+// Empty when they leave without picking one
+func pickConversation(client *api.Client) (string, error) {
+	keys, err := ui.LoadKeymap()
+	if err != nil {
+		return "", err
+	}
+
+	theme, err := ui.LoadThemeNamed(userConfig.Theme)
+	if err != nil {
+		return "", err
+	}
+	ui.SetTheme(theme)
+
+	app := tview.NewApplication()
+
+	var picked string
+	switcher := newConversationSwitcher(app, client, "", utils.CurrentProject(), keys, func(id string) {
+		picked = id
+		app.Stop()
+	}, app.Stop)
+
+	// Nothing to resume here, the conversations of other projects are better than an empty list
+	if len(switcher.convs) == 0 && switcher.loadErr == nil && !switcher.allProjects {
+		switcher.allProjects = true
+		switcher.load()
+	}
+
+	if err := app.SetRoot(switcher, true).SetFocus(switcher).Run(); err != nil {
+		return "", err
+	}
+
+	return picked, nil
+}
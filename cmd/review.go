@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/prompts"
+	"github.com/honganh1206/tinker/tools"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/spf13/cobra"
+)
+
+// Largest diff sent for review, past it the scope should be narrowed
+const maxReviewDiff = 256 << 10
+
+// Severities of findings, most severe first
+var severities = []string{"high", "medium", "low"}
+
+// Problem found in the diff, the shape the review prompt asks for
+type finding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// What --output json writes, for CI jobs
+type reviewResult struct {
+	ConversationID string    `json:"conversation_id"`
+	Findings       []finding `json:"findings"`
+}
+
+var jsonFence = regexp.MustCompile("(?s)```json\\s*\\n(.*?)```")
+
+func ReviewHandler(cmd *cobra.Command, args []string) error {
+	staged, err := cmd.Flags().GetBool("staged")
+	if err != nil {
+		return err
+	}
+
+	base, err := cmd.Flags().GetString("branch")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("unknown output format %q, expected text or json", output)
+	}
+
+	failOn, err := cmd.Flags().GetString("fail-on")
+	if err != nil {
+		return err
+	}
+	if failOn != "" && !slices.Contains(severities, failOn) {
+		return fmt.Errorf("unknown severity %q, expected one of %s", failOn, strings.Join(severities, ", "))
+	}
+
+	scope, gitArgs := "uncommitted changes", []string{"diff", "HEAD"}
+	switch {
+	case staged && base != "":
+		return errors.New("--staged and --branch cannot be used together")
+	case staged:
+		scope, gitArgs = "staged changes", []string{"diff", "--staged"}
+	case base != "":
+		scope, gitArgs = "changes since "+base, []string{"diff", base + "...HEAD"}
+	}
+
+	diff, err := gitDiff(cmd.Context(), gitArgs...)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		if output == outputJSON {
+			return json.NewEncoder(os.Stdout).Encode(reviewResult{Findings: []finding{}})
+		}
+		fmt.Println("Nothing to review")
+		return nil
+	}
+	if len(diff) > maxReviewDiff {
+		return fmt.Errorf("the diff is larger than %d KB, review fewer changes at a time", maxReviewDiff>>10)
+	}
+
+	setDefaultModels()
+
+	llmClient, err := inference.Init(cmd.Context(), llm)
+	if err != nil {
+		return fmt.Errorf("failed to initialize model: %w", err)
+	}
+
+	client := newAPIClient()
+	conv, err := client.CreateConversation(utils.CurrentProject())
+	if err != nil {
+		return err
+	}
+	// Only a label, the review runs either way
+	client.RenameConversation(conv.ID, "Review of "+scope)
+
+	// Reading the code around the changes is all a review needs
+	a := agent.New(&agent.Config{
+		LLM:          llmClient,
+		Conversation: conv,
+		ToolBox: &tools.ToolBox{
+			Tools: []*tools.ToolDefinition{
+				&tools.ReadFileDefinition,
+				&tools.ListFilesDefinition,
+				&tools.GrepSearchDefinition,
+			},
+		},
+		Client:    client,
+		Streaming: true,
+		Limits:    runLimits,
+	})
+	restrictTools(a)
+	a.OnEvent = recordEvents(func(e agent.Event) { writeToolCallPlain(os.Stderr, e) })
+
+	prompt := prompts.ReviewPrompt() + "\n\n## Diff of the " + scope + "\n\n```diff\n" + diff + "\n```"
+	// The findings are printed once the answer is complete
+	if err := a.Run(cmd.Context(), prompt, func(string) {}); err != nil {
+		return err
+	}
+
+	answer := lastResponse(a.Conv)
+	findings, err := parseFindings(answer)
+	if err != nil {
+		return fmt.Errorf("%w, the answer was:\n%s", err, answer)
+	}
+
+	// The exit status is the verdict from here on, the usage would only get in the way
+	cmd.SilenceUsage = true
+
+	if output == outputJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(reviewResult{ConversationID: conv.ID, Findings: findings}); err != nil {
+			return err
+		}
+	} else {
+		printFindings(findings)
+	}
+
+	if failOn != "" {
+		limit := slices.Index(severities, failOn)
+		failing := 0
+		for _, f := range findings {
+			if i := slices.Index(severities, f.Severity); i >= 0 && i <= limit {
+				failing++
+			}
+		}
+		if failing > 0 {
+			return fmt.Errorf("%d findings of severity %s or higher", failing, failOn)
+		}
+	}
+
+	return nil
+}
+
+// Output of git, with its stderr as the error when it fails
+func gitDiff(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	git := exec.CommandContext(ctx, "git", args...)
+	git.Stdout, git.Stderr = &stdout, &stderr
+	if err := git.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return stdout.String(), nil
+}
+
+// Findings in the last JSON block of the answer, or in its outermost brackets
+// when the model left out the fence
+func parseFindings(answer string) ([]finding, error) {
+	raw := ""
+	if blocks := jsonFence.FindAllStringSubmatch(answer, -1); len(blocks) > 0 {
+		raw = blocks[len(blocks)-1][1]
+	} else if start, end := strings.Index(answer, "["), strings.LastIndex(answer, "]"); start >= 0 && end > start {
+		raw = answer[start : end+1]
+	}
+	if raw == "" {
+		return nil, errors.New("the review has no findings block")
+	}
+
+	findings := []finding{}
+	if err := json.Unmarshal([]byte(raw), &findings); err != nil {
+		return nil, fmt.Errorf("the findings of the review are malformed: %w", err)
+	}
+	for i := range findings {
+		findings[i].Severity = strings.ToLower(findings[i].Severity)
+		if !slices.Contains(severities, findings[i].Severity) {
+			findings[i].Severity = "low"
+		}
+	}
+	slices.SortStableFunc(findings, func(a, b finding) int {
+		return slices.Index(severities, a.Severity) - slices.Index(severities, b.Severity)
+	})
+	return findings, nil
+}
+
+func printFindings(findings []finding) {
+	if len(findings) == 0 {
+		fmt.Printf("%sNo findings%s\n", colorGreen, colorReset)
+		return
+	}
+
+	colors := map[string]string{"high": colorRed, "medium": colorYellow, "low": ""}
+	for _, f := range findings {
+		location := f.File
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		fmt.Printf("%s %s[%s]%s %s\n", location, colors[f.Severity], f.Severity, colorReset, f.Message)
+		if f.Suggestion != "" {
+			fmt.Printf("    %s\n", f.Suggestion)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import "github.com/rivo/tview"
+
+// Scroll the view by lines, negative to go up. Reaching the bottom follows new text again,
+// anywhere above it the view stays put while responses stream in
+func scrollBy(view *tview.TextView, lines int) {
+	row, column := view.GetScrollOffset()
+	_, _, _, height := view.GetInnerRect()
+	bottom := max(view.GetWrappedLineCount()-height, 0)
+
+	row = min(max(row+lines, 0), bottom)
+	if row == bottom {
+		view.ScrollToEnd()
+		return
+	}
+	view.ScrollTo(row, column)
+}
+
+// Lines a page scroll moves, keeping one line of the previous page in sight
+func pageLines(view *tview.TextView) int {
+	_, _, _, height := view.GetInnerRect()
+	return max(height-1, 1)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// Color and region tags of tview, which matches must not be found in
+var tagPattern = regexp.MustCompile(`\[[a-zA-Z0-9_,;: \-\.#"]*\]`)
+
+// Tags wrapped around matches, taken out again when the search ends
+var matchTagPattern = regexp.MustCompile(`\["match-\d+"\]\[:[^\]]*\]|\[:-\]\[""\]`)
+
+// Search of the conversation view, whose text has its matches marked while it is open
+type conversationSearch struct {
+	view    *tview.TextView
+	query   string
+	matches int
+	// Index of the match scrolled to
+	current int
+}
+
+func newConversationSearch(view *tview.TextView) *conversationSearch {
+	return &conversationSearch{view: view}
+}
+
+func (s *conversationSearch) active() bool {
+	return s.query != ""
+}
+
+// Mark the matches of query, case insensitive, and scroll to the latest one
+func (s *conversationSearch) find(query string) {
+	if query == "" {
+		s.clear()
+		return
+	}
+
+	text, matches := markMatches(unmarkMatches(s.view.GetText(false)), query, ui.CurrentTheme().Selection)
+	s.query = query
+	s.matches = matches
+
+	s.view.SetText(text)
+	s.current = s.matches - 1
+	s.show()
+}
+
+// Go to the match delta away, wrapping around at both ends
+func (s *conversationSearch) move(delta int) {
+	if s.matches == 0 {
+		return
+	}
+	s.current = ((s.current+delta)%s.matches + s.matches) % s.matches
+	s.show()
+}
+
+func (s *conversationSearch) show() {
+	if s.matches == 0 {
+		s.view.Highlight()
+		return
+	}
+	s.view.Highlight(matchRegion(s.current))
+	s.view.ScrollToHighlight()
+}
+
+// Put the text back as it was before the search
+func (s *conversationSearch) clear() {
+	if !s.active() {
+		return
+	}
+	text := unmarkMatches(s.view.GetText(false))
+	s.view.Highlight()
+	// The view stays where the search left it
+	s.view.SetText(text)
+
+	s.query = ""
+	s.matches = 0
+}
+
+// e.g., "3/12" or "no match"
+func (s *conversationSearch) status() string {
+	switch {
+	case !s.active():
+		return ""
+	case s.matches == 0:
+		return "no match"
+	default:
+		return fmt.Sprintf("%d/%d", s.current+1, s.matches)
+	}
+}
+
+func matchRegion(i int) string {
+	return fmt.Sprintf("match-%d", i)
+}
+
+// Wrap each match of query in a region with the background color, looking only at the text between tags
+func markMatches(text, query, background string) (string, int) {
+	var b strings.Builder
+	count := 0
+	needle := strings.ToLower(query)
+
+	mark := func(segment string) {
+		// Lowercasing keeps offsets for all but a few runes, those are matched as typed
+		haystack := strings.ToLower(segment)
+		q := needle
+		if len(haystack) != len(segment) {
+			haystack, q = segment, query
+		}
+
+		for {
+			i := strings.Index(haystack, q)
+			if i < 0 {
+				b.WriteString(segment)
+				return
+			}
+			b.WriteString(segment[:i])
+			fmt.Fprintf(&b, `["%s"][:%s]%s[:-][""]`, matchRegion(count), background, segment[i:i+len(q)])
+			count++
+			segment, haystack = segment[i+len(q):], haystack[i+len(q):]
+		}
+	}
+
+	last := 0
+	for _, loc := range tagPattern.FindAllStringIndex(text, -1) {
+		mark(text[last:loc[0]])
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	mark(text[last:])
+
+	return b.String(), count
+}
+
+func unmarkMatches(text string) string {
+	return matchTagPattern.ReplaceAllString(text, "")
+}
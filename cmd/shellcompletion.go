@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/honganh1206/tinker/config"
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/spf13/cobra"
+)
+
+// Dynamic completions for the shell scripts of `tinker completion`.
+// Entries are "value\tdescription", which zsh and fish show next to the value
+
+// IDs of the conversations, most recently active first, described by their titles.
+// Nothing when the server is not up, a completion must not start it or print errors
+func completeConversationIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return conversationCompletions(data.ListFilter{}, toComplete)
+}
+
+func completeArchivedConversationIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return conversationCompletions(data.ListFilter{Archived: true}, toComplete)
+}
+
+func conversationCompletions(filter data.ListFilter, toComplete string) ([]string, cobra.ShellCompDirective) {
+	convs, err := api.NewClient(userConfig.Server).ListConversations(filter)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := make([]string, 0, len(convs))
+	for _, c := range convs {
+		if !strings.HasPrefix(c.ID, toComplete) {
+			continue
+		}
+		title := c.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		completions = append(completions, c.ID+"\t"+title)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+// Conversation ID as the first argument, what follows it is not completed
+func completeConversationArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeConversationIDs(cmd, args, toComplete)
+}
+
+// IDs of the plans, described by their progress
+func completePlanIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	plans, err := api.NewClient(userConfig.Server).ListPlans(data.ListFilter{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := make([]string, 0, len(plans))
+	for _, p := range plans {
+		if strings.HasPrefix(p.ID, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s %d/%d", p.ID, p.Status, p.CompletedTasks, p.TotalTasks))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completePlanArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completePlanIDs(cmd, args, toComplete)
+}
+
+// Models of the provider given with --provider, the one of the config otherwise
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var models []string
+	for _, m := range inference.ListAvailableModels(inference.ProviderName(llm.Provider)) {
+		models = append(models, string(m))
+	}
+	return models, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeProviders(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{inference.AnthropicProvider, inference.GoogleProvider}, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	path, err := config.UserPath()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := config.ReadFile(path)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return cfg.ProfileNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// Config key as the first argument of config get and set
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return config.Keys(), cobra.ShellCompDirectiveNoFileComp
+}
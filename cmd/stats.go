@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/telemetry"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/spf13/cobra"
+)
+
+func StatsHandler(cmd *cobra.Command, args []string) error {
+	rawSince, err := cmd.Flags().GetString("since")
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if rawSince != "" {
+		age, err := config.ParseAge(rawSince)
+		if err != nil {
+			return err
+		}
+		since = time.Now().Add(-age)
+	}
+
+	showTelemetry, err := cmd.Flags().GetBool("telemetry")
+	if err != nil {
+		return err
+	}
+	export, err := cmd.Flags().GetString("export")
+	if err != nil {
+		return err
+	}
+	if export != "" && !showTelemetry {
+		return errors.New("--export writes the telemetry records, use it with --telemetry")
+	}
+	if showTelemetry {
+		return telemetryStats(since, export)
+	}
+
+	project, err := cmd.Flags().GetString("project")
+	if err != nil {
+		return err
+	}
+	if project != "" {
+		project = utils.ProjectRoot(project)
+	}
+
+	stats, err := newAPIClient().Stats(since, project)
+	if err != nil {
+		return fmt.Errorf("error computing stats: %w", err)
+	}
+
+	period := "all time"
+	if !since.IsZero() {
+		period = "since " + since.Format("2006-01-02 15:04")
+	}
+	fmt.Printf("%d sessions and %d messages %s\n", stats.Sessions, stats.Messages, period)
+	if stats.Sessions == 0 {
+		return nil
+	}
+
+	var total float64
+	unpriced := 0
+	rows := make([][]string, 0, len(stats.Models))
+	for _, m := range stats.Models {
+		name, cost := m.Model, "unknown"
+		if name == "" {
+			name = "(not recorded)"
+		}
+		if m.Cost != nil {
+			total += *m.Cost
+			cost = fmt.Sprintf("$%.2f", *m.Cost)
+		} else {
+			unpriced++
+		}
+		latency := "-"
+		if m.AvgLatencyMs > 0 {
+			latency = (time.Duration(m.AvgLatencyMs) * time.Millisecond).Round(100 * time.Millisecond).String()
+		}
+		rows = append(rows, []string{name, strconv.Itoa(m.Replies), strconv.FormatInt(m.InputTokens, 10), strconv.FormatInt(m.OutputTokens, 10), strconv.FormatInt(m.CacheReadTokens, 10), latency, cost})
+	}
+	fmt.Println()
+	utils.RenderTable([]string{"Model", "Replies", "Input Tokens", "Output Tokens", "Cached Tokens", "Avg Latency", "Cost"}, rows)
+	if unpriced > 0 {
+		fmt.Printf("Total cost: $%.2f, not counting %d models of unknown price\n", total, unpriced)
+	} else {
+		fmt.Printf("Total cost: $%.2f\n", total)
+	}
+
+	if len(stats.Tools) > 0 {
+		fmt.Println()
+		rows = rows[:0]
+		for _, tool := range stats.Tools {
+			rows = append(rows, []string{tool.Name, strconv.Itoa(tool.Count)})
+		}
+		utils.RenderTable([]string{"Tool", "Calls"}, rows)
+	}
+
+	if len(stats.Files) > 0 {
+		fmt.Println()
+		rows = rows[:0]
+		for _, file := range stats.Files {
+			rows = append(rows, []string{file.Name, strconv.Itoa(file.Count)})
+		}
+		utils.RenderTable([]string{"Most Edited File", "Edits"}, rows)
+	}
+
+	return nil
+}
+
+// Summarize the local telemetry records, or write them as JSON to export, "-" for stdout
+func telemetryStats(since time.Time, export string) error {
+	path, err := telemetryPath()
+	if err != nil {
+		return err
+	}
+	events, err := telemetry.Read(path)
+	if err != nil {
+		return fmt.Errorf("error reading telemetry: %w", err)
+	}
+
+	if export != "" {
+		kept := make([]telemetry.Event, 0, len(events))
+		for _, e := range events {
+			if !e.Time.Before(since) {
+				kept = append(kept, e)
+			}
+		}
+		raw, err := json.MarshalIndent(kept, "", "  ")
+		if err != nil {
+			return err
+		}
+		raw = append(raw, '\n')
+		if export == "-" {
+			_, err = os.Stdout.Write(raw)
+			return err
+		}
+		if err := os.WriteFile(export, raw, 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d telemetry records to %s\n", len(kept), export)
+		return nil
+	}
+
+	if !userConfig.TelemetryEnabled() {
+		fmt.Println("Telemetry is off, turn it on with `tinker config set telemetry true`. Records stay in " + path)
+	}
+
+	features, errs := telemetry.Summarize(events, since)
+	if len(features) == 0 && len(errs) == 0 {
+		fmt.Println("No telemetry recorded")
+		return nil
+	}
+
+	if len(features) > 0 {
+		rows := make([][]string, 0, len(features))
+		for _, f := range features {
+			rows = append(rows, []string{f.Name, strconv.Itoa(f.Count)})
+		}
+		utils.RenderTable([]string{"Feature", "Uses"}, rows)
+	}
+	if len(errs) > 0 {
+		fmt.Println()
+		rows := make([][]string, 0, len(errs))
+		for _, e := range errs {
+			rows = append(rows, []string{e.Name, strconv.Itoa(e.Count)})
+		}
+		utils.RenderTable([]string{"Error", "Count"}, rows)
+	}
+
+	return nil
+}
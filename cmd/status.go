@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// What a row of the status panel stands for, only one of the two is set
+type statusRow struct {
+	server string
+	tool   string
+}
+
+// Overlay with the state of the MCP servers and of the tools offered to the model
+type statusPanel struct {
+	*tview.Table
+	rows []statusRow
+}
+
+func newStatusPanel(keys ui.Keymap, onRestart func(id string), onToggleTool func(name string), onClose func()) *statusPanel {
+	table := tview.NewTable().
+		SetSelectable(true, false)
+	table.SetBorder(true).
+		SetTitle(fmt.Sprintf(" Status  %s restart server · %s disable/enable tool ", keys.Describe(ui.ActionRestartServer), keys.Describe(ui.ActionToggleTool))).
+		SetTitleAlign(tview.AlignLeft)
+
+	p := &statusPanel{Table: table}
+
+	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		row, _ := table.GetSelection()
+		var selected statusRow
+		if row >= 0 && row < len(p.rows) {
+			selected = p.rows[row]
+		}
+
+		switch {
+		case keys.Matches(ui.ActionCancel, event):
+			onClose()
+			return nil
+		case selected.server != "" && keys.Matches(ui.ActionRestartServer, event):
+			onRestart(selected.server)
+			return nil
+		case selected.tool != "" && keys.Matches(ui.ActionToggleTool, event):
+			onToggleTool(selected.tool)
+			return nil
+		}
+		return event
+	})
+
+	return p
+}
+
+// Show the latest state, staying on the selected row
+func (p *statusPanel) set(servers []ui.MCPServerStatus, tools []agent.ToolStatus) {
+	theme := ui.CurrentTheme()
+	selected, _ := p.GetSelection()
+
+	p.Clear()
+	p.rows = nil
+
+	heading := func(title string) {
+		row := len(p.rows)
+		p.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("[%s::b]%s", theme.Text, title)).SetSelectable(false))
+		p.rows = append(p.rows, statusRow{})
+	}
+	add := func(r statusRow, cells ...string) {
+		row := len(p.rows)
+		for col, text := range cells {
+			p.SetCell(row, col, tview.NewTableCell(text).SetExpansion(col))
+		}
+		p.rows = append(p.rows, r)
+	}
+
+	heading("MCP servers")
+	if len(servers) == 0 {
+		p.SetCell(len(p.rows), 0, tview.NewTableCell(fmt.Sprintf("[%s::]None configured", theme.Muted)).SetSelectable(false))
+		p.rows = append(p.rows, statusRow{})
+	}
+	for _, s := range servers {
+		color := theme.Success
+		switch s.State {
+		case ui.MCPFailed:
+			color = theme.Error
+		case ui.MCPStarting, ui.MCPRestarting:
+			color = theme.Warning
+		}
+
+		detail := fmt.Sprintf("%d tools", s.Tools)
+		if s.Latency > 0 && s.State == ui.MCPRunning {
+			detail += fmt.Sprintf(" · %dms", s.Latency.Milliseconds())
+		}
+		if s.Err != "" {
+			detail += fmt.Sprintf(" · [%s::]%s", theme.Error, tview.Escape(s.Err))
+		}
+
+		add(statusRow{server: s.ID},
+			fmt.Sprintf(" [%s::]●[-::] %s", color, tview.Escape(s.ID)),
+			fmt.Sprintf("[%s::]%s", color, s.State),
+			fmt.Sprintf("[%s::]%s", theme.Muted, detail))
+	}
+
+	heading("")
+	heading("Tools")
+	for _, t := range tools {
+		state, color := "enabled", theme.Success
+		if t.Disabled {
+			state, color = "disabled", theme.Muted
+		}
+		source := "local"
+		if t.Server != "" {
+			source = "MCP " + t.Server
+		}
+
+		add(statusRow{tool: t.Name},
+			" "+tview.Escape(t.Name),
+			fmt.Sprintf("[%s::]%s", color, state),
+			fmt.Sprintf("[%s::]%s", theme.Muted, tview.Escape(source)))
+	}
+
+	if selected <= 0 || selected >= len(p.rows) || p.rows[selected] == (statusRow{}) {
+		selected = p.firstSelectable()
+	}
+	p.Select(selected, 0)
+}
+
+func (p *statusPanel) firstSelectable() int {
+	for i, r := range p.rows {
+		if r != (statusRow{}) {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+)
+
+const (
+	// Piped input read at most, the rest is dropped
+	maxStdinSize = 8 << 20
+	// Piped input sent as is up to this size, larger input is summarized first
+	maxStdinVerbatim = 256 << 10
+	// Size of the pieces summarized one at a time
+	stdinChunkSize = 128 << 10
+)
+
+// Name piped input is attached under, like a file mentioned with @
+const stdinName = "stdin"
+
+const stdinSummaryPrompt = `Summarize the following part of a larger input for a coding agent that will not see the original.
+Keep file names, identifiers, error messages and numbers exactly as written, and leave out nothing the agent may need to act on.
+Answer with the summary only.`
+
+// Input piped into the process, empty when stdin is a terminal.
+// truncated is set when there was more than maxStdinSize
+func readPipedStdin() (content string, truncated bool, err error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return "", false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinSize+1))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read stdin: %w", err)
+	}
+	if len(body) > maxStdinSize {
+		return string(body[:maxStdinSize]), true, nil
+	}
+	return string(body), false, nil
+}
+
+// Piped input as a block going with the prompt, summarized by the subagent's model when it is too large to send
+func stdinAttachment(ctx context.Context, sub inference.BaseLLMClient, content string, truncated bool) (message.ContentBlock, error) {
+	if truncated {
+		fmt.Fprintf(os.Stderr, "%sOnly the first %d MB of stdin is used%s\n", colorYellow, maxStdinSize>>20, colorReset)
+		content += "\n[input truncated]"
+	}
+	if len(content) <= maxStdinVerbatim {
+		return message.NewFileBlock(stdinName, content), nil
+	}
+
+	chunks := splitChunks(content, stdinChunkSize)
+	fmt.Fprintf(os.Stderr, "%sSummarizing %d KB of stdin in %d parts%s\n", colorGray, len(content)>>10, len(chunks), colorReset)
+
+	summaries := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		summary, err := summarizeChunk(ctx, sub, chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize part %d of stdin: %w", i+1, err)
+		}
+		summaries = append(summaries, fmt.Sprintf("Part %d of %d:\n%s", i+1, len(chunks), summary))
+	}
+
+	return message.NewFileBlock(stdinName+" (summarized)", strings.Join(summaries, "\n\n")), nil
+}
+
+// Summarize with a client of its own, so the parts do not pile up in one history
+func summarizeChunk(ctx context.Context, cfg inference.BaseLLMClient, chunk string) (string, error) {
+	return complete(ctx, cfg, stdinSummaryPrompt+"\n\n"+chunk)
+}
+
+// Text of the answer to a single prompt, without tools or a conversation
+func complete(ctx context.Context, cfg inference.BaseLLMClient, prompt string) (string, error) {
+	llm, err := inference.Init(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	req := &message.Message{
+		Role:    message.UserRole,
+		Content: []message.ContentBlock{message.NewTextBlock(prompt)},
+	}
+	if err := llm.ToNativeMessage(req); err != nil {
+		return "", err
+	}
+
+	resp, err := llm.RunInference(ctx, nil, false)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, block := range resp.Content {
+		if b, ok := block.(message.TextBlock); ok {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n")), nil
+}
+
+// Cut text into pieces of at most size bytes, at line ends where there is one
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	for len(text) > size {
+		cut := strings.LastIndexByte(text[:size], '\n') + 1
+		if cut == 0 {
+			// One long line, keep its runes whole
+			cut = size
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
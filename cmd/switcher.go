@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+const (
+	// Shortest query also looked for in the messages
+	minContentQuery = 3
+	// Conversations matching by content at most
+	contentSearchLimit = 50
+)
+
+// Overlay listing past conversations, narrowed down by a fuzzy search as the user types.
+// Conversations whose messages contain the words typed come after the fuzzy matches.
+// Lists the conversations of the current project, Tab toggles every project
+type conversationSwitcher struct {
+	*tview.Flex
+	search *tview.InputField
+	table  *tview.Table
+	status *tview.TextView
+
+	app         *tview.Application
+	client      *api.Client
+	currentID   string
+	project     string
+	allProjects bool
+	convs       []data.ConversationMetadata
+	loadErr     error
+	shown       []data.ConversationMetadata
+
+	// Snippets of the conversations matching the search query by content, by ID
+	snippets map[string]string
+	searched string
+	// Bumped for every query, so an answer to an earlier one is dropped
+	searchSeq int
+
+	keys     ui.Keymap
+	onSelect func(id string)
+	onCancel func()
+}
+
+func newConversationSwitcher(app *tview.Application, client *api.Client, currentID, project string, keys ui.Keymap, onSelect func(id string), onCancel func()) *conversationSwitcher {
+	s := &conversationSwitcher{
+		search:    tview.NewInputField().SetLabel("> ").SetFieldBackgroundColor(tcell.ColorDefault),
+		table:     tview.NewTable().SetSelectable(true, false),
+		status:    tview.NewTextView().SetDynamicColors(true),
+		app:       app,
+		client:    client,
+		currentID: currentID,
+		project:   project,
+		// Outside a git repository every conversation is a candidate
+		allProjects: project == "",
+		keys:        keys,
+		onSelect:    onSelect,
+		onCancel:    onCancel,
+	}
+
+	s.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(s.search, 1, 0, true).
+		AddItem(s.table, 0, 1, false).
+		AddItem(s.status, 1, 0, false)
+	s.Flex.SetBorder(true).SetTitleAlign(tview.AlignLeft)
+
+	s.search.SetChangedFunc(func(string) {
+		s.filter()
+		s.searchContent()
+	})
+	s.search.SetInputCapture(s.handleKey)
+	s.table.SetSelectedFunc(func(row, _ int) { s.choose(row) })
+
+	s.load()
+	return s
+}
+
+func (s *conversationSwitcher) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	row, _ := s.table.GetSelection()
+
+	if s.keys.Matches(ui.ActionCancel, event) {
+		s.onCancel()
+		return nil
+	}
+
+	switch event.Key() {
+	case tcell.KeyEnter:
+		s.choose(row)
+	case tcell.KeyDown, tcell.KeyCtrlN:
+		if row+1 < s.table.GetRowCount() {
+			s.table.Select(row+1, 0)
+		}
+	case tcell.KeyUp, tcell.KeyCtrlP:
+		if row > 0 {
+			s.table.Select(row-1, 0)
+		}
+	case tcell.KeyTab:
+		if s.project != "" {
+			s.allProjects = !s.allProjects
+			s.load()
+		}
+	default:
+		return event
+	}
+
+	return nil
+}
+
+func (s *conversationSwitcher) load() {
+	filter := data.ListFilter{}
+	title := " Resume a conversation (all projects) "
+	if !s.allProjects {
+		filter.Project = s.project
+		title = fmt.Sprintf(" Resume a conversation in %s (Tab for all projects) ", filepath.Base(s.project))
+	}
+	s.Flex.SetTitle(title)
+
+	s.convs, s.loadErr = s.client.ListConversations(filter)
+
+	// Most recently active first
+	sort.SliceStable(s.convs, func(i, j int) bool {
+		return lastActive(s.convs[i]).After(lastActive(s.convs[j]))
+	})
+
+	s.filter()
+}
+
+func (s *conversationSwitcher) filter() {
+	query := strings.TrimSpace(s.search.GetText())
+
+	type match struct {
+		conv  data.ConversationMetadata
+		score int
+	}
+	var matches []match
+	for _, conv := range s.convs {
+		if query == "" {
+			matches = append(matches, match{conv: conv})
+			continue
+		}
+
+		best, found := 0, false
+		for _, field := range []string{conv.Title, filepath.Base(conv.Project), conv.ID} {
+			if score, ok := fuzzyScore(query, field); ok && (!found || score > best) {
+				best, found = score, true
+			}
+		}
+		if found {
+			matches = append(matches, match{conv: conv, score: best})
+		} else if _, ok := s.contentSnippet(conv.ID); ok {
+			matches = append(matches, match{conv: conv, score: -1})
+		}
+	}
+
+	// Ties keep their recency order
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	s.shown = s.shown[:0]
+	for _, m := range matches {
+		s.shown = append(s.shown, m.conv)
+	}
+
+	s.render()
+}
+
+// Look for the query in the messages in the background, the list is filtered again with the results
+func (s *conversationSwitcher) searchContent() {
+	query := strings.TrimSpace(s.search.GetText())
+	s.searchSeq++
+	// Shorter words match about everything
+	if len([]rune(query)) < minContentQuery {
+		s.snippets, s.searched = nil, ""
+		return
+	}
+
+	seq := s.searchSeq
+	go func() {
+		// The fuzzy matches are still there when the search fails
+		results, err := s.client.SearchConversations(query, contentSearchLimit)
+		if err != nil {
+			return
+		}
+		s.app.QueueUpdateDraw(func() {
+			if seq != s.searchSeq {
+				return
+			}
+			s.snippets = make(map[string]string, len(results))
+			for _, r := range results {
+				s.snippets[r.ConversationID] = r.Snippet
+			}
+			s.searched = query
+			s.filter()
+		})
+	}()
+}
+
+// Snippet of the message of conversation id matching the current query
+func (s *conversationSwitcher) contentSnippet(id string) (string, bool) {
+	if s.searched == "" || s.searched != strings.TrimSpace(s.search.GetText()) {
+		return "", false
+	}
+	snippet, ok := s.snippets[id]
+	return snippet, ok
+}
+
+func (s *conversationSwitcher) render() {
+	s.table.Clear()
+	theme := ui.CurrentTheme()
+
+	now := time.Now()
+	for row, conv := range s.shown {
+		title := conv.Title
+		if title == "" {
+			title = "[" + theme.Muted + "::]untitled " + conv.ID[:min(8, len(conv.ID))] + "[-::]"
+		}
+		if conv.ID == s.currentID {
+			title = "[" + theme.Success + "::]●[-::] " + title
+		}
+		if snippet, ok := s.contentSnippet(conv.ID); ok {
+			title += " [" + theme.Muted + "::]" + tview.Escape(snippet) + "[-::]"
+		}
+
+		s.table.SetCell(row, 0, tview.NewTableCell(title).SetExpansion(1))
+		s.table.SetCell(row, 1, tview.NewTableCell(formatAge(now, lastActive(conv))).SetTextColor(tcell.GetColor(theme.Muted)).SetAlign(tview.AlignRight))
+		s.table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%d msgs", conv.MessageCount)).SetTextColor(tcell.GetColor(theme.Muted)).SetAlign(tview.AlignRight))
+		if s.allProjects && conv.Project != "" {
+			s.table.SetCell(row, 3, tview.NewTableCell(filepath.Base(conv.Project)).SetTextColor(tcell.GetColor(theme.Detail)))
+		}
+	}
+
+	if len(s.shown) > 0 {
+		s.table.Select(0, 0)
+		s.table.ScrollToBeginning()
+	}
+
+	switch {
+	case s.loadErr != nil:
+		s.status.SetText(fmt.Sprintf("[%s::]Failed to list conversations: %v[-::]", theme.Error, s.loadErr))
+	case len(s.convs) == 0:
+		s.status.SetText("[" + theme.Muted + "::]No conversations yet[-::]")
+	case len(s.shown) == 0:
+		s.status.SetText("[" + theme.Muted + "::]No conversation matches[-::]")
+	default:
+		s.status.SetText("[" + theme.Muted + "::]Enter to resume, Esc to close[-::]")
+	}
+}
+
+func (s *conversationSwitcher) choose(row int) {
+	if row < 0 || row >= len(s.shown) {
+		return
+	}
+	s.onSelect(s.shown[row].ID)
+}
+
+func lastActive(conv data.ConversationMetadata) time.Time {
+	if conv.LatestMessageTime.After(conv.CreatedAt) {
+		return conv.LatestMessageTime
+	}
+	return conv.CreatedAt
+}
+
+// Compact age of t, e.g., "5m ago", falling back to the date after a week
+func formatAge(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 7*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	default:
+		return t.Local().Format("Jan 2, 2006")
+	}
+}
+
+// Score how well pattern matches text as a case-insensitive subsequence, false when it does not.
+// Consecutive runes and runes starting a word score higher, so "tui" ranks "TUI panel" above "tool output ui"
+func fuzzyScore(pattern, text string) (int, bool) {
+	want := []rune(strings.ToLower(pattern))
+	if len(want) == 0 {
+		return 0, true
+	}
+
+	score, i := 0, 0
+	prevMatched := false
+	prev := ' '
+	for _, r := range strings.ToLower(text) {
+		if i < len(want) && r == want[i] {
+			score++
+			if prevMatched {
+				score += 3
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 2
+			}
+			i++
+			prevMatched = true
+		} else {
+			prevMatched = false
+		}
+		prev = r
+	}
+
+	return score, i == len(want)
+}
+
+// Center p in a box of the given size over whatever is behind it
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/telemetry"
+	"github.com/honganh1206/tinker/tinkererr"
+	"github.com/honganh1206/tinker/tools"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/spf13/cobra"
+)
+
+// Records usage for this process, nil unless the user turned telemetry on
+var recorder *telemetry.Recorder
+
+// Tools recorded by name, the others come from MCP servers and are all counted as "tool mcp"
+var builtinTools = []string{
+	tools.ToolNameBash, tools.ToolNameReadFile, tools.ToolNameEditFile, tools.ToolNameGrepSearch,
+	tools.ToolNameListFiles, tools.ToolNamePlanRead, tools.ToolNamePlanWrite, tools.ToolNameFinder,
+}
+
+func telemetryPath() (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, telemetry.FileName), nil
+}
+
+// Start recording once the config is loaded, counting cmd as the first use
+func setupTelemetry(cmd *cobra.Command) {
+	if !userConfig.TelemetryEnabled() {
+		return
+	}
+	path, err := telemetryPath()
+	if err != nil {
+		return
+	}
+	recorder = telemetry.Open(path)
+
+	// e.g., "tinker conversation list" is counted as "command conversation list"
+	name := strings.TrimSpace(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()))
+	if name == "" {
+		name = "chat"
+	}
+	recorder.Feature("command " + name)
+}
+
+// Count the tools the agent calls and those that fail before handing e to next
+func recordEvents(next func(agent.Event)) func(agent.Event) {
+	return func(e agent.Event) {
+		switch {
+		case e.Type == agent.EventToolCall && slices.Contains(builtinTools, e.Tool):
+			recorder.Feature("tool " + e.Tool)
+		case e.Type == agent.EventToolCall:
+			recorder.Feature("tool mcp")
+		case e.Type == agent.EventToolResult && e.IsError:
+			recorder.Error(tinkererr.ToolFailed)
+		}
+		if next != nil {
+			next(e)
+		}
+	}
+}
+
+// Count the kind of error a run failed with, a run the user cancelled did not fail
+func recordRunError(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	recorder.Error(err)
+}
+
+// Count a slash command, the prompts of MCP servers all as "/mcp-prompt"
+func recordCommand(name string) {
+	if strings.Contains(name, ":") {
+		name = "mcp-prompt"
+	}
+	recorder.Feature("/" + name)
+}
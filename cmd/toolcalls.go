@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+const toolRegionPrefix = "tool-"
+
+// Tool call shown in the conversation as a summary line, expandable to its input and output
+type toolCall struct {
+	name    string
+	input   json.RawMessage
+	output  string
+	isError bool
+	// Unknown for calls loaded from the history
+	duration time.Duration
+	expanded bool
+}
+
+// Tool calls of the conversation view, numbered by their region.
+// Calls are added from the agent's goroutine while the UI reads them
+type toolCalls struct {
+	mu    sync.Mutex
+	calls []*toolCall
+}
+
+// Record the call, returning its summary line wrapped in a region so it can be selected
+func (t *toolCalls) add(c *toolCall) string {
+	t.mu.Lock()
+	n := len(t.calls)
+	t.calls = append(t.calls, c)
+	t.mu.Unlock()
+
+	summary := strings.TrimRight(agent.FormatToolResultMessage(c.name, c.input, c.isError, c.duration), "\n")
+	return fmt.Sprintf(`["%s"]%s[""]`+"\n\n", toolRegion(n), summary)
+}
+
+func (t *toolCalls) get(n int) (*toolCall, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n < 0 || n >= len(t.calls) {
+		return nil, false
+	}
+	return t.calls[n], true
+}
+
+func (t *toolCalls) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.calls)
+}
+
+// Forget the calls, when the view is cleared for another conversation
+func (t *toolCalls) reset() {
+	t.mu.Lock()
+	t.calls = nil
+	t.mu.Unlock()
+}
+
+// Agent event hook writing each tool result to the view as it comes
+func writeToolCalls(view *tview.TextView, calls *toolCalls) func(agent.Event) {
+	return func(e agent.Event) {
+		if e.Type != agent.EventToolResult {
+			return
+		}
+		fmt.Fprint(view, calls.add(&toolCall{
+			name:     e.Tool,
+			input:    e.Input,
+			output:   e.Output,
+			isError:  e.IsError,
+			duration: time.Duration(e.DurationMs) * time.Millisecond,
+		}))
+	}
+}
+
+func toolRegion(n int) string {
+	return toolRegionPrefix + strconv.Itoa(n)
+}
+
+func toolDetailsRegion(n int) string {
+	return toolRegion(n) + "-details"
+}
+
+// Number of the tool call whose summary is highlighted, false when none is
+func selectedToolCall(view *tview.TextView) (int, bool) {
+	for _, id := range view.GetHighlights() {
+		n, err := strconv.Atoi(strings.TrimPrefix(id, toolRegionPrefix))
+		if strings.HasPrefix(id, toolRegionPrefix) && err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Show or hide the input and output of call n under its summary line
+func (t *toolCalls) toggle(view *tview.TextView, n int) {
+	c, ok := t.get(n)
+	if !ok {
+		return
+	}
+
+	text := view.GetText(false)
+	start := strings.Index(text, fmt.Sprintf(`["%s"]`, toolRegion(n)))
+	if start < 0 {
+		return
+	}
+	end := strings.Index(text[start:], `[""]`)
+	if end < 0 {
+		return
+	}
+	summaryEnd := start + end + len(`[""]`)
+
+	if c.expanded {
+		details := fmt.Sprintf(`["%s"]`, toolDetailsRegion(n))
+		if !strings.HasPrefix(text[summaryEnd:], details) {
+			return
+		}
+		detailsEnd := strings.Index(text[summaryEnd+len(details):], `[""]`)
+		if detailsEnd < 0 {
+			return
+		}
+		text = text[:summaryEnd] + text[summaryEnd+len(details)+detailsEnd+len(`[""]`):]
+	} else {
+		text = text[:summaryEnd] + formatToolDetails(n, c) + text[summaryEnd:]
+	}
+	c.expanded = !c.expanded
+
+	view.SetText(text)
+	view.Highlight(toolRegion(n))
+	view.ScrollToHighlight()
+}
+
+// Input and output of a call, escaped so neither can end the region early
+func formatToolDetails(n int, c *toolCall) string {
+	muted := ui.CurrentTheme().Muted
+
+	input := string(c.input)
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, c.input, "  ", "  "); err == nil {
+		input = indented.String()
+	}
+
+	output := strings.TrimRight(c.output, "\n")
+	if output == "" {
+		output = "(no output)"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `["%s"]`, toolDetailsRegion(n))
+	fmt.Fprintf(&b, "\n[%s::]Input[-::]\n  %s\n", muted, tview.Escape(input))
+	fmt.Fprintf(&b, "[%s::]Output[-::]\n%s", muted, tview.Escape(indent(output, "  ")))
+	b.WriteString(`[""]`)
+	return b.String()
+}
+
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
@@ -4,92 +4,160 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/inference"
 	"github.com/honganh1206/tinker/message"
 	"github.com/honganh1206/tinker/server/data"
 	"github.com/honganh1206/tinker/ui"
+	"github.com/honganh1206/tinker/utils"
 	"github.com/rivo/tview"
 )
 
 //go:embed logo.txt
 var logo string
 
-func tui(ctx context.Context, agent *agent.Agent, ctl *ui.Controller) error {
+// Keys closer together than this were typed out by the terminal, not by hand
+const pasteKeyGap = 10 * time.Millisecond
+
+func tui(ctx context.Context, agent *agent.Agent, ctl *ui.Controller, llmCfg inference.BaseLLMClient) error {
+	// Done on SIGINT or SIGTERM, the terminal sends no SIGINT for Ctrl+C while the TUI is open
+	signaled := ctx.Done()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	app := tview.NewApplication()
+	keys, err := ui.LoadKeymap()
+	if err != nil {
+		return err
+	}
+
+	settings, err := ui.LoadSettings()
+	if err != nil {
+		return err
+	}
+	settings.Approve = append(settings.Approve, userConfig.Approve...)
+	history := ui.NewInputHistory()
+	if settings.History == ui.HistoryGlobal {
+		path, err := ui.InputHistoryPath()
+		if err != nil {
+			return err
+		}
+		if history, err = ui.LoadInputHistory(path); err != nil {
+			return err
+		}
+	}
+
+	// Before any primitive is created, so they pick up its defaults
+	theme, err := ui.LoadThemeNamed(userConfig.Theme)
+	if err != nil {
+		return err
+	}
+	ui.SetTheme(theme)
+
+	screen, err := newFocusScreen()
+	if err != nil {
+		return err
+	}
+	app := tview.NewApplication().SetScreen(screen)
 
 	conversationView := tview.NewTextView().
 		SetDynamicColors(true).
+		SetRegions(true).
 		SetWordWrap(true).
 		SetChangedFunc(func() {
 			app.Draw()
 		}).ScrollToEnd()
 
+	// Tool calls are written as collapsed summaries rather than the agent's formatted deltas
+	calls := &toolCalls{}
+
 	isFirstInput := len(agent.Conv.Messages) == 0
 	if isFirstInput {
 		conversationView.SetTextAlign(tview.AlignLeft)
 		fmt.Fprintf(conversationView, "%s\n", formatWelcomeMessage())
 	} else {
-		displayConversationHistory(conversationView, agent.Conv)
+		displayConversationHistory(conversationView, agent.Conv, calls)
 	}
 	relPath := displayRelativePath()
 
 	questionInput := tview.NewTextArea()
-	model := fmt.Sprintf("[yellow] Model: %s ", agent.LLM.ModelName())
-	questionInput.SetTitle(model).
-		SetTitleAlign(tview.AlignLeft).
+	// Only touched from the UI goroutine, like the agent's model between runs
+	mcpStatus := formatMCPStatus(agent.MCPStatus())
+	// Pasted images waiting to go with the next message
+	var pendingImages []message.ContentBlock
+	// Nil until the first inference call
+	var usage *ui.UsageStatus
+	// A run of the agent is in progress, the input stays open to queue messages for it
+	busy := false
+	// Exiting once the run in progress is saved
+	quitting := false
+	statusBar := tview.NewTextView().
+		SetDynamicColors(true)
+	updateStatus := func() {
+		questionInput.SetTitle(formatImageStatus(len(pendingImages)))
+		statusBar.SetText(formatModelStatus(agent.LLM) + formatContextStatus(agent.LLM.ModelName(), usage) + formatCostStatus(usage) + mcpStatus)
+	}
+	updateStatus()
+	questionInput.SetTitleAlign(tview.AlignLeft).
 		SetBorder(true).
 		SetDrawFunc(renderRelativePath(relPath))
 	questionInput.SetFocusFunc(func() {
-		questionInput.SetBorderColor(tcell.ColorGreen)
+		questionInput.SetBorderColor(tcell.GetColor(theme.FocusBorder))
 	})
 	questionInput.SetBlurFunc(func() {
-		questionInput.SetBorderColor(tcell.ColorWhite)
+		questionInput.SetBorderColor(tcell.GetColor(theme.Border))
 	})
 
 	spinnerView := tview.NewTextView().
 		SetDynamicColors(true).
+		SetTextColor(tcell.GetColor(theme.Spinner)).
 		SetText("")
 
-	planView := tview.NewTextView().
-		SetDynamicColors(true)
-	planView.SetBorder(true)
+	planView := newPlanPanel()
+	// Hidden by the user, shown again only when they ask
+	planHidden := false
 
 	inputFlex := tview.NewFlex()
 
+	completion := newCompletionPopup()
+
+	banner := newErrorBanner(keys)
+
+	queued := newQueuedMessages()
+
+	search := newConversationSearch(conversationView)
+	searchField := tview.NewInputField().
+		SetLabel("/").
+		SetFieldBackgroundColor(tcell.ColorDefault)
+
 	inputHeight := 5
 	mainLayout := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(conversationView, 0, 1, false).
+		AddItem(searchField, 0, 0, false).
+		AddItem(completion, 0, 0, false).
+		AddItem(banner, 0, 0, false).
 		AddItem(inputFlex, inputHeight, 0, true).
-		AddItem(spinnerView, 1, 0, false)
-
-	conversationView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyEnter:
-			app.SetFocus(questionInput)
-		}
-		return event
-	})
+		AddItem(queued, 0, 0, false).
+		AddItem(spinnerView, 1, 0, false).
+		AddItem(statusBar, 1, 0, false)
 
 	// TODO: This should be in a separate function
 	renderPlan := func(s *ui.State) {
 		inputFlex.Clear()
 		plan := s.Plan
-		if plan == nil || len(plan.Steps) == 0 {
+		planView.set(plan)
+		if plan == nil || len(plan.Steps) == 0 || planHidden {
 			inputFlex.AddItem(questionInput, 0, 1, true)
 			mainLayout.ResizeItem(inputFlex, 5, 0)
 		} else {
-			planView.SetText(formatPlanSteps(plan))
 			inputFlex.
 				AddItem(questionInput, 0, 1, true).
 				AddItem(planView, 0, 1, false)
@@ -102,67 +170,944 @@ func tui(ctx context.Context, agent *agent.Agent, ctl *ui.Controller) error {
 	initialState := &ui.State{Plan: agent.Plan}
 	renderPlan(initialState)
 
+	// Spinner of the in-flight request, so tool progress can be shown on it
+	var activeSpinner atomic.Pointer[ui.Spinner]
+	agent.OnEvent = recordEvents(trackToolPhase(agent, &activeSpinner, writeQueuedSent(conversationView, &activeSpinner, func() {
+		app.QueueUpdateDraw(func() {
+			mainLayout.ResizeItem(queued, queued.pop(), 0)
+		})
+	}, writeCitations(conversationView, writeToolCalls(conversationView, calls)))))
+
+	// Set up once the views the commands act on exist
+	var env *commandEnv
+	// Open /status overlay, nil when closed
+	var statusView *statusPanel
+
 	go func() {
 		updateCh := ctl.Subscribe()
 
 		for s := range updateCh {
-			renderPlan(s)
+			switch {
+			case s.MCPServers != nil:
+				status := formatMCPStatus(s.MCPServers)
+				app.QueueUpdateDraw(func() {
+					mcpStatus = status
+					updateStatus()
+					registerMCPPromptCommands(env)
+					if statusView != nil {
+						statusView.set(s.MCPServers, agent.ToolStatus())
+					}
+				})
+			case s.Usage != nil:
+				app.QueueUpdateDraw(func() {
+					usage = s.Usage
+					updateStatus()
+				})
+			case s.ToolProgress != "":
+				if spinner := activeSpinner.Load(); spinner != nil {
+					spinner.SetMessage(s.ToolProgress)
+				}
+			default:
+				app.QueueUpdateDraw(func() {
+					renderPlan(s)
+				})
+			}
 		}
 	}()
 
+	pages := tview.NewPages().AddPage("main", mainLayout, true, true)
+
+	// Take the marks out of the conversation before it is written to again
+	// Errors show above the input rather than in the transcript
+	showError := func(err error, retryable bool) {
+		mainLayout.ResizeItem(banner, banner.show(err, retryable), 0)
+	}
+	dismissError := func() {
+		mainLayout.ResizeItem(banner, banner.dismiss(), 0)
+	}
+
+	closeSearch := func() {
+		if search.active() {
+			// Match count
+			spinnerView.SetText("")
+		}
+		search.clear()
+		searchField.SetText("")
+		mainLayout.ResizeItem(searchField, 0, 0)
+	}
+
+	// Replace what is on screen with another conversation, keeping the process and its MCP servers
+	switchConversation := func(id string) error {
+		closeSearch()
+		// A conversation without a plan is fine
+		conv, plan, err := agent.Client.GetConversationWithPlan(id)
+		if err != nil {
+			return err
+		}
+
+		agent.SwitchConversation(conv, plan)
+		dismissError()
+		// The context of the previous conversation no longer applies, the cost does
+		if usage != nil {
+			usage = &ui.UsageStatus{SessionCost: usage.SessionCost}
+			updateStatus()
+		}
+
+		conversationView.Clear()
+		calls.reset()
+		isFirstInput = len(conv.Messages) == 0
+		if isFirstInput {
+			fmt.Fprintf(conversationView, "%s\n", formatWelcomeMessage())
+		} else {
+			displayConversationHistory(conversationView, conv, calls)
+		}
+		renderPlan(&ui.State{Plan: plan})
+
+		return nil
+	}
+
+	openSwitcher := func() {
+		// The agent is busy with the current conversation until its run ends
+		if busy || pages.HasPage("switcher") {
+			return
+		}
+
+		closeSwitcher := func() {
+			pages.RemovePage("switcher")
+			app.SetFocus(questionInput)
+		}
+
+		var switcher *conversationSwitcher
+		switcher = newConversationSwitcher(app, agent.Client, agent.Conv.ID, utils.CurrentProject(), keys, func(id string) {
+			if id != agent.Conv.ID {
+				if err := switchConversation(id); err != nil {
+					switcher.status.SetText(fmt.Sprintf("[%s::]Failed to load conversation: %v[-::]", ui.CurrentTheme().Error, err))
+					return
+				}
+			}
+			closeSwitcher()
+		}, closeSwitcher)
+
+		pages.AddPage("switcher", centered(switcher, 100, 20), true, true)
+		app.SetFocus(switcher)
+	}
+
+	// With no name, pick one from a list
+	changeModel := func(name string) {
+		if busy || pages.HasPage("models") {
+			return
+		}
+
+		apply := func(name string) {
+			if err := switchModel(ctx, agent, &llmCfg, name); err != nil {
+				fmt.Fprintf(conversationView, "[%s::]Failed to switch to %s: %v[-]\n\n", ui.CurrentTheme().Error, name, err)
+				return
+			}
+			updateStatus()
+			fmt.Fprintf(conversationView, "[%s::]Switched to %s[-]\n\n", ui.CurrentTheme().Muted, name)
+		}
+
+		if name != "" {
+			apply(name)
+			return
+		}
+
+		closePicker := func() {
+			pages.RemovePage("models")
+			app.SetFocus(questionInput)
+		}
+		picker := newModelPicker(agent.LLM.ModelName(), keys, func(name string) {
+			closePicker()
+			if name != agent.LLM.ModelName() {
+				apply(name)
+			}
+		}, closePicker)
+
+		pages.AddPage("models", centered(picker, 50, 20), true, true)
+		app.SetFocus(picker)
+	}
+
+	// Short-lived note on the spinner line, which is free between runs
+	showStatus := func(text string) {
+		spinnerView.SetText(text)
+		time.AfterFunc(3*time.Second, func() {
+			app.QueueUpdateDraw(func() {
+				if spinnerView.GetText(false) == text && !busy {
+					spinnerView.SetText("")
+				}
+			})
+		})
+	}
+
+	copyText := func(what, text string) {
+		if err := ui.CopyToClipboard(text); err != nil {
+			showStatus(fmt.Sprintf("[%s::]Failed to copy: %s[-]", ui.CurrentTheme().Error, tview.Escape(err.Error())))
+			return
+		}
+		showStatus(fmt.Sprintf("[%s::]Copied %s (%d lines)[-]", ui.CurrentTheme().Muted, what, strings.Count(text, "\n")+1))
+	}
+
+	// Copy the last response, or one of its code blocks
+	copyResponse := func(pickCode bool) {
+		// The conversation is being written to until the run ends
+		if busy {
+			showStatus("[" + ui.CurrentTheme().Warning + "::]Wait for the response to finish[-]")
+			return
+		}
+
+		text := lastResponse(agent.Conv)
+		if text == "" {
+			showStatus("[" + ui.CurrentTheme().Warning + "::]Nothing to copy yet[-]")
+			return
+		}
+		if !pickCode {
+			copyText("the last response", text)
+			return
+		}
+
+		blocks := codeBlocks(text)
+		switch len(blocks) {
+		case 0:
+			showStatus("[" + ui.CurrentTheme().Warning + "::]No code block in the last response[-]")
+			return
+		case 1:
+			copyText("the code block", blocks[0].code)
+			return
+		}
+
+		focused := app.GetFocus()
+		closePicker := func() {
+			pages.RemovePage("codeblocks")
+			app.SetFocus(focused)
+		}
+		picker := newCodeBlockPicker(blocks, keys, func(b codeBlock) {
+			closePicker()
+			copyText("the code block", b.code)
+		}, closePicker)
+
+		pages.AddPage("codeblocks", centered(picker, 80, 20), true, true)
+		app.SetFocus(picker)
+	}
+
+	showSearchStatus := func() {
+		spinnerView.SetText(fmt.Sprintf("[%s::]%s[-]", ui.CurrentTheme().Muted, search.status()))
+	}
+
+	// Search while typing, Enter goes back to the conversation to move between the matches
+	openSearch := func() {
+		// The conversation is being written to until the run ends
+		if busy {
+			showStatus("[" + ui.CurrentTheme().Warning + "::]Wait for the response to finish[-]")
+			return
+		}
+		mainLayout.ResizeItem(searchField, 1, 0)
+		app.SetFocus(searchField)
+	}
+
+	searchField.SetChangedFunc(func(text string) {
+		search.find(text)
+		showSearchStatus()
+	})
+	searchField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case keys.Matches(ui.ActionSubmit, event):
+			if search.matches > 0 {
+				app.SetFocus(conversationView)
+			}
+			return nil
+		case keys.Matches(ui.ActionCancel, event):
+			closeSearch()
+			app.SetFocus(conversationView)
+			return nil
+		}
+		return event
+	})
+
+	togglePlan := func() {
+		planHidden = !planHidden
+		if planHidden && planView.HasFocus() {
+			app.SetFocus(questionInput)
+		}
+		renderPlan(&ui.State{Plan: planView.plan})
+		if planHidden {
+			showStatus(fmt.Sprintf("[%s::]Plan hidden, %s shows it again[-]", ui.CurrentTheme().Muted, keys.Describe(ui.ActionTogglePlan)))
+		}
+	}
+
+	focusPlan := func() {
+		if !planHidden && planView.GetItemCount() > 0 {
+			app.SetFocus(planView)
+		}
+	}
+
+	// Flip the selected step between DONE and TODO, saved as the user's change
+	toggleStep := func() {
+		// The agent may be saving the plan too
+		if busy {
+			showStatus("[" + ui.CurrentTheme().Warning + "::]Wait for the response to finish[-]")
+			return
+		}
+		step, ok := planView.selected()
+		if !ok {
+			return
+		}
+		plan := planView.plan
+		convID := agent.Conv.ID
+
+		status := "DONE"
+		if stepDone(step) {
+			status = "TODO"
+		}
+
+		go func() {
+			updated, err := agent.Client.UpdateStep(plan.ID, step.ID, data.StepPatch{Status: &status}, plan.Version)
+			if errors.Is(err, data.ErrPlanVersionConflict) {
+				// Changed since it was shown, show it as it is now and let the user decide again
+				updated, err = agent.Client.GetPlan(convID)
+				if err == nil {
+					err = errors.New("the plan changed meanwhile, it has been reloaded")
+				}
+			}
+
+			app.QueueUpdateDraw(func() {
+				if updated != nil && updated.ConversationID == agent.Conv.ID {
+					agent.Plan = updated
+					renderPlan(&ui.State{Plan: updated})
+				}
+				if err != nil {
+					showStatus(fmt.Sprintf("[%s::]%s[-]", ui.CurrentTheme().Error, tview.Escape(err.Error())))
+				}
+			})
+		}()
+	}
+
+	planView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case keys.Matches(ui.ActionStepDown, event):
+			planView.SetCurrentItem(min(planView.GetCurrentItem()+1, planView.GetItemCount()-1))
+			return nil
+		case keys.Matches(ui.ActionStepUp, event):
+			planView.SetCurrentItem(max(planView.GetCurrentItem()-1, 0))
+			return nil
+		case keys.Matches(ui.ActionToggleStep, event):
+			toggleStep()
+			return nil
+		case keys.Matches(ui.ActionStepDetails, event):
+			step, ok := planView.selected()
+			if !ok {
+				return nil
+			}
+			details := newStepDetails(step, keys, func() {
+				pages.RemovePage("step")
+				app.SetFocus(planView)
+			})
+			pages.AddPage("step", centered(details, 80, len(step.Acceptance)+10), true, true)
+			app.SetFocus(details)
+			return nil
+		case keys.Matches(ui.ActionCancel, event):
+			app.SetFocus(questionInput)
+			return nil
+		}
+		return event
+	})
+
+	// Move the selection between tool calls, starting from the latest one
+	selectToolCall := func(delta int) {
+		count := calls.count()
+		if count == 0 {
+			return
+		}
+
+		n, ok := selectedToolCall(conversationView)
+		if !ok {
+			n = count - 1
+		} else {
+			n = min(max(n+delta, 0), count-1)
+		}
+		closeSearch()
+		conversationView.Highlight(toolRegion(n))
+		conversationView.ScrollToHighlight()
+	}
+
+	toggleToolCall := func(n int) {
+		// The conversation is being written to until the run ends
+		if busy {
+			showStatus("[" + ui.CurrentTheme().Warning + "::]Wait for the response to finish[-]")
+			return
+		}
+		closeSearch()
+		calls.toggle(conversationView, n)
+	}
+
+	conversationView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		selected, hasSelected := selectedToolCall(conversationView)
+
+		switch {
+		case search.active() && keys.Matches(ui.ActionCancel, event):
+			closeSearch()
+			return nil
+		case hasSelected && keys.Matches(ui.ActionCancel, event):
+			conversationView.Highlight()
+			return nil
+		case hasSelected && keys.Matches(ui.ActionToggleToolCall, event):
+			toggleToolCall(selected)
+			return nil
+		case keys.Matches(ui.ActionScrollUp, event):
+			scrollBy(conversationView, -pageLines(conversationView))
+			return nil
+		case keys.Matches(ui.ActionScrollDown, event):
+			scrollBy(conversationView, pageLines(conversationView))
+			return nil
+		case event.Key() == tcell.KeyDown:
+			// As tview scrolls, but following new text again at the bottom
+			scrollBy(conversationView, 1)
+			return nil
+		case keys.Matches(ui.ActionNextToolCall, event):
+			selectToolCall(1)
+			return nil
+		case keys.Matches(ui.ActionPrevToolCall, event):
+			selectToolCall(-1)
+			return nil
+		case keys.Matches(ui.ActionFocusInput, event):
+			closeSearch()
+			app.SetFocus(questionInput)
+			return nil
+		case keys.Matches(ui.ActionSearch, event):
+			openSearch()
+			return nil
+		case keys.Matches(ui.ActionFocusPlan, event):
+			focusPlan()
+			return nil
+		case search.active() && keys.Matches(ui.ActionSearchNext, event):
+			search.move(1)
+			showSearchStatus()
+			return nil
+		case search.active() && keys.Matches(ui.ActionSearchPrev, event):
+			search.move(-1)
+			showSearchStatus()
+			return nil
+		case keys.Matches(ui.ActionCopyResponse, event):
+			copyResponse(false)
+			return nil
+		case keys.Matches(ui.ActionCopyCode, event):
+			copyResponse(true)
+			return nil
+		}
+		return event
+	})
+
+	// Opens the help overlay, or closes it when open
+	toggleHelp := func() {
+		if pages.HasPage("help") {
+			pages.RemovePage("help")
+			app.SetFocus(questionInput)
+			return
+		}
+
+		focused := app.GetFocus()
+		help := newHelp(helpContents{
+			keys:     keys,
+			commands: env.commands,
+			llm:      agent.LLM,
+			servers:  agent.MCPStatus(),
+		}, func() {
+			pages.RemovePage("help")
+			app.SetFocus(focused)
+		})
+		_, _, _, height := pages.GetRect()
+		lines := strings.Count(help.GetText(false), "\n") + 2
+		pages.AddPage("help", centered(help, 110, min(lines, max(height-2, 10))), true, true)
+		app.SetFocus(help)
+	}
+
+	openStatus := func() {
+		focused := app.GetFocus()
+		statusView = newStatusPanel(keys, func(id string) {
+			go func() {
+				if err := agent.RestartMCPServer(id); err != nil {
+					app.QueueUpdateDraw(func() {
+						showError(fmt.Errorf("failed to restart MCP server %s: %w", id, err), false)
+					})
+				}
+			}()
+		}, func(name string) {
+			agent.SetToolDisabled(name, !agent.ToolDisabled(name))
+			statusView.set(agent.MCPStatus(), agent.ToolStatus())
+		}, func() {
+			pages.RemovePage("status")
+			statusView = nil
+			app.SetFocus(focused)
+		})
+		statusView.set(agent.MCPStatus(), agent.ToolStatus())
+		pages.AddPage("status", centered(statusView, 110, 24), true, true)
+		app.SetFocus(statusView)
+	}
+
+	// Runs off the TUI goroutine, failures show on the spinner line
+	notify := func(body string) {
+		if err := notifyUnfocused(screen, settings.Notify, body); err != nil {
+			app.QueueUpdateDraw(func() {
+				showStatus(fmt.Sprintf("[%s::]Notification failed: %s[-]", ui.CurrentTheme().Error, tview.Escape(err.Error())))
+			})
+		}
+	}
+
+	allowed := &allowedTools{}
+	// Asked on the agent goroutine, which waits for the choice
+	agent.Approve = func(ctx context.Context, name string, input json.RawMessage) bool {
+		if !settings.NeedsApproval(name) || allowed.allowed(name) {
+			return true
+		}
+
+		if spinner := activeSpinner.Load(); spinner != nil {
+			phase := spinner.Phase()
+			spinner.SetPhase("Waiting for approval")
+			defer spinner.SetPhase(phase)
+		}
+
+		choice := make(chan approvalChoice, 1)
+		app.QueueUpdateDraw(func() {
+			focused := app.GetFocus()
+			prompt := newApprovalPrompt(name, input, keys, func(c approvalChoice) {
+				pages.RemovePage("approval")
+				app.SetFocus(focused)
+				select {
+				case choice <- c:
+				default:
+				}
+			})
+			pages.AddPage("approval", centered(prompt, 100, 24), true, true)
+			app.SetFocus(prompt)
+		})
+		go notify("Waiting for approval to run " + name)
+
+		select {
+		case c := <-choice:
+			if c == allowAlways {
+				allowed.allow(name)
+			}
+			return c != denyCall
+		case <-ctx.Done():
+			app.QueueUpdateDraw(func() {
+				if pages.HasPage("approval") {
+					pages.RemovePage("approval")
+					app.SetFocus(questionInput)
+				}
+			})
+			return false
+		}
+	}
+
+	attachImage := func(img message.ImageBlock) {
+		if !inference.SupportsImages(agent.LLM.ModelName()) {
+			showStatus(fmt.Sprintf("[%s::]%s does not take images[-]", ui.CurrentTheme().Warning, tview.Escape(agent.LLM.ModelName())))
+			return
+		}
+		pendingImages = append(pendingImages, img)
+		updateStatus()
+		showStatus(fmt.Sprintf("[%s::]Attached %s, it goes with the next message[-]", ui.CurrentTheme().Muted, tview.Escape(img.Placeholder())))
+	}
+
+	// Terminals paste the path of a dropped file, which is attached rather than typed
+	onPaste := func(text string) bool {
+		if app.GetFocus() != questionInput {
+			return false
+		}
+
+		img, ok, err := imageFromPath(text)
+		if !ok {
+			return false
+		}
+		if err != nil {
+			showStatus(fmt.Sprintf("[%s::]%s[-]", ui.CurrentTheme().Error, tview.Escape(err.Error())))
+			return true
+		}
+		attachImage(img)
+		return true
+	}
+
+	// Ctrl+V takes an image from the system clipboard, text goes through the text area's own clipboard
+	var clipboard string
+	questionInput.SetClipboard(func(text string) {
+		clipboard = text
+	}, func() string {
+		data, err := ui.ClipboardImage()
+		if err != nil {
+			return clipboard
+		}
+		img, err := newImage(data, "clipboard")
+		if err != nil {
+			showStatus(fmt.Sprintf("[%s::]%s[-]", ui.CurrentTheme().Error, tview.Escape(err.Error())))
+			return ""
+		}
+		attachImage(img)
+		return ""
+	})
+
+	// Send as a user message and stream the reply, with the files it mentions and the pasted images
+	// Stream a run of the agent into the conversation, the input waits for it to finish
+	startRun := func(run func(onDelta func(string)) error) {
+		busy = true
+		spinner := ui.NewSpinner(phaseThinking, ui.SpinnerStar)
+		activeSpinner.Store(spinner)
+
+		go streamContent(app, ctx, conversationView, spinnerView, spinner, run, func(err error) {
+			app.QueueUpdateDraw(func() {
+				busy = false
+				// The agent dropped what it had not taken yet, give it back to be sent again
+				texts, height := queued.take()
+				mainLayout.ResizeItem(queued, height, 0)
+				if len(texts) > 0 {
+					if text := questionInput.GetText(); text != "" {
+						texts = append(texts, text)
+					}
+					questionInput.SetText(strings.Join(texts, "\n\n"), true)
+				}
+				if quitting {
+					app.Stop()
+					return
+				}
+				if err != nil {
+					showError(err, true)
+				}
+			})
+			if err != nil {
+				recordRunError(err)
+				notify(fmt.Sprintf("The run failed: %v", err))
+			} else {
+				notify("The response is ready")
+			}
+		})
+	}
+
+	// Exit, cutting off the run in progress first so the agent saves what it has.
+	// Another Ctrl+C, or a save taking too long, exits without waiting
+	quit := func() {
+		if !busy || quitting {
+			app.Stop()
+			return
+		}
+		quitting = true
+		cancel()
+		if spinner := activeSpinner.Load(); spinner != nil {
+			spinner.SetPhase(phaseSaving)
+		}
+		time.AfterFunc(runSaveTimeout, app.Stop)
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-signaled:
+			app.QueueUpdateDraw(quit)
+		case <-exited:
+		}
+	}()
+
+	submit := func(content string) {
+		closeSearch()
+		dismissError()
+
+		attachments, attached, skipped := attachMentions(content)
+		images := pendingImages
+		pendingImages = nil
+		updateStatus()
+		// The model may have changed since they were pasted
+		if len(images) > 0 && !inference.SupportsImages(agent.LLM.ModelName()) {
+			skipped = append(skipped, fmt.Sprintf("%d images, %s does not take images", len(images), agent.LLM.ModelName()))
+			images = nil
+		}
+		attachments = append(attachments, images...)
+
+		// The run in progress takes it at its next step
+		if agent.Enqueue(content, attachments) {
+			mainLayout.ResizeItem(queued, queued.add(content), 0)
+			return
+		}
+
+		// Sending brings the view back to the end, to follow the response
+		conversationView.ScrollToEnd()
+		fmt.Fprintf(conversationView, "[%s::i]> %s\n\n", theme.User, content)
+		for _, path := range attached {
+			fmt.Fprintf(conversationView, "[%s::]Attached %s[-]\n", ui.CurrentTheme().Muted, tview.Escape(path))
+		}
+		for _, img := range images {
+			fmt.Fprintf(conversationView, "[%s::]%s[-]\n", ui.CurrentTheme().Muted, tview.Escape(img.(message.ImageBlock).Placeholder()))
+		}
+		for _, reason := range skipped {
+			fmt.Fprintf(conversationView, "[%s::]Not attached: %s[-]\n", ui.CurrentTheme().Warning, tview.Escape(reason))
+		}
+		if len(attached)+len(images)+len(skipped) > 0 {
+			fmt.Fprintln(conversationView)
+		}
+
+		startRun(func(onDelta func(string)) error {
+			return agent.RunWithAttachments(ctx, content, attachments, onDelta)
+		})
+	}
+
+	env = &commandEnv{
+		ctx:                ctx,
+		app:                app,
+		agent:              agent,
+		commands:           ui.NewCommands(),
+		out:                conversationView,
+		openSwitcher:       openSwitcher,
+		changeModel:        changeModel,
+		copyResponse:       copyResponse,
+		showHelp:           toggleHelp,
+		openStatus:         openStatus,
+		switchConversation: switchConversation,
+		submit:             submit,
+	}
+	if err := registerBuiltinCommands(env); err != nil {
+		return err
+	}
+	registerMCPPromptCommands(env)
+
+	runCommand := func(name, args string) {
+		questionInput.SetText("", false)
+		closeSearch()
+
+		// Commands act on the conversation the agent is writing to
+		if busy {
+			showStatus(fmt.Sprintf("[%s::]Wait for the response to finish to run /%s[-]", ui.CurrentTheme().Warning, tview.Escape(name)))
+			return
+		}
+
+		cmd, ok := env.commands.Lookup(name)
+		if !ok {
+			showError(fmt.Errorf("unknown command /%s, type /help for the list", name), false)
+			return
+		}
+		dismissError()
+		recordCommand(name)
+		if err := cmd.Run(args); err != nil {
+			showError(err, false)
+		}
+	}
+
+	// Start of the @mention being completed, -1 when completing a command
+	mentionStart := -1
+	// Listed when a mention starts, so files created meanwhile show up
+	var files []string
+
+	questionInput.SetChangedFunc(func() {
+		text := questionInput.GetText()
+
+		items := commandItems(env.commands, text)
+		mentionStart = -1
+		if start, query, ok := mentionAtEnd(text); ok && items == nil {
+			if query == "" || files == nil {
+				files = mentionFiles(llmCfg.Dirs)
+			}
+			items = mentionItems(files, query)
+			mentionStart = start
+		}
+
+		mainLayout.ResizeItem(completion, completion.set(items), 0)
+	})
+	hideCompletion := func() {
+		mainLayout.ResizeItem(completion, completion.set(nil), 0)
+	}
+	completeMention := func(path string) {
+		questionInput.SetText(questionInput.GetText()[:mentionStart]+"@"+path+" ", true)
+	}
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Global bindings on printable keys would keep them from being typed
+		if event.Key() == tcell.KeyRune {
+			switch app.GetFocus().(type) {
+			case *tview.TextArea, *tview.InputField:
+				return event
+			}
+		}
+
+		switch {
+		case event.Key() == tcell.KeyCtrlC:
+			quit()
+			return nil
+		case keys.Matches(ui.ActionSwitchConversation, event):
+			openSwitcher()
+			return nil
+		case keys.Matches(ui.ActionHelp, event):
+			toggleHelp()
+			return nil
+		case keys.Matches(ui.ActionTogglePlan, event):
+			togglePlan()
+			return nil
+		case banner.active() && keys.Matches(ui.ActionErrorDetails, event):
+			mainLayout.ResizeItem(banner, banner.toggle(), 0)
+			return nil
+		case banner.retryable && keys.Matches(ui.ActionRetry, event):
+			if busy {
+				return nil
+			}
+			dismissError()
+			startRun(func(onDelta func(string)) error {
+				return agent.Retry(ctx, onDelta)
+			})
+			return nil
+		}
+		return event
+	})
+
+	// When the previous key reached the input
+	var lastKey time.Time
+
 	questionInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		pasting := settings.PasteGuard && event.When().Sub(lastKey) < pasteKeyGap
+		lastKey = event.When()
+
 		if isFirstInput && event.Key() == tcell.KeyRune {
 			conversationView.Clear()
 			conversationView.SetTextAlign(tview.AlignLeft)
 			isFirstInput = false
 		}
 
-		switch event.Key() {
-		case tcell.KeyESC:
+		if selected, ok := completion.selected(); ok && !pasting {
+			switch {
+			case event.Key() == tcell.KeyUp:
+				completion.move(-1)
+				return nil
+			case event.Key() == tcell.KeyDown:
+				completion.move(1)
+				return nil
+			case keys.Matches(ui.ActionComplete, event):
+				if mentionStart >= 0 {
+					completeMention(selected.value)
+				} else {
+					questionInput.SetText("/"+selected.value+" ", true)
+				}
+				return nil
+			case keys.Matches(ui.ActionSubmit, event):
+				if mentionStart >= 0 {
+					completeMention(selected.value)
+					return nil
+				}
+				hideCompletion()
+				runCommand(selected.value, "")
+				return nil
+			case keys.Matches(ui.ActionCancel, event):
+				hideCompletion()
+				return nil
+			}
+		}
+
+		switch {
+		case banner.active() && keys.Matches(ui.ActionCancel, event):
+			dismissError()
+			return nil
+		case keys.Matches(ui.ActionScrollUp, event):
+			scrollBy(conversationView, -pageLines(conversationView))
+			return nil
+		case keys.Matches(ui.ActionScrollDown, event):
+			scrollBy(conversationView, pageLines(conversationView))
+			return nil
+		case keys.Matches(ui.ActionFocusConversation, event):
 			if conversationView.GetText(false) != "" {
 				app.SetFocus(conversationView)
 			}
-		case tcell.KeyEnter:
+			return nil
+		case event.Key() == tcell.KeyUp:
+			// Recall only from an empty input, so the cursor still moves through typed lines
+			text := questionInput.GetText()
+			if text != "" && !history.Recalling(text) {
+				return event
+			}
+			if text == "" {
+				history.Reset()
+			}
+			if entry, ok := history.Prev(); ok {
+				questionInput.SetText(entry, true)
+			}
+			return nil
+		case event.Key() == tcell.KeyDown:
+			if !history.Recalling(questionInput.GetText()) {
+				return event
+			}
+			entry, _ := history.Next()
+			questionInput.SetText(entry, true)
+			return nil
+		case event.Key() == tcell.KeyBackspace || event.Key() == tcell.KeyBackspace2:
+			// Nothing left to delete, take back the last pasted image
+			if questionInput.GetText() == "" && len(pendingImages) > 0 {
+				pendingImages = pendingImages[:len(pendingImages)-1]
+				updateStatus()
+				return nil
+			}
+		case keys.Matches(ui.ActionNewline, event) || (pasting && keys.Matches(ui.ActionSubmit, event)):
+			_, start, end := questionInput.GetSelection()
+			questionInput.Replace(start, end, "\n")
+			return nil
+		case keys.Matches(ui.ActionSubmit, event):
 			content := questionInput.GetText()
 			if strings.TrimSpace(content) == "" {
 				return nil
 			}
+			if err := history.Add(content); err != nil {
+				showStatus(fmt.Sprintf("[%s::]%s[-]", ui.CurrentTheme().Error, tview.Escape(err.Error())))
+			}
+			if name, args, ok := ui.ParseCommand(content); ok {
+				runCommand(name, args)
+				return nil
+			}
 			questionInput.SetText("", false)
-			questionInput.SetDisabled(true)
-
-			// User input
-			fmt.Fprintf(conversationView, "[blue::i]> %s\n\n", content)
-
-			// Should call this only
-			go streamContent(app, ctx, conversationView, questionInput, spinnerView, content, agent)
+			submit(content)
 
 			return nil
 		}
 		return event
 	})
 
-	if err := app.SetRoot(mainLayout, true).EnableMouse(true).SetFocus(questionInput).Run(); err != nil {
+	// A fresh start in a project with history offers to pick up where it left off
+	var initialFocus tview.Primitive = questionInput
+	if isFirstInput {
+		convs, err := agent.Client.ListConversations(data.ListFilter{Project: utils.CurrentProject()})
+		if last, ok := lastSession(convs, agent.Conv.ID); err == nil && ok {
+			closePicker := func() {
+				pages.RemovePage("welcome")
+				app.SetFocus(questionInput)
+			}
+			picker := newSessionPicker(last, keys, func() {
+				closePicker()
+				if err := switchConversation(last.ID); err != nil {
+					showError(fmt.Errorf("failed to load conversation: %w", err), false)
+				}
+			}, closePicker, func() {
+				closePicker()
+				openSwitcher()
+			})
+			pages.AddPage("welcome", centered(picker, 70, 5), true, true)
+			initialFocus = picker
+		}
+	}
+
+	root := &pasteInterceptor{Primitive: pages, onPaste: onPaste}
+	if err := app.SetRoot(root, true).EnableMouse(true).EnablePaste(true).SetFocus(initialFocus).Run(); err != nil {
 		panic(err)
 	}
 
 	return nil
 }
 
-func formatMessage(msg *message.Message, nextMsg *message.Message) string {
+func formatMessage(msg *message.Message, nextMsg *message.Message, calls *toolCalls) string {
 	var result strings.Builder
+	theme := ui.CurrentTheme()
 
 	switch msg.Role {
 	case message.UserRole:
-		result.WriteString("\n[blue::]> ")
+		result.WriteString("\n[" + theme.User + "::]> ")
 	case message.AssistantRole, message.ModelRole:
-		result.WriteString("\n[white::]")
+		result.WriteString("\n[" + theme.Text + "::]")
 	}
 
-	toolErrors := make(map[string]bool)
+	toolResults := make(map[string]message.ToolResultBlock)
 	if nextMsg != nil && nextMsg.Role == message.UserRole {
 		for _, block := range nextMsg.Content {
-			if tr, ok := block.(message.ToolResultBlock); ok && tr.IsError {
-				toolErrors[tr.ToolUseID] = true
+			if tr, ok := block.(message.ToolResultBlock); ok {
+				toolResults[tr.ToolUseID] = tr
 			}
 		}
 	}
@@ -170,38 +1115,69 @@ func formatMessage(msg *message.Message, nextMsg *message.Message) string {
 	for _, block := range msg.Content {
 		switch b := block.(type) {
 		case message.TextBlock:
+			if path, ok := b.AttachedFile(); ok {
+				result.WriteString("[" + theme.Muted + "::]Attached " + tview.Escape(path) + "[-]\n")
+				continue
+			}
 			result.WriteString(b.Text + "\n")
+		case message.ImageBlock:
+			result.WriteString("[" + theme.Muted + "::]" + tview.Escape(b.Placeholder()) + "[-]\n")
+		case message.CitationBlock:
+			result.WriteString(formatCitation(b) + "\n")
 		case message.ToolUseBlock:
-			isError := toolErrors[b.ID]
+			tr := toolResults[b.ID]
 			inputBytes, _ := json.Marshal(b.Input)
-			result.WriteString(agent.FormatToolResultMessage(b.Name, inputBytes, isError))
+			result.WriteString(calls.add(&toolCall{name: b.Name, input: inputBytes, output: tr.Content, isError: tr.IsError}))
 		}
 	}
 
 	return result.String()
 }
 
+// Reference to a cited source, a link the terminal opens when it supports them
+func formatCitation(c message.CitationBlock) string {
+	theme := ui.CurrentTheme()
+	return fmt.Sprintf("[%s::]Source: [%s::u:%s]%s[-::-:-]", theme.Muted, theme.Accent, c.Link(), tview.Escape(c.Reference()))
+}
+
+// Print the sources of the answer below it as they come
+func writeCitations(view *tview.TextView, next func(agent.Event)) func(agent.Event) {
+	return func(e agent.Event) {
+		if e.Type != agent.EventCitation || e.Citation == nil {
+			next(e)
+			return
+		}
+		// Streaming leaves the answer without its final newline
+		fmt.Fprint(view, "\n"+formatCitation(*e.Citation))
+	}
+}
+
 func formatWelcomeMessage() string {
 	var result strings.Builder
+	theme := ui.CurrentTheme()
 
-	result.WriteString("[green]\n")
+	result.WriteString("[" + theme.Logo + "]\n")
 	result.WriteString(logo)
 	result.WriteString("[-]\n")
-	result.WriteString(fmt.Sprintf("\t[white::b]v%s[-]\n\n", Version))
-	result.WriteString("\t[white]Thank you for using Tinker![-]\n")
-	result.WriteString("\t[white::]Feel free to make a contribution - this app is open source[-]\n\n")
-	result.WriteString("\t[dim::]Press Ctrl+C to exit[-]")
+	result.WriteString(fmt.Sprintf("\t[%s::b]v%s[-::-]\n\n", theme.Text, Version))
+	result.WriteString(fmt.Sprintf("\t[%s]Thank you for using Tinker![-]\n", theme.Text))
+	result.WriteString(fmt.Sprintf("\t[%s::]Feel free to make a contribution - this app is open source[-]\n\n", theme.Text))
+	result.WriteString(fmt.Sprintf("\t[%s::]Type / for commands or /keys for the key bindings, Ctrl+C to exit[-]", theme.Muted))
 
 	return result.String()
 }
 
-func displayConversationHistory(conversationView *tview.TextView, conv *data.Conversation) {
+func displayConversationHistory(conversationView *tview.TextView, conv *data.Conversation, calls *toolCalls) {
 	if len(conv.Messages) == 0 {
 		return
 	}
 
 	for i, msg := range conv.Messages {
 		if msg.Role == message.UserRole && len(msg.Content) > 0 && msg.Content[0].Type() == message.ToolResultType {
+			// Messages queued during the run went along with the results
+			if texts := textBlocks(msg); len(texts) > 0 {
+				fmt.Fprintf(conversationView, "%s", formatMessage(&message.Message{Role: msg.Role, Content: texts}, nil, calls))
+			}
 			continue
 		}
 
@@ -210,33 +1186,18 @@ func displayConversationHistory(conversationView *tview.TextView, conv *data.Con
 			nextMsg = conv.Messages[i+1]
 		}
 
-		formattedMsg := formatMessage(msg, nextMsg)
+		formattedMsg := formatMessage(msg, nextMsg, calls)
 		fmt.Fprintf(conversationView, "%s", formattedMsg)
 	}
 
 	conversationView.ScrollToEnd()
 }
 
-func getRandomSpinnerMessage() string {
-	messages := []string{
-		"Almost there...",
-		"Hold on...",
-		"Just a moment...",
-		"Figuring it out...",
-		"Communicating with the alien intelligence...",
-		"Beep booping...",
-		"Consulting the machines...",
-	}
-
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return messages[r.Intn(len(messages))]
-}
-
 // renderRelativePath returns a custom draw function for the question input area
 // that overlays the relative path in the bottom-right corner of the input box
 func renderRelativePath(relPath string) func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
 	return func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
-		pathText := fmt.Sprintf("[blue::]%s[-]", relPath)
+		pathText := fmt.Sprintf("[%s::]%s[-]", ui.CurrentTheme().Detail, relPath)
 		pathWidth := len(relPath)
 
 		rightX := x + width - pathWidth - 2
@@ -291,13 +1252,93 @@ func formatPlanSteps(plan *data.Plan) string {
 	var result strings.Builder
 
 	for _, step := range plan.Steps {
-		statusColor := "white"
-		statusSymbol := "○"
-		if strings.ToUpper(step.Status) == "DONE" {
-			statusColor = "green"
-			statusSymbol = "✓"
+		result.WriteString(formatPlanStep(step) + "\n")
+	}
+
+	return result.String()
+}
+
+// Model the agent talks to, for the input box title
+func formatModelStatus(llm inference.LLMClient) string {
+	return fmt.Sprintf("[%s] Model: %s (%s) ", ui.CurrentTheme().Accent, llm.ModelName(), llm.ProviderName())
+}
+
+func formatImageStatus(count int) string {
+	text := ui.CurrentTheme().Text
+	switch count {
+	case 0:
+		return ""
+	case 1:
+		return "[" + text + "] 1 image "
+	default:
+		return fmt.Sprintf("[%s] %d images ", text, count)
+	}
+}
+
+// How full the context window was on the last call, colored as it fills up
+func formatContextStatus(model string, usage *ui.UsageStatus) string {
+	theme := ui.CurrentTheme()
+	if usage == nil || usage.InputTokens+usage.OutputTokens == 0 {
+		return "[" + theme.Text + "]| Context: - "
+	}
+
+	tokens := usage.InputTokens + usage.OutputTokens
+	window := inference.ContextWindow(model)
+	if window == 0 {
+		return fmt.Sprintf("[%s]| Context: %s tokens ", theme.Text, formatTokens(tokens))
+	}
+
+	percent := float64(tokens) * 100 / float64(window)
+	color := theme.Success
+	switch {
+	case percent >= 80:
+		color = theme.Error
+	case percent >= 50:
+		color = theme.Warning
+	}
+	return fmt.Sprintf("[%s]| Context: [%s]%.0f%%[%s] (%s/%s) ", theme.Text, color, percent, theme.Text, formatTokens(tokens), formatTokens(window))
+}
+
+func formatCostStatus(usage *ui.UsageStatus) string {
+	if usage == nil || usage.SessionCost == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s]| Cost: $%.2f ", ui.CurrentTheme().Text, usage.SessionCost)
+}
+
+// e.g., 850, 12.3k, 1.0M
+func formatTokens(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+// Render a health dot per MCP server for the status bar
+func formatMCPStatus(statuses []ui.MCPServerStatus) string {
+	if len(statuses) == 0 {
+		return ""
+	}
+
+	theme := ui.CurrentTheme()
+	var result strings.Builder
+	result.WriteString("[" + theme.Text + "]| MCP: ")
+	for _, s := range statuses {
+		switch {
+		case s.State == ui.MCPStarting || s.State == ui.MCPRestarting:
+			result.WriteString(fmt.Sprintf("[%s]● [%s]%s ", theme.Warning, theme.Text, s.ID))
+		case s.Healthy:
+			result.WriteString(fmt.Sprintf("[%s]● [%s]%s ", theme.Success, theme.Text, s.ID))
+			if s.Latency > 0 {
+				result.WriteString(fmt.Sprintf("[%s]%dms[-] ", theme.Muted, s.Latency.Milliseconds()))
+			}
+		default:
+			result.WriteString(fmt.Sprintf("[%s]● [%s]%s ", theme.Error, theme.Text, s.ID))
 		}
-		result.WriteString(fmt.Sprintf("[%s::]%s %s[-]\n", statusColor, statusSymbol, step.Description))
 	}
 
 	return result.String()
@@ -305,34 +1346,72 @@ func formatPlanSteps(plan *data.Plan) string {
 
 // TODO: The number + order of arguments passed in here are atrocious.
 // Are we going to make it C-like? Can we make it better?
-func streamContent(app *tview.Application, ctx context.Context, conversationView *tview.TextView, questionInput *tview.TextArea, spinnerView *tview.TextView, content string, agent *agent.Agent) {
-	spinner := ui.NewSpinner(getRandomSpinnerMessage(), ui.SpinnerStar)
-
+func streamContent(app *tview.Application, ctx context.Context, conversationView *tview.TextView, spinnerView *tview.TextView, spinner *ui.Spinner, run func(onDelta func(string)) error, onFinish func(error)) {
 	stop := startSpinner(app, ctx, spinner, spinnerView)
 	go func() {
+		var err error
 		defer func() {
 			stop <- true
-			questionInput.SetDisabled(false)
-			app.Draw()
+			onFinish(err)
 		}()
 
+		streamed := false
 		onDelta := func(delta string) {
+			streamed = true
+			if spinner.Phase() != phaseResponding {
+				spinner.SetPhase(phaseResponding)
+			}
+			spinner.Receive(delta)
 			// conversationView is append only, meaning we can replace the text that has already printed out
 			// so bye bye printing out tool being executed
-			fmt.Fprintf(conversationView, "[white]%s", delta)
+			fmt.Fprintf(conversationView, "[%s]%s", ui.CurrentTheme().Text, delta)
 		}
 
-		err := agent.Run(ctx, content, onDelta)
+		err = run(onDelta)
 		if err != nil {
-			fmt.Fprintf(conversationView, "[red::]Error: %v[-]\n\n", err)
+			// The error itself goes to the banner, only the cut off response is closed here
+			if streamed {
+				fmt.Fprintf(conversationView, "\n\n")
+			}
 			return
 		}
 
+		// Only followed to the end if the user has not scrolled up meanwhile
 		fmt.Fprintf(conversationView, "\n\n")
-		conversationView.ScrollToEnd()
 	}()
 }
 
+const (
+	phaseThinking   = "Thinking"
+	phaseResponding = "Responding"
+	phaseSaving     = "Saving"
+)
+
+// How long exiting waits for the run in progress to save the conversation
+const runSaveTimeout = 5 * time.Second
+
+// Show on the spinner which tool the agent is waiting for
+func trackToolPhase(a *agent.Agent, spinner *atomic.Pointer[ui.Spinner], next func(agent.Event)) func(agent.Event) {
+	return func(e agent.Event) {
+		next(e)
+
+		s := spinner.Load()
+		if s == nil {
+			return
+		}
+		switch e.Type {
+		case agent.EventToolCall:
+			if server := a.MCPServerOf(e.Tool); server != "" {
+				s.SetPhase("Waiting on MCP server " + server)
+			} else {
+				s.SetPhase("Running " + e.Tool)
+			}
+		case agent.EventToolResult:
+			s.SetPhase(phaseThinking)
+		}
+	}
+}
+
 func startSpinner(app *tview.Application, ctx context.Context, spinner *ui.Spinner, spinnerView *tview.TextView) chan bool {
 	stop := make(chan bool)
 	go func() {
@@ -353,3 +1432,14 @@ func startSpinner(app *tview.Application, ctx context.Context, spinner *ui.Spinn
 
 	return stop
 }
+
+// Text sent in the same message as tool results
+func textBlocks(msg *message.Message) []message.ContentBlock {
+	var texts []message.ContentBlock
+	for _, block := range msg.Content {
+		if b, ok := block.(message.TextBlock); ok {
+			texts = append(texts, b)
+		}
+	}
+	return texts
+}
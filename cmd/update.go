@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/honganh1206/tinker/update"
+	"github.com/honganh1206/tinker/utils"
+	"github.com/spf13/cobra"
+)
+
+const updateStateFile = "update_check.json"
+
+func UpdateHandler(cmd *cobra.Command, args []string) error {
+	checkOnly, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+
+	rel, err := update.Latest(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if Version == "dev" {
+		return fmt.Errorf("this is a development build, install release %s from https://github.com/honganh1206/tinker/releases instead", rel.Version)
+	}
+	if !update.Newer(Version, rel.Version) {
+		fmt.Printf("tinker %s is up to date\n", Version)
+		return nil
+	}
+	if checkOnly {
+		fmt.Printf("tinker %s is available, you have %s. Run `tinker update` to install it\n", rel.Version, Version)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// Replace the binary itself, not a link to it
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updating tinker %s to %s...\n", Version, rel.Version)
+	if err := update.Apply(cmd.Context(), rel, exe); err != nil {
+		if errors.Is(err, update.ErrNoAsset) {
+			return fmt.Errorf("%w, build it from source instead", err)
+		}
+		return err
+	}
+	fmt.Printf("Updated %s to %s\n", exe, rel.Version)
+	return nil
+}
+
+// Version newer than this one found by an earlier check, empty when there is none.
+// Looks up the latest release in the background for the next start, at most once a day
+func checkForUpdate() string {
+	if Version == "dev" || !userConfig.UpdateChecks() {
+		return ""
+	}
+
+	dir, err := utils.DataDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, updateStateFile)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// Offline is fine, the next start tries again
+		update.Refresh(ctx, path)
+	}()
+
+	return update.Notice(path, Version)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/ui"
+	"github.com/rivo/tview"
+)
+
+// The conversation of the project most recently written to, false when there is none besides the current one.
+// Conversations nothing was ever sent in are left out, every start creates one
+func lastSession(convs []data.ConversationMetadata, currentID string) (data.ConversationMetadata, bool) {
+	var last data.ConversationMetadata
+	found := false
+	for _, conv := range convs {
+		if conv.ID == currentID || conv.MessageCount == 0 {
+			continue
+		}
+		if !found || lastActive(conv).After(lastActive(last)) {
+			last, found = conv, true
+		}
+	}
+	return last, found
+}
+
+// Overlay offered on startup when the project has history, Esc starts a new session
+func newSessionPicker(last data.ConversationMetadata, keys ui.Keymap, onContinue, onNew, onBrowse func()) *tview.List {
+	theme := ui.CurrentTheme()
+
+	title := last.Title
+	if title == "" {
+		title = "untitled " + last.ID[:min(8, len(last.ID))]
+	}
+
+	list := tview.NewList().
+		ShowSecondaryText(false).
+		SetHighlightFullLine(true).
+		AddItem(fmt.Sprintf("Continue last session [%s::]%s · %s[-::]", theme.Muted, tview.Escape(title), formatAge(time.Now(), lastActive(last))), "", 'c', onContinue).
+		AddItem("Start new", "", 'n', onNew).
+		AddItem("Browse sessions", "", 'b', onBrowse)
+	list.SetBorder(true).
+		SetTitle(" Welcome back ").
+		SetTitleAlign(tview.AlignLeft)
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if keys.Matches(ui.ActionCancel, event) {
+			onNew()
+			return nil
+		}
+		return event
+	})
+
+	return list
+}
@@ -0,0 +1,580 @@
+// Package config resolves the settings shared by every tinker command from the user's config file,
+// the project's and the environment. Flags are applied on top by the caller
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honganh1206/tinker/mcp"
+)
+
+const (
+	configFile = "config.json"
+	// Directory of the project config, at the root of the repository
+	projectDir = ".tinker"
+
+	ProviderEnv  = "TINKER_PROVIDER"
+	ModelEnv     = "TINKER_MODEL"
+	MaxTokensEnv = "TINKER_MAX_TOKENS"
+	ApproveEnv   = "TINKER_APPROVE"
+	ThemeEnv     = "TINKER_THEME"
+	ServerEnv    = "TINKER_SERVER"
+	ProfileEnv   = "TINKER_PROFILE"
+	MaxTurnsEnv  = "TINKER_MAX_TURNS"
+	MaxCostEnv   = "TINKER_MAX_COST"
+	MaxTimeEnv   = "TINKER_MAX_TIME"
+	// Set to false to stop looking for new releases, e.g., on CI
+	UpdateCheckEnv = "TINKER_UPDATE_CHECK"
+	// Set to true to count feature usage and errors locally, see tinker stats --telemetry
+	TelemetryEnv = "TINKER_TELEMETRY"
+)
+
+type Config struct {
+	Provider  string `json:"provider,omitempty"`
+	Model     string `json:"model,omitempty"`
+	MaxTokens int64  `json:"max_tokens,omitempty"`
+	// Bounds of each run, from a message until the agent is done with it
+	MaxTurns int          `json:"max_turns,omitempty"`
+	MaxCost  float64      `json:"max_cost,omitempty"`
+	MaxTime  mcp.Duration `json:"max_time,omitempty"`
+	// Tools to ask about before each call, "*" for all of them
+	Approve []string `json:"approve,omitempty"`
+	// Tools the agent may use, glob patterns allowed. All of them when empty
+	Tools []string `json:"tools,omitempty"`
+	// Name of a built-in theme or of one defined in theme.json
+	Theme string `json:"theme,omitempty"`
+	// URL of the tinker server, e.g., http://localhost:11435 or unix:///path/to/tinker.sock
+	Server string `json:"server,omitempty"`
+	// Look for a new release at most once a day and mention it on exit. On unless set to false
+	UpdateCheck *bool `json:"update_check,omitempty"`
+	// Count which features are used and which kinds of errors come up, in a local file. Off unless set to true
+	Telemetry *bool `json:"telemetry,omitempty"`
+	// Added to those of mcp_servers.json, replacing the ones with the same ID
+	MCPServers []mcp.ServerConfig `json:"mcp_servers,omitempty"`
+	// Environment of the model clients, e.g., ANTHROPIC_API_KEY.
+	// Values support ${VAR} and ${file:/path/to/secret} like the env of MCP servers
+	Env map[string]string `json:"env,omitempty"`
+	// Profile used when none is given with --profile or TINKER_PROFILE.
+	// Once resolved, the profile in use
+	Profile string `json:"profile,omitempty"`
+	// Named blocks applied over the rest of the user config, only read from the user's file
+	Profiles map[string]Config `json:"profiles,omitempty"`
+}
+
+// Keys get and set take, in the order they are listed
+var keys = []string{"provider", "model", "max_tokens", "max_turns", "max_cost", "max_time", "approve", "tools", "theme", "server", "update_check", "telemetry", "profile", "env", "mcp_servers"}
+
+func Keys() []string {
+	return append([]string(nil), keys...)
+}
+
+// Resolve the config of project from the user's config file, then the selected profile, then the project's,
+// then the environment, each one overriding the previous. An empty project skips the project file,
+// an empty profile falls back to TINKER_PROFILE and then to the profile set in the user's file
+func Load(project, profile string) (Config, error) {
+	var cfg Config
+	var profiles map[string]Config
+
+	if path, err := UserPath(); err == nil {
+		userCfg, err := ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		profiles = userCfg.Profiles
+		cfg = cfg.merge(userCfg)
+		cfg.Profile = userCfg.Profile
+	}
+
+	if profile == "" {
+		profile = os.Getenv(ProfileEnv)
+	}
+	if profile == "" {
+		profile = cfg.Profile
+	}
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			return cfg, unknownProfile(profile, profiles)
+		}
+		cfg = cfg.merge(p)
+		cfg.Profile = profile
+	}
+
+	if project != "" {
+		projectCfg, err := ReadFile(ProjectPath(project))
+		if err != nil {
+			return cfg, err
+		}
+		cfg = cfg.merge(projectCfg.restricted(cfg))
+	}
+
+	envCfg, err := fromEnv()
+	if err != nil {
+		return cfg, err
+	}
+	cfg = cfg.merge(envCfg)
+
+	return cfg, cfg.Validate()
+}
+
+func fromEnv() (Config, error) {
+	cfg := Config{
+		Provider: os.Getenv(ProviderEnv),
+		Model:    os.Getenv(ModelEnv),
+		Theme:    os.Getenv(ThemeEnv),
+		Server:   os.Getenv(ServerEnv),
+		Approve:  splitList(os.Getenv(ApproveEnv)),
+	}
+	if v := os.Getenv(MaxTokensEnv); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s %q", MaxTokensEnv, v)
+		}
+		cfg.MaxTokens = n
+	}
+	for _, env := range []struct{ name, key string }{
+		{MaxTurnsEnv, "max_turns"},
+		{MaxCostEnv, "max_cost"},
+		{MaxTimeEnv, "max_time"},
+		{UpdateCheckEnv, "update_check"},
+		{TelemetryEnv, "telemetry"},
+	} {
+		if v := os.Getenv(env.name); v != "" {
+			if err := cfg.Set(env.key, v); err != nil {
+				return cfg, fmt.Errorf("invalid %s: %w", env.name, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Config in the file at path, empty when there is none
+func ReadFile(path string) (Config, error) {
+	var cfg Config
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func writeFile(path string, cfg Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	raw, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Only readable by the user, env holds API keys
+	if err := os.WriteFile(path, append(raw, '\n'), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file written before
+	return os.Chmod(path, 0o600)
+}
+
+// Override fields that are set in other
+func (c Config) merge(other Config) Config {
+	if other.Provider != "" {
+		c.Provider = other.Provider
+	}
+	if other.Model != "" {
+		c.Model = other.Model
+	}
+	if other.MaxTokens != 0 {
+		c.MaxTokens = other.MaxTokens
+	}
+	if other.MaxTurns != 0 {
+		c.MaxTurns = other.MaxTurns
+	}
+	if other.MaxCost != 0 {
+		c.MaxCost = other.MaxCost
+	}
+	if other.MaxTime != 0 {
+		c.MaxTime = other.MaxTime
+	}
+	if other.Approve != nil {
+		c.Approve = other.Approve
+	}
+	if other.Tools != nil {
+		c.Tools = other.Tools
+	}
+	if other.Theme != "" {
+		c.Theme = other.Theme
+	}
+	if other.Server != "" {
+		c.Server = other.Server
+	}
+	if other.UpdateCheck != nil {
+		c.UpdateCheck = other.UpdateCheck
+	}
+	if other.Telemetry != nil {
+		c.Telemetry = other.Telemetry
+	}
+	c.MCPServers = MergeMCPServers(c.MCPServers, other.MCPServers)
+	if len(other.Env) > 0 {
+		env := make(map[string]string, len(c.Env)+len(other.Env))
+		for k, v := range c.Env {
+			env[k] = v
+		}
+		for k, v := range other.Env {
+			env[k] = v
+		}
+		c.Env = env
+	}
+	return c
+}
+
+// Servers of base with those of other added, the ones of other win when the IDs are the same
+func MergeMCPServers(base, other []mcp.ServerConfig) []mcp.ServerConfig {
+	if len(other) == 0 {
+		return base
+	}
+
+	merged := append([]mcp.ServerConfig(nil), base...)
+	for _, s := range other {
+		replaced := false
+		for i := range merged {
+			if merged[i].ID == s.ID {
+				merged[i] = s
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// What a project config may change over the user's. A cloned repository must not start programs,
+// send conversations elsewhere, swap credentials or lift the approvals and tool limits the user asked for
+func (c Config) restricted(user Config) Config {
+	c.MCPServers = nil
+	c.Server = ""
+	c.Env = nil
+	c.Tools = nil
+	c.Profile = ""
+	c.Profiles = nil
+	// Only the user opts in
+	c.Telemetry = nil
+	if c.Approve != nil {
+		c.Approve = append(append([]string(nil), user.Approve...), c.Approve...)
+	}
+	return c
+}
+
+func (c Config) Validate() error {
+	if c.MaxTokens < 0 {
+		return fmt.Errorf("invalid max_tokens %d, must be positive", c.MaxTokens)
+	}
+	if c.MaxTurns < 0 || c.MaxCost < 0 || c.MaxTime < 0 {
+		return errors.New("max_turns, max_cost and max_time must be positive")
+	}
+	for _, s := range c.MCPServers {
+		if s.ID == "" {
+			return errors.New("MCP server without an id in config")
+		}
+	}
+	for name, p := range c.Profiles {
+		if p.Profile != "" || len(p.Profiles) > 0 {
+			return fmt.Errorf("profile %s cannot select or define profiles", name)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Report whether the agent may use a tool
+func (c Config) AllowsTool(name string) bool {
+	if len(c.Tools) == 0 {
+		return true
+	}
+	for _, p := range c.Tools {
+		if p == name {
+			return true
+		}
+		// Malformed patterns simply never match
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether to look for new releases, which is the default
+func (c Config) UpdateChecks() bool {
+	return c.UpdateCheck == nil || *c.UpdateCheck
+}
+
+// Whether to record telemetry, which only happens once the user turns it on
+func (c Config) TelemetryEnabled() bool {
+	return c.Telemetry != nil && *c.Telemetry
+}
+
+// Names of the profiles, sorted
+func (c Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Value of key as set would take it, lists are comma-separated. Empty when it is not set
+func (c Config) Get(key string) (string, error) {
+	switch key {
+	case "provider":
+		return c.Provider, nil
+	case "model":
+		return c.Model, nil
+	case "max_tokens":
+		if c.MaxTokens == 0 {
+			return "", nil
+		}
+		return strconv.FormatInt(c.MaxTokens, 10), nil
+	case "max_turns":
+		if c.MaxTurns == 0 {
+			return "", nil
+		}
+		return strconv.Itoa(c.MaxTurns), nil
+	case "max_cost":
+		if c.MaxCost == 0 {
+			return "", nil
+		}
+		return strconv.FormatFloat(c.MaxCost, 'f', -1, 64), nil
+	case "max_time":
+		if c.MaxTime == 0 {
+			return "", nil
+		}
+		return time.Duration(c.MaxTime).String(), nil
+	case "approve":
+		return strings.Join(c.Approve, ","), nil
+	case "tools":
+		return strings.Join(c.Tools, ","), nil
+	case "theme":
+		return c.Theme, nil
+	case "server":
+		return c.Server, nil
+	case "update_check":
+		if c.UpdateCheck == nil {
+			return "", nil
+		}
+		return strconv.FormatBool(*c.UpdateCheck), nil
+	case "telemetry":
+		if c.Telemetry == nil {
+			return "", nil
+		}
+		return strconv.FormatBool(*c.Telemetry), nil
+	case "profile":
+		return c.Profile, nil
+	case "env":
+		// Names only, the values are usually secrets
+		names := make([]string, 0, len(c.Env))
+		for k := range c.Env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ","), nil
+	case "mcp_servers":
+		if len(c.MCPServers) == 0 {
+			return "", nil
+		}
+		raw, err := json.MarshalIndent(c.MCPServers, "", "  ")
+		return string(raw), err
+	}
+	return "", unknownKey(key)
+}
+
+// Set key from its text form, an empty value unsets it
+func (c *Config) Set(key, value string) error {
+	switch key {
+	case "provider":
+		c.Provider = value
+	case "model":
+		c.Model = value
+	case "max_tokens":
+		if value == "" {
+			c.MaxTokens = 0
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_tokens %q, must be a positive number", value)
+		}
+		c.MaxTokens = n
+	case "max_turns":
+		if value == "" {
+			c.MaxTurns = 0
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_turns %q, must be a positive number", value)
+		}
+		c.MaxTurns = n
+	case "max_cost":
+		if value == "" {
+			c.MaxCost = 0
+			return nil
+		}
+		n, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_cost %q, must be an amount in USD, e.g., 0.50", value)
+		}
+		c.MaxCost = n
+	case "max_time":
+		if value == "" {
+			c.MaxTime = 0
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid max_time %q, must be a duration, e.g., 10m", value)
+		}
+		c.MaxTime = mcp.Duration(d)
+	case "approve":
+		c.Approve = splitList(value)
+	case "tools":
+		c.Tools = splitList(value)
+	case "theme":
+		c.Theme = value
+	case "server":
+		c.Server = value
+	case "update_check":
+		if value == "" {
+			c.UpdateCheck = nil
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid update_check %q, must be true or false", value)
+		}
+		c.UpdateCheck = &b
+	case "telemetry":
+		if value == "" {
+			c.Telemetry = nil
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid telemetry %q, must be true or false", value)
+		}
+		c.Telemetry = &b
+	case "profile":
+		c.Profile = value
+	case "env":
+		return errors.New("env holds credentials, edit the config file to change it")
+	case "mcp_servers":
+		return errors.New("mcp_servers is a list of servers, edit the config file to change it")
+	default:
+		return unknownKey(key)
+	}
+	return nil
+}
+
+// Set key in the config file at path, in the block of profile when there is one,
+// leaving the rest of the file as it is
+func SetInFile(path, profile, key, value string) error {
+	cfg, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if profile == "" {
+		err = cfg.Set(key, value)
+		if _, ok := cfg.Profiles[value]; err == nil && key == "profile" && value != "" && !ok {
+			// Every command would fail on it
+			err = unknownProfile(value, cfg.Profiles)
+		}
+	} else {
+		err = cfg.setInProfile(profile, key, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return writeFile(path, cfg)
+}
+
+func (c *Config) setInProfile(profile, key, value string) error {
+	if key == "profile" {
+		return errors.New("profile cannot be set inside a profile")
+	}
+
+	p := c.Profiles[profile]
+	if err := p.Set(key, value); err != nil {
+		return err
+	}
+
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]Config)
+	}
+	c.Profiles[profile] = p
+	return nil
+}
+
+func unknownKey(key string) error {
+	sorted := Keys()
+	sort.Strings(sorted)
+	return fmt.Errorf("unknown config key %q, known keys are %s", key, strings.Join(sorted, ", "))
+}
+
+func unknownProfile(name string, profiles map[string]Config) error {
+	known := Config{Profiles: profiles}.ProfileNames()
+	if len(known) == 0 {
+		return fmt.Errorf("unknown profile %q, there are no profiles in the user config", name)
+	}
+	return fmt.Errorf("unknown profile %q, known profiles are %s", name, strings.Join(known, ", "))
+}
+
+// Comma-separated list with blanks dropped, nil when there is nothing in it
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func UserPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "tinker", configFile), nil
+}
+
+// Config file of the project rooted at project, meant to be committed with it
+func ProjectPath(project string) string {
+	return filepath.Join(project, projectDir, configFile)
+}
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/honganh1206/tinker/mcp"
+)
+
+// Point the user config at a temporary directory and clear the environment
+func isolate(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	for _, env := range []string{ProviderEnv, ModelEnv, MaxTokensEnv, ApproveEnv, ThemeEnv, ServerEnv, ProfileEnv, MaxTurnsEnv, MaxCostEnv, MaxTimeEnv, UpdateCheckEnv, TelemetryEnv} {
+		t.Setenv(env, "")
+	}
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	isolate(t)
+	project := t.TempDir()
+
+	userPath, err := UserPath()
+	if err != nil {
+		t.Fatalf("UserPath failed: %v", err)
+	}
+	writeConfig(t, userPath, `{"provider":"anthropic","model":"claude-4-sonnet","max_tokens":4096,"theme":"light","approve":["bash"]}`)
+	writeConfig(t, ProjectPath(project), `{"model":"claude-4-opus","approve":["edit_file"]}`)
+	t.Setenv(MaxTokensEnv, "2048")
+
+	cfg, err := Load(project, "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	want := Config{
+		Provider:  "anthropic",
+		Model:     "claude-4-opus",
+		MaxTokens: 2048,
+		Theme:     "light",
+		Approve:   []string{"bash", "edit_file"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Load() = %+v, want %+v", cfg, want)
+	}
+
+	// Without a project only the user file and the environment apply
+	cfg, err = Load("", "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Model != "claude-4-sonnet" {
+		t.Errorf("Load(\"\").Model = %q, want the user's", cfg.Model)
+	}
+}
+
+func TestLoad_ProjectRestricted(t *testing.T) {
+	isolate(t)
+	project := t.TempDir()
+
+	userPath, _ := UserPath()
+	writeConfig(t, userPath, `{"server":"http://localhost:11435","mcp_servers":[{"id":"fetch","command":"uvx"}]}`)
+	writeConfig(t, ProjectPath(project), `{"server":"http://example.com","mcp_servers":[{"id":"evil","command":"sh"}],"telemetry":true}`)
+
+	cfg, err := Load(project, "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server != "http://localhost:11435" {
+		t.Errorf("Server = %q, the project must not change it", cfg.Server)
+	}
+	if len(cfg.MCPServers) != 1 || cfg.MCPServers[0].ID != "fetch" {
+		t.Errorf("MCPServers = %+v, the project must not add any", cfg.MCPServers)
+	}
+	if cfg.TelemetryEnabled() {
+		t.Error("TelemetryEnabled() = true, only the user may turn it on")
+	}
+}
+
+func TestLoad_Profile(t *testing.T) {
+	isolate(t)
+	project := t.TempDir()
+
+	userPath, _ := UserPath()
+	writeConfig(t, userPath, `{
+		"provider": "google",
+		"model": "gemini-2.5-pro",
+		"env": {"GOOGLE_API_KEY": "personal"},
+		"profile": "home",
+		"profiles": {
+			"home": {"model": "gemini-2.5-flash"},
+			"work": {
+				"provider": "anthropic",
+				"env": {"ANTHROPIC_API_KEY": "${file:/run/secrets/work}"},
+				"tools": ["read_file", "grep_*"],
+				"mcp_servers": [{"id": "jira", "command": "jira-mcp"}]
+			}
+		}
+	}`)
+	writeConfig(t, ProjectPath(project), `{"model":"claude-4-opus"}`)
+
+	cfg, err := Load(project, "work")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := Config{
+		Provider:   "anthropic",
+		Model:      "claude-4-opus",
+		Tools:      []string{"read_file", "grep_*"},
+		MCPServers: []mcp.ServerConfig{{ID: "jira", Command: "jira-mcp"}},
+		Env:        map[string]string{"GOOGLE_API_KEY": "personal", "ANTHROPIC_API_KEY": "${file:/run/secrets/work}"},
+		Profile:    "work",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Load() = %+v, want %+v", cfg, want)
+	}
+	if !cfg.AllowsTool("grep_search") || cfg.AllowsTool("bash") {
+		t.Error("AllowsTool does not follow the tools of the profile")
+	}
+
+	// The environment picks the profile over the user file, which is the fallback
+	t.Setenv(ProfileEnv, "work")
+	if cfg, _ = Load("", ""); cfg.Profile != "work" {
+		t.Errorf("Profile = %q, want the one of %s", cfg.Profile, ProfileEnv)
+	}
+	t.Setenv(ProfileEnv, "")
+	if cfg, _ = Load("", ""); cfg.Model != "gemini-2.5-flash" {
+		t.Errorf("Model = %q, want the one of the default profile", cfg.Model)
+	}
+
+	if _, err := Load("", "play"); err == nil {
+		t.Error("Load accepted a profile that does not exist")
+	}
+}
+
+func TestLoad_ProjectCannotSelectProfile(t *testing.T) {
+	isolate(t)
+	project := t.TempDir()
+
+	userPath, _ := UserPath()
+	writeConfig(t, userPath, `{"profiles":{"work":{"provider":"anthropic"}}}`)
+	writeConfig(t, ProjectPath(project), `{"profile":"work","env":{"ANTHROPIC_BASE_URL":"http://example.com"},"tools":["*"]}`)
+
+	cfg, err := Load(project, "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Profile != "" || cfg.Provider != "" || cfg.Env != nil || cfg.Tools != nil {
+		t.Errorf("Load() = %+v, the project must not change the profile, env or tools", cfg)
+	}
+}
+
+func TestLoad_InvalidEnv(t *testing.T) {
+	for _, env := range []string{MaxTokensEnv, MaxTurnsEnv, MaxCostEnv, MaxTimeEnv} {
+		t.Run(env, func(t *testing.T) {
+			isolate(t)
+			t.Setenv(env, "many")
+
+			if _, err := Load("", ""); err == nil {
+				t.Errorf("Load accepted %s that is not a number", env)
+			}
+		})
+	}
+}
+
+func TestSetInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"provider":"google"}`)
+
+	if err := SetInFile(path, "", "approve", "bash, edit_file,"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile(path, "", "max_tokens", "1024"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile(path, "", "max_time", "10m"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile(path, "", "max_cost", "$0.50"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile(path, "", "update_check", "false"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+
+	// The env map holds API keys, a file written readable by others is tightened as well
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Config file mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+
+	cfg, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if cfg.Provider != "google" {
+		t.Errorf("Provider = %q, setting another key must keep it", cfg.Provider)
+	}
+	if got, _ := cfg.Get("approve"); got != "bash,edit_file" {
+		t.Errorf("Get(approve) = %q", got)
+	}
+	if got, _ := cfg.Get("max_tokens"); got != "1024" {
+		t.Errorf("Get(max_tokens) = %q", got)
+	}
+	if got, _ := cfg.Get("max_time"); got != "10m0s" {
+		t.Errorf("Get(max_time) = %q", got)
+	}
+	if got, _ := cfg.Get("max_cost"); got != "0.5" {
+		t.Errorf("Get(max_cost) = %q", got)
+	}
+	if cfg.UpdateChecks() {
+		t.Error("UpdateChecks() = true after turning update_check off")
+	}
+
+	// An empty value unsets
+	if err := SetInFile(path, "", "provider", ""); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if cfg, _ = ReadFile(path); cfg.Provider != "" {
+		t.Errorf("Provider = %q after unsetting", cfg.Provider)
+	}
+
+	for _, tc := range []struct{ key, value string }{
+		{"max_tokens", "-1"},
+		{"max_turns", "many"},
+		{"max_time", "10"},
+		{"update_check", "sometimes"},
+		{"telemetry", "maybe"},
+		{"mcp_servers", "x"},
+		{"bogus", "1"},
+	} {
+		if err := SetInFile(path, "", tc.key, tc.value); err == nil {
+			t.Errorf("SetInFile(%s, %q) succeeded", tc.key, tc.value)
+		}
+	}
+}
+
+func TestSetInFile_Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	if err := SetInFile(path, "work", "model", "claude-4-opus"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile(path, "", "model", "gemini-2.5-pro"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+
+	cfg, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if cfg.Model != "gemini-2.5-pro" || cfg.Profiles["work"].Model != "claude-4-opus" {
+		t.Errorf("ReadFile() = %+v, want the model set at the top and in the profile", cfg)
+	}
+
+	if err := SetInFile(path, "", "profile", "home"); err == nil {
+		t.Error("SetInFile selected a profile that does not exist")
+	}
+	if err := SetInFile(path, "", "profile", "work"); err != nil {
+		t.Errorf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile(path, "work", "profile", "home"); err == nil {
+		t.Error("SetInFile set a profile inside a profile")
+	}
+}
+
+func TestMergeMCPServers(t *testing.T) {
+	base := []mcp.ServerConfig{{ID: "a", Command: "one"}, {ID: "b", Command: "two"}}
+	other := []mcp.ServerConfig{{ID: "b", Command: "three"}, {ID: "c", Command: "four"}}
+
+	got := MergeMCPServers(base, other)
+	want := []mcp.ServerConfig{{ID: "a", Command: "one"}, {ID: "b", Command: "three"}, {ID: "c", Command: "four"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeMCPServers() = %+v, want %+v", got, want)
+	}
+	if base[1].Command != "two" {
+		t.Error("MergeMCPServers changed base")
+	}
+}
@@ -21,6 +21,9 @@ type AnthropicClient struct {
 	history      []anthropic.MessageParam
 	tools        []anthropic.ToolUnionParam
 	systemPrompt string
+	// Template of systemPrompt, nil when it was given as is
+	prompt    *promptTemplate
+	lastUsage Usage
 }
 
 func NewAnthropicClient(client *anthropic.Client, model ModelVersion, maxTokens int64, systemPrompt string) *AnthropicClient {
@@ -45,6 +48,10 @@ func (c *AnthropicClient) ModelName() string {
 	return c.BaseLLMClient.Model
 }
 
+func (c *AnthropicClient) LastUsage() Usage {
+	return c.lastUsage
+}
+
 func (c *AnthropicClient) SummarizeHistory(history []*message.Message, threshold int) []*message.Message {
 	return c.BaseLLMClient.BaseSummarizeHistory(history, threshold)
 }
@@ -117,20 +124,18 @@ func (c *AnthropicClient) runInferenceStream(ctx context.Context, params anthrop
 	for stream.Next() {
 		event := stream.Current()
 		if err := llmresp.Accumulate(event); err != nil {
-			fmt.Printf("error accumulating event: %v\n", err)
+			logger.Warn("failed to accumulate stream event", "err", err)
 			continue
 		}
 
 		switch ev := event.AsAny().(type) {
 		case anthropic.ContentBlockStartEvent:
 		case anthropic.ContentBlockStopEvent:
-			fmt.Println()
 		case anthropic.MessageStopEvent:
-			fmt.Println()
 		case anthropic.MessageStartEvent:
 		case anthropic.MessageDeltaEvent:
 		default:
-			fmt.Printf("Unhandled event type: %T\n", event)
+			logger.Debug("unhandled stream event", "type", fmt.Sprintf("%T", event))
 		case anthropic.ContentBlockDeltaEvent:
 			switch d := ev.Delta.AsAny().(type) {
 			case anthropic.TextDelta:
@@ -144,6 +149,8 @@ func (c *AnthropicClient) runInferenceStream(ctx context.Context, params anthrop
 		}
 	}
 
+	c.lastUsage = anthropicUsage(llmresp.Usage)
+
 	if streamErr := stream.Err(); streamErr != nil {
 		var sb strings.Builder
 		for _, blk := range llmresp.Content {
@@ -178,12 +185,23 @@ func (c *AnthropicClient) runInferenceStream(ctx context.Context, params anthrop
 	return msg, nil
 }
 
+// err with the kind of failure the status code of Anthropic's answer reports
+func anthropicError(err error) error {
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return providerError(apiErr.StatusCode, err)
+	}
+	return err
+}
+
 func (c *AnthropicClient) runInferenceSnapshot(ctx context.Context, params anthropic.MessageNewParams) (*message.Message, error) {
 	response, err := c.client.Messages.New(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("anthropic snapshot call failed: %w", err)
+		return nil, fmt.Errorf("anthropic snapshot call failed: %w", anthropicError(err))
 	}
 
+	c.lastUsage = anthropicUsage(response.Usage)
+
 	msg, err := toGenericMessage(*response)
 	if err != nil {
 		return nil, err
@@ -217,7 +235,8 @@ func (c *AnthropicClient) ToNativeMessage(msg *message.Message) error {
 	switch msg.Role {
 	case message.UserRole:
 		nativeMsg = anthropic.NewUserMessage(blocks...)
-	case message.AssistantRole:
+	// Messages written by Gemini use its model role
+	case message.AssistantRole, message.ModelRole:
 		nativeMsg = anthropic.NewAssistantMessage(blocks...)
 	default:
 		return errors.New("anthropic: invalid message role")
@@ -228,6 +247,14 @@ func (c *AnthropicClient) ToNativeMessage(msg *message.Message) error {
 }
 
 func (c *AnthropicClient) ToNativeTools(tools []*tools.ToolDefinition) error {
+	if c.prompt != nil {
+		sysPrompt, err := c.prompt.render(tools)
+		if err != nil {
+			return err
+		}
+		c.systemPrompt = sysPrompt
+	}
+
 	if len(tools) == 0 {
 		return nil
 	}
@@ -256,6 +283,8 @@ func toAnthropicBlocks(blocks []message.ContentBlock) []anthropic.ContentBlockPa
 			anthropicBlocks = append(anthropicBlocks, anthropic.NewToolResultBlock(b.ToolUseID, b.Content, b.IsError))
 		case message.TextBlock:
 			anthropicBlocks = append(anthropicBlocks, anthropic.NewTextBlock(b.Text))
+		case message.ImageBlock:
+			anthropicBlocks = append(anthropicBlocks, anthropic.NewImageBlockBase64(b.MediaType, b.Data))
 		case message.ToolUseBlock:
 			toolUseParam := anthropic.ToolUseBlockParam{
 				ID:    b.ID,
@@ -317,3 +346,12 @@ func toAnthropicTool(tool *tools.ToolDefinition) (anthropic.ToolUnionParam, erro
 		},
 	}, nil
 }
+
+func anthropicUsage(u anthropic.Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
@@ -2,6 +2,7 @@ package inference
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/honganh1206/tinker/message"
-	"github.com/honganh1206/tinker/prompts"
 	"github.com/honganh1206/tinker/schema"
 	"github.com/honganh1206/tinker/tools"
 	"google.golang.org/genai"
@@ -23,21 +23,21 @@ type GeminiClient struct {
 	contents     []*genai.Content
 	tools        []*genai.Tool
 	systemPrompt string
+	// Template of systemPrompt, nil when it was given as is
+	prompt    *promptTemplate
+	lastUsage Usage
 	// TODO: field for caching
 }
 
 func NewGeminiClient(client *genai.Client, model ModelVersion, maxTokens int64) *GeminiClient {
-	systemPrompt := prompts.GeminiSystemPrompt()
-
 	return &GeminiClient{
 		BaseLLMClient: BaseLLMClient{
 			Provider: GoogleModelName,
 			Model:    string(model),
 		},
-		client:       client,
-		model:        model,
-		maxTokens:    maxTokens,
-		systemPrompt: systemPrompt,
+		client:    client,
+		model:     model,
+		maxTokens: maxTokens,
 	}
 }
 
@@ -53,6 +53,10 @@ func getGeminiModelName(model ModelVersion) string {
 	return string(model)
 }
 
+func (c *GeminiClient) LastUsage() Usage {
+	return c.lastUsage
+}
+
 func (c *GeminiClient) SummarizeHistory(history []*message.Message, threshold int) []*message.Message {
 	return c.BaseLLMClient.BaseSummarizeHistory(history, threshold)
 }
@@ -108,7 +112,12 @@ func (c *GeminiClient) runInferenceStream(ctx context.Context, modelName string,
 		}
 
 		if err != nil {
-			return nil, err
+			return nil, geminiError(err)
+		}
+
+		// Only the last chunk carries the final counts, earlier ones are partial
+		if chunk.UsageMetadata != nil {
+			c.lastUsage = geminiUsage(chunk.UsageMetadata)
 		}
 
 		if len(chunk.Candidates) == 0 || chunk.Candidates[0].Content == nil {
@@ -179,10 +188,23 @@ func (c *GeminiClient) runInferenceStream(ctx context.Context, modelName string,
 	return msg, nil
 }
 
+// err with the kind of failure the status code of Gemini's answer reports
+func geminiError(err error) error {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return providerError(apiErr.Code, err)
+	}
+	return err
+}
+
 func (c *GeminiClient) runInferenceSnapshot(ctx context.Context, modelName string, config *genai.GenerateContentConfig) (*message.Message, error) {
 	response, err := c.client.Models.GenerateContent(ctx, modelName, c.contents, config)
 	if err != nil {
-		return nil, fmt.Errorf("gemini snapshot call failed: %w", err)
+		return nil, fmt.Errorf("gemini snapshot call failed: %w", geminiError(err))
+	}
+
+	if response.UsageMetadata != nil {
+		c.lastUsage = geminiUsage(response.UsageMetadata)
 	}
 
 	if len(response.Candidates) == 0 || response.Candidates[0].Content == nil {
@@ -264,8 +286,14 @@ func (c *GeminiClient) ToNativeMessage(msg *message.Message) error {
 		return errors.New("gemini: message has no content parts")
 	}
 
+	// Gemini only knows user and model, messages written by other providers use assistant
+	role := msg.Role
+	if role == message.AssistantRole {
+		role = message.ModelRole
+	}
+
 	content := &genai.Content{
-		Role:  msg.Role,
+		Role:  role,
 		Parts: parts,
 	}
 
@@ -278,6 +306,14 @@ func (c *GeminiClient) ToNativeTools(tools []*tools.ToolDefinition) error {
 		return errors.New("gemini: no tools provided")
 	}
 
+	if c.prompt != nil {
+		sysPrompt, err := c.prompt.render(tools)
+		if err != nil {
+			return err
+		}
+		c.systemPrompt = sysPrompt
+	}
+
 	builtinTool := &genai.Tool{
 		FunctionDeclarations: make([]*genai.FunctionDeclaration, 0, len(tools)),
 	}
@@ -304,6 +340,12 @@ func toGeminiParts(blocks []message.ContentBlock) []*genai.Part {
 			if b.Text != "" {
 				parts = append(parts, genai.NewPartFromText(b.Text))
 			}
+		case message.ImageBlock:
+			data, err := base64.StdEncoding.DecodeString(b.Data)
+			if err != nil {
+				continue
+			}
+			parts = append(parts, genai.NewPartFromBytes(data, b.MediaType))
 		case message.ToolUseBlock:
 			var args map[string]any
 
@@ -347,3 +389,11 @@ func toGeminiFunctionDeclaration(tool *tools.ToolDefinition) (*genai.FunctionDec
 
 	return functionDecl, nil
 }
+
+func geminiUsage(m *genai.GenerateContentResponseUsageMetadata) Usage {
+	return Usage{
+		InputTokens:     int64(m.PromptTokenCount),
+		OutputTokens:    int64(m.CandidatesTokenCount),
+		CacheReadTokens: int64(m.CachedContentTokenCount),
+	}
+}
@@ -3,16 +3,21 @@ package inference
 import (
 	"context"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/honganh1206/tinker/message"
 	"github.com/honganh1206/tinker/prompts"
+	"github.com/honganh1206/tinker/tinkererr"
 	"github.com/honganh1206/tinker/tools"
+	"github.com/honganh1206/tinker/utils"
 	"google.golang.org/genai"
 )
 
+var logger = utils.Logger("inference")
+
 type LLMClient interface {
 	// TODO: This still needs some rewrites.
 	// We must separate RunInference into 2 signatures: One for snapshot and one for streaming.
@@ -30,27 +35,99 @@ type LLMClient interface {
 	ToNativeTools(tools []*tools.ToolDefinition) error
 }
 
+// Token counts of a single inference call
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	// Prompt tokens read from and written to the provider's prompt cache.
+	// Anthropic counts them apart from InputTokens, Gemini within
+	CacheReadTokens  int64 `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int64 `json:"cache_write_tokens,omitempty"`
+}
+
+// UsageReporter is implemented by clients that can tell how many tokens their last call used
+type UsageReporter interface {
+	LastUsage() Usage
+}
+
 type BaseLLMClient struct {
 	Provider   string
 	Model      string
 	TokenLimit int64
+	// Directories the agent may work in besides the working directory, absolute
+	Dirs []string
+}
+
+// Tag err, an error the provider answered with statusCode, with the kind of failure it reports
+func providerError(statusCode int, err error) error {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return tinkererr.Wrap(tinkererr.RateLimited, err)
+	// Anthropic answers 529 when it is overloaded
+	case http.StatusServiceUnavailable, 529:
+		return tinkererr.Wrap(tinkererr.ProviderOverloaded, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return tinkererr.Wrap(tinkererr.PermissionDenied, err)
+	default:
+		return err
+	}
+}
+
+// System prompt template of a client, rendered again whenever the tools offered to the model change
+type promptTemplate struct {
+	prompt *prompts.Prompt
+	data   prompts.Data
+}
+
+// Template of the prompt called name along with its text before any tools are offered.
+// Rendering it here reports a broken override before the first request does
+func newPromptTemplate(name string, dirs []string) (*promptTemplate, string, error) {
+	prompt, err := prompts.Load(name)
+	if err != nil {
+		return nil, "", err
+	}
+	t := &promptTemplate{prompt: prompt, data: prompts.NewData(dirs)}
+	text, err := t.render(nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, text, nil
+}
+
+func (t *promptTemplate) render(offered []*tools.ToolDefinition) (string, error) {
+	data := t.data
+	for _, tool := range offered {
+		data.Tools = append(data.Tools, tool.Name)
+	}
+	return t.prompt.Render(data)
 }
 
 func Init(ctx context.Context, llm BaseLLMClient) (LLMClient, error) {
 	switch llm.Provider {
 	case AnthropicProvider:
+		prompt, sysPrompt, err := newPromptTemplate(prompts.Claude, llm.Dirs)
+		if err != nil {
+			return nil, err
+		}
 		client := anthropic.NewClient() // Default to look up ANTHROPIC_API_KEY
-		sysPrompt := prompts.ClaudeSystemPrompt()
-		return NewAnthropicClient(&client, ModelVersion(llm.Model), llm.TokenLimit, sysPrompt), nil
+		anthropicClient := NewAnthropicClient(&client, ModelVersion(llm.Model), llm.TokenLimit, sysPrompt)
+		anthropicClient.prompt = prompt
+		return anthropicClient, nil
 	case GoogleProvider:
+		prompt, sysPrompt, err := newPromptTemplate(prompts.Gemini, llm.Dirs)
+		if err != nil {
+			return nil, err
+		}
 		client, err := genai.NewClient(ctx, &genai.ClientConfig{
 			APIKey:  os.Getenv("GOOGLE_API_KEY"),
 			Backend: genai.BackendGeminiAPI,
 		})
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("failed to create gemini client: %w", err)
 		}
-		return NewGeminiClient(client, ModelVersion(llm.Model), llm.TokenLimit), nil
+		gemini := NewGeminiClient(client, ModelVersion(llm.Model), llm.TokenLimit)
+		gemini.systemPrompt, gemini.prompt = sysPrompt, prompt
+		return gemini, nil
 	default:
 		return nil, fmt.Errorf("unknown model provider: %s", llm.Provider)
 	}
@@ -94,6 +171,24 @@ func GetDefaultModel(provider ProviderName) ModelVersion {
 	}
 }
 
+// Provider serving model, told by its name. Empty for custom names
+func ProviderForModel(model string) ProviderName {
+	switch {
+	case strings.HasPrefix(model, "claude"):
+		return AnthropicProvider
+	case strings.HasPrefix(model, "gemini"):
+		return GoogleProvider
+	default:
+		return ""
+	}
+}
+
+// Whether model takes images as input. Every Claude 3+ and Gemini model does,
+// custom names are not assumed to
+func SupportsImages(model string) bool {
+	return ProviderForModel(model) != ""
+}
+
 func GetDefaultModelSubagent(provider ProviderName) ModelVersion {
 	switch provider {
 	case AnthropicProvider:
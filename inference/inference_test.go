@@ -2,6 +2,9 @@ package inference
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"testing"
 
@@ -9,6 +12,8 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/tinkererr"
+	"google.golang.org/genai"
 )
 
 // Mock implementations for testing
@@ -68,16 +73,8 @@ func createTestMessages(count int) []*message.Message {
 // Tests
 
 func TestInit_GoogleProvider_MissingAPIKey(t *testing.T) {
-	t.Skip("Skipping test that causes log.Fatal - needs proper error handling implementation")
-
-	// Ensure GEMINI_API_KEY is not set
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Unsetenv("GEMINI_API_KEY")
-	defer func() {
-		if originalKey != "" {
-			os.Setenv("GEMINI_API_KEY", originalKey)
-		}
-	}()
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "")
 
 	llm := BaseLLMClient{
 		Provider:   GoogleProvider,
@@ -87,12 +84,8 @@ func TestInit_GoogleProvider_MissingAPIKey(t *testing.T) {
 
 	client, err := Init(context.Background(), llm)
 
-	// The function calls log.Fatal which exits the program,
-	// but in tests we can't easily test this behavior without modifying the code
-	// For now, we'll skip this test or expect it to return an error
-	// This test might need to be adjusted based on how we want to handle missing API keys
-	_ = client
-	_ = err
+	assert.Error(t, err)
+	assert.Nil(t, client)
 }
 
 func TestInit_UnknownProvider(t *testing.T) {
@@ -300,3 +293,96 @@ func TestBaseLLMClient_BaseTruncateMessage_ExactThresholdLength(t *testing.T) {
 	toolResult := result.Content[0].(message.ToolResultBlock)
 	assert.Equal(t, content, toolResult.Content) // Should not be truncated
 }
+
+func TestToNativeHistory_OtherProviderRoles(t *testing.T) {
+	history := []*message.Message{
+		createTestMessage(message.UserRole, "Hello"),
+		createTestMessage(message.ModelRole, "Written by Gemini"),
+		createTestMessage(message.UserRole, "Thanks"),
+		createTestMessage(message.AssistantRole, "Written by Claude"),
+	}
+
+	anthropicClient := NewAnthropicClient(nil, Claude4Sonnet, 1024, "")
+	assert.NoError(t, anthropicClient.ToNativeHistory(history))
+	assert.Len(t, anthropicClient.history, len(history))
+
+	geminiClient := NewGeminiClient(nil, Gemini25Flash, 1024)
+	assert.NoError(t, geminiClient.ToNativeHistory(history))
+	for _, content := range geminiClient.contents {
+		assert.Contains(t, []string{message.UserRole, message.ModelRole}, content.Role)
+	}
+}
+
+func TestToNativeHistory_Images(t *testing.T) {
+	history := []*message.Message{{
+		Role: message.UserRole,
+		Content: []message.ContentBlock{
+			message.NewTextBlock("What is in this picture?"),
+			message.NewImageBlock("image/png", []byte("\x89PNG"), "shot.png"),
+		},
+	}}
+
+	anthropicClient := NewAnthropicClient(nil, Claude4Sonnet, 1024, "")
+	assert.NoError(t, anthropicClient.ToNativeHistory(history))
+	assert.Len(t, anthropicClient.history[0].Content, 2)
+	assert.NotNil(t, anthropicClient.history[0].Content[1].OfImage)
+
+	geminiClient := NewGeminiClient(nil, Gemini25Flash, 1024)
+	assert.NoError(t, geminiClient.ToNativeHistory(history))
+	parts := geminiClient.contents[0].Parts
+	assert.Len(t, parts, 2)
+	assert.Equal(t, []byte("\x89PNG"), parts[1].InlineData.Data)
+	assert.Equal(t, "image/png", parts[1].InlineData.MIMEType)
+}
+
+func TestSupportsImages(t *testing.T) {
+	assert.True(t, SupportsImages(string(Claude45Sonnet)))
+	assert.True(t, SupportsImages(string(Gemini25Flash)))
+	assert.False(t, SupportsImages("my-finetune"))
+}
+
+func TestProviderForModel(t *testing.T) {
+	assert.Equal(t, ProviderName(AnthropicProvider), ProviderForModel(string(Claude4Sonnet)))
+	assert.Equal(t, ProviderName(GoogleProvider), ProviderForModel(string(Gemini25Pro)))
+	assert.Equal(t, ProviderName(""), ProviderForModel("my-finetune"))
+}
+
+func TestPricing_Cost(t *testing.T) {
+	p, ok := PricingFor(string(Claude45Sonnet))
+	assert.True(t, ok)
+	assert.InDelta(t, 0.018, p.Cost(Usage{InputTokens: 1000, OutputTokens: 1000}), 1e-9)
+
+	_, ok = PricingFor("my-finetune")
+	assert.False(t, ok)
+}
+
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, int64(200_000), ContextWindow(string(Claude45Opus)))
+	assert.Equal(t, int64(200_000), ContextWindow("claude-future"))
+	assert.Equal(t, int64(1024*1024), ContextWindow(string(Gemini25Pro)))
+	assert.Equal(t, int64(0), ContextWindow("my-finetune"))
+}
+
+func TestProviderError(t *testing.T) {
+	base := errors.New("request failed")
+
+	tests := []struct {
+		status int
+		kind   tinkererr.Kind
+	}{
+		{http.StatusTooManyRequests, tinkererr.RateLimited},
+		{529, tinkererr.ProviderOverloaded},
+		{http.StatusServiceUnavailable, tinkererr.ProviderOverloaded},
+		{http.StatusUnauthorized, tinkererr.PermissionDenied},
+		{http.StatusBadRequest, tinkererr.Unknown},
+	}
+
+	for _, tt := range tests {
+		err := providerError(tt.status, base)
+		assert.Equal(t, tt.kind, tinkererr.KindOf(err), "status %d", tt.status)
+		assert.ErrorIs(t, err, base)
+	}
+
+	gemini := geminiError(fmt.Errorf("stream: %w", genai.APIError{Code: http.StatusTooManyRequests}))
+	assert.ErrorIs(t, gemini, tinkererr.RateLimited)
+}
@@ -0,0 +1,56 @@
+package inference
+
+// Price of a model in USD per million tokens, at the base tier
+type Pricing struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+var pricing = map[ModelVersion]Pricing{
+	Claude45Opus:   {InputPerMTok: 5, OutputPerMTok: 25},
+	Claude41Opus:   {InputPerMTok: 15, OutputPerMTok: 75},
+	Claude4Opus:    {InputPerMTok: 15, OutputPerMTok: 75},
+	Claude3Opus:    {InputPerMTok: 15, OutputPerMTok: 75},
+	Claude45Sonnet: {InputPerMTok: 3, OutputPerMTok: 15},
+	Claude4Sonnet:  {InputPerMTok: 3, OutputPerMTok: 15},
+	Claude35Sonnet: {InputPerMTok: 3, OutputPerMTok: 15},
+	Claude3Sonnet:  {InputPerMTok: 3, OutputPerMTok: 15},
+	Claude45Haiku:  {InputPerMTok: 1, OutputPerMTok: 5},
+	Claude35Haiku:  {InputPerMTok: 0.8, OutputPerMTok: 4},
+	Claude3Haiku:   {InputPerMTok: 0.25, OutputPerMTok: 1.25},
+
+	// Prompts past 200k tokens (128k for 1.5) cost more, which is not accounted for
+	Gemini3Pro:        {InputPerMTok: 2, OutputPerMTok: 12},
+	Gemini25Pro:       {InputPerMTok: 1.25, OutputPerMTok: 10},
+	Gemini25Flash:     {InputPerMTok: 0.3, OutputPerMTok: 2.5},
+	Gemini20Flash:     {InputPerMTok: 0.1, OutputPerMTok: 0.4},
+	Gemini20FlashLite: {InputPerMTok: 0.075, OutputPerMTok: 0.3},
+	Gemini15Pro:       {InputPerMTok: 1.25, OutputPerMTok: 5},
+	Gemini15Flash:     {InputPerMTok: 0.075, OutputPerMTok: 0.3},
+}
+
+// False for custom model names, whose price is unknown
+func PricingFor(model string) (Pricing, bool) {
+	p, ok := pricing[ModelVersion(model)]
+	return p, ok
+}
+
+// Cost of a call in USD
+func (p Pricing) Cost(u Usage) float64 {
+	return (float64(u.InputTokens)*p.InputPerMTok + float64(u.OutputTokens)*p.OutputPerMTok) / 1e6
+}
+
+// Tokens the model can take in a single call, 0 when unknown
+func ContextWindow(model string) int64 {
+	switch ModelVersion(model) {
+	case Gemini15Pro:
+		return 2 * 1024 * 1024
+	case Gemini3Pro, Gemini25Pro, Gemini25Flash, Gemini20Flash, Gemini20FlashLite, Gemini15Flash:
+		return 1024 * 1024
+	}
+
+	if ProviderForModel(model) == AnthropicProvider {
+		return 200_000
+	}
+	return 0
+}
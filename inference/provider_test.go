@@ -0,0 +1,149 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+
+	"github.com/honganh1206/tinker/inference/vcr"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/tinkererr"
+	"github.com/honganh1206/tinker/tools"
+)
+
+// Provider traffic of testdata/name.json, recorded again when vcr.RecordEnv is set
+func startCassette(t *testing.T, name string) *vcr.Recorder {
+	t.Helper()
+	rec, err := vcr.New(filepath.Join("testdata", name+".json"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if err := rec.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return rec
+}
+
+// API key for the provider, a placeholder when playing back
+func cassetteKey(rec *vcr.Recorder, env string) string {
+	if rec.Recording() {
+		return os.Getenv(env)
+	}
+	return "replay"
+}
+
+func newCassetteAnthropicClient(t *testing.T, name string) *AnthropicClient {
+	t.Helper()
+	rec := startCassette(t, name)
+	client := anthropic.NewClient(
+		option.WithHTTPClient(rec.Client()),
+		option.WithAPIKey(cassetteKey(rec, "ANTHROPIC_API_KEY")),
+		// Retries would send requests the cassette does not have
+		option.WithMaxRetries(0),
+	)
+	return NewAnthropicClient(&client, Claude4Sonnet, 1024, "You are a helpful assistant.")
+}
+
+func newCassetteGeminiClient(t *testing.T, name string) *GeminiClient {
+	t.Helper()
+	rec := startCassette(t, name)
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:     cassetteKey(rec, "GOOGLE_API_KEY"),
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: rec.Client(),
+	})
+	require.NoError(t, err)
+	gemini := NewGeminiClient(client, Gemini25Flash, 1024)
+	gemini.systemPrompt = "You are a helpful assistant."
+	return gemini
+}
+
+func userMessage(text string) *message.Message {
+	return &message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(text)}}
+}
+
+func TestAnthropicClient_Snapshot(t *testing.T) {
+	client := newCassetteAnthropicClient(t, "anthropic_snapshot")
+	require.NoError(t, client.ToNativeTools([]*tools.ToolDefinition{&tools.ReadFileDefinition}))
+	require.NoError(t, client.ToNativeMessage(userMessage("What is in notes.txt?")))
+
+	msg, err := client.RunInference(context.Background(), func(string) {}, false)
+	require.NoError(t, err)
+
+	require.Len(t, msg.Content, 2)
+	assert.Equal(t, message.NewTextBlock("Let me read it."), msg.Content[0])
+	call, ok := msg.Content[1].(message.ToolUseBlock)
+	require.True(t, ok, "second block is %T, want a tool call", msg.Content[1])
+	assert.Equal(t, "toolu_01", call.ID)
+	assert.Equal(t, "read_file", call.Name)
+	assert.JSONEq(t, `{"path":"notes.txt"}`, string(call.Input))
+
+	assert.Equal(t, Usage{InputTokens: 120, OutputTokens: 30, CacheReadTokens: 80}, client.LastUsage())
+}
+
+func TestAnthropicClient_Stream(t *testing.T) {
+	client := newCassetteAnthropicClient(t, "anthropic_stream")
+	require.NoError(t, client.ToNativeMessage(userMessage("Say hello")))
+
+	var deltas strings.Builder
+	msg, err := client.RunInference(context.Background(), func(delta string) {
+		deltas.WriteString(delta)
+	}, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello there!", deltas.String())
+	assert.Equal(t, []message.ContentBlock{message.NewTextBlock("Hello there!")}, msg.Content)
+	assert.Equal(t, int64(25), client.LastUsage().InputTokens)
+	assert.Equal(t, int64(5), client.LastUsage().OutputTokens)
+}
+
+func TestAnthropicClient_Overloaded(t *testing.T) {
+	client := newCassetteAnthropicClient(t, "anthropic_overloaded")
+	require.NoError(t, client.ToNativeMessage(userMessage("Say hello")))
+
+	_, err := client.RunInference(context.Background(), func(string) {}, false)
+	assert.ErrorIs(t, err, tinkererr.ProviderOverloaded)
+}
+
+func TestGeminiClient_Snapshot(t *testing.T) {
+	client := newCassetteGeminiClient(t, "gemini_snapshot")
+	require.NoError(t, client.ToNativeTools([]*tools.ToolDefinition{&tools.ReadFileDefinition}))
+	require.NoError(t, client.ToNativeMessage(userMessage("What is in notes.txt?")))
+
+	msg, err := client.RunInference(context.Background(), func(string) {}, false)
+	require.NoError(t, err)
+
+	require.Len(t, msg.Content, 1)
+	call, ok := msg.Content[0].(message.ToolUseBlock)
+	require.True(t, ok, "block is %T, want a tool call", msg.Content[0])
+	assert.Equal(t, "read_file", call.Name)
+	var input map[string]string
+	require.NoError(t, json.Unmarshal(call.Input, &input))
+	assert.Equal(t, "notes.txt", input["path"])
+
+	assert.Equal(t, int64(50), client.LastUsage().InputTokens)
+}
+
+func TestGeminiClient_Stream(t *testing.T) {
+	client := newCassetteGeminiClient(t, "gemini_stream")
+	require.NoError(t, client.ToNativeMessage(userMessage("Say hello")))
+
+	var deltas strings.Builder
+	msg, err := client.RunInference(context.Background(), func(delta string) {
+		deltas.WriteString(delta)
+	}, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello there!", deltas.String())
+	assert.Equal(t, []message.ContentBlock{message.NewTextBlock("Hello there!")}, msg.Content)
+	assert.Equal(t, int64(20), client.LastUsage().InputTokens)
+}
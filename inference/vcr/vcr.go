@@ -0,0 +1,191 @@
+// Package vcr records the HTTP traffic of provider clients to a cassette file and plays it back,
+// so tests of inference and the agent run the same way every time, without API keys or a network
+package vcr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Set to record the cassettes again against the real providers, with their API keys in the environment
+const RecordEnv = "TINKER_RECORD"
+
+// A request came in that the cassette does not have next
+var ErrUnexpectedRequest = errors.New("request not in the cassette")
+
+// Requests and responses in the order they were sent
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Headers and the query are left out, they are where API keys go
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// For reading the cassette, playing back does not compare it
+	Body string `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	// Server-sent events of streaming responses included
+	Body string `json:"body"`
+}
+
+// An http.RoundTripper answering with the responses of a cassette, matched by method and path
+// in the order they were recorded. While recording, requests go to the provider and the cassette
+// is written on Stop
+type Recorder struct {
+	path      string
+	recording bool
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	// Index of the interaction to play back next
+	next int
+}
+
+// Recorder of the cassette at path, played back unless RecordEnv is set
+func New(path string) (*Recorder, error) {
+	r := &Recorder{path: path, transport: http.DefaultTransport}
+	if os.Getenv(RecordEnv) != "" {
+		r.recording = true
+		return r, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette, record it with %s=1: %w", RecordEnv, err)
+	}
+	if err := json.Unmarshal(raw, &r.cassette); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// HTTP client going through the recorder, for the provider SDKs to use
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) Recording() bool {
+	return r.recording
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.recording {
+		return r.record(req)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.cassette.Interactions) {
+		return nil, fmt.Errorf("%w: %s %s after all %d interactions", ErrUnexpectedRequest, req.Method, req.URL.Path, len(r.cassette.Interactions))
+	}
+	want := r.cassette.Interactions[r.next]
+	if want.Request.Method != req.Method || want.Request.Path != req.URL.Path {
+		return nil, fmt.Errorf("%w: %s %s, interaction %d is %s %s", ErrUnexpectedRequest, req.Method, req.URL.Path, r.next, want.Request.Method, want.Request.Path)
+	}
+	r.next++
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return newResponse(req, want.Response), nil
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read whole, streaming responses are played back at once
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := Response{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(respBody),
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  Request{Method: req.Method, Path: req.URL.Path, Body: string(body)},
+		Response: recorded,
+	})
+	r.mu.Unlock()
+
+	return newResponse(req, recorded), nil
+}
+
+// Write the cassette when recording. When playing back, fail if some interactions were not,
+// the code under test sent fewer requests than it did when they were recorded
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recording {
+		if r.next < len(r.cassette.Interactions) {
+			return fmt.Errorf("cassette %s: %d of %d interactions were not played back", r.path, len(r.cassette.Interactions)-r.next, len(r.cassette.Interactions))
+		}
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(raw, '\n'), 0o644)
+}
+
+func newResponse(req *http.Request, recorded Response) *http.Response {
+	header := make(http.Header)
+	if recorded.ContentType != "" {
+		header.Set("Content-Type", recorded.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
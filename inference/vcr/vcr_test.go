@@ -0,0 +1,86 @@
+package vcr
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(t *testing.T, client *http.Client, url, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("X-Api-Key", "secret-key")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(raw)
+}
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "echo "+string(body))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	t.Setenv(RecordEnv, "1")
+	rec, err := New(path)
+	require.NoError(t, err)
+	status, body := post(t, rec.Client(), server.URL+"/v1/messages?key=secret-key", "hello")
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "echo hello", body)
+	require.NoError(t, rec.Stop())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "secret-key")
+
+	// Played back with the provider gone
+	server.Close()
+	t.Setenv(RecordEnv, "")
+	rec, err = New(path)
+	require.NoError(t, err)
+	status, body = post(t, rec.Client(), "https://api.example.com/v1/messages", "hello")
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "echo hello", body)
+	assert.NoError(t, rec.Stop())
+}
+
+func TestRecorder_Unexpected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"interactions": [
+		{"request": {"method": "POST", "path": "/v1/messages"}, "response": {"status": 200, "body": "{}"}},
+		{"request": {"method": "POST", "path": "/v1/messages"}, "response": {"status": 200, "body": "{}"}}
+	]}`), 0o644))
+
+	rec, err := New(path)
+	require.NoError(t, err)
+
+	_, err = rec.Client().Get("https://api.example.com/v1/models")
+	assert.ErrorIs(t, err, ErrUnexpectedRequest)
+
+	post(t, rec.Client(), "https://api.example.com/v1/messages", "{}")
+	// The second interaction was never asked for
+	assert.Error(t, rec.Stop())
+}
+
+func TestNew_MissingCassette(t *testing.T) {
+	t.Setenv(RecordEnv, "")
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, RecordEnv)
+}
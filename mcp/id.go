@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ID is a JSON-RPC request ID, either an integer or a string.
+// The zero value is the null ID, used by notifications and by errors the server could not attribute.
+// IDs are comparable, so they can be used as map keys:
+// the number 1 and the string "1" are different IDs, as the spec requires
+type ID struct {
+	num   int64
+	str   string
+	isStr bool
+	valid bool
+}
+
+func NumberID(n int64) ID {
+	return ID{num: n, valid: true}
+}
+
+func StringID(s string) ID {
+	return ID{str: s, isStr: true, valid: true}
+}
+
+// Report whether the ID is non-null
+func (id ID) IsValid() bool {
+	return id.valid
+}
+
+func (id ID) String() string {
+	switch {
+	case !id.valid:
+		return "null"
+	case id.isStr:
+		return strconv.Quote(id.str)
+	default:
+		return strconv.FormatInt(id.num, 10)
+	}
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	switch {
+	case !id.valid:
+		return []byte("null"), nil
+	case id.isStr:
+		return json.Marshal(id.str)
+	default:
+		return []byte(strconv.FormatInt(id.num, 10)), nil
+	}
+}
+
+// Accept integers and strings only. Fractional numbers are rejected
+// instead of being truncated into an ID that matches the wrong request
+func (id *ID) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+
+	if bytes.Equal(b, []byte("null")) {
+		*id = ID{}
+		return nil
+	}
+
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return fmt.Errorf("jsonrpc: invalid string ID %s: %w", b, err)
+		}
+		*id = StringID(s)
+		return nil
+	}
+
+	raw := string(b)
+	if strings.ContainsAny(raw, ".eE") {
+		return fmt.Errorf("jsonrpc: ID must be an integer or a string, got %s", raw)
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return fmt.Errorf("jsonrpc: ID must be an integer or a string, got %s", raw)
+	}
+
+	*id = NumberID(n)
+	return nil
+}
+
+// MismatchedIDError reports a response whose ID matches no request waiting for it,
+// e.g., a late reply to a cancelled call or a server echoing the ID with the wrong type
+type MismatchedIDError struct {
+	ID ID
+	// IDs that were expected instead, if known e.g., the requests of a batch
+	Expected []ID
+}
+
+func (e *MismatchedIDError) Error() string {
+	if len(e.Expected) == 0 {
+		return fmt.Sprintf("jsonrpc: response ID %s matches no pending request", e.ID)
+	}
+
+	expected := make([]string, len(e.Expected))
+	for i, id := range e.Expected {
+		expected[i] = id.String()
+	}
+
+	return fmt.Sprintf("jsonrpc: response ID %s matches no pending request (expected one of %s)", e.ID, strings.Join(expected, ", "))
+}
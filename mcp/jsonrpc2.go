@@ -1,16 +1,18 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"sync"
+	"time"
 )
 
 type Client struct {
 	transport Transport
-	nextID    uint64
+	nextID    int64
 	// Thread-safe request ID generation
 	idMu sync.Mutex
 
@@ -18,7 +20,7 @@ type Client struct {
 	notiMu       sync.Mutex
 
 	// Map responses to calls from client
-	pendingCalls   map[any]chan *Response
+	pendingCalls   map[ID]chan *Response
 	pendingCallsMu sync.Mutex
 
 	// Lifecycle management for listener goroutine
@@ -35,7 +37,7 @@ func NewClient(transport Transport) *Client {
 		nextID:    1, // Start from 1
 		// Mutexes are zero-value when constructed i.e., unlocked state
 		notiHandlers: make(map[string]func(params *json.RawMessage) error),
-		pendingCalls: make(map[any]chan *Response),
+		pendingCalls: make(map[ID]chan *Response),
 		ctx:          ctx,
 		cancel:       cancel,
 	}
@@ -59,22 +61,19 @@ type IncomingMessage struct {
 	JSONRPC string           `json:"jsonrpc"`
 	Method  string           `json:"method,omitempty"` // Present in requests/notifications
 	Params  *json.RawMessage `json:"params,omitempty"` // Present in requests/notifications
-	ID      any              `json:"id,omitempty"`     // Present in requests and responses (even if null for some responses)
+	ID      *ID              `json:"id,omitempty"`     // Present in requests and responses, nil if absent or null
 	Result  *json.RawMessage `json:"result,omitempty"` // Present in successful responses
 	Error   *Error           `json:"error,omitempty"`  // Present in error responses
 }
 
 // Make RPC calls and handle responses
 func (c *Client) Call(ctx context.Context, args *ClientCallArgs, resultDest any) error {
-	c.idMu.Lock()
-	currentID := c.nextID
-	c.nextID++
-	c.idMu.Unlock()
+	currentID := c.newID()
 
 	reqArgs := &RequestArgs{
 		Method: args.Method,
 		Params: args.Params,
-		ID:     currentID,
+		ID:     &currentID,
 	}
 
 	reqBytes, err := FormatRequest(reqArgs)
@@ -112,6 +111,7 @@ func (c *Client) Call(ctx context.Context, args *ClientCallArgs, resultDest any)
 
 	select {
 	case <-ctx.Done(): // Context for this specific call
+		c.notifyCancelled(currentID, args.Method, ctx.Err())
 		return fmt.Errorf("jsonrpc: call timed out or was cancelled: %w", ctx.Err())
 	case <-c.ctx.Done(): // Client's main context, indicates listener might be shutting down
 		return fmt.Errorf("jsonrpc: client is closing: %w", c.ctx.Err())
@@ -119,27 +119,117 @@ func (c *Client) Call(ctx context.Context, args *ClientCallArgs, resultDest any)
 		if resp == nil {
 			// Listen loop might close the channel during shutdown
 			// without sending a response
-			return fmt.Errorf("jsonrpc: call for ID %v aborted due to client shutdown or an issue in listener", currentID)
+			return fmt.Errorf("jsonrpc: call for ID %s aborted due to client shutdown or an issue in listener", currentID)
+		}
+
+		return decodeResponse(resp, resultDest)
+	}
+}
+
+func (c *Client) newID() ID {
+	c.idMu.Lock()
+	defer c.idMu.Unlock()
+
+	id := NumberID(c.nextID)
+	c.nextID++
+	return id
+}
+
+func decodeResponse(resp *Response, resultDest any) error {
+	if resp.Error != nil {
+		return fmt.Errorf("jsonrpc: server error (code: %d): %s", resp.Error.Code, resp.Error.Message)
+	}
+
+	if resultDest != nil && resp.Result != nil {
+		if err := json.Unmarshal(*resp.Result, resultDest); err != nil {
+			return fmt.Errorf("jsonrpc: failed to unmarshal result: %w", err)
 		}
+	}
 
-		if resp.Error != nil {
-			return fmt.Errorf("jsonrpc: server error (code: %d): %s", resp.Error.Code, resp.Error.Message)
+	return nil
+}
+
+// One request of a batch. The result is decoded into Result
+// and the outcome of this request alone is stored in Err
+type BatchCall struct {
+	Method string
+	Params any
+	Result any
+	Err    error
+}
+
+// Send several requests as a single JSON-RPC batch and wait for all of their responses.
+// The server may answer them in any order, they are matched back by ID.
+// The returned error covers the batch as a whole, failures of single requests are in their Err
+func (c *Client) CallBatch(ctx context.Context, calls []*BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	reqs := make([]Request, len(calls))
+	ids := make([]ID, len(calls))
+	chans := make([]chan *Response, len(calls))
+
+	for i, call := range calls {
+		ids[i] = c.newID()
+		chans[i] = make(chan *Response, 1)
+		reqs[i] = Request{
+			JSONRPC: jsonrpcver,
+			Method:  call.Method,
+			Params:  call.Params,
+			ID:      &ids[i],
 		}
+	}
+
+	reqBytes, err := json.Marshal(reqs)
+	if err != nil {
+		return fmt.Errorf("jsonrpc: failed to format batch: %w", err)
+	}
 
-		if resp.Result == nil && resultDest != nil {
-			// The caller expects a value?
-			// resultDest remains unchanged here?
-			return nil
+	c.pendingCallsMu.Lock()
+	select {
+	case <-c.ctx.Done():
+		c.pendingCallsMu.Unlock()
+		return fmt.Errorf("jsonrpc: client is closed: %w", c.ctx.Err())
+	default:
+	}
+	for i, id := range ids {
+		c.pendingCalls[id] = chans[i]
+	}
+	c.pendingCallsMu.Unlock()
+
+	defer func() {
+		c.pendingCallsMu.Lock()
+		for _, id := range ids {
+			delete(c.pendingCalls, id)
 		}
+		c.pendingCallsMu.Unlock()
+	}()
 
-		if resultDest != nil && resp.Result != nil {
-			if err := json.Unmarshal(*resp.Result, resultDest); err != nil {
-				return fmt.Errorf("jsonrpc: failed to unmarshal result: %w", err)
+	if err := c.transport.Send(ctx, reqBytes); err != nil {
+		return fmt.Errorf("jsonrpc: transport failed to send batch: %w", err)
+	}
+
+	for i, call := range calls {
+		select {
+		case <-ctx.Done():
+			for j := i; j < len(calls); j++ {
+				calls[j].Err = fmt.Errorf("jsonrpc: no response for ID %s: %w", ids[j], ctx.Err())
+				c.notifyCancelled(ids[j], calls[j].Method, ctx.Err())
 			}
+			return fmt.Errorf("jsonrpc: batch timed out or was cancelled: %w", ctx.Err())
+		case <-c.ctx.Done():
+			return fmt.Errorf("jsonrpc: client is closing: %w", c.ctx.Err())
+		case resp := <-chans[i]:
+			if resp == nil {
+				call.Err = fmt.Errorf("jsonrpc: call for ID %s aborted due to client shutdown or an issue in listener", ids[i])
+				continue
+			}
+			call.Err = decodeResponse(resp, call.Result)
 		}
 	}
-	return nil
 
+	return nil
 }
 
 // Register a handler function for a given server notification method.
@@ -173,15 +263,32 @@ func (c *Client) Notify(ctx context.Context, args *ClientNotifyArgs) error {
 	return nil
 }
 
+// Let the server know an abandoned request can be dropped, so it stops working on it.
+// Best effort, the server may not support cancellation at all
+func (c *Client) notifyCancelled(id ID, method string, reason error) {
+	// Per MCP, the initialize request must never be cancelled
+	if method == "initialize" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, time.Second)
+	defer cancel()
+
+	_ = c.Notify(ctx, &ClientNotifyArgs{
+		Method: "notifications/cancelled",
+		Params: map[string]any{
+			"requestId": id,
+			"reason":    reason.Error(),
+		},
+	})
+}
+
 // Start the client's message processing loop.
 // This method will block until the client's context is canceled (e.g., by calling Close)
 // or an unrecoverable error occurs in the transport's Receive method.
 // All server-to-client notifications and responses to client calls are processed here.
-// This method should typically be called in a separate goroutine to avoid blocking the caller.
+// Start it with Go rather than in a goroutine of your own, Close only waits for a listener started that way.
 func (c *Client) Listen() error {
-	c.wg.Add(1)
-	defer c.wg.Done()
-
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -206,7 +313,7 @@ func (c *Client) Listen() error {
 				return c.ctx.Err()
 			}
 			// Unexpected transport error
-			fmt.Printf("jsonrpc: error receiving message from transport: %v\n", err)
+			logger.Error("jsonrpc: failed to receive message from transport", "err", err)
 			c.cleanupPendingCalls()
 			return fmt.Errorf("jsonrpc: transport receive error:: %w", err)
 		}
@@ -216,87 +323,116 @@ func (c *Client) Listen() error {
 			continue
 		}
 
-		var incomingMsg IncomingMessage
-		if err := json.Unmarshal(payload, &incomingMsg); err != nil {
-			fmt.Printf("jsonrpc: error unmarshalling incoming message %v: %s\n", err, string(payload))
-			continue
-		}
-
-		// Dispatch the message
-		if incomingMsg.Method != "" {
-			// Either a request or notification from server
-			c.notiMu.Lock()
-			handler, ok := c.notiHandlers[incomingMsg.Method]
-			c.notiMu.Unlock()
-
-			if ok {
-				go func(p *json.RawMessage) {
-					if hErr := handler(p); hErr != nil {
-						fmt.Printf("jsonprc: notification handler for method '%s' failed: %v", incomingMsg.Method, hErr)
-					}
-				}(incomingMsg.Params)
-			} else {
-				fmt.Printf("jsonrpc: no notification handler method: '%s'\n", incomingMsg.Method)
-			}
-		} else if incomingMsg.ID != nil {
-			// Response to a client call
-			if incomingMsg.Error != nil && incomingMsg.Result != nil {
-				// Invalid response
-				fmt.Printf("jsonrpc: received response with ID %v that has both result and error fields\n", incomingMsg.ID)
+		// A batch reply is an array of responses, each dispatched on its own
+		if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(trimmed, &batch); err != nil {
+				logger.Warn("jsonrpc: failed to unmarshal incoming batch", "err", err, "payload", string(payload))
 				continue
 			}
-			if incomingMsg.Error == nil && incomingMsg.Result == nil && incomingMsg.JSONRPC == "2.0" {
-				// Invalid response
-				fmt.Printf("jsonrpc: received response with ID %v that has neither error nor result\n", incomingMsg.ID)
-				continue
-			}
-			if incomingMsg.Error == nil && incomingMsg.Result == nil && incomingMsg.JSONRPC == "2.0" { // ID is present, JSONRPC is present, but no result/error
-				fmt.Printf("jsonrpc: received response with ID %v that has neither result nor error field\n", incomingMsg.ID)
-				continue // Invalid response, skip
+			for _, msg := range batch {
+				c.dispatch(msg)
 			}
+			continue
+		}
 
-			// TODO: This could be a separate function
-			var mapKey any
-			switch idVal := incomingMsg.ID.(type) {
-			case float64:
-				mapKey = uint64(idVal)
-			case string:
-				mapKey = idVal
-			default:
-				// Use as is, assuming consistent types or Call side handles it?
-				mapKey = incomingMsg.ID
-			}
+		c.dispatch(payload)
+	}
+}
 
-			c.pendingCallsMu.Lock()
-			ch, ok := c.pendingCalls[mapKey]
-			c.pendingCallsMu.Unlock()
-
-			// Handle valid responses
-			if ok && ch != nil {
-				respForCall := &Response{
-					JSONRPC: incomingMsg.JSONRPC,
-					Result:  incomingMsg.Result,
-					Error:   incomingMsg.Error,
-					ID:      incomingMsg.ID,
-				}
-				select {
-				case ch <- respForCall:
-				// Why is there no handling here?
-				case <-c.ctx.Done():
-				}
-			} else {
-				fmt.Printf("jsonrpc: received response for unknown or already handled ID: %v\n", incomingMsg.ID)
-			}
+func (c *Client) dispatch(payload []byte) {
+	var incomingMsg IncomingMessage
+	if err := json.Unmarshal(payload, &incomingMsg); err != nil {
+		logger.Warn("jsonrpc: failed to unmarshal incoming message", "err", err, "payload", string(payload))
+		return
+	}
+
+	if incomingMsg.Method != "" {
+		// Either a request or notification from server
+		c.notiMu.Lock()
+		handler, ok := c.notiHandlers[incomingMsg.Method]
+		c.notiMu.Unlock()
 
+		if ok {
+			go func(p *json.RawMessage) {
+				if hErr := handler(p); hErr != nil {
+					logger.Warn("jsonrpc: notification handler failed", "method", incomingMsg.Method, "err", hErr)
+				}
+			}(incomingMsg.Params)
 		} else {
-			// Neither response for call nor notification/request to client
-			fmt.Printf("jsonrpc: received ill-formed message (no method and no/null ID for dispatch): %s\n", string(payload))
+			logger.Debug("jsonrpc: no notification handler", "method", incomingMsg.Method)
 		}
+		return
+	}
+
+	if incomingMsg.ID == nil {
+		// Neither response for call nor notification/request to client
+		logger.Warn("jsonrpc: received ill-formed message, no method and no ID", "payload", string(payload))
+		return
+	}
+
+	id := *incomingMsg.ID
+
+	// Response to a client call
+	if incomingMsg.Error != nil && incomingMsg.Result != nil {
+		logger.Warn("jsonrpc: received response with both result and error", "id", id)
+		return
+	}
+	if incomingMsg.Error == nil && incomingMsg.Result == nil && incomingMsg.JSONRPC == jsonrpcver {
+		logger.Warn("jsonrpc: received response with neither result nor error", "id", id)
+		return
+	}
+
+	c.pendingCallsMu.Lock()
+	ch, ok := c.pendingCalls[id]
+	c.pendingCallsMu.Unlock()
+
+	if !ok || ch == nil {
+		err := &MismatchedIDError{ID: id, Expected: c.pendingIDs()}
+		logger.Warn("jsonrpc: received unexpected response", "err", err)
+		return
+	}
+
+	respForCall := &Response{
+		JSONRPC: incomingMsg.JSONRPC,
+		Result:  incomingMsg.Result,
+		Error:   incomingMsg.Error,
+		ID:      id,
+	}
+	select {
+	case ch <- respForCall:
+	case <-c.ctx.Done():
 	}
 }
 
+// IDs of the calls still waiting for a response
+func (c *Client) pendingIDs() []ID {
+	c.pendingCallsMu.Lock()
+	defer c.pendingCallsMu.Unlock()
+
+	ids := make([]ID, 0, len(c.pendingCalls))
+	for id := range c.pendingCalls {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
 // Shutdown the client's listener goroutine and clean up resources
 // by closing the clients main context, which signals the listener to stop.
+// Run Listen in the background, reporting how it stopped to onStop when set.
+// The wait group is added to before the goroutine starts, so a Close racing with it still waits
+func (c *Client) Go(onStop func(error)) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		err := c.Listen()
+		if onStop != nil {
+			onStop(err)
+		}
+	}()
+}
+
 func (c *Client) Close() error {
 	c.cancel()  // Sinal listener goroutine to stop via context cancellation
 	c.wg.Wait() // Wait for listener goroutine to finish
@@ -314,14 +450,14 @@ func (c *Client) Close() error {
 	// Re-initialize just to be safe?
 	// The client might be re-used after closing,
 	// and it's a good practice to reset resouces after cleanup?
-	c.pendingCalls = make(map[any]chan *Response)
+	c.pendingCalls = make(map[ID]chan *Response)
 	c.pendingCallsMu.Unlock()
 
 	// Close transport
 	if closer, ok := c.transport.(io.Closer); ok {
 		if err := closer.Close(); err != nil {
 			// This does not prevent other cleanup or shadow client context errors.
-			fmt.Printf("jsonrpc: error closing transport: %v\n", err)
+			logger.Warn("jsonrpc: failed to close transport", "err", err)
 			return fmt.Errorf("jsonrpc: error closing transport: %w", err)
 		}
 	}
@@ -353,10 +489,10 @@ func (c *Client) cleanupPendingCalls() {
 }
 
 // FormatRequest creates a JSON-RPC request object and marshals it to JSON.
-// The id can be a string, number, or null. If id is nil, it will be omitted (for notifications).
+// The id can be a string or number. If id is nil, it will be omitted (for notifications).
 func FormatRequest(args *RequestArgs) ([]byte, error) {
 	req := Request{
-		JSONRPC: "2.0",
+		JSONRPC: jsonrpcver,
 		Method:  args.Method,
 		Params:  args.Params,
 		ID:      args.ID,
@@ -365,11 +501,11 @@ func FormatRequest(args *RequestArgs) ([]byte, error) {
 }
 
 // ParseResponse unmarshals a JSON response and separates the id, result (as json.RawMessage), and error fields.
-func ParseResponse(jsonResponse []byte) (id any, result *json.RawMessage, errResp *Error, parseErr error) {
+func ParseResponse(jsonResponse []byte) (id ID, result *json.RawMessage, errResp *Error, parseErr error) {
 	var resp Response
 	parseErr = json.Unmarshal(jsonResponse, &resp)
 	if parseErr != nil {
-		return nil, nil, nil, parseErr
+		return ID{}, nil, nil, parseErr
 	}
 	// Note: The JSON-RPC 2.0 spec says the id field in a response MUST match the id field in the request,
 	// or be null if there was an error parsing the request id (which this client-side parser doesn't deal with directly).
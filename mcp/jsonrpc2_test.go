@@ -6,15 +6,47 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// bytes.Buffer the client and the fake server on the other end can use from their goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) ReadBytes(delim byte) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.ReadBytes(delim)
+}
+
+func (b *syncBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// Copy of the unread bytes
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
 type mockTransport struct {
-	writeBuf *bytes.Buffer
-	readBuf  *bytes.Buffer
+	writeBuf *syncBuffer
+	readBuf  *syncBuffer
 	closed   chan struct{}
 }
 
@@ -77,8 +109,8 @@ func (m *mockTransport) Close() error {
 }
 
 func TestCallSuccess(t *testing.T) {
-	clientReadFromServer := new(bytes.Buffer)
-	clientWriteToServer := new(bytes.Buffer)
+	clientReadFromServer := new(syncBuffer)
+	clientWriteToServer := new(syncBuffer)
 
 	transport := &mockTransport{
 		writeBuf: clientWriteToServer,
@@ -87,12 +119,11 @@ func TestCallSuccess(t *testing.T) {
 	}
 
 	c := NewClient(transport)
-	go func() {
-		err := c.Listen()
+	c.Go(func(err error) {
 		if err != nil && err != context.Canceled && err != io.ErrClosedPipe && err.Error() != "context canceled" {
 			t.Logf("Client listen error: %v", err)
 		}
-	}()
+	})
 	defer func() {
 		c.Close()
 	}()
@@ -101,8 +132,10 @@ func TestCallSuccess(t *testing.T) {
 	go func() {
 		defer close(serverDone)
 		// 1. Consume the request from the client.
-		requestSink := make([]byte, 1024)
-		_, err := clientWriteToServer.Read(requestSink)
+		for clientWriteToServer.Len() == 0 {
+			time.Sleep(1 * time.Millisecond)
+		}
+		_, err := clientWriteToServer.ReadBytes('\n')
 		if err != nil && err != io.EOF {
 			t.Logf("Server: Error reading client request: %v", err)
 			return
@@ -136,8 +169,8 @@ func TestCallSuccess(t *testing.T) {
 }
 
 func TestClientHandlesNotification(t *testing.T) {
-	clientReadFromServer := new(bytes.Buffer)
-	clientWriteToServer := new(bytes.Buffer)
+	clientReadFromServer := new(syncBuffer)
+	clientWriteToServer := new(syncBuffer)
 
 	transport := &mockTransport{
 		writeBuf: clientWriteToServer,
@@ -177,12 +210,11 @@ func TestClientHandlesNotification(t *testing.T) {
 		return nil
 	})
 
-	go func() {
-		err := c.Listen()
+	c.Go(func(err error) {
 		if err != nil && err != context.Canceled && err != io.ErrClosedPipe && err.Error() != "context canceled" {
 			t.Logf("Client Listen error: %v", err)
 		}
-	}()
+	})
 	defer func() {
 		c.Close()
 	}()
@@ -212,3 +244,75 @@ func TestClientHandlesNotification(t *testing.T) {
 	}
 	<-serverDone
 }
+
+func TestID_JSON(t *testing.T) {
+	var id ID
+	assert.NoError(t, json.Unmarshal([]byte(`7`), &id))
+	assert.Equal(t, NumberID(7), id)
+
+	assert.NoError(t, json.Unmarshal([]byte(`"7"`), &id))
+	assert.Equal(t, StringID("7"), id)
+	assert.NotEqual(t, NumberID(7), id)
+
+	assert.NoError(t, json.Unmarshal([]byte(`null`), &id))
+	assert.False(t, id.IsValid())
+
+	assert.Error(t, json.Unmarshal([]byte(`1.5`), &id))
+	assert.Error(t, json.Unmarshal([]byte(`true`), &id))
+
+	b, err := json.Marshal(NumberID(42))
+	assert.NoError(t, err)
+	assert.Equal(t, `42`, string(b))
+
+	b, err = json.Marshal(StringID("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc"`, string(b))
+}
+
+func TestMismatchedIDError(t *testing.T) {
+	err := &MismatchedIDError{ID: StringID("1"), Expected: []ID{NumberID(1)}}
+	assert.Equal(t, `jsonrpc: response ID "1" matches no pending request (expected one of 1)`, err.Error())
+}
+
+func TestCallBatch(t *testing.T) {
+	clientReadFromServer := new(syncBuffer)
+	clientWriteToServer := new(syncBuffer)
+
+	transport := &mockTransport{
+		writeBuf: clientWriteToServer,
+		readBuf:  clientReadFromServer,
+		closed:   make(chan struct{}),
+	}
+
+	c := NewClient(transport)
+	c.Go(nil)
+	defer c.Close()
+
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		for !bytes.Contains(clientWriteToServer.Bytes(), []byte(`"method":"second"`)) {
+			time.Sleep(1 * time.Millisecond)
+		}
+		// Answered out of order, with one failure
+		clientReadFromServer.Write([]byte(`[{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found"}},{"jsonrpc":"2.0","id":1,"result":{"value":"first"}}]` + "\n"))
+	}()
+
+	var first map[string]string
+	calls := []*BatchCall{
+		{Method: "first", Result: &first},
+		{Method: "second"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.CallBatch(ctx, calls)
+	<-serverDone
+
+	assert.NoError(t, err)
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, "first", first["value"])
+	assert.ErrorContains(t, calls[1].Err, "method not found")
+	assert.True(t, bytes.HasPrefix(bytes.TrimSpace(clientWriteToServer.Bytes()), []byte("[")))
+}
@@ -2,19 +2,46 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
+
+	"github.com/honganh1206/tinker/tinkererr"
+	"github.com/honganh1206/tinker/utils"
+)
+
+const (
+	// Server stderr logs are rotated past this size
+	logMaxSize    = 5 * 1024 * 1024
+	logMaxBackups = 3
+
+	// Tool calls are abandoned after this long unless the server configures its own timeout
+	DefaultCallTimeout = 2 * time.Minute
+
+	// How long a server gets to exit after its stdin is closed, then after SIGTERM
+	shutdownGracePeriod = 2 * time.Second
+	shutdownTermPeriod  = 2 * time.Second
 )
 
+var logger = utils.Logger("mcp")
+
+var ErrCallTimeout = tinkererr.New(tinkererr.ToolFailed, "mcp server: tool call timed out")
+
 type Config struct {
 	ServerConfigs []ServerConfig
 	ActiveServers []*Server
 	Tools         []Tools
 	ToolMap       map[string]ToolDetails
+	// Prompts of the active servers that offer some, by server ID
+	Prompts map[string][]*Prompt
 }
 
 // Create a Server instance to manage server subprocesses and communication
@@ -45,20 +72,57 @@ type Server struct {
 	id        string
 	cmdPath   string
 	cmdArgs   []string
+	config    ServerConfig
 	proc      *exec.Cmd
 	rpcClient *Client
+	// Announced by the server during the handshake, replaced along with rpcClient
+	capabilities map[string]any
 	// Close the subprocess' pipe
 	closer io.Closer
+	// Log file capturing the subprocess' stderr
+	stderrLog *utils.RotatingFile
 	// Protect access to requestIDCounter
 	requestIDLock sync.Mutex
 	// Generate unique JSON-RPC request IDs
 	requestIDCounter int64
+	// Guard rpcClient swaps during restarts and closing them
+	clientMu sync.RWMutex
+	// Make Close a no-op past the first call, reset by each start
+	closeOnce sync.Once
+	healthMu  sync.Mutex
+	health    Health
+	// Route progress notifications to the in-flight call that requested them
+	progressMu       sync.Mutex
+	progressCounter  int64
+	progressHandlers map[string]func(ProgressParams)
+	// Closed once the first start attempt is over,
+	// so calls made against cached tools wait for the handshake
+	started   chan struct{}
+	startOnce sync.Once
 }
 
-func NewServer(id, cmd string) (*Server, error) {
+// Health is the result of the latest ping sent to a server
+type Health struct {
+	Healthy     bool
+	Latency     time.Duration
+	LastChecked time.Time
+	// Consecutive failed pings, reset on success
+	Failures int
+	Err      error
+}
+
+func NewServer(cfg ServerConfig) (*Server, error) {
+	if cfg.IsRemote() {
+		return &Server{
+			id:      cfg.ID,
+			config:  cfg,
+			started: make(chan struct{}),
+		}, nil
+	}
+
 	// For now, cmd is just an executable name with no args
 	// TODO: Implement command splitting
-	parts := strings.Fields(cmd)
+	parts := strings.Fields(cfg.Command)
 	if len(parts) == 0 {
 		return nil, fmt.Errorf("mcp server: cmd cannot be empty")
 	}
@@ -70,16 +134,57 @@ func NewServer(id, cmd string) (*Server, error) {
 	}
 
 	return &Server{
-		id:               id,
+		id:               cfg.ID,
 		cmdPath:          cmdPath,
 		cmdArgs:          cmdArgs,
+		config:           cfg,
 		requestIDCounter: 0,
+		started:          make(chan struct{}),
 	}, nil
 }
 
-// Start the server subprocess and perform the initialization handshake
-func (s *Server) Start(ctx context.Context) error {
-	s.proc = exec.CommandContext(ctx, s.cmdPath, s.cmdArgs...)
+// Start the server subprocess and perform the initialization handshake.
+// When it fails, what was started is closed again
+func (s *Server) Start(ctx context.Context) (err error) {
+	defer s.startOnce.Do(func() {
+		if s.started != nil {
+			close(s.started)
+		}
+	})
+
+	s.closeOnce = sync.Once{}
+	defer func() {
+		if err != nil {
+			_ = s.closeLocked()
+		}
+	}()
+
+	if s.config.IsRemote() {
+		return s.startRemote(ctx)
+	}
+
+	// ctx only bounds the startup, the process lives until Close
+	s.proc = exec.Command(s.cmdPath, s.cmdArgs...)
+
+	// Most servers need API keys, so we expand them at start time
+	// instead of persisting the resolved values
+	env, err := s.config.ResolveEnv()
+	if err != nil {
+		return err
+	}
+	if len(env) > 0 {
+		s.proc.Env = append(os.Environ(), env...)
+	}
+	s.proc.Dir = s.config.Cwd
+
+	// Keep server diagnostics out of the terminal
+	if logFile, err := openServerLog(s.id); err == nil {
+		s.stderrLog = logFile
+		s.logf("starting %s %s", s.cmdPath, strings.Join(s.cmdArgs, " "))
+		s.proc.Stderr = logFile
+	}
+	// Don't hang on Wait if a grandchild keeps stderr open after the server exits
+	s.proc.WaitDelay = time.Second
 
 	// Create file descriptors for stdin
 	stdin, err := s.proc.StdinPipe()
@@ -110,13 +215,43 @@ func (s *Server) Start(ctx context.Context) error {
 		return fmt.Errorf("mcp server: failed to start server process: %w", err)
 	}
 
-	go func() {
-		err := s.rpcClient.Listen()
+	s.rpcClient.Go(func(err error) {
 		// Check if file descriptors for stdin/stdout are closed
 		if err != nil && err != io.EOF && err != context.Canceled && !strings.Contains(err.Error(), "file already closed") {
-			fmt.Fprintf(os.Stderr, "MCP client listener error: %v\n", err)
+			logger.Error("MCP client stopped listening", "server", s.id, "err", err)
 		}
-	}()
+	})
+
+	return s.initialize(ctx)
+}
+
+// Connect to a remote server over HTTP and perform the initialization handshake.
+// Static headers e.g., a bearer token take precedence over OAuth tokens
+func (s *Server) startRemote(ctx context.Context) error {
+	headers, err := s.config.ResolveHeaders()
+	if err != nil {
+		return err
+	}
+
+	transport := NewHTTPTransport(s.config.URL, headers)
+	// Without a configured token, use the one 'tinker mcp login' stored
+	if !hasHeader(headers, "Authorization") {
+		transport.auth = newOAuthSession(s.config.URL, keyringTokens{}, transport.client)
+	}
+	s.closer = transport
+	s.rpcClient = NewClient(transport)
+
+	s.rpcClient.Go(func(err error) {
+		if err != nil && err != context.Canceled && err != io.ErrClosedPipe {
+			logger.Error("MCP client stopped listening", "server", s.id, "err", err)
+		}
+	})
+
+	return s.initialize(ctx)
+}
+
+func (s *Server) initialize(ctx context.Context) error {
+	s.rpcClient.OnNotification("notifications/progress", s.handleProgress)
 
 	initParams := &InitializeParams{
 		ProtocolVersion: "2024-11-05",
@@ -138,84 +273,270 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	if err := s.rpcClient.Call(ctx, callArgs, &initResult); err != nil {
-		// Clean up immediately if handshake fails
-		// TODO: error is ignored here
-		_ = s.Close()
 		return fmt.Errorf("mcp server: jsonrpc call to 'initialize' failed: %w", err)
 	}
 
+	s.capabilities = initResult.Capabilities
+
 	notifyArgs := &ClientNotifyArgs{
 		Method: "notifications/initialized",
 	}
 
 	if err := s.rpcClient.Notify(ctx, notifyArgs); err != nil {
-		_ = s.Close()
 		return fmt.Errorf("mcp server: jsonrpc notify to 'notifications/initialized' failed: %w", err)
 	}
 
+	s.setHealth(Health{Healthy: true, LastChecked: time.Now()})
+
 	return nil
 }
 
+// Restart the server subprocess in place,
+// so references held in the tool map stay valid
+func (s *Server) Restart(ctx context.Context) error {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+
+	if err := s.closeLocked(); err != nil {
+		logger.Warn("failed to close MCP server before restart", "server", s.id, "err", err)
+	}
+
+	return s.Start(ctx)
+}
+
+// Client of the server, an error until Start created one
+func (s *Server) client() (*Client, error) {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+
+	if s.rpcClient == nil {
+		return nil, fmt.Errorf("mcp server: server %s is not started", s.id)
+	}
+	return s.rpcClient, nil
+}
+
+// Send a "ping" request and record the round trip latency.
+// Servers must answer promptly with an empty result
+func (s *Server) Ping(ctx context.Context) (time.Duration, error) {
+	client, err := s.client()
+	if err != nil {
+		s.recordPing(0, err)
+		return 0, err
+	}
+
+	start := time.Now()
+	err = client.Call(ctx, &ClientCallArgs{Method: "ping"}, nil)
+	latency := time.Since(start)
+	if err != nil {
+		err = fmt.Errorf("mcp server: jsonrpc call to 'ping' failed: %w", err)
+	}
+
+	s.recordPing(latency, err)
+
+	return latency, err
+}
+
+// Whether the first start attempt is still under way
+func (s *Server) Starting() bool {
+	if s.started == nil {
+		return false
+	}
+	select {
+	case <-s.started:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *Server) Health() Health {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	return s.health
+}
+
+func (s *Server) setHealth(h Health) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health = h
+}
+
+func (s *Server) recordPing(latency time.Duration, err error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	s.health.LastChecked = time.Now()
+	s.health.Err = err
+	if err != nil {
+		s.health.Healthy = false
+		s.health.Failures++
+		return
+	}
+
+	s.health.Healthy = true
+	s.health.Latency = latency
+	s.health.Failures = 0
+}
+
+// Path of the file capturing the stderr of the server with the given ID
+func LogPath(id string) (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "logs", "mcp-"+sanitizeToolName(id)+".log"), nil
+}
+
+func openServerLog(id string) (*utils.RotatingFile, error) {
+	path, err := LogPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.NewRotatingFile(path, logMaxSize, logMaxBackups)
+}
+
 // Shutdown the server and clean up resources
+// Stop the client and the subprocess. Calls past the first one until the next start do nothing,
+// so a failed start and the shutdown of the agent can both close the server
 func (s *Server) Close() error {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	return s.closeLocked()
+}
+
+// Close with clientMu held, as Restart does
+func (s *Server) closeLocked() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.shutdown()
+	})
+	return err
+}
+
+func (s *Server) shutdown() error {
 	var firstErr error
 
+	// Closed last, once the process has exited and its stderr is drained
+	defer func() {
+		if s.stderrLog != nil {
+			s.stderrLog.Close()
+			s.stderrLog = nil
+		}
+	}()
+
+	// Stopping the client closes the pipes as well,
+	// so closing them again below is expected to report they are already closed
 	if s.rpcClient != nil {
-		if err := s.rpcClient.Close(); err != nil {
+		if err := s.rpcClient.Close(); err != nil && !isClosedErr(err) {
 			firstErr = fmt.Errorf("mcp server: failed to close rpc client: %w", err)
 		}
 	}
 
-	// Close the pipes (reader/writer/closer for the transport)
+	// Closing stdin is the first step of the shutdown, the server should exit on EOF
 	if s.closer != nil {
-		if err := s.closer.Close(); err != nil {
-			if firstErr == nil {
-				// TODO: Still error when close with SIGTERM
-				firstErr = fmt.Errorf("mcp server: failed to close server pipes: %w", err)
-			} else {
-				fmt.Fprintf(os.Stderr, "additional error while closing server pipes: %v\n", err)
-			}
+		if err := s.closer.Close(); err != nil && !isClosedErr(err) && firstErr == nil {
+			firstErr = fmt.Errorf("mcp server: failed to close server pipes: %w", err)
 		}
 	}
 
-	// Terminate the server subprocess
-	if s.proc != nil && s.proc.Process != nil {
-		// Send the process an interrupt
-		if err := s.proc.Process.Signal(os.Interrupt); err != nil {
-			// Interrupt fails, try to kill
-			if killErr := s.proc.Process.Kill(); killErr != nil {
-				if firstErr == nil {
-					firstErr = fmt.Errorf("mcp server: failed to kill server pipes: %w", killErr)
-				} else {
-					fmt.Fprintf(os.Stderr, "additional error while closing server pipes: %v\n", err)
-				}
-			}
-		}
+	// Remote servers have no process to wait for
+	if s.proc == nil || s.proc.Process == nil {
+		return firstErr
 	}
 
-	// Wait for the process to exit to release resources.
-	// We handle wait error when Signal/Kill causes unexpected erors
-	_, waitErr := s.proc.Process.Wait()
-	if waitErr != nil && !strings.Contains(waitErr.Error(), "signal: interrupt") && !strings.Contains(waitErr.Error(), "exit status 1") && !strings.Contains(waitErr.Error(), "killed") {
-		if firstErr == nil {
-			if !strings.Contains(waitErr.Error(), "Wait was already called") {
-				firstErr = fmt.Errorf("mcp server: error waiting for server process to exit: %w", waitErr)
-			} else {
-				fmt.Fprintf(os.Stderr, "additional error while closing server pipes: %v\n", waitErr)
-			}
-		}
+	if err := s.stopProcess(); err != nil && firstErr == nil {
+		firstErr = err
 	}
 
 	return firstErr
 }
 
+// Wait for the subprocess to exit once its stdin is closed,
+// escalating to SIGTERM and then SIGKILL if it does not.
+// How the server exits once asked to is not an error, only failing to stop it is
+func (s *Server) stopProcess() error {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.proc.Wait()
+	}()
+
+	s.logf("stdin closed, waiting %s for exit", shutdownGracePeriod)
+	if err, ok := waitExit(exited, shutdownGracePeriod); ok {
+		s.logExit(err)
+		return nil
+	}
+
+	s.logf("still running, sending SIGTERM")
+	if err := s.proc.Process.Signal(syscall.SIGTERM); err == nil {
+		if err, ok := waitExit(exited, shutdownTermPeriod); ok {
+			s.logExit(err)
+			return nil
+		}
+	}
+
+	s.logf("still running, sending SIGKILL")
+	if err := s.proc.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("mcp server: failed to kill server process: %w", err)
+	}
+
+	if err, ok := waitExit(exited, shutdownTermPeriod); ok {
+		s.logExit(err)
+		return nil
+	}
+
+	return fmt.Errorf("mcp server: server process %d did not exit after SIGKILL", s.proc.Process.Pid)
+}
+
+func waitExit(exited <-chan error, timeout time.Duration) (error, bool) {
+	select {
+	case err := <-exited:
+		return err, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+func (s *Server) logExit(err error) {
+	if err != nil {
+		s.logf("exited: %v", err)
+		return
+	}
+	s.logf("exited")
+}
+
+// Write a lifecycle line between the server's own output in its log file
+func (s *Server) logf(format string, args ...any) {
+	if s.stderrLog == nil {
+		return
+	}
+	fmt.Fprintf(s.stderrLog, "--- %s: %s ---\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+func isClosedErr(err error) bool {
+	return errors.Is(err, os.ErrClosed) || errors.Is(err, io.ErrClosedPipe) || strings.Contains(err.Error(), "file already closed")
+}
+
 // Send a "tools/call" request to the server for the specified tool
 func (s *Server) Call(ctx context.Context, toolName string, args map[string]any) ([]ToolResultContent, error) {
+	return s.CallWithProgress(ctx, toolName, args, nil)
+}
+
+// Same as Call, but onProgress receives the progress notifications
+// the server sends while the tool is running
+func (s *Server) CallWithProgress(ctx context.Context, toolName string, args map[string]any, onProgress func(ProgressParams)) ([]ToolResultContent, error) {
 	callParams := &ToolsCallParams{
 		Name:      toolName,
 		Arguments: args,
 	}
 
+	if onProgress != nil {
+		token := s.registerProgress(onProgress)
+		defer s.unregisterProgress(token)
+		callParams.Meta = map[string]any{"progressToken": token}
+	}
+
 	var callResult ToolsCallResult
 
 	callArgs := &ClientCallArgs{
@@ -223,7 +544,29 @@ func (s *Server) Call(ctx context.Context, toolName string, args map[string]any)
 		Params: callParams,
 	}
 
-	if err := s.rpcClient.Call(ctx, callArgs, &callResult); err != nil {
+	// Tools may be registered from the cache before the server is up
+	if s.started != nil {
+		select {
+		case <-s.started:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	// A hung server must not stall the agent forever
+	timeout := s.CallTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := client.Call(ctx, callArgs, &callResult); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: '%s' did not finish within %s", ErrCallTimeout, toolName, timeout)
+		}
 		return nil, fmt.Errorf("mcp server: jsonrpc call to 'tools/call' (tool: %s) failed: %w", toolName, err)
 	}
 
@@ -232,14 +575,66 @@ func (s *Server) Call(ctx context.Context, toolName string, args map[string]any)
 		// and we can try a more sophisticated error handling method in the future
 		// like extracting detail from callResult.Content
 		if len(callResult.Content) > 0 && callResult.Content[0].Type == "text" {
-			return callResult.Content, fmt.Errorf("mcp server: tool call for '%s' failed with server-side error: %s", toolName, callResult.Content[0].Text)
+			return callResult.Content, tinkererr.Errorf(tinkererr.ToolFailed, "mcp server: tool call for '%s' failed with server-side error: %s", toolName, callResult.Content[0].Text)
 		}
-		return callResult.Content, fmt.Errorf("mcp server: tool call for '%s' failed with server-side error", toolName)
+		return callResult.Content, tinkererr.Errorf(tinkererr.ToolFailed, "mcp server: tool call for '%s' failed with server-side error", toolName)
 	}
 
 	return callResult.Content, nil
 }
 
+func (s *Server) CallTimeout() time.Duration {
+	if s.config.CallTimeout > 0 {
+		return time.Duration(s.config.CallTimeout)
+	}
+	return DefaultCallTimeout
+}
+
+func (s *Server) registerProgress(handler func(ProgressParams)) string {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+
+	if s.progressHandlers == nil {
+		s.progressHandlers = make(map[string]func(ProgressParams))
+	}
+	s.progressCounter++
+	token := fmt.Sprintf("%s-%d", s.id, s.progressCounter)
+	s.progressHandlers[token] = handler
+
+	return token
+}
+
+func (s *Server) unregisterProgress(token string) {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	delete(s.progressHandlers, token)
+}
+
+func (s *Server) handleProgress(params *json.RawMessage) error {
+	if params == nil {
+		return fmt.Errorf("mcp server: progress notification without params")
+	}
+
+	var progress ProgressParams
+	if err := json.Unmarshal(*params, &progress); err != nil {
+		return fmt.Errorf("mcp server: invalid progress notification: %w", err)
+	}
+
+	// Tokens may come back as strings or numbers
+	token := fmt.Sprint(progress.ProgressToken)
+
+	s.progressMu.Lock()
+	handler, ok := s.progressHandlers[token]
+	s.progressMu.Unlock()
+
+	// Late notifications for finished calls are dropped
+	if ok {
+		handler(progress)
+	}
+
+	return nil
+}
+
 func (s *Server) ListTools(ctx context.Context) (Tools, error) {
 	listParams := &ToolsListParams{}
 	var listResult ToolsListResult
@@ -249,7 +644,12 @@ func (s *Server) ListTools(ctx context.Context) (Tools, error) {
 		Params: listParams,
 	}
 
-	if err := s.rpcClient.Call(ctx, &callArgs, &listResult); err != nil {
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Call(ctx, &callArgs, &listResult); err != nil {
 		return nil, fmt.Errorf("mcp server: jsonrpc call to 'tools/list' failed: %w", err)
 	}
 
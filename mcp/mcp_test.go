@@ -0,0 +1,278 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConfig_ResolveEnv(t *testing.T) {
+	t.Setenv("TINKER_TEST_TOKEN", "secret-token")
+
+	secretPath := filepath.Join(t.TempDir(), "api_key")
+	err := os.WriteFile(secretPath, []byte("file-secret\n"), 0o600)
+	assert.NoError(t, err)
+
+	cfg := ServerConfig{
+		ID:      "test",
+		Command: "echo",
+		Env: map[string]string{
+			"TOKEN":   "${TINKER_TEST_TOKEN}",
+			"API_KEY": "${file:" + secretPath + "}",
+			"PLAIN":   "value",
+		},
+	}
+
+	env, err := cfg.ResolveEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"API_KEY=file-secret",
+		"PLAIN=value",
+		"TOKEN=secret-token",
+	}, env)
+}
+
+func TestServerConfig_ResolveEnv_MissingSecret(t *testing.T) {
+	cfg := ServerConfig{
+		ID:  "test",
+		Env: map[string]string{"API_KEY": "${file:/non/existent/secret}"},
+	}
+
+	_, err := cfg.ResolveEnv()
+	assert.Error(t, err)
+}
+
+// MCP server on the other end of a pair of pipes, as a subprocess would be.
+// Each request is answered with the result respond returns for its method, left unanswered when empty
+type pipeServer struct {
+	mu       sync.Mutex
+	received []string
+}
+
+func startPipeServer(t *testing.T, respond func(method string) string) (*Client, *pipeServer) {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	client := NewClient(NewStdioTransport(&stdioReadWriteCloser{
+		Reader:       clientIn,
+		Writer:       clientOut,
+		stdinCloser:  clientOut,
+		stdoutCloser: clientIn,
+	}))
+
+	srv := &pipeServer{}
+	go func() {
+		// The client closing its end is the server's EOF
+		defer serverOut.Close()
+		scanner := bufio.NewScanner(serverIn)
+		for scanner.Scan() {
+			srv.mu.Lock()
+			srv.received = append(srv.received, scanner.Text())
+			srv.mu.Unlock()
+
+			var msg IncomingMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == nil {
+				continue
+			}
+			result := respond(msg.Method)
+			if result == "" {
+				continue
+			}
+			id, _ := json.Marshal(msg.ID)
+			if _, err := fmt.Fprintf(serverOut, `{"jsonrpc": "2.0", "id": %s, "result": %s}`+"\n", id, result); err != nil {
+				return
+			}
+		}
+	}()
+
+	client.Go(nil)
+	t.Cleanup(func() { client.Close() })
+	return client, srv
+}
+
+// Requests and notifications the server got so far, one per line
+func (p *pipeServer) Received() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.Join(p.received, "\n")
+}
+
+func TestServer_Ping(t *testing.T) {
+	client, _ := startPipeServer(t, func(method string) string {
+		if method == "ping" {
+			return "{}"
+		}
+		return ""
+	})
+	s := &Server{id: "test", rpcClient: client}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.Ping(ctx)
+	assert.NoError(t, err)
+
+	h := s.Health()
+	assert.True(t, h.Healthy)
+	assert.Equal(t, 0, h.Failures)
+	assert.False(t, h.LastChecked.IsZero())
+}
+
+func TestServer_Ping_NotStarted(t *testing.T) {
+	s := &Server{id: "test"}
+
+	for range 2 {
+		_, err := s.Ping(context.Background())
+		assert.Error(t, err)
+	}
+
+	h := s.Health()
+	assert.False(t, h.Healthy)
+	assert.Equal(t, 2, h.Failures)
+}
+
+func TestServer_NotStarted(t *testing.T) {
+	s := &Server{id: "test"}
+	ctx := context.Background()
+
+	_, err := s.ListTools(ctx)
+	assert.ErrorContains(t, err, "not started")
+	_, err = s.Call(ctx, "echo", nil)
+	assert.ErrorContains(t, err, "not started")
+	_, err = s.ListPrompts(ctx)
+	assert.ErrorContains(t, err, "not started")
+	_, err = s.GetPrompt(ctx, "review", nil)
+	assert.ErrorContains(t, err, "not started")
+}
+
+func TestNamespacedToolName(t *testing.T) {
+	assert.Equal(t, "fetch_get_page", NamespacedToolName("fetch", "get_page"))
+	assert.Equal(t, "my_server_tool_name", NamespacedToolName("my.server", "tool name"))
+
+	long := NamespacedToolName("server", strings.Repeat("a", 100))
+	assert.Len(t, long, MaxToolNameLength)
+}
+
+func TestProgressParams_String(t *testing.T) {
+	assert.Equal(t, "3/10 pages downloaded", ProgressParams{Progress: 3, Total: 10, Message: "pages downloaded"}.String())
+	assert.Equal(t, "0.5", ProgressParams{Progress: 0.5}.String())
+}
+
+func TestServer_handleProgress(t *testing.T) {
+	s := &Server{id: "fetch"}
+
+	var received []ProgressParams
+	token := s.registerProgress(func(p ProgressParams) {
+		received = append(received, p)
+	})
+
+	params := json.RawMessage(`{"progressToken":"` + token + `","progress":3,"total":10,"message":"pages downloaded"}`)
+	assert.NoError(t, s.handleProgress(&params))
+
+	// Notifications for unknown or finished calls are dropped
+	s.unregisterProgress(token)
+	assert.NoError(t, s.handleProgress(&params))
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, float64(3), received[0].Progress)
+	assert.Equal(t, "pages downloaded", received[0].Message)
+}
+
+func TestServerConfig_AllowsTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		tool    string
+		want    bool
+	}{
+		{"no filters", nil, nil, "anything", true},
+		{"included by name", []string{"search"}, nil, "search", true},
+		{"not included", []string{"search"}, nil, "delete", false},
+		{"included by glob", []string{"read_*"}, nil, "read_file", true},
+		{"excluded by name", nil, []string{"delete"}, "delete", false},
+		{"exclude wins over include", []string{"read_*"}, []string{"read_secret"}, "read_secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ServerConfig{ID: "test", IncludeTools: tt.include, ExcludeTools: tt.exclude}
+			assert.Equal(t, tt.want, cfg.AllowsTool(tt.tool))
+		})
+	}
+}
+
+func TestServer_Call_Timeout(t *testing.T) {
+	// The server never answers
+	client, srv := startPipeServer(t, func(string) string { return "" })
+
+	s := &Server{
+		id:        "test",
+		config:    ServerConfig{ID: "test", CallTimeout: Duration(50 * time.Millisecond)},
+		rpcClient: client,
+	}
+
+	start := time.Now()
+	_, err := s.Call(context.Background(), "slow_tool", nil)
+
+	assert.ErrorIs(t, err, ErrCallTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(srv.Received(), `"method":"notifications/cancelled"`)
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestServer_CallTimeout_Default(t *testing.T) {
+	s := &Server{id: "test"}
+	assert.Equal(t, DefaultCallTimeout, s.CallTimeout())
+}
+
+func TestServer_Close_ExitsOnStdinEOF(t *testing.T) {
+	s := &Server{id: "cat", proc: exec.Command("cat")}
+
+	stdin, err := s.proc.StdinPipe()
+	assert.NoError(t, err)
+	s.closer = stdin
+	assert.NoError(t, s.proc.Start())
+
+	// cat exits as soon as stdin is closed, so no signal is needed
+	start := time.Now()
+	assert.NoError(t, s.Close())
+	assert.Less(t, time.Since(start), shutdownGracePeriod)
+	assert.True(t, s.proc.ProcessState.Exited())
+}
+
+func TestServer_GetPrompt(t *testing.T) {
+	client, srv := startPipeServer(t, func(method string) string {
+		if method != "prompts/get" {
+			return ""
+		}
+		return `{"messages": [` +
+			`{"role": "user", "content": {"type": "text", "text": "Review PR 42"}},` +
+			`{"role": "user", "content": {"type": "image", "data": "aGk=", "mimeType": "image/png"}},` +
+			`{"role": "user", "content": {"type": "text", "text": "Focus on tests"}}]}`
+	})
+
+	s := &Server{id: "test", rpcClient: client, capabilities: map[string]any{"prompts": map[string]any{}}}
+	assert.True(t, s.SupportsPrompts())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.GetPrompt(ctx, "review", map[string]string{"pr": "42"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Review PR 42\n\nFocus on tests", result.Text())
+	assert.Contains(t, srv.Received(), `"arguments":{"pr":"42"}`)
+}
@@ -0,0 +1,472 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honganh1206/tinker/utils"
+)
+
+// Remote servers without static credentials are authorized with OAuth 2.1,
+// following the MCP authorization spec: tinker registers itself as a client
+// of the server's authorization server, the user grants access in the browser
+// and the tokens are kept in the OS keyring, refreshed as they expire
+
+const (
+	keyringService = "tinker-mcp"
+
+	// Refresh a little before the token expires so it does not run out mid request
+	tokenExpiryMargin = 30 * time.Second
+)
+
+// Client tinker registered as with an authorization server
+type oauthClient struct {
+	TokenEndpoint string `json:"token_endpoint"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+}
+
+type oauthToken struct {
+	// Kept with the token to refresh it later
+	oauthClient
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Zero when the token does not expire
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+func (t *oauthToken) expired() bool {
+	return !t.Expiry.IsZero() && time.Now().Add(tokenExpiryMargin).After(t.Expiry)
+}
+
+// Tokens kept between runs, by server URL
+type tokenStore interface {
+	load(serverURL string) (*oauthToken, error)
+	save(serverURL string, token *oauthToken) error
+	delete(serverURL string) error
+}
+
+type keyringTokens struct{}
+
+// Nil when nothing is stored, or there is no keyring to store it in
+func (keyringTokens) load(serverURL string) (*oauthToken, error) {
+	raw, err := utils.GetSecret(keyringService, serverURL)
+	if errors.Is(err, utils.ErrSecretNotFound) || errors.Is(err, utils.ErrKeyringUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token oauthToken
+	if err := json.Unmarshal([]byte(raw), &token); err != nil {
+		return nil, fmt.Errorf("invalid token stored for %s: %w", serverURL, err)
+	}
+	return &token, nil
+}
+
+func (keyringTokens) save(serverURL string, token *oauthToken) error {
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return utils.SetSecret(keyringService, serverURL, string(raw))
+}
+
+func (keyringTokens) delete(serverURL string) error {
+	return utils.DeleteSecret(keyringService, serverURL)
+}
+
+// Tokens of one remote server, loaded from the store on first use
+type oauthSession struct {
+	serverURL string
+	store     tokenStore
+	client    *http.Client
+
+	mu     sync.Mutex
+	loaded bool
+	token  *oauthToken
+}
+
+func newOAuthSession(serverURL string, store tokenStore, client *http.Client) *oauthSession {
+	return &oauthSession{
+		serverURL: serverURL,
+		store:     store,
+		client:    client,
+	}
+}
+
+// Access token for the next request, refreshed first when it expired.
+// Empty when tinker never logged in to the server
+func (s *oauthSession) accessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		token, err := s.store.load(s.serverURL)
+		if err != nil {
+			return "", err
+		}
+		s.token, s.loaded = token, true
+	}
+
+	if s.token == nil {
+		return "", nil
+	}
+	if s.token.expired() && s.token.RefreshToken != "" {
+		if err := s.refreshLocked(ctx); err != nil {
+			return "", err
+		}
+	}
+	return s.token.AccessToken, nil
+}
+
+// Refresh the token the server rejected, reports whether there is a new one to retry with
+func (s *oauthSession) refresh(ctx context.Context, rejected string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil || s.token.RefreshToken == "" {
+		return false, nil
+	}
+	// Another request refreshed it in the meantime
+	if s.token.AccessToken != rejected {
+		return true, nil
+	}
+	if err := s.refreshLocked(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *oauthSession) refreshLocked(ctx context.Context) error {
+	token, err := requestToken(ctx, s.client, s.token.oauthClient, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.token.RefreshToken},
+		"resource":      {s.serverURL},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh the access token, log in again with 'tinker mcp login': %w", err)
+	}
+	// Servers may keep the refresh token the same without sending it back
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.token.RefreshToken
+	}
+
+	s.token = token
+	return s.store.save(s.serverURL, token)
+}
+
+// Exchange a grant, e.g., an authorization code, for a token at the token endpoint
+func requestToken(ctx context.Context, httpClient *http.Client, client oauthClient, form url.Values) (*oauthToken, error) {
+	form.Set("client_id", client.ClientID)
+	if client.ClientSecret != "" {
+		form.Set("client_secret", client.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed (%d): %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	token := &oauthToken{
+		oauthClient:  client,
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+	}
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// Endpoints of an authorization server, RFC 8414
+type authServerMetadata struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	RegistrationEndpoint  string `json:"registration_endpoint"`
+}
+
+// Find the authorization server of the remote server at serverURL.
+// The server names it in its protected resource metadata (RFC 9728),
+// otherwise the origin of the server is assumed to be one
+func discover(ctx context.Context, client *http.Client, serverURL string) (*authServerMetadata, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	issuer := u.Scheme + "://" + u.Host
+
+	var resource struct {
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	found, err := getWellKnown(ctx, client, serverURL, "oauth-protected-resource", &resource)
+	if err != nil {
+		return nil, err
+	}
+	if found && len(resource.AuthorizationServers) > 0 {
+		issuer = resource.AuthorizationServers[0]
+	}
+
+	var meta authServerMetadata
+	for _, name := range []string{"oauth-authorization-server", "openid-configuration"} {
+		found, err := getWellKnown(ctx, client, issuer, name, &meta)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return &meta, nil
+		}
+	}
+
+	// Without metadata the spec falls back to these paths
+	base := strings.TrimSuffix(issuer, "/")
+	return &authServerMetadata{
+		AuthorizationEndpoint: base + "/authorize",
+		TokenEndpoint:         base + "/token",
+		RegistrationEndpoint:  base + "/register",
+	}, nil
+}
+
+// Decode the well-known document name of base into v, looked up with the path of base
+// appended first, then at the root. Reports false when neither exists
+func getWellKnown(ctx context.Context, client *http.Client, base, name string, v any) (bool, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return false, err
+	}
+	root := u.Scheme + "://" + u.Host + "/.well-known/" + name
+
+	candidates := []string{root}
+	if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+		candidates = []string{root + path, root}
+	}
+
+	for _, candidate := range candidates {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, candidate, nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch %s: %w", candidate, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			continue
+		}
+		err = json.NewDecoder(resp.Body).Decode(v)
+		resp.Body.Close()
+		if err != nil {
+			return false, fmt.Errorf("invalid metadata at %s: %w", candidate, err)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Register tinker as a public client redirecting to redirectURI, RFC 7591
+func register(ctx context.Context, client *http.Client, meta *authServerMetadata, redirectURI string) (oauthClient, error) {
+	if meta.RegistrationEndpoint == "" {
+		return oauthClient{}, errors.New("the authorization server does not support dynamic client registration")
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"client_name":                "tinker",
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+	if err != nil {
+		return oauthClient{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.RegistrationEndpoint, bytes.NewReader(payload))
+	if err != nil {
+		return oauthClient{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return oauthClient{}, fmt.Errorf("failed to register the client: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return oauthClient{}, fmt.Errorf("client registration failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var registered struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return oauthClient{}, fmt.Errorf("invalid client registration: %w", err)
+	}
+
+	return oauthClient{
+		TokenEndpoint: meta.TokenEndpoint,
+		ClientID:      registered.ClientID,
+		ClientSecret:  registered.ClientSecret,
+	}, nil
+}
+
+// Authorize tinker with the remote server at serverURL. The user grants access
+// at the URL passed to openURL, and the tokens go to the keyring
+func Login(ctx context.Context, serverURL string, openURL func(string) error) error {
+	return login(ctx, http.DefaultClient, keyringTokens{}, serverURL, openURL)
+}
+
+// Forget the tokens of the remote server at serverURL
+func Logout(serverURL string) error {
+	return keyringTokens{}.delete(serverURL)
+}
+
+func login(ctx context.Context, client *http.Client, store tokenStore, serverURL string, openURL func(string) error) error {
+	meta, err := discover(ctx, client, serverURL)
+	if err != nil {
+		return err
+	}
+
+	// The browser comes back to a one-off listener on the loopback interface
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen for the authorization response: %w", err)
+	}
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	registered, err := register(ctx, client, meta, redirectURI)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	verifier, state := randomToken(), randomToken()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", registered.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	query.Set("resource", serverURL)
+	authURL.RawQuery = query.Encode()
+
+	type callback struct {
+		code string
+		err  error
+	}
+	callbacks := make(chan callback, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		var cb callback
+		switch {
+		case q.Get("error") != "":
+			cb.err = fmt.Errorf("authorization denied: %s %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("state") != state:
+			cb.err = errors.New("authorization response does not match the request")
+		default:
+			cb.code = q.Get("code")
+		}
+
+		if cb.err != nil {
+			http.Error(w, cb.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "tinker is authorized, you can close this tab.")
+		}
+		select {
+		case callbacks <- cb:
+		default:
+		}
+	})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	if err := openURL(authURL.String()); err != nil {
+		return err
+	}
+
+	var cb callback
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case cb = <-callbacks:
+	}
+	if cb.err != nil {
+		return cb.err
+	}
+
+	token, err := requestToken(ctx, client, registered, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {cb.code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+		"resource":      {serverURL},
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.save(serverURL, token)
+}
+
+// Unguessable value for PKCE verifiers and states
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
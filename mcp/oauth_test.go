@@ -0,0 +1,215 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*oauthToken
+}
+
+func (m *memTokens) load(serverURL string) (*oauthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[serverURL], nil
+}
+
+func (m *memTokens) save(serverURL string, token *oauthToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = make(map[string]*oauthToken)
+	}
+	m.tokens[serverURL] = token
+	return nil
+}
+
+func (m *memTokens) delete(serverURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, serverURL)
+	return nil
+}
+
+// MCP endpoint at /mcp accepting only the access token "valid",
+// with its own authorization server issuing it
+type authServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	challenge string
+	refreshes int
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	a := &authServer{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"resource": a.URL + "/mcp", "authorization_servers": []string{a.URL + "/auth"}})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/auth", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": a.URL + "/auth/authorize",
+			"token_endpoint":         a.URL + "/auth/token",
+			"registration_endpoint":  a.URL + "/auth/register",
+		})
+	})
+	mux.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RedirectURIs []string `json:"redirect_uris"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Len(t, req.RedirectURIs, 1)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"client_id": "tinker-client"})
+	})
+	mux.HandleFunc("/auth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "tinker-client", q.Get("client_id"))
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		assert.Equal(t, a.URL+"/mcp", q.Get("resource"))
+		a.mu.Lock()
+		a.challenge = q.Get("code_challenge")
+		a.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {"code-1"}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "tinker-client", r.Form.Get("client_id"))
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+			if r.Form.Get("code") != "code-1" || base64.RawURLEncoding.EncodeToString(verifier[:]) != a.challenge {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			assert.Equal(t, "refresh-1", r.Form.Get("refresh_token"))
+			a.refreshes++
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "valid", "refresh_token": "refresh-1", "expires_in": 3600})
+	})
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	})
+
+	a.Server = httptest.NewServer(mux)
+	t.Cleanup(a.Close)
+	return a
+}
+
+// Ping the MCP endpoint of srv with the tokens of store
+func pingWithTokens(t *testing.T, srv *authServer, store tokenStore) error {
+	transport := NewHTTPTransport(srv.URL+"/mcp", nil)
+	transport.auth = newOAuthSession(srv.URL+"/mcp", store, srv.Client())
+
+	c := NewClient(transport)
+	c.Go(nil)
+	t.Cleanup(func() { c.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.Call(ctx, &ClientCallArgs{Method: "ping"}, nil)
+}
+
+func TestLogin(t *testing.T) {
+	srv := newAuthServer(t)
+	store := &memTokens{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The browser follows the redirect back to the listener of login
+	err := login(ctx, srv.Client(), store, srv.URL+"/mcp", func(authURL string) error {
+		resp, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	require.NoError(t, err)
+
+	token, _ := store.load(srv.URL + "/mcp")
+	require.NotNil(t, token)
+	assert.Equal(t, "valid", token.AccessToken)
+	assert.Equal(t, "refresh-1", token.RefreshToken)
+	assert.Equal(t, "tinker-client", token.ClientID)
+	assert.Equal(t, srv.URL+"/auth/token", token.TokenEndpoint)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+
+	assert.NoError(t, pingWithTokens(t, srv, store))
+}
+
+func TestLogin_Denied(t *testing.T) {
+	srv := newAuthServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := login(ctx, srv.Client(), &memTokens{}, srv.URL+"/mcp", func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		resp, err := http.Get(u.Query().Get("redirect_uri") + "?error=access_denied&state=" + u.Query().Get("state"))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	assert.ErrorContains(t, err, "access_denied")
+}
+
+func TestHTTPTransport_OAuthRefresh(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Time
+	}{
+		// Refreshed before the request is sent
+		{"expired", time.Now().Add(-time.Minute)},
+		// Refreshed after the server rejected it
+		{"revoked", time.Now().Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newAuthServer(t)
+			client := oauthClient{TokenEndpoint: srv.URL + "/auth/token", ClientID: "tinker-client"}
+			store := &memTokens{}
+			store.save(srv.URL+"/mcp", &oauthToken{oauthClient: client, AccessToken: "stale", RefreshToken: "refresh-1", Expiry: tt.expiry})
+
+			require.NoError(t, pingWithTokens(t, srv, store))
+			assert.Equal(t, 1, srv.refreshes)
+
+			token, _ := store.load(srv.URL + "/mcp")
+			assert.Equal(t, "valid", token.AccessToken)
+		})
+	}
+}
+
+func TestHTTPTransport_OAuthNotLoggedIn(t *testing.T) {
+	srv := newAuthServer(t)
+
+	err := pingWithTokens(t, srv, &memTokens{})
+	assert.ErrorContains(t, err, "tinker mcp login")
+	assert.Zero(t, srv.refreshes)
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Prompt template offered by a server, filled in with its arguments by "prompts/get"
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Defines the parameters for the "prompts/list" request.
+type PromptsListParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Defines the result for the "prompts/list" response.
+type PromptsListResult struct {
+	Prompts    []*Prompt `json:"prompts"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// Defines the parameters for the "prompts/get" request.
+type PromptsGetParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// Defines the result for the "prompts/get" response.
+type PromptsGetResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+type PromptMessage struct {
+	Role    string            `json:"role"`
+	Content ToolResultContent `json:"content"`
+}
+
+// Text of the prompt messages, one paragraph each. Non-text content is left out
+func (r PromptsGetResult) Text() string {
+	var parts []string
+	for _, msg := range r.Messages {
+		if msg.Content.Type == "text" && msg.Content.Text != "" {
+			parts = append(parts, msg.Content.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Whether the server announced prompts during the handshake
+func (s *Server) SupportsPrompts() bool {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+
+	_, ok := s.capabilities["prompts"]
+	return ok
+}
+
+func (s *Server) ListPrompts(ctx context.Context) ([]*Prompt, error) {
+	var listResult PromptsListResult
+
+	callArgs := ClientCallArgs{
+		Method: "prompts/list",
+		Params: &PromptsListParams{},
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Call(ctx, &callArgs, &listResult); err != nil {
+		return nil, fmt.Errorf("mcp server: jsonrpc call to 'prompts/list' failed: %w", err)
+	}
+
+	// TODO: Handle pagination using NextCursor
+	return listResult.Prompts, nil
+}
+
+func (s *Server) GetPrompt(ctx context.Context, name string, args map[string]string) (*PromptsGetResult, error) {
+	var getResult PromptsGetResult
+
+	callArgs := ClientCallArgs{
+		Method: "prompts/get",
+		Params: &PromptsGetParams{Name: name, Arguments: args},
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Call(ctx, &callArgs, &getResult); err != nil {
+		return nil, fmt.Errorf("mcp server: jsonrpc call to 'prompts/get' failed: %w", err)
+	}
+
+	return &getResult, nil
+}
@@ -1,9 +1,16 @@
 package mcp
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/invopop/jsonschema"
 )
 
+// Providers only accept tool names matching ^[a-zA-Z0-9_-]{1,64}$
+const MaxToolNameLength = 64
+
 // ToolResultContent defines the structure for content returned by a tool call.
 type ToolResultContent struct {
 	Type     string `json:"type"`               // "text" or "image"
@@ -26,6 +33,29 @@ type Tools []*Tool
 type ToolsCallParams struct {
 	Name      string         `json:"name"`
 	Arguments map[string]any `json:"arguments"`
+	// Carries the progressToken when the caller wants progress notifications
+	Meta map[string]any `json:"_meta,omitempty"`
+}
+
+// Defines the parameters for the "notifications/progress" notification.
+// Total is zero when the server does not know it
+type ProgressParams struct {
+	ProgressToken any     `json:"progressToken"`
+	Progress      float64 `json:"progress"`
+	Total         float64 `json:"total,omitempty"`
+	Message       string  `json:"message,omitempty"`
+}
+
+// Render the progress as e.g., "3/10 pages downloaded"
+func (p ProgressParams) String() string {
+	progress := strconv.FormatFloat(p.Progress, 'f', -1, 64)
+	if p.Total > 0 {
+		progress = fmt.Sprintf("%s/%s", progress, strconv.FormatFloat(p.Total, 'f', -1, 64))
+	}
+	if p.Message != "" {
+		return progress + " " + p.Message
+	}
+	return progress
 }
 
 // Defines the result for the "tools/call" response.
@@ -59,5 +89,27 @@ func (t Tools) ByName(name string) (*Tool, bool) {
 
 type ToolDetails struct {
 	Server *Server
-	Name   string
+	// Original tool name on the server, without the namespace
+	Name string
+}
+
+// Build the name a server tool is exposed under to the model, i.e., serverID_toolName.
+// Characters rejected by providers are replaced and the result is capped in length.
+func NamespacedToolName(serverID, toolName string) string {
+	name := sanitizeToolName(serverID) + "_" + sanitizeToolName(toolName)
+	if len(name) > MaxToolNameLength {
+		name = name[:MaxToolNameLength]
+	}
+	return name
+}
+
+func sanitizeToolName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
 }
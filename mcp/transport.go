@@ -1,12 +1,15 @@
 package mcp
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"net/http"
 	"strings"
+	"sync"
 )
 
 // Handle sending and receiving of byte payloads
@@ -75,11 +78,205 @@ func (t *stdioTransport) Receive(ctx context.Context) ([]byte, error) {
 
 func (t *stdioTransport) Close() error {
 	if t.closer != nil {
-		err := t.closer.Close()
-		if strings.Contains(err.Error(), "file already closed") || err == os.ErrClosed {
-			return nil
+		if err := t.closer.Close(); err != nil && !isClosedErr(err) {
+			return err
 		}
+	}
+	return nil
+}
+
+const sessionIDHeader = "Mcp-Session-Id"
+
+// Handle sending and receiving of byte payloads
+// to a remote server over the streamable HTTP transport.
+// Each payload is POSTed to the endpoint and the server answers
+// either with a single JSON body or an SSE stream of messages.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	// Assigned by the server during initialization
+	sessionID string
+	sessionMu sync.Mutex
+	incoming  chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+	// Tokens from 'tinker mcp login', nil when the headers carry the credentials
+	auth *oauthSession
+}
+
+func NewHTTPTransport(url string, headers map[string]string) *httpTransport {
+	return &httpTransport{
+		url:      url,
+		headers:  headers,
+		client:   &http.Client{},
+		incoming: make(chan []byte),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (t *httpTransport) Send(ctx context.Context, payload []byte) error {
+	resp, token, err := t.post(ctx, payload)
+	if err != nil {
 		return err
 	}
+
+	// The token may be revoked or expire early, refresh it and try once more
+	if resp.StatusCode == http.StatusUnauthorized && t.auth != nil {
+		retry, err := t.auth.refresh(ctx, token)
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+		if retry {
+			resp.Body.Close()
+			if resp, _, err = t.post(ctx, payload); err != nil {
+				return err
+			}
+		}
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(sessionIDHeader); id != "" {
+		t.sessionMu.Lock()
+		t.sessionID = id
+		t.sessionMu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("remote server rejected credentials (%d): check the configured headers or log in with 'tinker mcp login'", resp.StatusCode)
+	case resp.StatusCode == http.StatusAccepted:
+		// Notifications and responses have no body
+		return nil
+	case resp.StatusCode >= 400:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("remote server error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return t.readEventStream(ctx, resp.Body)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	return t.deliver(ctx, body)
+}
+
+// POST payload with the session and credentials, along with the access token sent
+func (t *httpTransport) post(ctx context.Context, payload []byte) (*http.Response, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	var token string
+	if t.auth != nil {
+		if token, err = t.auth.accessToken(ctx); err != nil {
+			return nil, "", err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	t.sessionMu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionIDHeader, t.sessionID)
+	}
+	t.sessionMu.Unlock()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to send payload: %w", err)
+	}
+	return resp, token, nil
+}
+
+// Forward every "data" event of an SSE stream to the listener
+func (t *httpTransport) readEventStream(ctx context.Context, body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			// Blank line terminates an event
+			if data.Len() > 0 {
+				if err := t.deliver(ctx, bytes.Clone(data.Bytes())); err != nil {
+					return err
+				}
+				data.Reset()
+			}
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+
+	if data.Len() > 0 {
+		if err := t.deliver(ctx, data.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (t *httpTransport) deliver(ctx context.Context, payload []byte) error {
+	select {
+	case t.incoming <- payload:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (t *httpTransport) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.closed:
+		return nil, io.ErrClosedPipe
+	case data := <-t.incoming:
+		return data, nil
+	}
+}
+
+// Header names are case-insensitive
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *httpTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+	})
 	return nil
 }
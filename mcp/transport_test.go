@@ -0,0 +1,74 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPTransport_JSONResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","method":"ping","id":1}`, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(sessionIDHeader, "session-1")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer srv.Close()
+
+	transport := NewHTTPTransport(srv.URL, map[string]string{"Authorization": "Bearer test-token"})
+	defer transport.Close()
+
+	c := NewClient(transport)
+	c.Go(nil)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.Call(ctx, &ClientCallArgs{Method: "ping"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "session-1", transport.sessionID)
+}
+
+func TestHTTPTransport_EventStreamResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"tools\":[]}}\n\n"))
+	}))
+	defer srv.Close()
+
+	transport := NewHTTPTransport(srv.URL, nil)
+
+	c := NewClient(transport)
+	c.Go(nil)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result ToolsListResult
+	err := c.Call(ctx, &ClientCallArgs{Method: "tools/list"}, &result)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Tools)
+}
+
+func TestHTTPTransport_Unauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	transport := NewHTTPTransport(srv.URL, nil)
+	defer transport.Close()
+
+	err := transport.Send(context.Background(), []byte(`{"jsonrpc":"2.0","method":"ping","id":1}`))
+	assert.ErrorContains(t, err, "rejected credentials")
+}
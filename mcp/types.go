@@ -2,10 +2,16 @@ package mcp
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 const jsonrpcver = "2.0"
@@ -25,13 +31,14 @@ type Request struct {
 	// TODO: Why not make it a constant?
 	Method string `json:"method"`
 	Params any    `json:"params,omitempty"`
-	ID     any    `json:"id,omitempty"`
+	// Nil for notifications
+	ID *ID `json:"id,omitempty"`
 }
 
 type RequestArgs struct {
 	Method string
 	Params any
-	ID     any
+	ID     *ID
 }
 
 // Defines the parameters for the "initialize" request.
@@ -62,7 +69,7 @@ type Response struct {
 	JSONRPC string           `json:"jsonrpc"`
 	Result  *json.RawMessage `json:"result,omitempty"`
 	Error   *Error           `json:"error,omitempty"`
-	ID      any              `json:"id"`
+	ID      ID               `json:"id"`
 }
 
 type Error struct {
@@ -95,6 +102,153 @@ const mcpConfigFile = "mcp_servers.json"
 type ServerConfig struct {
 	ID      string
 	Command string
+	// Extra environment variables for the server process.
+	// Values support ${VAR} expansion from the parent environment
+	// and ${file:/path/to/secret} references so secrets stay out of the config file.
+	Env map[string]string `json:",omitempty"`
+	// Working directory of the server process. Defaults to the current directory
+	Cwd string `json:",omitempty"`
+	// Endpoint of a remote server speaking the streamable HTTP transport.
+	// When set, Command is ignored and no subprocess is spawned
+	URL string `json:",omitempty"`
+	// Extra HTTP headers sent to a remote server e.g., "Authorization": "Bearer ${API_TOKEN}".
+	// Values are expanded the same way as Env
+	Headers map[string]string `json:",omitempty"`
+	// How long the server gets to finish the initialization handshake
+	// before it is skipped. Zero means the default
+	StartupTimeout Duration `json:",omitempty"`
+	// How long a single tool call may run before it is abandoned. Zero means DefaultCallTimeout
+	CallTimeout Duration `json:",omitempty"`
+	// Only expose these tools of the server, by original name. Glob patterns are allowed e.g., "read_*".
+	// Empty means every tool
+	IncludeTools []string `json:",omitempty"`
+	// Hide these tools of the server, applied after IncludeTools
+	ExcludeTools []string `json:",omitempty"`
+}
+
+// Identify the server across sessions by what is actually launched,
+// so editing the command invalidates its cached tools
+func (c ServerConfig) CacheKey() string {
+	target := c.Command
+	if c.IsRemote() {
+		target = c.URL
+	}
+
+	sum := sha256.Sum256([]byte(target + "\x00" + c.Cwd))
+	return hex.EncodeToString(sum[:])
+}
+
+// Report whether a tool of the server passes the include/exclude filters
+func (c ServerConfig) AllowsTool(name string) bool {
+	if len(c.IncludeTools) > 0 && !matchesAny(c.IncludeTools, name) {
+		return false
+	}
+
+	return !matchesAny(c.ExcludeTools, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if p == name {
+			return true
+		}
+		// Malformed patterns simply never match
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Duration is a time.Duration stored as a human readable string e.g., "30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string e.g., \"30s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (c ServerConfig) IsRemote() bool {
+	return c.URL != ""
+}
+
+// Resolve the configured headers for a remote server
+func (c ServerConfig) ResolveHeaders() (map[string]string, error) {
+	headers := make(map[string]string, len(c.Headers))
+	for k, v := range c.Headers {
+		expanded, err := ExpandValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("mcp server %s: header %s: %w", c.ID, k, err)
+		}
+		headers[k] = expanded
+	}
+
+	return headers, nil
+}
+
+// Resolve the configured environment into KEY=VALUE pairs
+// ready to be appended to the parent environment of the server process.
+func (c ServerConfig) ResolveEnv() ([]string, error) {
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	// Deterministic order, mostly for tests
+	sort.Strings(keys)
+
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v, err := ExpandValue(c.Env[k])
+		if err != nil {
+			return nil, fmt.Errorf("mcp server %s: env %s: %w", c.ID, k, err)
+		}
+		env = append(env, k+"="+v)
+	}
+
+	return env, nil
+}
+
+// Expand ${VAR} from the environment and ${file:/path/to/secret} to the trimmed content of the file
+func ExpandValue(value string) (string, error) {
+	var expandErr error
+
+	expanded := os.Expand(value, func(ref string) string {
+		if path, ok := strings.CutPrefix(ref, "file:"); ok {
+			if strings.HasPrefix(path, "~/") {
+				if home, err := os.UserHomeDir(); err == nil {
+					path = filepath.Join(home, path[2:])
+				}
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				expandErr = fmt.Errorf("failed to read secret reference %q: %w", path, err)
+				return ""
+			}
+			return strings.TrimSpace(string(content))
+		}
+		return os.Getenv(ref)
+	})
+
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	return expanded, nil
 }
 
 func SaveConfigs(configs []ServerConfig) error {
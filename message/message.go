@@ -1,8 +1,13 @@
 package message
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,6 +21,19 @@ type Message struct {
 	ID        string    `json:"id,omitempty" db:"id"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	Sequence  int       `json:"-" db:"sequence_number"`
+	// Model that wrote an assistant message and the tokens it took, kept for usage stats
+	Model string `json:"model,omitempty"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Tokens of the inference call that produced a message
+type Usage struct {
+	InputTokens      int64 `json:"input_tokens"`
+	OutputTokens     int64 `json:"output_tokens"`
+	CacheReadTokens  int64 `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int64 `json:"cache_write_tokens,omitempty"`
+	// From sending the request to the end of the reply
+	LatencyMs int64 `json:"latency_ms,omitempty"`
 }
 
 const (
@@ -31,6 +49,8 @@ const (
 	ToolUseType    = "tool_use"
 	ToolResultType = "tool_result"
 	ThoughtType    = "thought"
+	ImageType      = "image"
+	CitationType   = "citation"
 )
 
 // Here so we can marshal/unmarshal content blocks
@@ -42,6 +62,8 @@ func (t TextBlock) Type() string       { return TextType }
 func (t ToolUseBlock) Type() string    { return ToolUseType }
 func (t ToolResultBlock) Type() string { return ToolResultType }
 func (t ThoughtBlock) Type() string    { return ThoughtType }
+func (t ImageBlock) Type() string      { return ImageType }
+func (t CitationBlock) Type() string   { return CitationType }
 
 type TextBlock struct {
 	Text string `json:"text"`
@@ -53,6 +75,32 @@ func NewTextBlock(text string) ContentBlock {
 	}
 }
 
+// Contents of a file the user attached, wrapped so the model can tell it apart from the prompt
+func NewFileBlock(path, content string) ContentBlock {
+	return TextBlock{
+		Text: fmt.Sprintf("<file path=%s>\n%s\n</file>", strconv.Quote(path), content),
+	}
+}
+
+// Path of the file held by a block made with NewFileBlock
+func (t TextBlock) AttachedFile() (string, bool) {
+	rest, ok := strings.CutPrefix(t.Text, "<file path=")
+	if !ok || !strings.HasSuffix(rest, "\n</file>") {
+		return "", false
+	}
+
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil || !strings.HasPrefix(rest[len(quoted):], ">\n") {
+		return "", false
+	}
+
+	path, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
 type ToolUseBlock struct {
 	ID    string          `json:"id"`
 	Name  string          `json:"name"`
@@ -74,6 +122,8 @@ type ToolResultBlock struct {
 	ToolName  string `json:"tool_name"`
 	Content   string `json:"content"`
 	IsError   bool   `json:"is_error,omitempty"`
+	// Set in place of Content while it is stored apart from the message
+	Attachment string `json:"attachment,omitempty"`
 }
 
 func NewToolResultBlock(toolUseID, toolName, content string, isError bool) ContentBlock {
@@ -95,6 +145,108 @@ func NewThoughtBlock(thought json.RawMessage) ContentBlock {
 	}
 }
 
+// Image sent by the user, for models that accept them
+type ImageBlock struct {
+	// e.g., image/png
+	MediaType string `json:"media_type"`
+	// Base64 encoded, as the providers take it
+	Data string `json:"data"`
+	// Where the image came from, shown in place of it
+	Name string `json:"name,omitempty"`
+	// Set in place of Data while it is stored apart from the message
+	Attachment string `json:"attachment,omitempty"`
+}
+
+func NewImageBlock(mediaType string, data []byte, name string) ContentBlock {
+	return ImageBlock{
+		MediaType: mediaType,
+		Data:      base64.StdEncoding.EncodeToString(data),
+		Name:      name,
+	}
+}
+
+// Decoded size in bytes
+func (t ImageBlock) Size() int {
+	return base64.StdEncoding.DecodedLen(len(t.Data))
+}
+
+// Stands in for the image where it cannot be shown e.g., "[image: shot.png, 120 KB]"
+func (t ImageBlock) Placeholder() string {
+	name := t.Name
+	if name == "" {
+		name = t.MediaType
+	}
+	return fmt.Sprintf("[image: %s, %d KB]", name, (t.Size()+1023)/1024)
+}
+
+// Source an answer of the agent is based on, a file it read or a web page it fetched.
+// Kept for the reader, providers never get it
+type CitationBlock struct {
+	// Path of the file or URL of the page
+	Source string `json:"source"`
+	// Lines of the quote, 1-based and inclusive. Zero when the whole source is cited
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Quote     string `json:"quote,omitempty"`
+}
+
+func NewCitationBlock(source string, startLine, endLine int, quote string) ContentBlock {
+	return CitationBlock{
+		Source:    source,
+		StartLine: startLine,
+		EndLine:   endLine,
+		Quote:     quote,
+	}
+}
+
+func (t CitationBlock) IsURL() bool {
+	return strings.HasPrefix(t.Source, "http://") || strings.HasPrefix(t.Source, "https://")
+}
+
+// Source with its line range, e.g., "agent/agent.go:12-20"
+func (t CitationBlock) Reference() string {
+	switch {
+	case t.StartLine <= 0:
+		return t.Source
+	case t.EndLine <= t.StartLine:
+		return fmt.Sprintf("%s:%d", t.Source, t.StartLine)
+	default:
+		return fmt.Sprintf("%s:%d-%d", t.Source, t.StartLine, t.EndLine)
+	}
+}
+
+// Where a reference to the source leads, file:// for absolute paths.
+// Relative paths stay relative, to wherever the reference is shown
+func (t CitationBlock) Link() string {
+	if t.IsURL() {
+		return t.Source
+	}
+	link := &url.URL{Path: filepath.ToSlash(t.Source)}
+	if filepath.IsAbs(t.Source) {
+		link.Scheme = "file"
+	}
+	return link.String()
+}
+
+// Stands in for content that was redacted
+const RedactedText = "[redacted]"
+
+// Tombstone of block. Tool calls and results keep their ids and names,
+// providers reject results without the call they answer. Citations stay citations
+func Redact(block ContentBlock) ContentBlock {
+	switch b := block.(type) {
+	case ToolUseBlock:
+		return ToolUseBlock{ID: b.ID, Name: b.Name, Input: json.RawMessage(`{}`), Thought: b.Thought}
+	case ToolResultBlock:
+		return ToolResultBlock{ToolUseID: b.ToolUseID, ToolName: b.ToolName, Content: RedactedText, IsError: b.IsError}
+	case CitationBlock:
+		// Still kept from providers
+		return CitationBlock{Source: RedactedText}
+	default:
+		return TextBlock{Text: RedactedText}
+	}
+}
+
 // Custom JSON marshaling for Message to handle ContentBlock interface
 func (m *Message) MarshalJSON() ([]byte, error) {
 	type MessageAlias Message
@@ -109,6 +261,14 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 		ToolName  string          `json:"tool_name,omitempty"`
 		Content   string          `json:"content,omitempty"`
 		IsError   bool            `json:"is_error,omitempty"`
+		MediaType string          `json:"media_type,omitempty"`
+		Data      string          `json:"data,omitempty"`
+		// Shared by images and tool results
+		Attachment string `json:"attachment,omitempty"`
+		Source     string `json:"source,omitempty"`
+		StartLine  int    `json:"start_line,omitempty"`
+		EndLine    int    `json:"end_line,omitempty"`
+		Quote      string `json:"quote,omitempty"`
 	}
 
 	temp := struct {
@@ -126,9 +286,13 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 		case ToolUseBlock:
 			temp.Content[i] = contentWithType{Type: ToolUseType, ID: b.ID, Name: b.Name, Input: b.Input, Thought: b.Thought}
 		case ToolResultBlock:
-			temp.Content[i] = contentWithType{Type: ToolResultType, ToolUseID: b.ToolUseID, ToolName: b.ToolName, Content: b.Content, IsError: b.IsError}
+			temp.Content[i] = contentWithType{Type: ToolResultType, ToolUseID: b.ToolUseID, ToolName: b.ToolName, Content: b.Content, IsError: b.IsError, Attachment: b.Attachment}
 		case ThoughtBlock:
 			temp.Content[i] = contentWithType{Type: ThoughtType, Thought: b.Thought}
+		case ImageBlock:
+			temp.Content[i] = contentWithType{Type: ImageType, MediaType: b.MediaType, Data: b.Data, Name: b.Name, Attachment: b.Attachment}
+		case CitationBlock:
+			temp.Content[i] = contentWithType{Type: CitationType, Source: b.Source, StartLine: b.StartLine, EndLine: b.EndLine, Quote: b.Quote}
 		default:
 			return nil, fmt.Errorf("unknown content block type: %T", block)
 		}
@@ -151,6 +315,14 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 		ToolName  string          `json:"tool_name,omitempty"`
 		Content   string          `json:"content,omitempty"`
 		IsError   bool            `json:"is_error,omitempty"`
+		MediaType string          `json:"media_type,omitempty"`
+		Data      string          `json:"data,omitempty"`
+		// Shared by images and tool results
+		Attachment string `json:"attachment,omitempty"`
+		Source     string `json:"source,omitempty"`
+		StartLine  int    `json:"start_line,omitempty"`
+		EndLine    int    `json:"end_line,omitempty"`
+		Quote      string `json:"quote,omitempty"`
 	}
 
 	temp := struct {
@@ -172,9 +344,13 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 		case ToolUseType:
 			m.Content[i] = ToolUseBlock{ID: c.ID, Name: c.Name, Input: c.Input, Thought: c.Thought}
 		case ToolResultType:
-			m.Content[i] = ToolResultBlock{ToolUseID: c.ToolUseID, ToolName: c.ToolName, Content: c.Content, IsError: c.IsError}
+			m.Content[i] = ToolResultBlock{ToolUseID: c.ToolUseID, ToolName: c.ToolName, Content: c.Content, IsError: c.IsError, Attachment: c.Attachment}
 		case ThoughtType:
 			m.Content[i] = ThoughtBlock{Thought: c.Thought}
+		case ImageType:
+			m.Content[i] = ImageBlock{MediaType: c.MediaType, Data: c.Data, Name: c.Name, Attachment: c.Attachment}
+		case CitationType:
+			m.Content[i] = CitationBlock{Source: c.Source, StartLine: c.StartLine, EndLine: c.EndLine, Quote: c.Quote}
 		default:
 			return fmt.Errorf("unknown content block type: %s", c.Type)
 		}
@@ -1,31 +1,158 @@
 package prompts
 
 import (
-	_ "embed"
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"text/template"
+	"time"
+
+	"github.com/honganh1206/tinker/config"
+	"github.com/honganh1206/tinker/utils"
+)
+
+// System prompts, one per provider, each overridable by a file of the same name
+const (
+	Claude = "claude"
+	Gemini = "gemini"
 )
 
-//go:embed claude.md
-var claudeSystemPrompt string
+var Names = []string{Claude, Gemini}
+
+//go:embed claude.md gemini.md environment.md
+var builtin embed.FS
+
+// Directory of the override files
+const dirName = "prompts"
 
-// TODO: Parameterize this with LLM provider name
-func ClaudeSystemPrompt() string {
-	trimmedPrompt := strings.TrimSpace(string(claudeSystemPrompt))
-	if len(trimmedPrompt) == 0 {
-		return claudeSystemPrompt
+// What a system prompt template can refer to, e.g., {{.Workspace}} or {{join .Tools ", "}}
+type Data struct {
+	// Working directory of the agent
+	Workspace string
+	// Directories the user gave access to besides the workspace, absolute
+	Dirs []string
+	// As runtime.GOOS reports it, e.g., linux or darwin
+	OS string
+	// Today, as 2006-01-02
+	Date string
+	// Names of the tools offered to the model
+	Tools []string
+}
+
+// Data of this process, for an agent working in the current directory and dirs
+func NewData(dirs []string) Data {
+	cwd, _ := os.Getwd()
+	return Data{
+		Workspace: cwd,
+		Dirs:      dirs,
+		OS:        runtime.GOOS,
+		Date:      time.Now().Format(time.DateOnly),
 	}
+}
 
-	return trimmedPrompt
+// A system prompt template, the built-in one or an override of it
+type Prompt struct {
+	Name string
+	// File the template was read from, empty for the built-in one
+	Path string
+	// The template before rendering
+	Source string
+	tmpl   *template.Template
 }
 
-//go:embed gemini.md
-var geminiSystemPrompt string
+// Directory of the user's override files, next to the user config
+func UserDir() (string, error) {
+	path, err := config.UserPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), dirName), nil
+}
+
+// Directory of the override files of the project rooted at project, meant to be committed with it
+func ProjectDir(project string) string {
+	return filepath.Join(filepath.Dir(config.ProjectPath(project)), dirName)
+}
+
+// The prompt called name as it applies in the current project: the project's
+// override first, then the user's, then the built-in one
+func Load(name string) (*Prompt, error) {
+	builtinSource, err := fs.ReadFile(builtin, name+".md")
+	if err != nil {
+		return nil, fmt.Errorf("unknown prompt %q, want one of %s", name, strings.Join(Names, ", "))
+	}
+
+	var dirs []string
+	if project := utils.CurrentProject(); project != "" {
+		dirs = append(dirs, ProjectDir(project))
+	}
+	if dir, err := UserDir(); err == nil {
+		dirs = append(dirs, dir)
+	}
 
-func GeminiSystemPrompt() string {
-	trimmedPrompt := strings.TrimSpace(string(geminiSystemPrompt))
-	if len(trimmedPrompt) == 0 {
-		return geminiSystemPrompt
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name+".md")
+		source, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parse(name, path, string(source))
 	}
 
-	return trimmedPrompt
+	return parse(name, "", string(builtinSource))
+}
+
+func parse(name, path, source string) (*Prompt, error) {
+	environment, err := fs.ReadFile(builtin, "environment.md")
+	if err != nil {
+		return nil, err
+	}
+
+	// Overrides can include the environment section with {{template "environment" .}}
+	tmpl, err := template.New(name).
+		Funcs(template.FuncMap{"join": strings.Join}).
+		Option("missingkey=error").
+		Parse(string(environment))
+	if err == nil {
+		tmpl, err = tmpl.Parse(source)
+	}
+	if err != nil {
+		return nil, promptError(path, err)
+	}
+
+	return &Prompt{Name: name, Path: path, Source: source, tmpl: tmpl}, nil
+}
+
+// The prompt with the values of data filled in
+func (p *Prompt) Render(data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return "", promptError(p.Path, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Point at the override file when it is the one that is broken
+func promptError(path string, err error) error {
+	if path == "" {
+		return err
+	}
+	return fmt.Errorf("prompt %s: %w", path, err)
+}
+
+//go:embed review.md
+var reviewPrompt string
+
+// Instructions for reviewing a diff, asking for the findings as JSON
+func ReviewPrompt() string {
+	return strings.TrimSpace(reviewPrompt)
 }
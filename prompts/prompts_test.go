@@ -0,0 +1,120 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Work in a fresh repository with the user config in a temporary directory
+func isolate(t *testing.T) string {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	project := t.TempDir()
+	if err := os.Mkdir(filepath.Join(project, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+	return project
+}
+
+func writePrompt(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name+".md")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Builtin(t *testing.T) {
+	isolate(t)
+
+	for _, name := range Names {
+		prompt, err := Load(name)
+		if err != nil {
+			t.Fatalf("Load(%q) error = %v", name, err)
+		}
+		if prompt.Path != "" {
+			t.Errorf("Load(%q) read %s, want the built-in prompt", name, prompt.Path)
+		}
+
+		text, err := prompt.Render(Data{Workspace: "/work", OS: "linux", Date: "2026-01-02", Dirs: []string{"/other"}, Tools: []string{"bash", "read_file"}})
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		for _, want := range []string{"Working directory: /work", "Operating system: linux", "Today's date: 2026-01-02", "- /other", "Tools you can use: bash, read_file"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s prompt misses %q", name, want)
+			}
+		}
+	}
+
+	if _, err := Load("review"); err == nil {
+		t.Error("Load() of an unknown prompt succeeded")
+	}
+}
+
+func TestLoad_Overrides(t *testing.T) {
+	project := isolate(t)
+	userDir, err := UserDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userPath := writePrompt(t, userDir, Claude, "User prompt on {{.OS}}")
+	prompt, err := Load(Claude)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if prompt.Path != userPath {
+		t.Errorf("Load() read %q, want the user override %q", prompt.Path, userPath)
+	}
+	if text, _ := prompt.Render(Data{OS: "darwin"}); text != "User prompt on darwin" {
+		t.Errorf("Render() = %q, want the user override filled in", text)
+	}
+
+	projectPath := writePrompt(t, ProjectDir(project), Claude, "Project prompt\n\n{{template \"environment\" .}}")
+	prompt, err = Load(Claude)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if prompt.Path != projectPath {
+		t.Errorf("Load() read %q, want the project override %q", prompt.Path, projectPath)
+	}
+	text, err := prompt.Render(Data{Workspace: "/work"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !strings.HasPrefix(text, "Project prompt") || !strings.Contains(text, "Working directory: /work") {
+		t.Errorf("Render() = %q, want the project override with the environment", text)
+	}
+
+	// The other prompts are still the built-in ones
+	if prompt, err := Load(Gemini); err != nil || prompt.Path != "" {
+		t.Errorf("Load(%q) = %v, %v, want the built-in prompt", Gemini, prompt, err)
+	}
+}
+
+func TestLoad_Broken(t *testing.T) {
+	project := isolate(t)
+	path := writePrompt(t, ProjectDir(project), Gemini, "{{.Workspace")
+
+	_, err := Load(Gemini)
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Load() error = %v, want one naming %s", err, path)
+	}
+
+	writePrompt(t, ProjectDir(project), Gemini, "{{.Nope}}")
+	prompt, err := Load(Gemini)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, err := prompt.Render(Data{}); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Render() error = %v, want one naming %s", err, path)
+	}
+}
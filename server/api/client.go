@@ -2,14 +2,23 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/config"
 	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tinkererr"
 )
 
 type HTTPError struct {
@@ -21,36 +30,94 @@ func (e *HTTPError) Error() string {
 	return fmt.Sprintf("server error (%d): %s", e.StatusCode, e.Message)
 }
 
+// Kind of failure the status code reports, so callers can check e.g. errors.Is(err, tinkererr.NotFound)
+func (e *HTTPError) Is(target error) bool {
+	kind, ok := target.(tinkererr.Kind)
+	if !ok {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return kind == tinkererr.NotFound
+	case http.StatusTooManyRequests:
+		return kind == tinkererr.RateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return kind == tinkererr.PermissionDenied
+	default:
+		return false
+	}
+}
+
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	// Dials the unix socket of the server, nil over TCP
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Bearer token sent with every request
+	token string
+	// Messages of each conversation known to be stored, saves only send the ones after them
+	savedMu sync.Mutex
+	saved   map[string]int
 }
 
 func NewClient(baseURL string) *Client {
 	if baseURL == "" {
-		baseURL = "http://localhost:11435"
+		// An invalid config still leaves the default port in place
+		cfg, _ := config.Load()
+		baseURL = cfg.URL()
 	}
-	return &Client{
+	c := &Client{
 		baseURL:    baseURL,
 		httpClient: &http.Client{},
+		token:      LoadToken(),
+		saved:      make(map[string]int),
+	}
+
+	// unix:///path/to/tinker.sock sends every request through the socket, the host is never resolved
+	if socket, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		c.dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		c.baseURL = "http://unix"
+		c.httpClient = &http.Client{Transport: &http.Transport{DialContext: c.dial}}
+	}
+
+	return c
+}
+
+// Authenticate with the given token instead of the one found by LoadToken
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
 }
 
-func (c *Client) CreateConversation() (*data.Conversation, error) {
+// Start a conversation in project, the git root it belongs to, empty when unknown
+func (c *Client) CreateConversation(project string) (*data.Conversation, error) {
+	reqBody := map[string]string{
+		"project": project,
+	}
 	var result map[string]string
-	if err := c.doRequest(http.MethodPost, "/conversations", nil, &result); err != nil {
+	if err := c.doRequest(http.MethodPost, "/conversations", reqBody, &result); err != nil {
 		return nil, err
 	}
 
 	return &data.Conversation{
 		ID:       result["id"],
+		Project:  project,
 		Messages: make([]*message.Message, 0),
 	}, nil
 }
 
-func (c *Client) ListConversations() ([]data.ConversationMetadata, error) {
+// List the conversations matching filter, most recently active first
+func (c *Client) ListConversations(filter data.ListFilter) ([]data.ConversationMetadata, error) {
 	var conversations []data.ConversationMetadata
-	if err := c.doRequest(http.MethodGet, "/conversations", nil, &conversations); err != nil {
+	if err := c.doRequest(http.MethodGet, "/conversations"+filterQuery(filter), nil, &conversations); err != nil {
 		return nil, err
 	}
 
@@ -60,21 +127,248 @@ func (c *Client) ListConversations() ([]data.ConversationMetadata, error) {
 func (c *Client) GetConversation(id string) (*data.Conversation, error) {
 	var conv data.Conversation
 	if err := c.doRequest(http.MethodGet, "/conversations/"+id, nil, &conv); err != nil {
-		var httpErr *HTTPError
-		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		if errors.Is(err, tinkererr.NotFound) {
 			return nil, data.ErrConversationNotFound
 		}
 		return nil, err
 	}
+	c.markSaved(&conv)
 
 	return &conv, nil
 }
 
+// Conversation along with its plan in one request, the plan is nil when it has none
+func (c *Client) GetConversationWithPlan(id string) (*data.Conversation, *data.Plan, error) {
+	var resp struct {
+		data.Conversation
+		Plan *data.Plan
+	}
+	if err := c.doRequest(http.MethodGet, "/conversations/"+id+"?include=plan", nil, &resp); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return nil, nil, data.ErrConversationNotFound
+		}
+		return nil, nil, err
+	}
+	c.markSaved(&resp.Conversation)
+
+	return &resp.Conversation, resp.Plan, nil
+}
+
+// Persist the messages added since the last save. A history that was rewritten in between,
+// e.g., compacted, or a conversation the server does not know yet is stored in full instead
 func (c *Client) SaveConversation(conv *data.Conversation) error {
+	c.savedMu.Lock()
+	from := c.saved[conv.ID]
+	c.savedMu.Unlock()
+
+	if from > len(conv.Messages) {
+		return c.ReplaceConversation(conv)
+	}
+
+	reqBody := map[string]any{
+		"from":     from,
+		"messages": conv.Messages[from:],
+	}
+	var result struct {
+		Count int `json:"count"`
+	}
+
+	err := c.doRequest(http.MethodPost, "/conversations/"+conv.ID+"/messages", reqBody, &result)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusNotFound || httpErr.StatusCode == http.StatusConflict) {
+		return c.ReplaceConversation(conv)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The server skipped messages it already had, but holds a different number of them
+	if result.Count != len(conv.Messages) {
+		return c.ReplaceConversation(conv)
+	}
+	c.markSaved(conv)
+
+	return nil
+}
+
+// Overwrite the stored history with conv, for repairs and rewritten histories
+func (c *Client) ReplaceConversation(conv *data.Conversation) error {
 	path := fmt.Sprintf("/conversations/%s", conv.ID)
 	if err := c.doRequest(http.MethodPut, path, conv, nil); err != nil {
-		var httpErr *HTTPError
-		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		if errors.Is(err, tinkererr.NotFound) {
+			return data.ErrConversationNotFound
+		}
+		return err
+	}
+	c.markSaved(conv)
+
+	return nil
+}
+
+func (c *Client) markSaved(conv *data.Conversation) {
+	c.savedMu.Lock()
+	defer c.savedMu.Unlock()
+	c.saved[conv.ID] = len(conv.Messages)
+}
+
+func (c *Client) SearchConversations(query string, limit int) ([]data.SearchResult, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	var results []data.SearchResult
+	if err := c.doRequest(http.MethodGet, "/conversations/search?"+params.Encode(), nil, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Usage over the conversations active since then, of every project when project is empty.
+// All time when since is zero
+func (c *Client) Stats(since time.Time, project string) (*data.Stats, error) {
+	params := url.Values{}
+	if !since.IsZero() {
+		params.Set("since", since.Format(time.RFC3339))
+	}
+	if project != "" {
+		params.Set("project", project)
+	}
+
+	var stats data.Stats
+	if err := c.doRequest(http.MethodGet, "/stats?"+params.Encode(), nil, &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// Set the title of a conversation, an empty one clears it
+func (c *Client) RenameConversation(id, title string) error {
+	reqBody := map[string]string{"title": title}
+	if err := c.doRequest(http.MethodPatch, "/conversations/"+id, reqBody, nil); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return data.ErrConversationNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Start a new conversation from the first at messages of conversation id,
+// a negative at takes all of them
+func (c *Client) ForkConversation(id string, at int) (*data.Conversation, error) {
+	reqBody := map[string]int{}
+	if at >= 0 {
+		reqBody["at"] = at
+	}
+
+	var fork data.Conversation
+	if err := c.doRequest(http.MethodPost, "/conversations/"+id+"/fork", reqBody, &fork); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return nil, data.ErrConversationNotFound
+		}
+		return nil, err
+	}
+
+	return &fork, nil
+}
+
+// Replace a content block of message sequence with a tombstone, the whole message when block is negative
+func (c *Client) RedactMessage(id string, sequence, block int) error {
+	reqBody := map[string]int{"sequence": sequence}
+	if block >= 0 {
+		reqBody["block"] = block
+	}
+
+	return c.doRequest(http.MethodPost, "/conversations/"+id+"/redact", reqBody, nil)
+}
+
+// Store what compaction made of some messages, so the conversation is sent compacted once loaded again
+func (c *Client) AddSummary(id string, summary *data.Summary) error {
+	if err := c.doRequest(http.MethodPost, "/conversations/"+id+"/summaries", summary, nil); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return data.ErrConversationNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Move the messages of a conversation into an archive file on the server,
+// leaving it out of listings until it is unarchived
+func (c *Client) ArchiveConversation(id string) error {
+	return c.doArchiveRequest(id, "archive")
+}
+
+// Put the messages of an archived conversation back
+func (c *Client) UnarchiveConversation(id string) error {
+	return c.doArchiveRequest(id, "unarchive")
+}
+
+func (c *Client) doArchiveRequest(id, action string) error {
+	if err := c.doRequest(http.MethodPost, "/conversations/"+id+"/"+action, nil, nil); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return data.ErrConversationNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Attach a tag to a conversation or plan, resourceType being data.TagConversation or data.TagPlan
+func (c *Client) Tag(resourceType, id, tag string) error {
+	return c.doTagRequest(http.MethodPut, resourceType, id, tag)
+}
+
+// Detach a tag from a conversation or plan
+func (c *Client) Untag(resourceType, id, tag string) error {
+	return c.doTagRequest(http.MethodDelete, resourceType, id, tag)
+}
+
+func (c *Client) doTagRequest(method, resourceType, id, tag string) error {
+	prefix, notFound := "/conversations/", data.ErrConversationNotFound
+	if resourceType == data.TagPlan {
+		prefix, notFound = "/plans/", data.ErrPlanNotFound
+	}
+
+	if err := c.doRequest(method, prefix+id+"/tags/"+url.PathEscape(tag), nil, nil); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return notFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func filterQuery(filter data.ListFilter) string {
+	params := url.Values{}
+	if filter.Project != "" {
+		params.Set("project", filter.Project)
+	}
+	if len(filter.Tags) > 0 {
+		params["tag"] = filter.Tags
+	}
+	if filter.Archived {
+		params.Set("archived", "true")
+	}
+
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + params.Encode()
+}
+
+func (c *Client) DeleteConversation(id string) error {
+	path := fmt.Sprintf("/conversations/%s", id)
+	if err := c.doRequest(http.MethodDelete, path, nil, nil); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
 			return data.ErrConversationNotFound
 		}
 		return err
@@ -83,8 +377,70 @@ func (c *Client) SaveConversation(conv *data.Conversation) error {
 	return nil
 }
 
-func (c *Client) GetLatestConversationID() (string, error) {
-	conversations, err := c.ListConversations()
+// Fetch the transcript rendered by the server as json, markdown or html
+func (c *Client) ExportConversation(id, format string) ([]byte, error) {
+	params := url.Values{}
+	params.Set("format", format)
+
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/conversations/"+id+"/export?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, data.ErrConversationNotFound
+	}
+	if resp.StatusCode >= 400 {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+
+	return body, nil
+}
+
+// Part of the /health report of the server
+type Health struct {
+	// ok, or degraded when a dependency is unavailable
+	Status        string `json:"status"`
+	Version       string `json:"version"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// Report of the server, which is running when this does not fail even if it is degraded
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var health Health
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &health, nil
+}
+
+// Most recently active conversation of project, of any project when empty
+func (c *Client) GetLatestConversationID(project string) (string, error) {
+	conversations, err := c.ListConversations(data.ListFilter{Project: project})
 	if err != nil {
 		return "", err
 	}
@@ -102,6 +458,9 @@ func (c *Client) CreatePlan(conversationID string) (*data.Plan, error) {
 	}
 	var result map[string]string
 	if err := c.doRequest(http.MethodPost, "/plans", reqBody, &result); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return nil, data.ErrConversationNotFound
+		}
 		return nil, err
 	}
 
@@ -112,9 +471,10 @@ func (c *Client) CreatePlan(conversationID string) (*data.Plan, error) {
 	}, nil
 }
 
-func (c *Client) ListPlans() ([]data.PlanInfo, error) {
+// List the plans matching filter
+func (c *Client) ListPlans(filter data.ListFilter) ([]data.PlanInfo, error) {
 	var plans []data.PlanInfo
-	if err := c.doRequest(http.MethodGet, "/plans", nil, &plans); err != nil {
+	if err := c.doRequest(http.MethodGet, "/plans"+filterQuery(filter), nil, &plans); err != nil {
 		return nil, err
 	}
 
@@ -124,8 +484,7 @@ func (c *Client) ListPlans() ([]data.PlanInfo, error) {
 func (c *Client) GetPlan(id string) (*data.Plan, error) {
 	var p data.Plan
 	if err := c.doRequest(http.MethodGet, "/plans/"+id, nil, &p); err != nil {
-		var httpErr *HTTPError
-		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		if errors.Is(err, tinkererr.NotFound) {
 			return nil, data.ErrPlanNotFound
 		}
 		return nil, err
@@ -137,8 +496,7 @@ func (c *Client) GetPlan(id string) (*data.Plan, error) {
 func (c *Client) SavePlan(p *data.Plan) error {
 	path := fmt.Sprintf("/plans/%s", p.ID)
 	if err := c.doRequest(http.MethodPut, path, p, nil); err != nil {
-		var httpErr *HTTPError
-		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		if errors.Is(err, tinkererr.NotFound) {
 			return data.ErrPlanNotFound
 		}
 		return err
@@ -147,11 +505,81 @@ func (c *Client) SavePlan(p *data.Plan) error {
 	return nil
 }
 
+// Revisions of a plan, newest first
+func (c *Client) PlanHistory(id string) ([]data.PlanRevision, error) {
+	var revisions []data.PlanRevision
+	if err := c.doRequest(http.MethodGet, "/plans/"+id+"/history", nil, &revisions); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return nil, data.ErrPlanNotFound
+		}
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Restore the steps of an older revision on behalf of the user
+func (c *Client) RevertPlan(id string, revision int) (*data.Plan, error) {
+	reqBody := map[string]int{"revision": revision}
+
+	var p data.Plan
+	if err := c.doRequest(http.MethodPost, "/plans/"+id+"/revert", reqBody, &p); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return nil, data.ErrPlanRevisionNotFound
+		}
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Change one step of a plan on behalf of the user.
+// A positive version is sent as If-Match, so the update fails with
+// data.ErrPlanVersionConflict when someone else saved the plan in between
+func (c *Client) UpdateStep(planID, stepID string, patch data.StepPatch, version int) (*data.Plan, error) {
+	jsonData, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, c.baseURL+"/plans/"+planID+"/steps/"+stepID, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if version > 0 {
+		req.Header.Set("If-Match", fmt.Sprintf(`"%d"`, version))
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, data.ErrStepNotFound
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return nil, data.ErrPlanVersionConflict
+	case resp.StatusCode >= 400:
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Message: string(bodyBytes)}
+	}
+
+	var p data.Plan
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &p, nil
+}
+
 func (c *Client) DeletePlan(id string) error {
 	path := fmt.Sprintf("/plans/%s", id)
 	if err := c.doRequest(http.MethodDelete, path, nil, nil); err != nil {
-		var httpErr *HTTPError
-		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		if errors.Is(err, tinkererr.NotFound) {
 			return data.ErrPlanNotFound
 		}
 		return err
@@ -182,6 +610,22 @@ func (c *Client) DeletePlans(ids []string) (map[string]error, error) {
 	return results, nil
 }
 
+func (c *Client) GetMCPToolCache(key string) (*data.MCPToolCache, error) {
+	var cache data.MCPToolCache
+	if err := c.doRequest(http.MethodGet, "/mcp/tools/"+key, nil, &cache); err != nil {
+		if errors.Is(err, tinkererr.NotFound) {
+			return nil, data.ErrMCPToolCacheNotFound
+		}
+		return nil, err
+	}
+
+	return &cache, nil
+}
+
+func (c *Client) SaveMCPToolCache(cache *data.MCPToolCache) error {
+	return c.doRequest(http.MethodPut, "/mcp/tools/"+cache.Key, cache, nil)
+}
+
 func (c *Client) doRequest(method, path string, body, result any) error {
 	var bodyReader io.Reader
 	if body != nil {
@@ -200,6 +644,7 @@ func (c *Client) doRequest(method, path string, body, result any) error {
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+type RunRequest struct {
+	Prompt    string `json:"prompt"`
+	Provider  string `json:"provider,omitempty"`
+	Model     string `json:"model,omitempty"`
+	MaxTokens int64  `json:"max_tokens,omitempty"`
+}
+
+// RunEvent is one server-sent event of a run.
+// Data is the JSON payload, its shape depends on Type
+type RunEvent struct {
+	Type string
+	Data json.RawMessage
+}
+
+// Run the agent on the server and call onEvent for every event until the run ends.
+// Cancelling ctx stops the run on the server as well
+func (c *Client) RunConversation(ctx context.Context, id string, runReq RunRequest, onEvent func(RunEvent)) error {
+	jsonData, err := json.Marshal(runReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/conversations/"+id+"/run", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound {
+			return data.ErrConversationNotFound
+		}
+		return &HTTPError{
+			StatusCode: resp.StatusCode,
+			Message:    string(bodyBytes),
+		}
+	}
+
+	return readEvents(resp.Body, onEvent)
+}
+
+func readEvents(r io.Reader, onEvent func(RunEvent)) error {
+	scanner := bufio.NewScanner(r)
+	// Tool outputs can be large
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var event RunEvent
+	var payload strings.Builder
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// A blank line ends the event
+			if event.Type != "" {
+				event.Data = json.RawMessage(payload.String())
+				onEvent(event)
+
+				if event.Type == "error" {
+					var e struct {
+						Error string `json:"error"`
+					}
+					json.Unmarshal(event.Data, &e)
+					return errors.New(e.Error)
+				}
+			}
+			event = RunEvent{}
+			payload.Reset()
+		case strings.HasPrefix(line, "event:"):
+			event.Type = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			payload.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/honganh1206/tinker/utils"
+)
+
+// Environment variable overriding the token file
+const TokenEnv = "TINKER_API_TOKEN"
+
+// File holding the token the local clients authenticate with
+func TokenPath() (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get data directory: %w", err)
+	}
+
+	return filepath.Join(dir, "api_token"), nil
+}
+
+// Read the API token from the environment, then from the token file.
+// An empty token is returned when neither is set
+func LoadToken() string {
+	if token := strings.TrimSpace(os.Getenv(TokenEnv)); token != "" {
+		return token
+	}
+
+	path, err := TokenPath()
+	if err != nil {
+		return ""
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(raw))
+}
+
+// Write the token to the token file, readable by the current user only
+func SaveToken(token string) error {
+	path, err := TokenPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// Kinds of events pushed to watchers of a conversation
+const (
+	WatchMessages = "messages"
+	WatchPlan     = "plan"
+	WatchDeleted  = "deleted"
+)
+
+type WatchEvent struct {
+	Type string `json:"type"`
+	// Index of the first message, 0 when the whole history is resent
+	From     int                `json:"from,omitempty"`
+	Messages []*message.Message `json:"messages,omitempty"`
+	Plan     *data.Plan         `json:"plan,omitempty"`
+}
+
+// Follow a conversation read-only, calling onEvent with its history first and then with
+// every new message and plan update. Returns nil once ctx is done or the conversation is deleted
+func (c *Client) WatchConversation(ctx context.Context, id string, onEvent func(WatchEvent)) error {
+	wsURL := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/conversations/" + id + "/ws"
+
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = c.dial
+
+	conn, resp, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			if resp.StatusCode == http.StatusNotFound {
+				return data.ErrConversationNotFound
+			}
+			body, _ := io.ReadAll(resp.Body)
+			return &HTTPError{StatusCode: resp.StatusCode, Message: string(body)}
+		}
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read below when the caller stops watching
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var event WatchEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return fmt.Errorf("server closed the connection: %s", closeErr.Text)
+			}
+			return fmt.Errorf("failed to read event: %w", err)
+		}
+
+		onEvent(event)
+		if event.Type == WatchDeleted {
+			return nil
+		}
+	}
+}
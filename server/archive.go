@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+var errRunInProgress = errors.New("conversation has a run in progress")
+
+// Starts archive files encrypted with the database key, plain ones are gzip streams
+var encryptedArchive = []byte("enc:v1:")
+
+// File holding the messages of an archived conversation, gzipped JSON of the whole conversation,
+// encrypted when the database is
+func (s *server) archivePath(id string) string {
+	return filepath.Join(s.archiveDir, filepath.Base(id)+".json.gz")
+}
+
+// Move the messages of conversation id out of the database into its archive file
+func (s *server) archive(id string) error {
+	// Claimed like a run, so none starts while the messages move
+	if !s.startRun(id) {
+		return errRunInProgress
+	}
+	defer s.finishRun(id)
+
+	conv, err := s.models.Conversations.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err := writeArchive(s.archivePath(id), conv, s.cipher); err != nil {
+		return fmt.Errorf("failed to write archive of conversation '%s': %w", id, err)
+	}
+
+	if err := s.models.Conversations.Archive(id); err != nil {
+		os.Remove(s.archivePath(id))
+		return err
+	}
+	s.watchers.publish(id)
+	return nil
+}
+
+// Put the messages of an archived conversation back into the database
+func (s *server) unarchive(id string) error {
+	// Get fails with ErrArchived for archived conversations alone
+	_, err := s.models.Conversations.Get(id)
+	if err == nil {
+		return data.ErrNotArchived
+	}
+	if !errors.Is(err, data.ErrArchived) {
+		return err
+	}
+
+	archived, err := readArchive(s.archivePath(id), s.cipher)
+	if err != nil {
+		return fmt.Errorf("failed to read archive of conversation '%s': %w", id, err)
+	}
+
+	if err := s.models.Conversations.Unarchive(id, archived); err != nil {
+		return err
+	}
+	s.removeArchive(id)
+	return nil
+}
+
+// Drop the archive file of a deleted or restored conversation, if it has one
+func (s *server) removeArchive(id string) {
+	if err := os.Remove(s.archivePath(id)); err != nil && !os.IsNotExist(err) {
+		logger.Warn("failed to remove archive file", "conversation", id, "err", err)
+	}
+}
+
+// Written to a temporary file first, so a crash never leaves half an archive behind.
+// Encrypted with c unless it is nil
+func writeArchive(path string, conv *data.Conversation, c *data.PayloadCipher) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(conv); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	content := buf.Bytes()
+	if c != nil {
+		sealed, err := c.Seal(content)
+		if err != nil {
+			return err
+		}
+		content = append(bytes.Clone(encryptedArchive), sealed...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Archives in plain text are read whatever c is
+func readArchive(path string, c *data.PayloadCipher) (*data.Conversation, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if sealed, ok := bytes.CutPrefix(content, encryptedArchive); ok {
+		if c == nil {
+			return nil, data.ErrEncrypted
+		}
+		if content, err = c.Open(sealed); err != nil {
+			return nil, err
+		}
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var conv data.Conversation
+	if err := json.NewDecoder(gz).Decode(&conv); err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (s *server) archiveConversation(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.archive(id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "conversation archived"})
+}
+
+func (s *server) unarchiveConversation(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.unarchive(id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "conversation unarchived"})
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+func TestArchiveConversation(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("Keep this for later")}})
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation() failed: %v", err)
+	}
+
+	if err := client.ArchiveConversation(conv.ID); err != nil {
+		t.Fatalf("ArchiveConversation() failed: %v", err)
+	}
+	if _, err := os.Stat(srv.archivePath(conv.ID)); err != nil {
+		t.Errorf("Archive file missing: %v", err)
+	}
+
+	var httpErr *api.HTTPError
+	if _, err := client.GetConversation(conv.ID); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("GetConversation() of an archived conversation = %v, want a 409", err)
+	}
+	late := *conv
+	late.Messages = append(slices.Clone(conv.Messages), &message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("late")}})
+	if err := client.SaveConversation(&late); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("SaveConversation() of an archived conversation = %v, want a 409", err)
+	}
+	if err := client.ReplaceConversation(&late); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("ReplaceConversation() of an archived conversation = %v, want a 409", err)
+	}
+	if convs, err := client.ListConversations(data.ListFilter{}); err != nil || len(convs) != 0 {
+		t.Errorf("ListConversations() = %+v, %v, want archived conversations left out", convs, err)
+	}
+	if convs, err := client.ListConversations(data.ListFilter{Archived: true}); err != nil || len(convs) != 1 || convs[0].ArchivedAt == nil {
+		t.Errorf("ListConversations() of archived = %+v, %v, want the conversation", convs, err)
+	}
+
+	if err := client.UnarchiveConversation(conv.ID); err != nil {
+		t.Fatalf("UnarchiveConversation() failed: %v", err)
+	}
+	if _, err := os.Stat(srv.archivePath(conv.ID)); !os.IsNotExist(err) {
+		t.Errorf("Archive file left after unarchiving: %v", err)
+	}
+
+	restored, err := client.GetConversation(conv.ID)
+	if err != nil {
+		t.Fatalf("GetConversation() failed: %v", err)
+	}
+	if len(restored.Messages) != 1 || restored.Messages[0].Content[0].(message.TextBlock).Text != "Keep this for later" {
+		t.Errorf("Restored messages = %+v, want the saved one", restored.Messages)
+	}
+
+	if err := client.UnarchiveConversation(conv.ID); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("UnarchiveConversation() of an active conversation = %v, want a 409", err)
+	}
+
+	// No archiving under a running agent
+	srv.runs[conv.ID] = true
+	if err := client.ArchiveConversation(conv.ID); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("ArchiveConversation() during a run = %v, want a 409", err)
+	}
+}
+
+func TestArchive_Encrypted(t *testing.T) {
+	key, err := data.NewKey()
+	if err != nil {
+		t.Fatalf("NewKey() failed: %v", err)
+	}
+	cipher, err := data.NewPayloadCipher(key)
+	if err != nil {
+		t.Fatalf("NewPayloadCipher() failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "conv.json.gz")
+	conv := &data.Conversation{ID: "conv", Messages: []*message.Message{
+		{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("proprietary secret sauce")}},
+	}}
+	if err := writeArchive(path, conv, nil); err != nil {
+		t.Fatalf("writeArchive() failed: %v", err)
+	}
+
+	if n, err := rewriteArchives(dir, cipher, cipher); err != nil || n != 1 {
+		t.Fatalf("rewriteArchives() = %d, %v, want 1 encrypted", n, err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if !bytes.HasPrefix(content, encryptedArchive) {
+		t.Error("Archive left unencrypted")
+	}
+	if n, err := rewriteArchives(dir, cipher, cipher); err != nil || n != 0 {
+		t.Errorf("rewriteArchives() again = %d, %v, want nothing left to encrypt", n, err)
+	}
+
+	if _, err := readArchive(path, nil); !errors.Is(err, data.ErrEncrypted) {
+		t.Errorf("readArchive() without a key = %v, want ErrEncrypted", err)
+	}
+	got, err := readArchive(path, cipher)
+	if err != nil {
+		t.Fatalf("readArchive() failed: %v", err)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content[0].(message.TextBlock).Text != "proprietary secret sauce" {
+		t.Errorf("Archived messages = %+v, want the written one", got.Messages)
+	}
+
+	if n, err := rewriteArchives(dir, cipher, nil); err != nil || n != 1 {
+		t.Fatalf("rewriteArchives() to plain text = %d, %v, want 1 decrypted", n, err)
+	}
+	if _, err := readArchive(path, nil); err != nil {
+		t.Errorf("readArchive() without a key failed after decrypting: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Routes reachable without a token, so liveness checks and API docs need no credentials
+var publicPaths = map[string]bool{
+	"/health":       true,
+	"/openapi.json": true,
+}
+
+// Reject requests without a valid bearer token
+func (s *server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || s.socketAuth {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := requestToken(r)
+		if !ok {
+			unauthorized(w, "Missing bearer token")
+			return
+		}
+
+		if !s.validToken(token) {
+			unauthorized(w, "Invalid token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) validToken(token string) bool {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.internalToken)) == 1 {
+		return true
+	}
+
+	valid, err := s.models.APITokens.Valid(token)
+	if err != nil {
+		logger.Error("failed to check API token", "err", err)
+		return false
+	}
+
+	return valid
+}
+
+// Bearer token of the request. WebSocket upgrades may pass it as ?access_token=,
+// browsers cannot set headers on them
+func requestToken(r *http.Request) (string, bool) {
+	if token, ok := bearerToken(r); ok {
+		return token, true
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		token := r.URL.Query().Get("access_token")
+		return token, token != ""
+	}
+
+	return "", false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="tinker"`)
+	writeError(w, http.StatusUnauthorized, message)
+}
+
+// Token the server uses to call its own API, valid until it stops
+func newInternalToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPort = "11435"
+	// Large enough for long conversations, small enough that a runaway client cannot exhaust memory
+	DefaultMaxBodySize = 32 << 20
+	// Requests per minute for each API token
+	DefaultRateLimit = 600
+
+	HostEnv        = "TINKER_HOST"
+	PortEnv        = "TINKER_PORT"
+	DatabaseEnv    = "TINKER_DATABASE_URL"
+	MaxBodySizeEnv = "TINKER_MAX_BODY_SIZE"
+	RateLimitEnv   = "TINKER_RATE_LIMIT"
+	SocketEnv      = "TINKER_SOCKET"
+	GRPCPortEnv    = "TINKER_GRPC_PORT"
+	ArchiveEnv     = "TINKER_ARCHIVE_AFTER"
+	DeleteEnv      = "TINKER_DELETE_AFTER"
+	// Base64 of the key encrypting the database, instead of the one in the OS keyring
+	DatabaseKeyEnv = "TINKER_DATABASE_KEY"
+
+	configFile = "server.json"
+)
+
+// Where the server listens and stores its data. An empty host listens on every interface,
+// port "0" lets the OS pick a free port
+type Server struct {
+	Host string `json:"host,omitempty"`
+	Port string `json:"port,omitempty"`
+	// A postgres:// URL or a SQLite file path, tinker.db in the data directory when empty
+	Database string `json:"database,omitempty"`
+	// Unix domain socket to listen on instead of host and port, e.g., ~/.tinker/tinker.sock
+	Socket string `json:"socket,omitempty"`
+	// Port of the gRPC service on the same host, the service is off when empty
+	GRPCPort string `json:"grpc_port,omitempty"`
+	// Largest request body accepted, in bytes
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+	// Requests per minute allowed for each API token, a negative value disables the limit
+	RateLimit int `json:"rate_limit,omitempty"`
+	// When conversations are archived and deleted, never unless set
+	Retention Retention `json:"retention,omitempty"`
+}
+
+// Resolve the server address from the config file, then the environment,
+// each one overriding the previous. Flags are applied on top by the caller
+func Load() (Server, error) {
+	cfg := Server{Port: DefaultPort, MaxBodySize: DefaultMaxBodySize, RateLimit: DefaultRateLimit}
+
+	path, err := Path()
+	if err == nil {
+		raw, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return cfg, fmt.Errorf("failed to read server config: %w", err)
+		}
+		if err == nil {
+			var fileCfg Server
+			if err := json.Unmarshal(raw, &fileCfg); err != nil {
+				return cfg, fmt.Errorf("invalid server config %s: %w", path, err)
+			}
+			cfg = cfg.merge(fileCfg)
+		}
+	}
+
+	envCfg := Server{Host: os.Getenv(HostEnv), Port: os.Getenv(PortEnv), Database: os.Getenv(DatabaseEnv), Socket: os.Getenv(SocketEnv), GRPCPort: os.Getenv(GRPCPortEnv)}
+	if v := os.Getenv(MaxBodySizeEnv); v != "" {
+		if envCfg.MaxBodySize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return cfg, fmt.Errorf("invalid %s %q", MaxBodySizeEnv, v)
+		}
+	}
+	if v := os.Getenv(RateLimitEnv); v != "" {
+		if envCfg.RateLimit, err = strconv.Atoi(v); err != nil {
+			return cfg, fmt.Errorf("invalid %s %q", RateLimitEnv, v)
+		}
+	}
+	for _, env := range []struct {
+		name string
+		age  *Age
+	}{
+		{ArchiveEnv, &envCfg.Retention.ArchiveAfter},
+		{DeleteEnv, &envCfg.Retention.DeleteAfter},
+	} {
+		if v := os.Getenv(env.name); v != "" {
+			d, err := ParseAge(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %w", env.name, err)
+			}
+			*env.age = Age(d)
+		}
+	}
+	cfg = cfg.merge(envCfg)
+
+	return cfg, cfg.Validate()
+}
+
+// Override fields that are set in other
+func (s Server) merge(other Server) Server {
+	if other.Host != "" {
+		s.Host = other.Host
+	}
+	if other.Port != "" {
+		s.Port = other.Port
+	}
+	if other.Database != "" {
+		s.Database = other.Database
+	}
+	if other.Socket != "" {
+		s.Socket = other.Socket
+	}
+	if other.GRPCPort != "" {
+		s.GRPCPort = other.GRPCPort
+	}
+	if other.MaxBodySize != 0 {
+		s.MaxBodySize = other.MaxBodySize
+	}
+	if other.RateLimit != 0 {
+		s.RateLimit = other.RateLimit
+	}
+	if other.Retention.ArchiveAfter != 0 {
+		s.Retention.ArchiveAfter = other.Retention.ArchiveAfter
+	}
+	if other.Retention.DeleteAfter != 0 {
+		s.Retention.DeleteAfter = other.Retention.DeleteAfter
+	}
+	return s
+}
+
+func (s Server) Validate() error {
+	port, err := strconv.Atoi(s.Port)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", s.Port)
+	}
+	if s.GRPCPort != "" {
+		port, err := strconv.Atoi(s.GRPCPort)
+		if err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("invalid gRPC port %q", s.GRPCPort)
+		}
+	}
+	if s.MaxBodySize <= 0 {
+		return fmt.Errorf("invalid max body size %d, must be positive", s.MaxBodySize)
+	}
+	return s.Retention.Validate()
+}
+
+// Address to listen on
+func (s Server) Addr() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+// Address of the gRPC service, empty when it is off
+func (s Server) GRPCAddr() string {
+	if s.GRPCPort == "" {
+		return ""
+	}
+	return net.JoinHostPort(s.Host, s.GRPCPort)
+}
+
+// Socket path with a leading ~ expanded, empty when listening on TCP
+func (s Server) SocketPath() string {
+	if rest, ok := strings.CutPrefix(s.Socket, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return s.Socket
+}
+
+// URL clients on this machine reach the server with, unix:///path for a socket
+func (s Server) URL() string {
+	if socket := s.SocketPath(); socket != "" {
+		return "unix://" + socket
+	}
+
+	host := s.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, s.Port)
+}
+
+func Path() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "tinker", configFile), nil
+}
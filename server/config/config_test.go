@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	t.Setenv(HostEnv, "")
+	t.Setenv(PortEnv, "")
+	t.Setenv(MaxBodySizeEnv, "")
+	t.Setenv(RateLimitEnv, "")
+	t.Setenv(SocketEnv, "")
+	t.Setenv(GRPCPortEnv, "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != DefaultPort || cfg.Host != "" {
+		t.Errorf("default config = %+v, want port %s on every interface", cfg, DefaultPort)
+	}
+	if cfg.MaxBodySize != DefaultMaxBodySize || cfg.RateLimit != DefaultRateLimit {
+		t.Errorf("default limits = %d bytes, %d requests per minute", cfg.MaxBodySize, cfg.RateLimit)
+	}
+
+	path, err := Path()
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"host":"127.0.0.1","port":"9000"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment wins over the file
+	t.Setenv(PortEnv, "0")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Addr() != "127.0.0.1:0" {
+		t.Errorf("Addr() = %q, want %q", cfg.Addr(), "127.0.0.1:0")
+	}
+
+	t.Setenv(SocketEnv, "~/.tinker/tinker.sock")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if want := "unix://" + filepath.Join(configDir, ".tinker", "tinker.sock"); cfg.URL() != want {
+		t.Errorf("URL() = %q, want %q", cfg.URL(), want)
+	}
+	t.Setenv(SocketEnv, "")
+
+	t.Setenv(GRPCPortEnv, "50051")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.GRPCAddr() != "127.0.0.1:50051" {
+		t.Errorf("GRPCAddr() = %q, want %q", cfg.GRPCAddr(), "127.0.0.1:50051")
+	}
+	t.Setenv(GRPCPortEnv, "grpc")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a non-numeric gRPC port")
+	}
+	t.Setenv(GRPCPortEnv, "")
+
+	t.Setenv(RateLimitEnv, "-1")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.RateLimit != -1 {
+		t.Errorf("RateLimit = %d, want the environment's -1", cfg.RateLimit)
+	}
+
+	t.Setenv(MaxBodySizeEnv, "lots")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a non-numeric max body size")
+	}
+	t.Setenv(MaxBodySizeEnv, "")
+
+	t.Setenv(PortEnv, "http")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a non-numeric port")
+	}
+}
+
+func TestLoad_Retention(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	t.Setenv(PortEnv, "")
+	t.Setenv(ArchiveEnv, "")
+	t.Setenv(DeleteEnv, "")
+
+	path, err := Path()
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"retention":{"archive_after":"90d","delete_after":"1y"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	day := 24 * time.Hour
+	if cfg.Retention.ArchiveAfter != Age(90*day) || cfg.Retention.DeleteAfter != Age(365*day) {
+		t.Errorf("Retention = %+v, want 90 days then a year", cfg.Retention)
+	}
+
+	// Deleting first would leave nothing to archive
+	t.Setenv(DeleteEnv, "2w")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for deleting before archiving")
+	}
+
+	t.Setenv(DeleteEnv, "")
+	t.Setenv(ArchiveEnv, "soon")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for an invalid age")
+	}
+}
+
+func TestServer_URL(t *testing.T) {
+	tests := []struct {
+		cfg  Server
+		want string
+	}{
+		{Server{Port: "11435"}, "http://localhost:11435"},
+		{Server{Host: "0.0.0.0", Port: "8080"}, "http://localhost:8080"},
+		{Server{Host: "10.0.0.2", Port: "8080"}, "http://10.0.0.2:8080"},
+		{Server{Host: "::1", Port: "8080"}, "http://[::1]:8080"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.cfg.URL(); got != tt.want {
+			t.Errorf("URL() for %+v = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestDatabaseKey_Env(t *testing.T) {
+	want := []byte("0123456789abcdef0123456789abcdef")
+	t.Setenv(DatabaseKeyEnv, base64.StdEncoding.EncodeToString(want))
+
+	key, err := DatabaseKey()
+	if err != nil {
+		t.Fatalf("DatabaseKey() failed: %v", err)
+	}
+	if string(key) != string(want) {
+		t.Errorf("DatabaseKey() = %q, want %q", key, want)
+	}
+
+	t.Setenv(DatabaseKeyEnv, "not base64!")
+	if _, err := DatabaseKey(); err == nil {
+		t.Error("DatabaseKey() with a malformed key succeeded, want an error")
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/honganh1206/tinker/utils"
+)
+
+// Where the database key is kept in the OS keyring
+const (
+	keyringService = "tinker"
+	keyringAccount = "database-key"
+)
+
+// Key encrypting the messages in the database: DatabaseKeyEnv when set, the one in the OS keyring
+// otherwise. Nil when there is neither, the database is then in plain text
+func DatabaseKey() ([]byte, error) {
+	encoded := os.Getenv(DatabaseKeyEnv)
+	if encoded == "" {
+		secret, err := utils.GetSecret(keyringService, keyringAccount)
+		if errors.Is(err, utils.ErrSecretNotFound) || errors.Is(err, utils.ErrKeyringUnsupported) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		encoded = secret
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("database key must be base64: %w", err)
+	}
+	return key, nil
+}
+
+// Keep key in the OS keyring, where DatabaseKey finds it
+func StoreDatabaseKey(key []byte) error {
+	if err := utils.SetSecret(keyringService, keyringAccount, base64.StdEncoding.EncodeToString(key)); err != nil {
+		if errors.Is(err, utils.ErrKeyringUnsupported) {
+			return fmt.Errorf("%w, set %s to the base64 of %d random bytes instead, e.g., from 'openssl rand -base64 32'", err, DatabaseKeyEnv, 32)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove the key from the OS keyring once nothing is encrypted with it
+func DeleteDatabaseKey() error {
+	err := utils.DeleteSecret(keyringService, keyringAccount)
+	if errors.Is(err, utils.ErrKeyringUnsupported) {
+		return nil
+	}
+	return err
+}
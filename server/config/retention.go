@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long conversations are kept around, counted from their latest message.
+// Zero values keep them forever
+type Retention struct {
+	// Move the messages out of the database into a compressed archive file,
+	// the conversation is left out of listings until it is unarchived
+	ArchiveAfter Age `json:"archive_after,omitempty"`
+	// Delete the conversation, archived or not, along with its plan
+	DeleteAfter Age `json:"delete_after,omitempty"`
+}
+
+// Duration written in days, weeks or years in the config, e.g., "90d" or "1y"
+type Age time.Duration
+
+func (a Age) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(a).String())
+}
+
+func (a *Age) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("age must be a string, e.g., \"90d\": %w", err)
+	}
+
+	d, err := ParseAge(s)
+	if err != nil {
+		return err
+	}
+	*a = Age(d)
+	return nil
+}
+
+// Durations like time.ParseDuration takes, plus days, weeks and years of 365 days, e.g., 30d, 2w or 1y
+func ParseAge(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	case strings.HasSuffix(s, "y"):
+		unit = 365 * 24 * time.Hour
+	}
+
+	if unit == 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid age %q, e.g., 30d, 2w, 1y or 12h", s)
+		}
+		return d, nil
+	}
+
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid age %q, e.g., 30d, 2w, 1y or 12h", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// Whether anything is ever archived or deleted
+func (r Retention) Enabled() bool {
+	return r.ArchiveAfter > 0 || r.DeleteAfter > 0
+}
+
+func (r Retention) Validate() error {
+	if r.ArchiveAfter > 0 && r.DeleteAfter > 0 && r.DeleteAfter <= r.ArchiveAfter {
+		return fmt.Errorf("retention deletes after %s, before archiving after %s", time.Duration(r.DeleteAfter), time.Duration(r.ArchiveAfter))
+	}
+	return nil
+}
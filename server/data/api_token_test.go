@@ -0,0 +1,43 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPITokenModel_CreateAndValid(t *testing.T) {
+	model := APITokenModel{DB: createTestDB(t)}
+
+	token, err := model.Create()
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(token, "tk_") {
+		t.Errorf("token = %q, want tk_ prefix", token)
+	}
+
+	for _, tt := range []struct {
+		token string
+		want  bool
+	}{
+		{token, true},
+		{token + "x", false},
+		{"", false},
+	} {
+		got, err := model.Valid(tt.token)
+		if err != nil {
+			t.Fatalf("Valid(%q) failed: %v", tt.token, err)
+		}
+		if got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+
+	count, err := model.Count()
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Count = %d, want 1", count)
+	}
+}
@@ -0,0 +1,255 @@
+package data
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+// Tool results larger than this, in bytes, are stored as attachments. Images always are
+const attachmentMinSize = 64 << 10
+
+// Prefix of the references to attachments in content blocks, followed by the hash
+const attachmentRef = "sha256:"
+
+// Content moved out of a message, keyed by the hex SHA-256 of it
+type attachment struct {
+	hash    string
+	content []byte
+}
+
+func newAttachment(content []byte) attachment {
+	sum := sha256.Sum256(content)
+	return attachment{hash: hex.EncodeToString(sum[:]), content: content}
+}
+
+// Copy of msg with its images and oversized tool results replaced by references to attachments.
+// Messages with neither come back as they are, the same message always detaches the same
+func detachAttachments(msg *message.Message) (*message.Message, []attachment, error) {
+	var attachments []attachment
+	var content []message.ContentBlock
+
+	for i, block := range msg.Content {
+		var detached message.ContentBlock
+		switch b := block.(type) {
+		case message.ImageBlock:
+			if b.Data == "" {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(b.Data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid image data: %w", err)
+			}
+			a := newAttachment(data)
+			attachments = append(attachments, a)
+			b.Data, b.Attachment = "", attachmentRef+a.hash
+			detached = b
+		case message.ToolResultBlock:
+			if len(b.Content) <= attachmentMinSize {
+				continue
+			}
+			a := newAttachment([]byte(b.Content))
+			attachments = append(attachments, a)
+			b.Content, b.Attachment = "", attachmentRef+a.hash
+			detached = b
+		default:
+			continue
+		}
+
+		if content == nil {
+			content = append([]message.ContentBlock(nil), msg.Content...)
+		}
+		content[i] = detached
+	}
+
+	if content == nil {
+		return msg, nil, nil
+	}
+	copied := *msg
+	copied.Content = content
+	return &copied, attachments, nil
+}
+
+// Keep attachments of conversation id, those it already has are skipped
+func (cm ConversationModel) storeAttachments(tx *sql.Tx, id string, attachments []attachment) error {
+	for _, a := range attachments {
+		content, err := cm.Cipher.encryptBytes(a.content)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(cm.Dialect.rebind(`
+			INSERT INTO attachments (conversation_id, hash, content)
+			VALUES (?, ?, ?)
+			ON CONFLICT (conversation_id, hash) DO NOTHING`), id, a.hash, content)
+		if err != nil {
+			return fmt.Errorf("failed to store attachment of conversation '%s': %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Put the attachments of conversation id back into the blocks of msgs referring to them
+func (cm ConversationModel) resolveAttachments(id string, msgs []*message.Message) error {
+	refs := false
+	for _, msg := range msgs {
+		for _, block := range msg.Content {
+			switch b := block.(type) {
+			case message.ImageBlock:
+				refs = refs || b.Attachment != ""
+			case message.ToolResultBlock:
+				refs = refs || b.Attachment != ""
+			}
+		}
+	}
+	if !refs {
+		return nil
+	}
+
+	rows, err := cm.DB.Query(cm.Dialect.rebind(`SELECT hash, content FROM attachments WHERE conversation_id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("failed to query attachments of conversation '%s': %w", id, err)
+	}
+	defer rows.Close()
+
+	contents := make(map[string][]byte)
+	for rows.Next() {
+		var hash string
+		var content []byte
+		if err := rows.Scan(&hash, &content); err != nil {
+			return err
+		}
+		if contents[attachmentRef+hash], err = cm.Cipher.decryptBytes(content); err != nil {
+			return fmt.Errorf("failed to read attachment %s of conversation '%s': %w", hash, id, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		for i, block := range msg.Content {
+			switch b := block.(type) {
+			case message.ImageBlock:
+				if b.Attachment == "" {
+					continue
+				}
+				content, ok := contents[b.Attachment]
+				if !ok {
+					return fmt.Errorf("attachment %s of conversation '%s' is missing", b.Attachment, id)
+				}
+				b.Data, b.Attachment = base64.StdEncoding.EncodeToString(content), ""
+				msg.Content[i] = b
+			case message.ToolResultBlock:
+				if b.Attachment == "" {
+					continue
+				}
+				content, ok := contents[b.Attachment]
+				if !ok {
+					return fmt.Errorf("attachment %s of conversation '%s' is missing", b.Attachment, id)
+				}
+				b.Content, b.Attachment = string(content), ""
+				msg.Content[i] = b
+			}
+		}
+	}
+	return nil
+}
+
+// Attachments the stored messages of conversation id refer to, from sequence on
+func (cm ConversationModel) attachmentRefsFrom(tx *sql.Tx, id string, sequence int) ([]string, error) {
+	rows, err := tx.Query(cm.Dialect.rebind(`SELECT payload FROM messages WHERE conversation_id = ? AND sequence_number >= ?`), id, sequence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages of conversation '%s': %w", id, err)
+	}
+	var payloads []string
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, payload := range payloads {
+		payload, err := cm.Cipher.decrypt(payload)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodePayload(payload)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range msg.Content {
+			switch b := block.(type) {
+			case message.ImageBlock:
+				refs = append(refs, b.Attachment)
+			case message.ToolResultBlock:
+				refs = append(refs, b.Attachment)
+			}
+		}
+	}
+	return refs, nil
+}
+
+// Delete the attachments of conversation id among refs that no message of it refers to anymore
+func (cm ConversationModel) dropUnreferencedAttachments(tx *sql.Tx, id string, refs []string) error {
+	unreferenced := make(map[string]bool)
+	for _, ref := range refs {
+		if ref != "" {
+			unreferenced[ref] = true
+		}
+	}
+	if len(unreferenced) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(cm.Dialect.rebind(`SELECT payload FROM messages WHERE conversation_id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("failed to query messages of conversation '%s': %w", id, err)
+	}
+	var payloads []string
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		payload, err := cm.Cipher.decrypt(payload)
+		if err != nil {
+			return err
+		}
+		for ref := range unreferenced {
+			if strings.Contains(payload, ref) {
+				delete(unreferenced, ref)
+			}
+		}
+	}
+
+	for ref := range unreferenced {
+		hash := strings.TrimPrefix(ref, attachmentRef)
+		if _, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM attachments WHERE conversation_id = ? AND hash = ?`), id, hash); err != nil {
+			return fmt.Errorf("failed to delete attachment %s of conversation '%s': %w", hash, id, err)
+		}
+	}
+	return nil
+}
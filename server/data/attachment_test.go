@@ -0,0 +1,155 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+func countAttachments(t *testing.T, cm *ConversationModel, id string) int {
+	var count int
+	if err := cm.DB.QueryRow(`SELECT COUNT(*) FROM attachments WHERE conversation_id = ?`, id).Scan(&count); err != nil {
+		t.Fatalf("Failed to count attachments: %v", err)
+	}
+	return count
+}
+
+func TestConversation_Attachments(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	image := []byte("\x89PNG not really an image")
+	output := strings.Repeat("a line of tool output\n", attachmentMinSize/10)
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewTextBlock("What is in this picture?"),
+		message.NewImageBlock("image/png", image, "shot.png"),
+	}})
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewToolResultBlock("tool-1", "bash", output, false),
+		message.NewToolResultBlock("tool-2", "bash", "short output", false),
+		// The same image again is stored once
+		message.NewImageBlock("image/png", image, "again.png"),
+	}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	for _, payload := range storedPayloads(t, cm, conv.ID) {
+		if strings.Contains(payload, "tool output") || strings.Contains(payload, `"data"`) {
+			t.Errorf("Payload %.200q holds the content of an attachment", payload)
+		}
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 2 {
+		t.Errorf("Stored %d attachments, want the image and the large tool result", n)
+	}
+
+	// Unchanged messages are not rewritten
+	stored := storedPayloads(t, cm, conv.ID)
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if again := storedPayloads(t, cm, conv.ID); again[1] != stored[1] {
+		t.Error("Saving an unchanged history rewrote its payload")
+	}
+
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	gotImage := got.Messages[0].Content[1].(message.ImageBlock)
+	if gotImage.Data != conv.Messages[0].Content[1].(message.ImageBlock).Data || gotImage.Attachment != "" || gotImage.Name != "shot.png" {
+		t.Errorf("Image = %+v, want the saved one", gotImage)
+	}
+	gotResult := got.Messages[1].Content[0].(message.ToolResultBlock)
+	if gotResult.Content != output || gotResult.Attachment != "" {
+		t.Errorf("Tool result of %d bytes with attachment %q, want the saved output", len(gotResult.Content), gotResult.Attachment)
+	}
+	if got.Messages[1].Content[2].(message.ImageBlock).Name != "again.png" {
+		t.Errorf("Second image = %+v, want again.png", got.Messages[1].Content[2])
+	}
+
+	fork, err := cm.Fork(conv.ID, 1)
+	if err != nil {
+		t.Fatalf("Fork() failed: %v", err)
+	}
+	if len(fork.Messages) != 1 || fork.Messages[0].Content[1].(message.ImageBlock).Data != gotImage.Data {
+		t.Errorf("Fork messages = %+v, want the image resolved", fork.Messages)
+	}
+
+	if err := cm.Delete(conv.ID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 0 {
+		t.Errorf("%d attachments left after Delete()", n)
+	}
+	if _, err := cm.Get(fork.ID); err != nil {
+		t.Errorf("Get() of the fork failed after deleting its parent: %v", err)
+	}
+}
+
+func TestConversation_Attachments_RewrittenHistory(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	image := []byte("\x89PNG not really an image")
+	output := strings.Repeat("a line of tool output\n", attachmentMinSize/10)
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewTextBlock("What is in this picture?"),
+		message.NewImageBlock("image/png", image, "shot.png"),
+	}})
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewToolResultBlock("tool-1", "bash", output, false),
+	}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 2 {
+		t.Fatalf("Stored %d attachments, want the image and the large tool result", n)
+	}
+
+	// The second message is replaced, the image of the first one is kept
+	conv.Messages = conv.Messages[:1]
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewTextBlock("Never mind"),
+	}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 1 {
+		t.Errorf("%d attachments after replacing the tool result, want the image alone", n)
+	}
+
+	// Shortened, with the image the new last message refers to again
+	conv.Messages = []*message.Message{{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewImageBlock("image/png", image, "again.png"),
+	}}}
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 1 {
+		t.Errorf("%d attachments after rewriting the image message, want the image still", n)
+	}
+
+	conv.Messages = nil
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 0 {
+		t.Errorf("%d attachments left after emptying the history", n)
+	}
+}
@@ -0,0 +1,251 @@
+package data
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Size of the keys NewPayloadCipher takes, AES-256
+const KeySize = 32
+
+// Marks an encrypted payload, followed by the base64 of the nonce and the sealed JSON
+const encryptedPrefix = "enc:v1:"
+
+var ErrEncrypted = errors.New("message payload is encrypted and no encryption key is set")
+
+// Encrypts message payloads at rest with AES-256-GCM.
+// Payloads saved in plain text before encryption was turned on are read as is
+type PayloadCipher struct {
+	aead cipher.AEAD
+}
+
+func NewPayloadCipher(key []byte) (*PayloadCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &PayloadCipher{aead: aead}, nil
+}
+
+// Random key for NewPayloadCipher
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Nonce followed by the ciphertext of b
+func (c *PayloadCipher) Seal(b []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, b, nil), nil
+}
+
+func (c *PayloadCipher) Open(b []byte) ([]byte, error) {
+	if len(b) < c.aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, sealed := b[:c.aead.NonceSize()], b[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt, wrong encryption key? %w", err)
+	}
+	return plain, nil
+}
+
+// Whether payload was stored encrypted
+func isEncrypted(payload string) bool {
+	return strings.HasPrefix(payload, encryptedPrefix)
+}
+
+// Payload as stored, left in plain text by a nil cipher
+func (c *PayloadCipher) encrypt(payload string) (string, error) {
+	if c == nil {
+		return payload, nil
+	}
+
+	sealed, err := c.Seal([]byte(payload))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// JSON of a stored payload, plain text ones come back unchanged
+func (c *PayloadCipher) decrypt(payload string) (string, error) {
+	encoded, ok := strings.CutPrefix(payload, encryptedPrefix)
+	if !ok {
+		return payload, nil
+	}
+	if c == nil {
+		return "", ErrEncrypted
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted payload: %w", err)
+	}
+	plain, err := c.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Content of an attachment as stored, left as is by a nil cipher
+func (c *PayloadCipher) encryptBytes(content []byte) ([]byte, error) {
+	if c == nil {
+		return content, nil
+	}
+
+	sealed, err := c.Seal(content)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(encryptedPrefix), sealed...), nil
+}
+
+func (c *PayloadCipher) decryptBytes(content []byte) ([]byte, error) {
+	sealed, ok := bytes.CutPrefix(content, []byte(encryptedPrefix))
+	if !ok {
+		return content, nil
+	}
+	if c == nil {
+		return nil, ErrEncrypted
+	}
+	return c.Open(sealed)
+}
+
+// Rows rewritten per transaction by RewritePayloads, RewriteSummaries and RewriteAttachments
+const rewriteBatch = 500
+
+// Rewrite every stored payload for the cipher of the model: encrypted with it, or in plain
+// text when the model has none. Payloads are read with from, which may be nil for a database
+// in plain text. Returns the number of payloads rewritten, those already right are skipped
+func (cm ConversationModel) RewritePayloads(from *PayloadCipher) (int, error) {
+	return cm.rewriteTable("messages", "payload", func(payload []byte) ([]byte, error) {
+		plain, err := from.decrypt(string(payload))
+		if err != nil {
+			return nil, err
+		}
+		stored, err := cm.Cipher.encrypt(plain)
+		return []byte(stored), err
+	})
+}
+
+// Rewrite the text of every summary the way RewritePayloads does payloads
+func (cm ConversationModel) RewriteSummaries(from *PayloadCipher) (int, error) {
+	return cm.rewriteTable("summaries", "content", func(content []byte) ([]byte, error) {
+		plain, err := from.decrypt(string(content))
+		if err != nil {
+			return nil, err
+		}
+		stored, err := cm.Cipher.encrypt(plain)
+		return []byte(stored), err
+	})
+}
+
+// Rewrite the content of every attachment the way RewritePayloads does payloads
+func (cm ConversationModel) RewriteAttachments(from *PayloadCipher) (int, error) {
+	return cm.rewriteTable("attachments", "content", func(content []byte) ([]byte, error) {
+		plain, err := from.decryptBytes(content)
+		if err != nil {
+			return nil, err
+		}
+		return cm.Cipher.encryptBytes(plain)
+	})
+}
+
+// Rewrite column of the rows of table that are not yet encrypted, or not yet in plain text
+// when the model has no cipher, in batches by id
+func (cm ConversationModel) rewriteTable(table, column string, rewrite func([]byte) ([]byte, error)) (int, error) {
+	rewritten := 0
+	lastID := int64(0)
+	for {
+		n, last, err := cm.rewriteBatch(table, column, rewrite, lastID)
+		rewritten += n
+		if err != nil || last == lastID {
+			return rewritten, err
+		}
+		lastID = last
+	}
+}
+
+// Rewrite up to rewriteBatch rows after lastID. Returns the id of the last row looked at
+func (cm ConversationModel) rewriteBatch(table, column string, rewrite func([]byte) ([]byte, error), lastID int64) (int, int64, error) {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return 0, lastID, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`SELECT id, %s FROM %s WHERE id > ? ORDER BY id ASC LIMIT ?`, column, table)
+	rows, err := tx.Query(cm.Dialect.rebind(query), lastID, rewriteBatch)
+	if err != nil {
+		return 0, lastID, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+
+	type row struct {
+		id    int64
+		value []byte
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.value); err != nil {
+			rows.Close()
+			return 0, lastID, err
+		}
+		lastID = r.id
+		if bytes.HasPrefix(r.value, []byte(encryptedPrefix)) != (cm.Cipher != nil) {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, lastID, err
+	}
+
+	update := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table, column)
+	for _, r := range pending {
+		value, err := rewrite(r.value)
+		if err != nil {
+			return 0, lastID, fmt.Errorf("failed to read %s row %d: %w", table, r.id, err)
+		}
+		// Payloads and summaries are TEXT, attachments binary
+		var arg any = value
+		if table != "attachments" {
+			arg = string(value)
+		}
+		if _, err := tx.Exec(cm.Dialect.rebind(update), arg, r.id); err != nil {
+			return 0, lastID, fmt.Errorf("failed to rewrite %s row %d: %w", table, r.id, err)
+		}
+	}
+
+	return len(pending), lastID, tx.Commit()
+}
+
+// Whether any stored payload is encrypted, so reading them takes a key
+func (cm ConversationModel) HasEncryptedPayloads() (bool, error) {
+	var exists bool
+	err := cm.DB.QueryRow(cm.Dialect.rebind(`SELECT EXISTS (SELECT 1 FROM messages WHERE payload LIKE ?)`), encryptedPrefix+"%").Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+func createTestCipher(t *testing.T) *PayloadCipher {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey() failed: %v", err)
+	}
+	c, err := NewPayloadCipher(key)
+	if err != nil {
+		t.Fatalf("NewPayloadCipher() failed: %v", err)
+	}
+	return c
+}
+
+func storedPayloads(t *testing.T, cm *ConversationModel, id string) []string {
+	rows, err := cm.DB.Query(`SELECT payload FROM messages WHERE conversation_id = ? ORDER BY sequence_number`, id)
+	if err != nil {
+		t.Fatalf("Failed to query payloads: %v", err)
+	}
+	defer rows.Close()
+
+	var payloads []string
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			t.Fatalf("Failed to scan payload: %v", err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+func TestNewPayloadCipher_KeySize(t *testing.T) {
+	if _, err := NewPayloadCipher(make([]byte, 16)); err == nil {
+		t.Error("NewPayloadCipher() with a 16 byte key succeeded, want an error")
+	}
+}
+
+func TestConversation_Encrypted(t *testing.T) {
+	cm := createTestModel(t)
+	cm.Cipher = createTestCipher(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("proprietary secret sauce")}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	stored := storedPayloads(t, cm, conv.ID)
+	if len(stored) != 1 || !isEncrypted(stored[0]) || strings.Contains(stored[0], "secret") {
+		t.Fatalf("Stored payloads = %q, want one encrypted", stored)
+	}
+
+	// No title is cut from the prompt
+	var title sql.NullString
+	if err := cm.DB.QueryRow(`SELECT title FROM conversations WHERE id = ?`, conv.ID).Scan(&title); err != nil {
+		t.Fatalf("Failed to query title: %v", err)
+	}
+	if strings.Contains(title.String, "secret") {
+		t.Errorf("Stored title = %q, want no prompt text", title.String)
+	}
+
+	// Unchanged messages are not encrypted again
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if again := storedPayloads(t, cm, conv.ID); again[0] != stored[0] {
+		t.Error("Saving an unchanged history rewrote its payload")
+	}
+
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content[0].(message.TextBlock).Text != "proprietary secret sauce" {
+		t.Errorf("Get() messages = %+v, want the saved one", got.Messages)
+	}
+
+	results, err := cm.Search("secret sauce", 10)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ConversationID != conv.ID {
+		t.Errorf("Search() = %+v, want the conversation", results)
+	}
+
+	plain := &ConversationModel{DB: cm.DB}
+	if _, err := plain.Get(conv.ID); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Get() without a key = %v, want ErrEncrypted", err)
+	}
+	if encrypted, err := plain.HasEncryptedPayloads(); err != nil || !encrypted {
+		t.Errorf("HasEncryptedPayloads() = %v, %v, want true", encrypted, err)
+	}
+}
+
+func TestConversation_RewritePayloads(t *testing.T) {
+	cm := createTestModel(t)
+	c := createTestCipher(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewTextBlock("saved in plain text"),
+		message.NewImageBlock("image/png", []byte("plain image"), ""),
+	}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	encrypting := &ConversationModel{DB: cm.DB, Cipher: c}
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("saved encrypted")}})
+	if err := encrypting.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// Only the plain text one is left to encrypt
+	if n, err := encrypting.RewritePayloads(c); err != nil || n != 1 {
+		t.Fatalf("RewritePayloads() = %d, %v, want 1 rewritten", n, err)
+	}
+	for _, payload := range storedPayloads(t, cm, conv.ID) {
+		if !isEncrypted(payload) {
+			t.Errorf("Payload %q left in plain text", payload)
+		}
+	}
+	if n, err := encrypting.RewriteAttachments(c); err != nil || n != 1 {
+		t.Fatalf("RewriteAttachments() = %d, %v, want 1 rewritten", n, err)
+	}
+	if _, err := cm.Get(conv.ID); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Get() without a key = %v, want ErrEncrypted", err)
+	}
+
+	if n, err := cm.RewritePayloads(c); err != nil || n != 2 {
+		t.Fatalf("RewritePayloads() to plain text = %d, %v, want 2 rewritten", n, err)
+	}
+	if n, err := cm.RewriteAttachments(c); err != nil || n != 1 {
+		t.Fatalf("RewriteAttachments() to plain text = %d, %v, want 1 rewritten", n, err)
+	}
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() without a key failed after decrypting: %v", err)
+	}
+	if len(got.Messages) != 2 || got.Messages[1].Content[0].(message.TextBlock).Text != "saved encrypted" {
+		t.Errorf("Get() messages = %+v, want both saved", got.Messages)
+	}
+}
@@ -2,30 +2,56 @@ package data
 
 import (
 	"database/sql"
-	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/tinkererr"
 	"github.com/honganh1206/tinker/utils"
 )
 
-var ErrConversationNotFound = errors.New("history: conversation not found")
-
-//go:embed conversation_schema.sql
-var ConversationSchema string
+// Longest title taken from the first prompt
+const maxAutoTitle = 80
+
+var (
+	ErrConversationNotFound = tinkererr.New(tinkererr.NotFound, "history: conversation not found")
+	ErrMessageGap           = errors.New("history: appended messages do not follow the stored ones")
+	ErrForkPoint            = errors.New("history: fork point is outside the conversation")
+	ErrArchived             = errors.New("history: conversation is archived")
+	ErrNotArchived          = errors.New("history: conversation is not archived")
+	ErrMessageNotFound      = tinkererr.New(tinkererr.NotFound, "history: message not found")
+	ErrMalformedPayload     = errors.New("history: message payload is not a single message")
+)
 
 type Conversation struct {
-	ID        string
-	Messages  []*message.Message
+	ID string
+	// Set by the user, empty until then
+	Title string
+	// Git root the conversation was started in, empty when unknown
+	Project string
+	// Of the latest reply, set by the server as replies come in
+	Provider string
+	Model    string
+	// Conversation this one was forked from and the number of its messages
+	// the fork started with, empty for conversations that are not forks
+	ParentID     string
+	ForkSequence int
+	Tags         []string
+	Messages     []*message.Message
+	// Of compacted messages, the latest last, see History
+	Summaries []*Summary
 	CreatedAt time.Time
 }
 
 type ConversationModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
+	// Encrypts the payloads of messages saved from now on, nil keeps them in plain text
+	Cipher *PayloadCipher
 }
 
 func NewConversation() (*Conversation, error) {
@@ -53,12 +79,12 @@ func (c *Conversation) Append(msg *message.Message) {
 
 func (cm ConversationModel) Create(c *Conversation) error {
 	query := `
-	INSERT INTO conversations (id, created_at)
-	VALUES(?, ?)
+	INSERT INTO conversations (id, project, created_at)
+	VALUES(?, ?, ?)
 	RETURNING id
 	`
 
-	err := cm.DB.QueryRow(query, c.ID, c.CreatedAt).Scan(&c.ID)
+	err := cm.DB.QueryRow(cm.Dialect.rebind(query), c.ID, nullString(c.Project), c.CreatedAt).Scan(&c.ID)
 	if err != nil {
 		return fmt.Errorf("failed to insert new conversation into database: %w", err)
 	}
@@ -76,79 +102,359 @@ func (cm ConversationModel) Save(c *Conversation) error {
 	// TODO: Do I need to init a context for timeouts/graceful cancellation/tracing and logging?
 
 	query := `
-	INSERT OR IGNORE INTO conversations (id, created_at)
-	VALUES(?, ?);
+	INSERT INTO conversations (id, project, created_at)
+	VALUES(?, ?, ?)
+	ON CONFLICT (id) DO NOTHING;
 	`
 
-	if _, err = tx.Exec(query, c.ID, c.CreatedAt); err != nil {
+	if _, err = tx.Exec(cm.Dialect.rebind(query), c.ID, nullString(c.Project), c.CreatedAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Messages saved now would clash with the archived ones once it is unarchived
+	if err := cm.checkArchived(tx, c.ID, false); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := cm.setAutoTitle(tx, c.ID, c.Messages); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Only the messages from the first one differing from the stored history are rewritten,
+	// so a history that grew since the last save costs the new messages alone
+	payloads := make([]string, len(c.Messages))
+	attachments := make([][]attachment, len(c.Messages))
+	for i, msg := range c.Messages {
+		detached, detachedAttachments, detachErr := detachAttachments(msg)
+		if detachErr != nil {
+			tx.Rollback()
+			return detachErr
+		}
+		jsonBytes, jsonErr := json.Marshal(detached)
+		if jsonErr != nil {
+			tx.Rollback()
+			return jsonErr
+		}
+		payloads[i] = string(jsonBytes)
+		attachments[i] = detachedAttachments
+	}
+
+	saved, err := cm.savedPrefix(tx, c.ID, payloads)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := saved; i < len(payloads); i++ {
+		if payloads[i], err = cm.Cipher.encrypt(payloads[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Attachments of the rewritten messages go once nothing refers to them anymore
+	replaced, err := cm.attachmentRefsFrom(tx, c.ID, saved)
+	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// FIXME: Currently delete and re-insert all messages, extremely inefficient
-	// There should be a lastSavedIndex to insert the latest message. Should it be a column?
 	query = `
-	DELETE FROM messages WHERE conversation_id = ?;
+	DELETE FROM messages WHERE conversation_id = ? AND sequence_number >= ?;
 	`
 
-	if _, err = tx.Exec(query, c.ID); err != nil {
+	if _, err = tx.Exec(cm.Dialect.rebind(query), c.ID, saved); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// A summary of rewritten messages no longer says what they hold
+	if err = cm.dropSummariesFrom(tx, c.ID, saved); err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	if saved == len(c.Messages) {
+		if err = cm.dropUnreferencedAttachments(tx, c.ID, replaced); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+
 	query = `
 	INSERT INTO messages (conversation_id, sequence_number, payload, created_at)
 	VALUES (?, ?, ?, ?);
 	`
 
-	stmt, err := tx.Prepare(query)
+	stmt, err := tx.Prepare(cm.Dialect.rebind(query))
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
-	for i, msg := range c.Messages {
-		jsonBytes, jsonErr := json.Marshal(msg)
-		if jsonErr != nil {
+	for i := saved; i < len(c.Messages); i++ {
+		if err = cm.storeAttachments(tx, c.ID, attachments[i]); err != nil {
 			tx.Rollback()
-			return jsonErr
+			return err
 		}
-		payloadString := string(jsonBytes)
-		_, err = stmt.Exec(c.ID, i, payloadString, msg.CreatedAt)
+		_, err = stmt.Exec(c.ID, i, payloads[i], c.Messages[i].CreatedAt)
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
 	}
 
+	if err = cm.dropUnreferencedAttachments(tx, c.ID, replaced); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (cm ConversationModel) List() ([]ConversationMetadata, error) {
+// Message of a decrypted payload. Each row of messages holds one message, the JSON object
+// of it. Rows written before that was settled hold an array of the message alone, read the same
+func decodePayload(payload string) (*message.Message, error) {
+	if strings.HasPrefix(strings.TrimSpace(payload), "[") {
+		var legacy []*message.Message
+		if err := json.Unmarshal([]byte(payload), &legacy); err != nil {
+			return nil, err
+		}
+		if len(legacy) != 1 || legacy[0] == nil {
+			return nil, fmt.Errorf("%w: it holds %d", ErrMalformedPayload, len(legacy))
+		}
+		return legacy[0], nil
+	}
+
+	var msg *message.Message
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("%w: it is null", ErrMalformedPayload)
+	}
+	return msg, nil
+}
+
+// Number of leading payloads the stored history already holds as is.
+// Encrypted ones are compared decrypted, the same message never encrypts the same twice
+func (cm ConversationModel) savedPrefix(tx *sql.Tx, id string, payloads []string) (int, error) {
+	rows, err := tx.Query(cm.Dialect.rebind(`
+		SELECT sequence_number, payload FROM messages
+		WHERE conversation_id = ?
+		ORDER BY sequence_number ASC`), id)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	saved := 0
+	for rows.Next() {
+		var sequence int
+		var payload string
+		if err := rows.Scan(&sequence, &payload); err != nil {
+			return 0, err
+		}
+		if sequence == saved && saved < len(payloads) && isEncrypted(payload) {
+			if payload, err = cm.Cipher.decrypt(payload); err != nil {
+				return 0, err
+			}
+		}
+		if sequence != saved || saved == len(payloads) || payload != payloads[saved] {
+			break
+		}
+		saved++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return saved, nil
+}
+
+// Payload stored for msg in conversation id, encrypted when the model has a cipher.
+// Its images and oversized tool results are stored as attachments
+func (cm ConversationModel) encodeMessage(tx *sql.Tx, id string, msg *message.Message) (string, error) {
+	detached, attachments, err := detachAttachments(msg)
+	if err != nil {
+		return "", err
+	}
+	if err := cm.storeAttachments(tx, id, attachments); err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(detached)
+	if err != nil {
+		return "", err
+	}
+	return cm.Cipher.encrypt(string(payload))
+}
+
+// Append msgs to the stored history, the first one having sequence number from.
+// Messages the database already holds are skipped, so retrying an append is harmless.
+// Returns the number of stored messages afterwards
+func (cm ConversationModel) AppendMessages(id string, from int, msgs []*message.Message) (int, error) {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction for appending to conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := cm.checkArchived(tx, id, false); err != nil {
+		return 0, err
+	}
+
+	var stored int
+	err = tx.QueryRow(cm.Dialect.rebind(`
+		SELECT COUNT(m.id) FROM conversations c
+		LEFT JOIN messages m ON m.conversation_id = c.id
+		WHERE c.id = ?
+		GROUP BY c.id`), id).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return 0, ErrConversationNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages of conversation '%s': %w", id, err)
+	}
+
+	if from > stored {
+		return stored, ErrMessageGap
+	}
+
+	pending := msgs[min(stored-from, len(msgs)):]
+	if len(pending) == 0 {
+		return stored, nil
+	}
+
+	stmt, err := tx.Prepare(cm.Dialect.rebind(`
+		INSERT INTO messages (conversation_id, sequence_number, payload, created_at)
+		VALUES (?, ?, ?, ?)`))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for i, msg := range pending {
+		payload, err := cm.encodeMessage(tx, id, msg)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(id, stored+i, payload, msg.CreatedAt); err != nil {
+			return 0, fmt.Errorf("failed to append message %d to conversation '%s': %w", stored+i, id, err)
+		}
+	}
+
+	if from == 0 {
+		if err := cm.setAutoTitle(tx, id, msgs); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return stored + len(pending), nil
+}
+
+// Title an untitled conversation after the first line of its first prompt in msgs,
+// so lists show more than IDs. A title set by the user is left alone
+func (cm ConversationModel) setAutoTitle(tx *sql.Tx, id string, msgs []*message.Message) error {
+	// The prompt is encrypted at rest, a title cut from it would leak it in plaintext
+	if cm.Cipher != nil {
+		return nil
+	}
+
+	title := autoTitle(msgs)
+	if title == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(cm.Dialect.rebind(`UPDATE conversations SET title = ? WHERE id = ? AND title IS NULL`), title, id)
+	if err != nil {
+		return fmt.Errorf("failed to title conversation '%s': %w", id, err)
+	}
+	return nil
+}
+
+// Same as the 0006 migration does for the conversations stored before
+func autoTitle(msgs []*message.Message) string {
+	for _, msg := range msgs {
+		if msg.Role != message.UserRole || len(msg.Content) == 0 {
+			continue
+		}
+		text, ok := msg.Content[0].(message.TextBlock)
+		if !ok {
+			continue
+		}
+
+		line, _, _ := strings.Cut(strings.TrimSpace(text.Text), "\n")
+		title := []rune(strings.TrimSpace(line))
+		return strings.TrimSpace(string(title[:min(len(title), maxAutoTitle)]))
+	}
+	return ""
+}
+
+// Record the model of the latest reply. Empty values keep the stored ones
+func (cm ConversationModel) SetModel(id, provider, model string) error {
+	_, err := cm.DB.Exec(cm.Dialect.rebind(`
+		UPDATE conversations
+		SET provider = COALESCE(?, provider), model = COALESCE(?, model)
+		WHERE id = ?`), nullString(provider), nullString(model), id)
+	if err != nil {
+		return fmt.Errorf("failed to record the model of conversation '%s': %w", id, err)
+	}
+	return nil
+}
+
+// List conversations matching filter, most recently active first
+func (cm ConversationModel) List(filter ListFilter) ([]ConversationMetadata, error) {
+	where, args := filter.where("c.id", "c.project", TagConversation)
+	archived := "c.archived_at IS NULL"
+	if filter.Archived {
+		archived = "c.archived_at IS NOT NULL"
+	}
+	if where == "" {
+		where = "WHERE " + archived
+	} else {
+		where += " AND " + archived
+	}
+
 	query := `
 		SELECT
 			c.id,
+			COALESCE(c.title, ''),
+			COALESCE(c.project, ''),
+			COALESCE(c.provider, ''),
+			COALESCE(c.model, ''),
+			COALESCE(c.parent_id, ''),
+			c.archived_at,
 			c.created_at,
 			COUNT(m.id) as message_count,
-			COALESCE(MAX(m.created_at), c.created_at) as latest_message_at
+			COALESCE(MAX(m.created_at), c.last_message_at, c.created_at) as latest_message_at
 		FROM
 			conversations c
 		LEFT JOIN
 			messages m ON c.id = m.conversation_id
+		` + where + `
 		GROUP BY
 			c.id
 		ORDER BY
 			latest_message_at DESC;
 	`
 
-	rows, err := cm.DB.Query(query)
+	rows, err := cm.DB.Query(cm.Dialect.rebind(query), args...)
 	if err != nil {
 		// Check for missing tables
-		var tableCheck string
-		errTable := cm.DB.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='conversations'").Scan(&tableCheck)
-		if errTable == sql.ErrNoRows {
-			return []ConversationMetadata{}, nil // No 'conversations' table, so no conversations
+		if cm.Dialect == SQLite {
+			var tableCheck string
+			errTable := cm.DB.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='conversations'").Scan(&tableCheck)
+			if errTable == sql.ErrNoRows {
+				return []ConversationMetadata{}, nil // No 'conversations' table, so no conversations
+			}
 		}
 		return nil, fmt.Errorf("failed to query conversations: %w", err)
 	}
@@ -158,12 +464,16 @@ func (cm ConversationModel) List() ([]ConversationMetadata, error) {
 	var metadataList []ConversationMetadata
 	for rows.Next() {
 		var meta ConversationMetadata
+		var archivedAt sql.NullTime
 		var createdAt string
 		var latestTimestamp string
 
-		if err := rows.Scan(&meta.ID, &createdAt, &meta.MessageCount, &latestTimestamp); err != nil {
+		if err := rows.Scan(&meta.ID, &meta.Title, &meta.Project, &meta.Provider, &meta.Model, &meta.ParentID, &archivedAt, &createdAt, &meta.MessageCount, &latestTimestamp); err != nil {
 			return nil, fmt.Errorf("failed to scan conversation metadata: %w", err)
 		}
+		if archivedAt.Valid {
+			meta.ArchivedAt = &archivedAt.Time
+		}
 		meta.CreatedAt, err = utils.ParseTimeWithFallback(createdAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse conversation created_at: %w", err)
@@ -180,12 +490,20 @@ func (cm ConversationModel) List() ([]ConversationMetadata, error) {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
+	tagsByID, err := loadTags(cm.DB, cm.Dialect, TagConversation)
+	if err != nil {
+		return nil, err
+	}
+	for i := range metadataList {
+		metadataList[i].Tags = tagsByID[metadataList[i].ID]
+	}
+
 	return metadataList, nil
 }
 
 func (cm ConversationModel) LatestID() (string, error) {
 	query := `
-		SELECT id FROM conversations ORDER BY created_at DESC LIMIT 1
+		SELECT id FROM conversations WHERE archived_at IS NULL ORDER BY created_at DESC LIMIT 1
 	`
 
 	var id string
@@ -202,17 +520,22 @@ func (cm ConversationModel) LatestID() (string, error) {
 
 func (cm ConversationModel) Get(id string) (*Conversation, error) {
 	query := `
-		SELECT created_at FROM conversations WHERE id = ?
+		SELECT COALESCE(title, ''), COALESCE(project, ''), COALESCE(provider, ''), COALESCE(model, ''), COALESCE(parent_id, ''), COALESCE(fork_sequence, 0), archived_at, created_at FROM conversations WHERE id = ?
 	`
 	conv := &Conversation{ID: id, Messages: make([]*message.Message, 0)}
 
-	err := cm.DB.QueryRow(query, id).Scan(&conv.CreatedAt)
+	var archivedAt sql.NullTime
+	err := cm.DB.QueryRow(cm.Dialect.rebind(query), id).Scan(&conv.Title, &conv.Project, &conv.Provider, &conv.Model, &conv.ParentID, &conv.ForkSequence, &archivedAt, &conv.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrConversationNotFound
 		}
 		return nil, fmt.Errorf("failed to query conversation metadata for ID '%s': %w", id, err)
 	}
+	// Its messages are in the archive, an empty history would pass for the real one
+	if archivedAt.Valid {
+		return nil, ErrArchived
+	}
 
 	query = `
 		SELECT
@@ -223,7 +546,7 @@ func (cm ConversationModel) Get(id string) (*Conversation, error) {
 			sequence_number ASC
 	`
 
-	rows, err := cm.DB.Query(query, id)
+	rows, err := cm.DB.Query(cm.Dialect.rebind(query), id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages for conversation ID '%s': %w", id, err)
 	}
@@ -233,15 +556,20 @@ func (cm ConversationModel) Get(id string) (*Conversation, error) {
 
 	for rows.Next() {
 		var sequenceNumber int
-		var payload []byte
+		var payload string
 
 		if err := rows.Scan(&sequenceNumber, &payload); err != nil {
 			return nil, fmt.Errorf("failed to scan message for conversation ID '%s': %w", id, err)
 		}
 
-		var msg *message.Message
-		if err := json.Unmarshal(payload, &msg); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal temp message payload for conversation ID '%s': %w", id, err)
+		payload, err = cm.Cipher.decrypt(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message %d of conversation ID '%s': %w", sequenceNumber, id, err)
+		}
+
+		msg, err := decodePayload(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message %d of conversation ID '%s': %w", sequenceNumber, id, err)
 		}
 
 		// Restore the sequence number from database
@@ -254,9 +582,342 @@ func (cm ConversationModel) Get(id string) (*Conversation, error) {
 		return nil, fmt.Errorf("error during message rows iteration for conversation ID '%s': %w", id, err)
 	}
 
+	if err := cm.resolveAttachments(id, msgs); err != nil {
+		return nil, err
+	}
+
 	for _, msg := range msgs {
 		conv.Messages = append(conv.Messages, msg)
 	}
 
-	return conv, nil
+	if conv.Summaries, err = cm.summaries(id); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := cm.DB.Query(cm.Dialect.rebind(`SELECT tag FROM tags WHERE resource_type = ? AND resource_id = ? ORDER BY tag`), TagConversation, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags for conversation ID '%s': %w", id, err)
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var tag string
+		if err := tagRows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag for conversation ID '%s': %w", id, err)
+		}
+		conv.Tags = append(conv.Tags, tag)
+	}
+
+	return conv, tagRows.Err()
+}
+
+// Start a new conversation from the first atSequence messages of conversation id,
+// to take it in another direction while keeping the original as is. The messages are
+// copied rather than shared, so either side can be rewritten or deleted on its own
+func (cm ConversationModel) Fork(id string, atSequence int) (*Conversation, error) {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction for forking conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := cm.checkArchived(tx, id, false); err != nil {
+		return nil, err
+	}
+
+	var title, project, provider, model sql.NullString
+	err = tx.QueryRow(cm.Dialect.rebind(`SELECT title, project, provider, model FROM conversations WHERE id = ?`), id).
+		Scan(&title, &project, &provider, &model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation '%s': %w", id, err)
+	}
+
+	var count int
+	if err := tx.QueryRow(cm.Dialect.rebind(`SELECT COUNT(*) FROM messages WHERE conversation_id = ?`), id).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count messages of conversation '%s': %w", id, err)
+	}
+	if atSequence < 0 || atSequence > count {
+		return nil, fmt.Errorf("%w: it has %d messages, cannot fork at %d", ErrForkPoint, count, atSequence)
+	}
+
+	fork, err := NewConversation()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO conversations (id, title, project, provider, model, parent_id, fork_sequence, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	if _, err := tx.Exec(cm.Dialect.rebind(query), fork.ID, title, project, provider, model, id, atSequence, fork.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to insert fork of conversation '%s': %w", id, err)
+	}
+
+	query = `
+	INSERT INTO messages (conversation_id, sequence_number, payload, created_at)
+	SELECT ?, sequence_number, payload, created_at
+	FROM messages
+	WHERE conversation_id = ? AND sequence_number < ?
+	`
+	if _, err := tx.Exec(cm.Dialect.rebind(query), fork.ID, id, atSequence); err != nil {
+		return nil, fmt.Errorf("failed to copy messages of conversation '%s': %w", id, err)
+	}
+
+	// All of them, those of the messages left out are few and harmless
+	query = `
+	INSERT INTO attachments (conversation_id, hash, content, created_at)
+	SELECT ?, hash, content, created_at
+	FROM attachments
+	WHERE conversation_id = ?
+	`
+	if _, err := tx.Exec(cm.Dialect.rebind(query), fork.ID, id); err != nil {
+		return nil, fmt.Errorf("failed to copy attachments of conversation '%s': %w", id, err)
+	}
+
+	query = `
+	INSERT INTO summaries (conversation_id, start_sequence, end_sequence, content, created_at)
+	SELECT ?, start_sequence, end_sequence, content, created_at
+	FROM summaries
+	WHERE conversation_id = ? AND end_sequence <= ?
+	`
+	if _, err := tx.Exec(cm.Dialect.rebind(query), fork.ID, id, atSequence); err != nil {
+		return nil, fmt.Errorf("failed to copy summaries of conversation '%s': %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return cm.Get(fork.ID)
+}
+
+// Replace block of message sequence in conversation id with a tombstone, every block of it
+// when block is negative. What the block held is gone from the database, its attachments,
+// search index entries and the summaries covering it included. Forks keep their own copies
+func (cm ConversationModel) Redact(id string, sequence, block int) error {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for redacting conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := cm.checkArchived(tx, id, false); err != nil {
+		return err
+	}
+
+	var payload string
+	var createdAt time.Time
+	err = tx.QueryRow(cm.Dialect.rebind(`SELECT payload, created_at FROM messages WHERE conversation_id = ? AND sequence_number = ?`), id, sequence).
+		Scan(&payload, &createdAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: conversation '%s' has no message %d", ErrMessageNotFound, id, sequence)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query message %d of conversation '%s': %w", sequence, id, err)
+	}
+
+	if payload, err = cm.Cipher.decrypt(payload); err != nil {
+		return err
+	}
+	msg, err := decodePayload(payload)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal message %d of conversation '%s': %w", sequence, id, err)
+	}
+	if block >= len(msg.Content) {
+		return fmt.Errorf("%w: message %d of conversation '%s' has %d blocks, no block %d", ErrMessageNotFound, sequence, id, len(msg.Content), block)
+	}
+
+	// The stored blocks still refer to their attachments
+	var refs []string
+	for i, b := range msg.Content {
+		if block >= 0 && i != block {
+			continue
+		}
+		switch b := b.(type) {
+		case message.ImageBlock:
+			refs = append(refs, b.Attachment)
+		case message.ToolResultBlock:
+			refs = append(refs, b.Attachment)
+		}
+		msg.Content[i] = message.Redact(b)
+	}
+
+	encoded, err := cm.encodeMessage(tx, id, msg)
+	if err != nil {
+		return err
+	}
+
+	// Replaced rather than updated, so the search index triggers drop the redacted text
+	if _, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM messages WHERE conversation_id = ? AND sequence_number = ?`), id, sequence); err != nil {
+		return fmt.Errorf("failed to redact message %d of conversation '%s': %w", sequence, id, err)
+	}
+	if _, err := tx.Exec(cm.Dialect.rebind(`INSERT INTO messages (conversation_id, sequence_number, payload, created_at) VALUES (?, ?, ?, ?)`), id, sequence, encoded, createdAt); err != nil {
+		return fmt.Errorf("failed to redact message %d of conversation '%s': %w", sequence, id, err)
+	}
+
+	if err := cm.dropUnreferencedAttachments(tx, id, refs); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM summaries WHERE conversation_id = ? AND start_sequence <= ? AND end_sequence > ?`), id, sequence, sequence); err != nil {
+		return fmt.Errorf("failed to drop summaries of conversation '%s': %w", id, err)
+	}
+
+	return tx.Commit()
+}
+
+// Drop the messages of conversation id once the caller has stored them elsewhere.
+// The conversation itself stays, left out of listings unless ListFilter.Archived is set
+func (cm ConversationModel) Archive(id string) error {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for archiving conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := cm.checkArchived(tx, id, false); err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE conversations
+	SET archived_at = ?, last_message_at = (SELECT MAX(created_at) FROM messages WHERE conversation_id = ?)
+	WHERE id = ?
+	`
+	if _, err := tx.Exec(cm.Dialect.rebind(query), time.Now(), id, id); err != nil {
+		return fmt.Errorf("failed to archive conversation '%s': %w", id, err)
+	}
+
+	for _, table := range []string{"messages", "attachments", "summaries"} {
+		if _, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM `+table+` WHERE conversation_id = ?`), id); err != nil {
+			return fmt.Errorf("failed to delete %s of conversation '%s': %w", table, id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Put back the messages and summaries of an archived conversation, as read from its archive
+func (cm ConversationModel) Unarchive(id string, archived *Conversation) error {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for unarchiving conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := cm.checkArchived(tx, id, true); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(cm.Dialect.rebind(`INSERT INTO messages (conversation_id, sequence_number, payload, created_at) VALUES (?, ?, ?, ?)`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, msg := range archived.Messages {
+		payload, err := cm.encodeMessage(tx, id, msg)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(id, i, payload, msg.CreatedAt); err != nil {
+			return fmt.Errorf("failed to restore messages of conversation '%s': %w", id, err)
+		}
+	}
+
+	for _, s := range archived.Summaries {
+		if err := cm.insertSummary(tx, id, s); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(cm.Dialect.rebind(`UPDATE conversations SET archived_at = NULL, last_message_at = NULL WHERE id = ?`), id); err != nil {
+		return fmt.Errorf("failed to unarchive conversation '%s': %w", id, err)
+	}
+
+	return tx.Commit()
+}
+
+// Fail unless conversation id exists and is archived or not, as wanted
+func (cm ConversationModel) checkArchived(tx *sql.Tx, id string, want bool) error {
+	var archivedAt sql.NullTime
+	err := tx.QueryRow(cm.Dialect.rebind(`SELECT archived_at FROM conversations WHERE id = ?`), id).Scan(&archivedAt)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query conversation '%s': %w", id, err)
+	}
+
+	switch {
+	case archivedAt.Valid && !want:
+		return ErrArchived
+	case !archivedAt.Valid && want:
+		return ErrNotArchived
+	}
+	return nil
+}
+
+// Give a conversation a human-readable title, an empty one clears it
+func (cm ConversationModel) Rename(id, title string) error {
+	var value sql.NullString
+	if title != "" {
+		value = sql.NullString{String: title, Valid: true}
+	}
+
+	result, err := cm.DB.Exec(cm.Dialect.rebind(`UPDATE conversations SET title = ? WHERE id = ?`), value, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename conversation '%s': %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConversationNotFound
+	}
+
+	return nil
+}
+
+// Delete a conversation along with its messages and its plan.
+// The plan, its steps and history go through the cascade of their foreign keys, the rest is deleted here
+func (cm ConversationModel) Delete(id string) error {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for deleting conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM tags WHERE resource_type = 'plan' AND resource_id IN (SELECT id FROM plans WHERE conversation_id = ?)`,
+		`DELETE FROM tags WHERE resource_type = 'conversation' AND resource_id = ?`,
+		`DELETE FROM messages WHERE conversation_id = ?`,
+		`DELETE FROM attachments WHERE conversation_id = ?`,
+		`DELETE FROM summaries WHERE conversation_id = ?`,
+		// Forks keep their copies of the messages, only the link goes
+		`UPDATE conversations SET parent_id = NULL, fork_sequence = NULL WHERE parent_id = ?`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(cm.Dialect.rebind(query), id); err != nil {
+			return fmt.Errorf("failed to delete data of conversation '%s': %w", id, err)
+		}
+	}
+
+	result, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM conversations WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation '%s': %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConversationNotFound
+	}
+
+	return tx.Commit()
 }
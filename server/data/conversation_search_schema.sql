@@ -0,0 +1,40 @@
+-- Full-text index over the text blocks of messages. Requires SQLite built with FTS5,
+-- which go-sqlite3 only does with the sqlite_fts5 build tag.
+-- Contentless, the text stays in the payloads only, and the rowid of an entry is the
+-- id of its message
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+    text,
+    content = '',
+    contentless_delete = 1,
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert
+AFTER INSERT ON messages
+FOR EACH ROW
+BEGIN
+    INSERT INTO messages_fts (rowid, text)
+    VALUES (
+        new.id,
+        (SELECT COALESCE(group_concat(json_extract(value, '$.text'), ' '), '')
+         FROM json_each(new.payload, '$.content')
+         WHERE json_extract(value, '$.type') = 'text')
+    );
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete
+AFTER DELETE ON messages
+FOR EACH ROW
+BEGIN
+    DELETE FROM messages_fts WHERE rowid = old.id;
+END;
+
+-- Index messages saved before the index existed
+INSERT INTO messages_fts (rowid, text)
+SELECT
+    m.id,
+    (SELECT COALESCE(group_concat(json_extract(value, '$.text'), ' '), '')
+     FROM json_each(m.payload, '$.content')
+     WHERE json_extract(value, '$.type') = 'text')
+FROM messages m
+WHERE m.id NOT IN (SELECT rowid FROM messages_fts);
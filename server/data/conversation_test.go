@@ -1,10 +1,16 @@
 package data
 
 import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/db"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -129,6 +135,363 @@ func TestConversation_SaveTo(t *testing.T) {
 	}
 }
 
+func TestConversation_Save_KeepsStoredPrefix(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	for _, text := range []string{"one", "two", "three"} {
+		conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(text)}})
+	}
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// Row IDs of the stored messages, changing when a message is rewritten
+	rowIDs := func() []int64 {
+		t.Helper()
+		rows, err := cm.DB.Query("SELECT id FROM messages WHERE conversation_id = ? ORDER BY sequence_number", conv.ID)
+		if err != nil {
+			t.Fatalf("Failed to query saved messages: %v", err)
+		}
+		defer rows.Close()
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("Failed to scan message row: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	before := rowIDs()
+
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("four")}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	grown := rowIDs()
+	if len(grown) != 4 || !slices.Equal(grown[:3], before) {
+		t.Errorf("Rows after appending = %v, want %v kept and one more", grown, before)
+	}
+
+	// A rewritten history, e.g., compacted, keeps the messages before the first change only
+	conv.Messages = conv.Messages[:2]
+	conv.Messages[1] = &message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("summary")}, Sequence: 1}
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	rewritten := rowIDs()
+	if len(rewritten) != 2 || rewritten[0] != before[0] || rewritten[1] == before[1] {
+		t.Errorf("Rows after rewriting = %v, want the first of %v kept and a new second", rewritten, before)
+	}
+
+	stored, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if text := stored.Messages[1].Content[0].(message.TextBlock).Text; len(stored.Messages) != 2 || text != "summary" {
+		t.Errorf("Stored %d messages ending with %q, want 2 ending with summary", len(stored.Messages), text)
+	}
+}
+
+// The server and a CLI command writing to the same file wait for each other
+func TestConversation_ConcurrentHandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var models []ConversationModel
+	for range 2 {
+		conn, err := db.OpenDB(path)
+		if err != nil {
+			t.Fatalf("OpenDB() failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		models = append(models, ConversationModel{DB: conn})
+	}
+	if _, err := Migrate(models[0].DB, SQLite); err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+
+	var mode string
+	if err := models[1].DB.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q, %v, want wal", mode, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conv, err := NewConversation()
+			if err != nil {
+				errs <- err
+				return
+			}
+			cm := models[i%2]
+			if err := cm.Create(conv); err != nil {
+				errs <- err
+				return
+			}
+			// Reads the stored count before writing, the pattern prone to deadlocks
+			conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("hello")}})
+			_, err = cm.AppendMessages(conv.ID, 0, conv.Messages)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Writing failed: %v", err)
+		}
+	}
+}
+
+func TestConversation_AutoTitle(t *testing.T) {
+	cm := createTestModel(t)
+
+	saved, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	saved.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("\n  Fix the flaky test  \nIt fails in CI")}})
+	if err := cm.Save(saved); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	appended, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(appended); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	appended.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(strings.Repeat("é", 100))}})
+	if _, err := cm.AppendMessages(appended.ID, 0, appended.Messages); err != nil {
+		t.Fatalf("AppendMessages() failed: %v", err)
+	}
+
+	for conv, want := range map[*Conversation]string{saved: "Fix the flaky test", appended: strings.Repeat("é", maxAutoTitle)} {
+		stored, err := cm.Get(conv.ID)
+		if err != nil {
+			t.Fatalf("Get() failed: %v", err)
+		}
+		if stored.Title != want {
+			t.Errorf("Title = %q, want %q", stored.Title, want)
+		}
+	}
+
+	// A title set by the user stays
+	if err := cm.Rename(saved.ID, "Mine"); err != nil {
+		t.Fatalf("Rename() failed: %v", err)
+	}
+	if err := cm.Save(saved); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if stored, err := cm.Get(saved.ID); err != nil || stored.Title != "Mine" {
+		t.Errorf("Title after saving again = %q, %v, want Mine", stored.Title, err)
+	}
+}
+
+func TestConversation_SetModel(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	if err := cm.SetModel(conv.ID, "anthropic", "claude-sonnet-4-5"); err != nil {
+		t.Fatalf("SetModel() failed: %v", err)
+	}
+	// A custom model of unknown provider keeps the previous one
+	if err := cm.SetModel(conv.ID, "", "my-model"); err != nil {
+		t.Fatalf("SetModel() failed: %v", err)
+	}
+
+	stored, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if stored.Provider != "anthropic" || stored.Model != "my-model" {
+		t.Errorf("Provider, Model = %q, %q, want anthropic, my-model", stored.Provider, stored.Model)
+	}
+}
+
+func TestConversation_Fork(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	conv.Project = "/src/tinker"
+	for _, text := range []string{"first", "second", "third"} {
+		conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(text)}})
+	}
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if err := cm.Rename(conv.ID, "Original"); err != nil {
+		t.Fatalf("Rename() failed: %v", err)
+	}
+
+	fork, err := cm.Fork(conv.ID, 2)
+	if err != nil {
+		t.Fatalf("Fork() failed: %v", err)
+	}
+	if fork.ID == conv.ID || fork.ParentID != conv.ID || fork.ForkSequence != 2 {
+		t.Errorf("ID, ParentID, ForkSequence = %q, %q, %d, want a new ID, %q, 2", fork.ID, fork.ParentID, fork.ForkSequence, conv.ID)
+	}
+	if fork.Title != "Original" || fork.Project != "/src/tinker" {
+		t.Errorf("Title, Project = %q, %q, want those of the parent", fork.Title, fork.Project)
+	}
+	if len(fork.Messages) != 2 || fork.Messages[1].Content[0].(message.TextBlock).Text != "second" {
+		t.Fatalf("Fork messages = %+v, want the first two of the parent", fork.Messages)
+	}
+
+	// The fork goes its own way
+	reply := &message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("elsewhere")}}
+	if _, err := cm.AppendMessages(fork.ID, 2, []*message.Message{reply}); err != nil {
+		t.Fatalf("AppendMessages() failed: %v", err)
+	}
+	parent, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(parent.Messages) != 3 || parent.Messages[2].Content[0].(message.TextBlock).Text != "third" {
+		t.Errorf("Parent messages = %+v, want them unchanged", parent.Messages)
+	}
+
+	if _, err := cm.Fork(conv.ID, 4); !errors.Is(err, ErrForkPoint) {
+		t.Errorf("Fork() past the end = %v, want ErrForkPoint", err)
+	}
+	if _, err := cm.Fork("missing", 0); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Fork() of a missing conversation = %v, want ErrConversationNotFound", err)
+	}
+
+	// Deleting the parent leaves the fork whole
+	if err := cm.Delete(conv.ID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	orphan, err := cm.Get(fork.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if orphan.ParentID != "" || len(orphan.Messages) != 3 {
+		t.Errorf("ParentID, messages = %q, %d, want no parent and 3 messages", orphan.ParentID, len(orphan.Messages))
+	}
+}
+
+func TestConversation_Archive(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	conv.CreatedAt = time.Now().Add(-48 * time.Hour)
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("question")}})
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("answer")}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if err := cm.Archive(conv.ID); err != nil {
+		t.Fatalf("Archive() failed: %v", err)
+	}
+	if err := cm.Archive(conv.ID); !errors.Is(err, ErrArchived) {
+		t.Errorf("Archive() twice = %v, want ErrArchived", err)
+	}
+	if err := cm.Archive("missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Archive() of a missing conversation = %v, want ErrConversationNotFound", err)
+	}
+
+	if _, err := cm.Get(conv.ID); !errors.Is(err, ErrArchived) {
+		t.Errorf("Get() of an archived conversation = %v, want ErrArchived", err)
+	}
+	if _, err := cm.Fork(conv.ID, 0); !errors.Is(err, ErrArchived) {
+		t.Errorf("Fork() of an archived conversation = %v, want ErrArchived", err)
+	}
+
+	if list, err := cm.List(ListFilter{}); err != nil || len(list) != 0 {
+		t.Errorf("List() = %+v, %v, want archived conversations left out", list, err)
+	}
+	if _, err := cm.LatestID(); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("LatestID() = %v, want archived conversations left out", err)
+	}
+
+	list, err := cm.List(ListFilter{Archived: true})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(list) != 1 || list[0].ArchivedAt == nil {
+		t.Fatalf("List() of archived = %+v, want the conversation", list)
+	}
+	// Still dated by its latest message, which is gone from the database
+	if last := list[0].LatestMessageTime; last.Before(time.Now().Add(-time.Hour)) {
+		t.Errorf("LatestMessageTime = %v, want the time of the answer", last)
+	}
+
+	if err := cm.Unarchive(conv.ID, conv); err != nil {
+		t.Fatalf("Unarchive() failed: %v", err)
+	}
+	if err := cm.Unarchive(conv.ID, conv); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Unarchive() twice = %v, want ErrNotArchived", err)
+	}
+
+	restored, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(restored.Messages) != 2 || restored.Messages[1].Content[0].(message.TextBlock).Text != "answer" {
+		t.Errorf("Restored conversation = %+v, want both messages back", restored)
+	}
+}
+
+func TestConversation_Archive_RejectsWrites(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("question")}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if err := cm.Archive(conv.ID); err != nil {
+		t.Fatalf("Archive() failed: %v", err)
+	}
+
+	late := &message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("late answer")}}
+	if err := cm.Save(&Conversation{ID: conv.ID, Messages: []*message.Message{conv.Messages[0], late}, CreatedAt: conv.CreatedAt}); !errors.Is(err, ErrArchived) {
+		t.Errorf("Save() of an archived conversation = %v, want ErrArchived", err)
+	}
+	if _, err := cm.AppendMessages(conv.ID, 1, []*message.Message{late}); !errors.Is(err, ErrArchived) {
+		t.Errorf("AppendMessages() to an archived conversation = %v, want ErrArchived", err)
+	}
+
+	// Nothing was written that would clash with the restored messages
+	if err := cm.Unarchive(conv.ID, conv); err != nil {
+		t.Fatalf("Unarchive() failed: %v", err)
+	}
+	restored, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(restored.Messages) != 1 {
+		t.Errorf("Restored %d messages, want the archived one alone", len(restored.Messages))
+	}
+}
+
 func TestConversation_Save_DuplicateConversation(t *testing.T) {
 	cm := createTestModel(t)
 
@@ -185,7 +548,7 @@ func TestList(t *testing.T) {
 	cm := createTestModel(t)
 
 	// Test empty database
-	metadataList, err := cm.List()
+	metadataList, err := cm.List(ListFilter{})
 	if err != nil {
 		t.Fatalf("List() failed on empty database: %v", err)
 	}
@@ -235,7 +598,7 @@ func TestList(t *testing.T) {
 	}
 
 	// Test List function
-	metadataList, err = cm.List()
+	metadataList, err = cm.List(ListFilter{})
 	if err != nil {
 		t.Fatalf("List() failed: %v", err)
 	}
@@ -286,7 +649,7 @@ func TestList_EmptyConversation(t *testing.T) {
 		t.Fatalf("Failed to insert empty conversation: %v", err)
 	}
 
-	metadataList, err := cm.List()
+	metadataList, err := cm.List(ListFilter{})
 	if err != nil {
 		t.Fatalf("List() failed: %v", err)
 	}
@@ -527,3 +890,366 @@ func TestGet_EmptyConversation(t *testing.T) {
 	}
 }
 
+
+func TestDelete(t *testing.T) {
+	model := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	conv.Append(&message.Message{
+		Role:    message.UserRole,
+		Content: []message.ContentBlock{message.NewTextBlock("Delete me")},
+	})
+	if err := model.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	plans := PlanModel{DB: model.DB}
+	plan, err := NewPlan(conv.ID)
+	if err != nil {
+		t.Fatalf("NewPlan() failed: %v", err)
+	}
+	if err := plans.Create(plan); err != nil {
+		t.Fatalf("Create plan failed: %v", err)
+	}
+
+	if err := model.Delete(conv.ID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+
+	if _, err := model.Get(conv.ID); err != ErrConversationNotFound {
+		t.Errorf("Expected ErrConversationNotFound after delete, got %v", err)
+	}
+
+	for _, table := range []string{"messages", "plans"} {
+		var count int
+		if err := model.DB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE conversation_id = ?", conv.ID).Scan(&count); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("Expected no %s left after delete, got %d", table, count)
+		}
+	}
+
+	if err := model.Delete(conv.ID); err != ErrConversationNotFound {
+		t.Errorf("Expected ErrConversationNotFound when deleting twice, got %v", err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	model := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := model.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if err := model.Rename(conv.ID, "Fix the parser"); err != nil {
+		t.Fatalf("Rename() failed: %v", err)
+	}
+
+	// Saving the transcript again must keep the title
+	if err := model.Save(conv); err != nil {
+		t.Fatalf("Save() after Rename() failed: %v", err)
+	}
+
+	got, err := model.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if got.Title != "Fix the parser" {
+		t.Errorf("Get() title = %q, want %q", got.Title, "Fix the parser")
+	}
+
+	list, err := model.List(ListFilter{})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(list) != 1 || list[0].Title != "Fix the parser" {
+		t.Errorf("List() = %+v, want the renamed conversation", list)
+	}
+
+	if err := model.Rename(conv.ID, ""); err != nil {
+		t.Fatalf("Rename() to clear the title failed: %v", err)
+	}
+	if got, _ := model.Get(conv.ID); got.Title != "" {
+		t.Errorf("Title after clearing = %q, want empty", got.Title)
+	}
+
+	if err := model.Rename("missing", "Title"); err != ErrConversationNotFound {
+		t.Errorf("Expected ErrConversationNotFound when renaming a missing conversation, got %v", err)
+	}
+}
+
+func TestList_ProjectFilter(t *testing.T) {
+	db := createTestDB(t)
+	conversations := ConversationModel{DB: db}
+	plans := PlanModel{DB: db}
+
+	var ids []string
+	for _, project := range []string{"/src/tinker", "/src/other", ""} {
+		conv, err := NewConversation()
+		if err != nil {
+			t.Fatalf("NewConversation() failed: %v", err)
+		}
+		conv.Project = project
+		if err := conversations.Create(conv); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+		ids = append(ids, conv.ID)
+	}
+
+	list, err := conversations.List(ListFilter{Project: "/src/tinker"})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != ids[0] || list[0].Project != "/src/tinker" {
+		t.Errorf("List(/src/tinker) = %+v, want only %s", list, ids[0])
+	}
+
+	if all, _ := conversations.List(ListFilter{}); len(all) != 3 {
+		t.Errorf("Unfiltered List() returned %d conversations, want 3", len(all))
+	}
+
+	conv, err := conversations.Get(ids[1])
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if conv.Project != "/src/other" {
+		t.Errorf("Get().Project = %q, want /src/other", conv.Project)
+	}
+
+	// Plans take the project of their conversation
+	plan, err := NewPlan(ids[0])
+	if err != nil {
+		t.Fatalf("NewPlan() failed: %v", err)
+	}
+	if err := plans.Create(plan); err != nil {
+		t.Fatalf("Create() plan failed: %v", err)
+	}
+	if plan.Project != "/src/tinker" {
+		t.Errorf("Plan project = %q, want /src/tinker", plan.Project)
+	}
+
+	if infos, _ := plans.List(ListFilter{Project: "/src/tinker"}); len(infos) != 1 || infos[0].ID != plan.ID {
+		t.Errorf("Plan List(/src/tinker) = %+v, want %s", infos, plan.ID)
+	}
+	if infos, _ := plans.List(ListFilter{Project: "/src/other"}); len(infos) != 0 {
+		t.Errorf("Plan List(/src/other) = %+v, want none", infos)
+	}
+}
+
+func TestAppendMessages(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	for _, text := range []string{"one", "two", "three"} {
+		conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(text)}})
+	}
+
+	count, err := cm.AppendMessages(conv.ID, 0, conv.Messages[:2])
+	if err != nil || count != 2 {
+		t.Fatalf("AppendMessages(0) = %d, %v, want 2", count, err)
+	}
+
+	// Retried with overlap, only the third message is new
+	count, err = cm.AppendMessages(conv.ID, 1, conv.Messages[1:])
+	if err != nil || count != 3 {
+		t.Fatalf("AppendMessages(1) = %d, %v, want 3", count, err)
+	}
+
+	if _, err := cm.AppendMessages(conv.ID, 5, conv.Messages[:1]); err != ErrMessageGap {
+		t.Errorf("AppendMessages past the end: got %v, want ErrMessageGap", err)
+	}
+	if _, err := cm.AppendMessages("missing", 0, conv.Messages); err != ErrConversationNotFound {
+		t.Errorf("AppendMessages on a missing conversation: got %v, want ErrConversationNotFound", err)
+	}
+
+	stored, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(stored.Messages) != 3 {
+		t.Fatalf("Expected 3 stored messages, got %d", len(stored.Messages))
+	}
+	for i, msg := range stored.Messages {
+		text := msg.Content[0].(message.TextBlock).Text
+		if want := conv.Messages[i].Content[0].(message.TextBlock).Text; text != want || msg.Sequence != i {
+			t.Errorf("Message %d = %q with sequence %d, want %q", i, text, msg.Sequence, want)
+		}
+	}
+}
+
+func TestConversation_Redact(t *testing.T) {
+	cm := createTestModel(t)
+	indexErr := EnableSearchIndex(cm.DB)
+	t.Logf("search index: %v", indexErr)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewTextBlock("Here is my password hunter2"),
+		message.NewImageBlock("image/png", []byte("screenshot of the password"), "shot.png"),
+	}})
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{
+		message.NewToolUseBlock("t1", "bash", []byte(`{"command":"login hunter2"}`)),
+	}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if err := cm.Redact(conv.ID, 0, 1); err != nil {
+		t.Fatalf("Redact() of the image failed: %v", err)
+	}
+	if n := countAttachments(t, cm, conv.ID); n != 0 {
+		t.Errorf("%d attachments left after redacting the image", n)
+	}
+	if err := cm.Redact(conv.ID, 0, 0); err != nil {
+		t.Fatalf("Redact() of the text failed: %v", err)
+	}
+	if err := cm.Redact(conv.ID, 1, -1); err != nil {
+		t.Fatalf("Redact() of the message failed: %v", err)
+	}
+
+	for _, payload := range storedPayloads(t, cm, conv.ID) {
+		if strings.Contains(payload, "hunter2") {
+			t.Errorf("Payload %q still holds the secret", payload)
+		}
+	}
+	if results, err := cm.Search("hunter2", 10); err != nil || len(results) != 0 {
+		t.Errorf("Search() = %+v, %v, want the redacted text gone", results, err)
+	}
+
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	want := []message.ContentBlock{message.NewTextBlock(message.RedactedText), message.NewTextBlock(message.RedactedText)}
+	if !slices.Equal(got.Messages[0].Content, want) {
+		t.Errorf("First message = %+v, want tombstones", got.Messages[0].Content)
+	}
+	if call := got.Messages[1].Content[0].(message.ToolUseBlock); call.ID != "t1" || string(call.Input) != "{}" {
+		t.Errorf("Tool call = %+v, want its id kept and its input gone", call)
+	}
+
+	// A client redacting its own copy the same way saves without rewriting anything
+	stored := storedPayloads(t, cm, conv.ID)
+	for _, msg := range conv.Messages {
+		for i := range msg.Content {
+			msg.Content[i] = message.Redact(msg.Content[i])
+		}
+	}
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if again := storedPayloads(t, cm, conv.ID); !slices.Equal(again, stored) {
+		t.Error("Saving the redacted history rewrote it")
+	}
+
+	if err := cm.Redact(conv.ID, 2, -1); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Redact() of a missing message = %v, want ErrMessageNotFound", err)
+	}
+	if err := cm.Redact(conv.ID, 0, 2); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Redact() of a missing block = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	msg, err := decodePayload(`{"role":"user","content":[{"type":"text","text":"Hi"}]}`)
+	if err != nil || msg.Role != message.UserRole || len(msg.Content) != 1 {
+		t.Errorf("decodePayload() of an object = %+v, %v, want the message", msg, err)
+	}
+
+	// Written before payloads held a single object
+	msg, err = decodePayload(`[{"role":"assistant","content":[{"type":"text","text":"Hello"}]}]`)
+	if err != nil || msg.Role != message.AssistantRole {
+		t.Errorf("decodePayload() of a legacy array = %+v, %v, want the message", msg, err)
+	}
+
+	for _, payload := range []string{`null`, `[]`, `[{"role":"user"},{"role":"assistant"}]`} {
+		if _, err := decodePayload(payload); !errors.Is(err, ErrMalformedPayload) {
+			t.Errorf("decodePayload(%s) = %v, want ErrMalformedPayload", payload, err)
+		}
+	}
+	if _, err := decodePayload(`{"role":`); err == nil {
+		t.Error("decodePayload() of broken JSON succeeded, want an error")
+	}
+}
+
+func TestGet_MixedContentBlocks(t *testing.T) {
+	cm := createTestModel(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	thought := message.NewThoughtBlock([]byte(`"Check the file first"`))
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewTextBlock("What does this show?"),
+		message.NewImageBlock("image/png", []byte("png"), "shot.png"),
+		message.NewFileBlock("main.go", "package main"),
+	}})
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{
+		thought,
+		message.NewTextBlock("Let me look"),
+		message.NewToolUseBlock("t1", "read_file", []byte(`{"path":"main.go"}`)),
+	}})
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{
+		message.NewToolResultBlock("t1", "read_file", "package main", false),
+		message.NewTextBlock("Sent while it ran"),
+	}})
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// A row written before payloads held a single object
+	legacy := `[{"role":"assistant","content":[{"type":"text","text":"From the old format"}]}]`
+	if _, err := cm.DB.Exec(`INSERT INTO messages (conversation_id, sequence_number, payload, created_at) VALUES (?, 3, ?, ?)`, conv.ID, legacy, time.Now()); err != nil {
+		t.Fatalf("Failed to insert legacy row: %v", err)
+	}
+
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(got.Messages) != 4 {
+		t.Fatalf("Get() returned %d messages, want 4", len(got.Messages))
+	}
+	for i, msg := range conv.Messages {
+		if got.Messages[i].Sequence != i || len(got.Messages[i].Content) != len(msg.Content) {
+			t.Fatalf("Message %d = %+v, want %+v", i, got.Messages[i], msg)
+		}
+		for j, block := range msg.Content {
+			if got.Messages[i].Content[j].Type() != block.Type() {
+				t.Errorf("Block %d of message %d has type %s, want %s", j, i, got.Messages[i].Content[j].Type(), block.Type())
+			}
+		}
+	}
+	if tu := got.Messages[1].Content[2].(message.ToolUseBlock); tu.ID != "t1" || string(tu.Input) != `{"path":"main.go"}` {
+		t.Errorf("Tool use = %+v, want the saved one", tu)
+	}
+	if text := got.Messages[3].Content[0].(message.TextBlock).Text; text != "From the old format" {
+		t.Errorf("Legacy message text = %q", text)
+	}
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SQL flavour of the database behind the models.
+// Queries are written with SQLite's ? placeholders and rebound for the other dialects
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	default:
+		return "sqlite"
+	}
+}
+
+// Driver name registered with database/sql
+func (d Dialect) Driver() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	default:
+		return "sqlite3"
+	}
+}
+
+// Pick the dialect from a database URL, anything that is not a Postgres URL is a SQLite file path
+func DialectFromDSN(dsn string) Dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// Replace ? placeholders with $1, $2, ... for Postgres.
+// Question marks inside quoted strings are left alone
+func (d Dialect) rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Whether err is SQLite's or Postgres' report of a duplicate key
+func isUniqueViolation(err error) bool {
+	if isSQLiteUniqueViolation(err) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Whether err is SQLite's or Postgres' report of a row referring to one that does not exist
+func isForeignKeyViolation(err error) bool {
+	if isSQLiteForeignKeyViolation(err) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package data
+
+// The SQLite driver needs cgo, without it every error comes from Postgres
+
+func isSQLiteUniqueViolation(err error) bool {
+	return false
+}
+
+func isSQLiteForeignKeyViolation(err error) bool {
+	return false
+}
@@ -0,0 +1,30 @@
+package data
+
+import "testing"
+
+func TestDialect_rebind(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{SQLite, "SELECT * FROM plans WHERE id = ?", "SELECT * FROM plans WHERE id = ?"},
+		{Postgres, "SELECT * FROM plans WHERE id = ? AND conversation_id = ?", "SELECT * FROM plans WHERE id = $1 AND conversation_id = $2"},
+		{Postgres, "SELECT '?' FROM messages WHERE payload LIKE ? ESCAPE '\\'", "SELECT '?' FROM messages WHERE payload LIKE $1 ESCAPE '\\'"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dialect.rebind(tt.query); got != tt.want {
+			t.Errorf("%s rebind(%q) = %q, want %q", tt.dialect, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDialectFromDSN(t *testing.T) {
+	if got := DialectFromDSN("postgres://tinker@localhost/tinker"); got != Postgres {
+		t.Errorf("DialectFromDSN(postgres URL) = %s, want postgres", got)
+	}
+	if got := DialectFromDSN("/home/me/.tinker/tinker.db"); got != SQLite {
+		t.Errorf("DialectFromDSN(path) = %s, want sqlite", got)
+	}
+}
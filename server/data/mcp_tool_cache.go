@@ -0,0 +1,75 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/honganh1206/tinker/tinkererr"
+)
+
+var ErrMCPToolCacheNotFound = tinkererr.New(tinkererr.NotFound, "mcp tool cache not found")
+
+// Tool list of an MCP server kept across sessions
+type MCPToolCache struct {
+	Key      string `json:"key"`
+	ServerID string `json:"server_id"`
+	// Raw tools/list result, decoded by the mcp package
+	Tools     json.RawMessage `json:"tools"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type MCPToolCacheModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+func (m *MCPToolCacheModel) Get(key string) (*MCPToolCache, error) {
+	query := `
+	SELECT cache_key, server_id, tools, updated_at
+	FROM mcp_tool_cache
+	WHERE cache_key = ?
+	`
+
+	var cache MCPToolCache
+	var tools string
+
+	err := m.DB.QueryRow(m.Dialect.rebind(query), key).Scan(&cache.Key, &cache.ServerID, &tools, &cache.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMCPToolCacheNotFound
+		}
+		return nil, fmt.Errorf("failed to query mcp tool cache '%s': %w", key, err)
+	}
+
+	cache.Tools = json.RawMessage(tools)
+
+	return &cache, nil
+}
+
+// Insert or replace the tool list stored under the cache key
+func (m *MCPToolCacheModel) Save(cache *MCPToolCache) error {
+	if cache.Key == "" {
+		return fmt.Errorf("mcp tool cache key cannot be empty")
+	}
+
+	if !json.Valid(cache.Tools) {
+		return fmt.Errorf("mcp tool cache for server '%s' is not valid JSON", cache.ServerID)
+	}
+
+	query := `
+	INSERT INTO mcp_tool_cache (cache_key, server_id, tools, updated_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(cache_key) DO UPDATE SET
+		server_id = excluded.server_id,
+		tools = excluded.tools,
+		updated_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := m.DB.Exec(m.Dialect.rebind(query), cache.Key, cache.ServerID, string(cache.Tools)); err != nil {
+		return fmt.Errorf("failed to save mcp tool cache for server '%s': %w", cache.ServerID, err)
+	}
+
+	return nil
+}
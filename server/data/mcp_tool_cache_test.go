@@ -0,0 +1,53 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMCPToolCacheModel_SaveAndGet(t *testing.T) {
+	model := MCPToolCacheModel{DB: createTestDB(t)}
+
+	_, err := model.Get("missing")
+	if !errors.Is(err, ErrMCPToolCacheNotFound) {
+		t.Fatalf("Expected ErrMCPToolCacheNotFound, got %v", err)
+	}
+
+	cache := &MCPToolCache{
+		Key:      "abc123",
+		ServerID: "fetch",
+		Tools:    json.RawMessage(`[{"name":"get_page"}]`),
+	}
+	if err := model.Save(cache); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Saving again replaces the tool list
+	cache.Tools = json.RawMessage(`[{"name":"get_page"},{"name":"get_links"}]`)
+	if err := model.Save(cache); err != nil {
+		t.Fatalf("Second save failed: %v", err)
+	}
+
+	got, err := model.Get("abc123")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.ServerID != "fetch" {
+		t.Errorf("ServerID = %q, want %q", got.ServerID, "fetch")
+	}
+	if string(got.Tools) != string(cache.Tools) {
+		t.Errorf("Tools = %s, want %s", got.Tools, cache.Tools)
+	}
+}
+
+func TestMCPToolCacheModel_SaveInvalid(t *testing.T) {
+	model := MCPToolCacheModel{DB: createTestDB(t)}
+
+	if err := model.Save(&MCPToolCache{ServerID: "fetch", Tools: json.RawMessage(`[]`)}); err == nil {
+		t.Error("Expected an error for an empty key")
+	}
+	if err := model.Save(&MCPToolCache{Key: "abc", ServerID: "fetch", Tools: json.RawMessage(`{`)}); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versioned schema changes, one directory per dialect.
+// Files are named <version>_<name>.sql, e.g., 0002_conversation_titles.sql,
+// and are never edited once released: change the schema with a new file instead
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+const migrationsTableSchema = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	SQL     string `json:"-"`
+}
+
+type MigrationStatus struct {
+	Migration
+	// Nil while the migration is pending
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrations shipped for the dialect, oldest first
+func (d Dialect) Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFS, path.Join("migrations", d.String()))
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		rawVersion, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<name>.sql", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Apply the pending migrations in order, each one in its own transaction.
+// Returns the migrations that were applied by this call
+func Migrate(db *sql.DB, d Dialect) ([]Migration, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		if err := applyMigration(db, d, m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+func applyMigration(db *sql.DB, d Dialect, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+	}
+
+	query := `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`
+	if _, err := tx.Exec(d.rebind(query), m.Version, m.Name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+
+	return tx.Commit()
+}
+
+// Every shipped migration along with when it was applied
+func MigrationStatuses(db *sql.DB, d Dialect) ([]MigrationStatus, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if _, err := db.Exec(migrationsTableSchema); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Highest applied migration, 0 for a database that was never migrated
+func SchemaVersion(db *sql.DB) (int, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,186 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_titles.sql":  {Data: []byte("ALTER TABLE conversations ADD COLUMN name TEXT;")},
+		"m/0001_initial.sql": {Data: []byte("CREATE TABLE t (id INTEGER);")},
+		"m/README.md":        {Data: []byte("not a migration")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[1].Version != 2 || migrations[1].Name != "titles" {
+		t.Errorf("migrations = %+v, want initial then titles", migrations)
+	}
+
+	for name, bad := range map[string]fstest.MapFS{
+		"no version": {"m/initial.sql": {}},
+		"duplicate":  {"m/0001_a.sql": {}, "m/1_b.sql": {}},
+	} {
+		if _, err := loadMigrations(bad, "m"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// createTestDB already migrated the database
+	db := createTestDB(t)
+
+	applied, err := Migrate(db, SQLite)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate applied %d migrations, want 0", len(applied))
+	}
+
+	statuses, err := MigrationStatuses(db, SQLite)
+	if err != nil {
+		t.Fatalf("MigrationStatuses failed: %v", err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d (%s) is pending, want applied", s.Version, s.Name)
+		}
+	}
+}
+
+func TestShippedMigrations(t *testing.T) {
+	for _, d := range []Dialect{SQLite, Postgres} {
+		migrations, err := d.Migrations()
+		if err != nil {
+			t.Fatalf("%s migrations: %v", d, err)
+		}
+		if len(migrations) == 0 || migrations[0].Version != 1 {
+			t.Errorf("%s migrations should start at version 1, got %+v", d, migrations)
+		}
+	}
+}
+
+func TestMigrate_SingleMessagePayloads(t *testing.T) {
+	db := createTestDB(t)
+	cm := ConversationModel{DB: db}
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	payloads := []string{
+		`[{"role":"user","content":[{"type":"text","text":"legacy"}]}]`,
+		`{"role":"assistant","content":[{"type":"text","text":"current"}]}`,
+		// Left for decodePayload to report
+		`[{"role":"user"},{"role":"assistant"}]`,
+		encryptedPrefix + "c2VhbGVk",
+	}
+	for i, payload := range payloads {
+		if _, err := db.Exec(`INSERT INTO messages (conversation_id, sequence_number, payload) VALUES (?, ?, ?)`, conv.ID, i, payload); err != nil {
+			t.Fatalf("Failed to insert payload: %v", err)
+		}
+	}
+
+	migrations, err := SQLite.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() failed: %v", err)
+	}
+	i := slices.IndexFunc(migrations, func(m Migration) bool { return m.Name == "single_message_payloads" })
+	if i < 0 {
+		t.Fatal("single_message_payloads migration not shipped")
+	}
+	if _, err := db.Exec(migrations[i].SQL); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+
+	want := slices.Clone(payloads)
+	want[0] = `{"role":"user","content":[{"type":"text","text":"legacy"}]}`
+	if got := storedPayloads(t, &cm, conv.ID); !slices.Equal(got, want) {
+		t.Errorf("Payloads after the migration = %q, want %q", got, want)
+	}
+}
+
+func TestMigrate_OrphanPlans(t *testing.T) {
+	db := createTestDB(t)
+	cm := ConversationModel{DB: db}
+	pm := PlanModel{DB: db}
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	kept, err := NewPlan(conv.ID)
+	if err != nil {
+		t.Fatalf("NewPlan() failed: %v", err)
+	}
+	if err := pm.Create(kept); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	// Left behind by deletes from before foreign keys were enforced
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Conn() failed: %v", err)
+	}
+	defer conn.Close()
+	for _, query := range []string{
+		`PRAGMA foreign_keys = OFF`,
+		`INSERT INTO plans (id, conversation_id) VALUES ('orphan', 'deleted')`,
+		`INSERT INTO steps (id, plan_id, status, step_order) VALUES ('step', 'orphan', 'TODO', 0)`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			t.Fatalf("Failed to insert orphan plan: %v", err)
+		}
+	}
+
+	migrations, err := SQLite.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() failed: %v", err)
+	}
+	i := slices.IndexFunc(migrations, func(m Migration) bool { return m.Name == "orphan_plans" })
+	if i < 0 {
+		t.Fatal("orphan_plans migration not shipped")
+	}
+	if _, err := conn.ExecContext(ctx, migrations[i].SQL); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+
+	var plans, steps int
+	if err := conn.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM plans), (SELECT COUNT(*) FROM steps)`).Scan(&plans, &steps); err != nil {
+		t.Fatalf("Failed to count plans: %v", err)
+	}
+	if plans != 1 || steps != 0 {
+		t.Errorf("Plans, steps after the migration = %d, %d, want the plan of the conversation alone", plans, steps)
+	}
+
+	// And the foreign key now takes plans along with their conversation
+	if err := cm.Delete(conv.ID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := pm.Get(conv.ID); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("Get() after deleting the conversation = %v, want ErrPlanNotFound", err)
+	}
+	if err := pm.Create(kept); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Create() in a deleted conversation = %v, want ErrConversationNotFound", err)
+	}
+}
@@ -0,0 +1,102 @@
+-- Baseline: the tables that existed before migrations were versioned
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    title TEXT,
+    transcript TEXT
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id TEXT NOT NULL,
+    sequence_number INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    UNIQUE (conversation_id, sequence_number)
+);
+
+CREATE TABLE IF NOT EXISTS plans (
+		id TEXT PRIMARY KEY NOT NULL,  -- UUID generated by Go
+		conversation_id TEXT NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+		UNIQUE (conversation_id)
+);
+
+CREATE TABLE IF NOT EXISTS steps (
+		id TEXT NOT NULL, -- e.g., "add-tests"
+		plan_id TEXT NOT NULL,
+		description TEXT,
+		status TEXT NOT NULL CHECK (status IN ('TODO', 'DONE')),
+		step_order INTEGER NOT NULL,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (plan_id, id),
+		FOREIGN KEY (plan_id) REFERENCES plans(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_plans_conversation_id ON plans(conversation_id);
+
+CREATE INDEX IF NOT EXISTS idx_steps_plan_id ON steps(plan_id);
+CREATE INDEX IF NOT EXISTS idx_steps_plan_id_step_order ON steps(plan_id, step_order);
+
+CREATE OR REPLACE FUNCTION touch_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+		NEW.updated_at = CURRENT_TIMESTAMP;
+		RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION touch_plan_of_step() RETURNS TRIGGER AS $$
+BEGIN
+		UPDATE plans SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.plan_id;
+		RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- CREATE OR REPLACE TRIGGER needs Postgres 14, dropping first works on older servers too
+DROP TRIGGER IF EXISTS plans_updated_at ON plans;
+CREATE TRIGGER plans_updated_at
+BEFORE UPDATE ON plans
+FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+DROP TRIGGER IF EXISTS steps_updated_at ON steps;
+CREATE TRIGGER steps_updated_at
+BEFORE UPDATE ON steps
+FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+DROP TRIGGER IF EXISTS steps_touch_plan ON steps;
+CREATE TRIGGER steps_touch_plan
+AFTER UPDATE ON steps
+FOR EACH ROW EXECUTE FUNCTION touch_plan_of_step();
+
+-- Join table between steps and plans
+CREATE TABLE IF NOT EXISTS step_acceptance_criteria (
+		plan_id TEXT NOT NULL,
+		step_id TEXT NOT NULL,
+		criterion TEXT NOT NULL,
+		criterion_order INTEGER NOT NULL, -- Order of criteria for a step
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(plan_id, step_id, criterion_order),
+		FOREIGN KEY(plan_id, step_id) REFERENCES steps(plan_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_step_acceptance_criteria_plan_step ON step_acceptance_criteria(plan_id, step_id);
+
+-- Tool lists of MCP servers, so new sessions can expose tools before the handshake completes
+CREATE TABLE IF NOT EXISTS mcp_tool_cache (
+		cache_key TEXT PRIMARY KEY NOT NULL, -- Hash of the server command
+		server_id TEXT NOT NULL,
+		tools TEXT NOT NULL, -- JSON array as returned by tools/list
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Bearer tokens accepted by the HTTP server, only their hashes are stored
+CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE, -- Hex SHA-256 of the token
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Bumped on every write, clients send it back to detect concurrent edits
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+-- Provider and model of the latest reply, NULL until a reply records its model.
+-- Untitled conversations take the first line of their first prompt, as new ones do on save
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS provider TEXT;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS model TEXT;
+
+UPDATE conversations c
+SET title = (
+    SELECT NULLIF(left(btrim(split_part(btrim(m.payload::json #>> '{content,0,text}', E' \t\n\r'), E'\n', 1)), 80), '')
+    FROM messages m
+    WHERE m.conversation_id = c.id
+        AND m.payload::json ->> 'role' = 'user'
+        AND m.payload::json #>> '{content,0,type}' = 'text'
+    ORDER BY m.sequence_number
+    LIMIT 1
+)
+WHERE c.title IS NULL;
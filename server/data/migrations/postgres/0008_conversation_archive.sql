@@ -0,0 +1,4 @@
+-- When the messages of a conversation were moved out to its archive file, NULL while they
+-- are in the database, and the time of its latest message, which retention needs once they are gone
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_message_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- Each payload holds one message as a JSON object. Rows written before that was settled
+-- hold an array of the message alone, unwrapped here. Encrypted ones are read either way
+UPDATE messages
+SET payload = (payload::json -> 0)::text
+WHERE CASE
+    WHEN payload LIKE '[%' THEN json_array_length(payload::json) = 1
+    ELSE FALSE
+END;
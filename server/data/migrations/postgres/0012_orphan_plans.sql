@@ -0,0 +1,17 @@
+-- Plans go with their conversation, now that the foreign key cascades on SQLite too.
+-- Those of conversations deleted before are dropped along with what hangs off them
+DELETE FROM tags
+WHERE resource_type = 'plan'
+    AND resource_id IN (SELECT id FROM plans WHERE conversation_id NOT IN (SELECT id FROM conversations));
+
+DELETE FROM plan_revisions
+WHERE plan_id IN (SELECT id FROM plans WHERE conversation_id NOT IN (SELECT id FROM conversations));
+
+DELETE FROM step_acceptance_criteria
+WHERE plan_id IN (SELECT id FROM plans WHERE conversation_id NOT IN (SELECT id FROM conversations));
+
+DELETE FROM steps
+WHERE plan_id IN (SELECT id FROM plans WHERE conversation_id NOT IN (SELECT id FROM conversations));
+
+DELETE FROM plans
+WHERE conversation_id NOT IN (SELECT id FROM conversations);
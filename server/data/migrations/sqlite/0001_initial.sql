@@ -1,8 +1,22 @@
+-- Baseline: the tables that existed before migrations were versioned.
+-- Everything uses IF NOT EXISTS so databases created by older versions adopt it as is
 
--- Foreign key constraint to ensure referential integrity
--- that is a value in one's table column must exist in another table's primary key column.
--- E.g., user_id of orders table must exist in users table primary key.
-PRAGMA foreign_keys=ON;
+CREATE TABLE IF NOT EXISTS conversations (
+    id TEXT PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    title TEXT,
+    transcript TEXT
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id TEXT NOT NULL,
+    sequence_number INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    UNIQUE (conversation_id, sequence_number)
+);
 
 CREATE TABLE IF NOT EXISTS plans (
 		id TEXT PRIMARY KEY NOT NULL,  -- UUID generated by Go
@@ -57,3 +71,18 @@ CREATE TABLE IF NOT EXISTS step_acceptance_criteria (
 );
 
 CREATE INDEX IF NOT EXISTS idx_step_acceptance_criteria_plan_step ON step_acceptance_criteria(plan_id, step_id);
+
+-- Tool lists of MCP servers, so new sessions can expose tools before the handshake completes
+CREATE TABLE IF NOT EXISTS mcp_tool_cache (
+		cache_key TEXT PRIMARY KEY NOT NULL, -- Hash of the server command
+		server_id TEXT NOT NULL,
+		tools TEXT NOT NULL, -- JSON array as returned by tools/list
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Bearer tokens accepted by the HTTP server, only their hashes are stored
+CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE, -- Hex SHA-256 of the token
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
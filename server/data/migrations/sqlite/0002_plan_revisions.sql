@@ -0,0 +1,10 @@
+-- Snapshot of a plan after every save, so overwritten steps can be restored
+CREATE TABLE IF NOT EXISTS plan_revisions (
+		plan_id TEXT NOT NULL,
+		revision INTEGER NOT NULL, -- Starts at 1 for every plan
+		author TEXT NOT NULL CHECK (author IN ('agent', 'user')),
+		snapshot TEXT NOT NULL, -- JSON of the plan with its steps
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (plan_id, revision),
+		FOREIGN KEY (plan_id) REFERENCES plans(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Bumped on every write, clients send it back to detect concurrent edits
+ALTER TABLE plans ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
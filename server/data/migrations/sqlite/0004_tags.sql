@@ -0,0 +1,10 @@
+-- Free-form labels such as bug or refactor, shared by conversations and plans
+CREATE TABLE IF NOT EXISTS tags (
+		resource_type TEXT NOT NULL CHECK (resource_type IN ('conversation', 'plan')),
+		resource_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (resource_type, resource_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tags_tag ON tags(resource_type, tag);
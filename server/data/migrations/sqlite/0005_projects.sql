@@ -0,0 +1,7 @@
+-- Git root the conversation was started in, NULL for rows created before projects were tracked.
+-- Plans take the project of their conversation
+ALTER TABLE conversations ADD COLUMN project TEXT;
+ALTER TABLE plans ADD COLUMN project TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_project ON conversations(project);
+CREATE INDEX IF NOT EXISTS idx_plans_project ON plans(project);
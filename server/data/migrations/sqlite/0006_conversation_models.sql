@@ -0,0 +1,19 @@
+-- Provider and model of the latest reply, NULL until a reply records its model.
+-- Untitled conversations take the first line of their first prompt, as new ones do on save
+ALTER TABLE conversations ADD COLUMN provider TEXT;
+ALTER TABLE conversations ADD COLUMN model TEXT;
+
+UPDATE conversations
+SET title = (
+    SELECT NULLIF(substr(trim(substr(t, 1, instr(t || char(10), char(10)) - 1)), 1, 80), '')
+    FROM (
+        SELECT trim(json_extract(m.payload, '$.content[0].text'), ' ' || char(9) || char(10) || char(13)) AS t
+        FROM messages m
+        WHERE m.conversation_id = conversations.id
+            AND json_extract(m.payload, '$.role') = 'user'
+            AND json_extract(m.payload, '$.content[0].type') = 'text'
+        ORDER BY m.sequence_number
+        LIMIT 1
+    )
+)
+WHERE title IS NULL;
@@ -0,0 +1,6 @@
+-- Conversation a fork was made from and how many of its messages the fork started with.
+-- The messages are copied, so a fork outlives its parent
+ALTER TABLE conversations ADD COLUMN parent_id TEXT;
+ALTER TABLE conversations ADD COLUMN fork_sequence INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_parent_id ON conversations(parent_id);
@@ -0,0 +1,11 @@
+-- Images and oversized tool results of messages, kept out of the payloads, which refer to
+-- them by the hex SHA-256 of their content. Per conversation, so deleting one drops its own
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    content BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    UNIQUE (conversation_id, hash)
+);
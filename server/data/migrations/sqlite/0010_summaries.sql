@@ -0,0 +1,13 @@
+-- What compaction made of messages start_sequence up to, not including, end_sequence.
+-- The messages stay, the latest summary stands in for them when the history goes to a model
+CREATE TABLE IF NOT EXISTS summaries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id TEXT NOT NULL,
+    start_sequence INTEGER NOT NULL,
+    end_sequence INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_summaries_conversation_id ON summaries(conversation_id);
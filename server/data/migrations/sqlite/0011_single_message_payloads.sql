@@ -0,0 +1,8 @@
+-- Each payload holds one message as a JSON object. Rows written before that was settled
+-- hold an array of the message alone, unwrapped here. Encrypted ones are read either way
+UPDATE messages
+SET payload = json_extract(payload, '$[0]')
+WHERE CASE
+    WHEN payload LIKE '[%' AND json_valid(payload) THEN json_array_length(payload) = 1
+    ELSE 0
+END;
@@ -0,0 +1,7 @@
+-- Notes, origin (agent or user) and completion time of plan steps.
+-- Steps done before are taken as completed when last updated
+ALTER TABLE steps ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE steps ADD COLUMN origin TEXT NOT NULL DEFAULT '';
+ALTER TABLE steps ADD COLUMN completed_at TIMESTAMP;
+
+UPDATE steps SET completed_at = updated_at WHERE status = 'DONE';
@@ -5,13 +5,26 @@ import (
 )
 
 type Models struct {
-	Conversations *ConversationModel
-	Plans         *PlanModel
+	Conversations ConversationStore
+	Plans         PlanStore
+	MCPToolCache  MCPToolCacheStore
+	Tags          TagStore
+	APITokens     APITokenStore
 }
 
-func NewModels(db *sql.DB) *Models {
+func NewModels(db *sql.DB, dialect Dialect) *Models {
 	return &Models{
-		Conversations: &ConversationModel{DB: db},
-		Plans:         &PlanModel{DB: db},
+		Conversations: &ConversationModel{DB: db, Dialect: dialect},
+		Plans:         &PlanModel{DB: db, Dialect: dialect},
+		MCPToolCache:  &MCPToolCacheModel{DB: db, Dialect: dialect},
+		Tags:          &TagModel{DB: db, Dialect: dialect},
+		APITokens:     &APITokenModel{DB: db, Dialect: dialect},
 	}
 }
+
+// Models whose conversations encrypt the payloads of their messages with c
+func NewEncryptedModels(db *sql.DB, dialect Dialect, c *PayloadCipher) *Models {
+	models := NewModels(db, dialect)
+	models.Conversations = &ConversationModel{DB: db, Dialect: dialect, Cipher: c}
+	return models
+}
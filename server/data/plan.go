@@ -2,38 +2,46 @@ package data
 
 import (
 	"database/sql"
-	_ "embed"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/honganh1206/tinker/tinkererr"
 )
 
-//go:embed plan_schema.sql
-var PlanSchema string
-
-var ErrPlanNotFound = errors.New("plan not found")
+var (
+	ErrPlanNotFound        = tinkererr.New(tinkererr.NotFound, "plan not found")
+	ErrStepNotFound        = tinkererr.New(tinkererr.NotFound, "step not found")
+	ErrPlanVersionConflict = errors.New("plan was modified by another writer")
+)
 
 type Plan struct {
 	ID             string  `json:"id"`
 	ConversationID string  `json:"conversation_id"`
 	Steps          []*Step `json:"steps"`
-	isNew          bool
+	// Copied from the conversation when the plan is created
+	Project string `json:"project,omitempty"`
+	// Incremented by every save, used for optimistic concurrency
+	Version int `json:"version"`
+	isNew   bool
 }
 
 type PlanModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
 }
 
 // Hold summary of a plan. Used by List() method
 type PlanInfo struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	ConversationID string `json:"conversation_id"`
-	Status         string `json:"status"` // "DONE" or "TODO"
-	TotalTasks     int    `json:"total_tasks"`
-	CompletedTasks int    `json:"completed_tasks"`
+	ID             string   `json:"id"`
+	ConversationID string   `json:"conversation_id"`
+	Project        string   `json:"project,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Status         string   `json:"status"` // "DONE" or "TODO"
+	TotalTasks     int      `json:"total_tasks"`
+	CompletedTasks int      `json:"completed_tasks"`
 }
 
 type Step struct {
@@ -41,6 +49,13 @@ type Step struct {
 	Description string   `json:"description"`
 	Status      string   `json:"status"` // "DONE" or "TODO"
 	Acceptance  []string `json:"acceptance"`
+	// Free-form remarks on the step, e.g., why it was skipped
+	Notes string `json:"notes,omitempty"`
+	// Author of the step, AuthorAgent or AuthorUser. Empty for steps added before it was recorded
+	Origin    string    `json:"origin,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Set when the step is marked done, cleared when it is reopened
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
 	stepOrder   int
 }
 
@@ -71,15 +86,20 @@ func (pm *PlanModel) Close() error {
 
 func (pm *PlanModel) Create(plan *Plan) error {
 	query := `
-	INSERT INTO plans (id, conversation_id) VALUES (?, ?)
-	RETURNING id
+	INSERT INTO plans (id, conversation_id, project)
+	VALUES (?, ?, (SELECT project FROM conversations WHERE id = ?))
+	RETURNING id, COALESCE(project, '')
 	`
 
-	err := pm.DB.QueryRow(query, plan.ID, plan.ConversationID).Scan(&plan.ID)
+	err := pm.DB.QueryRow(pm.Dialect.rebind(query), plan.ID, plan.ConversationID, plan.ConversationID).Scan(&plan.ID, &plan.Project)
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if isUniqueViolation(err) {
 			return fmt.Errorf("plan already exists in conversation '%s'", plan.ConversationID)
 		}
+		// Plans belong to a stored conversation
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("%w: cannot create a plan in '%s'", ErrConversationNotFound, plan.ConversationID)
+		}
 		return fmt.Errorf("failed to insert new plan with conversation ID '%s' into database: %w", plan.ConversationID, err)
 	}
 
@@ -87,72 +107,94 @@ func (pm *PlanModel) Create(plan *Plan) error {
 	if plan.Steps == nil {
 		plan.Steps = []*Step{}
 	}
+	plan.Version = 1
 	plan.isNew = false
 
 	return nil
 }
 
 func (pm *PlanModel) Get(conversationID string) (*Plan, error) {
-	var planID string
+	plan := &Plan{
+		ConversationID: conversationID,
+		Steps:          []*Step{},
+		isNew:          false,
+	}
 
-	err := pm.DB.QueryRow("SELECT id FROM plans WHERE conversation_id = ?", conversationID).Scan(&planID)
+	err := pm.DB.QueryRow(pm.Dialect.rebind("SELECT id, version, COALESCE(project, '') FROM plans WHERE conversation_id = ?"), conversationID).Scan(&plan.ID, &plan.Version, &plan.Project)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("plan with ID '%s' not found", conversationID)
+			return nil, fmt.Errorf("%w: no plan in conversation '%s'", ErrPlanNotFound, conversationID)
 		}
 		return nil, fmt.Errorf("failed to query plan '%s': %w", conversationID, err)
 	}
 
-	plan := &Plan{
-		ID:             planID,
-		ConversationID: conversationID,
-		Steps:          []*Step{},
-		isNew:          false,
+	if err := pm.loadSteps(pm.DB, plan); err != nil {
+		return nil, err
 	}
 
-	rows, err := pm.DB.Query("SELECT id, description, status, step_order FROM steps WHERE plan_id = ? ORDER BY step_order ASC", planID)
+	return plan, nil
+}
+
+// Either the database or a transaction
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Fill in the steps of plan along with their acceptance criteria
+func (pm *PlanModel) loadSteps(q querier, plan *Plan) error {
+	planID, conversationID := plan.ID, plan.ConversationID
+
+	query := `
+		SELECT id, description, status, step_order, notes, origin, created_at, completed_at
+		FROM steps WHERE plan_id = ? ORDER BY step_order ASC`
+	rows, err := q.Query(pm.Dialect.rebind(query), planID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query steps for plan '%s': %w", conversationID, err)
+		return fmt.Errorf("failed to query steps for plan '%s': %w", conversationID, err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		step := &Step{}
-		err := rows.Scan(&step.ID, &step.Description, &step.Status, &step.stepOrder)
+		var completedAt sql.NullTime
+		err := rows.Scan(&step.ID, &step.Description, &step.Status, &step.stepOrder, &step.Notes, &step.Origin, &step.CreatedAt, &completedAt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan step for plan '%s': %w", conversationID, err)
+			return fmt.Errorf("failed to scan step for plan '%s': %w", conversationID, err)
+		}
+		if completedAt.Valid {
+			step.CompletedAt = &completedAt.Time
 		}
 		step.Acceptance = []string{}
 		plan.Steps = append(plan.Steps, step)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating steps for plan '%s': %w", conversationID, err)
+		return fmt.Errorf("error iterating steps for plan '%s': %w", conversationID, err)
 	}
+	rows.Close()
 
 	// Fetch acceptance criteria for each step
 	for _, step := range plan.Steps {
-		acRows, err := pm.DB.Query("SELECT criterion FROM step_acceptance_criteria WHERE step_id = ? AND plan_id = ? ORDER BY criterion_order ASC", step.ID, planID)
+		acRows, err := q.Query(pm.Dialect.rebind("SELECT criterion FROM step_acceptance_criteria WHERE step_id = ? AND plan_id = ? ORDER BY criterion_order ASC"), step.ID, planID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to query acceptance criteria for step '%s' in plan '%s': %w", step.ID, conversationID, err)
+			return fmt.Errorf("failed to query acceptance criteria for step '%s' in plan '%s': %w", step.ID, conversationID, err)
 		}
 		for acRows.Next() {
 			var acDescription string
 			err := acRows.Scan(&acDescription)
 			if err != nil {
 				acRows.Close()
-				return nil, fmt.Errorf("failed to scan acceptance criterion for step '%s' in plan '%s': %w", step.ID, conversationID, err)
+				return fmt.Errorf("failed to scan acceptance criterion for step '%s' in plan '%s': %w", step.ID, conversationID, err)
 			}
 			step.Acceptance = append(step.Acceptance, acDescription)
 		}
 		if err = acRows.Err(); err != nil {
 			acRows.Close()
-			return nil, fmt.Errorf("error iterating acceptance criteria for step '%s' in plan '%s': %w", step.ID, conversationID, err)
+			return fmt.Errorf("error iterating acceptance criteria for step '%s' in plan '%s': %w", step.ID, conversationID, err)
 		}
 		acRows.Close()
 	}
 
-	return plan, nil
+	return nil
 }
 
 func (p *Plan) Inspect() string {
@@ -168,6 +210,13 @@ func (p *Plan) Inspect() string {
 		}
 		builder.WriteString("\n") // Ensure a blank line after header or description
 
+		if meta := step.Metadata(); meta != "" {
+			builder.WriteString(meta + "\n\n")
+		}
+		if step.Notes != "" {
+			builder.WriteString("Notes: " + step.Notes + "\n\n")
+		}
+
 		// Acceptance criteria numbered list
 		if len(step.Acceptance) > 0 {
 			builder.WriteString("Acceptance Criteria:\n")
@@ -181,6 +230,23 @@ func (p *Plan) Inspect() string {
 	return builder.String()
 }
 
+// Who added the step and when, and when it was completed, on one line
+func (s *Step) Metadata() string {
+	var parts []string
+	if s.Origin != "" {
+		parts = append(parts, "Added by "+s.Origin)
+	} else if !s.CreatedAt.IsZero() {
+		parts = append(parts, "Added")
+	}
+	if !s.CreatedAt.IsZero() {
+		parts[len(parts)-1] += " on " + s.CreatedAt.Local().Format(time.DateTime)
+	}
+	if s.CompletedAt != nil {
+		parts = append(parts, "completed on "+s.CompletedAt.Local().Format(time.DateTime))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func (p *Plan) NextStep() *Step {
 	for _, step := range p.Steps {
 		// Case-insensitive comparison just in case
@@ -240,11 +306,15 @@ func (s *Step) GetAcceptanceCriteria() []string {
 func (p *Plan) MarkStepAsCompleted(stepID string) error {
 	for _, step := range p.Steps {
 		if step.ID == stepID {
+			if step.CompletedAt == nil {
+				now := time.Now()
+				step.CompletedAt = &now
+			}
 			step.Status = "DONE"
 			return nil
 		}
 	}
-	return fmt.Errorf("step with ID '%s' not found in plan '%s'", stepID, p.ID)
+	return tinkererr.Errorf(tinkererr.NotFound, "step with ID '%s' not found in plan '%s'", stepID, p.ID)
 }
 
 // Sets the status of the step with the given stepID to "TODO" in-memory.
@@ -252,10 +322,11 @@ func (p *Plan) MarkStepAsIncomplete(stepID string) error {
 	for _, step := range p.Steps {
 		if step.ID == stepID {
 			step.Status = "TODO"
+			step.CompletedAt = nil
 			return nil
 		}
 	}
-	return fmt.Errorf("step with ID '%s' not found in plan '%s'", stepID, p.ID)
+	return tinkererr.Errorf(tinkererr.NotFound, "step with ID '%s' not found in plan '%s'", stepID, p.ID)
 }
 
 // Appends a new step to the plan.
@@ -325,17 +396,21 @@ func (p *Plan) IsStepCompleted() bool {
 	return p.NextStep() == nil
 }
 
-// Retrieve summary information for all plans from the database
-func (pm *PlanModel) List() ([]PlanInfo, error) {
-	rows, err := pm.DB.Query(
+// Retrieve summary information for the plans matching filter
+func (pm *PlanModel) List(filter ListFilter) ([]PlanInfo, error) {
+	where, args := filter.where("p.id", "p.project", TagPlan)
+
+	rows, err := pm.DB.Query(pm.Dialect.rebind(
 		`SELECT
 				p.id,
 				p.conversation_id,
+				COALESCE(p.project, ''),
 				COUNT(s.id),
 				SUM(CASE WHEN s.status = 'DONE' THEN 1 ELSE 0 END)
 		FROM plans p
 		LEFT JOIN steps s ON p.id = s.plan_id
-		GROUP BY p.id, p.conversation_id`)
+		`+where+`
+		GROUP BY p.id, p.conversation_id, p.project`), args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query plan summaries: %w", err)
 	}
@@ -348,7 +423,7 @@ func (pm *PlanModel) List() ([]PlanInfo, error) {
 		var totalTasks sql.NullInt64 // For COUNT which can be 0 -> NULL
 		var completedTasks sql.NullInt64
 
-		if err := rows.Scan(&info.ID, &info.Name, &info.ConversationID, &totalTasks, &completedTasks); err != nil {
+		if err := rows.Scan(&info.ID, &info.ConversationID, &info.Project, &totalTasks, &completedTasks); err != nil {
 			return nil, fmt.Errorf("failed to scan plan summary: %w", err)
 		}
 
@@ -367,42 +442,56 @@ func (pm *PlanModel) List() ([]PlanInfo, error) {
 		return nil, fmt.Errorf("error iterating plan summaries: %w", err)
 	}
 
+	tagsByID, err := loadTags(pm.DB, pm.Dialect, TagPlan)
+	if err != nil {
+		return nil, err
+	}
+	for i := range plansInfo {
+		plansInfo[i].Tags = tagsByID[plansInfo[i].ID]
+	}
+
 	return plansInfo, nil
 }
 
-func (pm *PlanModel) Save(plan *Plan) error {
+// Save the plan and record the result as a new revision by author
+func (pm *PlanModel) Save(plan *Plan, author string) error {
+	if !validAuthor(author) {
+		return fmt.Errorf("invalid plan author '%s': must be %s or %s", author, AuthorAgent, AuthorUser)
+	}
+
 	tx, err := pm.DB.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	var version int
 	if plan.isNew {
-		_, err := tx.Exec("INSERT INTO plans (id, conversation_id) VALUES (?, ?)", plan.ID, plan.ConversationID)
+		_, err := tx.Exec(pm.Dialect.rebind("INSERT INTO plans (id, conversation_id, project) VALUES (?, ?, (SELECT project FROM conversations WHERE id = ?))"), plan.ID, plan.ConversationID, plan.ConversationID)
 		if err != nil {
 			// Check if the error is due to a unique constraint violation (plan already exists)
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			if isUniqueViolation(err) {
 				return fmt.Errorf("plan with conversation ID '%s' already exists in database, cannot save as new", plan.ConversationID)
 			}
 			return fmt.Errorf("failed to insert new plan with conversation ID '%s' into database: %w", plan.ConversationID, err)
 		}
+		version = 1
 	} else {
-		// Even if it isn't a new plan, we still verify it to get a cleaner error
-		// than what might come from step synchronization?
-		var checkID string
-		err := tx.QueryRow("SELECT id FROM plans WHERE id = ?", plan.ID).Scan(&checkID)
+		// Bumping the version doubles as the existence check
+		err := tx.QueryRow(pm.Dialect.rebind("UPDATE plans SET version = version + 1 WHERE id = ? RETURNING version"), plan.ID).Scan(&version)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				return fmt.Errorf("plan with name '%s' not found in database, cannot update", plan.ID)
+				return tinkererr.Errorf(tinkererr.NotFound, "plan with name '%s' not found in database, cannot update", plan.ID)
 			}
 			return fmt.Errorf("failed to verify existence of plan '%s': %w", plan.ID, err)
 		}
 	}
+	plan.Version = version
 
 	/* Synchronize steps from the DB (if exist) with input steps*/
 
 	// Get existing step IDs for the current plan
-	rows, err := tx.Query("SELECT id FROM steps WHERE plan_id = ?", plan.ID)
+	rows, err := tx.Query(pm.Dialect.rebind("SELECT id FROM steps WHERE plan_id = ?"), plan.ID)
 	if err != nil {
 		return fmt.Errorf("failed to query existing steps for plan '%s': %w", plan.ID, err)
 	}
@@ -430,7 +519,7 @@ func (pm *PlanModel) Save(plan *Plan) error {
 	for dbStepID := range dbStepIDs {
 		if !planStepIDs[dbStepID] {
 			// Deprecated steps from DB, remove step (acceptance criteria will be removed by CASCADE)
-			_, err := tx.Exec("DELETE FROM steps WHERE plan_id = ? AND id = ?", plan.ID, dbStepID)
+			_, err := tx.Exec(pm.Dialect.rebind("DELETE FROM steps WHERE plan_id = ? AND id = ?"), plan.ID, dbStepID)
 			if err != nil {
 				return fmt.Errorf("failed to delete old step '%s' in plan '%s': %w", dbStepID, plan.ID, err)
 			}
@@ -451,33 +540,49 @@ func (pm *PlanModel) Save(plan *Plan) error {
 		if s.Status != "TODO" && s.Status != "DONE" {
 			return fmt.Errorf("step '%s' has invalid status '%s': must be TODO or DONE", s.ID, s.Status)
 		}
+		if s.Origin != "" && !validAuthor(s.Origin) {
+			return fmt.Errorf("step '%s' has invalid origin '%s': must be %s or %s", s.ID, s.Origin, AuthorAgent, AuthorUser)
+		}
+		s.touch(author, !dbStepIDs[s.ID])
 
-		// Update or create step
+		// Update or create step. Origin and creation time are kept from the stored step,
+		// so is the completion time of a step still done
 		if dbStepIDs[s.ID] {
-			_, err := tx.Exec("UPDATE steps SET description = ?, status = ?, step_order = ? WHERE plan_id = ? AND id = ?", s.Description, s.Status, s.stepOrder, plan.ID, s.ID)
+			query := `
+			UPDATE steps SET description = ?, status = ?, step_order = ?, notes = ?,
+				completed_at = CASE WHEN ? = 'DONE' THEN COALESCE(completed_at, ?) ELSE NULL END
+			WHERE plan_id = ? AND id = ?`
+			_, err := tx.Exec(pm.Dialect.rebind(query), s.Description, s.Status, s.stepOrder, s.Notes, s.Status, s.CompletedAt, plan.ID, s.ID)
 			if err != nil {
 				return fmt.Errorf("failed to update step '%s' in plan '%s': %w", s.ID, plan.ID, err)
 			}
 		} else {
-			_, err := tx.Exec("INSERT INTO steps(id, plan_id, description, status, step_order) VALUES(?, ?, ?, ?, ?)", s.ID, plan.ID, s.Description, s.Status, s.stepOrder)
+			query := `
+			INSERT INTO steps(id, plan_id, description, status, step_order, notes, origin, created_at, completed_at)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			_, err := tx.Exec(pm.Dialect.rebind(query), s.ID, plan.ID, s.Description, s.Status, s.stepOrder, s.Notes, s.Origin, s.CreatedAt, s.CompletedAt)
 			if err != nil {
 				return fmt.Errorf("failed to insert step '%s' into plan '%s': %w", s.ID, plan.ID, err)
 			}
 		}
 		// Delete ACs here just to make sure clean ACs when we update a plan?
-		_, err = tx.Exec("DELETE FROM step_acceptance_criteria WHERE plan_id = ? AND step_id = ?", plan.ID, s.ID)
+		_, err = tx.Exec(pm.Dialect.rebind("DELETE FROM step_acceptance_criteria WHERE plan_id = ? AND step_id = ?"), plan.ID, s.ID)
 		if err != nil {
 			return fmt.Errorf("failed to delete old acceptance criteria for step '%s' in plan '%s': %w", s.ID, plan.ID, err)
 		}
 
 		for j, acText := range s.Acceptance {
-			_, err = tx.Exec("INSERT INTO step_acceptance_criteria (plan_id, step_id, criterion_order, criterion) VALUES (?, ?, ?, ?)", plan.ID, s.ID, j, acText)
+			_, err = tx.Exec(pm.Dialect.rebind("INSERT INTO step_acceptance_criteria (plan_id, step_id, criterion_order, criterion) VALUES (?, ?, ?, ?)"), plan.ID, s.ID, j, acText)
 			if err != nil {
 				return fmt.Errorf("failed to insert acceptance criterion for step '%s' in plan '%s': %w", s.ID, plan.ID, err)
 			}
 		}
 	}
 
+	if err := pm.recordRevision(tx, plan, author); err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return fmt.Errorf("failed to commit transaction for plan '%s': %w", plan.ID, err)
@@ -491,14 +596,129 @@ func (pm *PlanModel) Save(plan *Plan) error {
 	return nil
 }
 
+// Fields of a step to change, nil ones are left as they are
+type StepPatch struct {
+	Status      *string  `json:"status,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Notes       *string  `json:"notes,omitempty"`
+	Acceptance  []string `json:"acceptance"`
+}
+
+// Fill in the completion time of a step being saved by author, and its origin
+// and creation time when it is new
+func (s *Step) touch(author string, isNew bool) {
+	now := time.Now()
+	if isNew && s.Origin == "" {
+		s.Origin = author
+	}
+	if isNew && s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	switch {
+	case s.Status == "DONE" && s.CompletedAt == nil:
+		s.CompletedAt = &now
+	case s.Status != "DONE":
+		s.CompletedAt = nil
+	}
+}
+
+// Change a single step without rewriting the whole plan.
+// A positive version must match the stored one, otherwise ErrPlanVersionConflict is returned
+func (pm *PlanModel) UpdateStep(planID, stepID string, patch StepPatch, version int, author string) (*Plan, error) {
+	if !validAuthor(author) {
+		return nil, fmt.Errorf("invalid plan author '%s': must be %s or %s", author, AuthorAgent, AuthorUser)
+	}
+
+	var status string
+	if patch.Status != nil {
+		status = strings.ToUpper(*patch.Status)
+		if status != "TODO" && status != "DONE" {
+			return nil, fmt.Errorf("step '%s' has invalid status '%s': must be TODO or DONE", stepID, *patch.Status)
+		}
+	}
+
+	tx, err := pm.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	plan := &Plan{ID: planID, Steps: []*Step{}}
+
+	query := "UPDATE plans SET version = version + 1 WHERE id = ? RETURNING conversation_id, version, COALESCE(project, '')"
+	args := []any{planID}
+	if version > 0 {
+		query = "UPDATE plans SET version = version + 1 WHERE id = ? AND version = ? RETURNING conversation_id, version, COALESCE(project, '')"
+		args = append(args, version)
+	}
+
+	err = tx.QueryRow(pm.Dialect.rebind(query), args...).Scan(&plan.ConversationID, &plan.Version, &plan.Project)
+	if err == sql.ErrNoRows {
+		// Tell a missing plan apart from a stale version
+		var id string
+		if err := tx.QueryRow(pm.Dialect.rebind("SELECT id FROM plans WHERE id = ?"), planID).Scan(&id); err == sql.ErrNoRows {
+			return nil, ErrPlanNotFound
+		}
+		return nil, ErrPlanVersionConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bump version of plan '%s': %w", planID, err)
+	}
+
+	result, err := tx.Exec(pm.Dialect.rebind(`
+		UPDATE steps
+		SET status = COALESCE(?, status), description = COALESCE(?, description), notes = COALESCE(?, notes),
+			completed_at = CASE WHEN COALESCE(?, status) = 'DONE' THEN COALESCE(completed_at, ?) ELSE NULL END
+		WHERE plan_id = ? AND id = ?`),
+		nullString(status), patch.Description, patch.Notes, nullString(status), time.Now(), planID, stepID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update step '%s' in plan '%s': %w", stepID, planID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrStepNotFound
+	}
+
+	if patch.Acceptance != nil {
+		_, err = tx.Exec(pm.Dialect.rebind("DELETE FROM step_acceptance_criteria WHERE plan_id = ? AND step_id = ?"), planID, stepID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete old acceptance criteria for step '%s' in plan '%s': %w", stepID, planID, err)
+		}
+
+		for j, acText := range patch.Acceptance {
+			_, err = tx.Exec(pm.Dialect.rebind("INSERT INTO step_acceptance_criteria (plan_id, step_id, criterion_order, criterion) VALUES (?, ?, ?, ?)"), planID, stepID, j, acText)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert acceptance criterion for step '%s' in plan '%s': %w", stepID, planID, err)
+			}
+		}
+	}
+
+	if err := pm.loadSteps(tx, plan); err != nil {
+		return nil, err
+	}
+
+	if err := pm.recordRevision(tx, plan, author); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction for plan '%s': %w", planID, err)
+	}
+
+	return plan, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func (p *Plan) IsCompleted() bool {
 	return p.NextStep() == nil // If NextStep is nil, all steps are DONE
 }
 
-// Remove deletes plans from the database by their names (IDs).
-// It relies on "ON DELETE CASCADE" foreign key constraints to remove associated steps and criteria.
-// It returns a map where keys are plan names and values are errors encountered during deletion (nil on success).
-func (pm *PlanModel) Remove(planNames []string) map[string]error {
+// Remove deletes plans from the database by their IDs.
+// It relies on "ON DELETE CASCADE" foreign key constraints to remove associated steps, criteria and revisions.
+// It returns a map where keys are plan IDs and values are errors encountered during deletion (nil on success).
+func (pm *PlanModel) Remove(planIDs []string) map[string]error {
 	results := make(map[string]error)
 	tx, err := pm.DB.Begin()
 	if err != nil {
@@ -509,26 +729,38 @@ func (pm *PlanModel) Remove(planNames []string) map[string]error {
 
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("DELETE FROM plans WHERE id = ?")
+	stmt, err := tx.Prepare(pm.Dialect.rebind("DELETE FROM plans WHERE id = ?"))
 	if err != nil {
 		results["_"] = fmt.Errorf("failed to prepare delete statement: %w", err)
 		return results
 	}
 	defer stmt.Close()
 
-	for _, name := range planNames {
-		result, err := stmt.Exec(name)
+	tagStmt, err := tx.Prepare(pm.Dialect.rebind("DELETE FROM tags WHERE resource_type = 'plan' AND resource_id = ?"))
+	if err != nil {
+		results["_"] = fmt.Errorf("failed to prepare delete statement: %w", err)
+		return results
+	}
+	defer tagStmt.Close()
+
+	for _, id := range planIDs {
+		if _, err := tagStmt.Exec(id); err != nil {
+			results[id] = fmt.Errorf("failed to delete tags of plan '%s': %w", id, err)
+			continue
+		}
+
+		result, err := stmt.Exec(id)
 		if err != nil {
-			results[name] = fmt.Errorf("failed to execute delete for plan '%s': %w", name, err)
+			results[id] = fmt.Errorf("failed to execute delete for plan '%s': %w", id, err)
 			continue
 		}
 		rowsAffected, _ := result.RowsAffected()
 		if rowsAffected == 0 {
 			// Report this either as an error or warning
-			results[name] = fmt.Errorf("plan '%s' not found for deletion", name)
+			results[id] = tinkererr.Errorf(tinkererr.NotFound, "plan '%s' not found for deletion", id)
 		} else {
 			// Success
-			results[name] = nil
+			results[id] = nil
 		}
 	}
 
@@ -543,9 +775,9 @@ func (pm *PlanModel) Remove(planNames []string) map[string]error {
 	if !hasErrors {
 		if err := tx.Commit(); err != nil {
 			results["_"] = fmt.Errorf("failed to commit transaction for remove: %w", err)
-			for name, resErr := range results {
+			for id, resErr := range results {
 				if resErr == nil {
-					results[name] = fmt.Errorf("transaction commit failed after successful delete prep: %w", err)
+					results[id] = fmt.Errorf("transaction commit failed after successful delete prep: %w", err)
 				}
 			}
 		}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/honganh1206/tinker/tinkererr"
+)
+
+var ErrPlanRevisionNotFound = tinkererr.New(tinkererr.NotFound, "plan revision not found")
+
+// Who saved a plan revision
+const (
+	AuthorAgent = "agent"
+	AuthorUser  = "user"
+)
+
+// State of a plan right after one of its saves
+type PlanRevision struct {
+	PlanID    string    `json:"plan_id"`
+	Revision  int       `json:"revision"`
+	Author    string    `json:"author"`
+	Plan      *Plan     `json:"plan"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func validAuthor(author string) bool {
+	return author == AuthorAgent || author == AuthorUser
+}
+
+func (pm *PlanModel) recordRevision(tx *sql.Tx, plan *Plan, author string) error {
+	snapshot, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot plan '%s': %w", plan.ID, err)
+	}
+
+	query := `
+	INSERT INTO plan_revisions (plan_id, revision, author, snapshot)
+	SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?
+	FROM plan_revisions WHERE plan_id = ?
+	`
+
+	if _, err := tx.Exec(pm.Dialect.rebind(query), plan.ID, author, string(snapshot), plan.ID); err != nil {
+		return fmt.Errorf("failed to record revision of plan '%s': %w", plan.ID, err)
+	}
+
+	return nil
+}
+
+// Every revision of a plan, newest first
+func (pm *PlanModel) History(planID string) ([]PlanRevision, error) {
+	query := `
+	SELECT revision, author, snapshot, created_at
+	FROM plan_revisions
+	WHERE plan_id = ?
+	ORDER BY revision DESC
+	`
+
+	rows, err := pm.DB.Query(pm.Dialect.rebind(query), planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history of plan '%s': %w", planID, err)
+	}
+	defer rows.Close()
+
+	revisions := []PlanRevision{}
+	for rows.Next() {
+		rev := PlanRevision{PlanID: planID}
+		var snapshot string
+		if err := rows.Scan(&rev.Revision, &rev.Author, &snapshot, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision of plan '%s': %w", planID, err)
+		}
+
+		if err := json.Unmarshal([]byte(snapshot), &rev.Plan); err != nil {
+			return nil, fmt.Errorf("failed to decode revision %d of plan '%s': %w", rev.Revision, planID, err)
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating history of plan '%s': %w", planID, err)
+	}
+
+	if len(revisions) == 0 {
+		// Plans saved before history existed have no revisions yet
+		var id string
+		err := pm.DB.QueryRow(pm.Dialect.rebind("SELECT id FROM plans WHERE id = ?"), planID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, ErrPlanNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query plan '%s': %w", planID, err)
+		}
+	}
+
+	return revisions, nil
+}
+
+// Restore the steps of an older revision.
+// The restored state is saved as a new revision, so reverting can itself be undone
+func (pm *PlanModel) Revert(planID string, revision int, author string) (*Plan, error) {
+	var snapshot string
+	err := pm.DB.QueryRow(
+		pm.Dialect.rebind("SELECT snapshot FROM plan_revisions WHERE plan_id = ? AND revision = ?"),
+		planID, revision,
+	).Scan(&snapshot)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPlanRevisionNotFound
+		}
+		return nil, fmt.Errorf("failed to query revision %d of plan '%s': %w", revision, planID, err)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal([]byte(snapshot), &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode revision %d of plan '%s': %w", revision, planID, err)
+	}
+	if plan.Steps == nil {
+		plan.Steps = []*Step{}
+	}
+
+	if err := pm.Save(&plan, author); err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
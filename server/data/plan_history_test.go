@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlanner_HistoryAndRevert(t *testing.T) {
+	planner := createPlanTestModel(t)
+	conversationID := "test-conversation-id"
+	createTestConversation(t, planner.DB, conversationID)
+
+	plan, err := NewPlan(conversationID)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	if err := planner.Create(plan); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	plan.AddStep("step1", "First step", []string{"AC1"})
+	if err := planner.Save(plan, AuthorAgent); err != nil {
+		t.Fatalf("First Save failed: %v", err)
+	}
+
+	// Overwrite the plan with an unrelated step
+	plan.Steps = nil
+	plan.AddStep("other", "Something else", nil)
+	if err := planner.Save(plan, AuthorUser); err != nil {
+		t.Fatalf("Second Save failed: %v", err)
+	}
+
+	history, err := planner.History(plan.ID)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("History returned %d revisions, want 2", len(history))
+	}
+	if history[0].Revision != 2 || history[0].Author != AuthorUser || history[1].Revision != 1 || history[1].Author != AuthorAgent {
+		t.Errorf("History out of order or with wrong authors: %+v", history)
+	}
+	if history[1].CreatedAt.IsZero() {
+		t.Error("Revision has no timestamp")
+	}
+	if got := history[1].Plan.Steps; len(got) != 1 || got[0].ID != "step1" {
+		t.Errorf("Revision 1 snapshot has steps %+v, want step1", got)
+	}
+
+	restored, err := planner.Revert(plan.ID, 1, AuthorUser)
+	if err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	if len(restored.Steps) != 1 || restored.Steps[0].ID != "step1" {
+		t.Errorf("Revert returned steps %+v, want step1", restored.Steps)
+	}
+
+	current, err := planner.Get(conversationID)
+	if err != nil {
+		t.Fatalf("Get after Revert failed: %v", err)
+	}
+	if len(current.Steps) != 1 || current.Steps[0].ID != "step1" || len(current.Steps[0].Acceptance) != 1 {
+		t.Errorf("Stored plan after Revert has steps %+v, want step1 with its criterion", current.Steps)
+	}
+
+	history, err = planner.History(plan.ID)
+	if err != nil {
+		t.Fatalf("History after Revert failed: %v", err)
+	}
+	if len(history) != 3 || history[0].Revision != 3 {
+		t.Errorf("Revert should be recorded as revision 3, got %d revisions", len(history))
+	}
+
+	if _, err := planner.Revert(plan.ID, 42, AuthorUser); !errors.Is(err, ErrPlanRevisionNotFound) {
+		t.Errorf("Revert to a missing revision: got %v, want ErrPlanRevisionNotFound", err)
+	}
+	if err := planner.Save(plan, "someone"); err == nil {
+		t.Error("Save with an unknown author should fail")
+	}
+
+	if results := planner.Remove([]string{plan.ID}); results[plan.ID] != nil {
+		t.Fatalf("Remove failed: %v", results[plan.ID])
+	}
+	if _, err := planner.History(plan.ID); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("History of a removed plan: got %v, want ErrPlanNotFound", err)
+	}
+}
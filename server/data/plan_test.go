@@ -2,9 +2,13 @@ package data
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/honganh1206/tinker/tinkererr"
 )
 
 func createPlanTestModel(t *testing.T) PlanModel {
@@ -75,8 +79,17 @@ func TestPlanner_Create(t *testing.T) {
 		t.Fatalf("NewPlan failed: %v", err)
 	}
 	err = planner.Create(plan2)
-	if err == nil {
-		t.Error("Creating a second plan with the same conversation ID should fail")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Creating a second plan with the same conversation ID = %v, want an already exists error", err)
+	}
+
+	orphan, err := NewPlan("missing")
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	err = planner.Create(orphan)
+	if !errors.Is(err, ErrConversationNotFound) || !errors.Is(err, tinkererr.NotFound) {
+		t.Errorf("Creating a plan in a missing conversation = %v, want ErrConversationNotFound", err)
 	}
 }
 
@@ -139,7 +152,7 @@ func TestPlanner_SaveAndGet(t *testing.T) {
 	plan.AddStep("step2", "Second step", []string{"AC2.1"})
 
 	// 3. Save the plan
-	err = planner.Save(plan)
+	err = planner.Save(plan, AuthorAgent)
 	if err != nil {
 		t.Fatalf("Save failed: %v", err)
 	}
@@ -200,7 +213,7 @@ func TestPlanner_SaveAndGet(t *testing.T) {
 	retrievedPlan.ReorderSteps([]string{"step3", "step2"})
 
 	// 7. Save again
-	err = planner.Save(retrievedPlan)
+	err = planner.Save(retrievedPlan, AuthorAgent)
 	if err != nil {
 		t.Fatalf("Second Save failed: %v", err)
 	}
@@ -230,3 +243,184 @@ func TestPlanner_SaveAndGet(t *testing.T) {
 		t.Errorf("Final Step 2 Status mismatch (expected DONE)")
 	}
 }
+
+func TestPlanner_List(t *testing.T) {
+	planner := createPlanTestModel(t)
+	conversationID := "test-conversation-id"
+	createTestConversation(t, planner.DB, conversationID)
+
+	plan, err := NewPlan(conversationID)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	if err := planner.Create(plan); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	plan.AddStep("step1", "First step", nil)
+	plan.AddStep("step2", "Second step", nil)
+	if err := plan.MarkStepAsCompleted("step1"); err != nil {
+		t.Fatalf("MarkStepAsCompleted failed: %v", err)
+	}
+	if err := planner.Save(plan, AuthorAgent); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	infos, err := planner.List(ListFilter{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	if len(infos) != 1 {
+		t.Fatalf("List returned %d plans, want 1", len(infos))
+	}
+
+	info := infos[0]
+	if info.ID != plan.ID || info.ConversationID != conversationID {
+		t.Errorf("List returned %+v, want plan %s of conversation %s", info, plan.ID, conversationID)
+	}
+	if info.TotalTasks != 2 || info.CompletedTasks != 1 || info.Status != "TODO" {
+		t.Errorf("List returned progress %d/%d (%s), want 1/2 (TODO)", info.CompletedTasks, info.TotalTasks, info.Status)
+	}
+}
+
+func TestPlanner_UpdateStep(t *testing.T) {
+	planner := createPlanTestModel(t)
+	conversationID := "test-conversation-id"
+	createTestConversation(t, planner.DB, conversationID)
+
+	plan, err := NewPlan(conversationID)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	if err := planner.Create(plan); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	plan.AddStep("step1", "First step", []string{"AC1"})
+	plan.AddStep("step2", "Second step", nil)
+	if err := planner.Save(plan, AuthorAgent); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if plan.Version != 2 {
+		t.Fatalf("Version after Create and Save = %d, want 2", plan.Version)
+	}
+
+	done := "done"
+	updated, err := planner.UpdateStep(plan.ID, "step1", StepPatch{Status: &done}, plan.Version, AuthorUser)
+	if err != nil {
+		t.Fatalf("UpdateStep failed: %v", err)
+	}
+	if updated.Version != 3 || updated.Steps[0].Status != "DONE" || updated.Steps[0].Description != "First step" {
+		t.Errorf("UpdateStep returned %+v (version %d), want step1 DONE at version 3", updated.Steps[0], updated.Version)
+	}
+	if len(updated.Steps[0].Acceptance) != 1 {
+		t.Errorf("UpdateStep dropped acceptance criteria it was not asked to change")
+	}
+
+	// A writer still holding version 2 must not clobber the change
+	description := "Stale edit"
+	if _, err := planner.UpdateStep(plan.ID, "step2", StepPatch{Description: &description}, plan.Version, AuthorUser); !errors.Is(err, ErrPlanVersionConflict) {
+		t.Errorf("UpdateStep with a stale version: got %v, want ErrPlanVersionConflict", err)
+	}
+
+	updated, err = planner.UpdateStep(plan.ID, "step2", StepPatch{Description: &description, Acceptance: []string{"AC2"}}, 0, AuthorUser)
+	if err != nil {
+		t.Fatalf("UpdateStep without a version failed: %v", err)
+	}
+	if updated.Steps[1].Description != description || len(updated.Steps[1].Acceptance) != 1 {
+		t.Errorf("UpdateStep returned %+v, want the new description and criterion", updated.Steps[1])
+	}
+
+	if _, err := planner.UpdateStep(plan.ID, "missing", StepPatch{Status: &done}, 0, AuthorUser); !errors.Is(err, ErrStepNotFound) {
+		t.Errorf("UpdateStep on a missing step: got %v, want ErrStepNotFound", err)
+	}
+	if _, err := planner.UpdateStep("missing", "step1", StepPatch{Status: &done}, 0, AuthorUser); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("UpdateStep on a missing plan: got %v, want ErrPlanNotFound", err)
+	}
+
+	history, err := planner.History(plan.ID)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 3 || history[0].Author != AuthorUser {
+		t.Errorf("Step updates should be recorded as user revisions, got %d revisions", len(history))
+	}
+}
+
+func TestPlanner_StepMetadata(t *testing.T) {
+	planner := createPlanTestModel(t)
+	conversationID := "test-conversation-id"
+	createTestConversation(t, planner.DB, conversationID)
+
+	plan, err := NewPlan(conversationID)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	if err := planner.Create(plan); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	plan.AddStep("step1", "First step", nil)
+	plan.Steps[0].Notes = "Keep the old API working"
+	if err := planner.Save(plan, AuthorAgent); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	plan.AddStep("step2", "Second step", nil)
+	if err := plan.MarkStepAsCompleted("step1"); err != nil {
+		t.Fatalf("MarkStepAsCompleted failed: %v", err)
+	}
+	if err := planner.Save(plan, AuthorUser); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	got, err := planner.Get(conversationID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	first, second := got.Steps[0], got.Steps[1]
+	// The origin stays with whoever added the step
+	if first.Origin != AuthorAgent || second.Origin != AuthorUser {
+		t.Errorf("Origins = %q, %q, want agent then user", first.Origin, second.Origin)
+	}
+	if first.Notes != "Keep the old API working" || first.CreatedAt.IsZero() || first.CompletedAt == nil {
+		t.Errorf("First step = %+v, want its notes, creation and completion times", first)
+	}
+	if second.CompletedAt != nil {
+		t.Errorf("Second step completed at %v, want it open", second.CompletedAt)
+	}
+
+	// Saving a done step again keeps the time it was completed
+	completedAt := *first.CompletedAt
+	got.Steps[0].CompletedAt = nil
+	if err := planner.Save(got, AuthorAgent); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	again, err := planner.Get(conversationID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if again.Steps[0].CompletedAt == nil || !again.Steps[0].CompletedAt.Equal(completedAt) {
+		t.Errorf("Completed at %v after saving again, want %v", again.Steps[0].CompletedAt, completedAt)
+	}
+
+	todo, notes := "TODO", "Reopened, the tests fail on Windows"
+	updated, err := planner.UpdateStep(plan.ID, "step1", StepPatch{Status: &todo, Notes: &notes}, 0, AuthorUser)
+	if err != nil {
+		t.Fatalf("UpdateStep failed: %v", err)
+	}
+	if updated.Steps[0].Notes != notes || updated.Steps[0].CompletedAt != nil {
+		t.Errorf("Reopened step = %+v, want the new notes and no completion time", updated.Steps[0])
+	}
+	done := "DONE"
+	if updated, err = planner.UpdateStep(plan.ID, "step2", StepPatch{Status: &done}, 0, AuthorUser); err != nil {
+		t.Fatalf("UpdateStep failed: %v", err)
+	}
+	if updated.Steps[1].CompletedAt == nil {
+		t.Errorf("Step marked done = %+v, want a completion time", updated.Steps[1])
+	}
+
+	if inspected := updated.Inspect(); !strings.Contains(inspected, "Notes: "+notes) || !strings.Contains(inspected, "Added by agent on ") {
+		t.Errorf("Inspect() = %q, want the notes and origin of the step", inspected)
+	}
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/db"
+	_ "github.com/lib/pq"
+)
+
+// Runs the models against a real Postgres server, e.g.
+// TINKER_TEST_POSTGRES_URL=postgres://postgres@localhost/tinker_test?sslmode=disable
+func createPostgresTestModels(t *testing.T) *Models {
+	t.Helper()
+
+	dsn := os.Getenv("TINKER_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TINKER_TEST_POSTGRES_URL not set")
+	}
+
+	conn, err := db.Open(Postgres.Driver(), dsn)
+	if err != nil {
+		t.Fatalf("Failed to initialize Postgres database: %v", err)
+	}
+
+	if _, err := Migrate(conn, Postgres); err != nil {
+		t.Fatalf("Failed to migrate Postgres database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return NewModels(conn, Postgres)
+}
+
+func TestPostgres_ConversationsAndPlans(t *testing.T) {
+	models := createPostgresTestModels(t)
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation failed: %v", err)
+	}
+	if err := models.Conversations.Create(conv); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	t.Cleanup(func() {
+		models.Conversations.Delete(conv.ID)
+	})
+
+	conv.Append(&message.Message{
+		Role:    message.UserRole,
+		Content: []message.ContentBlock{message.NewTextBlock("postgres migration checklist")},
+	})
+	// Saving twice must not trip over the existing conversation row
+	for range 2 {
+		if err := models.Conversations.Save(conv); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	got, err := models.Conversations.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(got.Messages) != 1 {
+		t.Errorf("Get returned %d messages, want 1", len(got.Messages))
+	}
+
+	results, err := models.Conversations.Search("Postgres CHECKLIST", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	found := false
+	for _, r := range results {
+		found = found || r.ConversationID == conv.ID
+	}
+	if !found {
+		t.Errorf("Search did not find conversation %s", conv.ID)
+	}
+
+	plan, err := NewPlan(conv.ID)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	if err := models.Plans.Create(plan); err != nil {
+		t.Fatalf("Plan create failed: %v", err)
+	}
+	plan.AddStep("dump", "Dump the SQLite data", []string{"dump file exists"})
+	if err := models.Plans.Save(plan, AuthorAgent); err != nil {
+		t.Fatalf("Plan save failed: %v", err)
+	}
+
+	gotPlan, err := models.Plans.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Plan get failed: %v", err)
+	}
+	if len(gotPlan.Steps) != 1 || len(gotPlan.Steps[0].GetAcceptanceCriteria()) != 1 {
+		t.Errorf("Plan get returned %+v, want one step with one criterion", gotPlan.Steps)
+	}
+
+	if err := models.Conversations.Delete(conv.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+}
+
+func TestPostgres_TokensAndToolCache(t *testing.T) {
+	models := createPostgresTestModels(t)
+
+	token, err := models.APITokens.Create()
+	if err != nil {
+		t.Fatalf("Token create failed: %v", err)
+	}
+	if valid, err := models.APITokens.Valid(token); err != nil || !valid {
+		t.Errorf("Valid(new token) = %v, %v, want true", valid, err)
+	}
+
+	cache := &MCPToolCache{Key: "postgres-test", ServerID: "fetch", Tools: json.RawMessage(`[]`)}
+	for range 2 {
+		if err := models.MCPToolCache.Save(cache); err != nil {
+			t.Fatalf("Tool cache save failed: %v", err)
+		}
+	}
+	if _, err := models.MCPToolCache.Get(cache.Key); err != nil {
+		t.Errorf("Tool cache get failed: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+func renderTitle(conv *Conversation) string {
+	if conv.Title != "" {
+		return conv.Title
+	}
+	return "Conversation " + conv.ID
+}
+
+func roleTitle(role string) string {
+	switch role {
+	case message.UserRole:
+		return "User"
+	case message.AssistantRole, message.ModelRole:
+		return "Assistant"
+	default:
+		return role
+	}
+}
+
+// Transcript as Markdown: messages under a heading for their role, tool calls and results
+// in fenced blocks, and edits as diffs
+func (conv *Conversation) RenderMarkdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", renderTitle(conv))
+	fmt.Fprintf(&b, "_Conversation %s, started %s_\n", conv.ID, conv.CreatedAt.Format("2006-01-02 15:04"))
+
+	for _, msg := range conv.Messages {
+		fmt.Fprintf(&b, "\n## %s\n\n", roleTitle(msg.Role))
+
+		for _, block := range msg.Content {
+			switch blk := block.(type) {
+			case message.TextBlock:
+				b.WriteString(strings.TrimSpace(blk.Text) + "\n\n")
+			case message.ImageBlock:
+				fmt.Fprintf(&b, "_%s_\n\n", blk.Placeholder())
+			case message.CitationBlock:
+				fmt.Fprintf(&b, "**Source** [%s](<%s>)\n\n", blk.Reference(), blk.Link())
+				if blk.Quote != "" {
+					b.WriteString(blockquote(blk.Quote) + "\n\n")
+				}
+			case message.ToolUseBlock:
+				if edit, ok := editDiff(blk); ok {
+					fmt.Fprintf(&b, "**Tool call** `%s` `%s`\n\n", blk.Name, edit.path)
+					writeFence(&b, "diff", edit.diff)
+					continue
+				}
+				fmt.Fprintf(&b, "**Tool call** `%s`\n\n", blk.Name)
+				writeFence(&b, "json", prettyJSON(blk.Input))
+			case message.ToolResultBlock:
+				label := "Tool result"
+				if blk.IsError {
+					label = "Tool error"
+				}
+				fmt.Fprintf(&b, "**%s** `%s`\n\n", label, blk.ToolName)
+				writeFence(&b, "", blk.Content)
+			}
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// Quote text in Markdown, every line of it
+func blockquote(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Fence a code block with more backticks than the content contains,
+// so tool output with its own fences cannot break out of the block
+func writeFence(b *strings.Builder, lang, content string) {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n\n", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
+
+type fileEdit struct {
+	path string
+	diff string
+}
+
+// Path a file edit tool call changes and a diff of the change, false for other calls.
+// Set by the tools package, which imports this one
+var EditDiff func(blk message.ToolUseBlock) (path, diff string, ok bool)
+
+// Edits read better as the lines they removed and added than as escaped JSON strings
+func editDiff(blk message.ToolUseBlock) (fileEdit, bool) {
+	if EditDiff == nil {
+		return fileEdit{}, false
+	}
+	path, diff, ok := EditDiff(blk)
+	return fileEdit{path: path, diff: diff}, ok
+}
+
+func prettyJSON(raw json.RawMessage) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return out.String()
+}
+
+type htmlBlock struct {
+	Kind    string
+	Title   string
+	Content string
+	IsError bool
+	Image   template.URL
+	Link    template.URL
+}
+
+// Media types embedded in HTML transcripts, anything else is shown by its placeholder
+var renderImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type htmlMessage struct {
+	Role   string
+	Blocks []htmlBlock
+}
+
+var renderTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 860px; margin: 2rem auto; padding: 0 1rem; color: #222; }
+.message { border-left: 3px solid #ccc; padding: 0.25rem 1rem; margin: 1.5rem 0; }
+.message.user { border-color: #3b82f6; }
+.message.assistant { border-color: #10b981; }
+.role { font-weight: bold; text-transform: uppercase; font-size: 0.8rem; color: #666; }
+.text { white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: 0.75rem; overflow-x: auto; }
+.error pre { background: #fdecec; }
+.tool { font-size: 0.9rem; color: #555; }
+.image { max-width: 100%; }
+.citation { font-size: 0.9rem; color: #555; }
+blockquote { margin: 0.25rem 0 0; padding-left: 0.75rem; border-left: 2px solid #ddd; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p><em>Conversation {{.ID}}, started {{.Started}}</em></p>
+{{range .Messages}}<div class="message {{.Role}}">
+<div class="role">{{.Role}}</div>
+{{range .Blocks}}{{if eq .Kind "text"}}<div class="text">{{.Content}}</div>
+{{else if eq .Kind "image"}}<img class="image" src="{{.Image}}" alt="{{.Title}}">
+{{else if eq .Kind "citation"}}<div class="citation">Source: <a href="{{.Link}}">{{.Title}}</a>{{if .Content}}<blockquote>{{.Content}}</blockquote>{{end}}</div>
+{{else}}<div class="tool{{if .IsError}} error{{end}}"><div>{{.Title}}</div><pre>{{.Content}}</pre></div>
+{{end}}{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+// Transcript as a standalone HTML page, images embedded
+func (conv *Conversation) RenderHTML() ([]byte, error) {
+	messages := make([]htmlMessage, 0, len(conv.Messages))
+	for _, msg := range conv.Messages {
+		m := htmlMessage{Role: strings.ToLower(roleTitle(msg.Role))}
+
+		for _, block := range msg.Content {
+			switch blk := block.(type) {
+			case message.TextBlock:
+				m.Blocks = append(m.Blocks, htmlBlock{Kind: "text", Content: strings.TrimSpace(blk.Text)})
+			case message.ImageBlock:
+				if !renderImageTypes[blk.MediaType] {
+					m.Blocks = append(m.Blocks, htmlBlock{Kind: "text", Content: blk.Placeholder()})
+					continue
+				}
+				// Safe to mark, the data is base64 and the media type one of ours
+				src := template.URL("data:" + blk.MediaType + ";base64," + blk.Data)
+				m.Blocks = append(m.Blocks, htmlBlock{Kind: "image", Title: blk.Placeholder(), Image: src})
+			case message.CitationBlock:
+				// Safe to mark, links are http(s) URLs or built from a path without a scheme of its own
+				m.Blocks = append(m.Blocks, htmlBlock{Kind: "citation", Title: blk.Reference(), Content: blk.Quote, Link: template.URL(blk.Link())})
+			case message.ToolUseBlock:
+				if edit, ok := editDiff(blk); ok {
+					m.Blocks = append(m.Blocks, htmlBlock{Kind: "tool", Title: "Tool call " + blk.Name + " " + edit.path, Content: edit.diff})
+					continue
+				}
+				m.Blocks = append(m.Blocks, htmlBlock{Kind: "tool", Title: "Tool call " + blk.Name, Content: prettyJSON(blk.Input)})
+			case message.ToolResultBlock:
+				title := "Tool result " + blk.ToolName
+				if blk.IsError {
+					title = "Tool error " + blk.ToolName
+				}
+				m.Blocks = append(m.Blocks, htmlBlock{Kind: "tool", Title: title, Content: blk.Content, IsError: blk.IsError})
+			}
+		}
+
+		messages = append(messages, m)
+	}
+
+	var out bytes.Buffer
+	err := renderTemplate.Execute(&out, map[string]any{
+		"ID":       conv.ID,
+		"Title":    renderTitle(conv),
+		"Started":  conv.CreatedAt.Format("2006-01-02 15:04"),
+		"Messages": messages,
+	})
+
+	return out.Bytes(), err
+}
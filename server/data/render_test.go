@@ -0,0 +1,119 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+func renderFixture() *Conversation {
+	return &Conversation{
+		ID:        "conv-1",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC),
+		Messages: []*message.Message{
+			{Role: message.UserRole, Content: []message.ContentBlock{
+				message.TextBlock{Text: "list files <please>"},
+			}},
+			{Role: message.AssistantRole, Content: []message.ContentBlock{
+				message.ToolUseBlock{ID: "t1", Name: "edit_file", Input: json.RawMessage(`{"path":"main.go"}`)},
+			}},
+		},
+	}
+}
+
+func TestConversation_RenderHTMLEscapes(t *testing.T) {
+	out, err := renderFixture().RenderHTML()
+	if err != nil {
+		t.Fatalf("RenderHTML() error = %v", err)
+	}
+
+	html := string(out)
+	if strings.Contains(html, "<please>") {
+		t.Errorf("message text was not escaped")
+	}
+	if !strings.Contains(html, "list files &lt;please&gt;") || !strings.Contains(html, "Tool call edit_file") {
+		t.Errorf("html missing transcript:\n%s", html)
+	}
+}
+
+func TestConversation_RenderImages(t *testing.T) {
+	conv := renderFixture()
+	conv.Messages[0].Content = append(conv.Messages[0].Content,
+		message.NewImageBlock("image/png", []byte("png"), "shot.png"),
+		message.NewImageBlock("image/svg+xml", []byte("<svg/>"), "logo.svg"),
+	)
+
+	md := conv.RenderMarkdown()
+	if !strings.Contains(md, "_[image: shot.png, 1 KB]_") {
+		t.Errorf("markdown missing image placeholder:\n%s", md)
+	}
+
+	html, err := conv.RenderHTML()
+	if err != nil {
+		t.Fatalf("RenderHTML() error = %v", err)
+	}
+	if !strings.Contains(string(html), `src="data:image/png;base64,cG5n"`) {
+		t.Errorf("html missing embedded image:\n%s", html)
+	}
+	// Only known raster types are embedded
+	if strings.Contains(string(html), "data:image/svg") || !strings.Contains(string(html), "[image: logo.svg, 1 KB]") {
+		t.Errorf("svg should be shown by its placeholder:\n%s", html)
+	}
+}
+
+func TestConversation_RenderEditDiff(t *testing.T) {
+	conv := renderFixture()
+
+	// Without the hook of the tools package, edits are shown as their input
+	EditDiff = nil
+	if md := conv.RenderMarkdown(); !strings.Contains(md, "**Tool call** `edit_file`\n\n```json\n{\n  \"path\": \"main.go\"\n}") {
+		t.Errorf("markdown missing tool input:\n%s", md)
+	}
+
+	EditDiff = func(blk message.ToolUseBlock) (string, string, bool) {
+		return "main.go", "--- main.go\n+++ main.go\n+a := 1\n", true
+	}
+	defer func() { EditDiff = nil }()
+
+	if md := conv.RenderMarkdown(); !strings.Contains(md, "**Tool call** `edit_file` `main.go`\n\n```diff\n--- main.go\n+++ main.go\n+a := 1\n```") {
+		t.Errorf("markdown missing edit diff:\n%s", md)
+	}
+	html, err := conv.RenderHTML()
+	if err != nil {
+		t.Fatalf("RenderHTML() error = %v", err)
+	}
+	if !strings.Contains(string(html), "Tool call edit_file main.go") {
+		t.Errorf("html missing edit diff:\n%s", html)
+	}
+}
+
+func TestConversation_RenderCitations(t *testing.T) {
+	conv := renderFixture()
+	conv.Messages = append(conv.Messages, &message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{
+		message.NewTextBlock("It retries <three> times"),
+		message.NewCitationBlock("/src/retry.go", 12, 13, "const maxRetries = 3\n// then give up"),
+		message.NewCitationBlock("https://example.com/docs", 0, 0, ""),
+	}})
+
+	md := conv.RenderMarkdown()
+	for _, want := range []string{
+		"**Source** [/src/retry.go:12-13](<file:///src/retry.go>)",
+		"> const maxRetries = 3\n> // then give up",
+		"**Source** [https://example.com/docs](<https://example.com/docs>)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+
+	html, err := conv.RenderHTML()
+	if err != nil {
+		t.Fatalf("RenderHTML() error = %v", err)
+	}
+	if !strings.Contains(string(html), `<a href="file:///src/retry.go">/src/retry.go:12-13</a>`) || !strings.Contains(string(html), `<a href="https://example.com/docs">`) {
+		t.Errorf("html missing citation links:\n%s", html)
+	}
+}
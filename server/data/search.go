@@ -0,0 +1,270 @@
+package data
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/utils"
+)
+
+//go:embed conversation_search_schema.sql
+var ConversationSearchSchema string
+
+// How many words of context surround a match in a snippet
+const snippetWords = 12
+
+// Best matching message of a conversation
+type SearchResult struct {
+	ConversationID string    `json:"conversation_id"`
+	Snippet        string    `json:"snippet"`
+	MessageTime    time.Time `json:"message_time"`
+}
+
+// Create the full-text index over messages.
+// Fails when SQLite was built without FTS5, in which case Search falls back to a plain scan
+func EnableSearchIndex(db *sql.DB) error {
+	// Indexes created by earlier versions hold a copy of the text, rebuilt without it
+	var schema string
+	err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'`).Scan(&schema)
+	if err == nil && !strings.Contains(schema, "content = ''") {
+		if _, err := db.Exec(`
+			DROP TRIGGER IF EXISTS messages_fts_insert;
+			DROP TRIGGER IF EXISTS messages_fts_delete;
+			DROP TABLE messages_fts;`); err != nil {
+			return fmt.Errorf("failed to drop the previous search index: %w", err)
+		}
+	} else if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up the search index: %w", err)
+	}
+
+	if _, err := db.Exec(ConversationSearchSchema); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+	return nil
+}
+
+// Drop the full-text index. Its terms would give away the text of encrypted payloads,
+// and its trigger cannot read them
+func DisableSearchIndex(db *sql.DB) error {
+	if _, err := db.Exec(`
+		DROP TRIGGER IF EXISTS messages_fts_insert;
+		DROP TRIGGER IF EXISTS messages_fts_delete;
+		DROP TABLE IF EXISTS messages_fts;`); err != nil {
+		return fmt.Errorf("failed to drop the search index: %w", err)
+	}
+	return nil
+}
+
+// Find conversations whose messages contain every word of the query,
+// best match first and one result per conversation
+func (cm ConversationModel) Search(query string, limit int) ([]SearchResult, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	// The FTS5 index only exists in SQLite, and never alongside encrypted payloads
+	if cm.Dialect != SQLite || cm.Cipher != nil {
+		return cm.searchScan(terms, limit)
+	}
+
+	results, err := cm.searchIndex(terms, limit)
+	if err != nil && strings.Contains(err.Error(), "no such table: messages_fts") {
+		return cm.searchScan(terms, limit)
+	}
+
+	return results, err
+}
+
+func (cm ConversationModel) searchIndex(terms []string, limit int) ([]SearchResult, error) {
+	// Quote every term so user input is never parsed as FTS syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	// The index holds no text to cut snippets from, they come from the payloads
+	query := `
+		SELECT
+			m.conversation_id,
+			m.payload,
+			m.created_at
+		FROM
+			messages_fts
+		JOIN
+			messages m ON m.id = messages_fts.rowid
+		WHERE
+			messages_fts MATCH ?
+		ORDER BY
+			bm25(messages_fts)
+	`
+
+	rows, err := cm.DB.Query(cm.Dialect.rebind(query), strings.Join(quoted, " "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	defer rows.Close()
+
+	return collectSearchResults(rows, limit, func(payload string) string {
+		// Stemmed matches, e.g., "fixing" for "fix", land on the start of the text
+		return makeSnippet(payloadText(payload), terms[0])
+	})
+}
+
+// Slow path without FTS5: match the raw payloads and build snippets in Go.
+// Encrypted payloads cannot be matched by the database, every one is decrypted and matched here
+func (cm ConversationModel) searchScan(terms []string, limit int) ([]SearchResult, error) {
+	// LIKE is already case-insensitive for ASCII in SQLite
+	like := "LIKE"
+	if cm.Dialect == Postgres {
+		like = "ILIKE"
+	}
+
+	conditions := []string{"TRUE"}
+	var args []any
+	if cm.Cipher == nil {
+		conditions = make([]string, len(terms))
+		args = make([]any, len(terms))
+		for i, term := range terms {
+			conditions[i] = "payload " + like + " ? ESCAPE '\\'"
+			args[i] = "%" + escapeLike(term) + "%"
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT conversation_id, payload, created_at
+		FROM messages
+		WHERE %s
+		ORDER BY created_at DESC
+	`, strings.Join(conditions, " AND "))
+
+	rows, err := cm.DB.Query(cm.Dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	defer rows.Close()
+
+	return collectSearchResults(rows, limit, func(payload string) string {
+		payload, err := cm.Cipher.decrypt(payload)
+		if err != nil {
+			return ""
+		}
+		text := payloadText(payload)
+		if !containsAll(text, terms) {
+			// Matched on JSON keys or tool payloads only
+			return ""
+		}
+
+		return makeSnippet(text, terms[0])
+	})
+}
+
+// Keep the first hit of every conversation, rows must be ordered best first.
+// Rows for which toSnippet returns an empty string are skipped
+func collectSearchResults(rows *sql.Rows, limit int, toSnippet func(text string) string) ([]SearchResult, error) {
+	results := []SearchResult{}
+	seen := make(map[string]bool)
+
+	for rows.Next() {
+		var convID, text, createdAt string
+		if err := rows.Scan(&convID, &text, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		if seen[convID] {
+			continue
+		}
+
+		snippet := toSnippet(text)
+		if snippet == "" {
+			continue
+		}
+
+		messageTime, err := utils.ParseTimeWithFallback(createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse message created_at: %w", err)
+		}
+
+		seen[convID] = true
+		results = append(results, SearchResult{
+			ConversationID: convID,
+			Snippet:        snippet,
+			MessageTime:    messageTime,
+		})
+
+		if len(results) >= limit {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating search results: %w", err)
+	}
+
+	return results, nil
+}
+
+// Text blocks of a stored message, what the index covers
+func payloadText(payload string) string {
+	msg, err := decodePayload(payload)
+	if err != nil {
+		return ""
+	}
+
+	var texts []string
+	for _, block := range msg.Content {
+		if tb, ok := block.(message.TextBlock); ok {
+			texts = append(texts, tb.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func containsAll(text string, terms []string) bool {
+	lower := strings.ToLower(text)
+	for _, term := range terms {
+		if !strings.Contains(lower, strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Cut a few words around the first occurrence of term
+func makeSnippet(text, term string) string {
+	words := strings.Fields(text)
+	lowerTerm := strings.ToLower(term)
+
+	hit := 0
+	for i, w := range words {
+		if strings.Contains(strings.ToLower(w), lowerTerm) {
+			hit = i
+			break
+		}
+	}
+
+	start := max(0, hit-snippetWords/2)
+	end := min(len(words), start+snippetWords)
+
+	snippet := strings.Join(words[start:end], " ")
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(words) {
+		snippet += "..."
+	}
+
+	return snippet
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+func saveTestConversation(t *testing.T, model *ConversationModel, texts ...string) *Conversation {
+	t.Helper()
+
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	for _, text := range texts {
+		conv.Append(&message.Message{
+			Role:    message.UserRole,
+			Content: []message.ContentBlock{message.NewTextBlock(text)},
+		})
+	}
+	if err := model.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	return conv
+}
+
+func TestSearch(t *testing.T) {
+	model := createTestModel(t)
+
+	// Without the sqlite_fts5 build tag this fails and Search scans the messages instead
+	indexErr := EnableSearchIndex(model.DB)
+	t.Logf("search index: %v", indexErr)
+
+	match := saveTestConversation(t, model, "Hello", "We finally fixed the flaky websocket test by adding a retry")
+	saveTestConversation(t, model, "Let's refactor the websocket server")
+	saveTestConversation(t, model, "Nothing relevant here")
+
+	results, err := model.Search("flaky websocket", 10)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d: %+v", len(results), results)
+	}
+	if results[0].ConversationID != match.ID {
+		t.Errorf("Expected conversation %s, got %s", match.ID, results[0].ConversationID)
+	}
+	if results[0].Snippet == "" {
+		t.Error("Expected a non-empty snippet")
+	}
+
+	results, err = model.Search("websocket", 10)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+
+	// Quotes and FTS operators in the query are searched literally
+	if _, err := model.Search(`"flaky" OR -test`, 10); err != nil {
+		t.Errorf("Search() with special characters failed: %v", err)
+	}
+	// Messages dropped from a history are gone from the index as well
+	match.Messages = match.Messages[:1]
+	if err := model.Save(match); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	results, err = model.Search("flaky", 10)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no result for a removed message, got %+v", results)
+	}
+}
+
+func TestEnableSearchIndex_RebuildsCopyingIndex(t *testing.T) {
+	model := createTestModel(t)
+	conv := saveTestConversation(t, model, "An index from before")
+
+	// The layout of earlier versions, holding a copy of the text
+	_, err := model.DB.Exec(`
+		CREATE VIRTUAL TABLE messages_fts USING fts5(text, conversation_id UNINDEXED, tokenize = 'porter unicode61');
+		CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages FOR EACH ROW
+		BEGIN DELETE FROM messages_fts WHERE rowid = old.id; END;`)
+	if err != nil {
+		t.Skipf("SQLite built without FTS5: %v", err)
+	}
+
+	if err := EnableSearchIndex(model.DB); err != nil {
+		t.Fatalf("EnableSearchIndex() failed: %v", err)
+	}
+
+	var schema string
+	if err := model.DB.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'messages_fts'`).Scan(&schema); err != nil {
+		t.Fatalf("Failed to read the index schema: %v", err)
+	}
+	if !strings.Contains(schema, "content = ''") {
+		t.Errorf("Index still stores the text: %s", schema)
+	}
+
+	results, err := model.Search("before", 10)
+	if err != nil || len(results) != 1 || results[0].ConversationID != conv.ID {
+		t.Errorf("Search() after the rebuild = %+v, %v, want the saved conversation", results, err)
+	}
+}
+
+func TestMakeSnippet(t *testing.T) {
+	text := "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen"
+	got := makeSnippet(text, "ten")
+	want := "...four five six seven eight nine ten eleven twelve thirteen fourteen fifteen..."
+	if got != want {
+		t.Errorf("makeSnippet() = %q, want %q", got, want)
+	}
+}
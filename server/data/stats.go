@@ -0,0 +1,38 @@
+package data
+
+import "time"
+
+// Use of the agent over the conversations active in a period
+type Stats struct {
+	// Start of the period, zero for all time
+	Since time.Time `json:"since"`
+	// Conversations with a message in the period
+	Sessions int `json:"sessions"`
+	Messages int `json:"messages"`
+	// Most tokens first
+	Models []ModelUsage `json:"models"`
+	// Most calls first
+	Tools []NameCount `json:"tools"`
+	// Paths passed to edit_file, most edits first
+	Files []NameCount `json:"files"`
+}
+
+type ModelUsage struct {
+	// Empty for the replies stored before models were recorded
+	Model        string `json:"model"`
+	Replies      int    `json:"replies"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	// Prompt tokens read from and written to the prompt cache
+	CacheReadTokens  int64 `json:"cache_read_tokens"`
+	CacheWriteTokens int64 `json:"cache_write_tokens"`
+	// Mean time to a complete reply, 0 when no reply recorded it
+	AvgLatencyMs int64 `json:"avg_latency_ms"`
+	// USD, nil when the price of the model is unknown
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+type NameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,60 @@
+package data
+
+import "github.com/honganh1206/tinker/message"
+
+// Storage used by the server, implemented by the SQL models for every dialect
+
+type ConversationStore interface {
+	Create(c *Conversation) error
+	Save(c *Conversation) error
+	AppendMessages(id string, from int, msgs []*message.Message) (int, error)
+	List(filter ListFilter) ([]ConversationMetadata, error)
+	LatestID() (string, error)
+	Get(id string) (*Conversation, error)
+	Rename(id, title string) error
+	Fork(id string, atSequence int) (*Conversation, error)
+	Redact(id string, sequence, block int) error
+	AddSummary(id string, s *Summary) error
+	Archive(id string) error
+	Unarchive(id string, archived *Conversation) error
+	SetModel(id, provider, model string) error
+	Delete(id string) error
+	Search(query string, limit int) ([]SearchResult, error)
+}
+
+type PlanStore interface {
+	Create(plan *Plan) error
+	Get(conversationID string) (*Plan, error)
+	List(filter ListFilter) ([]PlanInfo, error)
+	Save(plan *Plan, author string) error
+	UpdateStep(planID, stepID string, patch StepPatch, version int, author string) (*Plan, error)
+	History(planID string) ([]PlanRevision, error)
+	Revert(planID string, revision int, author string) (*Plan, error)
+	Remove(planIDs []string) map[string]error
+	Compact() error
+}
+
+type MCPToolCacheStore interface {
+	Get(key string) (*MCPToolCache, error)
+	Save(cache *MCPToolCache) error
+}
+
+type TagStore interface {
+	Add(resourceType, id, tag string) error
+	Remove(resourceType, id, tag string) error
+	Set(resourceType, id string, tags []string) error
+}
+
+type APITokenStore interface {
+	Create() (string, error)
+	Valid(token string) (bool, error)
+	Count() (int, error)
+}
+
+var (
+	_ ConversationStore = (*ConversationModel)(nil)
+	_ PlanStore         = (*PlanModel)(nil)
+	_ MCPToolCacheStore = (*MCPToolCacheModel)(nil)
+	_ TagStore          = (*TagModel)(nil)
+	_ APITokenStore     = (*APITokenModel)(nil)
+)
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+// Introduces the summary where it stands in for the messages it covers
+const summaryIntro = "Summary of the earlier messages, compacted to free up context:\n\n"
+
+var ErrSummaryRange = errors.New("history: summary range is outside the conversation")
+
+// What compaction made of messages From up to, not including, To of a conversation.
+// The messages stay in the history, the latest summary stands in for them when it goes to a model
+type Summary struct {
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Summary standing in for the most messages, nil until the conversation is compacted
+func (c *Conversation) LatestSummary() *Summary {
+	if len(c.Summaries) == 0 {
+		return nil
+	}
+	return c.Summaries[len(c.Summaries)-1]
+}
+
+// Messages to send to a model, those the latest summary covers replaced by a message holding it.
+// A summary outside the messages, e.g., of a history rewritten since, is ignored
+func (c *Conversation) History() []*message.Message {
+	s := c.LatestSummary()
+	if s == nil || s.From < 0 || s.From >= s.To || s.To > len(c.Messages) {
+		return c.Messages
+	}
+
+	history := make([]*message.Message, 0, len(c.Messages)-(s.To-s.From)+1)
+	history = append(history, c.Messages[:s.From]...)
+	history = append(history, &message.Message{
+		Role:      message.UserRole,
+		Content:   []message.ContentBlock{message.NewTextBlock(summaryIntro + s.Text)},
+		CreatedAt: s.CreatedAt,
+	})
+	return append(history, c.Messages[s.To:]...)
+}
+
+// Store a summary of messages of conversation id. Summaries starting at the same message
+// and covering no more are superseded by it and dropped
+func (cm ConversationModel) AddSummary(id string, s *Summary) error {
+	tx, err := cm.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for summarizing conversation '%s': %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if err := cm.checkArchived(tx, id, false); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRow(cm.Dialect.rebind(`SELECT COUNT(*) FROM messages WHERE conversation_id = ?`), id).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count messages of conversation '%s': %w", id, err)
+	}
+	if s.From < 0 || s.From >= s.To || s.To > count {
+		return fmt.Errorf("%w: it has %d messages, cannot summarize %d to %d", ErrSummaryRange, count, s.From, s.To)
+	}
+
+	if _, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM summaries WHERE conversation_id = ? AND start_sequence = ? AND end_sequence <= ?`), id, s.From, s.To); err != nil {
+		return fmt.Errorf("failed to drop superseded summaries of conversation '%s': %w", id, err)
+	}
+
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	if err := cm.insertSummary(tx, id, s); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Content encrypted when the model has a cipher, like message payloads
+func (cm ConversationModel) insertSummary(tx *sql.Tx, id string, s *Summary) error {
+	content, err := cm.Cipher.encrypt(s.Text)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO summaries (conversation_id, start_sequence, end_sequence, content, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	if _, err := tx.Exec(cm.Dialect.rebind(query), id, s.From, s.To, content, s.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert summary of conversation '%s': %w", id, err)
+	}
+	return nil
+}
+
+// Summaries of conversation id, the latest last
+func (cm ConversationModel) summaries(id string) ([]*Summary, error) {
+	rows, err := cm.DB.Query(cm.Dialect.rebind(`
+		SELECT start_sequence, end_sequence, content, created_at FROM summaries
+		WHERE conversation_id = ?
+		ORDER BY end_sequence ASC, id ASC`), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query summaries for conversation ID '%s': %w", id, err)
+	}
+	defer rows.Close()
+
+	var summaries []*Summary
+	for rows.Next() {
+		s := &Summary{}
+		if err := rows.Scan(&s.From, &s.To, &s.Text, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan summary for conversation ID '%s': %w", id, err)
+		}
+		if s.Text, err = cm.Cipher.decrypt(s.Text); err != nil {
+			return nil, fmt.Errorf("failed to read summary of conversation ID '%s': %w", id, err)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// Drop the summaries of conversation id covering messages from sequence on, once those change
+func (cm ConversationModel) dropSummariesFrom(tx *sql.Tx, id string, sequence int) error {
+	if _, err := tx.Exec(cm.Dialect.rebind(`DELETE FROM summaries WHERE conversation_id = ? AND end_sequence > ?`), id, sequence); err != nil {
+		return fmt.Errorf("failed to drop summaries of conversation '%s': %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/honganh1206/tinker/message"
+)
+
+func createSummarizedConversation(t *testing.T, cm *ConversationModel, messages int) *Conversation {
+	conv, err := NewConversation()
+	if err != nil {
+		t.Fatalf("NewConversation() failed: %v", err)
+	}
+	if err := cm.Create(conv); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	for i := range messages {
+		role := message.UserRole
+		if i%2 == 1 {
+			role = message.AssistantRole
+		}
+		conv.Append(&message.Message{Role: role, Content: []message.ContentBlock{message.NewTextBlock(fmt.Sprintf("message %d", i))}})
+	}
+	if err := cm.Save(conv); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	return conv
+}
+
+func TestConversation_History(t *testing.T) {
+	conv := &Conversation{}
+	for i := range 5 {
+		conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(fmt.Sprint(i))}})
+	}
+	if got := conv.History(); len(got) != 5 {
+		t.Errorf("History() without summaries has %d messages, want 5", len(got))
+	}
+
+	conv.Summaries = []*Summary{{From: 1, To: 4, Text: "three messages"}}
+	got := conv.History()
+	if len(got) != 3 || got[0] != conv.Messages[0] || got[2] != conv.Messages[4] {
+		t.Fatalf("History() = %+v, want the first message, the summary and the last one", got)
+	}
+	if text := got[1].Content[0].(message.TextBlock).Text; text != summaryIntro+"three messages" {
+		t.Errorf("Summary message = %q", text)
+	}
+
+	// Of a longer history rewritten since
+	conv.Summaries = []*Summary{{From: 1, To: 6, Text: "gone"}}
+	if got := conv.History(); len(got) != 5 {
+		t.Errorf("History() with a summary past the messages has %d messages, want 5", len(got))
+	}
+}
+
+func TestConversation_Summaries(t *testing.T) {
+	cm := createTestModel(t)
+	conv := createSummarizedConversation(t, cm, 6)
+
+	if err := cm.AddSummary(conv.ID, &Summary{From: 1, To: 7, Text: "too far"}); !errors.Is(err, ErrSummaryRange) {
+		t.Errorf("AddSummary() past the messages = %v, want ErrSummaryRange", err)
+	}
+	if err := cm.AddSummary("missing", &Summary{From: 1, To: 2, Text: "nothing"}); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("AddSummary() of a missing conversation = %v, want ErrConversationNotFound", err)
+	}
+
+	for _, s := range []*Summary{{From: 1, To: 3, Text: "first"}, {From: 1, To: 5, Text: "second"}} {
+		if err := cm.AddSummary(conv.ID, s); err != nil {
+			t.Fatalf("AddSummary() failed: %v", err)
+		}
+	}
+
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	// The first one is superseded
+	if len(got.Summaries) != 1 || got.Summaries[0].Text != "second" || got.Summaries[0].To != 5 {
+		t.Fatalf("Summaries = %+v, want the second one alone", got.Summaries)
+	}
+	if history := got.History(); len(history) != 3 {
+		t.Errorf("History() has %d messages, want 3", len(history))
+	}
+
+	fork, err := cm.Fork(conv.ID, 4)
+	if err != nil {
+		t.Fatalf("Fork() failed: %v", err)
+	}
+	if len(fork.Summaries) != 0 {
+		t.Errorf("Fork before the end of the summary has summaries %+v", fork.Summaries)
+	}
+	fork, err = cm.Fork(conv.ID, 6)
+	if err != nil {
+		t.Fatalf("Fork() failed: %v", err)
+	}
+	if len(fork.Summaries) != 1 {
+		t.Errorf("Fork after the summary has summaries %+v, want it", fork.Summaries)
+	}
+
+	// Rewriting messages after the summary keeps it, rewriting those it covers drops it
+	got.Messages[5].Content = []message.ContentBlock{message.NewTextBlock("rewritten")}
+	if err := cm.Save(got); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if again, _ := cm.Get(conv.ID); len(again.Summaries) != 1 {
+		t.Errorf("Summaries after rewriting a later message = %+v, want it kept", again.Summaries)
+	}
+	got.Messages[2].Content = []message.ContentBlock{message.NewTextBlock("rewritten")}
+	if err := cm.Save(got); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if again, _ := cm.Get(conv.ID); len(again.Summaries) != 0 {
+		t.Errorf("Summaries after rewriting a summarized message = %+v, want none", again.Summaries)
+	}
+
+	// Redacting a summarized message drops the summaries that may quote it
+	if err := cm.AddSummary(conv.ID, &Summary{From: 1, To: 3, Text: "message 1 and rewritten"}); err != nil {
+		t.Fatalf("AddSummary() failed: %v", err)
+	}
+	if err := cm.Redact(conv.ID, 4, -1); err != nil {
+		t.Fatalf("Redact() failed: %v", err)
+	}
+	if again, _ := cm.Get(conv.ID); len(again.Summaries) != 1 {
+		t.Errorf("Summaries after redacting a later message = %+v, want it kept", again.Summaries)
+	}
+	if err := cm.Redact(conv.ID, 2, -1); err != nil {
+		t.Fatalf("Redact() failed: %v", err)
+	}
+	if again, _ := cm.Get(conv.ID); len(again.Summaries) != 0 {
+		t.Errorf("Summaries after redacting a summarized message = %+v, want none", again.Summaries)
+	}
+}
+
+func TestConversation_SummariesEncrypted(t *testing.T) {
+	cm := createTestModel(t)
+	cm.Cipher = createTestCipher(t)
+	conv := createSummarizedConversation(t, cm, 4)
+
+	if err := cm.AddSummary(conv.ID, &Summary{From: 1, To: 3, Text: "secret plans"}); err != nil {
+		t.Fatalf("AddSummary() failed: %v", err)
+	}
+
+	var stored string
+	if err := cm.DB.QueryRow(`SELECT content FROM summaries WHERE conversation_id = ?`, conv.ID).Scan(&stored); err != nil {
+		t.Fatalf("Failed to query summary: %v", err)
+	}
+	if !isEncrypted(stored) {
+		t.Errorf("Summary stored as %q, want it encrypted", stored)
+	}
+
+	got, err := cm.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(got.Summaries) != 1 || got.Summaries[0].Text != "secret plans" {
+		t.Errorf("Summaries = %+v, want the stored one", got.Summaries)
+	}
+
+	plain := &ConversationModel{DB: cm.DB}
+	if n, err := plain.RewriteSummaries(cm.Cipher); err != nil || n != 1 {
+		t.Errorf("RewriteSummaries() to plain text = %d, %v, want 1 rewritten", n, err)
+	}
+}
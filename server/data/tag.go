@@ -0,0 +1,203 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidTag = errors.New("tags must start with a letter or digit and contain only letters, digits, '.', '_' or '-', at most 50 characters")
+
+// What a tag is attached to
+const (
+	TagConversation = "conversation"
+	TagPlan         = "plan"
+)
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,49}$`)
+
+func ValidTag(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+type TagModel struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+// Table holding the tagged resources of each kind
+func tagTable(resourceType string) (string, error) {
+	switch resourceType {
+	case TagConversation:
+		return "conversations", nil
+	case TagPlan:
+		return "plans", nil
+	default:
+		return "", fmt.Errorf("unknown tag resource type '%s'", resourceType)
+	}
+}
+
+func notFoundErr(resourceType string) error {
+	if resourceType == TagPlan {
+		return ErrPlanNotFound
+	}
+	return ErrConversationNotFound
+}
+
+// Attach a tag, tagging twice is a no-op
+func (m *TagModel) Add(resourceType, id, tag string) error {
+	if !ValidTag(tag) {
+		return ErrInvalidTag
+	}
+
+	table, err := tagTable(resourceType)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO tags (resource_type, resource_id, tag)
+	SELECT ?, id, ? FROM %s WHERE id = ?
+	ON CONFLICT (resource_type, resource_id, tag) DO NOTHING
+	`, table)
+
+	result, err := m.DB.Exec(m.Dialect.rebind(query), resourceType, tag, id)
+	if err != nil {
+		return fmt.Errorf("failed to tag %s '%s': %w", resourceType, id, err)
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		// Either already tagged or the resource doesn't exist
+		if exists, err := m.exists(table, id); err != nil {
+			return err
+		} else if !exists {
+			return notFoundErr(resourceType)
+		}
+	}
+
+	return nil
+}
+
+// Detach a tag, removing a missing tag is a no-op
+func (m *TagModel) Remove(resourceType, id, tag string) error {
+	table, err := tagTable(resourceType)
+	if err != nil {
+		return err
+	}
+
+	if exists, err := m.exists(table, id); err != nil {
+		return err
+	} else if !exists {
+		return notFoundErr(resourceType)
+	}
+
+	query := `DELETE FROM tags WHERE resource_type = ? AND resource_id = ? AND tag = ?`
+	if _, err := m.DB.Exec(m.Dialect.rebind(query), resourceType, id, tag); err != nil {
+		return fmt.Errorf("failed to untag %s '%s': %w", resourceType, id, err)
+	}
+
+	return nil
+}
+
+// Replace every tag of a resource
+func (m *TagModel) Set(resourceType, id string, tags []string) error {
+	for _, tag := range tags {
+		if !ValidTag(tag) {
+			return ErrInvalidTag
+		}
+	}
+
+	table, err := tagTable(resourceType)
+	if err != nil {
+		return err
+	}
+
+	if exists, err := m.exists(table, id); err != nil {
+		return err
+	} else if !exists {
+		return notFoundErr(resourceType)
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.Dialect.rebind(`DELETE FROM tags WHERE resource_type = ? AND resource_id = ?`), resourceType, id); err != nil {
+		return fmt.Errorf("failed to clear tags of %s '%s': %w", resourceType, id, err)
+	}
+
+	query := `
+	INSERT INTO tags (resource_type, resource_id, tag) VALUES (?, ?, ?)
+	ON CONFLICT (resource_type, resource_id, tag) DO NOTHING
+	`
+	for _, tag := range tags {
+		if _, err := tx.Exec(m.Dialect.rebind(query), resourceType, id, tag); err != nil {
+			return fmt.Errorf("failed to tag %s '%s': %w", resourceType, id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *TagModel) exists(table, id string) (bool, error) {
+	var found string
+	err := m.DB.QueryRow(m.Dialect.rebind(fmt.Sprintf("SELECT id FROM %s WHERE id = ?", table)), id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", strings.TrimSuffix(table, "s"), err)
+	}
+	return true, nil
+}
+
+// Tags of every resource of a kind, sorted by name
+func loadTags(db *sql.DB, d Dialect, resourceType string) (map[string][]string, error) {
+	rows, err := db.Query(d.rebind(`SELECT resource_id, tag FROM tags WHERE resource_type = ? ORDER BY tag`), resourceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags[id] = append(tags[id], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// SQL condition keeping the resources that carry every one of tags, along with its arguments
+func tagFilter(column, resourceType string, tags []string) (string, []any) {
+	unique := slices.Compact(slices.Sorted(slices.Values(tags)))
+
+	placeholders := make([]string, len(unique))
+	args := []any{resourceType}
+	for i, tag := range unique {
+		placeholders[i] = "?"
+		args = append(args, tag)
+	}
+	args = append(args, len(unique))
+
+	condition := fmt.Sprintf(`%s IN (
+		SELECT resource_id FROM tags
+		WHERE resource_type = ? AND tag IN (%s)
+		GROUP BY resource_id
+		HAVING COUNT(DISTINCT tag) = ?
+	)`, column, strings.Join(placeholders, ", "))
+
+	return condition, args
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	db := createTestDB(t)
+	conversations := ConversationModel{DB: db}
+	plans := PlanModel{DB: db}
+	tags := TagModel{DB: db}
+
+	var ids []string
+	for range 2 {
+		conv, err := NewConversation()
+		if err != nil {
+			t.Fatalf("NewConversation() failed: %v", err)
+		}
+		if err := conversations.Save(conv); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+		ids = append(ids, conv.ID)
+	}
+
+	for _, tag := range []string{"refactor", "bug", "refactor"} {
+		if err := tags.Add(TagConversation, ids[0], tag); err != nil {
+			t.Fatalf("Add(%q) failed: %v", tag, err)
+		}
+	}
+	if err := tags.Add(TagConversation, ids[1], "refactor"); err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+
+	list, err := conversations.List(ListFilter{Tags: []string{"refactor", "bug"}})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != ids[0] {
+		t.Fatalf("List(refactor, bug) = %+v, want only %s", list, ids[0])
+	}
+	if !reflect.DeepEqual(list[0].Tags, []string{"bug", "refactor"}) {
+		t.Errorf("Tags = %v, want [bug refactor]", list[0].Tags)
+	}
+
+	if list, _ := conversations.List(ListFilter{Tags: []string{"refactor"}}); len(list) != 2 {
+		t.Errorf("List(refactor) returned %d conversations, want 2", len(list))
+	}
+
+	if err := tags.Remove(TagConversation, ids[0], "bug"); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	conv, err := conversations.Get(ids[0])
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if !reflect.DeepEqual(conv.Tags, []string{"refactor"}) {
+		t.Errorf("Tags after Remove() = %v, want [refactor]", conv.Tags)
+	}
+
+	if err := tags.Set(TagConversation, ids[1], []string{"projectX"}); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if list, _ := conversations.List(ListFilter{Tags: []string{"projectX"}}); len(list) != 1 || list[0].ID != ids[1] {
+		t.Errorf("List(projectX) = %+v, want only %s", list, ids[1])
+	}
+
+	plan, err := NewPlan(ids[0])
+	if err != nil {
+		t.Fatalf("NewPlan() failed: %v", err)
+	}
+	if err := plans.Create(plan); err != nil {
+		t.Fatalf("Create plan failed: %v", err)
+	}
+	if err := tags.Add(TagPlan, plan.ID, "bug"); err != nil {
+		t.Fatalf("Add() to plan failed: %v", err)
+	}
+	if infos, _ := plans.List(ListFilter{Tags: []string{"bug"}}); len(infos) != 1 || infos[0].ID != plan.ID {
+		t.Errorf("Plan List(bug) = %+v, want %s", infos, plan.ID)
+	}
+	if infos, _ := plans.List(ListFilter{Tags: []string{"refactor"}}); len(infos) != 0 {
+		t.Errorf("Plan List(refactor) = %+v, want none", infos)
+	}
+
+	if err := tags.Add(TagConversation, "missing", "bug"); err != ErrConversationNotFound {
+		t.Errorf("Add() on a missing conversation: got %v, want ErrConversationNotFound", err)
+	}
+	if err := tags.Add(TagPlan, "missing", "bug"); err != ErrPlanNotFound {
+		t.Errorf("Add() on a missing plan: got %v, want ErrPlanNotFound", err)
+	}
+	for _, bad := range []string{"", "with space", "-leading", "a/b"} {
+		if err := tags.Add(TagConversation, ids[0], bad); err != ErrInvalidTag {
+			t.Errorf("Add(%q): got %v, want ErrInvalidTag", bad, err)
+		}
+	}
+
+	// Tags go away with what they are attached to
+	if err := conversations.Delete(ids[0]); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tags WHERE resource_id IN (?, ?)", ids[0], plan.ID).Scan(&count); err != nil {
+		t.Fatalf("Failed to count tags: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no tags left after delete, got %d", count)
+	}
+}
@@ -24,15 +24,15 @@ func createTestDB(t *testing.T) *sql.DB {
 
 	testDBPath := filepath.Join(tempDir, "test.db")
 
-	schemas := make([]string, 2)
-	schemas = append(schemas, ConversationSchema)
-	schemas = append(schemas, PlanSchema)
-
-	db, err := db.OpenDB(testDBPath, schemas...)
+	db, err := db.OpenDB(testDBPath)
 	if err != nil {
 		t.Fatalf("Failed to initialize test database: %v", err)
 	}
 
+	if _, err := Migrate(db, SQLite); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
 	t.Cleanup(func() {
 		db.Close()
 	})
@@ -1,10 +1,53 @@
 package data
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type ConversationMetadata struct {
 	ID                string
+	Title             string
+	Project           string
+	Provider          string
+	Model             string
+	ParentID          string
+	ArchivedAt        *time.Time
+	Tags              []string
 	LatestMessageTime time.Time
 	MessageCount      int
 	CreatedAt         time.Time
 }
+
+// Narrow down List results, zero values match everything
+type ListFilter struct {
+	// Git root the resources were created in
+	Project string
+	// Every one of these tags must be present
+	Tags []string
+	// Only archived conversations instead of only the others, ignored for plans
+	Archived bool
+}
+
+// WHERE clause of the filter for a table with the given id and project columns
+func (f ListFilter) where(idColumn, projectColumn, resourceType string) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if f.Project != "" {
+		conditions = append(conditions, projectColumn+" = ?")
+		args = append(args, f.Project)
+	}
+
+	if len(f.Tags) > 0 {
+		condition, tagArgs := tagFilter(idColumn, resourceType, f.Tags)
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
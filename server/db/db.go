@@ -5,11 +5,15 @@ import (
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 )
 
+// Open a SQLite database file, creating its directory if needed
 func OpenDB(dsn string, schemas ...string) (*sql.DB, error) {
 	dbDir := filepath.Dir(dsn)
 	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
@@ -19,7 +23,44 @@ func OpenDB(dsn string, schemas ...string) (*sql.DB, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", dsn)
+	return Open("sqlite3", sqliteDSN(dsn), schemas...)
+}
+
+// SQLite settings applied unless the DSN sets them, under any of their names.
+// WAL lets readers go on while the server writes, and writers wait for the one
+// holding the lock for up to the busy timeout rather than fail with "database is locked".
+// Transactions take the lock as they begin, since two of them upgrading from reading
+// to writing at once would fail right away, whatever the timeout.
+// Foreign keys are off by default in SQLite, on every connection they cascade like in Postgres
+var sqliteDefaults = []struct {
+	names []string
+	value string
+}{
+	{[]string{"_journal_mode", "_journal"}, "WAL"},
+	{[]string{"_busy_timeout", "_timeout"}, "10000"},
+	{[]string{"_txlock"}, "immediate"},
+	{[]string{"_foreign_keys", "_fk"}, "1"},
+}
+
+func sqliteDSN(dsn string) string {
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// The driver reports it when opening
+		return dsn
+	}
+
+	for _, d := range sqliteDefaults {
+		if !slices.ContainsFunc(d.names, query.Has) {
+			query.Set(d.names[0], d.value)
+		}
+	}
+	return path + "?" + query.Encode()
+}
+
+// Open a database with any registered driver and apply the schemas
+func Open(driver, dsn string, schemas ...string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
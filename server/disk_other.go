@@ -0,0 +1,9 @@
+//go:build !unix
+
+package server
+
+import "errors"
+
+func diskUsageOf(path string) (*diskUsage, error) {
+	return nil, errors.New("disk usage is not supported on this platform")
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+func diskUsageOf(path string) (*diskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil, err
+	}
+
+	return &diskUsage{
+		FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+		TotalBytes: stat.Blocks * uint64(stat.Bsize),
+	}, nil
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// What EncryptDatabase and DecryptDatabase rewrote
+type EncryptionReport struct {
+	Messages    int
+	Summaries   int
+	Attachments int
+	Archives    int
+}
+
+// Cipher for the database key, nil when there is no key and nothing in db is encrypted
+func databaseCipher(db *sql.DB, dialect data.Dialect) (*data.PayloadCipher, error) {
+	key, err := config.DatabaseKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the database key: %w", err)
+	}
+
+	if key == nil {
+		encrypted, err := data.ConversationModel{DB: db, Dialect: dialect}.HasEncryptedPayloads()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the database for encrypted messages: %w", err)
+		}
+		if encrypted {
+			return nil, fmt.Errorf("the database holds encrypted messages but no key was found in the keyring or %s", config.DatabaseKeyEnv)
+		}
+		return nil, nil
+	}
+
+	cipher, err := data.NewPayloadCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database key: %w", err)
+	}
+	logger.Info("messages are encrypted at rest")
+	return cipher, nil
+}
+
+// Encrypt the messages, summaries, attachments and archives of the database behind dsn, which may be
+// partly encrypted already. The key is created and stored in the OS keyring unless there is one.
+// Titles, plans and tags stay in plain text
+func EncryptDatabase(dsn string) (EncryptionReport, error) {
+	key, err := config.DatabaseKey()
+	if err != nil {
+		return EncryptionReport{}, fmt.Errorf("failed to load the database key: %w", err)
+	}
+	// Stored before anything is encrypted with it, so it is never lost
+	if key == nil {
+		if key, err = data.NewKey(); err != nil {
+			return EncryptionReport{}, err
+		}
+		if err := config.StoreDatabaseKey(key); err != nil {
+			return EncryptionReport{}, err
+		}
+	}
+
+	cipher, err := data.NewPayloadCipher(key)
+	if err != nil {
+		return EncryptionReport{}, fmt.Errorf("invalid database key: %w", err)
+	}
+	return rewriteDatabase(dsn, cipher, cipher)
+}
+
+// Turn the encryption off: decrypt the messages, summaries, attachments and archives of the database
+// behind dsn, then drop the key from the OS keyring
+func DecryptDatabase(dsn string) (EncryptionReport, error) {
+	key, err := config.DatabaseKey()
+	if err != nil {
+		return EncryptionReport{}, fmt.Errorf("failed to load the database key: %w", err)
+	}
+	if key == nil {
+		return EncryptionReport{}, fmt.Errorf("no database key in the keyring or %s", config.DatabaseKeyEnv)
+	}
+
+	cipher, err := data.NewPayloadCipher(key)
+	if err != nil {
+		return EncryptionReport{}, fmt.Errorf("invalid database key: %w", err)
+	}
+
+	report, err := rewriteDatabase(dsn, cipher, nil)
+	if err != nil {
+		return report, err
+	}
+	return report, config.DeleteDatabaseKey()
+}
+
+// Rewrite messages, summaries, attachments and archives read with from, encrypted with to or in plain text when it is nil
+func rewriteDatabase(dsn string, from, to *data.PayloadCipher) (EncryptionReport, error) {
+	var report EncryptionReport
+
+	db, dialect, err := openDatabase(dsn)
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	lock, err := lockDatabase(dsn, dialect)
+	if err != nil {
+		return report, err
+	}
+	if lock != nil {
+		defer lock.Unlock()
+	}
+
+	if _, err := data.Migrate(db, dialect); err != nil {
+		return report, err
+	}
+
+	// The server builds it again on its next start once nothing is encrypted
+	if dialect == data.SQLite {
+		if err := data.DisableSearchIndex(db); err != nil {
+			return report, err
+		}
+	}
+
+	model := data.ConversationModel{DB: db, Dialect: dialect, Cipher: to}
+	if report.Messages, err = model.RewritePayloads(from); err != nil {
+		return report, err
+	}
+	if report.Summaries, err = model.RewriteSummaries(from); err != nil {
+		return report, err
+	}
+	if report.Attachments, err = model.RewriteAttachments(from); err != nil {
+		return report, err
+	}
+
+	dir, err := archiveDir(dsn, dialect)
+	if err != nil {
+		return report, err
+	}
+	if report.Archives, err = rewriteArchives(dir, from, to); err != nil {
+		return report, err
+	}
+
+	// Free pages would still hold the text rewritten
+	if dialect == data.SQLite && to != nil {
+		if _, err := db.Exec(`VACUUM`); err != nil {
+			return report, fmt.Errorf("failed to vacuum the database: %w", err)
+		}
+	}
+
+	return report, nil
+}
+
+// Rewrite the archive files in dir the way rewriteDatabase does messages
+func rewriteArchives(dir string, from, to *data.PayloadCipher) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json.gz") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return rewritten, err
+		}
+		if bytes.HasPrefix(content, encryptedArchive) == (to != nil) {
+			continue
+		}
+
+		conv, err := readArchive(path, from)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to read archive %s: %w", path, err)
+		}
+		if err := writeArchive(path, conv, to); err != nil {
+			return rewritten, fmt.Errorf("failed to rewrite archive %s: %w", path, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
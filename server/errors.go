@@ -2,10 +2,11 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tinkererr"
 )
 
 var (
@@ -27,19 +28,50 @@ func (e *HTTPError) Error() string {
 	return e.Message
 }
 
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
 func handleError(w http.ResponseWriter, err error) {
+	// Handlers report any decoding failure as a bad request, an oversized body takes precedence
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+		return
+	}
+
 	var httpErr *HTTPError
 	if errors.As(err, &httpErr) {
 		writeError(w, httpErr.Code, httpErr.Message)
 		return
 	}
 
-	if errors.Is(err, data.ErrConversationNotFound) || errors.Is(err, data.ErrPlanNotFound) {
-		writeError(w, http.StatusNotFound, "Resource not found")
+	if errors.Is(err, data.ErrInvalidTag) || errors.Is(err, data.ErrSummaryRange) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if errors.Is(err, data.ErrArchived) {
+		writeError(w, http.StatusConflict, "Conversation is archived, unarchive it first")
+		return
+	}
+
+	if errors.Is(err, data.ErrNotArchived) {
+		writeError(w, http.StatusConflict, "Conversation is not archived")
+		return
+	}
+
+	if errors.Is(err, errRunInProgress) {
+		writeError(w, http.StatusConflict, "Conversation has a run in progress")
+		return
+	}
+
+	if errors.Is(err, data.ErrPlanVersionConflict) {
+		writeError(w, http.StatusPreconditionFailed, "Plan was modified since it was read")
 		return
 	}
 
-	if strings.Contains(err.Error(), "not found") {
+	if errors.Is(err, tinkererr.NotFound) {
 		writeError(w, http.StatusNotFound, "Resource not found")
 		return
 	}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+const (
+	ExportJSON     = "json"
+	ExportMarkdown = "markdown"
+	ExportHTML     = "html"
+)
+
+// Render the transcript of a conversation, tool calls and results included
+func exportConversation(conv *data.Conversation, format string) ([]byte, string, error) {
+	switch format {
+	case ExportJSON, "":
+		raw, err := json.MarshalIndent(conv, "", "  ")
+		return raw, "application/json", err
+	case ExportMarkdown, "md":
+		return []byte(conv.RenderMarkdown()), "text/markdown; charset=utf-8", nil
+	case ExportHTML:
+		raw, err := conv.RenderHTML()
+		return raw, "text/html; charset=utf-8", err
+	default:
+		return nil, "", fmt.Errorf("unknown export format %q, expected json, markdown or html", format)
+	}
+}
+
+func (s *server) exportConversation(w http.ResponseWriter, r *http.Request, id string) {
+	conv, err := s.models.Conversations.Get(id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	body, contentType, err := exportConversation(conv, format)
+	if err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Err:     err,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%s.%s"`, id, exportExtension(format)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func exportExtension(format string) string {
+	switch format {
+	case ExportMarkdown, "md":
+		return "md"
+	case ExportHTML:
+		return "html"
+	default:
+		return "json"
+	}
+}
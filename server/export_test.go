@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+func exportFixture() *data.Conversation {
+	return &data.Conversation{
+		ID:        "conv-1",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC),
+		Messages: []*message.Message{
+			{Role: message.UserRole, Content: []message.ContentBlock{
+				message.TextBlock{Text: "list files <please>"},
+			}},
+			{Role: message.AssistantRole, Content: []message.ContentBlock{
+				message.ToolUseBlock{ID: "t1", Name: "list_files", Input: json.RawMessage(`{"path":"."}`)},
+			}},
+			{Role: message.UserRole, Content: []message.ContentBlock{
+				message.ToolResultBlock{ToolUseID: "t1", ToolName: "list_files", Content: "```\nmain.go\n```"},
+			}},
+		},
+	}
+}
+
+func TestExportConversation_Markdown(t *testing.T) {
+	out, contentType, err := exportConversation(exportFixture(), ExportMarkdown)
+	if err != nil {
+		t.Fatalf("exportConversation() error = %v", err)
+	}
+
+	if !strings.HasPrefix(contentType, "text/markdown") {
+		t.Errorf("content type = %q", contentType)
+	}
+
+	md := string(out)
+	for _, want := range []string{
+		"# Conversation conv-1",
+		"## User",
+		"## Assistant",
+		"**Tool call** `list_files`",
+		"\"path\": \".\"",
+		// The result contains a fence, so it must be wrapped in a longer one
+		"````\n```\nmain.go\n```\n````",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestExportConversation_EditDiff(t *testing.T) {
+	conv := exportFixture()
+	conv.Messages = append(conv.Messages, &message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{
+		message.ToolUseBlock{ID: "t2", Name: "edit_file", Input: json.RawMessage(`{"path":"main.go","old_str":"a := 1\nb := 2","new_str":"a := 3"}`)},
+	}})
+
+	md, _, err := exportConversation(conv, ExportMarkdown)
+	if err != nil {
+		t.Fatalf("exportConversation() error = %v", err)
+	}
+	want := "**Tool call** `edit_file` `main.go`\n\n```diff\n--- main.go\n+++ main.go\n-a := 1\n-b := 2\n+a := 3\n```"
+	if !strings.Contains(string(md), want) {
+		t.Errorf("markdown missing edit diff:\n%s", md)
+	}
+}
+
+func TestExportConversation_UnknownFormat(t *testing.T) {
+	if _, _, err := exportConversation(exportFixture(), "pdf"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
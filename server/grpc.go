@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/server/tinkerpb"
+	"github.com/honganh1206/tinker/tinkererr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The gRPC service, backed by the same models, watchers and runs as the HTTP API
+type grpcService struct {
+	tinkerpb.UnimplementedTinkerServer
+	srv *server
+}
+
+func (s *server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorizeRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorizeRPC(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	tinkerpb.RegisterTinkerServer(g, &grpcService{srv: s})
+
+	return g
+}
+
+// Serve the gRPC service on its own TCP address, errors of the listener end up in serveErr
+func (s *server) serveGRPC(addr string, serveErr chan<- error) (*grpc.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("serving gRPC", "addr", ln.Addr().String())
+
+	g := s.newGRPCServer()
+	go func() {
+		if err := g.Serve(ln); err != nil {
+			serveErr <- err
+		}
+	}()
+
+	return g, nil
+}
+
+// Wait for open calls like Shutdown does for requests, cutting them off once ctx is done
+func stopGRPC(ctx context.Context, g *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		g.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		g.Stop()
+		return ctx.Err()
+	}
+}
+
+// Same rules as requireToken and rateLimit, with the token in the authorization metadata
+func (s *server) authorizeRPC(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var token string
+	for _, value := range md.Get("authorization") {
+		scheme, t, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(t)
+		}
+	}
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "Missing bearer token")
+	}
+	if !s.validToken(token) {
+		return status.Error(codes.Unauthenticated, "Invalid token")
+	}
+
+	if s.limiter == nil || token == s.internalToken {
+		return nil
+	}
+
+	if allowed, wait := s.limiter.allow(token); !allowed {
+		// Mirrors the Retry-After header of the HTTP API
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		return status.Error(codes.ResourceExhausted, "Rate limit exceeded, retry later")
+	}
+
+	return nil
+}
+
+// Status of err, with the codes matching what handleError answers over HTTP
+func rpcError(err error) error {
+	var httpErr *HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return status.Error(rpcCode(httpErr.Code), httpErr.Message)
+	case errors.Is(err, data.ErrInvalidTag):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, tinkererr.NotFound):
+		return status.Error(codes.NotFound, "Resource not found")
+	default:
+		return status.Error(codes.Internal, "Internal server error")
+	}
+}
+
+func rpcCode(httpCode int) codes.Code {
+	switch httpCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
+
+func (g *grpcService) CreateConversation(ctx context.Context, req *tinkerpb.CreateConversationRequest) (*tinkerpb.Conversation, error) {
+	conv, err := data.NewConversation()
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	conv.Project = req.GetProject()
+
+	if err := g.srv.models.Conversations.Create(conv); err != nil {
+		return nil, rpcError(err)
+	}
+
+	return conversationToPB(conv), nil
+}
+
+func (g *grpcService) ListConversations(ctx context.Context, req *tinkerpb.ListRequest) (*tinkerpb.ListConversationsResponse, error) {
+	filter, err := listFilterPB(req)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	conversations, err := g.srv.models.Conversations.List(filter)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	resp := &tinkerpb.ListConversationsResponse{}
+	for _, c := range conversations {
+		resp.Conversations = append(resp.Conversations, conversationSummaryToPB(c))
+	}
+
+	return resp, nil
+}
+
+func (g *grpcService) GetConversation(ctx context.Context, req *tinkerpb.GetConversationRequest) (*tinkerpb.Conversation, error) {
+	conv, err := g.srv.models.Conversations.Get(req.GetId())
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	return conversationToPB(conv), nil
+}
+
+func (g *grpcService) DeleteConversation(ctx context.Context, req *tinkerpb.DeleteConversationRequest) (*tinkerpb.DeleteConversationResponse, error) {
+	if err := g.srv.models.Conversations.Delete(req.GetId()); err != nil {
+		return nil, rpcError(err)
+	}
+	g.srv.watchers.publish(req.GetId())
+
+	return &tinkerpb.DeleteConversationResponse{}, nil
+}
+
+// Same events as the WebSocket of the HTTP API, the stream ends when the conversation is deleted
+func (g *grpcService) WatchConversation(req *tinkerpb.WatchConversationRequest, stream grpc.ServerStreamingServer[tinkerpb.WatchEvent]) error {
+	id := req.GetId()
+	if _, err := g.srv.models.Conversations.Get(id); err != nil {
+		return rpcError(err)
+	}
+
+	// Subscribe before the first snapshot, so nothing saved in between is missed
+	updates, unsubscribe := g.srv.watchers.subscribe(id)
+	defer unsubscribe()
+
+	var cursor watchCursor
+	for {
+		events, err := g.srv.watchUpdates(id, &cursor)
+		if err != nil {
+			return status.Error(codes.Internal, "Failed to load conversation")
+		}
+
+		for _, event := range events {
+			if err := stream.Send(watchEventToPB(event)); err != nil {
+				return err
+			}
+			if event.Type == api.WatchDeleted {
+				return nil
+			}
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case _, ok := <-updates:
+			if !ok {
+				return status.Error(codes.Unavailable, "Server shutting down")
+			}
+		}
+	}
+}
+
+func (g *grpcService) ListPlans(ctx context.Context, req *tinkerpb.ListRequest) (*tinkerpb.ListPlansResponse, error) {
+	filter, err := listFilterPB(req)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	plans, err := g.srv.models.Plans.List(filter)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	resp := &tinkerpb.ListPlansResponse{}
+	for _, p := range plans {
+		resp.Plans = append(resp.Plans, planInfoToPB(p))
+	}
+
+	return resp, nil
+}
+
+func (g *grpcService) GetPlan(ctx context.Context, req *tinkerpb.GetPlanRequest) (*tinkerpb.Plan, error) {
+	p, err := g.srv.models.Plans.Get(req.GetId())
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	return planToPB(p), nil
+}
+
+// Same run as POST /conversations/{id}/run, a failed run ends the stream with an error status
+func (g *grpcService) Run(req *tinkerpb.RunRequest, stream grpc.ServerStreamingServer[tinkerpb.RunEvent]) error {
+	if strings.TrimSpace(req.GetPrompt()) == "" {
+		return status.Error(codes.InvalidArgument, "Prompt is required")
+	}
+
+	convID := req.GetConversationId()
+	conv, err := g.srv.models.Conversations.Get(convID)
+	if err != nil {
+		return rpcError(err)
+	}
+
+	if !g.srv.startRun(convID) {
+		return status.Error(codes.FailedPrecondition, "Conversation already has a run in progress")
+	}
+	defer g.srv.finishRun(convID)
+
+	ctx, done := g.srv.agentRunContext(stream.Context())
+	defer done()
+	a, err := g.srv.newRunAgent(ctx, conv, runRequest{
+		Prompt:    req.GetPrompt(),
+		Provider:  req.GetProvider(),
+		Model:     req.GetModel(),
+		MaxTokens: req.GetMaxTokens(),
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// A stream does not support concurrent sends
+	var sendMu sync.Mutex
+	a.OnEvent = func(e agent.Event) {
+		if event := runEventToPB(e); event != nil {
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			stream.Send(event)
+		}
+	}
+
+	onDelta := func(delta string) {
+		a.OnEvent(agent.Event{Type: agent.EventText, Text: delta})
+	}
+
+	if err := a.Run(ctx, req.GetPrompt(), onDelta); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return stream.Send(&tinkerpb.RunEvent{Event: &tinkerpb.RunEvent_Done{Done: &tinkerpb.RunDone{ConversationId: conv.ID}}})
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/server/tinkerpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Conversions between the models and their protobuf counterparts
+
+func listFilterPB(req *tinkerpb.ListRequest) (data.ListFilter, error) {
+	return validFilter(data.ListFilter{Project: req.GetProject(), Tags: req.GetTags()})
+}
+
+// Unset instead of the year 1 for missing times
+func timestampPB(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func conversationToPB(conv *data.Conversation) *tinkerpb.Conversation {
+	return &tinkerpb.Conversation{
+		Id:        conv.ID,
+		Title:     conv.Title,
+		Project:   conv.Project,
+		Tags:      conv.Tags,
+		Messages:  messagesToPB(conv.Messages),
+		CreatedAt: timestampPB(conv.CreatedAt),
+	}
+}
+
+func conversationSummaryToPB(c data.ConversationMetadata) *tinkerpb.ConversationSummary {
+	return &tinkerpb.ConversationSummary{
+		Id:                c.ID,
+		Title:             c.Title,
+		Project:           c.Project,
+		Tags:              c.Tags,
+		MessageCount:      int32(c.MessageCount),
+		LatestMessageTime: timestampPB(c.LatestMessageTime),
+		CreatedAt:         timestampPB(c.CreatedAt),
+	}
+}
+
+func messagesToPB(msgs []*message.Message) []*tinkerpb.Message {
+	out := make([]*tinkerpb.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		out = append(out, messageToPB(msg))
+	}
+	return out
+}
+
+func messageToPB(msg *message.Message) *tinkerpb.Message {
+	out := &tinkerpb.Message{
+		Id:        msg.ID,
+		Role:      msg.Role,
+		CreatedAt: timestampPB(msg.CreatedAt),
+	}
+
+	for _, block := range msg.Content {
+		var pb tinkerpb.ContentBlock
+		switch b := block.(type) {
+		case message.TextBlock:
+			pb.Block = &tinkerpb.ContentBlock_Text{Text: &tinkerpb.TextBlock{Text: b.Text}}
+		case message.ToolUseBlock:
+			pb.Block = &tinkerpb.ContentBlock_ToolUse{ToolUse: &tinkerpb.ToolUseBlock{Id: b.ID, Name: b.Name, Input: b.Input, Thought: b.Thought}}
+		case message.ToolResultBlock:
+			pb.Block = &tinkerpb.ContentBlock_ToolResult{ToolResult: &tinkerpb.ToolResultBlock{ToolUseId: b.ToolUseID, ToolName: b.ToolName, Content: b.Content, IsError: b.IsError}}
+		case message.ThoughtBlock:
+			pb.Block = &tinkerpb.ContentBlock_Thought{Thought: &tinkerpb.ThoughtBlock{Thought: b.Thought}}
+		case message.ImageBlock:
+			data, err := base64.StdEncoding.DecodeString(b.Data)
+			if err != nil {
+				continue
+			}
+			pb.Block = &tinkerpb.ContentBlock_Image{Image: &tinkerpb.ImageBlock{MediaType: b.MediaType, Data: data, Name: b.Name}}
+		case message.CitationBlock:
+			pb.Block = &tinkerpb.ContentBlock_Citation{Citation: &tinkerpb.CitationBlock{Source: b.Source, StartLine: int32(b.StartLine), EndLine: int32(b.EndLine), Quote: b.Quote}}
+		default:
+			continue
+		}
+		out.Content = append(out.Content, &pb)
+	}
+
+	return out
+}
+
+func planToPB(p *data.Plan) *tinkerpb.Plan {
+	out := &tinkerpb.Plan{
+		Id:             p.ID,
+		ConversationId: p.ConversationID,
+		Project:        p.Project,
+		Version:        int32(p.Version),
+	}
+
+	for _, step := range p.Steps {
+		out.Steps = append(out.Steps, &tinkerpb.Step{
+			Id:          step.ID,
+			Description: step.Description,
+			Status:      step.Status,
+			Acceptance:  step.Acceptance,
+		})
+	}
+
+	return out
+}
+
+func planInfoToPB(p data.PlanInfo) *tinkerpb.PlanSummary {
+	return &tinkerpb.PlanSummary{
+		Id:             p.ID,
+		ConversationId: p.ConversationID,
+		Project:        p.Project,
+		Tags:           p.Tags,
+		Status:         p.Status,
+		TotalTasks:     int32(p.TotalTasks),
+		CompletedTasks: int32(p.CompletedTasks),
+	}
+}
+
+func watchEventToPB(e api.WatchEvent) *tinkerpb.WatchEvent {
+	switch e.Type {
+	case api.WatchMessages:
+		return &tinkerpb.WatchEvent{Event: &tinkerpb.WatchEvent_Messages{Messages: &tinkerpb.MessagesAdded{
+			From:     int32(e.From),
+			Messages: messagesToPB(e.Messages),
+		}}}
+	case api.WatchPlan:
+		return &tinkerpb.WatchEvent{Event: &tinkerpb.WatchEvent_Plan{Plan: planToPB(e.Plan)}}
+	default:
+		return &tinkerpb.WatchEvent{Event: &tinkerpb.WatchEvent_Deleted{Deleted: &tinkerpb.ConversationDeleted{}}}
+	}
+}
+
+// Nil for events the protocol has no message for
+func runEventToPB(e agent.Event) *tinkerpb.RunEvent {
+	switch e.Type {
+	case agent.EventText:
+		return &tinkerpb.RunEvent{Event: &tinkerpb.RunEvent_Text{Text: &tinkerpb.TextDelta{Text: e.Text}}}
+	case agent.EventToolCall:
+		return &tinkerpb.RunEvent{Event: &tinkerpb.RunEvent_ToolCall{ToolCall: &tinkerpb.ToolCall{
+			ToolUseId: e.ToolUseID,
+			Tool:      e.Tool,
+			Input:     e.Input,
+		}}}
+	case agent.EventToolResult:
+		return &tinkerpb.RunEvent{Event: &tinkerpb.RunEvent_ToolResult{ToolResult: &tinkerpb.ToolResult{
+			ToolUseId: e.ToolUseID,
+			Tool:      e.Tool,
+			Output:    e.Output,
+			IsError:   e.IsError,
+		}}}
+	case agent.EventUsage:
+		if e.Usage == nil {
+			return nil
+		}
+		return &tinkerpb.RunEvent{Event: &tinkerpb.RunEvent_Usage{Usage: &tinkerpb.Usage{
+			InputTokens:  e.Usage.InputTokens,
+			OutputTokens: e.Usage.OutputTokens,
+		}}}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/tinkerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPC(t *testing.T) {
+	srv := newTestServer(t)
+	token, err := srv.models.APITokens.Create()
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	ln := bufconn.Listen(1 << 20)
+	g := srv.newGRPCServer()
+	go g.Serve(ln)
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := tinkerpb.NewTinkerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.ListConversations(ctx, &tinkerpb.ListRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Call without a token = %v, want Unauthenticated", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	created, err := client.CreateConversation(ctx, &tinkerpb.CreateConversationRequest{Project: "/src/tinker"})
+	if err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+
+	list, err := client.ListConversations(ctx, &tinkerpb.ListRequest{Project: "/src/tinker"})
+	if err != nil {
+		t.Fatalf("ListConversations failed: %v", err)
+	}
+	if len(list.Conversations) != 1 || list.Conversations[0].Id != created.Id {
+		t.Fatalf("ListConversations = %v, want the created conversation", list.Conversations)
+	}
+
+	if _, err := client.GetConversation(ctx, &tinkerpb.GetConversationRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetConversation of a missing id = %v, want NotFound", err)
+	}
+
+	conv, err := srv.models.Conversations.Get(created.Id)
+	if err != nil {
+		t.Fatalf("Failed to load conversation: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("hello")}})
+	if err := srv.models.Conversations.Save(conv); err != nil {
+		t.Fatalf("Failed to save conversation: %v", err)
+	}
+
+	stream, err := client.WatchConversation(ctx, &tinkerpb.WatchConversationRequest{Id: created.Id})
+	if err != nil {
+		t.Fatalf("WatchConversation failed: %v", err)
+	}
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive the history: %v", err)
+	}
+	added := event.GetMessages()
+	if added == nil || len(added.Messages) != 1 || added.Messages[0].Content[0].GetText().GetText() != "hello" {
+		t.Fatalf("First event = %v, want the history of one message", event)
+	}
+
+	if _, err := client.DeleteConversation(ctx, &tinkerpb.DeleteConversationRequest{Id: created.Id}); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+
+	event, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive the deletion: %v", err)
+	}
+	if event.GetDeleted() == nil {
+		t.Fatalf("Event after delete = %v, want deleted", event)
+	}
+}
+
+func TestMessageToPB_Citation(t *testing.T) {
+	msg := &message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{
+		message.NewTextBlock("The loop ends here"),
+		message.NewCitationBlock("agent/agent.go", 12, 20, "for {"),
+	}}
+
+	pb := messageToPB(msg)
+	if len(pb.Content) != 2 {
+		t.Fatalf("Content = %v, want the text and the citation", pb.Content)
+	}
+	citation := pb.Content[1].GetCitation()
+	if citation.GetSource() != "agent/agent.go" || citation.GetStartLine() != 12 || citation.GetEndLine() != 20 || citation.GetQuote() != "for {" {
+		t.Errorf("Citation = %v, want agent/agent.go:12-20", citation)
+	}
+}
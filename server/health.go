@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// Reported by /health, the CLI fills them in from its build flags
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+)
+
+type healthReport struct {
+	// ok, or degraded when a dependency is unavailable
+	Status        string         `json:"status"`
+	Version       string         `json:"version"`
+	Commit        string         `json:"commit"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	Database      databaseHealth `json:"database"`
+	// Only for SQLite, Postgres keeps its data elsewhere
+	Disk       *diskUsage `json:"disk,omitempty"`
+	ActiveRuns int        `json:"active_runs"`
+}
+
+type databaseHealth struct {
+	Status  string `json:"status"`
+	Dialect string `json:"dialect"`
+	// Latest applied migration, behind LatestSchemaVersion until 'tinker db migrate' runs
+	SchemaVersion       int    `json:"schema_version"`
+	LatestSchemaVersion int    `json:"latest_schema_version"`
+	Error               string `json:"error,omitempty"`
+}
+
+type diskUsage struct {
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+func (s *server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{
+		Status:        "ok",
+		Version:       Version,
+		Commit:        GitCommit,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		Database:      s.databaseHealth(r.Context()),
+		ActiveRuns:    s.activeRuns(),
+	}
+
+	if s.dataDir != "" {
+		if usage, err := diskUsageOf(s.dataDir); err == nil {
+			report.Disk = usage
+		}
+	}
+
+	status := http.StatusOK
+	if report.Database.Status != "ok" {
+		report.Status = "degraded"
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
+
+func (s *server) databaseHealth(ctx context.Context) databaseHealth {
+	health := databaseHealth{Status: "ok", Dialect: s.dialect.String()}
+
+	if migrations, err := s.dialect.Migrations(); err == nil && len(migrations) > 0 {
+		health.LatestSchemaVersion = migrations[len(migrations)-1].Version
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if err := s.db.PingContext(ctx); err != nil {
+		health.Status = "unavailable"
+		health.Error = err.Error()
+		return health
+	}
+
+	version, err := data.SchemaVersion(s.db)
+	if err != nil {
+		health.Status = "unavailable"
+		health.Error = err.Error()
+		return health
+	}
+	health.SchemaVersion = version
+
+	return health
+}
+
+func (s *server) activeRuns() int {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	return len(s.runs)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Buckets untouched for this long are full again and can be forgotten
+const bucketIdleTimeout = 10 * time.Minute
+
+// Token bucket per API token, refilled continuously at the configured rate.
+// A full minute of requests can be spent at once before the limit kicks in
+type rateLimiter struct {
+	mu sync.Mutex
+	// Tokens added per second
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take a token from the bucket of key, or report how long until one is available
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Throttle each API token separately. Runs after requireToken, so the token is already valid.
+// The server's own token is exempt, agent runs persist through it
+func (s *server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := requestToken(r)
+		if !ok || token == s.internalToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := s.limiter.allow(token)
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded, retry later")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reject bodies over maxBodySize. Declared lengths are refused upfront,
+// chunked bodies fail while being read and surface through handleError
+func (s *server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > s.maxBodySize {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", s.maxBodySize))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(60)
+	l.now = func() time.Time { return now }
+
+	for i := range 60 {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("Request %d rejected within the burst", i)
+		}
+	}
+
+	ok, wait := l.allow("a")
+	if ok {
+		t.Fatal("Request allowed after the burst was spent")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Retry after %s, want within a second at one request per second", wait)
+	}
+
+	// Each token has its own bucket
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("Another token was throttled")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("Bucket did not refill after a second")
+	}
+
+	now = now.Add(bucketIdleTimeout)
+	l.allow("c")
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("Idle bucket was not swept")
+	}
+}
+
+func TestHandler_Limits(t *testing.T) {
+	srv := newTestServer(t)
+	srv.maxBodySize = 64
+	srv.limiter = newRateLimiter(2)
+
+	token, err := srv.models.APITokens.Create()
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	handler := srv.handler()
+
+	do := func(body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/conversations/missing", strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	big := `{"title":"` + strings.Repeat("x", 100) + `"}`
+	if rec := do(big, false); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Oversized body = %d, want 413", rec.Code)
+	}
+	if rec := do(big, true); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Oversized chunked body = %d, want 413: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do("{}", false)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Third request in the burst of 2 = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Missing Retry-After header")
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// Hand-maintained description of the REST API.
+// openapi_test.go checks it against both the routes and api.Client
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func (s *server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/server/db"
+)
+
+type openAPIDoc struct {
+	OpenAPI string                                `json:"openapi"`
+	Paths   map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+type operation struct {
+	method string
+	path   string
+}
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi version = %q, want 3.x", doc.OpenAPI)
+	}
+
+	return doc
+}
+
+func (d openAPIDoc) operations() []operation {
+	var ops []operation
+	for path, item := range d.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			ops = append(ops, operation{method: strings.ToUpper(method), path: path})
+		}
+	}
+	return ops
+}
+
+// Find the documented operation serving a concrete request path
+func (d openAPIDoc) match(method, path string) (operation, bool) {
+	// Literal paths win over templated ones, e.g., /conversations/search
+	if _, ok := d.Paths[path][strings.ToLower(method)]; ok {
+		return operation{method: method, path: path}, true
+	}
+
+	segments := strings.Split(path, "/")
+	for template, item := range d.Paths {
+		if _, ok := item[strings.ToLower(method)]; !ok {
+			continue
+		}
+
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+
+		matched := true
+		for i, part := range parts {
+			if !strings.HasPrefix(part, "{") && part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return operation{method: method, path: template}, true
+		}
+	}
+
+	return operation{}, false
+}
+
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+
+	conn, err := db.OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, err := data.Migrate(conn, data.SQLite); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	dataDir := t.TempDir()
+	return &server{
+		db:         conn,
+		dialect:    data.SQLite,
+		models:     data.NewModels(conn, data.SQLite),
+		dataDir:    dataDir,
+		archiveDir: filepath.Join(dataDir, "archive"),
+		startedAt:  time.Now(),
+		runs:       make(map[string]bool),
+		watchers:   newWatchHub(),
+	}
+}
+
+func TestOpenAPI_EveryOperationIsRouted(t *testing.T) {
+	doc := loadSpec(t)
+	routes := newTestServer(t).routes()
+
+	for _, op := range doc.operations() {
+		path := strings.NewReplacer("{id}", "missing", "{key}", "missing", "{stepID}", "missing", "{tag}", "bug").Replace(op.path)
+		req := httptest.NewRequest(op.method, path, strings.NewReader("{}"))
+		rec := httptest.NewRecorder()
+
+		routes.ServeHTTP(rec, req)
+
+		if rec.Code == http.StatusMethodNotAllowed {
+			t.Errorf("%s %s is documented but the server does not allow the method", op.method, op.path)
+		}
+		// Handlers answer 404 in JSON, a plain text one comes from the mux
+		if rec.Code == http.StatusNotFound && !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("%s %s is documented but not routed", op.method, op.path)
+		}
+	}
+}
+
+func TestOpenAPI_RefsResolve(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	for _, ref := range regexp.MustCompile(`"\$ref": "#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(openAPISpec), -1) {
+		if _, ok := doc.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("schema %s is referenced but not defined", ref[1])
+		}
+	}
+}
+
+func TestOpenAPI_ClientMatchesSpec(t *testing.T) {
+	doc := loadSpec(t)
+	srv := newTestServer(t)
+
+	var mu sync.Mutex
+	called := make(map[operation]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, ok := doc.match(r.Method, r.URL.Path)
+		if !ok {
+			t.Errorf("client calls %s %s, which openapi.json does not document", r.Method, r.URL.Path)
+		}
+
+		mu.Lock()
+		called[op] = true
+		mu.Unlock()
+
+		srv.routes().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+
+	// Errors don't matter here, only which routes get hit
+	calls := map[string]func(){
+		"CreateConversation": func() { client.CreateConversation("/src/tinker") },
+		"ListConversations":  func() { client.ListConversations(data.ListFilter{Project: "/src/tinker", Tags: []string{"bug"}}) },
+		"Tag": func() {
+			client.Tag(data.TagConversation, "missing", "bug")
+			client.Tag(data.TagPlan, "missing", "bug")
+		},
+		"Untag": func() {
+			client.Untag(data.TagConversation, "missing", "bug")
+			client.Untag(data.TagPlan, "missing", "bug")
+		},
+		"GetConversation":         func() { client.GetConversation("missing") },
+		"GetConversationWithPlan": func() { client.GetConversationWithPlan("missing") },
+		"SaveConversation":        func() { client.SaveConversation(&data.Conversation{ID: "saved"}) },
+		"ReplaceConversation":     func() { client.ReplaceConversation(&data.Conversation{ID: "replaced"}) },
+		"SearchConversations":     func() { client.SearchConversations("hello", 5) },
+		"RenameConversation":      func() { client.RenameConversation("missing", "Title") },
+		"ForkConversation":        func() { client.ForkConversation("missing", 1) },
+		"RedactMessage":           func() { client.RedactMessage("missing", 0, -1) },
+		"AddSummary":              func() { client.AddSummary("missing", &data.Summary{From: 1, To: 2, Text: "summary"}) },
+		"ArchiveConversation":     func() { client.ArchiveConversation("missing") },
+		"UnarchiveConversation":   func() { client.UnarchiveConversation("missing") },
+		"DeleteConversation":      func() { client.DeleteConversation("missing") },
+		"ExportConversation":      func() { client.ExportConversation("missing", "markdown") },
+		"GetLatestConversationID": func() { client.GetLatestConversationID("") },
+		"RunConversation": func() {
+			client.RunConversation(context.Background(), "missing", api.RunRequest{Prompt: "hi"}, func(api.RunEvent) {})
+		},
+		"WatchConversation": func() {
+			client.WatchConversation(context.Background(), "missing", func(api.WatchEvent) {})
+		},
+		"CreatePlan":       func() { client.CreatePlan("saved") },
+		"ListPlans":        func() { client.ListPlans(data.ListFilter{Tags: []string{"bug"}}) },
+		"GetPlan":          func() { client.GetPlan("missing") },
+		"SavePlan":         func() { client.SavePlan(&data.Plan{ID: "missing"}) },
+		"DeletePlan":       func() { client.DeletePlan("missing") },
+		"PlanHistory":      func() { client.PlanHistory("missing") },
+		"RevertPlan":       func() { client.RevertPlan("missing", 1) },
+		"UpdateStep":       func() { client.UpdateStep("missing", "step", data.StepPatch{}, 1) },
+		"DeletePlans":      func() { client.DeletePlans([]string{"missing"}) },
+		"GetMCPToolCache":  func() { client.GetMCPToolCache("missing") },
+		"SaveMCPToolCache": func() { client.SaveMCPToolCache(&data.MCPToolCache{Key: "key", Tools: json.RawMessage(`[]`)}) },
+		"Health":           func() { client.Health(context.Background()) },
+		"Stats":            func() { client.Stats(time.Now().Add(-time.Hour), "/src/tinker") },
+	}
+
+	// A new client method has to be listed above, which checks its route against the spec
+	clientType := reflect.TypeOf(client)
+	for i := range clientType.NumMethod() {
+		name := clientType.Method(i).Name
+		if _, ok := calls[name]; !ok && name != "SetToken" {
+			t.Errorf("api.Client.%s is not covered by the OpenAPI check", name)
+		}
+	}
+
+	for _, call := range calls {
+		call()
+	}
+
+	// Everything documented should be reachable through the client
+	serverOnly := []operation{
+		{method: http.MethodGet, path: "/openapi.json"},
+	}
+	for _, op := range doc.operations() {
+		if !called[op] && !slices.Contains(serverOnly, op) {
+			t.Errorf("%s %s is documented but api.Client never calls it", op.method, op.path)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// Author of a plan change from the ?author= parameter, fallback when it is absent
+func planAuthor(r *http.Request, fallback string) (string, bool) {
+	switch author := r.URL.Query().Get("author"); author {
+	case "":
+		return fallback, true
+	case data.AuthorAgent, data.AuthorUser:
+		return author, true
+	default:
+		return "", false
+	}
+}
+
+func (s *server) planHistory(w http.ResponseWriter, r *http.Request, planID string) {
+	revisions, err := s.models.Plans.History(planID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, revisions)
+}
+
+func (s *server) revertPlan(w http.ResponseWriter, r *http.Request, planID string) {
+	var req struct {
+		Revision int `json:"revision"`
+	}
+
+	if err := decodeJSON(r, &req); err != nil || req.Revision <= 0 {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "A positive revision is required",
+			Err:     err,
+		})
+		return
+	}
+
+	// Reverts are requested by people, the agent just writes a new plan
+	author, ok := planAuthor(r, data.AuthorUser)
+	if !ok {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Author must be agent or user",
+			Err:     nil,
+		})
+		return
+	}
+
+	plan, err := s.models.Plans.Revert(planID, req.Revision, author)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	s.watchers.publish(plan.ConversationID)
+
+	setPlanETag(w, plan)
+	writeJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// The plan version doubles as its ETag
+func setPlanETag(w http.ResponseWriter, p *data.Plan) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, p.Version))
+}
+
+// Version expected by an If-Match header, 0 when the client didn't send one
+func ifMatchVersion(r *http.Request) (int, error) {
+	raw := r.Header.Get("If-Match")
+	if raw == "" || raw == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(raw, "W/"), `"`))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid If-Match header %q", raw)
+	}
+
+	return version, nil
+}
+
+func (s *server) patchStep(w http.ResponseWriter, r *http.Request, planID, stepID string) {
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Err:     err,
+		})
+		return
+	}
+
+	var patch data.StepPatch
+	if err := decodeJSON(r, &patch); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid step patch format",
+			Err:     err,
+		})
+		return
+	}
+
+	if patch.Status != nil {
+		if status := strings.ToUpper(*patch.Status); status != "TODO" && status != "DONE" {
+			handleError(w, &HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: "Status must be TODO or DONE",
+				Err:     nil,
+			})
+			return
+		}
+	}
+
+	author, ok := planAuthor(r, data.AuthorUser)
+	if !ok {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Author must be agent or user",
+			Err:     nil,
+		})
+		return
+	}
+
+	plan, err := s.models.Plans.UpdateStep(planID, stepID, patch, version, author)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	s.watchers.publish(plan.ConversationID)
+
+	setPlanETag(w, plan)
+	writeJSON(w, http.StatusOK, plan)
+}
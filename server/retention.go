@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// How often the retention policy is applied while the server runs
+const retentionInterval = time.Hour
+
+// Apply policy now, then every retentionInterval until ctx is done
+func (s *server) enforceRetention(ctx context.Context, policy config.Retention) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.applyRetention(time.Now(), policy); err != nil {
+			logger.Warn("failed to apply the retention policy", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Delete, then archive, the conversations whose latest message is older than policy allows.
+// Conversations with a run in progress are left for the next time
+func (s *server) applyRetention(now time.Time, policy config.Retention) error {
+	if policy.DeleteAfter > 0 {
+		cutoff := now.Add(-time.Duration(policy.DeleteAfter))
+		for _, archived := range []bool{false, true} {
+			convs, err := s.models.Conversations.List(data.ListFilter{Archived: archived})
+			if err != nil {
+				return err
+			}
+
+			for _, conv := range convs {
+				if !conv.LatestMessageTime.Before(cutoff) || !s.startRun(conv.ID) {
+					continue
+				}
+				err := s.models.Conversations.Delete(conv.ID)
+				s.finishRun(conv.ID)
+				if err != nil {
+					logger.Warn("failed to delete conversation past retention", "conversation", conv.ID, "err", err)
+					continue
+				}
+				s.removeArchive(conv.ID)
+				s.watchers.publish(conv.ID)
+				logger.Info("deleted conversation past retention", "conversation", conv.ID)
+			}
+		}
+	}
+
+	if policy.ArchiveAfter > 0 {
+		cutoff := now.Add(-time.Duration(policy.ArchiveAfter))
+		convs, err := s.models.Conversations.List(data.ListFilter{})
+		if err != nil {
+			return err
+		}
+
+		for _, conv := range convs {
+			if !conv.LatestMessageTime.Before(cutoff) {
+				continue
+			}
+			if err := s.archive(conv.ID); err != nil {
+				if !errors.Is(err, errRunInProgress) {
+					logger.Warn("failed to archive conversation past retention", "conversation", conv.ID, "err", err)
+				}
+				continue
+			}
+			logger.Info("archived conversation past retention", "conversation", conv.ID)
+		}
+	}
+
+	return nil
+}
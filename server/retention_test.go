@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+func TestApplyRetention(t *testing.T) {
+	srv := newTestServer(t)
+	now := time.Now()
+	day := 24 * time.Hour
+
+	save := func(id string, lastMessage time.Time) {
+		conv := &data.Conversation{ID: id, CreatedAt: lastMessage, Messages: []*message.Message{
+			{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("hi")}, CreatedAt: lastMessage},
+		}}
+		if err := srv.models.Conversations.Save(conv); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+	}
+	save("recent", now.Add(-day))
+	save("stale", now.Add(-100*day))
+	save("ancient", now.Add(-400*day))
+	save("running", now.Add(-100*day))
+	srv.runs["running"] = true
+
+	policy := config.Retention{ArchiveAfter: config.Age(90 * day), DeleteAfter: config.Age(365 * day)}
+	if err := srv.applyRetention(now, policy); err != nil {
+		t.Fatalf("applyRetention() failed: %v", err)
+	}
+
+	if _, err := srv.models.Conversations.Get("recent"); err != nil {
+		t.Errorf("Get() of the recent conversation = %v, want it left alone", err)
+	}
+	if _, err := srv.models.Conversations.Get("stale"); !errors.Is(err, data.ErrArchived) {
+		t.Errorf("Get() of the stale conversation = %v, want ErrArchived", err)
+	}
+	if _, err := srv.models.Conversations.Get("ancient"); !errors.Is(err, data.ErrConversationNotFound) {
+		t.Errorf("Get() of the ancient conversation = %v, want it deleted", err)
+	}
+	if _, err := srv.models.Conversations.Get("running"); err != nil {
+		t.Errorf("Get() of the running conversation = %v, want it left for later", err)
+	}
+
+	// Archived conversations are deleted in turn once they are old enough
+	if err := srv.applyRetention(now.Add(300*day), policy); err != nil {
+		t.Fatalf("applyRetention() failed: %v", err)
+	}
+	if _, err := srv.models.Conversations.Get("stale"); !errors.Is(err, data.ErrConversationNotFound) {
+		t.Errorf("Get() of the stale conversation = %v, want it deleted", err)
+	}
+	if _, err := os.Stat(srv.archivePath("stale")); !os.IsNotExist(err) {
+		t.Errorf("Archive file left after deleting: %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/honganh1206/tinker/agent"
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+	"github.com/honganh1206/tinker/tools"
+)
+
+const defaultRunMaxTokens = 8192
+
+type runRequest struct {
+	Prompt    string `json:"prompt"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	MaxTokens int64  `json:"max_tokens"`
+}
+
+// Events written by the server itself, on top of the ones coming from the agent
+const (
+	eventDone  = "done"
+	eventError = "error"
+)
+
+// sseWriter writes server-sent events and flushes each one immediately
+type sseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+func (s *sseWriter) send(event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+
+	return nil
+}
+
+// Claim a conversation for a run, so two runs never interleave their messages
+func (s *server) startRun(id string) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if s.runs[id] {
+		return false
+	}
+	s.runs[id] = true
+
+	return true
+}
+
+func (s *server) finishRun(id string) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	delete(s.runs, id)
+}
+
+// Context of an agent run, cut off when the server shuts down as well as when parent is.
+// done must be called once the run returns, shutting down waits for it
+func (s *server) agentRunContext(parent context.Context) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(parent)
+	s.agentRuns.Add(1)
+	go func() {
+		select {
+		case <-s.draining:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		s.agentRuns.Done()
+	}
+}
+
+// Cut off the agent runs in progress and wait for them to save their conversations.
+// False when ctx is done first
+func (s *server) stopAgentRuns(ctx context.Context) bool {
+	if s.draining != nil {
+		close(s.draining)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.agentRuns.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run the agent on a conversation and stream what it does as server-sent events.
+// The run stops when the client disconnects or the server shuts down.
+// MCP servers are not started for server-side runs, only the built-in tools are available
+func (s *server) runConversation(w http.ResponseWriter, r *http.Request, convID string) {
+	var req runRequest
+	if err := decodeJSON(r, &req); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid run request format",
+			Err:     err,
+		})
+		return
+	}
+
+	if strings.TrimSpace(req.Prompt) == "" {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Prompt is required",
+			Err:     nil,
+		})
+		return
+	}
+
+	conv, err := s.models.Conversations.Get(convID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if !s.startRun(convID) {
+		handleError(w, &HTTPError{
+			Code:    http.StatusConflict,
+			Message: "Conversation already has a run in progress",
+			Err:     nil,
+		})
+		return
+	}
+	defer s.finishRun(convID)
+
+	ctx, done := s.agentRunContext(r.Context())
+	defer done()
+
+	a, err := s.newRunAgent(ctx, conv, req)
+	if err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Err:     err,
+		})
+		return
+	}
+
+	stream, ok := newSSEWriter(w)
+	if !ok {
+		handleError(w, &HTTPError{
+			Code:    http.StatusInternalServerError,
+			Message: "Streaming not supported",
+			Err:     nil,
+		})
+		return
+	}
+
+	a.OnEvent = func(e agent.Event) {
+		stream.send(string(e.Type), e)
+	}
+
+	onDelta := func(delta string) {
+		a.OnEvent(agent.Event{Type: agent.EventText, Text: delta})
+	}
+
+	if err := a.Run(ctx, req.Prompt, onDelta); err != nil {
+		stream.send(eventError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	stream.send(eventDone, map[string]string{"conversation_id": conv.ID})
+}
+
+// Agent running on conv with the models of req, errors come from invalid provider settings
+func (s *server) newRunAgent(ctx context.Context, conv *data.Conversation, req runRequest) (*agent.Agent, error) {
+	llmCfg, subCfg := runLLMConfigs(req)
+	llm, err := inference.Init(ctx, llmCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	subllm, err := inference.Init(ctx, subCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// A plan is optional, the agent creates one when it needs it
+	plan, _ := s.models.Plans.Get(conv.ID)
+
+	// Persist through our own API, like any other frontend does
+	client := api.NewClient(s.baseURL())
+	client.SetToken(s.internalToken)
+
+	a := agent.New(&agent.Config{
+		LLM:          llm,
+		Conversation: conv,
+		ToolBox:      runToolBox(),
+		Client:       client,
+		Plan:         plan,
+		Streaming:    true,
+	})
+	a.Sub, err = agent.NewSubagent(&agent.Config{
+		LLM:       subllm,
+		ToolBox:   runSubToolBox(),
+		Streaming: false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func runLLMConfigs(req runRequest) (inference.BaseLLMClient, inference.BaseLLMClient) {
+	provider := req.Provider
+	if provider == "" {
+		provider = string(inference.GoogleProvider)
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultRunMaxTokens
+	}
+
+	llm := inference.BaseLLMClient{Provider: provider, Model: req.Model, TokenLimit: maxTokens}
+	sub := inference.BaseLLMClient{Provider: provider, TokenLimit: maxTokens}
+
+	sub.Model = string(inference.GetDefaultModelSubagent(inference.ProviderName(provider)))
+	if llm.Model == "" {
+		llm.Model = string(inference.GetDefaultModel(inference.ProviderName(provider)))
+	}
+
+	return llm, sub
+}
+
+func runToolBox() *tools.ToolBox {
+	return &tools.ToolBox{
+		Tools: []*tools.ToolDefinition{
+			&tools.ReadFileDefinition,
+			&tools.ListFilesDefinition,
+			&tools.EditFileDefinition,
+			&tools.GrepSearchDefinition,
+			&tools.FinderDefinition,
+			&tools.BashDefinition,
+			&tools.PlanWriteDefinition,
+			&tools.PlanReadDefinition,
+		},
+	}
+}
+
+func runSubToolBox() *tools.ToolBox {
+	return &tools.ToolBox{
+		Tools: []*tools.ToolDefinition{
+			&tools.ReadFileDefinition,
+			&tools.GrepSearchDefinition,
+			&tools.ListFilesDefinition,
+		},
+	}
+}
+
+// URL the server can reach itself on, whatever interface it listens on
+func (s *server) baseURL() string {
+	if s.addr.Network() == "unix" {
+		return "unix://" + s.addr.String()
+	}
+
+	_, port, err := net.SplitHostPort(s.addr.String())
+	if err != nil {
+		return ""
+	}
+
+	return "http://" + net.JoinHostPort("127.0.0.1", port)
+}
@@ -1,81 +1,476 @@
 package server
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/config"
 	"github.com/honganh1206/tinker/server/data"
 	"github.com/honganh1206/tinker/server/db"
+	"github.com/honganh1206/tinker/utils"
+	"google.golang.org/grpc"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+var logger = utils.Logger("server")
+
+// How long a shutdown waits for active requests to finish
+const shutdownTimeout = 10 * time.Second
+
 type server struct {
-	addr   net.Addr
-	db     *sql.DB
-	models *data.Models
+	addr    net.Addr
+	db      *sql.DB
+	dialect data.Dialect
+	models  *data.Models
+	// Directory of the SQLite file, empty for other databases
+	dataDir string
+	// Where archived conversations are kept, next to the database
+	archiveDir string
+	// Encrypts messages and archives, nil when the database is in plain text
+	cipher    *data.PayloadCipher
+	startedAt time.Time
+	// Conversations with an agent run in progress
+	runsMu sync.Mutex
+	runs   map[string]bool
+	// Closed once shutting down, which cuts off the agent runs. Nil when the server never shuts down
+	draining  chan struct{}
+	agentRuns sync.WaitGroup
+	// Accepted alongside the issued tokens, for the server's own API calls
+	internalToken string
+	// Listening on a unix socket only its owner can open, which stands in for tokens
+	socketAuth bool
+	// Conversations being watched over a WebSocket
+	watchers *watchHub
+	// Nil when requests are not rate limited
+	limiter     *rateLimiter
+	maxBodySize int64
+}
+
+// Location of the server database
+func DBPath() (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "tinker.db"), nil
+}
+
+// Open the database behind dsn without touching its schema.
+// An empty dsn means the SQLite file in the user's home directory
+func openDatabase(dsn string) (*sql.DB, data.Dialect, error) {
+	if dsn == "" {
+		path, err := DBPath()
+		if err != nil {
+			return nil, data.SQLite, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dsn = path
+	}
+
+	dialect := data.DialectFromDSN(dsn)
+	if dialect == data.SQLite {
+		conn, err := db.OpenDB(dsn)
+		return conn, dialect, err
+	}
+
+	conn, err := db.Open(dialect.Driver(), dsn)
+	return conn, dialect, err
+}
+
+// File of the SQLite database behind dsn, empty for other databases and in-memory ones
+func sqlitePath(dsn string, dialect data.Dialect) string {
+	if dialect != data.SQLite {
+		return ""
+	}
+
+	if dsn == "" {
+		path, err := DBPath()
+		if err != nil {
+			return ""
+		}
+		dsn = path
+	}
+
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return ""
+	}
+	return path
+}
+
+func sqliteDir(dsn string, dialect data.Dialect) string {
+	path := sqlitePath(dsn, dialect)
+	if path == "" {
+		return ""
+	}
+	return filepath.Dir(path)
+}
+
+// Where archived conversations are kept. Next to a SQLite file, other databases
+// keep archives in the data directory of the user running the server
+func archiveDir(dsn string, dialect data.Dialect) (string, error) {
+	dir := sqliteDir(dsn, dialect)
+	if dir == "" {
+		var err error
+		if dir, err = utils.DataDir(); err != nil {
+			return "", fmt.Errorf("failed to get data directory: %w", err)
+		}
+	}
+	return filepath.Join(dir, "archive"), nil
+}
+
+// Keep a second server from opening the same SQLite file, which has a single writer.
+// Nil when there is no file to guard
+func lockDatabase(dsn string, dialect data.Dialect) (*utils.FileLock, error) {
+	path := sqlitePath(dsn, dialect)
+	if path == "" {
+		return nil, nil
+	}
+
+	lock, err := utils.LockFile(path + ".lock")
+	if errors.Is(err, utils.ErrLocked) {
+		return nil, fmt.Errorf("another server is already running on %s", path)
+	}
+	return lock, err
+}
+
+// Apply the pending migrations of the database behind dsn
+func MigrateDatabase(dsn string) ([]data.Migration, error) {
+	db, dialect, err := openDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return data.Migrate(db, dialect)
+}
+
+// Report which migrations the database behind dsn has applied
+func DatabaseStatus(dsn string) ([]data.MigrationStatus, error) {
+	db, dialect, err := openDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return data.MigrationStatuses(db, dialect)
+}
+
+// Issue a new API token, stored in the server database
+func NewToken(dsn string) (string, error) {
+	db, dialect, err := openDatabase(dsn)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	if _, err := data.Migrate(db, dialect); err != nil {
+		return "", err
+	}
+
+	return data.NewModels(db, dialect).APITokens.Create()
 }
 
-func Serve(ln net.Listener) error {
-	homeDir, err := os.UserHomeDir()
+// Listen on the unix socket of cfg when set, on its TCP address otherwise.
+// The socket is only accessible to the current user, file permissions act as access control
+func Listen(cfg config.Server) (net.Listener, error) {
+	socket := cfg.SocketPath()
+	if socket == "" {
+		return net.Listen("tcp", cfg.Addr())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// A server that crashed leaves its socket behind, refuse only when one is still answering
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a server is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", socket)
 	if err != nil {
-		log.Fatal("Failed to get home directory:", err)
+		return nil, err
 	}
 
-	// TODO: This should have their own function
-	// to be used directly by the CLI agent
-	dsn := filepath.Join(homeDir, ".tinker", "tinker.db")
+	if err := os.Chmod(socket, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	return ln, nil
+}
 
-	db, err := db.OpenDB(dsn, data.ConversationSchema, data.PlanSchema)
+// Serve the API on ln until ctx is cancelled, then stop accepting connections
+// and wait for active requests before closing the database
+func Serve(ctx context.Context, ln net.Listener, cfg config.Server) error {
+	dsn := cfg.Database
+	db, dialect, err := openDatabase(dsn)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %s", err.Error())
+		return fmt.Errorf("failed to initialize %s database: %w", dialect, err)
 	}
 	defer db.Close()
 
+	lock, err := lockDatabase(dsn, dialect)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		defer lock.Unlock()
+	}
+
+	applied, err := data.Migrate(db, dialect)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s database: %w", dialect, err)
+	}
+	for _, m := range applied {
+		logger.Info("applied migration", "version", fmt.Sprintf("%04d", m.Version), "name", m.Name)
+	}
+
+	cipher, err := databaseCipher(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	if dialect == data.SQLite && cipher != nil {
+		// Left behind when the key was set without 'tinker db encrypt'
+		if err := data.DisableSearchIndex(db); err != nil {
+			return err
+		}
+	} else if dialect == data.SQLite {
+		if err := data.EnableSearchIndex(db); err != nil {
+			logger.Warn("full-text search index unavailable, searching without it", "err", err)
+		}
+	}
+
+	internalToken, err := newInternalToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate internal token: %w", err)
+	}
+
 	srv := &server{
-		addr:   ln.Addr(),
-		db:     db,
-		models: data.NewModels(db),
+		addr:          ln.Addr(),
+		db:            db,
+		dialect:       dialect,
+		models:        data.NewEncryptedModels(db, dialect, cipher),
+		dataDir:       sqliteDir(dsn, dialect),
+		cipher:        cipher,
+		startedAt:     time.Now(),
+		runs:          make(map[string]bool),
+		draining:      make(chan struct{}),
+		watchers:      newWatchHub(),
+		internalToken: internalToken,
+		maxBodySize:   cfg.MaxBodySize,
+		socketAuth:    ln.Addr().Network() == "unix",
+	}
+	if cfg.RateLimit > 0 {
+		srv.limiter = newRateLimiter(cfg.RateLimit)
 	}
 
+	if srv.archiveDir, err = archiveDir(dsn, dialect); err != nil {
+		return err
+	}
+
+	if cfg.Retention.Enabled() {
+		retentionCtx, stopRetention := context.WithCancel(ctx)
+		retentionDone := make(chan struct{})
+		go func() {
+			defer close(retentionDone)
+			srv.enforceRetention(retentionCtx, cfg.Retention)
+		}()
+		// Before the database closes
+		defer func() {
+			stopRetention()
+			<-retentionDone
+		}()
+	}
+
+	if count, err := srv.models.APITokens.Count(); err == nil && count == 0 && !srv.socketAuth {
+		logger.Warn("no API tokens issued yet, every request except /health will be rejected. Create one with 'tinker serve --new-token'")
+	}
+
+	// Parent of every request context, cancelled when draining takes too long
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	server := &http.Server{
+		Handler:     srv.handler(),
+		Addr:        ln.Addr().String(),
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	// Shutdown does not track hijacked connections, hang up on watchers ourselves
+	server.RegisterOnShutdown(srv.watchers.close)
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+
+	var grpcServer *grpc.Server
+	if addr := cfg.GRPCAddr(); addr != "" {
+		grpcServer, err = srv.serveGRPC(addr, serveErr)
+		if err != nil {
+			server.Close()
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+		defer grpcServer.Stop()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Agent runs save through the server's own API, so they are cut off while it still listens
+	logger.Info("shutting down, stopping agent runs", "timeout", shutdownTimeout)
+	if !srv.stopAgentRuns(shutdownCtx) {
+		logger.Warn("agent runs did not save their conversations in time")
+	}
+
+	logger.Info("waiting for active requests", "timeout", shutdownTimeout)
+
+	grpcStopped := make(chan error, 1)
+	if grpcServer != nil {
+		go func() { grpcStopped <- stopGRPC(shutdownCtx, grpcServer) }()
+	} else {
+		grpcStopped <- nil
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// Agent runs can stream for minutes, cut off whatever is left
+		cancelRequests()
+		server.Close()
+		return fmt.Errorf("active requests did not finish within %s: %w", shutdownTimeout, err)
+	}
+
+	if err := <-grpcStopped; err != nil {
+		return fmt.Errorf("active gRPC calls did not finish within %s: %w", shutdownTimeout, err)
+	}
+
+	return nil
+}
+
+// Wrap the routes in authentication and the limits protecting a shared instance
+func (s *server) handler() http.Handler {
+	var h http.Handler = s.routes()
+	if s.maxBodySize > 0 {
+		h = s.limitBody(h)
+	}
+	if s.limiter != nil {
+		h = s.rateLimit(h)
+	}
+
+	return s.requireToken(h)
+}
+
+// Every route is documented in openapi.json, keep the two in sync
+func (s *server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok"}`))
-	})
+	mux.HandleFunc("/health", s.healthHandler)
+
+	mux.HandleFunc("/openapi.json", s.openAPIHandler)
 
 	// Register conversation handlers
-	mux.HandleFunc("/conversations", srv.conversationHandler)
-	mux.HandleFunc("/conversations/", srv.conversationHandler)
+	mux.HandleFunc("/conversations", s.conversationHandler)
+	mux.HandleFunc("/conversations/", s.conversationHandler)
 
 	// Register plan handlers
-	mux.HandleFunc("/plans", srv.planHandler)
-	mux.HandleFunc("/plans/", srv.planHandler)
+	mux.HandleFunc("/plans", s.planHandler)
+	mux.HandleFunc("/plans/", s.planHandler)
+
+	mux.HandleFunc("/stats", s.statsHandler)
+
+	// Register MCP tool cache handlers
+	mux.HandleFunc("/mcp/tools/", s.mcpToolCacheHandler)
 
-	server := &http.Server{Handler: mux, Addr: ":11435"}
-	return server.Serve(ln)
+	return mux
 }
 
 func (s *server) conversationHandler(w http.ResponseWriter, r *http.Request) {
+	if id, tag, ok := parseSubPath("/conversations/", "tags", r.URL.Path); ok {
+		s.tagHandler(w, r, data.TagConversation, id, tag)
+		return
+	}
+
+	if id, action, ok := parseAction("/conversations/", r.URL.Path); ok {
+		switch {
+		case action == "run" && r.Method == http.MethodPost:
+			s.runConversation(w, r, id)
+		case action == "export" && r.Method == http.MethodGet:
+			s.exportConversation(w, r, id)
+		case action == "ws" && r.Method == http.MethodGet:
+			s.watchConversation(w, r, id)
+		case action == "messages" && r.Method == http.MethodPost:
+			s.appendMessages(w, r, id)
+		case action == "fork" && r.Method == http.MethodPost:
+			s.forkConversation(w, r, id)
+		case action == "archive" && r.Method == http.MethodPost:
+			s.archiveConversation(w, r, id)
+		case action == "unarchive" && r.Method == http.MethodPost:
+			s.unarchiveConversation(w, r, id)
+		case action == "redact" && r.Method == http.MethodPost:
+			s.redactMessage(w, r, id)
+		case action == "summaries" && r.Method == http.MethodPost:
+			s.addSummary(w, r, id)
+		case action == "run" || action == "export" || action == "ws" || action == "messages" || action == "fork" || action == "archive" || action == "unarchive" || action == "redact" || action == "summaries":
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
 	convID, hasID := parseConvID(r.URL.Path)
 
 	switch r.Method {
 	case http.MethodPost:
 		s.createConversation(w, r)
 	case http.MethodGet:
-		if hasID {
+		if convID == "search" {
+			s.searchConversations(w, r)
+		} else if hasID {
 			s.getConversation(w, r, convID)
 		} else {
 			s.listConversations(w, r)
 		}
 	case http.MethodPut:
 		s.saveConversation(w, r, convID)
+	case http.MethodPatch:
+		if !hasID {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.patchConversation(w, r, convID)
+	case http.MethodDelete:
+		if !hasID {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.deleteConversation(w, r, convID)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -101,7 +496,52 @@ func parseConvID(path string) (string, bool) {
 	return id, true
 }
 
+// Match {prefix}{id}/{action}, e.g., /conversations/123/run
+func parseAction(prefix, path string) (string, string, bool) {
+	path = strings.TrimSuffix(path, "/")
+
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, action, ok := strings.Cut(rest, "/")
+	if !ok || id == "" || action == "" || strings.Contains(action, "/") {
+		return "", "", false
+	}
+
+	return id, action, true
+}
+
+// Match {prefix}{id}/{collection}/{itemID}, e.g., /plans/123/steps/add-tests
+func parseSubPath(prefix, collection, path string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(path, "/"), prefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, itemID, ok := strings.Cut(rest, "/"+collection+"/")
+	if !ok || id == "" || itemID == "" || strings.Contains(id, "/") || strings.Contains(itemID, "/") {
+		return "", "", false
+	}
+
+	return id, itemID, true
+}
+
 func (s *server) createConversation(w http.ResponseWriter, r *http.Request) {
+	// The body is optional, older clients send none
+	var req struct {
+		Project string `json:"project"`
+	}
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Err:     err,
+		})
+		return
+	}
+
 	conv, err := data.NewConversation()
 	if err != nil {
 		handleError(w, &HTTPError{
@@ -111,6 +551,7 @@ func (s *server) createConversation(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	conv.Project = req.Project
 
 	if err := s.models.Conversations.Create(conv); err != nil {
 		handleError(w, &HTTPError{
@@ -125,7 +566,13 @@ func (s *server) createConversation(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) listConversations(w http.ResponseWriter, r *http.Request) {
-	conversations, err := s.models.Conversations.List()
+	filter, err := listFilter(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	conversations, err := s.models.Conversations.List(filter)
 	if err != nil {
 		handleError(w, &HTTPError{
 			Code:    http.StatusInternalServerError,
@@ -139,13 +586,39 @@ func (s *server) listConversations(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) getConversation(w http.ResponseWriter, r *http.Request, id string) {
+	include := r.URL.Query().Get("include")
+	if include != "" && include != "plan" {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Cannot include '%s', only 'plan'", include),
+		})
+		return
+	}
+
 	conv, err := s.models.Conversations.Get(id)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, conv)
+	if include == "" {
+		writeJSON(w, http.StatusOK, conv)
+		return
+	}
+
+	// Saves a second request when opening a conversation, the plan is null when it has none
+	plan, err := s.models.Plans.Get(id)
+	if err != nil && !errors.Is(err, data.ErrPlanNotFound) {
+		handleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, conversationWithPlan{Conversation: conv, Plan: plan})
+}
+
+// Conversation with its plan inline, as returned for include=plan
+type conversationWithPlan struct {
+	*data.Conversation
+	Plan *data.Plan
 }
 
 func (s *server) saveConversation(w http.ResponseWriter, r *http.Request, conversationID string) {
@@ -168,7 +641,12 @@ func (s *server) saveConversation(w http.ResponseWriter, r *http.Request, conver
 		return
 	}
 
-	if err := s.models.Conversations.Save(&conv); err != nil {
+	err := s.models.Conversations.Save(&conv)
+	if errors.Is(err, data.ErrArchived) {
+		handleError(w, err)
+		return
+	}
+	if err != nil {
 		handleError(w, &HTTPError{
 			Code:    http.StatusInternalServerError,
 			Message: "Failed to save conversation",
@@ -176,17 +654,313 @@ func (s *server) saveConversation(w http.ResponseWriter, r *http.Request, conver
 		})
 		return
 	}
+	s.recordModel(conv.ID, conv.Messages)
+	s.watchers.publish(conv.ID)
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "conversation saved"})
 }
 
+// Store only the messages the database does not have yet.
+// PUT rewrites the whole history and stays around for repairs
+func (s *server) appendMessages(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		From     int                `json:"from"`
+		Messages []*message.Message `json:"messages"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid messages format",
+			Err:     err,
+		})
+		return
+	}
+
+	if req.From < 0 {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "From must not be negative",
+			Err:     nil,
+		})
+		return
+	}
+
+	count, err := s.models.Conversations.AppendMessages(id, req.From, req.Messages)
+	if errors.Is(err, data.ErrMessageGap) {
+		handleError(w, &HTTPError{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("Conversation has %d messages, cannot append from %d", count, req.From),
+			Err:     err,
+		})
+		return
+	}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	s.recordModel(id, req.Messages)
+	s.watchers.publish(id)
+
+	writeJSON(w, http.StatusOK, map[string]int{"count": count})
+}
+
+func (s *server) forkConversation(w http.ResponseWriter, r *http.Request, id string) {
+	// The body is optional, without it the fork takes every message
+	var req struct {
+		At *int `json:"at"`
+	}
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Err:     err,
+		})
+		return
+	}
+
+	var at int
+	if req.At != nil {
+		at = *req.At
+	} else {
+		conv, err := s.models.Conversations.Get(id)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		at = len(conv.Messages)
+	}
+
+	fork, err := s.models.Conversations.Fork(id, at)
+	if errors.Is(err, data.ErrForkPoint) {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "At must be between 0 and the number of messages of the conversation",
+			Err:     err,
+		})
+		return
+	}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fork)
+}
+
+func (s *server) redactMessage(w http.ResponseWriter, r *http.Request, id string) {
+	// Without a block the whole message is redacted
+	var req struct {
+		Sequence *int `json:"sequence"`
+		Block    *int `json:"block"`
+	}
+	if err := decodeJSON(r, &req); err != nil || req.Sequence == nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format, sequence is required",
+			Err:     err,
+		})
+		return
+	}
+
+	block := -1
+	if req.Block != nil {
+		block = *req.Block
+	}
+
+	// A run would save its copy of the history over the redaction
+	if !s.startRun(id) {
+		handleError(w, errRunInProgress)
+		return
+	}
+	err := s.models.Conversations.Redact(id, *req.Sequence, block)
+	s.finishRun(id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	s.watchers.publish(id)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "message redacted"})
+}
+
+// Not claimed like a run, runs store the summaries of their own compactions
+func (s *server) addSummary(w http.ResponseWriter, r *http.Request, id string) {
+	var summary data.Summary
+	if err := decodeJSON(r, &summary); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid summary format",
+			Err:     err,
+		})
+		return
+	}
+
+	if err := s.models.Conversations.AddSummary(id, &summary); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "summary added"})
+}
+
+// Keep the model of the latest reply in msgs on the conversation, for listings.
+// Only metadata, the messages are saved either way
+func (s *server) recordModel(id string, msgs []*message.Message) {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		model := msgs[i].Model
+		if model == "" {
+			continue
+		}
+		if err := s.models.Conversations.SetModel(id, string(inference.ProviderForModel(model)), model); err != nil {
+			logger.Warn("failed to record the model of a conversation", "conversation", id, "err", err)
+		}
+		return
+	}
+}
+
+func (s *server) searchConversations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Search query is required",
+			Err:     nil,
+		})
+		return
+	}
+
+	limit := 0
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 0 {
+			handleError(w, &HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid limit",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	results, err := s.models.Conversations.Search(query, limit)
+	if err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to search conversations",
+			Err:     err,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// Longest title accepted, titles are meant to fit in a list
+const maxTitleLength = 200
+
+func (s *server) patchConversation(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		Title *string `json:"title"`
+		// Replaces every tag when present
+		Tags *[]string `json:"tags"`
+	}
+
+	if err := decodeJSON(r, &req); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request format",
+			Err:     err,
+		})
+		return
+	}
+
+	if req.Title == nil && req.Tags == nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Nothing to update",
+			Err:     nil,
+		})
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if len([]rune(title)) > maxTitleLength || strings.ContainsAny(title, "\r\n") {
+			handleError(w, &HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Title must be a single line of at most %d characters", maxTitleLength),
+				Err:     nil,
+			})
+			return
+		}
+
+		if err := s.models.Conversations.Rename(id, title); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if req.Tags != nil {
+		if err := s.models.Tags.Set(data.TagConversation, id, *req.Tags); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "conversation updated"})
+}
+
+func (s *server) deleteConversation(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.models.Conversations.Delete(id); err != nil {
+		handleError(w, err)
+		return
+	}
+	s.removeArchive(id)
+	s.watchers.publish(id)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "conversation deleted"})
+}
+
 func (s *server) planHandler(w http.ResponseWriter, r *http.Request) {
+	if planID, tag, ok := parseSubPath("/plans/", "tags", r.URL.Path); ok {
+		s.tagHandler(w, r, data.TagPlan, planID, tag)
+		return
+	}
+
+	if planID, stepID, ok := parseSubPath("/plans/", "steps", r.URL.Path); ok {
+		if r.Method != http.MethodPatch {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.patchStep(w, r, planID, stepID)
+		return
+	}
+
+	if id, action, ok := parseAction("/plans/", r.URL.Path); ok {
+		switch {
+		case action == "history" && r.Method == http.MethodGet:
+			s.planHistory(w, r, id)
+		case action == "revert" && r.Method == http.MethodPost:
+			s.revertPlan(w, r, id)
+		case action == "history" || action == "revert":
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
 	planID, hasID := parsePlanID(r.URL.Path)
 	switch r.Method {
 	case http.MethodPost:
 		s.createPlan(w, r)
 	case http.MethodGet:
-		s.getPlan(w, r, planID)
+		if hasID {
+			s.getPlan(w, r, planID)
+		} else {
+			s.listPlans(w, r)
+		}
 	case http.MethodPut:
 		s.savePlan(w, r, planID)
 	case http.MethodDelete:
@@ -254,6 +1028,10 @@ func (s *server) createPlan(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = s.models.Plans.Create(plan)
+	if errors.Is(err, data.ErrConversationNotFound) {
+		handleError(w, err)
+		return
+	}
 	if err != nil {
 		handleError(w, &HTTPError{
 			Code:    http.StatusInternalServerError,
@@ -266,6 +1044,26 @@ func (s *server) createPlan(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"id": plan.ID})
 }
 
+func (s *server) listPlans(w http.ResponseWriter, r *http.Request) {
+	filter, err := listFilter(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	plans, err := s.models.Plans.List(filter)
+	if err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list plans",
+			Err:     err,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plans)
+}
+
 func (s *server) getPlan(w http.ResponseWriter, r *http.Request, id string) {
 	p, err := s.models.Plans.Get(id)
 	if err != nil {
@@ -273,6 +1071,7 @@ func (s *server) getPlan(w http.ResponseWriter, r *http.Request, id string) {
 		return
 	}
 
+	setPlanETag(w, p)
 	writeJSON(w, http.StatusOK, p)
 }
 
@@ -296,7 +1095,17 @@ func (s *server) savePlan(w http.ResponseWriter, r *http.Request, planID string)
 		return
 	}
 
-	if err := s.models.Plans.Save(&p); err != nil {
+	author, ok := planAuthor(r, data.AuthorAgent)
+	if !ok {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Author must be agent or user",
+			Err:     nil,
+		})
+		return
+	}
+
+	if err := s.models.Plans.Save(&p, author); err != nil {
 		handleError(w, &HTTPError{
 			Code:    http.StatusInternalServerError,
 			Message: err.Error(),
@@ -304,7 +1113,9 @@ func (s *server) savePlan(w http.ResponseWriter, r *http.Request, planID string)
 		})
 		return
 	}
+	s.watchers.publish(p.ConversationID)
 
+	setPlanETag(w, &p)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "plan saved"})
 }
 
@@ -357,3 +1168,59 @@ func (s *server) deletePlans(w http.ResponseWriter, r *http.Request) {
 		"results": results,
 	})
 }
+
+func (s *server) mcpToolCacheHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/mcp/tools/")
+	if key == "" || strings.Contains(key, "/") {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Cache key is required",
+			Err:     nil,
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getMCPToolCache(w, r, key)
+	case http.MethodPut:
+		s.saveMCPToolCache(w, r, key)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) getMCPToolCache(w http.ResponseWriter, r *http.Request, key string) {
+	cache, err := s.models.MCPToolCache.Get(key)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cache)
+}
+
+func (s *server) saveMCPToolCache(w http.ResponseWriter, r *http.Request, key string) {
+	var cache data.MCPToolCache
+	if err := decodeJSON(r, &cache); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid tool cache format",
+			Err:     err,
+		})
+		return
+	}
+
+	cache.Key = key
+
+	if err := s.models.MCPToolCache.Save(&cache); err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to save tool cache",
+			Err:     err,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "tool cache saved"})
+}
@@ -0,0 +1,468 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/config"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+func TestLockDatabase(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+
+	lock, err := lockDatabase(dsn, data.SQLite)
+	if err != nil || lock == nil {
+		t.Fatalf("lockDatabase() = %v, %v, want a lock", lock, err)
+	}
+
+	if _, err := lockDatabase(dsn, data.SQLite); err == nil {
+		t.Error("lockDatabase() succeeded while another lock is held")
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	again, err := lockDatabase(dsn, data.SQLite)
+	if err != nil {
+		t.Fatalf("lockDatabase() after Unlock() error = %v", err)
+	}
+	again.Unlock()
+
+	// Nothing on disk to guard
+	for _, dsn := range []string{":memory:", "file:test?mode=memory", "postgres://localhost/tinker"} {
+		if lock, err := lockDatabase(dsn, data.DialectFromDSN(dsn)); lock != nil || err != nil {
+			t.Errorf("lockDatabase(%q) = %v, %v, want no lock", dsn, lock, err)
+		}
+	}
+}
+
+func TestServe_ReturnsAfterShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, ln, config.Server{Database: filepath.Join(t.TempDir(), "test.db")})
+	}()
+
+	url := "http://" + ln.Addr().String() + "/health"
+	var resp *http.Response
+	for range 50 {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Server never answered: %v", err)
+	}
+	resp.Body.Close()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() error = %v, want nil after shutdown", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("Serve() did not return after the context was cancelled")
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("Server still accepts connections after shutdown")
+	}
+}
+
+func TestStopAgentRuns(t *testing.T) {
+	srv := newTestServer(t)
+	srv.draining = make(chan struct{})
+
+	runCtx, done := srv.agentRunContext(context.Background())
+	saved := make(chan struct{})
+	go func() {
+		<-runCtx.Done()
+		// Saving the conversation before the run returns
+		time.Sleep(20 * time.Millisecond)
+		close(saved)
+		done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !srv.stopAgentRuns(ctx) {
+		t.Fatal("stopAgentRuns() = false, want the run to stop in time")
+	}
+	select {
+	case <-saved:
+	default:
+		t.Error("stopAgentRuns() returned before the run did")
+	}
+
+	// A run that ignores being cut off is given up on
+	srv = newTestServer(t)
+	srv.draining = make(chan struct{})
+	_, done = srv.agentRunContext(context.Background())
+	defer done()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if srv.stopAgentRuns(ctx) {
+		t.Error("stopAgentRuns() = true, want false for a run still going")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := newTestServer(t)
+	srv.runs["conv-1"] = true
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /health = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	var report healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid health report: %v", err)
+	}
+
+	if report.Status != "ok" || report.Database.Status != "ok" || report.Database.Dialect != "sqlite" {
+		t.Errorf("Unexpected health report: %+v", report)
+	}
+	if report.Database.SchemaVersion == 0 || report.Database.SchemaVersion != report.Database.LatestSchemaVersion {
+		t.Errorf("Schema version %d, latest %d, want both set and equal", report.Database.SchemaVersion, report.Database.LatestSchemaVersion)
+	}
+	if report.ActiveRuns != 1 {
+		t.Errorf("Active runs = %d, want 1", report.ActiveRuns)
+	}
+	if report.Disk == nil || report.Disk.TotalBytes == 0 {
+		t.Errorf("Disk usage missing: %+v", report.Disk)
+	}
+
+	srv.db.Close()
+
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /health with a closed database = %d, want 503", rec.Code)
+	}
+}
+
+func TestClient_SaveConversationAppends(t *testing.T) {
+	srv := newTestServer(t)
+
+	var puts, posts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			puts++
+		case http.MethodPost:
+			posts++
+		}
+		srv.routes().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+	posts = 0
+
+	say := func(text string) {
+		conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(text)}})
+		if err := client.SaveConversation(conv); err != nil {
+			t.Fatalf("SaveConversation() failed: %v", err)
+		}
+	}
+	say("one")
+	say("two")
+
+	if puts != 0 || posts != 2 {
+		t.Errorf("Got %d PUTs and %d appends, want only 2 appends", puts, posts)
+	}
+
+	// A compacted history is shorter than what is stored, it gets rewritten
+	conv.Messages = conv.Messages[1:]
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation() after compaction failed: %v", err)
+	}
+	if puts != 1 {
+		t.Errorf("Got %d PUTs after compaction, want 1", puts)
+	}
+
+	stored, err := srv.models.Conversations.Get(conv.ID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if len(stored.Messages) != 1 || stored.Messages[0].Content[0].(message.TextBlock).Text != "two" {
+		t.Errorf("Stored history = %+v, want only the second message", stored.Messages)
+	}
+}
+
+func TestListConversations_TitleAndModel(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("Why does the build fail?\nLogs attached")}})
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("A typo")}, Model: string(inference.Claude45Sonnet)})
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation() failed: %v", err)
+	}
+
+	convs, err := client.ListConversations(data.ListFilter{})
+	if err != nil {
+		t.Fatalf("ListConversations() failed: %v", err)
+	}
+	if len(convs) != 1 {
+		t.Fatalf("Listed %d conversations, want 1", len(convs))
+	}
+	got := convs[0]
+	if got.Title != "Why does the build fail?" || got.Provider != string(inference.AnthropicProvider) || got.Model != string(inference.Claude45Sonnet) {
+		t.Errorf("Listed title, provider, model = %q, %q, %q, want the first line of the prompt and the model of the reply", got.Title, got.Provider, got.Model)
+	}
+}
+
+func TestForkConversation(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("Try it this way")}})
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("Done")}})
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation() failed: %v", err)
+	}
+
+	// Without a fork point the fork takes the whole history
+	fork, err := client.ForkConversation(conv.ID, -1)
+	if err != nil {
+		t.Fatalf("ForkConversation() failed: %v", err)
+	}
+	if fork.ParentID != conv.ID || fork.ForkSequence != 2 || len(fork.Messages) != 2 {
+		t.Errorf("ParentID, ForkSequence, messages = %q, %d, %d, want %q, 2, 2", fork.ParentID, fork.ForkSequence, len(fork.Messages), conv.ID)
+	}
+
+	fork, err = client.ForkConversation(conv.ID, 1)
+	if err != nil {
+		t.Fatalf("ForkConversation() failed: %v", err)
+	}
+	if len(fork.Messages) != 1 {
+		t.Errorf("Fork at 1 has %d messages, want 1", len(fork.Messages))
+	}
+
+	var httpErr *api.HTTPError
+	if _, err := client.ForkConversation(conv.ID, 3); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("ForkConversation() past the end = %v, want a 400", err)
+	}
+	if _, err := client.ForkConversation("missing", -1); !errors.Is(err, data.ErrConversationNotFound) {
+		t.Errorf("ForkConversation() of a missing conversation = %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestRedactMessage(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("My key is sk-123")}})
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation() failed: %v", err)
+	}
+
+	if err := client.RedactMessage(conv.ID, 0, -1); err != nil {
+		t.Fatalf("RedactMessage() failed: %v", err)
+	}
+	got, err := client.GetConversation(conv.ID)
+	if err != nil {
+		t.Fatalf("GetConversation() failed: %v", err)
+	}
+	if text := got.Messages[0].Content[0].(message.TextBlock).Text; text != message.RedactedText {
+		t.Errorf("Redacted message = %q, want %q", text, message.RedactedText)
+	}
+
+	var httpErr *api.HTTPError
+	if err := client.RedactMessage(conv.ID, 1, -1); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("RedactMessage() of a missing message = %v, want a 404", err)
+	}
+
+	// A run would save its copy of the history over the redaction
+	srv.runs[conv.ID] = true
+	if err := client.RedactMessage(conv.ID, 0, 0); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusConflict {
+		t.Errorf("RedactMessage() during a run = %v, want a 409", err)
+	}
+}
+
+func TestAddSummary(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+	for _, text := range []string{"Fix the tests", "Fixed", "Thanks"} {
+		conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock(text)}})
+	}
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("SaveConversation() failed: %v", err)
+	}
+
+	if err := client.AddSummary(conv.ID, &data.Summary{From: 1, To: 2, Text: "- assistant: Fixed"}); err != nil {
+		t.Fatalf("AddSummary() failed: %v", err)
+	}
+	got, err := client.GetConversation(conv.ID)
+	if err != nil {
+		t.Fatalf("GetConversation() failed: %v", err)
+	}
+	// Loaded again, the conversation is sent compacted
+	if len(got.Summaries) != 1 || len(got.History()) != 3 || len(got.Messages) != 3 {
+		t.Errorf("Conversation has summaries %+v and a history of %d messages, want the summary standing in for one", got.Summaries, len(got.History()))
+	}
+
+	var httpErr *api.HTTPError
+	if err := client.AddSummary(conv.ID, &data.Summary{From: 1, To: 4, Text: "too far"}); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("AddSummary() past the messages = %v, want a 400", err)
+	}
+	if err := client.AddSummary("missing", &data.Summary{From: 1, To: 2}); !errors.Is(err, data.ErrConversationNotFound) {
+		t.Errorf("AddSummary() of a missing conversation = %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestGetConversationWithPlan(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+
+	got, plan, err := client.GetConversationWithPlan(conv.ID)
+	if err != nil {
+		t.Fatalf("GetConversationWithPlan() failed: %v", err)
+	}
+	if got.ID != conv.ID || plan != nil {
+		t.Errorf("GetConversationWithPlan() = %q, %+v, want the conversation without a plan", got.ID, plan)
+	}
+
+	created, err := client.CreatePlan(conv.ID)
+	if err != nil {
+		t.Fatalf("CreatePlan() failed: %v", err)
+	}
+	if _, plan, err = client.GetConversationWithPlan(conv.ID); err != nil || plan == nil || plan.ID != created.ID {
+		t.Errorf("GetConversationWithPlan() plan = %+v, %v, want %q", plan, err, created.ID)
+	}
+
+	resp, err := http.Get(ts.URL + "/conversations/" + conv.ID + "?include=steps")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unknown include status = %d, want 400", resp.StatusCode)
+	}
+
+	// The plan goes with its conversation
+	if err := client.DeleteConversation(conv.ID); err != nil {
+		t.Fatalf("DeleteConversation() failed: %v", err)
+	}
+	if _, err := client.GetPlan(conv.ID); !errors.Is(err, data.ErrPlanNotFound) {
+		t.Errorf("GetPlan() after deleting the conversation = %v, want ErrPlanNotFound", err)
+	}
+	if _, err := client.CreatePlan("missing"); !errors.Is(err, data.ErrConversationNotFound) {
+		t.Errorf("CreatePlan() in a missing conversation = %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not used on Windows")
+	}
+
+	dir := t.TempDir()
+	cfg := config.Server{Socket: filepath.Join(dir, "tinker.sock"), Database: filepath.Join(dir, "test.db")}
+
+	// Left behind by a server that crashed
+	if err := os.WriteFile(cfg.Socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := Listen(cfg)
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+
+	info, err := os.Stat(cfg.Socket)
+	if err != nil {
+		t.Fatalf("Socket missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Socket permissions = %o, want 600", perm)
+	}
+
+	if _, err := Listen(cfg); err == nil {
+		t.Error("Listen() succeeded while another server holds the socket")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, ln, cfg)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// No token needed, only the owner can open the socket
+	client := api.NewClient(cfg.URL())
+	client.SetToken("")
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("CreateConversation() over the socket failed: %v", err)
+	}
+	if _, err := client.GetConversation(conv.ID); err != nil {
+		t.Errorf("GetConversation() over the socket failed: %v", err)
+	}
+}
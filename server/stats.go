@@ -0,0 +1,148 @@
+package server
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// Entries of the tool and file rankings, the long tail is noise
+const statsTopN = 10
+
+func (s *server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, raw); err != nil {
+			handleError(w, &HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid since, expected an RFC 3339 time",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	metas, err := s.models.Conversations.List(data.ListFilter{Project: r.URL.Query().Get("project")})
+	if err != nil {
+		handleError(w, &HTTPError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to list conversations",
+			Err:     err,
+		})
+		return
+	}
+
+	var convs []*data.Conversation
+	for _, meta := range metas {
+		if meta.LatestMessageTime.Before(since) {
+			continue
+		}
+		conv, err := s.models.Conversations.Get(meta.ID)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		convs = append(convs, conv)
+	}
+
+	writeJSON(w, http.StatusOK, computeStats(convs, since))
+}
+
+// Tally the messages of convs written at or after since
+func computeStats(convs []*data.Conversation, since time.Time) data.Stats {
+	stats := data.Stats{Since: since, Models: []data.ModelUsage{}}
+	models := make(map[string]*data.ModelUsage)
+	// Total latency and the number of replies it covers, per model
+	latencies := make(map[string][2]int64)
+	tools := make(map[string]int)
+	files := make(map[string]int)
+
+	for _, conv := range convs {
+		active := false
+		for _, msg := range conv.Messages {
+			if msg.CreatedAt.Before(since) {
+				continue
+			}
+			active = true
+			stats.Messages++
+
+			if msg.Role != message.UserRole {
+				usage, ok := models[msg.Model]
+				if !ok {
+					usage = &data.ModelUsage{Model: msg.Model}
+					models[msg.Model] = usage
+				}
+				usage.Replies++
+				if msg.Usage != nil {
+					usage.InputTokens += msg.Usage.InputTokens
+					usage.OutputTokens += msg.Usage.OutputTokens
+					usage.CacheReadTokens += msg.Usage.CacheReadTokens
+					usage.CacheWriteTokens += msg.Usage.CacheWriteTokens
+					if msg.Usage.LatencyMs > 0 {
+						l := latencies[msg.Model]
+						latencies[msg.Model] = [2]int64{l[0] + msg.Usage.LatencyMs, l[1] + 1}
+					}
+				}
+			}
+
+			for _, block := range msg.Content {
+				call, ok := block.(message.ToolUseBlock)
+				if !ok {
+					continue
+				}
+				tools[call.Name]++
+				// Set as the tools package is linked in
+				if path, _, ok := data.EditDiff(call); ok {
+					files[path]++
+				}
+			}
+		}
+		if active {
+			stats.Sessions++
+		}
+	}
+
+	for model, usage := range models {
+		if l := latencies[model]; l[1] > 0 {
+			usage.AvgLatencyMs = l[0] / l[1]
+		}
+		if p, ok := inference.PricingFor(usage.Model); ok {
+			cost := p.Cost(inference.Usage{InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens})
+			usage.Cost = &cost
+		}
+		stats.Models = append(stats.Models, *usage)
+	}
+	slices.SortFunc(stats.Models, func(a, b data.ModelUsage) int {
+		return cmp.Or(
+			cmp.Compare(b.InputTokens+b.OutputTokens, a.InputTokens+a.OutputTokens),
+			cmp.Compare(a.Model, b.Model),
+		)
+	})
+
+	stats.Tools = ranked(tools)
+	stats.Files = ranked(files)
+	return stats
+}
+
+// Most counted first, at most statsTopN of them
+func ranked(counts map[string]int) []data.NameCount {
+	out := make([]data.NameCount, 0, len(counts))
+	for name, count := range counts {
+		out = append(out, data.NameCount{Name: name, Count: count})
+	}
+	slices.SortFunc(out, func(a, b data.NameCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	return out[:min(len(out), statsTopN)]
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+func TestStats(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	sonnet := string(inference.Claude45Sonnet)
+	since := time.Now().Add(-24 * time.Hour)
+
+	reply := func(at time.Time, model string, tools ...message.ContentBlock) *message.Message {
+		return &message.Message{
+			Role:      message.AssistantRole,
+			Content:   append([]message.ContentBlock{message.NewTextBlock("ok")}, tools...),
+			CreatedAt: at,
+			Model:     model,
+			Usage:     &message.Usage{InputTokens: 1000, OutputTokens: 100, CacheReadTokens: 500, LatencyMs: 2000},
+		}
+	}
+	edit := func(path string) message.ContentBlock {
+		return message.NewToolUseBlock("call", "edit_file", []byte(`{"path":"`+path+`","old_str":"a","new_str":"b"}`))
+	}
+
+	recent := &data.Conversation{ID: "recent", Project: "/src/tinker", CreatedAt: since.Add(-time.Hour), Messages: []*message.Message{
+		// Before the period, left out
+		reply(since.Add(-time.Hour), sonnet, edit("old.go")),
+		{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("fix it")}, CreatedAt: time.Now()},
+		reply(time.Now(), sonnet, edit("main.go"), edit("main.go"), edit("cmd.go")),
+		reply(time.Now(), "unpriced-model", message.NewToolUseBlock("call", "bash", []byte(`{"command":"go test"}`))),
+	}}
+	stale := &data.Conversation{ID: "stale", CreatedAt: since.Add(-48 * time.Hour), Messages: []*message.Message{
+		reply(since.Add(-48*time.Hour), sonnet, edit("main.go")),
+	}}
+	for _, conv := range []*data.Conversation{recent, stale} {
+		if err := srv.models.Conversations.Save(conv); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+	}
+
+	stats, err := api.NewClient(ts.URL).Stats(since, "")
+	if err != nil {
+		t.Fatalf("Stats() failed: %v", err)
+	}
+
+	if stats.Sessions != 1 || stats.Messages != 3 {
+		t.Errorf("Sessions, Messages = %d, %d, want 1, 3", stats.Sessions, stats.Messages)
+	}
+
+	if len(stats.Models) != 2 {
+		t.Fatalf("Models = %+v, want sonnet and the unpriced one", stats.Models)
+	}
+	if m := stats.Models[0]; m.Model != sonnet || m.Replies != 1 || m.InputTokens != 1000 || m.Cost == nil {
+		t.Errorf("Models[0] = %+v, want one priced reply of %s", m, sonnet)
+	}
+	// Read back from the stored payloads
+	if m := stats.Models[0]; m.CacheReadTokens != 500 || m.AvgLatencyMs != 2000 {
+		t.Errorf("Models[0] cache reads, latency = %d, %d, want 500, 2000", m.CacheReadTokens, m.AvgLatencyMs)
+	}
+	if m := stats.Models[1]; m.Cost != nil {
+		t.Errorf("Models[1] has a cost of %v without a price", *m.Cost)
+	}
+
+	if len(stats.Tools) != 2 || stats.Tools[0] != (data.NameCount{Name: "edit_file", Count: 3}) {
+		t.Errorf("Tools = %+v, want edit_file 3 times then bash", stats.Tools)
+	}
+	if len(stats.Files) != 2 || stats.Files[0] != (data.NameCount{Name: "main.go", Count: 2}) {
+		t.Errorf("Files = %+v, want main.go twice then cmd.go", stats.Files)
+	}
+
+	// Another project has none of it
+	stats, err = api.NewClient(ts.URL).Stats(time.Time{}, "/src/other")
+	if err != nil {
+		t.Fatalf("Stats() failed: %v", err)
+	}
+	if stats.Sessions != 0 || len(stats.Models) != 0 {
+		t.Errorf("Stats of another project = %+v, want nothing", stats)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/honganh1206/tinker/server/data"
+)
+
+// PUT attaches the tag, DELETE detaches it
+func (s *server) tagHandler(w http.ResponseWriter, r *http.Request, resourceType, id, tag string) {
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = s.models.Tags.Add(resourceType, id, tag)
+	case http.MethodDelete:
+		err = s.models.Tags.Remove(resourceType, id, tag)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "tags updated"})
+}
+
+// Filter of a list request, from the repeatable ?tag= and ?project= parameters
+func listFilter(r *http.Request) (data.ListFilter, error) {
+	return validFilter(data.ListFilter{
+		Project:  r.URL.Query().Get("project"),
+		Tags:     r.URL.Query()["tag"],
+		Archived: r.URL.Query().Get("archived") == "true",
+	})
+}
+
+// Tags are validated so a typo is reported rather than matching nothing
+func validFilter(filter data.ListFilter) (data.ListFilter, error) {
+	for _, tag := range filter.Tags {
+		if !data.ValidTag(tag) {
+			return filter, data.ErrInvalidTag
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,4 @@
+// Package tinkerpb holds the gRPC service of the server, generated from tinker.proto
+package tinkerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative tinker.proto
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+const (
+	watchPingInterval = 30 * time.Second
+	watchWriteTimeout = 10 * time.Second
+)
+
+// Browsers cannot set an Authorization header on a WebSocket, they pass the token
+// as ?access_token= instead, so any origin holding a valid token is accepted
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Tell the watchers of a conversation that it or its plan changed.
+// Notifications carry no payload, watchers reload what they need and a pending one
+// stands for any number of changes, so a slow watcher never blocks a writer
+type watchHub struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan struct{}]struct{}
+	closed bool
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{subs: make(map[string]map[chan struct{}]struct{})}
+}
+
+func (h *watchHub) subscribe(convID string) (<-chan struct{}, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if h.subs[convID] == nil {
+		h.subs[convID] = make(map[chan struct{}]struct{})
+	}
+	h.subs[convID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subs[convID][ch]; !ok {
+			return
+		}
+		delete(h.subs[convID], ch)
+		if len(h.subs[convID]) == 0 {
+			delete(h.subs, convID)
+		}
+	}
+}
+
+func (h *watchHub) publish(convID string) {
+	if convID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[convID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close every subscription, so watchers hang up when the server shuts down
+func (h *watchHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for convID, subs := range h.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(h.subs, convID)
+	}
+}
+
+// What a watcher has already been sent
+type watchCursor struct {
+	started     bool
+	messages    int
+	planVersion int
+}
+
+// Stream new messages and plan updates of a conversation over a WebSocket.
+// The connection is read-only, anything the client sends is discarded
+func (s *server) watchConversation(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := s.models.Conversations.Get(id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// Subscribe before the first snapshot, so nothing saved in between is missed
+	updates, unsubscribe := s.watchers.subscribe(id)
+	defer unsubscribe()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var cursor watchCursor
+	if !s.pushUpdates(conn, id, &cursor) {
+		return
+	}
+
+	ping := time.NewTicker(watchPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case _, ok := <-updates:
+			if !ok {
+				closeWatch(conn, websocket.CloseGoingAway, "server shutting down")
+				return
+			}
+			if !s.pushUpdates(conn, id, &cursor) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(watchWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Send whatever changed since cursor, false once the connection is done
+func (s *server) pushUpdates(conn *websocket.Conn, id string, cursor *watchCursor) bool {
+	events, err := s.watchUpdates(id, cursor)
+	if err != nil {
+		closeWatch(conn, websocket.CloseInternalServerErr, "failed to load conversation")
+		return false
+	}
+
+	for _, event := range events {
+		if err := writeWatchEvent(conn, event); err != nil {
+			return false
+		}
+		if event.Type == api.WatchDeleted {
+			closeWatch(conn, websocket.CloseNormalClosure, "conversation deleted")
+			return false
+		}
+	}
+
+	return true
+}
+
+// Events for whatever changed since cursor, which is moved past them.
+// A deleted conversation yields a single WatchDeleted event
+func (s *server) watchUpdates(id string, cursor *watchCursor) ([]api.WatchEvent, error) {
+	conv, err := s.models.Conversations.Get(id)
+	if errors.Is(err, data.ErrConversationNotFound) {
+		return []api.WatchEvent{{Type: api.WatchDeleted}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []api.WatchEvent
+
+	// A full save may have rewritten the history, resend it from the start
+	rewritten := len(conv.Messages) < cursor.messages
+	if rewritten {
+		cursor.messages = 0
+	}
+
+	if !cursor.started || rewritten || len(conv.Messages) > cursor.messages {
+		events = append(events, api.WatchEvent{Type: api.WatchMessages, From: cursor.messages, Messages: conv.Messages[cursor.messages:]})
+		cursor.messages = len(conv.Messages)
+		cursor.started = true
+	}
+
+	// A conversation without a plan yet is not an error
+	if plan, err := s.models.Plans.Get(id); err == nil && plan.Version != cursor.planVersion {
+		events = append(events, api.WatchEvent{Type: api.WatchPlan, Plan: plan})
+		cursor.planVersion = plan.Version
+	}
+
+	return events, nil
+}
+
+func writeWatchEvent(conn *websocket.Conn, event api.WatchEvent) error {
+	conn.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+	return conn.WriteJSON(event)
+}
+
+func closeWatch(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(watchWriteTimeout))
+}
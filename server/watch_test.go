@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/message"
+	"github.com/honganh1206/tinker/server/api"
+	"github.com/honganh1206/tinker/server/data"
+)
+
+func TestWatchConversation(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL)
+	conv, err := client.CreateConversation("")
+	if err != nil {
+		t.Fatalf("Failed to create conversation: %v", err)
+	}
+	conv.Append(&message.Message{Role: message.UserRole, Content: []message.ContentBlock{message.NewTextBlock("hello")}})
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("Failed to save conversation: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := make(chan api.WatchEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.WatchConversation(ctx, conv.ID, func(e api.WatchEvent) { events <- e })
+	}()
+
+	next := func() api.WatchEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for a watch event")
+			return api.WatchEvent{}
+		}
+	}
+
+	if e := next(); e.Type != api.WatchMessages || e.From != 0 || len(e.Messages) != 1 {
+		t.Fatalf("First event = %+v, want the history of one message", e)
+	}
+
+	// Only the new message is pushed
+	conv.Append(&message.Message{Role: message.AssistantRole, Content: []message.ContentBlock{message.NewTextBlock("hi")}})
+	if err := client.SaveConversation(conv); err != nil {
+		t.Fatalf("Failed to save conversation: %v", err)
+	}
+	if e := next(); e.Type != api.WatchMessages || e.From != 1 || len(e.Messages) != 1 {
+		t.Fatalf("Event after save = %+v, want the one new message", e)
+	}
+
+	plan, err := client.CreatePlan(conv.ID)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	plan.Steps = []*data.Step{{ID: "1", Description: "Write tests", Status: "TODO"}}
+	if err := client.SavePlan(plan); err != nil {
+		t.Fatalf("Failed to save plan: %v", err)
+	}
+	if e := next(); e.Type != api.WatchPlan || len(e.Plan.Steps) != 1 {
+		t.Fatalf("Event after plan save = %+v, want the plan", e)
+	}
+
+	if err := client.DeleteConversation(conv.ID); err != nil {
+		t.Fatalf("Failed to delete conversation: %v", err)
+	}
+	if e := next(); e.Type != api.WatchDeleted {
+		t.Fatalf("Event after delete = %+v, want deleted", e)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("WatchConversation() error = %v, want nil after the conversation was deleted", err)
+	}
+
+	if err := client.WatchConversation(ctx, conv.ID, func(api.WatchEvent) {}); err != data.ErrConversationNotFound {
+		t.Errorf("Watching a deleted conversation = %v, want ErrConversationNotFound", err)
+	}
+}
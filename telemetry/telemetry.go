@@ -0,0 +1,171 @@
+// Package telemetry counts which features of tinker are used and which kinds of errors come up,
+// in a file under the data directory. Nothing is recorded unless the user turns it on, and
+// nothing leaves the machine unless they export it
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/honganh1206/tinker/tinkererr"
+)
+
+const (
+	FileName = "telemetry.jsonl"
+	// Past this size the older half of the records is dropped on Open
+	maxSize = 1 << 20
+)
+
+// What a record counts
+const (
+	KindFeature = "feature"
+	KindError   = "error"
+)
+
+// One use of a feature or one error. Records hold names only, never prompts, paths or messages
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	// e.g., "command stats", "tool bash" or "/compact" for features, "rate limited" for errors
+	Name string `json:"name"`
+}
+
+// Appends records to the file at path. The methods of a nil Recorder do nothing,
+// which is what callers get when telemetry is off
+type Recorder struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Recorder writing to path, its directory is created on the first record
+func Open(path string) *Recorder {
+	trim(path)
+	return &Recorder{path: path}
+}
+
+// Count a use of the feature name
+func (r *Recorder) Feature(name string) {
+	r.record(KindFeature, name)
+}
+
+// Count err by its kind, Unknown for errors without one
+func (r *Recorder) Error(err error) {
+	if err == nil {
+		return
+	}
+	r.record(KindError, tinkererr.KindOf(err).String())
+}
+
+func (r *Recorder) record(kind, name string) {
+	if r == nil {
+		return
+	}
+
+	line, err := json.Marshal(Event{Time: time.Now().UTC(), Kind: kind, Name: name})
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Losing a record is fine, failing what the user is doing because of one is not
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
+
+// Records in the file at path, oldest first. None when it does not exist, malformed lines are skipped
+func Read(path string) ([]Event, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Kind == "" {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// How often a feature was used or an error came up
+type Count struct {
+	Name  string
+	Count int
+}
+
+// Counts of the features and errors recorded since then, a zero time for all of them.
+// Most frequent first
+func Summarize(events []Event, since time.Time) (features, errs []Count) {
+	counts := map[string]map[string]int{KindFeature: {}, KindError: {}}
+	for _, e := range events {
+		if e.Time.Before(since) || counts[e.Kind] == nil {
+			continue
+		}
+		counts[e.Kind][e.Name]++
+	}
+	return sorted(counts[KindFeature]), sorted(counts[KindError])
+}
+
+func sorted(counts map[string]int) []Count {
+	out := make([]Count, 0, len(counts))
+	for name, n := range counts {
+		out = append(out, Count{Name: name, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Drop the older half of the records once the file outgrows maxSize
+func trim(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= maxSize {
+		return
+	}
+
+	events, err := Read(path)
+	if err != nil {
+		return
+	}
+	events = events[len(events)/2:]
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		enc.Encode(e)
+	}
+
+	// Renamed into place, so a failure midway leaves the old file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honganh1206/tinker/tinkererr"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", FileName)
+	r := Open(path)
+
+	r.Feature("command stats")
+	r.Feature("tool bash")
+	r.Feature("tool bash")
+	r.Error(tinkererr.New(tinkererr.RateLimited, "too many requests to example.com"))
+	r.Error(errors.New("open /home/me/secret.txt: permission denied"))
+	r.Error(nil)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, private := range []string{"example.com", "secret.txt"} {
+		if strings.Contains(string(raw), private) {
+			t.Errorf("telemetry file holds %q, want names only:\n%s", private, raw)
+		}
+	}
+
+	events, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	features, errs := Summarize(events, time.Time{})
+
+	wantFeatures := []Count{{"tool bash", 2}, {"command stats", 1}}
+	if len(features) != len(wantFeatures) {
+		t.Fatalf("features = %v, want %v", features, wantFeatures)
+	}
+	for i := range wantFeatures {
+		if features[i] != wantFeatures[i] {
+			t.Errorf("features[%d] = %v, want %v", i, features[i], wantFeatures[i])
+		}
+	}
+
+	wantErrs := []Count{{"rate limited", 1}, {"unknown", 1}}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("errors = %v, want %v", errs, wantErrs)
+	}
+	for i := range wantErrs {
+		if errs[i] != wantErrs[i] {
+			t.Errorf("errors[%d] = %v, want %v", i, errs[i], wantErrs[i])
+		}
+	}
+
+	if features, _ := Summarize(events, time.Now().Add(time.Hour)); len(features) != 0 {
+		t.Errorf("Summarize() since a later time = %v, want none", features)
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.Feature("command stats")
+	r.Error(errors.New("failed"))
+}
+
+func TestRead_Missing(t *testing.T) {
+	events, err := Read(filepath.Join(t.TempDir(), FileName))
+	if err != nil || events != nil {
+		t.Errorf("Read() of a missing file = %v, %v, want nothing", events, err)
+	}
+}
+
+func TestOpen_Trim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	line := `{"time":"2026-01-02T03:04:05Z","kind":"feature","name":"tool read_file"}` + "\n"
+	if err := os.WriteFile(path, []byte(strings.Repeat(line, maxSize/len(line)+1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	before, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	Open(path)
+
+	after, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(after) != len(before)-len(before)/2 {
+		t.Errorf("%d records after trimming %d, want the newer half", len(after), len(before))
+	}
+}
@@ -0,0 +1,96 @@
+// Package tinkererr tags errors with the kind of failure they report, so callers can tell
+// a missing conversation from a busy provider with errors.Is instead of matching messages
+package tinkererr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// What went wrong, independent of the package reporting it.
+// A Kind is an error itself, so errors.Is(err, tinkererr.NotFound) checks for one
+type Kind int
+
+const (
+	Unknown Kind = iota
+	// A conversation, plan, step or other resource does not exist
+	NotFound
+	// Too many requests to the server or a provider, retrying later may succeed
+	RateLimited
+	// A tool call did not produce a result
+	ToolFailed
+	// The credentials are missing or not allowed to do this
+	PermissionDenied
+	// The provider cannot take the request right now, e.g., Anthropic's 529
+	ProviderOverloaded
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case RateLimited:
+		return "rate limited"
+	case ToolFailed:
+		return "tool failed"
+	case PermissionDenied:
+		return "permission denied"
+	case ProviderOverloaded:
+		return "provider overloaded"
+	default:
+		return "unknown"
+	}
+}
+
+func (k Kind) Error() string {
+	return k.String()
+}
+
+// Error of a known kind, reading as the error it wraps
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Matches the kind of e, the wrapped error is matched through Unwrap
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// New error of the given kind with the message text
+func New(kind Kind, text string) error {
+	return &Error{Kind: kind, Err: errors.New(text)}
+}
+
+// Like fmt.Errorf, %w keeps the wrapped error reachable
+func Errorf(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Tag err with kind, nil stays nil
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Kind of err, Unknown when it has none. Errors outside this package report
+// their kind with an Is method, like api.HTTPError does for its status code
+func KindOf(err error) Kind {
+	for _, kind := range []Kind{NotFound, RateLimited, ToolFailed, PermissionDenied, ProviderOverloaded} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return Unknown
+}
@@ -0,0 +1,32 @@
+package tinkererr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Is(t *testing.T) {
+	base := errors.New("connection reset")
+	err := fmt.Errorf("calling the provider: %w", Wrap(RateLimited, base))
+
+	assert.ErrorIs(t, err, RateLimited)
+	assert.ErrorIs(t, err, base)
+	assert.NotErrorIs(t, err, NotFound)
+	assert.Equal(t, "calling the provider: connection reset", err.Error())
+}
+
+func TestWrap_Nil(t *testing.T) {
+	assert.NoError(t, Wrap(NotFound, nil))
+}
+
+func TestKindOf(t *testing.T) {
+	sentinel := New(NotFound, "plan not found")
+
+	assert.Equal(t, NotFound, KindOf(fmt.Errorf("%w: cannot update", sentinel)))
+	assert.Equal(t, ToolFailed, KindOf(Errorf(ToolFailed, "tool %s failed", "bash")))
+	assert.Equal(t, Unknown, KindOf(errors.New("plain")))
+	assert.Equal(t, Unknown, KindOf(nil))
+}
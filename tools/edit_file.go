@@ -7,7 +7,9 @@ import (
 	"path"
 	"strings"
 
+	"github.com/honganh1206/tinker/message"
 	"github.com/honganh1206/tinker/schema"
+	"github.com/honganh1206/tinker/server/data"
 )
 
 // TODO: Embed markdown tool prompt
@@ -31,6 +33,20 @@ type EditFileInput struct {
 
 var EditFileInputSchema = schema.Generate[EditFileInput]()
 
+func init() {
+	// Transcripts show edits as diffs
+	data.EditDiff = func(blk message.ToolUseBlock) (string, string, bool) {
+		if blk.Name != ToolNameEditFile {
+			return "", "", false
+		}
+		input, err := schema.DecodeRaw[EditFileInput](blk.Input)
+		if err != nil || input.Path == "" {
+			return "", "", false
+		}
+		return input.Path, input.Diff(), true
+	}
+}
+
 func EditFile(input ToolInput) (string, error) {
 	editFileInput := EditFileInput{}
 	err := json.Unmarshal(input.RawInput, &editFileInput)
@@ -42,10 +58,11 @@ func EditFile(input ToolInput) (string, error) {
 		return "", fmt.Errorf("invalid input parameters")
 	}
 
-	content, err := os.ReadFile(editFileInput.Path)
+	fsys := input.fs()
+	content, err := fsys.ReadFile(editFileInput.Path)
 	if err != nil {
 		if os.IsNotExist(err) && editFileInput.OldStr == "" {
-			result, err := createNewFile(editFileInput.Path, editFileInput.NewStr)
+			result, err := createNewFile(fsys, editFileInput.Path, editFileInput.NewStr)
 			if err != nil {
 				return "", fmt.Errorf("error cannot create new file: %w", err)
 			}
@@ -62,7 +79,7 @@ func EditFile(input ToolInput) (string, error) {
 		return "", fmt.Errorf("old_str not found in file")
 	}
 
-	err = os.WriteFile(editFileInput.Path, []byte(newContent), 0o644)
+	err = fsys.WriteFile(editFileInput.Path, []byte(newContent), 0o644)
 	if err != nil {
 		return "", err
 	}
@@ -70,18 +87,36 @@ func EditFile(input ToolInput) (string, error) {
 	return "OK", nil
 }
 
-func createNewFile(filePath, content string) (string, error) {
+// The edit as the lines it removes and adds
+func (i EditFileInput) Diff() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", i.Path, i.Path)
+	for _, side := range []struct {
+		prefix string
+		text   string
+	}{{"-", i.OldStr}, {"+", i.NewStr}} {
+		if side.text == "" {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(side.text, "\n"), "\n") {
+			b.WriteString(side.prefix + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func createNewFile(fsys FS, filePath, content string) (string, error) {
 	dir := path.Dir(filePath)
 	if dir != "." {
 		// Default permission for dir
-		err := os.MkdirAll(dir, 0o755)
+		err := fsys.MkdirAll(dir, 0o755)
 		if err != nil {
 			return "", fmt.Errorf("failed to create directory: %w", err)
 		}
 	}
 
 	// Permission to read and write file
-	err := os.WriteFile(filePath, []byte(content), 0o644)
+	err := fsys.WriteFile(filePath, []byte(content), 0o644)
 	if err != nil {
 		return "", fmt.Errorf("failed to create file: %w", err)
 	}
@@ -423,6 +423,22 @@ func TestEditFile_MultipleEdits(t *testing.T) {
 	assert.Equal(t, "The fast brown cat jumps over the lazy dog", string(finalContent))
 }
 
+func TestEditFile_MemFS(t *testing.T) {
+	fsys := NewMemFS()
+
+	result, err := EditFile(fsInput(t, fsys, EditFileInput{Path: "src/main.go", NewStr: "package main"}))
+	assert.NoError(t, err)
+	assert.Contains(t, result, "successfully created file")
+
+	result, err = EditFile(fsInput(t, fsys, EditFileInput{Path: "src/main.go", OldStr: "main", NewStr: "tools"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", result)
+
+	content, err := fsys.ReadFile("src/main.go")
+	assert.NoError(t, err)
+	assert.Equal(t, "package tools", string(content))
+}
+
 // Benchmark tests
 func BenchmarkEditFile_SimpleReplacement(b *testing.B) {
 	content := "Hello world, this is a benchmark test"
@@ -0,0 +1,450 @@
+package tools
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// A tool was given a path outside of the directories the agent may work in
+var ErrOutsideWorkspace = errors.New("path is outside of the workspace")
+
+// Filesystem read_file, edit_file and list_files go through, in the spirit of afero.
+// The agent can be given one to keep it in its workspace, collect its edits instead of
+// writing them, or run the tools in memory
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	MkdirAll(path string, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	// Entries of the directory sorted by name, as os.ReadDir
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// The filesystem of the machine, tools use it when given no other
+type OSFS struct{}
+
+func (OSFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// Filesystem the tool call works on
+func (input ToolInput) fs() FS {
+	if input.ToolObject != nil && input.FS != nil {
+		return input.FS
+	}
+	return OSFS{}
+}
+
+// Like filepath.Walk, over fsys
+func walk(fsys FS, root string, fn filepath.WalkFunc) error {
+	info, err := fsys.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDir(fsys FS, path string, info fs.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	entries, err := fsys.ReadDir(path)
+	if err := fn(path, info, err); err != nil || entries == nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			if err := fn(child, info, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walkDir(fsys, child, info, fn); err != nil {
+			// Skipping a file skips the rest of its directory
+			if !info.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Filesystem held in memory, e.g., to run tools in tests without a temporary directory.
+// Paths are cleaned, "." and "/" always exist
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string][]byte),
+		dirs:  map[string]bool{".": true, "/": true},
+	}
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(data), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	if !m.dirs[filepath.Dir(name)] {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	m.files[name] = slices.Clone(data)
+	return nil
+}
+
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	for dir := path; !m.dirs[dir]; dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+		}
+	}
+	for dir := path; !m.dirs[dir]; dir = filepath.Dir(dir) {
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	if data, ok := m.files[name]; ok {
+		return memFileInfo{name: filepath.Base(name), size: int64(len(data))}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		if _, ok := m.files[name]; ok {
+			return nil, &fs.PathError{Op: "readdirent", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for dir := range m.dirs {
+		if dir != name && filepath.Dir(dir) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: filepath.Base(dir), dir: true}))
+		}
+	}
+	for file, data := range m.files {
+		if filepath.Dir(file) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: filepath.Base(file), size: int64(len(data))}))
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() any           { return nil }
+
+func (i memFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+func sortEntries(entries []fs.DirEntry) {
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+}
+
+// FS refusing paths outside of its roots, the working directory and the directories
+// added with --add-dir. Symlinks are followed on the disk, a link in the workspace
+// does not lead out of it
+type WorkspaceFS struct {
+	fs    FS
+	roots []string
+}
+
+// roots are absolute paths
+func NewWorkspaceFS(fsys FS, roots ...string) *WorkspaceFS {
+	w := &WorkspaceFS{fs: fsys}
+	for _, root := range roots {
+		w.roots = append(w.roots, w.resolve(filepath.Clean(root)))
+	}
+	return w
+}
+
+func (w *WorkspaceFS) check(op, name string) error {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	path = w.resolve(path)
+	for _, root := range w.roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: ErrOutsideWorkspace}
+}
+
+// Path with its symlinks resolved when on the disk. Only the part that exists is,
+// for the files and directories about to be created
+func (w *WorkspaceFS) resolve(path string) string {
+	if _, ok := w.fs.(OSFS); !ok {
+		return path
+	}
+	rest := ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func (w *WorkspaceFS) ReadFile(name string) ([]byte, error) {
+	if err := w.check("open", name); err != nil {
+		return nil, err
+	}
+	return w.fs.ReadFile(name)
+}
+
+func (w *WorkspaceFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := w.check("open", name); err != nil {
+		return err
+	}
+	return w.fs.WriteFile(name, data, perm)
+}
+
+func (w *WorkspaceFS) MkdirAll(path string, perm fs.FileMode) error {
+	if err := w.check("mkdir", path); err != nil {
+		return err
+	}
+	return w.fs.MkdirAll(path, perm)
+}
+
+func (w *WorkspaceFS) Stat(name string) (fs.FileInfo, error) {
+	if err := w.check("stat", name); err != nil {
+		return nil, err
+	}
+	return w.fs.Stat(name)
+}
+
+func (w *WorkspaceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := w.check("open", name); err != nil {
+		return nil, err
+	}
+	return w.fs.ReadDir(name)
+}
+
+// FS keeping what is written in memory over another, which is only read.
+// Tools see their own edits, Diff shows them all without a file being touched.
+// Over a WorkspaceFS, paths outside of the workspace are refused as they would be when writing
+type DryRunFS struct {
+	fs      FS
+	overlay *MemFS
+
+	mu sync.Mutex
+	// Absolute paths of the written files in the order of their first write
+	written []string
+	// Content before the first write by absolute path, nil for created files
+	original map[string][]byte
+	// Paths as the tools gave them, for the diff
+	names map[string]string
+}
+
+func NewDryRunFS(fsys FS) *DryRunFS {
+	return &DryRunFS{
+		fs:       fsys,
+		overlay:  NewMemFS(),
+		original: make(map[string][]byte),
+		names:    make(map[string]string),
+	}
+}
+
+// Overlay paths are absolute, so a file is the same whichever way a tool names it
+func abs(name string) string {
+	if p, err := filepath.Abs(name); err == nil {
+		return p
+	}
+	return filepath.Clean(name)
+}
+
+func (d *DryRunFS) ReadFile(name string) ([]byte, error) {
+	if _, err := d.overlay.Stat(abs(name)); err == nil {
+		return d.overlay.ReadFile(abs(name))
+	}
+	return d.fs.ReadFile(name)
+}
+
+func (d *DryRunFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	path := abs(name)
+	if info, err := d.fs.Stat(name); err == nil && info.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	if _, err := d.Stat(filepath.Dir(name)); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.names[path]; !ok {
+		original, err := d.fs.ReadFile(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		d.written = append(d.written, path)
+		d.original[path] = original
+		d.names[path] = name
+	}
+
+	if err := d.overlay.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return d.overlay.WriteFile(path, data, perm)
+}
+
+func (d *DryRunFS) MkdirAll(path string, perm fs.FileMode) error {
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if info, err := d.fs.Stat(dir); err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+			}
+			break
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return d.overlay.MkdirAll(abs(path), perm)
+}
+
+func (d *DryRunFS) Stat(name string) (fs.FileInfo, error) {
+	if info, err := d.overlay.Stat(abs(name)); err == nil {
+		return info, nil
+	}
+	return d.fs.Stat(name)
+}
+
+func (d *DryRunFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := d.fs.ReadDir(name)
+	created, createdErr := d.overlay.ReadDir(abs(name))
+	if createdErr != nil {
+		return entries, err
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// Written files replace those on the disk
+	entries = slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return slices.ContainsFunc(created, func(c fs.DirEntry) bool { return c.Name() == entry.Name() })
+	})
+	entries = append(entries, created...)
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Unified diff of the files written, in the order they were first. Empty when nothing changed
+func (d *DryRunFS) Diff() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	for _, path := range d.written {
+		original := d.original[path]
+		current, _ := d.overlay.ReadFile(path)
+		if original != nil && string(original) == string(current) {
+			continue
+		}
+
+		name := filepath.ToSlash(d.names[path])
+		from := "a/" + strings.TrimPrefix(name, "/")
+		if original == nil {
+			from = "/dev/null"
+		}
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(original)),
+			B:        difflib.SplitLines(string(current)),
+			FromFile: from,
+			ToFile:   "b/" + strings.TrimPrefix(name, "/"),
+			Context:  3,
+		})
+		b.WriteString(diff)
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Input of a tool call working on fsys
+func fsInput(t *testing.T, fsys FS, input any) ToolInput {
+	t.Helper()
+	raw, err := json.Marshal(input)
+	require.NoError(t, err)
+	return ToolInput{RawInput: raw, ToolObject: &ToolObject{FS: fsys}}
+}
+
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+
+	err := fsys.WriteFile("missing/a.txt", []byte("a"), 0o644)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, fsys.MkdirAll("src/pkg", 0o755))
+	require.NoError(t, fsys.WriteFile("src/pkg/a.go", []byte("package pkg"), 0o644))
+	require.NoError(t, fsys.WriteFile("src/main.go", []byte("package main"), 0o644))
+
+	content, err := fsys.ReadFile("./src/pkg/a.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package pkg", string(content))
+
+	entries, err := fsys.ReadDir("src")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "main.go", entries[0].Name())
+	assert.Equal(t, "pkg", entries[1].Name())
+	assert.True(t, entries[1].IsDir())
+
+	_, err = fsys.ReadFile("src")
+	assert.Error(t, err)
+	assert.Error(t, fsys.MkdirAll("src/main.go/sub", 0o755))
+}
+
+func TestWorkspaceFS(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "in.txt"), []byte("in"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+
+	fsys := NewWorkspaceFS(OSFS{}, root)
+
+	content, err := ReadFile(fsInput(t, fsys, ReadFileInput{Path: filepath.Join(root, "in.txt")}))
+	require.NoError(t, err)
+	assert.Equal(t, "in", content)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"outside", filepath.Join(outside, "secret.txt")},
+		{"parent", filepath.Join(root, "..", filepath.Base(outside), "secret.txt")},
+		{"symlink", filepath.Join(root, "link", "secret.txt")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadFile(fsInput(t, fsys, ReadFileInput{Path: tt.path}))
+			assert.ErrorIs(t, err, ErrOutsideWorkspace)
+		})
+	}
+
+	// New files are fine anywhere in the workspace, not out of it
+	_, err = EditFile(fsInput(t, fsys, EditFileInput{Path: filepath.Join(root, "new", "file.txt"), NewStr: "new"}))
+	assert.NoError(t, err)
+	_, err = EditFile(fsInput(t, fsys, EditFileInput{Path: filepath.Join(outside, "new.txt"), NewStr: "new"}))
+	assert.ErrorIs(t, err, ErrOutsideWorkspace)
+	assert.NoFileExists(t, filepath.Join(outside, "new.txt"))
+}
+
+func TestDryRunFS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0o644))
+
+	fsys := NewDryRunFS(OSFS{})
+
+	_, err := EditFile(fsInput(t, fsys, EditFileInput{Path: path, OldStr: "func main() {}", NewStr: "func main() {\n\tprintln(\"hi\")\n}"}))
+	require.NoError(t, err)
+	_, err = EditFile(fsInput(t, fsys, EditFileInput{Path: filepath.Join(dir, "docs", "README.md"), NewStr: "# Hi\n"}))
+	require.NoError(t, err)
+
+	// Nothing reached the disk
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc main() {}\n", string(content))
+	assert.NoDirExists(t, filepath.Join(dir, "docs"))
+
+	// The tools see the edits
+	read, err := ReadFile(fsInput(t, fsys, ReadFileInput{Path: path}))
+	require.NoError(t, err)
+	assert.Contains(t, read, "println")
+	listing, err := ListFiles(fsInput(t, fsys, ListFilesInput{Path: dir}))
+	require.NoError(t, err)
+	assert.Equal(t, `["docs/","docs/README.md","main.go"]`, listing)
+
+	diff := fsys.Diff()
+	assert.Contains(t, diff, "-func main() {}\n+func main() {\n+\tprintln(\"hi\")\n+}\n")
+	assert.Contains(t, diff, "--- /dev/null\n")
+	assert.Contains(t, diff, "+# Hi\n")
+}
+
+func TestDryRunFS_Workspace(t *testing.T) {
+	root := t.TempDir()
+	fsys := NewDryRunFS(NewWorkspaceFS(OSFS{}, root))
+
+	_, err := EditFile(fsInput(t, fsys, EditFileInput{Path: filepath.Join(t.TempDir(), "new.txt"), NewStr: "new"}))
+	assert.ErrorIs(t, err, ErrOutsideWorkspace)
+	assert.Empty(t, fsys.Diff())
+}
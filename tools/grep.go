@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/honganh1206/tinker/schema"
@@ -13,6 +14,9 @@ import (
 //go:embed grep.md
 var grepSearchPrompt string
 
+// Matches past this are left out of a file, they rarely tell more than the first ones
+const maxMatchesPerFile = 15
+
 var GrepSearchDefinition = ToolDefinition{
 	Name:        ToolNameGrepSearch,
 	Description: grepSearchPrompt,
@@ -38,7 +42,7 @@ func GrepSearch(input ToolInput) (string, error) {
 		return "", fmt.Errorf("invalid pattern parameter")
 	}
 
-	args := []string{"rg", "--json", searchInput.Pattern}
+	args := []string{"rg", "--json", "--max-count", strconv.Itoa(maxMatchesPerFile), searchInput.Pattern}
 
 	if searchInput.Directory != "" {
 		args = append(args, searchInput.Directory)
@@ -2,15 +2,19 @@ package tools
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/honganh1206/tinker/schema"
 )
 
+// Entries past this are left out, a listing of a whole repository costs more tokens than it is worth
+const maxListedFiles = 500
+
 var ListFilesDefinition = ToolDefinition{
 	Name:        "list_files",
-	Description: "List files and directories at a given path. If no path is provided, list files in the current directory",
+	Description: "List the files and directories under a given path, recursively. If no path is provided, list the current directory. Only use it to see the layout of a specific directory, never on the root of a repository: find files with grep_search and read a file you know the path of with read_file directly. Listings stop after 500 entries",
 	InputSchema: ListFilesInputSchema,
 	Function:    ListFiles,
 }
@@ -36,7 +40,7 @@ func ListFiles(input ToolInput) (string, error) {
 
 	var fileNames []string
 
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err = walk(input.fs(), dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -52,6 +56,11 @@ func ListFiles(input ToolInput) (string, error) {
 			return err
 		}
 
+		if len(fileNames) >= maxListedFiles {
+			fileNames = append(fileNames, fmt.Sprintf("... more entries left out, list a subdirectory or search with %s", ToolNameGrepSearch))
+			return filepath.SkipAll
+		}
+
 		if relPath != "." {
 			if info.IsDir() {
 				fileNames = append(fileNames, relPath+"/")
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -179,6 +180,30 @@ func TestListFiles_GitDirectorySkipped(t *testing.T) {
 	assert.True(t, fileMap["README.md"])
 }
 
+func TestListFiles_Truncated(t *testing.T) {
+	testDir := t.TempDir()
+	for i := range maxListedFiles + 10 {
+		err := os.WriteFile(filepath.Join(testDir, fmt.Sprintf("file%04d.go", i)), []byte("package main"), 0644)
+		if err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	input := ListFilesInput{Path: testDir}
+	inputJSON, _ := json.Marshal(input)
+
+	result, err := ListFiles(ToolInput{RawInput: inputJSON})
+	assert.NoError(t, err)
+
+	var files []string
+	err = json.Unmarshal([]byte(result), &files)
+	assert.NoError(t, err)
+
+	// The listing stops with a hint at cheaper tools
+	assert.Len(t, files, maxListedFiles+1)
+	assert.Contains(t, files[maxListedFiles], ToolNameGrepSearch)
+}
+
 func TestListFiles_DirectoryIndicator(t *testing.T) {
 	testDir := createTestDirectoryForList(t)
 
@@ -431,6 +456,21 @@ func TestListFiles_ComplexDirectoryStructure(t *testing.T) {
 	assert.True(t, fileMap["tests/"])
 }
 
+func TestListFiles_MemFS(t *testing.T) {
+	fsys := NewMemFS()
+	assert.NoError(t, fsys.MkdirAll("repo/.git/objects", 0o755))
+	assert.NoError(t, fsys.MkdirAll("repo/cmd", 0o755))
+	assert.NoError(t, fsys.WriteFile("repo/cmd/main.go", []byte("package main"), 0o644))
+	assert.NoError(t, fsys.WriteFile("repo/go.mod", []byte("module repo"), 0o644))
+
+	result, err := ListFiles(fsInput(t, fsys, ListFilesInput{Path: "repo"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `["cmd/","cmd/main.go","go.mod"]`, result)
+
+	_, err = ListFiles(fsInput(t, fsys, ListFilesInput{Path: "missing"}))
+	assert.Error(t, err)
+}
+
 // Benchmark tests
 func BenchmarkListFiles_SmallDirectory(b *testing.B) {
 	// Create small directory with few files
@@ -29,6 +29,7 @@ type PlanStepInput struct {
 	Status             string   `json:"status" jsonschema_description:"The status to set: 'DONE' or 'TODO'."`
 	Description        string   `json:"description" jsonschema_description:"A detailed description of the step's task."`
 	AcceptanceCriteria []string `json:"acceptance_criteria,omitempty" jsonschema_description:"A list of criteria that must be met for the step to be considered DONE."`
+	Notes              string   `json:"notes,omitempty" jsonschema_description:"Optional remarks on the step, e.g., constraints or open questions."`
 }
 
 var PlanStepSchema = schema.Generate[PlanStepInput]()
@@ -90,6 +91,9 @@ func handleSetStatus(input *PlanWriteInput, plan *data.Plan) (string, error) {
 
 	stepID := input.StepID
 	status := input.Status
+	if stepID == "" {
+		return "", fmt.Errorf("plan_write: 'set_status' requires 'step_id'")
+	}
 
 	var err error
 	if status == "DONE" {
@@ -107,6 +111,9 @@ func handleSetStatus(input *PlanWriteInput, plan *data.Plan) (string, error) {
 
 func handleAddSteps(input *PlanWriteInput, plan *data.Plan) (string, error) {
 	stepsToAdd := input.StepsToAdd
+	if len(stepsToAdd) == 0 {
+		return "", fmt.Errorf("plan_write: 'add_steps' requires 'steps_to_add'")
+	}
 
 	addedCount := 0
 	for i, s := range stepsToAdd {
@@ -126,6 +133,7 @@ func handleAddSteps(input *PlanWriteInput, plan *data.Plan) (string, error) {
 		}
 
 		plan.AddStep(id, description, criteria)
+		plan.Steps[len(plan.Steps)-1].Notes = s.Notes
 		addedCount++
 	}
 
@@ -35,10 +35,15 @@ func createToolInput(inputJSON []byte) ToolInput {
 	}
 }
 
+// Like createToolInput, with a plan holding the step step-1
+func createToolInputWithStep(inputJSON []byte) ToolInput {
+	input := createToolInput(inputJSON)
+	input.Plan.AddStep("step-1", "First test step", nil)
+	return input
+}
+
 // Tests for PlanWrite function - ActionAddSteps
 func TestPlanWrite_AddSteps_Success(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionAddSteps,
 		StepsToAdd: []PlanStepInput{
@@ -58,12 +63,10 @@ func TestPlanWrite_AddSteps_Success(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, result)
-	assert.Contains(t, result, "Added 1 steps to plan 'test-plan'")
+	assert.Contains(t, result, "Added 1 steps to plan ID 'test-plan'")
 }
 
 func TestPlanWrite_AddSteps_MultipleSteps(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionAddSteps,
 		StepsToAdd: []PlanStepInput{
@@ -90,8 +93,6 @@ func TestPlanWrite_AddSteps_MultipleSteps(t *testing.T) {
 }
 
 func TestPlanWrite_AddSteps_MissingStepID(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionAddSteps,
 		StepsToAdd: []PlanStepInput{
@@ -111,8 +112,6 @@ func TestPlanWrite_AddSteps_MissingStepID(t *testing.T) {
 }
 
 func TestPlanWrite_AddSteps_MissingDescription(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionAddSteps,
 		StepsToAdd: []PlanStepInput{
@@ -133,8 +132,6 @@ func TestPlanWrite_AddSteps_MissingDescription(t *testing.T) {
 
 // Tests for PlanWrite function - ActionSetStatus
 func TestPlanWrite_SetStatus_ToDone(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionSetStatus,
 		StepID: "step-1",
@@ -142,16 +139,15 @@ func TestPlanWrite_SetStatus_ToDone(t *testing.T) {
 	}
 	inputJSON, _ := json.Marshal(input)
 
-	result, err := PlanWrite(createToolInput(inputJSON))
+	toolInput := createToolInputWithStep(inputJSON)
+	result, err := PlanWrite(toolInput)
 
 	assert.NoError(t, err)
-	assert.NotEmpty(t, result)
-	assert.Contains(t, result, "Step 'step-1' in plan 'test-plan' set to")
+	assert.Contains(t, result, "Step 'step-1' in plan 'test-plan' set to 'DONE'")
+	assert.Equal(t, "DONE", toolInput.Plan.Steps[0].Status)
 }
 
 func TestPlanWrite_SetStatus_ToTodo(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionSetStatus,
 		StepID: "step-1",
@@ -159,15 +155,16 @@ func TestPlanWrite_SetStatus_ToTodo(t *testing.T) {
 	}
 	inputJSON, _ := json.Marshal(input)
 
-	result, err := PlanWrite(createToolInput(inputJSON))
+	toolInput := createToolInputWithStep(inputJSON)
+	toolInput.Plan.Steps[0].Status = "DONE"
+	result, err := PlanWrite(toolInput)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, result)
+	assert.Equal(t, "TODO", toolInput.Plan.Steps[0].Status)
 }
 
 func TestPlanWrite_SetStatus_MissingStepID(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionSetStatus,
 		StepID: "",
@@ -175,16 +172,14 @@ func TestPlanWrite_SetStatus_MissingStepID(t *testing.T) {
 	}
 	inputJSON, _ := json.Marshal(input)
 
-	result, err := PlanWrite(createToolInput(inputJSON))
+	result, err := PlanWrite(createToolInputWithStep(inputJSON))
 
 	assert.Error(t, err)
 	assert.Empty(t, result)
 	assert.Contains(t, err.Error(), "'set_status' requires 'step_id'")
 }
 
-func TestPlanWrite_SetStatus_NonexistentPlan(t *testing.T) {
-	t.Skip("Requires running API server")
-
+func TestPlanWrite_SetStatus_NonexistentStep(t *testing.T) {
 	input := PlanWriteInput{
 		Action: ActionSetStatus,
 		StepID: "step-1",
@@ -196,12 +191,11 @@ func TestPlanWrite_SetStatus_NonexistentPlan(t *testing.T) {
 
 	assert.Error(t, err)
 	assert.Empty(t, result)
-	assert.Contains(t, err.Error(), "failed to get plan")
+	assert.Contains(t, err.Error(), "step with ID 'step-1' not found in plan 'test-plan'")
 }
 
 // Tests for error cases
 func TestPlanWrite_EmptyPlanName(t *testing.T) {
-	t.Skip("Requires running API server")
 	input := PlanWriteInput{
 		Action: ActionAddSteps,
 	}
@@ -339,8 +333,6 @@ func TestWriteAction_Values(t *testing.T) {
 
 // Table-driven tests
 func TestPlanWrite_VariousInputs(t *testing.T) {
-	t.Skip("Requires running API server")
-
 	tests := []struct {
 		name        string
 		input       PlanWriteInput
@@ -357,14 +349,6 @@ func TestPlanWrite_VariousInputs(t *testing.T) {
 			},
 			expectError: false,
 		},
-		{
-			name: "missing plan name",
-			input: PlanWriteInput{
-				Action: ActionAddSteps,
-			},
-			expectError: true,
-			errorMsg:    "missing or invalid plan_name",
-		},
 		{
 			name: "set status without step id",
 			input: PlanWriteInput{
@@ -375,6 +359,14 @@ func TestPlanWrite_VariousInputs(t *testing.T) {
 			expectError: true,
 			errorMsg:    "requires 'step_id'",
 		},
+		{
+			name: "add steps without steps",
+			input: PlanWriteInput{
+				Action: ActionAddSteps,
+			},
+			expectError: true,
+			errorMsg:    "requires 'steps_to_add'",
+		},
 		{
 			name: "add step without id",
 			input: PlanWriteInput{
@@ -421,8 +413,6 @@ func TestPlanWrite_VariousInputs(t *testing.T) {
 
 // Benchmark tests
 func BenchmarkPlanWrite_AddSteps(b *testing.B) {
-	b.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionAddSteps,
 		StepsToAdd: []PlanStepInput{
@@ -438,8 +428,6 @@ func BenchmarkPlanWrite_AddSteps(b *testing.B) {
 }
 
 func BenchmarkPlanWrite_SetStatus(b *testing.B) {
-	b.Skip("Requires running API server")
-
 	input := PlanWriteInput{
 		Action: ActionSetStatus,
 		StepID: "step-1",
@@ -449,7 +437,7 @@ func BenchmarkPlanWrite_SetStatus(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		PlanWrite(createToolInput(inputJSON))
+		PlanWrite(createToolInputWithStep(inputJSON))
 	}
 }
 
@@ -3,7 +3,6 @@ package tools
 import (
 	_ "embed"
 	"encoding/json"
-	"os"
 
 	"github.com/honganh1206/tinker/schema"
 )
@@ -28,10 +27,10 @@ func ReadFile(input ToolInput) (string, error) {
 	readFileInput := ReadFileInput{}
 	err := json.Unmarshal(input.RawInput, &readFileInput)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	content, err := os.ReadFile(readFileInput.Path)
+	content, err := input.fs().ReadFile(readFileInput.Path)
 	if err != nil {
 		return "", err
 	}
@@ -88,15 +88,10 @@ func TestReadFile_LargeFile(t *testing.T) {
 func TestReadFile_InvalidJSON(t *testing.T) {
 	invalidJSON := []byte(`{"invalid": json}`)
 
-	// ReadFile panics on JSON unmarshal error, so we need to recover from panic
-	defer func() {
-		if r := recover(); r != nil {
-			assert.NotNil(t, r)
-		}
-	}()
-
-	ReadFile(ToolInput{RawInput: invalidJSON})
-	t.Error("Expected panic but didn't get one")
+	result, err := ReadFile(ToolInput{RawInput: invalidJSON})
+
+	assert.Error(t, err)
+	assert.Empty(t, result)
 }
 
 func TestReadFile_BinaryFile(t *testing.T) {
@@ -271,6 +266,18 @@ func TestReadFile_VariousFileTypes(t *testing.T) {
 	}
 }
 
+func TestReadFile_MemFS(t *testing.T) {
+	fsys := NewMemFS()
+	assert.NoError(t, fsys.WriteFile("notes.txt", []byte("buy milk"), 0o644))
+
+	result, err := ReadFile(fsInput(t, fsys, ReadFileInput{Path: "notes.txt"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "buy milk", result)
+
+	_, err = ReadFile(fsInput(t, fsys, ReadFileInput{Path: "missing.txt"}))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
 // Benchmark tests
 func BenchmarkReadFile_SmallFile(b *testing.B) {
 	content := "Small file content for benchmarking"
@@ -32,6 +32,8 @@ type ToolDefinition struct {
 
 type ToolObject struct {
 	Plan *data.Plan
+	// Filesystem of the file tools, the disk when nil
+	FS FS
 }
 
 type ToolInput struct {
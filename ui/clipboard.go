@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Tools tried in order when the terminal may not honor OSC52
+var nativeClipboards = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip.exe"}},
+	"linux": {
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+		// WSL
+		{"clip.exe"},
+	},
+}
+
+// Tools printing the clipboard as PNG, failing or printing nothing without an image
+var nativeImagePastes = map[string][][]string{
+	"darwin": {{"pngpaste", "-"}},
+	"linux": {
+		{"wl-paste", "--no-newline", "--type", "image/png"},
+		{"xclip", "-selection", "clipboard", "-t", "image/png", "-o"},
+	},
+}
+
+var ErrNoClipboardImage = errors.New("no image on the clipboard")
+
+// Image on the system clipboard, as terminals only paste text
+func ClipboardImage() ([]byte, error) {
+	for _, args := range nativeImagePastes[runtime.GOOS] {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err == nil && len(out) > 0 {
+			return out, nil
+		}
+	}
+
+	return nil, ErrNoClipboardImage
+}
+
+// Put text on the system clipboard. The OSC52 escape reaches the local clipboard
+// through SSH and tmux, native tools cover terminals that ignore it.
+// Fails only when neither could be used
+func CopyToClipboard(text string) error {
+	oscErr := writeOSC52(text)
+	nativeErr := copyNative(text)
+
+	if oscErr != nil && nativeErr != nil {
+		return fmt.Errorf("no clipboard available: %w", errors.Join(oscErr, nativeErr))
+	}
+	return nil
+}
+
+// Escape sequence asking the terminal to set its clipboard, wrapped for tmux when inside it
+func OSC52(text string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"
+	if os.Getenv("TMUX") != "" {
+		// tmux passes through sequences in a DCS with their escapes doubled
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+func writeOSC52(text string) error {
+	// The terminal itself, stdout may be redirected
+	var tty io.Writer = os.Stderr
+	if f, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer f.Close()
+		tty = f
+	}
+
+	_, err := io.WriteString(tty, OSC52(text))
+	return err
+}
+
+func copyNative(text string) error {
+	for _, args := range nativeClipboards[runtime.GOOS] {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = bytes.NewBufferString(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return nil
+	}
+
+	return errors.New("no native clipboard tool found")
+}
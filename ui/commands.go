@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Command typed in the question input as /name followed by its arguments
+type Command struct {
+	Name        string
+	Description string
+	// Shown after the name in the completion list e.g., "[model]"
+	Usage string
+	// Receives the rest of the line, trimmed
+	Run func(args string) error
+}
+
+// Commands available in the question input. Features register theirs at startup,
+// MCP servers as their prompts become known
+type Commands struct {
+	mu     sync.RWMutex
+	byName map[string]Command
+}
+
+func NewCommands() *Commands {
+	return &Commands{byName: make(map[string]Command)}
+}
+
+func (c *Commands) Register(cmd Command) error {
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " /") {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.byName[cmd.Name]; ok {
+		return fmt.Errorf("command /%s is already registered", cmd.Name)
+	}
+	c.byName[cmd.Name] = cmd
+
+	return nil
+}
+
+func (c *Commands) Lookup(name string) (Command, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cmd, ok := c.byName[name]
+	return cmd, ok
+}
+
+// Commands whose name starts with prefix, sorted by name
+func (c *Commands) Complete(prefix string) []Command {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var matches []Command
+	for name, cmd := range c.byName {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, cmd)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+
+	return matches
+}
+
+// Split input like "/model gemini-2.5-pro" into the command name and its arguments.
+// False when the input is not a command, so a message starting with a path like /usr/bin is sent as is
+func ParseCommand(input string) (name, args string, ok bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(input), "/")
+	if !ok {
+		return "", "", false
+	}
+
+	name = rest
+	if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+		name, args = rest[:i], rest[i:]
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+
+	return name, strings.TrimSpace(args), true
+}
@@ -2,6 +2,9 @@ package ui
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
 )
 
 const (
@@ -14,31 +17,51 @@ type ToolResultFormat struct {
 	Name    string
 	Detail  string
 	IsError bool
+	// Shown after the detail when set
+	Duration time.Duration
 }
 
 func FormatToolResult(f ToolResultFormat) string {
+	t := CurrentTheme()
+	symbol, color := SuccessSymbol, t.Success
 	if f.IsError {
-		if f.Detail != "" {
-			return fmt.Sprintf("[red]%s [white::-]%s [blue]%s[white::-]\n\n", ErrorSymbol, f.Name, f.Detail)
-		}
-		return fmt.Sprintf("[red]%s [white::-]%s\n\n", ErrorSymbol, f.Name)
+		symbol, color = ErrorSymbol, t.Error
 	}
 
+	line := fmt.Sprintf("[%s::]%s [%s::-]%s", color, symbol, t.Text, f.Name)
 	if f.Detail != "" {
-		return fmt.Sprintf("[green]%s [white::-]%s [blue]%s[white::-]\n\n", SuccessSymbol, f.Name, f.Detail)
+		line += fmt.Sprintf(" [%s::]%s[%s::-]", t.Detail, tview.Escape(f.Detail), t.Text)
 	}
-
-	return fmt.Sprintf("[green]%s [white::-]%s\n\n", SuccessSymbol, f.Name)
+	return line + formatToolDuration(f.Duration) + "\n\n"
 }
 
 func FormatListFilesToolResult(f ToolResultFormat) string {
+	t := CurrentTheme()
 	if f.IsError {
 		if f.Detail != "" {
-			return fmt.Sprintf("[red]%s [white::-]%s [blue]%s[white::-]\n\n", ErrorSymbol, FolderSymbol, f.Detail)
+			return fmt.Sprintf("[%s::]%s [%s::-]%s [%s::]%s[%s::-]%s\n\n", t.Error, ErrorSymbol, t.Text, FolderSymbol, t.Detail, tview.Escape(f.Detail), t.Text, formatToolDuration(f.Duration))
 		}
-		return fmt.Sprintf("[red]%s [white::-]%s\n\n", ErrorSymbol, FolderSymbol)
+		return fmt.Sprintf("[%s::]%s [%s::-]%s%s\n\n", t.Error, ErrorSymbol, t.Text, FolderSymbol, formatToolDuration(f.Duration))
 	}
 
-	return fmt.Sprintf("[green]%s [white::-]%s\n\n", SuccessSymbol, FolderSymbol)
+	return fmt.Sprintf("[%s::]%s [%s::-]%s%s\n\n", t.Success, SuccessSymbol, t.Text, FolderSymbol, formatToolDuration(f.Duration))
 }
 
+func formatToolDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%s::]%s[%s::-]", CurrentTheme().Muted, FormatDuration(d), CurrentTheme().Text)
+}
+
+// e.g., 85ms, 1.2s, 2m5s
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/honganh1206/tinker/utils"
+)
+
+// Prompts kept for recall, older ones are dropped
+const maxHistoryEntries = 1000
+
+// Prompts sent from the input, recalled newest first
+type InputHistory struct {
+	entries []string
+	// Entry being recalled, len(entries) when none is
+	pos int
+	// File entries are appended to, empty to keep them in memory only
+	path string
+}
+
+func NewInputHistory() *InputHistory {
+	return &InputHistory{}
+}
+
+// History shared across runs, one JSON string per line so prompts can span lines
+func LoadInputHistory(path string) (*InputHistory, error) {
+	h := &InputHistory{path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, fmt.Errorf("failed to read input history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry string
+		// A line cut short by a crash is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil && entry != "" {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("failed to read input history: %w", err)
+	}
+
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[len(h.entries)-maxHistoryEntries:]
+		if err := h.rewrite(); err != nil {
+			return h, err
+		}
+	}
+	h.pos = len(h.entries)
+
+	return h, nil
+}
+
+// Record a sent prompt and stop recalling. Repeating the last one is not recorded twice
+func (h *InputHistory) Add(entry string) error {
+	h.pos = len(h.entries)
+	if strings.TrimSpace(entry) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[1:]
+	}
+	h.pos = len(h.entries)
+
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return fmt.Errorf("failed to save input history: %w", err)
+	}
+	// Prompts can carry anything, so only the user reads them
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to save input history: %w", err)
+	}
+	defer f.Close()
+
+	line, _ := json.Marshal(entry)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to save input history: %w", err)
+	}
+	return nil
+}
+
+func (h *InputHistory) rewrite() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		line, _ := json.Marshal(entry)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(h.path, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to trim input history: %w", err)
+	}
+	return nil
+}
+
+// Whether text is the entry being recalled, left as it was
+func (h *InputHistory) Recalling(text string) bool {
+	return h.pos < len(h.entries) && h.entries[h.pos] == text
+}
+
+// The entry before the one being recalled, false at the oldest
+func (h *InputHistory) Prev() (string, bool) {
+	if h.pos == 0 {
+		return "", false
+	}
+	h.pos--
+	return h.entries[h.pos], true
+}
+
+// The entry after the one being recalled, with an empty input past the newest
+func (h *InputHistory) Next() (string, bool) {
+	if h.pos >= len(h.entries) {
+		return "", false
+	}
+	h.pos++
+	if h.pos == len(h.entries) {
+		return "", true
+	}
+	return h.entries[h.pos], true
+}
+
+// Stop recalling, as the input was edited
+func (h *InputHistory) Reset() {
+	h.pos = len(h.entries)
+}
+
+func InputHistoryPath() (string, error) {
+	dir, err := utils.DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "input_history"), nil
+}
@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInputHistory_Recall(t *testing.T) {
+	h := NewInputHistory()
+	for _, entry := range []string{"first", "second", "second", "third"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for {
+		entry, ok := h.Prev()
+		if !ok {
+			break
+		}
+		got = append(got, entry)
+	}
+	if want := "third,second,first"; strings.Join(got, ",") != want {
+		t.Errorf("Prev() = %v, want %s", got, want)
+	}
+
+	if entry, _ := h.Next(); entry != "second" {
+		t.Errorf("Next() = %q, want second", entry)
+	}
+	if !h.Recalling("second") || h.Recalling("second, edited") {
+		t.Error("Recalling should only hold for the entry as recalled")
+	}
+
+	h.Next()
+	if entry, ok := h.Next(); !ok || entry != "" {
+		t.Errorf("Next() past the newest = %q, %v, want an empty input", entry, ok)
+	}
+	if _, ok := h.Next(); ok {
+		t.Error("Next() with nothing recalled should do nothing")
+	}
+}
+
+func TestInputHistory_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tinker", "input_history")
+
+	h, err := LoadInputHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add("fix the\nfailing test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add("  "); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("history file mode = %o, want 600", perm)
+	}
+
+	reloaded, err := LoadInputHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := reloaded.Prev(); !ok || entry != "fix the\nfailing test" {
+		t.Errorf("Prev() after reload = %q, %v", entry, ok)
+	}
+	if _, ok := reloaded.Prev(); ok {
+		t.Error("blank entries should not be recorded")
+	}
+}
+
+func TestSettings_Validate(t *testing.T) {
+	if err := DefaultSettings().Validate(); err != nil {
+		t.Errorf("default settings: %v", err)
+	}
+	if err := (Settings{History: "forever"}).Validate(); err == nil {
+		t.Error("expected an error for an unknown history mode")
+	}
+	if err := (Settings{History: HistorySession, Notify: "loudly"}).Validate(); err == nil {
+		t.Error("expected an error for an unknown notify mode")
+	}
+}
+
+func TestSettings_NeedsApproval(t *testing.T) {
+	if DefaultSettings().NeedsApproval("bash") {
+		t.Error("no tool should wait for approval by default")
+	}
+	s := Settings{Approve: []string{"bash", "edit_file"}}
+	if !s.NeedsApproval("bash") || s.NeedsApproval("read_file") {
+		t.Error("only the listed tools should wait for approval")
+	}
+	if !(Settings{Approve: []string{"*"}}).NeedsApproval("read_file") {
+		t.Error("* should cover every tool")
+	}
+}
@@ -0,0 +1,345 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const keymapFile = "keys.json"
+
+// Something a key can be bound to in the TUI
+type Action string
+
+const (
+	ActionSubmit             Action = "submit"
+	ActionNewline            Action = "newline"
+	ActionFocusConversation  Action = "focus_conversation"
+	ActionFocusInput         Action = "focus_input"
+	ActionSwitchConversation Action = "switch_conversation"
+	ActionScrollUp           Action = "scroll_up"
+	ActionScrollDown         Action = "scroll_down"
+	ActionCopyResponse       Action = "copy_response"
+	ActionCopyCode           Action = "copy_code"
+	ActionSearch             Action = "search"
+	ActionSearchNext         Action = "search_next"
+	ActionSearchPrev         Action = "search_prev"
+	ActionNextToolCall       Action = "next_tool_call"
+	ActionPrevToolCall       Action = "prev_tool_call"
+	ActionToggleToolCall     Action = "toggle_tool_call"
+	ActionFocusPlan          Action = "focus_plan"
+	ActionTogglePlan         Action = "toggle_plan"
+	ActionStepDown           Action = "step_down"
+	ActionStepUp             Action = "step_up"
+	ActionToggleStep         Action = "toggle_step"
+	ActionStepDetails        Action = "step_details"
+	ActionAllowOnce          Action = "allow_once"
+	ActionAllowAlways        Action = "allow_always"
+	ActionDeny               Action = "deny"
+	ActionRestartServer      Action = "restart_server"
+	ActionToggleTool         Action = "toggle_tool"
+	ActionRetry              Action = "retry"
+	ActionErrorDetails       Action = "error_details"
+	ActionComplete           Action = "complete"
+	ActionCancel             Action = "cancel"
+	ActionHelp               Action = "help"
+)
+
+type actionInfo struct {
+	action      Action
+	description string
+	defaults    []string
+}
+
+// In the order the help overlay lists them
+var actions = []actionInfo{
+	{ActionSubmit, "Send the message", []string{"Enter"}},
+	// Few terminals tell Shift+Enter from Enter, the others are the fallbacks
+	{ActionNewline, "Start a new line in the message", []string{"Shift+Enter", "Alt+Enter", "Ctrl+J"}},
+	{ActionComplete, "Complete the command or file being typed", []string{"Tab"}},
+	{ActionFocusConversation, "Move from the input to the conversation", []string{"Esc"}},
+	{ActionFocusInput, "Move from the conversation back to the input", []string{"Enter"}},
+	{ActionScrollUp, "Scroll the conversation a page up, from the input too", []string{"PgUp"}},
+	{ActionScrollDown, "Scroll the conversation a page down, back to following it at the end", []string{"PgDn"}},
+	{ActionCopyResponse, "Copy the last response, in the conversation", []string{"y"}},
+	{ActionCopyCode, "Copy a code block of the last response, in the conversation", []string{"c"}},
+	{ActionSearch, "Search the conversation, in the conversation", []string{"/"}},
+	{ActionSearchNext, "Jump to the next match of the search", []string{"n"}},
+	{ActionSearchPrev, "Jump to the previous match of the search", []string{"N"}},
+	{ActionPrevToolCall, "Select the previous tool call, in the conversation", []string{"Shift+Tab"}},
+	{ActionNextToolCall, "Select the next tool call, in the conversation", []string{"Tab"}},
+	{ActionToggleToolCall, "Expand or collapse the selected tool call", []string{"Enter"}},
+	{ActionFocusPlan, "Move from the conversation to the plan", []string{"p"}},
+	{ActionStepDown, "Select the next step, in the plan", []string{"j"}},
+	{ActionStepUp, "Select the previous step, in the plan", []string{"k"}},
+	{ActionStepDetails, "Show the description and acceptance criteria of the step, in the plan", []string{"Enter"}},
+	{ActionToggleStep, "Mark the step done or to do, in the plan", []string{"x"}},
+	{ActionTogglePlan, "Hide or show the plan", []string{"Ctrl+P"}},
+	{ActionAllowOnce, "Run the tool call waiting for approval", []string{"y"}},
+	{ActionAllowAlways, "Run it and the next calls of the same tool without asking", []string{"a"}},
+	{ActionDeny, "Skip the tool call waiting for approval", []string{"n"}},
+	{ActionRestartServer, "Restart the selected MCP server, in /status", []string{"r"}},
+	{ActionToggleTool, "Disable or enable the selected tool for the session, in /status", []string{"d"}},
+	{ActionRetry, "Run the turn that failed again", []string{"Ctrl+R"}},
+	{ActionErrorDetails, "Show the whole error or only its first line", []string{"Ctrl+G"}},
+	{ActionSwitchConversation, "Switch to another conversation", []string{"Ctrl+O"}},
+	{ActionCancel, "Close a popup or picker, or dismiss the error", []string{"Esc"}},
+	{ActionHelp, "Show the commands, key bindings, model and MCP servers", []string{"F1", "?"}},
+}
+
+// A key with its modifiers, as written in the keymap e.g., "Ctrl+O", "Alt+x", "Shift+Enter", "F1" or "y"
+type Key struct {
+	key tcell.Key
+	// Set for printable keys, with key being tcell.KeyRune
+	r   rune
+	alt bool
+	// Printable keys carry it in their rune instead
+	shift bool
+}
+
+// Lowercased tcell names, plus the spellings people tend to use
+var keysByName = func() map[string]tcell.Key {
+	names := make(map[string]tcell.Key)
+	for k, name := range tcell.KeyNames {
+		// Control keys are parsed from their modifier
+		if !strings.HasPrefix(name, "Ctrl-") {
+			names[strings.ToLower(name)] = k
+		}
+	}
+	names["escape"] = tcell.KeyEsc
+	names["return"] = tcell.KeyEnter
+	names["backspace"] = tcell.KeyBackspace2
+	names["space"] = tcell.KeyRune
+	return names
+}()
+
+func ParseKey(s string) (Key, error) {
+	if utf8.RuneCountInString(s) == 1 {
+		r, _ := utf8.DecodeRuneInString(s)
+		return Key{key: tcell.KeyRune, r: r}, nil
+	}
+
+	parts := strings.Split(s, "+")
+	name := parts[len(parts)-1]
+	var k Key
+	ctrl := false
+	for _, mod := range parts[:len(parts)-1] {
+		switch strings.ToLower(mod) {
+		case "ctrl":
+			ctrl = true
+		case "alt":
+			k.alt = true
+		case "shift":
+			k.shift = true
+		default:
+			return Key{}, fmt.Errorf("unknown modifier %q in key %q", mod, s)
+		}
+	}
+
+	switch {
+	case ctrl && len(name) == 1 && isLetter(name[0]):
+		k.key = tcell.KeyCtrlA + tcell.Key(strings.ToLower(name)[0]-'a')
+	case ctrl && strings.EqualFold(name, "space"):
+		k.key = tcell.KeyCtrlSpace
+	case ctrl:
+		return Key{}, fmt.Errorf("key %q cannot be combined with Ctrl", name)
+	case k.shift && utf8.RuneCountInString(name) == 1:
+		return Key{}, fmt.Errorf("write %q as the character Shift gives instead", s)
+	case utf8.RuneCountInString(name) == 1:
+		k.key = tcell.KeyRune
+		k.r, _ = utf8.DecodeRuneInString(name)
+	default:
+		key, ok := keysByName[strings.ToLower(name)]
+		if !ok {
+			return Key{}, fmt.Errorf("unknown key %q", s)
+		}
+		k.key = key
+		if key == tcell.KeyRune {
+			k.r = ' '
+		}
+		// Terminals report it as a key of its own
+		if key == tcell.KeyTab && k.shift {
+			k.key = tcell.KeyBacktab
+			k.shift = false
+		}
+	}
+
+	return k, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (k Key) Matches(event *tcell.EventKey) bool {
+	if k.alt != (event.Modifiers()&tcell.ModAlt != 0) {
+		return false
+	}
+	if k.key == tcell.KeyRune {
+		return event.Key() == tcell.KeyRune && event.Rune() == k.r
+	}
+	if k.key != tcell.KeyBacktab && k.shift != (event.Modifiers()&tcell.ModShift != 0) {
+		return false
+	}
+	return event.Key() == k.key
+}
+
+func (k Key) String() string {
+	// Tab, Enter and Backspace share their codes with control keys, their own names win
+	name, named := tcell.KeyNames[k.key]
+	switch {
+	case k.key == tcell.KeyRune && k.r == ' ':
+		name = "Space"
+	case k.key == tcell.KeyRune:
+		name = string(k.r)
+	case k.key == tcell.KeyBacktab:
+		name = "Shift+Tab"
+	case named && !strings.HasPrefix(name, "Ctrl-"):
+	case k.key == tcell.KeyCtrlSpace:
+		name = "Ctrl+Space"
+	case k.key >= tcell.KeyCtrlA && k.key <= tcell.KeyCtrlZ:
+		name = "Ctrl+" + string(rune('A'+k.key-tcell.KeyCtrlA))
+	}
+
+	if k.shift {
+		name = "Shift+" + name
+	}
+	if k.alt {
+		return "Alt+" + name
+	}
+	return name
+}
+
+// Keys bound to each action
+type Keymap map[Action][]Key
+
+func DefaultKeymap() Keymap {
+	keys := make(Keymap)
+	for _, a := range actions {
+		for _, s := range a.defaults {
+			k, err := ParseKey(s)
+			if err != nil {
+				panic(err)
+			}
+			keys[a.action] = append(keys[a.action], k)
+		}
+	}
+	return keys
+}
+
+func (m Keymap) Matches(action Action, event *tcell.EventKey) bool {
+	for _, k := range m[action] {
+		if k.Matches(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys of an action for display e.g., "Ctrl+O" or "Esc, Ctrl+G"
+func (m Keymap) Describe(action Action) string {
+	var names []string
+	for _, k := range m[action] {
+		names = append(names, k.String())
+	}
+	if len(names) == 0 {
+		return "unbound"
+	}
+	return strings.Join(names, ", ")
+}
+
+type Binding struct {
+	Action      Action
+	Description string
+	Keys        string
+}
+
+// Effective bindings in a stable order, for the help overlay
+func (m Keymap) Bindings() []Binding {
+	bindings := make([]Binding, 0, len(actions))
+	for _, a := range actions {
+		bindings = append(bindings, Binding{Action: a.action, Description: a.description, Keys: m.Describe(a.action)})
+	}
+	return bindings
+}
+
+// Apply overrides like {"switch_conversation": "Ctrl+T", "copy_code": ["c", "C"]}.
+// An empty list unbinds the action
+func (m Keymap) Override(raw []byte) error {
+	var overrides map[Action]json.RawMessage
+	if err := json.Unmarshal(raw, &overrides); err != nil {
+		return err
+	}
+
+	for action, value := range overrides {
+		if !knownAction(action) {
+			return fmt.Errorf("unknown action %q", action)
+		}
+
+		var names []string
+		var single string
+		if err := json.Unmarshal(value, &single); err == nil {
+			names = []string{single}
+		} else if err := json.Unmarshal(value, &names); err != nil {
+			return fmt.Errorf("keys of %s must be a string or a list of strings", action)
+		}
+
+		keys := []Key{}
+		for _, name := range names {
+			k, err := ParseKey(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", action, err)
+			}
+			keys = append(keys, k)
+		}
+		m[action] = keys
+	}
+
+	return nil
+}
+
+func knownAction(action Action) bool {
+	for _, a := range actions {
+		if a.action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults with the overrides of the keymap file applied, if there is one
+func LoadKeymap() (Keymap, error) {
+	keys := DefaultKeymap()
+
+	path, err := KeymapPath()
+	if err != nil {
+		return keys, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return keys, fmt.Errorf("failed to read keymap: %w", err)
+	}
+
+	if err := keys.Override(raw); err != nil {
+		return keys, fmt.Errorf("invalid keymap %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+func KeymapPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "tinker", keymapFile), nil
+}
@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in    string
+		event *tcell.EventKey
+		want  string
+	}{
+		{"Ctrl+O", tcell.NewEventKey(tcell.KeyCtrlO, 0, tcell.ModCtrl), "Ctrl+O"},
+		{"ctrl+t", tcell.NewEventKey(tcell.KeyCtrlT, 0, tcell.ModCtrl), "Ctrl+T"},
+		{"Esc", tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone), "Esc"},
+		{"enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), "Enter"},
+		{"Tab", tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone), "Tab"},
+		{"Shift+Tab", tcell.NewEventKey(tcell.KeyBacktab, 0, tcell.ModShift), "Shift+Tab"},
+		{"Shift+Enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModShift), "Shift+Enter"},
+		{"Alt+Enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModAlt), "Alt+Enter"},
+		{"Ctrl+J", tcell.NewEventKey(tcell.KeyCtrlJ, 0, tcell.ModCtrl), "Ctrl+J"},
+		{"F1", tcell.NewEventKey(tcell.KeyF1, 0, tcell.ModNone), "F1"},
+		{"PgUp", tcell.NewEventKey(tcell.KeyPgUp, 0, tcell.ModNone), "PgUp"},
+		{"y", tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModNone), "y"},
+		{"Alt+c", tcell.NewEventKey(tcell.KeyRune, 'c', tcell.ModAlt), "Alt+c"},
+		{"Space", tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone), "Space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			k, err := ParseKey(tt.in)
+			if err != nil {
+				t.Fatalf("ParseKey(%q) error = %v", tt.in, err)
+			}
+			if !k.Matches(tt.event) {
+				t.Errorf("%q does not match %s", tt.in, tt.event.Name())
+			}
+			if got := k.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKey_Invalid(t *testing.T) {
+	for _, in := range []string{"Ctrl+F1", "Hyper+x", "NotAKey", "Shift+a"} {
+		if _, err := ParseKey(in); err == nil {
+			t.Errorf("ParseKey(%q) expected error", in)
+		}
+	}
+}
+
+func TestKeymap_Matches_Alt(t *testing.T) {
+	keys := DefaultKeymap()
+
+	if !keys.Matches(ActionCopyResponse, tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModNone)) {
+		t.Error("y should copy the response")
+	}
+	if keys.Matches(ActionCopyResponse, tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModAlt)) {
+		t.Error("Alt+y should not match y")
+	}
+}
+
+func TestKeymap_Matches_Shift(t *testing.T) {
+	keys := DefaultKeymap()
+	shiftEnter := tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModShift)
+
+	if keys.Matches(ActionSubmit, shiftEnter) {
+		t.Error("Shift+Enter should not send the message")
+	}
+	if !keys.Matches(ActionNewline, shiftEnter) {
+		t.Error("Shift+Enter should start a new line")
+	}
+	if keys.Matches(ActionNewline, tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)) {
+		t.Error("Enter should not start a new line")
+	}
+}
+
+func TestKeymap_Override(t *testing.T) {
+	keys := DefaultKeymap()
+
+	err := keys.Override([]byte(`{"switch_conversation": "Ctrl+T", "copy_code": ["c", "C"], "help": []}`))
+	if err != nil {
+		t.Fatalf("Override() error = %v", err)
+	}
+
+	if keys.Matches(ActionSwitchConversation, tcell.NewEventKey(tcell.KeyCtrlO, 0, tcell.ModCtrl)) {
+		t.Error("Ctrl+O should no longer switch conversations")
+	}
+	if !keys.Matches(ActionSwitchConversation, tcell.NewEventKey(tcell.KeyCtrlT, 0, tcell.ModCtrl)) {
+		t.Error("Ctrl+T should switch conversations")
+	}
+	if got := keys.Describe(ActionCopyCode); got != "c, C" {
+		t.Errorf("Describe(copy_code) = %q", got)
+	}
+	if got := keys.Describe(ActionHelp); got != "unbound" {
+		t.Errorf("Describe(help) = %q", got)
+	}
+	// Untouched actions keep their defaults
+	if got := keys.Describe(ActionSubmit); got != "Enter" {
+		t.Errorf("Describe(submit) = %q", got)
+	}
+}
+
+func TestKeymap_Override_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"launch_rockets": "x"}`,
+		`{"help": 1}`,
+		`{"help": "Ctrl+F1"}`,
+	} {
+		if err := DefaultKeymap().Override([]byte(raw)); err == nil {
+			t.Errorf("Override(%s) expected error", raw)
+		}
+	}
+}
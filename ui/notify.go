@@ -0,0 +1,44 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+const (
+	// Never draw attention
+	NotifyOff = "off"
+	// Ring the terminal bell, which most terminals turn into an urgency hint
+	NotifyBell = "bell"
+	// Ring the bell and show a desktop notification too
+	NotifyDesktop = "desktop"
+)
+
+// Tools showing a desktop notification, given its title and body
+var nativeNotifiers = map[string]func(title, body string) []string{
+	"darwin": func(title, body string) []string {
+		return []string{"osascript", "-e", fmt.Sprintf("display notification %q with title %q", body, title)}
+	},
+	"linux": func(title, body string) []string {
+		return []string{"notify-send", "--app-name=tinker", title, body}
+	},
+}
+
+// Show a desktop notification with the tool the platform ships with
+func Notify(title, body string) error {
+	command, ok := nativeNotifiers[runtime.GOOS]
+	if !ok {
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+
+	args := command(title, body)
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return errors.New("no notification tool found, install " + args[0])
+	}
+	if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const settingsFile = "tui.json"
+
+const (
+	// Recall the prompts sent since the TUI started
+	HistorySession = "session"
+	// Also recall those of earlier runs, kept in ~/.tinker
+	HistoryGlobal = "global"
+)
+
+// Behavior of the TUI that is a matter of taste
+type Settings struct {
+	History string `json:"history"`
+	// Take Enter as a newline when it comes right after the previous key, as it does in a paste
+	// the terminal types out because it does not support bracketed paste
+	PasteGuard bool `json:"paste_guard"`
+	// How to tell that a run finished while the terminal was in the background
+	Notify string `json:"notify"`
+	// Tools to ask about before each call, "*" for all of them
+	Approve []string `json:"approve"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{History: HistorySession, PasteGuard: true, Notify: NotifyBell}
+}
+
+func (s Settings) Validate() error {
+	switch s.History {
+	case HistorySession, HistoryGlobal:
+	default:
+		return fmt.Errorf("history must be %q or %q, got %q", HistorySession, HistoryGlobal, s.History)
+	}
+	switch s.Notify {
+	case NotifyOff, NotifyBell, NotifyDesktop:
+	default:
+		return fmt.Errorf("notify must be %q, %q or %q, got %q", NotifyOff, NotifyBell, NotifyDesktop, s.Notify)
+	}
+	return nil
+}
+
+// Whether a call of the tool waits for the user to allow it
+func (s Settings) NeedsApproval(tool string) bool {
+	for _, name := range s.Approve {
+		if name == "*" || name == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults with the settings file applied over them, if there is one
+func LoadSettings() (Settings, error) {
+	settings := DefaultSettings()
+
+	path, err := SettingsPath()
+	if err != nil {
+		return settings, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("failed to read settings: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return DefaultSettings(), fmt.Errorf("invalid settings file %s: %w", path, err)
+	}
+	if err := settings.Validate(); err != nil {
+		return DefaultSettings(), fmt.Errorf("invalid settings file %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+func SettingsPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "tinker", settingsFile), nil
+}
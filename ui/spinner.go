@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -36,17 +37,26 @@ var (
 	}
 )
 
+// Rough size of a token in characters, good enough to show the response growing
+const charsPerToken = 4
+
 type Spinner struct {
+	// What the agent is doing e.g., "Thinking" or "Running grep_search"
+	phase atomic.Value
+	// Characters of the response received so far
+	received     atomic.Int64
 	message      atomic.Value
 	messageWidth int
 	parts        []string
-	value        int
-	ticker       *time.Ticker
-	started      time.Time
-	stopped      time.Time
+	// Index of the part shown, advanced by the ticker goroutine
+	value   atomic.Int64
+	started time.Time
+	// Time elapsed when stopped, zero while running.
+	// Written by Stop and read from the render goroutine
+	stopped atomic.Int64
 }
 
-func NewSpinner(message string, parts []string) *Spinner {
+func NewSpinner(phase string, parts []string) *Spinner {
 	if len(parts) == 0 {
 		parts = SpinnerBinary
 	}
@@ -54,25 +64,61 @@ func NewSpinner(message string, parts []string) *Spinner {
 		parts:   parts,
 		started: time.Now(),
 	}
-	s.SetMessage(message)
+	s.SetPhase(phase)
 	go s.start()
 	return s
 }
 
+// Move on to another phase, dropping the message of the previous one
+func (s *Spinner) SetPhase(phase string) {
+	s.phase.Store(phase)
+	s.message.Store("")
+}
+
+func (s *Spinner) Phase() string {
+	phase, _ := s.phase.Load().(string)
+	return phase
+}
+
+// Progress reported within the phase e.g., by a long-running tool
 func (s *Spinner) SetMessage(message string) {
 	s.message.Store(message)
 }
 
-// Display the spinner with a message
+// Count text streamed from the model towards the tokens shown
+func (s *Spinner) Receive(text string) {
+	s.received.Add(int64(utf8.RuneCountInString(text)))
+}
+
+// Tokens received so far, estimated from the characters
+func (s *Spinner) Tokens() int {
+	return int((s.received.Load() + charsPerToken - 1) / charsPerToken)
+}
+
+func (s *Spinner) Elapsed() time.Duration {
+	if stopped := s.stopped.Load(); stopped != 0 {
+		return time.Duration(stopped)
+	}
+	return time.Since(s.started)
+}
+
+// Display the spinner with the phase, time elapsed, tokens received and message
 func (s *Spinner) String() string {
 	var sb strings.Builder
 
-	if s.stopped.IsZero() {
-		spinner := s.parts[s.value]
+	if s.stopped.Load() == 0 {
+		spinner := s.parts[s.value.Load()]
 		sb.WriteString(spinner)
 		sb.WriteString(" ")
 	}
 
+	sb.WriteString(s.Phase())
+	fmt.Fprintf(&sb, " · %s", s.Elapsed().Truncate(time.Second))
+	if tokens := s.Tokens(); tokens > 0 {
+		fmt.Fprintf(&sb, " · ~%d tokens", tokens)
+	}
+	sb.WriteString(" ")
+
 	if message, ok := s.message.Load().(string); ok && len(message) > 0 {
 		message := strings.TrimSpace(message)
 		if s.messageWidth > 0 && len(message) > s.messageWidth {
@@ -95,19 +141,20 @@ func (s *Spinner) String() string {
 }
 
 func (s *Spinner) start() {
-	s.ticker = time.NewTicker(100 * time.Millisecond)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
 	// Ticks are delivered via channel C
-	for range s.ticker.C {
+	for range ticker.C {
 		// Use modulo to wrap around i.e., change the s.value to indices of the parts array
-		s.value = (s.value + 1) % len(s.parts)
-		if !s.stopped.IsZero() {
+		s.value.Store((s.value.Load() + 1) % int64(len(s.parts)))
+		if s.stopped.Load() != 0 {
 			return
 		}
 	}
 }
 
+// Freeze the time elapsed, only the first call counts
 func (s *Spinner) Stop() {
-	if s.stopped.IsZero() {
-		s.stopped = time.Now()
-	}
+	// At least a nanosecond, zero means running
+	s.stopped.CompareAndSwap(0, int64(max(time.Since(s.started), 1)))
 }
@@ -0,0 +1,23 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpinner_String(t *testing.T) {
+	s := NewSpinner("Thinking", SpinnerStar)
+	defer s.Stop()
+
+	s.SetMessage("fetch: 3/10 pages")
+	s.SetPhase("Responding")
+	s.Receive("Hello, wörld")
+
+	got := s.String()
+	if !strings.Contains(got, "Responding · 0s · ~3 tokens") {
+		t.Errorf("String() = %q", got)
+	}
+	if strings.Contains(got, "fetch") {
+		t.Errorf("the message of the previous phase should be dropped: %q", got)
+	}
+}
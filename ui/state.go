@@ -1,12 +1,48 @@
 package ui
 
-import "github.com/honganh1206/tinker/server/data"
+import (
+	"time"
+
+	"github.com/honganh1206/tinker/inference"
+	"github.com/honganh1206/tinker/server/data"
+)
 
 type State struct {
 	Plan *data.Plan
+	// Health of the active MCP servers, nil if unchanged
+	MCPServers []MCPServerStatus
+	// Progress reported by a long-running tool e.g., "fetch: 3/10 pages downloaded"
+	ToolProgress string
+	// Tokens of the last inference call and the cost so far, nil if unchanged
+	Usage *UsageStatus
 	// TODO: Can we handle response delta here too?
 }
 
+type UsageStatus struct {
+	inference.Usage
+	// In USD since the agent started, 0 when no model in use has known pricing
+	SessionCost float64
+}
+
+const (
+	MCPStarting   = "starting"
+	MCPRunning    = "running"
+	MCPFailed     = "failed"
+	MCPRestarting = "restarting"
+)
+
+type MCPServerStatus struct {
+	ID      string
+	Healthy bool
+	Latency time.Duration
+	// One of MCPStarting, MCPRunning, MCPFailed or MCPRestarting
+	State string
+	// Tools of the server offered to the model
+	Tools int
+	// Why the server failed to start or stopped answering pings, empty when fine
+	Err string
+}
+
 type Controller struct {
 	Updates chan *State
 }
@@ -20,6 +56,15 @@ func (c *Controller) Publish(s *State) {
 	c.Updates <- s
 }
 
+// Publish without blocking, dropping the update if nobody is listening.
+// Used for periodic updates that are superseded by the next one anyway
+func (c *Controller) TryPublish(s *State) {
+	select {
+	case c.Updates <- s:
+	default:
+	}
+}
+
 func (c *Controller) Subscribe() <-chan *State {
 	return c.Updates
 }
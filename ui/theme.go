@@ -0,0 +1,260 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	ThemeEnv  = "TINKER_THEME"
+	themeFile = "theme.json"
+)
+
+// Colors of the TUI by role, as tview color names e.g., "gray" or "#839496"
+type Theme struct {
+	Name       string `json:"-"`
+	Background string `json:"background"`
+	// Assistant responses
+	Text string `json:"text"`
+	// Secondary information e.g., notes, ages, descriptions
+	Muted string `json:"muted"`
+	// What the user typed
+	User string `json:"user"`
+	// Commands, keys and the model name
+	Accent  string `json:"accent"`
+	Success string `json:"success"`
+	Warning string `json:"warning"`
+	Error   string `json:"error"`
+	// Paths and other details of tool results
+	Detail      string `json:"detail"`
+	Border      string `json:"border"`
+	FocusBorder string `json:"focus_border"`
+	Selection   string `json:"selection"`
+	Spinner     string `json:"spinner"`
+	Logo        string `json:"logo"`
+}
+
+var themes = map[string]Theme{
+	"dark": {
+		Background:  "black",
+		Text:        "white",
+		Muted:       "gray",
+		User:        "blue",
+		Accent:      "yellow",
+		Success:     "green",
+		Warning:     "yellow",
+		Error:       "red",
+		Detail:      "blue",
+		Border:      "white",
+		FocusBorder: "green",
+		Selection:   "darkcyan",
+		Spinner:     "white",
+		Logo:        "green",
+	},
+	"light": {
+		Background:  "white",
+		Text:        "black",
+		Muted:       "#6c6c6c",
+		User:        "navy",
+		Accent:      "#875f00",
+		Success:     "darkgreen",
+		Warning:     "#af5f00",
+		Error:       "darkred",
+		Detail:      "navy",
+		Border:      "black",
+		FocusBorder: "darkgreen",
+		Selection:   "lightblue",
+		Spinner:     "black",
+		Logo:        "darkgreen",
+	},
+	"high-contrast": {
+		Background:  "black",
+		Text:        "white",
+		Muted:       "silver",
+		User:        "aqua",
+		Accent:      "yellow",
+		Success:     "lime",
+		Warning:     "yellow",
+		Error:       "#ff5f5f",
+		Detail:      "aqua",
+		Border:      "white",
+		FocusBorder: "yellow",
+		Selection:   "blue",
+		Spinner:     "yellow",
+		Logo:        "white",
+	},
+}
+
+const DefaultTheme = "dark"
+
+var activeTheme atomic.Pointer[Theme]
+
+// Theme in use, dark until SetTheme is called
+func CurrentTheme() Theme {
+	if t := activeTheme.Load(); t != nil {
+		return *t
+	}
+	return BuiltinTheme(DefaultTheme)
+}
+
+// Use t from now on, including for the defaults of tview primitives created afterwards
+func SetTheme(t Theme) {
+	activeTheme.Store(&t)
+
+	tview.Styles.PrimitiveBackgroundColor = tcell.GetColor(t.Background)
+	tview.Styles.ContrastBackgroundColor = tcell.GetColor(t.Selection)
+	tview.Styles.MoreContrastBackgroundColor = tcell.GetColor(t.Selection)
+	tview.Styles.BorderColor = tcell.GetColor(t.Border)
+	tview.Styles.TitleColor = tcell.GetColor(t.Text)
+	tview.Styles.GraphicsColor = tcell.GetColor(t.Border)
+	tview.Styles.PrimaryTextColor = tcell.GetColor(t.Text)
+	tview.Styles.SecondaryTextColor = tcell.GetColor(t.Accent)
+	tview.Styles.TertiaryTextColor = tcell.GetColor(t.Success)
+	tview.Styles.InverseTextColor = tcell.GetColor(t.Background)
+	tview.Styles.ContrastSecondaryTextColor = tcell.GetColor(t.Muted)
+}
+
+func BuiltinTheme(name string) Theme {
+	t := themes[name]
+	t.Name = name
+	return t
+}
+
+func BuiltinThemes() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Layout of theme.json
+type themeConfig struct {
+	// Built-in or defined below
+	Theme  string                 `json:"theme"`
+	Themes map[string]customTheme `json:"themes"`
+}
+
+// Colors left out are taken from the base theme
+type customTheme struct {
+	Base string `json:"base"`
+	Theme
+}
+
+// Resolve the theme from the theme file, then the environment, each one overriding the previous
+func LoadTheme() (Theme, error) {
+	return LoadThemeNamed("")
+}
+
+// Like LoadTheme, with name set in the config file overriding the theme file
+func LoadThemeNamed(name string) (Theme, error) {
+	var cfg themeConfig
+
+	path, err := ThemePath()
+	if err == nil {
+		raw, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return CurrentTheme(), fmt.Errorf("failed to read theme: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(raw, &cfg); err != nil {
+				return CurrentTheme(), fmt.Errorf("invalid theme file %s: %w", path, err)
+			}
+		}
+	}
+
+	if name != "" {
+		cfg.Theme = name
+	}
+	if name := os.Getenv(ThemeEnv); name != "" {
+		cfg.Theme = name
+	}
+
+	t, err := resolveTheme(cfg.Theme, cfg.Themes)
+	if err != nil {
+		return CurrentTheme(), err
+	}
+	return t, nil
+}
+
+func resolveTheme(name string, custom map[string]customTheme) (Theme, error) {
+	if name == "" {
+		name = DefaultTheme
+	}
+
+	c, ok := custom[name]
+	if !ok {
+		if _, builtin := themes[name]; !builtin {
+			return Theme{}, fmt.Errorf("unknown theme %q, built-in themes are %s", name, strings.Join(BuiltinThemes(), ", "))
+		}
+		return BuiltinTheme(name), nil
+	}
+
+	base := c.Base
+	if base == "" {
+		base = DefaultTheme
+	}
+	if _, builtin := themes[base]; !builtin {
+		return Theme{}, fmt.Errorf("theme %s: unknown base %q", name, base)
+	}
+
+	t := BuiltinTheme(base)
+	t.merge(c.Theme)
+	t.Name = name
+
+	if err := t.Validate(); err != nil {
+		return Theme{}, fmt.Errorf("theme %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Take the colors set in other
+func (t *Theme) merge(other Theme) {
+	dst := reflect.ValueOf(t).Elem()
+	src := reflect.ValueOf(other)
+	for i := 0; i < src.NumField(); i++ {
+		if v := src.Field(i).String(); v != "" {
+			dst.Field(i).SetString(v)
+		}
+	}
+}
+
+// Every color must be one tview knows
+func (t Theme) Validate() error {
+	v := reflect.ValueOf(t)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("json")
+		if key == "-" {
+			continue
+		}
+
+		color := v.Field(i).String()
+		if color == "" {
+			return fmt.Errorf("%s is not set", key)
+		}
+		if color != "default" && tcell.GetColor(color) == tcell.ColorDefault {
+			return fmt.Errorf("%s: unknown color %q", key, color)
+		}
+	}
+	return nil
+}
+
+func ThemePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "tinker", themeFile), nil
+}
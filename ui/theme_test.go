@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinThemes_Valid(t *testing.T) {
+	for _, name := range BuiltinThemes() {
+		if err := BuiltinTheme(name).Validate(); err != nil {
+			t.Errorf("theme %s: %v", name, err)
+		}
+	}
+}
+
+func TestResolveTheme_Custom(t *testing.T) {
+	custom := map[string]customTheme{
+		"solarized": {Base: "light", Theme: Theme{Background: "#fdf6e3", Accent: "#b58900"}},
+	}
+
+	got, err := resolveTheme("solarized", custom)
+	if err != nil {
+		t.Fatalf("resolveTheme error = %v", err)
+	}
+
+	if got.Name != "solarized" {
+		t.Errorf("Name = %q, want solarized", got.Name)
+	}
+	if got.Background != "#fdf6e3" || got.Accent != "#b58900" {
+		t.Errorf("overrides not applied: %+v", got)
+	}
+	if light := BuiltinTheme("light"); got.Text != light.Text || got.Error != light.Error {
+		t.Errorf("colors left out should come from the base theme: %+v", got)
+	}
+}
+
+func TestResolveTheme_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		custom map[string]customTheme
+	}{
+		{"unknown", nil},
+		{"bad-base", map[string]customTheme{"bad-base": {Base: "sepia"}}},
+		{"bad-color", map[string]customTheme{"bad-color": {Theme: Theme{Error: "not-a-color"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := resolveTheme(tt.name, tt.custom); err == nil {
+				t.Errorf("resolveTheme(%q) expected error", tt.name)
+			}
+		})
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv(ThemeEnv, "")
+
+	got, err := LoadTheme()
+	if err != nil {
+		t.Fatalf("LoadTheme without a file error = %v", err)
+	}
+	if got.Name != DefaultTheme {
+		t.Errorf("Name = %q, want %q", got.Name, DefaultTheme)
+	}
+
+	path, err := ThemePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"theme": "light"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = LoadTheme()
+	if err != nil {
+		t.Fatalf("LoadTheme error = %v", err)
+	}
+	if got.Name != "light" {
+		t.Errorf("Name = %q, want light", got.Name)
+	}
+
+	t.Setenv(ThemeEnv, "high-contrast")
+	got, err = LoadTheme()
+	if err != nil {
+		t.Fatalf("LoadTheme error = %v", err)
+	}
+	if got.Name != "high-contrast" {
+		t.Errorf("the environment should win over the file, got %q", got.Name)
+	}
+}
@@ -0,0 +1,291 @@
+// Package update finds newer releases of tinker on GitHub and replaces the running binary with them
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	repo = "honganh1206/tinker"
+	// Asset of each release listing the SHA-256 of the binaries, as sha256sum writes it
+	checksumsAsset = "checksums.txt"
+	// Binaries are tens of MB, anything past this is not one of them
+	maxDownloadSize = 256 << 20
+)
+
+// Overridden by tests
+var apiURL = "https://api.github.com"
+
+var ErrNoAsset = errors.New("no binary for this platform in the release")
+
+type Release struct {
+	// Tag of the release, e.g., 0.2.5
+	Version string
+	// Download URLs by asset name
+	Assets map[string]string
+}
+
+// Latest published release of tinker
+func Latest(ctx context.Context) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"/repos/"+repo+"/releases/latest", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for releases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check for releases: %s", resp.Status)
+	}
+
+	var body struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid release: %w", err)
+	}
+
+	rel := &Release{Version: strings.TrimPrefix(body.TagName, "v"), Assets: make(map[string]string)}
+	for _, a := range body.Assets {
+		rel.Assets[a.Name] = a.URL
+	}
+	return rel, nil
+}
+
+// Name of the binary built by scripts/build.sh for a platform
+func AssetName(version, goos, goarch string) string {
+	name := fmt.Sprintf("tinker_%s_%s_%s", version, goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Whether latest is a later version than current. Development builds are never behind
+func Newer(current, latest string) bool {
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+
+	for i := range c {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+// Major, minor and patch of a version such as v1.2.3, pre-release suffixes ignored
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "-")
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// Download the binary of rel for this platform, check it against the checksums of the release
+// and put it in place of the executable at exe
+func Apply(ctx context.Context, rel *Release, exe string) error {
+	name := AssetName(rel.Version, runtime.GOOS, runtime.GOARCH)
+	binURL, ok := rel.Assets[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoAsset, name)
+	}
+	sumsURL, ok := rel.Assets[checksumsAsset]
+	if !ok {
+		// An unverified binary is not worth the risk
+		return fmt.Errorf("release %s has no %s to verify the binary with", rel.Version, checksumsAsset)
+	}
+
+	sums, err := download(ctx, sumsURL)
+	if err != nil {
+		return err
+	}
+	want, err := checksumOf(sums, name)
+	if err != nil {
+		return err
+	}
+
+	bin, err := download(ctx, binURL)
+	if err != nil {
+		return err
+	}
+	got := sha256.Sum256(bin)
+	if hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s, the download is corrupted or was tampered with", name)
+	}
+
+	return replace(exe, bin)
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("failed to download %s: larger than %d MB", url, maxDownloadSize>>20)
+	}
+	return body, nil
+}
+
+// SHA-256 of name in the output of sha256sum
+func checksumOf(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Binary mode marks the name with a *
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s in %s", name, checksumsAsset)
+}
+
+// Swap the executable at exe for bin. The new file is written next to it first,
+// so a failure leaves the old one working
+func replace(exe string, bin []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(exe)
+	tmp, err := os.CreateTemp(dir, ".tinker-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write to %s, run the update with permissions on it: %w", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+
+	// Windows does not let a running executable be replaced, only renamed
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(old)
+	}
+	return nil
+}
+
+// What the last check found, so startup does not wait on the network
+type state struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest"`
+}
+
+// Checks closer together than this reuse the last result
+const checkInterval = 24 * time.Hour
+
+// Version newer than current found by the last check, empty when there is none.
+// Reads the state file at path only, Refresh is what goes to the network
+func Notice(path, current string) string {
+	s, err := readState(path)
+	if err != nil || !Newer(current, s.Latest) {
+		return ""
+	}
+	return s.Latest
+}
+
+// Look up the latest release if the last check is older than a day, and remember it in the state file at path
+func Refresh(ctx context.Context, path string) error {
+	s, err := readState(path)
+	if err == nil && time.Since(s.CheckedAt) < checkInterval {
+		return nil
+	}
+
+	rel, err := Latest(ctx)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(state{CheckedAt: time.Now(), Latest: rel.Version})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
+
+func readState(path string) (state, error) {
+	var s state
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(raw, &s)
+}
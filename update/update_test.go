@@ -0,0 +1,156 @@
+package update
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		want            bool
+	}{
+		{"0.2.5", "0.2.6", true},
+		{"0.2.5", "v0.10.0", true},
+		{"0.2.5", "1.0.0", true},
+		{"0.2.5", "0.2.5", false},
+		{"0.3.0", "0.2.9", false},
+		{"0.2.5-rc1", "0.2.5", false},
+		{"dev", "9.9.9", false},
+		{"0.2.5", "nightly", false},
+	}
+
+	for _, tt := range tests {
+		if got := Newer(tt.current, tt.latest); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.current, tt.latest, got, tt.want)
+		}
+	}
+}
+
+// Serve a release of version with the binary for this platform and its checksums
+func serveRelease(t *testing.T, version string, bin []byte, sum string) {
+	t.Helper()
+
+	name := AssetName(version, runtime.GOOS, runtime.GOARCH)
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/repos/"+repo+"/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"tag_name": "v" + version,
+			"assets": []map[string]string{
+				{"name": name, "browser_download_url": srv.URL + "/bin"},
+				{"name": checksumsAsset, "browser_download_url": srv.URL + "/sums"},
+			},
+		})
+	})
+	mux.HandleFunc("/bin", func(w http.ResponseWriter, r *http.Request) { w.Write(bin) })
+	mux.HandleFunc("/sums", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  some_other_file\n%s  %s\n", sum, sum, name)
+	})
+
+	old := apiURL
+	apiURL = srv.URL
+	t.Cleanup(func() { apiURL = old })
+}
+
+func TestApply(t *testing.T) {
+	bin := []byte("new binary")
+	sum := sha256.Sum256(bin)
+	serveRelease(t, "0.3.0", bin, hex.EncodeToString(sum[:]))
+
+	exe := filepath.Join(t.TempDir(), "tinker")
+	if err := os.WriteFile(exe, []byte("old binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if rel.Version != "0.3.0" {
+		t.Errorf("Version = %q, want the tag without its v", rel.Version)
+	}
+
+	if err := Apply(context.Background(), rel, exe); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(exe)
+	if string(got) != "new binary" {
+		t.Errorf("executable = %q, want the new binary", got)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm()&0o111 == 0 {
+		t.Error("the new binary is not executable")
+	}
+}
+
+func TestApply_ChecksumMismatch(t *testing.T) {
+	serveRelease(t, "0.3.0", []byte("tampered"), hex.EncodeToString(make([]byte, sha256.Size)))
+
+	exe := filepath.Join(t.TempDir(), "tinker")
+	os.WriteFile(exe, []byte("old binary"), 0o755)
+
+	rel, err := Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if err := Apply(context.Background(), rel, exe); err == nil {
+		t.Fatal("Apply accepted a binary that does not match its checksum")
+	}
+
+	got, _ := os.ReadFile(exe)
+	if string(got) != "old binary" {
+		t.Errorf("executable = %q, a failed update must leave it alone", got)
+	}
+}
+
+func TestApply_NoAsset(t *testing.T) {
+	rel := &Release{Version: "0.3.0", Assets: map[string]string{}}
+	if err := Apply(context.Background(), rel, "tinker"); !errors.Is(err, ErrNoAsset) {
+		t.Errorf("Apply() = %v, want ErrNoAsset", err)
+	}
+}
+
+func TestRefreshAndNotice(t *testing.T) {
+	serveRelease(t, "0.3.0", nil, "")
+	path := filepath.Join(t.TempDir(), "update.json")
+
+	if got := Notice(path, "0.2.5"); got != "" {
+		t.Errorf("Notice() = %q before any check", got)
+	}
+
+	if err := Refresh(context.Background(), path); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if got := Notice(path, "0.2.5"); got != "0.3.0" {
+		t.Errorf("Notice() = %q, want 0.3.0", got)
+	}
+	if got := Notice(path, "0.3.0"); got != "" {
+		t.Errorf("Notice() = %q when up to date", got)
+	}
+
+	// A recent check is not repeated
+	apiURL = "http://127.0.0.1:0"
+	if err := Refresh(context.Background(), path); err != nil {
+		t.Errorf("Refresh went to the network after a recent check: %v", err)
+	}
+
+	raw, _ := json.Marshal(state{CheckedAt: time.Now().Add(-2 * checkInterval), Latest: "0.3.0"})
+	os.WriteFile(path, raw, 0o644)
+	if err := Refresh(context.Background(), path); err == nil {
+		t.Error("Refresh did not check again after a day")
+	}
+}
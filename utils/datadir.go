@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Directory holding the database, logs and other state, created on first use.
+// ~/.tinker on Unix, %AppData%\tinker on Windows where dotted home directories are foreign
+func DataDir() (string, error) {
+	if runtime.GOOS == "windows" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(configDir, "tinker"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".tinker"), nil
+}
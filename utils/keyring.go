@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var (
+	ErrSecretNotFound     = errors.New("secret not found in the keyring")
+	ErrKeyringUnsupported = errors.New("no supported keyring on this system, the login keychain on macOS or secret-tool on Linux")
+)
+
+// Secret stored for service and account in the OS keyring:
+// the login keychain on macOS, the Secret Service through secret-tool on Linux
+func GetSecret(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return "", ErrKeyringUnsupported
+		}
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", ErrKeyringUnsupported
+	}
+
+	out, err := cmd.Output()
+	secret := strings.TrimSpace(string(out))
+	// Both tools exit with an error when nothing is stored
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) || (err == nil && secret == "") {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the keyring: %w", err)
+	}
+	return secret, nil
+}
+
+// Store secret for service and account, replacing the one stored before.
+// The secret goes through stdin, never the arguments other users can list
+func SetSecret(service, account, secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", service, account, secret))
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return ErrKeyringUnsupported
+		}
+		cmd = exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return ErrKeyringUnsupported
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write the keyring: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Remove the secret of service and account, nothing stored is not an error
+func DeleteSecret(service, account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", service, "-a", account)
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return ErrKeyringUnsupported
+		}
+		cmd = exec.Command("secret-tool", "clear", "service", service, "account", account)
+	default:
+		return ErrKeyringUnsupported
+	}
+
+	if _, err := GetSecret(service, account); errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to delete from the keyring: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The lock is held by another process
+var ErrLocked = errors.New("file is locked by another process")
+
+// FileLock is an exclusive advisory lock on a file, released when the process exits
+type FileLock struct {
+	file *os.File
+}
+
+// Take the lock on path without waiting, creating the file if needed.
+// Returns ErrLocked when another process holds it
+func LockFile(path string) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileLock{file: file}, nil
+}
+
+func (l *FileLock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
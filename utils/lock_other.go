@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package utils
+
+import "os"
+
+// Nothing to lock with, every process gets the lock
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
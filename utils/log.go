@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"path/filepath"
+)
+
+const (
+	logMaxSize    = 10 * 1024 * 1024
+	logMaxBackups = 3
+)
+
+// Formats of the log file, one record per line
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log file of the given name under the data directory, e.g., ~/.tinker/logs/tinker.log
+func LogPath(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "logs", name+".log"), nil
+}
+
+// Level named debug, info, warn or error
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// Send slog and the standard logger to the rotating file at path, dropping records below level.
+// Records are written as text, or JSON for LogFormatJSON, and also to each of also, e.g., the stderr of the server
+func SetupLogging(path string, level slog.Level, format string, also ...io.Writer) (*RotatingFile, error) {
+	if format != LogFormatText && format != LogFormatJSON {
+		return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+
+	file, err := NewRotatingFile(path, logMaxSize, logMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = file
+	if len(also) > 0 {
+		w = io.MultiWriter(append([]io.Writer{file}, also...)...)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if format == LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	// SetDefault routes log.Printf through the handler, which adds the time already
+	log.SetFlags(0)
+
+	return file, nil
+}
+
+// Logger whose records carry the component they come from, e.g., component=mcp.
+// Records go to the default logger at the time they are logged, so package level
+// loggers made before SetupLogging end up in the log file too
+func Logger(component string) *slog.Logger {
+	return slog.New(defaultHandler{}).With("component", component)
+}
+
+// Hands records to the handler of the default logger, with the attributes and groups
+// added to it since
+type defaultHandler struct {
+	wrap func(slog.Handler) slog.Handler
+}
+
+func (h defaultHandler) handler() slog.Handler {
+	handler := slog.Default().Handler()
+	if h.wrap != nil {
+		handler = h.wrap(handler)
+	}
+	return handler
+}
+
+func (h defaultHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (h defaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, r)
+}
+
+func (h defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h defaultHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h defaultHandler) with(next func(slog.Handler) slog.Handler) slog.Handler {
+	prev := h.wrap
+	return defaultHandler{wrap: func(handler slog.Handler) slog.Handler {
+		if prev != nil {
+			handler = prev(handler)
+		}
+		return next(handler)
+	}}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Git root containing dir, or dir itself outside of a repository.
+// Conversations and plans are grouped by it, so unrelated repos don't mingle
+func ProjectRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	for current := dir; ; {
+		// A file in worktrees and submodules, a directory otherwise
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// Project of the working directory, empty when it cannot be determined
+func CurrentProject() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	return ProjectRoot(wd)
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestRotatingFile_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "tinker.log")
+	r, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// Each write fills the file, so every next one rotates it
+	for _, line := range []string{"aaaaaaaaa\n", "bbbbbbbbb\n", "ccccccccc\n", "ddddddddd\n"} {
+		n, err := r.Write([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+
+	assert.Equal(t, "ddddddddd\n", readLog(t, path))
+	assert.Equal(t, "ccccccccc\n", readLog(t, path+".1"))
+	assert.Equal(t, "bbbbbbbbb\n", readLog(t, path+".2"))
+	// The oldest one is gone past maxBackups
+	assert.NoFileExists(t, path+".3")
+	for _, backup := range []string{path, path + ".1", path + ".2"} {
+		assert.NotContains(t, readLog(t, backup), "a")
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tinker.log")
+	require.NoError(t, os.WriteFile(path, []byte("12345678\n"), 0o644))
+
+	// The size of what is already there counts towards the limit
+	r, err := NewRotatingFile(path, 10, 1)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Write([]byte("next\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "next\n", readLog(t, path))
+	assert.Equal(t, "12345678\n", readLog(t, path+".1"))
+}
+
+func TestRotatingFile_NoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tinker.log")
+	r, err := NewRotatingFile(path, 10, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Write([]byte(strings.Repeat("x", 10)))
+	require.NoError(t, err)
+	_, err = r.Write([]byte("y"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "y", readLog(t, path))
+	assert.NoFileExists(t, path+".1")
+}
+
+func TestRotatingFile_WriteAfterClose(t *testing.T) {
+	r, err := NewRotatingFile(filepath.Join(t.TempDir(), "tinker.log"), 10, 1)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	_, err = r.Write([]byte("late"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}